@@ -0,0 +1,382 @@
+// Package client is a Go SDK for ApexCoin nodes. It wraps the node's
+// JSON-RPC API with typed methods, polls the chain for new blocks and
+// transactions, and builds and broadcasts transactions using the wallet
+// and crypto packages, so services need not re-implement the encoding.
+package client
+
+import (
+	"errors"
+
+	"blockchain/crypto"
+	"blockchain/rpc"
+	"blockchain/types"
+)
+
+// Client talks to a single node. It satisfies wallet.ChainReader, so it
+// can be passed to wallet.Scan and the transaction builders.
+type Client struct {
+	rpc *rpc.Client
+}
+
+// New creates a client for the node RPC at url
+// (e.g. "http://127.0.0.1:9100")
+func New(url string) *Client {
+	return &Client{rpc: rpc.NewClient(url)}
+}
+
+// SetProxy routes requests through a SOCKS5 proxy such as Tor
+func (c *Client) SetProxy(addr string) {
+	c.rpc.SetProxy(addr)
+}
+
+// SetAuthToken sets the bearer token sent with every request, needed
+// for admin methods
+func (c *Client) SetAuthToken(token string) {
+	c.rpc.SetAuthToken(token)
+}
+
+// Call invokes a method that has no typed wrapper
+func (c *Client) Call(method string, params interface{}, result interface{}) error {
+	return c.rpc.Call(method, params, result)
+}
+
+// ForkInfo is the result of GetForks
+type ForkInfo struct {
+	Height          uint64             `json:"height"`
+	ProtocolVersion uint32             `json:"protocol_version"` // Highest version the node supports
+	ActiveVersion   uint32             `json:"active_version"`   // Version in force at Height
+	Forks           types.ForkSchedule `json:"forks"`
+	Next            *types.Fork        `json:"next,omitempty"`
+}
+
+// SupplyInfo is the result of GetSupply
+type SupplyInfo struct {
+	Height      uint64               `json:"height"`
+	TotalSupply uint64               `json:"total_supply"`
+	NextSubsidy uint64               `json:"next_subsidy"`
+	Emission    types.EmissionConfig `json:"emission"`
+}
+
+// SupplyDetails is the result of GetSupplyInfo. TotalSupply always
+// equals Genesis + Minted + Released - Burned.
+type SupplyDetails struct {
+	Height      uint64 `json:"height"`
+	TotalSupply uint64 `json:"total_supply"`
+	SupplyCap   uint64 `json:"supply_cap"`
+	Unissued    uint64 `json:"unissued"` // Left to emit before the cap
+	Staked      uint64 `json:"staked"`
+	types.SupplyStats
+}
+
+// TreasuryInfo is the result of GetTreasury
+type TreasuryInfo struct {
+	Height          uint64 `json:"height"`
+	TreasuryPercent uint64 `json:"treasury_percent"`
+	NextCredit      uint64 `json:"next_credit"` // Share of the next block's subsidy
+	types.Treasury
+}
+
+// ValidatorsInfo is the result of GetValidators
+type ValidatorsInfo struct {
+	Height        uint64                  `json:"height"`
+	MaxValidators int                     `json:"max_validators"` // 0 for no limit
+	EpochLength   uint64                  `json:"epoch_length"`
+	NextRotation  uint64                  `json:"next_rotation"` // Height whose block rotates the set
+	Active        []*types.ValidatorState `json:"active"`
+	Queued        []*types.ValidatorState `json:"queued"`
+	Jailed        []*types.ValidatorState `json:"jailed"`    // Out of the set for downtime
+	Unbonding     []*types.ValidatorState `json:"unbonding"` // Stake waiting to be released
+
+	// Bonding requirements and commission limits (basis points)
+	MinValidatorStake   uint64 `json:"min_validator_stake"`
+	MinSelfBond         uint64 `json:"min_self_bond"`
+	MaxCommission       uint32 `json:"max_commission"`
+	MaxCommissionChange uint32 `json:"max_commission_change"`
+}
+
+// ValidatorLiveness is one validator's row in LivenessInfo
+type ValidatorLiveness struct {
+	Validator       types.PublicKey `json:"validator"`
+	Status          string          `json:"status"` // active, queued, jailed or inactive
+	Online          bool            `json:"online"` // Heartbeat seen recently
+	LastHeartbeat   int64           `json:"last_heartbeat,omitempty"`
+	HeartbeatHeight uint64          `json:"heartbeat_height,omitempty"`
+	MissedBlocks    uint64          `json:"missed_blocks"`
+	JailedUntil     uint64          `json:"jailed_until,omitempty"`
+}
+
+// LivenessInfo is the result of GetValidatorLiveness
+type LivenessInfo struct {
+	Window     uint64              `json:"window"`
+	Validators []ValidatorLiveness `json:"validators"`
+}
+
+// ProofResult is the result of VerifyTxProof
+type ProofResult struct {
+	Valid  bool   `json:"valid"`
+	Amount uint64 `json:"amount"`
+	Error  string `json:"error,omitempty"`
+}
+
+// GetLatestHeight returns the height of the node's latest block
+func (c *Client) GetLatestHeight() (uint64, error) {
+	var result struct {
+		Height uint64 `json:"height"`
+	}
+	if err := c.rpc.Call("getHeight", nil, &result); err != nil {
+		return 0, err
+	}
+	return result.Height, nil
+}
+
+// GetChainID returns the chain the node follows
+func (c *Client) GetChainID() (string, error) {
+	var result struct {
+		ChainID string `json:"chain_id"`
+	}
+	if err := c.rpc.Call("getChainId", nil, &result); err != nil {
+		return "", err
+	}
+	return result.ChainID, nil
+}
+
+// GetBlock returns the block at height
+func (c *Client) GetBlock(height uint64) (*types.Block, error) {
+	var block types.Block
+	params := map[string]uint64{"height": height}
+	if err := c.rpc.Call("getBlock", params, &block); err != nil {
+		return nil, err
+	}
+	return &block, nil
+}
+
+// GetTransaction returns a confirmed transaction by hash
+func (c *Client) GetTransaction(hash types.Hash) (*types.Transaction, error) {
+	var tx types.Transaction
+	params := map[string]string{"hash": hash.String()}
+	if err := c.rpc.Call("getTransaction", params, &tx); err != nil {
+		return nil, err
+	}
+	return &tx, nil
+}
+
+// SendTransaction broadcasts a signed transaction and returns its hash
+func (c *Client) SendTransaction(tx *types.Transaction) (types.Hash, error) {
+	if tx == nil {
+		return types.Hash{}, errors.New("nil transaction")
+	}
+
+	var result struct {
+		Hash string `json:"hash"`
+	}
+	params := map[string]*types.Transaction{"tx": tx}
+	if err := c.rpc.Call("sendRawTransaction", params, &result); err != nil {
+		return types.Hash{}, err
+	}
+	return types.HashFromString(result.Hash)
+}
+
+// SubmitResult is the outcome of one transaction sent with
+// SendTransactions
+type SubmitResult struct {
+	Hash  string `json:"hash,omitempty"`
+	Error string `json:"error,omitempty"` // Set if the node rejected the transaction
+}
+
+// SendTransactions broadcasts a batch of signed transactions. Results are
+// in the order of txs; rejected transactions do not fail the call.
+func (c *Client) SendTransactions(txs []*types.Transaction) ([]SubmitResult, error) {
+	if len(txs) == 0 {
+		return nil, errors.New("no transactions")
+	}
+
+	var results []SubmitResult
+	params := map[string][]*types.Transaction{"txs": txs}
+	if err := c.rpc.Call("sendRawTransactions", params, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// GetForks returns the fork schedule and active protocol version
+func (c *Client) GetForks() (*ForkInfo, error) {
+	var info ForkInfo
+	if err := c.rpc.Call("getForks", nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// GetSupply returns the coin supply and emission parameters
+func (c *Client) GetSupply() (*SupplyInfo, error) {
+	var info SupplyInfo
+	if err := c.rpc.Call("getSupply", nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// GetSupplyInfo returns the supply with minted, burned and slashed
+// totals since genesis
+func (c *Client) GetSupplyInfo() (*SupplyDetails, error) {
+	var info SupplyDetails
+	if err := c.rpc.Call("getSupplyInfo", nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// GetTreasury returns the treasury balance and the nonce of its next
+// spend
+func (c *Client) GetTreasury() (*TreasuryInfo, error) {
+	var info TreasuryInfo
+	if err := c.rpc.Call("getTreasury", nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// GetBaseFee returns the base fee the next block burns from every
+// transaction, 0 while the fee market is off. It implements
+// wallet.BaseFeeReader.
+func (c *Client) GetBaseFee() (uint64, error) {
+	var result struct {
+		BaseFee uint64 `json:"base_fee"`
+	}
+	if err := c.rpc.Call("getBaseFee", nil, &result); err != nil {
+		return 0, err
+	}
+	return result.BaseFee, nil
+}
+
+// GetDustLimit returns the smallest amount an output of the next block
+// may carry, 0 while the limit is off. It implements
+// wallet.DustLimitReader.
+func (c *Client) GetDustLimit() (uint64, error) {
+	var result struct {
+		DustLimit uint64 `json:"dust_limit"`
+	}
+	if err := c.rpc.Call("getDustLimit", nil, &result); err != nil {
+		return 0, err
+	}
+	return result.DustLimit, nil
+}
+
+// GetRingPolicy returns the ring size bounds of the next block, the
+// zero policy while none are enforced. It implements
+// wallet.RingPolicyReader.
+func (c *Client) GetRingPolicy() (types.RingPolicy, error) {
+	var policy types.RingPolicy
+	if err := c.rpc.Call("getRingPolicy", nil, &policy); err != nil {
+		return types.RingPolicy{}, err
+	}
+	return policy, nil
+}
+
+// GetMaturity returns the depths outputs must be buried under to be
+// spent or used as decoys in the next block. It implements
+// wallet.MaturityReader.
+func (c *Client) GetMaturity() (types.MaturityConfig, error) {
+	var maturity types.MaturityConfig
+	if err := c.rpc.Call("getMaturity", nil, &maturity); err != nil {
+		return types.MaturityConfig{}, err
+	}
+	return maturity, nil
+}
+
+// GetNextProtocolVersion returns the protocol version of the next
+// block. It implements wallet.ProtocolReader.
+func (c *Client) GetNextProtocolVersion() (uint32, error) {
+	info, err := c.GetForks()
+	if err != nil {
+		return 0, err
+	}
+	return info.Forks.VersionAt(info.Height + 1), nil
+}
+
+// GetRingMemberIndexes returns the global output index of each key, or
+// nil while rings do not reference members by index. It implements
+// wallet.RingMemberReader.
+func (c *Client) GetRingMemberIndexes(keys []types.PublicKey) ([]uint64, error) {
+	var result struct {
+		Indexes []uint64 `json:"indexes"`
+	}
+	if err := c.rpc.Call("getRingMemberIndexes", map[string]interface{}{"keys": keys}, &result); err != nil {
+		return nil, err
+	}
+	return result.Indexes, nil
+}
+
+// GetDenomination returns the coin symbol and decimal places amounts
+// are written with (see types.Denomination). It implements
+// wallet.DenominationReader.
+func (c *Client) GetDenomination() (types.Denomination, error) {
+	var d types.Denomination
+	if err := c.rpc.Call("getDenomination", nil, &d); err != nil {
+		return types.Denomination{}, err
+	}
+	return d, nil
+}
+
+// IsKeyImageSpent reports which of keyImages are spent, in order. At
+// most wallet.MaxKeyImageBatch may be checked at once.
+func (c *Client) IsKeyImageSpent(keyImages []types.PublicKey) ([]bool, error) {
+	var result struct {
+		Spent []bool `json:"spent"`
+	}
+	if err := c.rpc.Call("isKeyImageSpent", map[string]interface{}{"key_images": keyImages}, &result); err != nil {
+		return nil, err
+	}
+	return result.Spent, nil
+}
+
+// GetStakingNonce returns the nonce the validator's next staking
+// transaction must carry
+func (c *Client) GetStakingNonce(validator types.PublicKey) (uint64, error) {
+	var result struct {
+		Nonce uint64 `json:"nonce"`
+	}
+	if err := c.rpc.Call("getStakingNonce", map[string]interface{}{"validator": validator}, &result); err != nil {
+		return 0, err
+	}
+	return result.Nonce, nil
+}
+
+// GetValidators returns the active and queued validator sets
+func (c *Client) GetValidators() (*ValidatorsInfo, error) {
+	var info ValidatorsInfo
+	if err := c.rpc.Call("getValidators", nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// GetValidatorSet returns the validator set that voted on the block at
+// height, to check its certificate
+func (c *Client) GetValidatorSet(height uint64) (*types.ValidatorSetSnapshot, error) {
+	var set types.ValidatorSetSnapshot
+	params := map[string]uint64{"height": height}
+	if err := c.rpc.Call("getValidatorSet", params, &set); err != nil {
+		return nil, err
+	}
+	return &set, nil
+}
+
+// GetValidatorLiveness returns heartbeat and missed-block status for
+// every known validator
+func (c *Client) GetValidatorLiveness() (*LivenessInfo, error) {
+	var info LivenessInfo
+	if err := c.rpc.Call("getValidatorLiveness", nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// VerifyTxProof checks a payment proof against the chain
+func (c *Client) VerifyTxProof(proof *crypto.TxProof) (*ProofResult, error) {
+	var result ProofResult
+	if err := c.rpc.Call("verifyTxProof", proof, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
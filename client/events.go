@@ -0,0 +1,163 @@
+package client
+
+import (
+	"sync"
+	"time"
+
+	"blockchain/types"
+)
+
+// DefaultPollInterval is how often a subscription checks for new blocks
+const DefaultPollInterval = 2 * time.Second
+
+// EventType tells what an Event reports
+type EventType string
+
+const (
+	EventBlock       EventType = "block"       // A block was added
+	EventTransaction EventType = "transaction" // A transaction was confirmed
+)
+
+// Event reports a new block or one of its transactions. Block events
+// precede the events of their transactions.
+type Event struct {
+	Type   EventType
+	Height uint64
+	Block  *types.Block
+	Tx     *types.Transaction // Set for EventTransaction
+}
+
+// Subscription delivers chain events in height order
+// NOTE: Phase 1 nodes have no push API, so subscriptions poll getHeight.
+type Subscription struct {
+	client   *Client
+	next     uint64
+	interval time.Duration
+	events   chan *Event
+
+	mu  sync.Mutex
+	err error
+
+	quit chan struct{}
+	once sync.Once
+	wg   sync.WaitGroup
+}
+
+// Subscribe starts delivering events for blocks from fromHeight on.
+// Pass the latest height plus one to only see new blocks.
+func (c *Client) Subscribe(fromHeight uint64, interval time.Duration) *Subscription {
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	// Height 0 is genesis and is never stored
+	if fromHeight == 0 {
+		fromHeight = 1
+	}
+
+	s := &Subscription{
+		client:   c,
+		next:     fromHeight,
+		interval: interval,
+		events:   make(chan *Event, 64),
+		quit:     make(chan struct{}),
+	}
+
+	s.wg.Add(1)
+	go s.loop()
+
+	return s
+}
+
+// Events returns the event channel. It is closed when the subscription
+// is closed.
+func (s *Subscription) Events() <-chan *Event {
+	return s.events
+}
+
+// Err returns the last polling error, or nil after a successful poll
+func (s *Subscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Close stops the subscription
+func (s *Subscription) Close() {
+	s.once.Do(func() { close(s.quit) })
+	s.wg.Wait()
+}
+
+func (s *Subscription) loop() {
+	defer s.wg.Done()
+	defer close(s.events)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		err := s.poll()
+
+		s.mu.Lock()
+		s.err = err
+		s.mu.Unlock()
+
+		select {
+		case <-s.quit:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll delivers every block up to the node's latest height. Failed
+// fetches are retried from the same height on the next poll.
+func (s *Subscription) poll() error {
+	latest, err := s.client.GetLatestHeight()
+	if err != nil {
+		return err
+	}
+
+	for ; s.next <= latest; s.next++ {
+		block, err := s.client.GetBlock(s.next)
+		if err != nil {
+			return err
+		}
+
+		if !s.send(&Event{Type: EventBlock, Height: s.next, Block: block}) {
+			return nil
+		}
+		for _, tx := range block.Transactions {
+			if !s.send(&Event{Type: EventTransaction, Height: s.next, Block: block, Tx: tx}) {
+				return nil
+			}
+		}
+	}
+
+	return nil
+}
+
+// send delivers an event, returning false if the subscription closed
+func (s *Subscription) send(e *Event) bool {
+	select {
+	case s.events <- e:
+		return true
+	case <-s.quit:
+		return false
+	}
+}
+
+// WaitForTransaction polls until a transaction is confirmed or the
+// timeout expires
+func (c *Client) WaitForTransaction(hash types.Hash, timeout time.Duration) (*types.Transaction, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		tx, err := c.GetTransaction(hash)
+		if err == nil {
+			return tx, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, err
+		}
+		time.Sleep(DefaultPollInterval)
+	}
+}
@@ -0,0 +1,81 @@
+package client
+
+import (
+	"blockchain/crypto"
+	"blockchain/types"
+	"blockchain/wallet"
+)
+
+// Scan returns the outputs owned by keys from fromHeight on
+func (c *Client) Scan(keys *crypto.WalletKeys, fromHeight uint64) (*wallet.ScanResult, error) {
+	return wallet.Scan(keys, c, fromHeight)
+}
+
+// ParsePayments creates payments to standard, integrated or multisig
+// addresses of network
+func ParsePayments(network types.Network, destinations []wallet.Destination) ([]wallet.Payment, error) {
+	payments := make([]wallet.Payment, 0, len(destinations))
+	for _, d := range destinations {
+		p, err := wallet.ParsePayment(network, d.Address, d.Amount, "")
+		if err != nil {
+			return nil, err
+		}
+		payments = append(payments, p)
+	}
+	return payments, nil
+}
+
+// BuildUnsigned selects an input and decoys and creates the outputs of
+// a transaction. It only needs the view key; the result can be signed
+// offline with UnsignedTx.Sign. A zero fee uses wallet.SuggestFee.
+func (c *Client) BuildUnsigned(keys *crypto.WalletKeys, scan *wallet.ScanResult, payments []wallet.Payment, fee uint64) (*wallet.UnsignedTx, error) {
+	if fee == 0 {
+		var err error
+		if fee, err = wallet.SuggestFee(c, payments); err != nil {
+			return nil, err
+		}
+	}
+
+	unsigned, _, err := wallet.BuildUnsigned(keys, c, scan, payments, fee, wallet.OutputPolicy{})
+	return unsigned, err
+}
+
+// BuildTransaction builds and signs a transaction with a full wallet
+func (c *Client) BuildTransaction(keys *crypto.WalletKeys, scan *wallet.ScanResult, payments []wallet.Payment, fee uint64) (*types.Transaction, error) {
+	unsigned, err := c.BuildUnsigned(keys, scan, payments, fee)
+	if err != nil {
+		return nil, err
+	}
+	return unsigned.Sign(keys)
+}
+
+// Transfer scans the chain, then builds, signs and broadcasts a
+// transaction paying payments from keys
+func (c *Client) Transfer(keys *crypto.WalletKeys, payments []wallet.Payment, fee uint64) (*types.Transaction, error) {
+	scan, err := c.Scan(keys, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := c.BuildTransaction(keys, scan, payments, fee)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := c.SendTransaction(tx); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// Sponsor scans the chain for the sponsor's outputs and pays the fee of
+// a transaction built with wallet.BuildSponsored and signed by its
+// sender, up to maxFee. The transaction is completed in place and can
+// then be sent with SendTransaction.
+func (c *Client) Sponsor(keys *crypto.WalletKeys, tx *types.Transaction, maxFee uint64) error {
+	scan, err := c.Scan(keys, 0)
+	if err != nil {
+		return err
+	}
+	return wallet.Sponsor(keys, c, scan, tx, maxFee)
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"blockchain/rpc"
+	"blockchain/types"
+)
+
+// DefaultBanDuration applies when banPeer is called without a duration
+const DefaultBanDuration = 24 * time.Hour
+
+// registerAdminMethods exposes operator controls that require the admin
+// token
+func (n *Node) registerAdminMethods() {
+	n.rpc.RegisterAdmin("listPeers", n.rpcListPeers)
+	n.rpc.RegisterAdmin("connectPeer", n.rpcConnectPeer)
+	n.rpc.RegisterAdmin("banPeer", n.rpcBanPeer)
+	n.rpc.RegisterAdmin("mempoolContents", n.rpcMempoolContents)
+	n.rpc.RegisterAdmin("evictTx", n.rpcEvictTx)
+	n.rpc.RegisterAdmin("setLogLevel", n.rpcSetLogLevel)
+	n.rpc.RegisterAdmin("peerBandwidth", n.rpcPeerBandwidth)
+	n.rpc.RegisterAdmin("reloadConfig", n.rpcReloadConfig)
+	n.rpc.RegisterAdmin("validatorStatus", n.rpcValidatorStatus)
+}
+
+func (n *Node) rpcListPeers(params json.RawMessage) (interface{}, error) {
+	return n.network.ListPeers(), nil
+}
+
+func (n *Node) rpcConnectPeer(params json.RawMessage) (interface{}, error) {
+	var req struct {
+		Addr string `json:"addr"`
+	}
+	if err := rpc.DecodeParams(params, &req); err != nil {
+		return nil, err
+	}
+
+	if err := n.network.ConnectPeer(req.Addr); err != nil {
+		return nil, err
+	}
+
+	infof("Admin: connected to peer %s", req.Addr)
+	return map[string]bool{"connected": true}, nil
+}
+
+func (n *Node) rpcBanPeer(params json.RawMessage) (interface{}, error) {
+	var req struct {
+		PeerID   string `json:"peer_id"`
+		Duration string `json:"duration"` // e.g. "1h", default 24h
+	}
+	if err := rpc.DecodeParams(params, &req); err != nil {
+		return nil, err
+	}
+
+	duration := DefaultBanDuration
+	if req.Duration != "" {
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil || d <= 0 {
+			return nil, rpc.InvalidParams(errors.New("invalid ban duration"))
+		}
+		duration = d
+	}
+
+	if err := n.network.BanPeer(req.PeerID, duration); err != nil {
+		return nil, rpc.InvalidParams(err)
+	}
+
+	infof("Admin: banned peer %s for %s", req.PeerID, duration)
+	return map[string]string{"banned_until": time.Now().Add(duration).Format(time.RFC3339)}, nil
+}
+
+// mempoolEntry summarizes a pooled transaction
+type mempoolEntry struct {
+	Hash    string `json:"hash"`
+	Inputs  int    `json:"inputs"`
+	Outputs int    `json:"outputs"`
+	Fee     uint64 `json:"fee"`
+}
+
+func (n *Node) rpcMempoolContents(params json.RawMessage) (interface{}, error) {
+	n.txPoolMu.Lock()
+	defer n.txPoolMu.Unlock()
+
+	entries := make([]mempoolEntry, 0, len(n.txPool))
+	for _, tx := range n.txPool {
+		entries = append(entries, mempoolEntry{
+			Hash:    tx.Hash().String(),
+			Inputs:  len(tx.Inputs),
+			Outputs: len(tx.Outputs),
+			Fee:     tx.Fee,
+		})
+	}
+
+	return entries, nil
+}
+
+func (n *Node) rpcEvictTx(params json.RawMessage) (interface{}, error) {
+	var req struct {
+		Hash string `json:"hash"`
+	}
+	if err := rpc.DecodeParams(params, &req); err != nil {
+		return nil, err
+	}
+
+	hash, err := types.HashFromString(req.Hash)
+	if err != nil {
+		return nil, rpc.InvalidParams(err)
+	}
+
+	if !n.evictFromPool(hash) {
+		return nil, errors.New("transaction not in mempool")
+	}
+
+	infof("Admin: evicted transaction %s", hash)
+	return map[string]bool{"evicted": true}, nil
+}
+
+func (n *Node) rpcSetLogLevel(params json.RawMessage) (interface{}, error) {
+	var req struct {
+		Level string `json:"level"`
+	}
+	if err := rpc.DecodeParams(params, &req); err != nil {
+		return nil, err
+	}
+
+	if err := setLogLevel(req.Level); err != nil {
+		return nil, rpc.InvalidParams(err)
+	}
+
+	infof("Admin: log level set to %s", req.Level)
+	return map[string]string{"level": req.Level}, nil
+}
+
+func (n *Node) rpcPeerBandwidth(params json.RawMessage) (interface{}, error) {
+	var req struct {
+		Limit int `json:"limit"` // Top peers and protocols to return, 0 for all
+	}
+	if len(params) > 0 && string(params) != "null" {
+		if err := rpc.DecodeParams(params, &req); err != nil {
+			return nil, err
+		}
+	}
+
+	report := n.network.Bandwidth()
+	if req.Limit > 0 {
+		if len(report.Peers) > req.Limit {
+			report.Peers = report.Peers[:req.Limit]
+		}
+		if len(report.Protocols) > req.Limit {
+			report.Protocols = report.Protocols[:req.Limit]
+		}
+	}
+
+	return report, nil
+}
+
+func (n *Node) rpcReloadConfig(params json.RawMessage) (interface{}, error) {
+	return n.reloadConfig()
+}
+
+// evictFromPool removes a transaction from the pool, reporting whether
+// it was present
+func (n *Node) evictFromPool(hash types.Hash) bool {
+	n.txPoolMu.Lock()
+	defer n.txPoolMu.Unlock()
+
+	entry, ok := n.txIndex[hash]
+	if !ok {
+		return false
+	}
+	delete(n.txIndex, hash)
+	for i, tx := range n.txPool {
+		if tx == entry.tx {
+			n.txPool = append(n.txPool[:i], n.txPool[i+1:]...)
+			break
+		}
+	}
+	return true
+}
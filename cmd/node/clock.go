@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+const (
+	// DefaultNTPServer is queried for the clock offset unless -ntp-server
+	// is set (empty disables NTP)
+	DefaultNTPServer = "pool.ntp.org:123"
+
+	// MaxClockOffset is the clock error that triggers a warning. Blocks
+	// more than a minute ahead of the local clock are rejected.
+	MaxClockOffset = 10 * time.Second
+
+	clockCheckInterval = 10 * time.Minute
+	ntpTimeout         = 5 * time.Second
+
+	// minClockPeers is how many peer clocks are needed to estimate the
+	// offset without NTP
+	minClockPeers = 3
+
+	// ntpEpochOffset is the number of seconds from 1900 to 1970
+	ntpEpochOffset = 2208988800
+)
+
+// clockHealth is the clock section of the health report
+type clockHealth struct {
+	Offset string `json:"offset,omitempty"` // Reference time minus local time
+	Source string `json:"source,omitempty"` // ntp or peers
+	OK     bool   `json:"ok"`
+}
+
+// monitorClock checks the local clock at startup and periodically
+func (n *Node) monitorClock() {
+	ticker := time.NewTicker(clockCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		n.checkClock()
+		<-ticker.C
+	}
+}
+
+// checkClock measures the clock offset against NTP, falling back to the
+// median of peer clocks, and warns when it exceeds MaxClockOffset
+func (n *Node) checkClock() {
+	var offset time.Duration
+	var source string
+
+	// NTP over UDP would bypass the proxy
+	if n.config.NTPServer != "" && n.config.Proxy == nil {
+		if o, err := queryNTP(n.config.NTPServer); err != nil {
+			debugf("NTP query to %s failed: %v", n.config.NTPServer, err)
+		} else {
+			offset, source = o, "ntp"
+		}
+	}
+	if source == "" {
+		if o, peers := n.network.PeerClockOffset(); peers >= minClockPeers {
+			offset, source = o, "peers"
+		}
+	}
+	if source == "" {
+		return
+	}
+
+	n.healthMu.Lock()
+	n.clockOffset = offset
+	n.clockSource = source
+	n.healthMu.Unlock()
+
+	if offset > MaxClockOffset || offset < -MaxClockOffset {
+		direction := "behind"
+		if offset < 0 {
+			direction = "ahead"
+		}
+		warnf("Local clock is %s %s (%s); blocks may be rejected, sync the system clock",
+			absDuration(offset).Round(time.Millisecond), direction, source)
+	} else {
+		debugf("Clock offset %s (%s)", offset.Round(time.Millisecond), source)
+	}
+}
+
+// adjustedNow returns the local time corrected by the last measured
+// clock offset
+func (n *Node) adjustedNow() time.Time {
+	n.healthMu.RLock()
+	defer n.healthMu.RUnlock()
+	return time.Now().Add(n.clockOffset)
+}
+
+// clockReport returns the last measured clock offset
+func (n *Node) clockReport() clockHealth {
+	n.healthMu.RLock()
+	defer n.healthMu.RUnlock()
+
+	if n.clockSource == "" {
+		return clockHealth{OK: true} // Not measured
+	}
+	return clockHealth{
+		Offset: n.clockOffset.Round(time.Millisecond).String(),
+		Source: n.clockSource,
+		OK:     absDuration(n.clockOffset) <= MaxClockOffset,
+	}
+}
+
+// queryNTP returns the offset of an SNTP server's clock from ours
+func queryNTP(server string) (time.Duration, error) {
+	conn, err := net.DialTimeout("udp", server, ntpTimeout)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(ntpTimeout))
+
+	req := make([]byte, 48)
+	req[0] = 0x1B // Version 3, client mode
+
+	sent := time.Now()
+	if _, err := conn.Write(req); err != nil {
+		return 0, err
+	}
+
+	resp := make([]byte, 48)
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return 0, err
+	}
+	received := time.Now()
+
+	if mode := resp[0] & 0x07; mode != 4 {
+		return 0, fmt.Errorf("unexpected NTP mode %d", mode)
+	}
+	if resp[1] == 0 {
+		return 0, errors.New("NTP server refused the request")
+	}
+
+	serverReceive := ntpTime(resp[32:40])
+	serverTransmit := ntpTime(resp[40:48])
+
+	return (serverReceive.Sub(sent) + serverTransmit.Sub(received)) / 2, nil
+}
+
+// ntpTime decodes a 64-bit NTP timestamp
+func ntpTime(b []byte) time.Time {
+	secs := binary.BigEndian.Uint32(b[0:4])
+	frac := binary.BigEndian.Uint32(b[4:8])
+	nsec := (uint64(frac) * 1e9) >> 32
+	return time.Unix(int64(secs)-ntpEpochOffset, int64(nsec))
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
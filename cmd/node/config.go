@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// reloadableFlags are the flags a reload applies to the running node.
+// Changes to any other flag take effect on the next start.
+var reloadableFlags = map[string]bool{
+	"log-level":       true,
+	"min-peers":       true,
+	"mempool-max-txs": true,
+	"rpc-rate-limit":  true,
+	"rpc-rate":        true,
+	"rpc-burst":       true,
+	"rpc-auth-rate":   true,
+	"rpc-auth-burst":  true,
+	"rpc-cost":        true,
+}
+
+// applyConfigFile sets the flags of fs missing from set, the flags given
+// on the command line, from a JSON object of flag names and values:
+//
+//	{"log-level": "debug", "rpc-rate-limit": true, "rpc-rate": 50}
+func applyConfigFile(fs *flag.FlagSet, path string, set map[string]bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if name == "config" || fs.Lookup(name) == nil {
+			return fmt.Errorf("config file %s: unknown flag %q", path, name)
+		}
+		if set[name] {
+			continue // The command line wins
+		}
+
+		var value string
+		switch v := values[name].(type) {
+		case string:
+			value = v
+		case bool:
+			value = strconv.FormatBool(v)
+		case float64:
+			value = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			return fmt.Errorf("config file %s: %s must be a string, number or boolean", path, name)
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("config file %s: %s: %w", path, name, err)
+		}
+	}
+	return nil
+}
+
+// setFlags returns the names of the flags set so far
+func setFlags(fs *flag.FlagSet) map[string]bool {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	return set
+}
+
+// flagValues returns the value of every flag of fs
+func flagValues(fs *flag.FlagSet) map[string]string {
+	values := make(map[string]string)
+	fs.VisitAll(func(f *flag.Flag) {
+		values[f.Name] = f.Value.String()
+	})
+	return values
+}
+
+// changedFlags returns the names of the flags whose values differ,
+// sorted
+func changedFlags(old, new map[string]string) []string {
+	var changed []string
+	for name, value := range new {
+		if old[name] != value {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// checkLimits checks the settings a reload may change
+func checkLimits(cfg *Config) error {
+	if cfg.MinPeers < 1 {
+		return errors.New("-min-peers must be positive")
+	}
+	if cfg.MempoolMaxTxs < 0 {
+		return errors.New("-mempool-max-txs must not be negative")
+	}
+	return nil
+}
+
+// reloadReport lists the flags a reload changed: those applied to the
+// running node, and those that differ from the running node's but only
+// take effect on restart
+type reloadReport struct {
+	Applied         []string `json:"applied"`
+	RestartRequired []string `json:"restart_required"`
+}
+
+// reloadConfig parses the command line and -config file again and
+// applies the reloadable settings. All of them are checked before any is
+// applied, so a bad file changes nothing.
+func (n *Node) reloadConfig() (*reloadReport, error) {
+	n.reloadMu.Lock()
+	defer n.reloadMu.Unlock()
+
+	if n.config.ConfigFile == "" {
+		return nil, errors.New("node was started without -config")
+	}
+	cfg, err := parseConfig(os.Args[1:], flag.ContinueOnError)
+	if err != nil {
+		return nil, err
+	}
+
+	level, err := parseLogLevel(cfg.LogLevel)
+	if err != nil {
+		return nil, err
+	}
+	limits, err := rpcRateLimits(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkLimits(cfg); err != nil {
+		return nil, err
+	}
+
+	logLevel.Store(level)
+	n.network.SetMinPeers(cfg.MinPeers)
+	n.poolLimit.Store(int64(cfg.MempoolMaxTxs))
+	if n.rpc != nil {
+		n.rpc.SetRateLimit(limits)
+	}
+
+	report := &reloadReport{Applied: []string{}, RestartRequired: []string{}}
+	for _, name := range changedFlags(n.loaded.flagValues, cfg.flagValues) {
+		if reloadableFlags[name] {
+			report.Applied = append(report.Applied, name)
+		}
+	}
+	for _, name := range changedFlags(n.config.flagValues, cfg.flagValues) {
+		if !reloadableFlags[name] {
+			report.RestartRequired = append(report.RestartRequired, name)
+		}
+	}
+	n.loaded = cfg
+
+	infof("Configuration reloaded from %s: %d settings applied", cfg.ConfigFile, len(report.Applied))
+	if len(report.RestartRequired) > 0 {
+		warnf("Restart required to apply: %v", report.RestartRequired)
+	}
+	return report, nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"blockchain/conformance"
+	"blockchain/storage"
+	"blockchain/types"
+)
+
+// runConformance records a conformance suite from the stored chain, or
+// checks one against this build. Recording needs the node stopped.
+func runConformance(args []string) {
+	fs := flag.NewFlagSet("conformance", flag.ExitOnError)
+	dataDir := fs.String("datadir", "./data", "Data directory to record from")
+	to := fs.Uint64("to", 0, "Last height to record (0 for the latest block)")
+	out := fs.String("out", "", "Record a suite to this file (- for stdout)")
+	check := fs.String("check", "", "Check the suite in this file")
+	addOutputFlags(fs)
+	fs.Parse(args)
+	setupOutput()
+
+	switch {
+	case *check != "" && *out == "":
+		checkConformance(*check)
+	case *out != "" && *check == "":
+		if jsonOutput && *out == "-" {
+			usageFatal("-json needs -out <file>: the suite would share stdout with the result")
+		}
+		recordConformance(*dataDir, *to, *out)
+	default:
+		usageFatal("Usage: node conformance -datadir <dir> [-to <height>] -out <file> | node conformance -check <file>")
+	}
+}
+
+// recordConformance writes a suite of the stored blocks up to height to
+func recordConformance(dataDir string, to uint64, out string) {
+	db, err := storage.OpenReadOnly(dataDir + "/blockchain.db")
+	if err != nil {
+		log.Fatalf("Failed to open database (is the node still running?): %v", err)
+	}
+	defer db.Close()
+
+	genesis, err := db.GetGenesis()
+	if err != nil {
+		log.Fatalf("No genesis in database: %v", err)
+	}
+	latest, err := db.GetLatestHeight()
+	if err != nil {
+		log.Fatalf("Failed to read latest height: %v", err)
+	}
+	if to == 0 {
+		to = latest
+	}
+	if to > latest {
+		log.Fatalf("Height %d is above the latest block %d", to, latest)
+	}
+
+	blocks := make([]*types.Block, 0, to)
+	for h := uint64(1); h <= to; h++ {
+		block, err := db.GetBlock(h)
+		if err != nil {
+			log.Fatalf("Failed to load block %d: %v", h, err)
+		}
+		blocks = append(blocks, block)
+	}
+
+	suite, err := conformance.Record(genesis, blocks)
+	if err != nil {
+		log.Fatalf("Failed to record suite: %v", err)
+	}
+	data, err := json.MarshalIndent(suite, "", "  ")
+	if err != nil {
+		log.Fatalf("Failed to encode suite: %v", err)
+	}
+	if err := writeOutput(out, data); err != nil {
+		log.Fatalf("Failed to write suite: %v", err)
+	}
+
+	if out != "-" {
+		fmt.Printf("Recorded %d blocks of %s to %s\n", len(suite.Steps), genesis.ChainID, out)
+	}
+	printResult(map[string]interface{}{
+		"file":     out,
+		"chain_id": genesis.ChainID,
+		"blocks":   len(suite.Steps),
+	})
+}
+
+// checkConformance replays a suite and exits with exitFailure at the
+// first block whose state differs
+func checkConformance(path string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("Failed to read suite: %v", err)
+	}
+	var suite conformance.Suite
+	if err := json.Unmarshal(data, &suite); err != nil {
+		log.Fatalf("Failed to decode suite: %v", err)
+	}
+
+	passed, err := suite.Check()
+	if err != nil {
+		fmt.Printf("Conformance FAILED after %d of %d blocks: %v\n", passed, len(suite.Steps), err)
+		printResult(map[string]interface{}{"conforms": false, "passed": passed, "blocks": len(suite.Steps), "error": err.Error()})
+		os.Exit(exitFailure)
+	}
+
+	fmt.Printf("All %d blocks conform\n", passed)
+	printResult(map[string]interface{}{"conforms": true, "passed": passed, "blocks": len(suite.Steps)})
+}
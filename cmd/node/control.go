@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"blockchain/p2p"
+	"blockchain/rpc"
+)
+
+// Keys the rotateKey control method can replace
+const (
+	KeyAdminToken   = "admin-token"
+	KeyControlToken = "control-token"
+)
+
+// ctlUsage lists the commands of node ctl
+const ctlUsage = `Usage: node ctl [-datadir <dir>] [-socket <path>] [-token-file <file>] <command>
+
+Commands:
+  status                     Chain, height and protocol version of the node
+  peers                      List connected peers
+  ban <peer_id> [duration]   Disconnect and refuse a peer (default 24h)
+  rotate <key>               Replace the admin-token or control-token
+  stop                       Shut the node down`
+
+// newControlServer creates the control socket of a node: a unix socket
+// for operations too dangerous for the RPC port, whose requests must be
+// signed with the control token and carry a fresh nonce
+func (n *Node) newControlServer(cfg *Config) (*rpc.Server, error) {
+	token, err := loadControlToken(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load control token: %w", err)
+	}
+
+	server := rpc.NewUnixServer(cfg.ControlSocket)
+	server.SetSigningKey(token)
+	server.SetPanicHandler(func(method string, value interface{}, stack []byte) {
+		n.notePanic("control method "+method, value, stack)
+	})
+	server.Register("status", n.rpcGetStatus)
+	server.Register("listPeers", n.rpcListPeers)
+	server.Register("banPeer", n.rpcBanPeer)
+	server.Register("rotateKey", n.rpcRotateKey)
+	server.Register("stop", n.rpcStop)
+	return server, nil
+}
+
+// loadControlToken loads the key signing control requests, or generates
+// one for an ephemeral node and logs it, since it is stored nowhere
+func loadControlToken(cfg *Config) (string, error) {
+	if !cfg.Ephemeral {
+		return rpc.LoadOrCreateToken(cfg.ControlTokenFile)
+	}
+	token, err := rpc.NewToken()
+	if err != nil {
+		return "", err
+	}
+	infof("Ephemeral control token (valid until exit): %s", token)
+	return token, nil
+}
+
+// rpcRotateKey replaces the admin RPC token or the control token. The
+// new token is written to its file and takes effect at once; clients
+// holding the old one are refused from then on.
+func (n *Node) rpcRotateKey(params json.RawMessage) (interface{}, error) {
+	var req struct {
+		Key string `json:"key"`
+	}
+	if err := rpc.DecodeParams(params, &req); err != nil {
+		return nil, err
+	}
+
+	var (
+		file string
+		set  func(string)
+	)
+	switch req.Key {
+	case KeyAdminToken:
+		if n.rpc == nil {
+			return nil, rpc.InvalidParams(errors.New("RPC server is disabled; there is no admin token"))
+		}
+		file, set = n.config.AdminTokenFile, n.rpc.SetAdminToken
+	case KeyControlToken:
+		file, set = n.config.ControlTokenFile, n.control.SetSigningKey
+	default:
+		return nil, rpc.InvalidParams(fmt.Errorf("unknown key %q (want %s or %s)", req.Key, KeyAdminToken, KeyControlToken))
+	}
+
+	token, err := rpc.NewToken()
+	if err != nil {
+		return nil, err
+	}
+	if n.config.Ephemeral {
+		infof("Ephemeral %s (valid until exit): %s", req.Key, token)
+		file = ""
+	} else if err := writeToken(file, token); err != nil {
+		return nil, err
+	}
+	set(token)
+
+	infof("Control: rotated %s", req.Key)
+	return map[string]string{"key": req.Key, "file": file}, nil
+}
+
+// writeToken replaces a token file, so a crash leaves either the old
+// token or the new one
+func writeToken(path, token string) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(token+"\n"), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// rpcStop shuts the node down as SIGTERM would, after answering
+func (n *Node) rpcStop(params json.RawMessage) (interface{}, error) {
+	infof("Control: stop requested")
+	n.stopOnce.Do(func() { close(n.stopRequested) })
+	return map[string]bool{"stopping": true}, nil
+}
+
+// ctlCommand runs a control command against the node listening on its
+// control socket
+func ctlCommand(args []string) {
+	fs := flag.NewFlagSet("ctl", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprintln(os.Stderr, ctlUsage) }
+	dataDir := fs.String("datadir", "./data", "Data directory of the node")
+	socket := fs.String("socket", "", "Control socket of the node (default <datadir>/control.sock)")
+	tokenFile := fs.String("token-file", "", "Control token file (default <datadir>/control.token)")
+	addOutputFlags(fs)
+	fs.Parse(args)
+	setupOutput()
+
+	if fs.NArg() == 0 {
+		usageFatal(ctlUsage)
+	}
+	if *socket == "" {
+		*socket = *dataDir + "/control.sock"
+	}
+	if *tokenFile == "" {
+		*tokenFile = *dataDir + "/control.token"
+	}
+	token, err := os.ReadFile(*tokenFile)
+	if err != nil {
+		log.Fatalf("Failed to read control token: %v", err)
+	}
+
+	client := rpc.NewUnixClient(*socket)
+	client.SetSigningKey(strings.TrimSpace(string(token)))
+
+	args = fs.Args()
+	switch args[0] {
+	case "status":
+		var status p2p.Status
+		if err := client.Call("status", nil, &status); err != nil {
+			log.Fatalf("Failed to get status: %v", err)
+		}
+		fmt.Printf("Chain:    %s (genesis %s)\n", status.ChainID, status.GenesisHash)
+		fmt.Printf("Height:   %d\n", status.Height)
+		fmt.Printf("Protocol: %d (active %d)\n", status.ProtocolVersion, status.ActiveVersion)
+		printResult(status)
+
+	case "peers":
+		var peers []p2p.PeerInfo
+		if err := client.Call("listPeers", nil, &peers); err != nil {
+			log.Fatalf("Failed to list peers: %v", err)
+		}
+		for _, peer := range peers {
+			fmt.Println(peer.ID)
+		}
+		fmt.Printf("%d peers\n", len(peers))
+		printResult(peers)
+
+	case "ban":
+		if len(args) < 2 || len(args) > 3 {
+			usageFatal("Usage: node ctl ban <peer_id> [duration]")
+		}
+		params := map[string]string{"peer_id": args[1]}
+		if len(args) == 3 {
+			if _, err := time.ParseDuration(args[2]); err != nil {
+				usageFatal(fmt.Sprintf("Invalid duration %q: %v", args[2], err))
+			}
+			params["duration"] = args[2]
+		}
+		var result map[string]string
+		if err := client.Call("banPeer", params, &result); err != nil {
+			log.Fatalf("Failed to ban peer: %v", err)
+		}
+		fmt.Printf("Banned %s until %s\n", args[1], result["banned_until"])
+		printResult(result)
+
+	case "rotate":
+		if len(args) != 2 {
+			usageFatal("Usage: node ctl rotate " + KeyAdminToken + "|" + KeyControlToken)
+		}
+		var result map[string]string
+		if err := client.Call("rotateKey", map[string]string{"key": args[1]}, &result); err != nil {
+			log.Fatalf("Failed to rotate %s: %v", args[1], err)
+		}
+		if result["file"] != "" {
+			fmt.Printf("Rotated %s; the new token is in %s\n", args[1], result["file"])
+		} else {
+			fmt.Printf("Rotated %s; the new token is in the node's log\n", args[1])
+		}
+		printResult(result)
+
+	case "stop":
+		if err := client.Call("stop", nil, nil); err != nil {
+			log.Fatalf("Failed to stop node: %v", err)
+		}
+		fmt.Println("Node is shutting down")
+		printResult(map[string]bool{"stopping": true})
+
+	default:
+		usageFatal(ctlUsage)
+	}
+}
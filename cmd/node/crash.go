@@ -0,0 +1,203 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"sort"
+	"time"
+
+	"blockchain/storage"
+	"blockchain/types"
+)
+
+const (
+	// panicRestartDelay is how long a long-running task that panicked
+	// waits before it starts over
+	panicRestartDelay = time.Second
+
+	// runningMarker is kept in the data directory while the node runs.
+	// Finding it at start means the last run did not stop cleanly.
+	runningMarker = "node.running"
+
+	// integrityCheckDepth is how many blocks below the tip the startup
+	// check follows parent hashes
+	integrityCheckDepth = 100
+)
+
+// recoverPanic stops a panic in the calling goroutine from crashing the
+// node and reports it. It must be deferred directly.
+func (n *Node) recoverPanic(task string) {
+	if value := recover(); value != nil {
+		n.notePanic(task, value, debug.Stack())
+	}
+}
+
+// exitOnPanic stops the node after a panic while applying a block. The
+// state may hold part of the block, so it must not be used or the block
+// retried; the restart rebuilds the state from the database and, with
+// the running marker left behind, checks the chain first. It must be
+// deferred directly.
+func (n *Node) exitOnPanic(task string) {
+	if value := recover(); value != nil {
+		n.notePanic(task, value, debug.Stack())
+		errorf("Stopping: the state may hold part of a block; restart the node to rebuild it from the database")
+		os.Exit(exitFailure)
+	}
+}
+
+// supervise runs a long-running task in its own goroutine, starting it
+// again after panicRestartDelay whenever it panics
+func (n *Node) supervise(task string, run func()) {
+	go func() {
+		for !n.runRecovered(task, run) {
+			time.Sleep(panicRestartDelay)
+			warnf("Restarting %s after a panic", task)
+		}
+	}()
+}
+
+// runRecovered runs fn, reporting whether it returned without panicking
+func (n *Node) runRecovered(task string, fn func()) (ok bool) {
+	defer n.recoverPanic(task)
+	fn()
+	return true
+}
+
+// notePanic logs a recovered panic with its stack, counts it for
+// /metrics and writes a crash report with -crash-dir
+func (n *Node) notePanic(task string, value interface{}, stack []byte) {
+	errorf("Recovered panic in %s: %v\n%s", task, value, stack)
+
+	n.panicMu.Lock()
+	n.panics[task]++
+	n.panicMu.Unlock()
+
+	if n.config.CrashDir == "" {
+		return
+	}
+	path, err := writeCrashReport(n.config.CrashDir, task, value, stack, n.state.GetHeight())
+	if err != nil {
+		warnf("Failed to write crash report: %v", err)
+		return
+	}
+	infof("Crash report written to %s", path)
+}
+
+// panicCount is the number of panics recovered in one task
+type panicCount struct {
+	Task  string
+	Count uint64
+}
+
+// panicCounts returns the panics recovered since start per task, sorted
+// by task
+func (n *Node) panicCounts() []panicCount {
+	n.panicMu.Lock()
+	defer n.panicMu.Unlock()
+
+	counts := make([]panicCount, 0, len(n.panics))
+	for task, count := range n.panics {
+		counts = append(counts, panicCount{Task: task, Count: count})
+	}
+	sort.Slice(counts, func(i, j int) bool { return counts[i].Task < counts[j].Task })
+	return counts
+}
+
+// writeCrashReport writes a recovered panic to a new file in dir and
+// returns its path
+func writeCrashReport(dir, task string, value interface{}, stack []byte, height uint64) (string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	f, err := os.CreateTemp(dir, "crash-"+now.Format("20060102T150405")+"-*.txt")
+	if err != nil {
+		return "", err
+	}
+
+	report := fmt.Sprintf("task:     %s\ntime:     %s\nheight:   %d\nprotocol: %d\npanic:    %v\n\n%s",
+		task, now.Format(time.RFC3339Nano), height, types.ProtocolVersion, value, stack)
+	if _, err := f.WriteString(report); err != nil {
+		f.Close()
+		return "", err
+	}
+	return f.Name(), f.Close()
+}
+
+// checkCleanShutdown checks the database if the last run of the node did
+// not stop cleanly, then marks the data directory as in use until Stop.
+// Ephemeral nodes start empty and are not checked.
+func checkCleanShutdown(cfg *Config, db *storage.Database) error {
+	if cfg.Ephemeral {
+		return nil
+	}
+
+	marker := cfg.DataDir + "/" + runningMarker
+	_, err := os.Stat(marker)
+	switch {
+	case err == nil:
+		warnf("Node did not stop cleanly; checking the database")
+		if err := checkDatabase(db); err != nil {
+			return fmt.Errorf("database integrity check failed (run \"node verify\" for details): %w", err)
+		}
+		infof("Database integrity check passed")
+	case !errors.Is(err, os.ErrNotExist):
+		return err
+	}
+	return os.WriteFile(marker, nil, 0600)
+}
+
+// markCleanShutdown removes the marker left by checkCleanShutdown
+func markCleanShutdown(cfg *Config) {
+	if cfg.Ephemeral {
+		return
+	}
+	if err := os.Remove(cfg.DataDir + "/" + runningMarker); err != nil && !errors.Is(err, os.ErrNotExist) {
+		warnf("Failed to mark clean shutdown: %v", err)
+	}
+}
+
+// checkDatabase makes sure the stored chain ends at the latest height
+// and that the integrityCheckDepth blocks below it each build on the one
+// before. A crash between storing a block and recording its height
+// leaves the block past the latest height; it was validated before it
+// was stored, so its height is recorded.
+func checkDatabase(db *storage.Database) error {
+	latest, err := db.GetLatestHeight()
+	if err != nil {
+		return fmt.Errorf("failed to read latest height: %w", err)
+	}
+
+	tip := latest
+	if _, err := db.GetBlock(latest + 1); err == nil {
+		tip = latest + 1
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("block %d: failed to load: %w", latest+1, err)
+	}
+
+	var child *types.Block
+	for height := tip; height > 0 && tip-height <= integrityCheckDepth; height-- {
+		block, err := db.GetBlock(height)
+		if err != nil {
+			return fmt.Errorf("block %d: failed to load: %w", height, err)
+		}
+		if block.Header.Height != height {
+			return fmt.Errorf("block %d: stored as height %d", height, block.Header.Height)
+		}
+		if child != nil && child.Header.PrevBlockHash != block.Header.Hash() {
+			return fmt.Errorf("block %d does not build on block %d", height+1, height)
+		}
+		child = block
+	}
+
+	if tip > latest {
+		if err := db.UpdateLatestHeight(tip); err != nil {
+			return fmt.Errorf("failed to update height: %w", err)
+		}
+		warnf("Recorded block %d, stored just before the node stopped", tip)
+	}
+	return nil
+}
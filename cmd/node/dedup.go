@@ -0,0 +1,71 @@
+package main
+
+import (
+	"crypto/sha256"
+	"sync"
+
+	"blockchain/types"
+)
+
+// SeenCacheSize is how many recent block and vote payloads the node
+// remembers, per kind. Votes of a few heights and the blocks within
+// FutureBlockWindow fit many times over.
+const SeenCacheSize = 4096
+
+// seenCache remembers the hashes of recent gossip payloads so that
+// copies of a block or vote arriving from several peers, or sent again,
+// are dropped before they are validated. Payloads are keyed by their
+// full encoding, so a tampered copy of a block never hides the real one.
+// The oldest entry is dropped once it is full.
+type seenCache struct {
+	mu         sync.Mutex
+	entries    map[types.Hash]struct{}
+	order      []types.Hash // ring buffer of entries, oldest at next
+	next       int
+	duplicates uint64
+}
+
+func newSeenCache() *seenCache {
+	return &seenCache{
+		entries: make(map[types.Hash]struct{}),
+		order:   make([]types.Hash, 0, SeenCacheSize),
+	}
+}
+
+// add records a payload and returns its key, reporting whether it was
+// new
+func (c *seenCache) add(payload []byte) (types.Hash, bool) {
+	key := types.Hash(sha256.Sum256(payload))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[key]; ok {
+		c.duplicates++
+		return key, false
+	}
+	if len(c.order) < SeenCacheSize {
+		c.order = append(c.order, key)
+	} else {
+		delete(c.entries, c.order[c.next])
+		c.order[c.next] = key
+		c.next = (c.next + 1) % SeenCacheSize
+	}
+	c.entries[key] = struct{}{}
+	return key, true
+}
+
+// forget drops a payload whose handling failed for a reason that may
+// pass, so a later copy is handled again
+func (c *seenCache) forget(key types.Hash) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
+
+// duplicateCount returns how many copies were dropped since start
+func (c *seenCache) duplicateCount() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.duplicates
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+
+	libp2pcrypto "github.com/libp2p/go-libp2p/core/crypto"
+
+	"blockchain/p2p"
+	"blockchain/rpc"
+	"blockchain/storage"
+)
+
+// ephemeralEngine keeps the chain of an ephemeral node
+const ephemeralEngine = "memory"
+
+// configureEphemeral checks the options of an ephemeral node, which
+// keeps its chain in the memory engine and writes nothing to the data
+// directory
+func configureEphemeral(cfg *Config) error {
+	if !cfg.Ephemeral {
+		return nil
+	}
+	if cfg.DBEngine != ephemeralEngine && cfg.DBEngine != storage.DefaultEngine {
+		return fmt.Errorf("-ephemeral keeps the chain in memory; it cannot be used with -db-engine %s", cfg.DBEngine)
+	}
+	cfg.DBEngine = ephemeralEngine
+	warnf("Ephemeral node: nothing is written to %s, the chain is lost on exit", cfg.DataDir)
+	return nil
+}
+
+// loadIdentity loads the P2P identity encrypted in the data directory
+// with the passphrase the operator gives (see identity.go), or creates
+// one in memory for an ephemeral node
+func loadIdentity(cfg *Config) (libp2pcrypto.PrivKey, error) {
+	if cfg.Ephemeral {
+		identity, err := p2p.NewIdentity()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create P2P identity: %w", err)
+		}
+		return identity, nil
+	}
+
+	keyPath := cfg.DataDir + "/p2p.key"
+	passphrase, err := identityPassphrase(cfg, keyPath)
+	if err != nil {
+		return nil, err
+	}
+	identity, created, err := p2p.LoadOrCreateEncryptedIdentity(keyPath, passphrase, cfg.NewIdentity)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load P2P identity: %w", err)
+	}
+	if created {
+		infof("Created new P2P identity")
+	}
+	return identity, nil
+}
+
+// loadAdminToken loads the admin RPC token, or generates one for an
+// ephemeral node and logs it, since it is stored nowhere
+func loadAdminToken(cfg *Config) (string, error) {
+	if !cfg.Ephemeral {
+		return rpc.LoadOrCreateToken(cfg.AdminTokenFile)
+	}
+	token, err := rpc.NewToken()
+	if err != nil {
+		return "", err
+	}
+	infof("Ephemeral admin token (valid until exit): %s", token)
+	return token, nil
+}
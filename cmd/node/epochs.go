@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"blockchain/rpc"
+	"blockchain/types"
+)
+
+// maxEpochBatch bounds the epochs of one getValidatorHistory call
+const maxEpochBatch = 100
+
+// recordEpochSummary stores the summary of the epoch ending at height.
+// Epochs this node did not apply every block of, such as those before a
+// state sync anchor, are skipped.
+func (n *Node) recordEpochSummary(height uint64) {
+	epoch := n.state.ValidatorSet().EpochOf(height)
+	summary, err := n.buildEpochSummary(epoch)
+	if err != nil {
+		debugf("No summary for epoch %d: %v", epoch, err)
+		return
+	}
+	if err := n.db.SaveEpochSummary(summary); err != nil {
+		warnf("Failed to store epoch summary: %v", err)
+	}
+}
+
+// buildEpochSummary summarizes a finished epoch from its blocks, the set
+// that voted on them and the validators' state after its last block
+func (n *Node) buildEpochSummary(epoch uint64) (*types.EpochSummary, error) {
+	start, end := n.state.ValidatorSet().EpochBounds(epoch)
+	set, err := n.db.GetValidatorSet(start)
+	if err != nil {
+		return nil, fmt.Errorf("validator set at %d: %w", start, err)
+	}
+
+	summary := &types.EpochSummary{
+		Epoch:       epoch,
+		StartHeight: start,
+		EndHeight:   end,
+		TotalStake:  set.TotalStake,
+		Validators:  make([]types.EpochValidator, 0, len(set.Validators)),
+	}
+
+	// row returns a validator's record, adding one after the set for a
+	// validator that joined it during the epoch
+	index := make(map[types.PublicKey]int, len(set.Validators))
+	row := func(pubKey types.PublicKey) *types.EpochValidator {
+		i, ok := index[pubKey]
+		if !ok {
+			i = len(summary.Validators)
+			index[pubKey] = i
+			summary.Validators = append(summary.Validators, types.EpochValidator{PublicKey: pubKey})
+		}
+		return &summary.Validators[i]
+	}
+	for _, val := range set.Validators {
+		row(val.PublicKey).Stake = val.StakedAmount
+	}
+
+	stakes := set.Stakes()
+	blocks := end - start + 1
+	var signedStake float64
+	for height := start; height <= end; height++ {
+		block, err := n.db.GetBlock(height)
+		if err != nil {
+			return nil, fmt.Errorf("block %d: %w", height, err)
+		}
+
+		proposer := row(block.Header.Proposer)
+		proposer.Proposed++
+		for _, tx := range block.Transactions {
+			if !tx.IsCoinbase() {
+				summary.Fees += tx.Fee
+				continue
+			}
+			reward, err := tx.OutputSum()
+			if err != nil {
+				return nil, err
+			}
+			proposer.Rewards += reward
+			summary.Rewards += reward
+		}
+
+		var stake uint64
+		for _, vote := range block.Validators {
+			row(vote.Validator).Signed++
+			stake += stakes[vote.Validator]
+		}
+		if summary.TotalStake > 0 {
+			signedStake += float64(stake) / float64(summary.TotalStake)
+		}
+	}
+	summary.Participation = signedStake / float64(blocks)
+
+	for i := range summary.Validators {
+		r := &summary.Validators[i]
+		r.Missed = blocks - r.Signed
+		val, err := n.state.GetValidator(r.PublicKey)
+		if err != nil {
+			continue // Never staked, such as a genesis proposer
+		}
+		r.EndStake = val.StakedAmount
+		r.Commission = val.Commission
+		r.Jailed = val.Jailed
+		if r.Stake > r.EndStake {
+			r.Slashed = r.Stake - r.EndStake
+			summary.Slashed += r.Slashed
+		}
+	}
+
+	return summary, nil
+}
+
+// rpcGetEpochSummary returns the summary of an epoch, by default the last
+// one to finish
+func (n *Node) rpcGetEpochSummary(params json.RawMessage) (interface{}, error) {
+	var req struct {
+		Epoch *uint64 `json:"epoch"`
+	}
+	if len(params) > 0 && string(params) != "null" {
+		if err := rpc.DecodeParams(params, &req); err != nil {
+			return nil, err
+		}
+	}
+
+	last, err := n.lastFinishedEpoch()
+	if err != nil {
+		return nil, err
+	}
+	epoch := last
+	if req.Epoch != nil {
+		if *req.Epoch > last {
+			return nil, rpc.InvalidParams(fmt.Errorf("epoch must be at most %d", last))
+		}
+		epoch = *req.Epoch
+	}
+
+	summary, err := n.db.GetEpochSummary(epoch)
+	if err != nil {
+		return nil, notFound(err, fmt.Sprintf("summary of epoch %d", epoch))
+	}
+	return summary, nil
+}
+
+// validatorEpoch is one epoch of a validator's history
+type validatorEpoch struct {
+	Epoch       uint64 `json:"epoch"`
+	StartHeight uint64 `json:"start_height"`
+	EndHeight   uint64 `json:"end_height"`
+	TotalStake  uint64 `json:"total_stake"`
+	types.EpochValidator
+}
+
+// rpcGetValidatorHistory returns a validator's record in count epochs
+// from from_epoch on. Epochs it took no part in, and those this node has
+// no summary of, are left out.
+func (n *Node) rpcGetValidatorHistory(params json.RawMessage) (interface{}, error) {
+	var req struct {
+		Validator types.PublicKey `json:"validator"`
+		FromEpoch uint64          `json:"from_epoch"`
+		Count     uint64          `json:"count"`
+	}
+	if err := rpc.DecodeParams(params, &req); err != nil {
+		return nil, err
+	}
+	if req.Count == 0 || req.Count > maxEpochBatch {
+		return nil, rpc.InvalidParams(fmt.Errorf("count must be between 1 and %d", maxEpochBatch))
+	}
+
+	last, err := n.lastFinishedEpoch()
+	if err != nil {
+		return nil, err
+	}
+
+	history := make([]validatorEpoch, 0, req.Count)
+	for epoch := req.FromEpoch; epoch < req.FromEpoch+req.Count && epoch <= last; epoch++ {
+		summary, err := n.db.GetEpochSummary(epoch)
+		if err != nil {
+			continue
+		}
+		for _, val := range summary.Validators {
+			if val.PublicKey == req.Validator {
+				history = append(history, validatorEpoch{
+					Epoch:          summary.Epoch,
+					StartHeight:    summary.StartHeight,
+					EndHeight:      summary.EndHeight,
+					TotalStake:     summary.TotalStake,
+					EpochValidator: val,
+				})
+				break
+			}
+		}
+	}
+	return map[string]interface{}{"validator": req.Validator, "epochs": history}, nil
+}
+
+// lastFinishedEpoch returns the latest epoch whose last block is applied
+func (n *Node) lastFinishedEpoch() (uint64, error) {
+	cfg := n.state.ValidatorSet()
+	height := n.state.GetHeight()
+	if height < cfg.Epoch() {
+		return 0, errors.New("no epoch has finished yet")
+	}
+	return cfg.EpochOf(height - height%cfg.Epoch()), nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+
+	"blockchain/notify"
+	"blockchain/types"
+)
+
+// blockEvent is the data of a block event
+type blockEvent struct {
+	Height    uint64   `json:"height"`
+	Hash      string   `json:"hash"`
+	PrevHash  string   `json:"prev_hash"`
+	Timestamp int64    `json:"timestamp"`
+	Proposer  string   `json:"proposer"`
+	Txs       []string `json:"txs"`
+}
+
+// txEvent is the data of a tx event
+type txEvent struct {
+	Hash    string `json:"hash"`
+	Version uint8  `json:"version"`
+	Fee     uint64 `json:"fee"`
+	Inputs  int    `json:"inputs"`
+	Outputs int    `json:"outputs"`
+}
+
+// finalizedEvent is the data of a finalized event: the commit votes of
+// a block, which subscribers can check against the validator set
+type finalizedEvent struct {
+	Height     uint64                     `json:"height"`
+	Hash       string                     `json:"hash"`
+	Round      uint32                     `json:"round"`
+	Validators []types.ValidatorSignature `json:"validators"`
+}
+
+// startEventPublishers subscribes the configured message bus publishers
+// to the node's events
+func (n *Node) startEventPublishers() error {
+	if n.config.ZMQPub != "" {
+		zmq, err := notify.NewZMQPublisher(n.config.ZMQPub)
+		if err != nil {
+			return fmt.Errorf("failed to start ZeroMQ publisher: %w", err)
+		}
+		n.events.Subscribe(zmq)
+		n.publishers = append(n.publishers, zmq.Close)
+		infof("Publishing events on ZeroMQ at tcp://%s", zmq.Addr())
+	}
+
+	if n.config.NATSURL != "" {
+		nats, err := notify.NewNATSPublisher(n.config.NATSURL, n.config.NATSSubject)
+		if err != nil {
+			return err
+		}
+		n.events.Subscribe(nats)
+		n.publishers = append(n.publishers, nats.Close)
+		infof("Publishing events to NATS subjects %s.*", n.config.NATSSubject)
+	}
+
+	return nil
+}
+
+// stopEventPublishers disconnects the message bus publishers
+func (n *Node) stopEventPublishers() {
+	for _, stop := range n.publishers {
+		stop()
+	}
+}
+
+// publishBlock publishes the events of an applied block
+func (n *Node) publishBlock(block *types.Block) {
+	if !n.events.Active() {
+		return
+	}
+
+	hash := block.Header.Hash().String()
+	txs := make([]string, len(block.Transactions))
+	for i, tx := range block.Transactions {
+		txs[i] = tx.Hash().String()
+	}
+
+	n.events.Publish(&notify.Event{
+		ID:   "block:" + hash,
+		Type: notify.EventBlock,
+		Data: &blockEvent{
+			Height:    block.Header.Height,
+			Hash:      hash,
+			PrevHash:  block.Header.PrevBlockHash.String(),
+			Timestamp: block.Header.Timestamp,
+			Proposer:  block.Header.Proposer.String(),
+			Txs:       txs,
+		},
+	})
+	n.events.Publish(&notify.Event{
+		ID:   "finalized:" + hash,
+		Type: notify.EventFinalized,
+		Data: &finalizedEvent{
+			Height:     block.Header.Height,
+			Hash:       hash,
+			Round:      block.Header.Round,
+			Validators: block.Validators,
+		},
+	})
+}
+
+// publishTx publishes the event of a transaction added to the pool
+func (n *Node) publishTx(tx *types.Transaction, hash types.Hash) {
+	if !n.events.Active() {
+		return
+	}
+
+	n.events.Publish(&notify.Event{
+		ID:   "tx:" + hash.String(),
+		Type: notify.EventTx,
+		Data: &txEvent{
+			Hash:    hash.String(),
+			Version: tx.Version,
+			Fee:     tx.Fee,
+			Inputs:  len(tx.AllInputs()),
+			Outputs: len(tx.AllOutputs()),
+		},
+	})
+}
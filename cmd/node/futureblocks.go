@@ -0,0 +1,169 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"blockchain/p2p"
+	"blockchain/types"
+)
+
+const (
+	// FutureBlockWindow is how far ahead of the next height a gossiped
+	// block is kept until the chain reaches it. A block further ahead
+	// shows the node has fallen behind, so it is left to sync.
+	FutureBlockWindow = 16
+
+	// MaxUnconnectedBlocks is how many blocks that fail to connect a
+	// peer may send before it is banned for UnconnectedBanDuration
+	MaxUnconnectedBlocks   = 3
+	UnconnectedBanDuration = time.Hour
+
+	// Blocks ahead of the next height cost a certificate check, so each
+	// peer may send only futureBlockRate of them per second
+	futureBlockRate  = 2
+	futureBlockBurst = FutureBlockWindow
+
+	// maxBlockPeers bounds the peers tracked; past it, their rate
+	// limits and strikes start over
+	maxBlockPeers = 1024
+)
+
+// futureBlock is a certified block waiting for its parent
+type futureBlock struct {
+	block *types.Block
+	from  string // Peer that forwarded it
+}
+
+// bufferFutureBlock handles a gossiped block ahead of the next height.
+// Certified blocks within FutureBlockWindow wait for the chain to reach
+// them; any certified block tells sync that the peer is ahead. It
+// reports false if the peer was over its quota, so the block was not
+// looked at.
+func (n *Node) bufferFutureBlock(from string, block *types.Block) bool {
+	height := block.Header.Height
+	if !n.allowFutureBlock(from) {
+		debugf("Dropped block %d from %s: too many blocks ahead of the chain", height, from)
+		return false
+	}
+
+	// The certificate is checked against the current validator set, which
+	// may have rotated by then: a failure costs the peer nothing
+	if err := n.consensus.VerifyCertificate(block.SignedHeader()); err != nil {
+		debugf("Dropped block %d from %s without valid certificate: %v", height, from, err)
+		return true
+	}
+	n.notePeerHeight(height)
+	n.sync.NotePeerHeight(from, height)
+
+	next := n.state.GetHeight() + 1
+	if height > next+FutureBlockWindow {
+		debugf("Block %d from %s is %d blocks ahead; left to sync", height, from, height-next)
+		return true
+	}
+
+	n.futureMu.Lock()
+	if _, ok := n.futureBlocks[height]; !ok {
+		n.futureBlocks[height] = &futureBlock{block: block, from: from}
+	}
+	n.futureMu.Unlock()
+
+	// The gap may have closed while the certificate was checked
+	n.applyFutureBlocks()
+	return true
+}
+
+// allowFutureBlock spends one block ahead of the chain from a peer's
+// quota, reporting whether it had any left
+func (n *Node) allowFutureBlock(from string) bool {
+	n.futureMu.Lock()
+	defer n.futureMu.Unlock()
+
+	limiter, ok := n.futureLimiters[from]
+	if !ok {
+		if len(n.futureLimiters) >= maxBlockPeers {
+			clear(n.futureLimiters)
+		}
+		limiter = rate.NewLimiter(futureBlockRate, futureBlockBurst)
+		n.futureLimiters[from] = limiter
+	}
+	return limiter.Allow()
+}
+
+// applyFutureBlocks applies buffered blocks for as long as the next one
+// is there. Blocks the chain has passed are dropped; peers that sent one
+// the chain did not take, or that fails to apply, are penalized.
+func (n *Node) applyFutureBlocks() {
+	for {
+		local := n.state.GetHeight()
+
+		n.futureMu.Lock()
+		var stale []*futureBlock
+		for height, fb := range n.futureBlocks {
+			if height <= local {
+				stale = append(stale, fb)
+				delete(n.futureBlocks, height)
+			}
+		}
+		next, ok := n.futureBlocks[local+1]
+		delete(n.futureBlocks, local+1)
+		n.futureMu.Unlock()
+
+		for _, fb := range stale {
+			n.checkPassedBlock(fb)
+		}
+		if !ok {
+			return
+		}
+
+		if err := n.applyBlock(next.block); err != nil {
+			if errors.Is(err, p2p.ErrInvalidBlock) {
+				n.penalizeBlockPeer(next.from, err)
+			} else {
+				warnf("Failed to apply buffered block %d: %v", next.block.Header.Height, err)
+			}
+			return
+		}
+		n.notePeerHeight(next.block.Header.Height)
+	}
+}
+
+// checkPassedBlock penalizes the sender of a buffered block if the chain
+// took another block at its height
+func (n *Node) checkPassedBlock(fb *futureBlock) {
+	height := fb.block.Header.Height
+	stored, err := n.db.GetBlock(height)
+	if err != nil {
+		return // Pruned or not yet stored
+	}
+	if stored.Header.Hash() != fb.block.Header.Hash() {
+		n.penalizeBlockPeer(fb.from, errors.New("block does not connect to the chain"))
+	}
+}
+
+// penalizeBlockPeer records a block from a peer that did not connect and
+// bans the peer after MaxUnconnectedBlocks of them
+func (n *Node) penalizeBlockPeer(from string, err error) {
+	n.futureMu.Lock()
+	if _, ok := n.blockStrikes[from]; !ok && len(n.blockStrikes) >= maxBlockPeers {
+		clear(n.blockStrikes)
+	}
+	n.blockStrikes[from]++
+	strikes := n.blockStrikes[from]
+	if strikes >= MaxUnconnectedBlocks {
+		delete(n.blockStrikes, from)
+	}
+	n.futureMu.Unlock()
+
+	if strikes < MaxUnconnectedBlocks {
+		debugf("Block from %s did not connect (%d of %d): %v", from, strikes, MaxUnconnectedBlocks, err)
+		return
+	}
+
+	warnf("Banning peer %s: %d blocks did not connect: %v", from, strikes, err)
+	if err := n.network.BanPeer(from, UnconnectedBanDuration); err != nil {
+		warnf("Failed to ban peer %s: %v", from, err)
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// SyncTolerance is how many blocks a node may trail its peers and still
+// count as caught up
+const SyncTolerance = 2
+
+// healthReport is the body of /healthz and /readyz
+type healthReport struct {
+	Status    string          `json:"status"`
+	Role      string          `json:"role"`
+	Archive   bool            `json:"archive,omitempty"`
+	Database  databaseHealth  `json:"database"`
+	Peers     int             `json:"peers"`
+	Sync      syncHealth      `json:"sync"`
+	Consensus consensusHealth `json:"consensus"`
+	Clock     clockHealth     `json:"clock"`
+	Problems  []string        `json:"problems,omitempty"`
+}
+
+type databaseHealth struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+type syncHealth struct {
+	Height         uint64 `json:"height"`
+	BestPeerHeight uint64 `json:"best_peer_height"`
+	CaughtUp       bool   `json:"caught_up"`
+	LastBlockAge   string `json:"last_block_age,omitempty"`
+}
+
+type consensusHealth struct {
+	Validator          bool   `json:"validator"`
+	Active             bool   `json:"active"`
+	JailedUntil        uint64 `json:"jailed_until,omitempty"`
+	LastProposalHeight uint64 `json:"last_proposal_height,omitempty"`
+}
+
+// registerHealthEndpoints exposes liveness and readiness checks on the
+// RPC listener for orchestrators and load balancers
+func (n *Node) registerHealthEndpoints() {
+	n.rpc.HandleHTTP("/healthz", n.handleHealthz)
+	n.rpc.HandleHTTP("/readyz", n.handleReadyz)
+}
+
+// handleHealthz reports whether the node is alive: the process responds
+// and its database is readable
+func (n *Node) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	report := n.healthReport()
+
+	status := http.StatusOK
+	if !report.Database.OK {
+		status = http.StatusServiceUnavailable
+	}
+	writeHealth(w, status, report)
+}
+
+// handleReadyz reports whether the node should receive traffic: it is
+// alive, has enough peers, and is caught up with the chain
+func (n *Node) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	report := n.healthReport()
+
+	status := http.StatusOK
+	if len(report.Problems) > 0 {
+		status = http.StatusServiceUnavailable
+	}
+	writeHealth(w, status, report)
+}
+
+// healthReport gathers the current node status. Problems lists the
+// reasons the node is not ready.
+func (n *Node) healthReport() *healthReport {
+	report := &healthReport{
+		Role:    n.config.Role,
+		Archive: n.config.Archive,
+		Peers:   n.network.GetConnectedPeerCount(),
+	}
+
+	height, err := n.db.GetLatestHeight()
+	if err != nil {
+		report.Database.Error = err.Error()
+		report.Problems = append(report.Problems, "database unavailable")
+	} else {
+		report.Database.OK = true
+	}
+
+	n.healthMu.RLock()
+	lastBlockTime := n.lastBlockTime
+	lastProposal := n.lastProposalHeight
+	n.healthMu.RUnlock()
+	bestPeerHeight := n.bestKnownHeight()
+
+	report.Sync = syncHealth{
+		Height:         height,
+		BestPeerHeight: bestPeerHeight,
+		CaughtUp:       bestPeerHeight <= height+SyncTolerance,
+	}
+	if !lastBlockTime.IsZero() {
+		report.Sync.LastBlockAge = time.Since(lastBlockTime).Round(time.Second).String()
+	}
+	if !report.Sync.CaughtUp {
+		report.Problems = append(report.Problems,
+			fmt.Sprintf("behind peers by %d blocks", bestPeerHeight-height))
+	}
+
+	if report.Peers < n.config.ReadyMinPeers {
+		report.Problems = append(report.Problems,
+			fmt.Sprintf("%d peers, need %d", report.Peers, n.config.ReadyMinPeers))
+	}
+
+	// A skewed clock is reported but does not fail readiness
+	report.Clock = n.clockReport()
+
+	report.Consensus.Validator = n.isValidator
+	report.Consensus.LastProposalHeight = lastProposal
+	if n.isValidator {
+		if val, err := n.state.GetValidator(n.validatorPub); err == nil {
+			report.Consensus.Active = val.Active
+			if val.Jailed {
+				report.Consensus.JailedUntil = val.JailedUntil
+			}
+		}
+	}
+
+	return report
+}
+
+// bestKnownHeight returns the highest chain height heard from peers
+func (n *Node) bestKnownHeight() uint64 {
+	n.healthMu.RLock()
+	best := n.bestPeerHeight
+	n.healthMu.RUnlock()
+
+	// Heights learned through sync cover peers that do not gossip
+	if target := n.sync.Status().TargetHeight; target > best {
+		best = target
+	}
+	return best
+}
+
+// notePeerHeight records the height of a block announced by a peer
+func (n *Node) notePeerHeight(height uint64) {
+	n.healthMu.Lock()
+	defer n.healthMu.Unlock()
+
+	if height > n.bestPeerHeight {
+		n.bestPeerHeight = height
+	}
+}
+
+// noteBlockApplied records that a block was added to the local chain
+func (n *Node) noteBlockApplied() {
+	n.healthMu.Lock()
+	defer n.healthMu.Unlock()
+
+	n.lastBlockTime = time.Now()
+}
+
+// noteProposal records a block proposed by this validator
+func (n *Node) noteProposal(height uint64) {
+	n.healthMu.Lock()
+	defer n.healthMu.Unlock()
+
+	n.lastProposalHeight = height
+}
+
+// writeHealth encodes a health report as JSON
+func writeHealth(w http.ResponseWriter, status int, report *healthReport) {
+	report.Status = "ok"
+	if status != http.StatusOK {
+		report.Status = "unavailable"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+
+	"blockchain/p2p"
+	"blockchain/types"
+)
+
+const (
+	// HeartbeatInterval is the longest a validator waits between
+	// heartbeats; one is also sent whenever a new epoch starts
+	HeartbeatInterval = 5 * time.Minute
+
+	// heartbeatOnline is how recent a heartbeat must be to count as online
+	heartbeatOnline = 2 * HeartbeatInterval
+
+	// heartbeatMaxSkew bounds the clock difference accepted from senders
+	heartbeatMaxSkew = 2 * time.Minute
+
+	heartbeatCheckInterval = 15 * time.Second
+)
+
+// heartbeatEntry is the latest heartbeat seen from one validator
+type heartbeatEntry struct {
+	heartbeat types.Heartbeat
+	received  time.Time
+}
+
+// sendHeartbeats broadcasts a signed heartbeat at startup, at the start
+// of every epoch and at least every HeartbeatInterval
+func (n *Node) sendHeartbeats() {
+	if len(n.validatorKey) != ed25519.PrivateKeySize {
+		warnf("Validator key cannot sign; heartbeats disabled")
+		return
+	}
+
+	ticker := time.NewTicker(heartbeatCheckInterval)
+	defer ticker.Stop()
+
+	var lastSent time.Time
+	var lastEpoch uint64
+	for {
+		height := n.state.GetHeight()
+		epoch := height / n.state.ValidatorSet().Epoch()
+
+		if lastSent.IsZero() || epoch != lastEpoch || time.Since(lastSent) >= HeartbeatInterval {
+			if err := n.sendHeartbeat(height); err != nil {
+				warnf("Failed to send heartbeat: %v", err)
+			} else {
+				lastSent = time.Now()
+				lastEpoch = epoch
+			}
+		}
+
+		<-ticker.C
+	}
+}
+
+// sendHeartbeat signs and broadcasts one heartbeat
+func (n *Node) sendHeartbeat(height uint64) error {
+	hb := &types.Heartbeat{
+		Validator: n.validatorPub,
+		Height:    height,
+		Timestamp: time.Now().Unix(),
+	}
+
+	sigHash := hb.SigningHash(n.chainID)
+	copy(hb.Signature[:], ed25519.Sign(n.validatorKey, sigHash[:]))
+
+	// Gossip does not deliver our own messages back
+	n.recordHeartbeat(hb)
+
+	debugf("Heartbeat sent at height %d", height)
+	return n.network.BroadcastHeartbeat(hb)
+}
+
+// handleHeartbeat verifies and records a gossiped heartbeat
+func (n *Node) handleHeartbeat(data []byte) error {
+	var msg p2p.Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return err
+	}
+
+	var hb types.Heartbeat
+	if err := json.Unmarshal(msg.Data, &hb); err != nil {
+		return err
+	}
+
+	if _, err := n.state.GetValidator(hb.Validator); err != nil {
+		return errors.New("heartbeat from unknown validator")
+	}
+
+	skew := time.Since(time.Unix(hb.Timestamp, 0))
+	if skew > heartbeatMaxSkew || skew < -heartbeatMaxSkew {
+		return fmt.Errorf("heartbeat timestamp off by %s", skew.Round(time.Second))
+	}
+
+	sigHash := hb.SigningHash(n.chainID)
+	if !ed25519.Verify(ed25519.PublicKey(hb.Validator[:]), sigHash[:], hb.Signature[:]) {
+		return errors.New("invalid heartbeat signature")
+	}
+
+	if !n.recordHeartbeat(&hb) {
+		return nil // Replayed or out of order
+	}
+
+	debugf("Heartbeat from %s at height %d", hb.Validator.String()[:8], hb.Height)
+	return nil
+}
+
+// recordHeartbeat stores a heartbeat unless a newer one is known
+func (n *Node) recordHeartbeat(hb *types.Heartbeat) bool {
+	n.heartbeatMu.Lock()
+	defer n.heartbeatMu.Unlock()
+
+	if prev, ok := n.heartbeats[hb.Validator]; ok && prev.heartbeat.Timestamp >= hb.Timestamp {
+		return false
+	}
+
+	n.heartbeats[hb.Validator] = &heartbeatEntry{heartbeat: *hb, received: time.Now()}
+	return true
+}
+
+// ValidatorLiveness is one row of the getValidatorLiveness table
+type ValidatorLiveness struct {
+	Validator       types.PublicKey `json:"validator"`
+	Status          string          `json:"status"` // active, queued, jailed or inactive
+	Online          bool            `json:"online"`
+	LastHeartbeat   int64           `json:"last_heartbeat,omitempty"` // Unix seconds
+	HeartbeatHeight uint64          `json:"heartbeat_height,omitempty"`
+	MissedBlocks    uint64          `json:"missed_blocks"`
+	JailedUntil     uint64          `json:"jailed_until,omitempty"`
+}
+
+func (n *Node) rpcGetValidatorLiveness(params json.RawMessage) (interface{}, error) {
+	state := n.state.View()
+	validators := state.GetActiveValidators()
+	validators = append(validators, state.GetQueuedValidators()...)
+	validators = append(validators, state.GetJailedValidators()...)
+
+	n.heartbeatMu.RLock()
+	defer n.heartbeatMu.RUnlock()
+
+	table := make([]ValidatorLiveness, 0, len(validators))
+	for _, val := range validators {
+		row := ValidatorLiveness{
+			Validator:    val.PublicKey,
+			Status:       validatorStatus(val),
+			MissedBlocks: val.MissedCount,
+			JailedUntil:  val.JailedUntil,
+		}
+		if entry, ok := n.heartbeats[val.PublicKey]; ok {
+			row.Online = time.Since(entry.received) < heartbeatOnline
+			row.LastHeartbeat = entry.heartbeat.Timestamp
+			row.HeartbeatHeight = entry.heartbeat.Height
+		}
+		table = append(table, row)
+	}
+
+	return struct {
+		Window     uint64              `json:"window"` // Blocks MissedBlocks counts over
+		Validators []ValidatorLiveness `json:"validators"`
+	}{
+		Window:     n.state.Liveness().Window(),
+		Validators: table,
+	}, nil
+}
+
+// validatorStatus names a validator's place in the set
+func validatorStatus(val *types.ValidatorState) string {
+	switch {
+	case val.Jailed:
+		return "jailed"
+	case val.Active:
+		return "active"
+	case val.Queued:
+		return "queued"
+	default:
+		return "inactive"
+	}
+}
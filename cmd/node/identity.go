@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// identityPassphraseEnv names the environment variable that may carry
+// the P2P identity passphrase
+const identityPassphraseEnv = "APEX_IDENTITY_PASSPHRASE"
+
+// identityPassphrase returns the passphrase encrypting the P2P identity
+// key at keyPath, from -identity-passphrase-file, then the environment,
+// then a prompt on the terminal. It is never kept in the data directory
+// beside the key, and a node without one does not start.
+func identityPassphrase(cfg *Config, keyPath string) ([]byte, error) {
+	if cfg.IdentityPassphraseFile != "" {
+		inside, err := inDir(cfg.IdentityPassphraseFile, cfg.DataDir)
+		if err != nil {
+			return nil, err
+		}
+		if inside {
+			return nil, fmt.Errorf("identity passphrase file %s is in the data directory; keep it elsewhere", cfg.IdentityPassphraseFile)
+		}
+		data, err := os.ReadFile(cfg.IdentityPassphraseFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read identity passphrase: %w", err)
+		}
+		passphrase := strings.TrimSpace(string(data))
+		if passphrase == "" {
+			return nil, fmt.Errorf("identity passphrase file %s is empty", cfg.IdentityPassphraseFile)
+		}
+		return []byte(passphrase), nil
+	}
+	if passphrase := os.Getenv(identityPassphraseEnv); passphrase != "" {
+		return []byte(passphrase), nil
+	}
+
+	passphrase, err := readPassphrase("P2P identity passphrase: ")
+	if err != nil {
+		return nil, missingPassphrase(cfg, err)
+	}
+	if passphrase == "" {
+		return nil, errors.New("empty identity passphrase")
+	}
+
+	// A mistyped passphrase for a new key would lock it away for good
+	if _, err := os.Stat(keyPath); cfg.NewIdentity || os.IsNotExist(err) {
+		again, err := readPassphrase("Repeat passphrase: ")
+		if err != nil {
+			return nil, err
+		}
+		if again != passphrase {
+			return nil, errors.New("identity passphrases do not match")
+		}
+	}
+	return []byte(passphrase), nil
+}
+
+// missingPassphrase explains how to give the identity passphrase to a
+// node that could not prompt for it
+func missingPassphrase(cfg *Config, err error) error {
+	hint := fmt.Sprintf("set -identity-passphrase-file or %s, or start the node on a terminal", identityPassphraseEnv)
+	if _, statErr := os.Stat(cfg.DataDir + "/identity.pass"); statErr == nil {
+		hint = fmt.Sprintf("move %s/identity.pass out of the data directory and pass it to -identity-passphrase-file", cfg.DataDir)
+	}
+	return fmt.Errorf("no identity passphrase (%v): %s", err, hint)
+}
+
+// inDir reports whether path lies inside dir
+func inDir(path, dir string) (bool, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false, err
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return false, err
+	}
+	rel, err := filepath.Rel(absDir, absPath)
+	if err != nil {
+		return false, nil
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)), nil
+}
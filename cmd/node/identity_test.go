@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	libp2pcrypto "github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// TestSeedIdentityEncrypted checks that a seed's plain key is encrypted
+// in place with the passphrase from the environment, keeping its peer
+// ID, and that a passphrase file in the data directory is refused
+func TestSeedIdentityEncrypted(t *testing.T) {
+	cfg := &Config{DataDir: t.TempDir()}
+	key, _, err := libp2pcrypto.GenerateEd25519Key(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := libp2pcrypto.MarshalPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cfg.DataDir+"/seed.key", data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(identityPassphraseEnv, "correct horse")
+	identity, err := loadSeedIdentity(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := peer.IDFromPrivateKey(key)
+	if got, _ := peer.IDFromPrivateKey(identity); got != want {
+		t.Fatalf("peer ID %s after encrypting the seed key, want %s", got, want)
+	}
+	if _, err := os.Stat(cfg.DataDir + "/seed.key"); !os.IsNotExist(err) {
+		t.Fatalf("plain seed key left behind: %v", err)
+	}
+	if identity, err := loadSeedIdentity(cfg); err != nil || !identity.Equals(key) {
+		t.Fatalf("reloading the encrypted seed key: %v", err)
+	}
+
+	t.Setenv(identityPassphraseEnv, "wrong")
+	if _, err := loadSeedIdentity(cfg); err == nil {
+		t.Fatal("seed key opened with the wrong passphrase")
+	}
+
+	cfg.IdentityPassphraseFile = cfg.DataDir + "/identity.pass"
+	if err := os.WriteFile(cfg.IdentityPassphraseFile, []byte("correct horse\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadSeedIdentity(cfg); err == nil {
+		t.Fatal("passphrase file in the data directory accepted")
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+)
+
+// Log levels, from most to least verbose
+const (
+	levelDebug int32 = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+// logLevel is the minimum level written to the log
+var logLevel atomic.Int32
+
+func init() {
+	logLevel.Store(levelInfo)
+}
+
+// parseLogLevel converts a level name to its value
+func parseLogLevel(name string) (int32, error) {
+	for i, n := range levelNames {
+		if strings.EqualFold(name, n) {
+			return int32(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q (want debug, info, warn or error)", name)
+}
+
+// setLogLevel changes the log level at runtime
+func setLogLevel(name string) error {
+	level, err := parseLogLevel(name)
+	if err != nil {
+		return err
+	}
+	logLevel.Store(level)
+	return nil
+}
+
+// logAt writes a log line if level is enabled
+func logAt(level int32, prefix, format string, args ...interface{}) {
+	if level < logLevel.Load() {
+		return
+	}
+	log.Printf(prefix+format, args...)
+}
+
+func debugf(format string, args ...interface{}) { logAt(levelDebug, "DEBUG ", format, args...) }
+func infof(format string, args ...interface{})  { logAt(levelInfo, "", format, args...) }
+func warnf(format string, args ...interface{})  { logAt(levelWarn, "WARN ", format, args...) }
+func errorf(format string, args ...interface{}) { logAt(levelError, "ERROR ", format, args...) }
@@ -1,35 +1,129 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 	
 	"golang.org/x/crypto/ed25519"
+	"golang.org/x/time/rate"
 	"blockchain/consensus"
 	"blockchain/crypto"
 	"blockchain/ledger"
+	"blockchain/notify"
 	"blockchain/p2p"
+	"blockchain/rosetta"
+	"blockchain/rpc"
 	"blockchain/storage"
 	"blockchain/types"
+	"blockchain/wallet"
 )
 
 type Config struct {
+	ConfigFile     string // Read for flags not given; see config.go
 	DataDir        string
 	P2PPort        int
 	BootstrapPeers []string
 	ValidatorKey   string
 	GenesisFile    string
+	RPCAddr        string
+	Dandelion      p2p.DandelionConfig
+	Proxy          *p2p.ProxyConfig // nil for direct connections
+	ReadyMinPeers  int
+	MinPeers       int // See p2p.Network.SetMinPeers
+	MempoolMaxTxs  int // 0 for no limit
+	AdminTokenFile string
+	LogLevel       string
+	RewardAddress  string
+	RosettaAddr    string // Empty disables the Rosetta API
+	StateSync      bool   // Start from a state snapshot downloaded from peers
+	Role           string // See role.go; empty picks one from the other flags
+	Archive        bool   // Never validate, keep full history (see OpenArchive)
+	DBEngine       string // Name in storage.Engines
+	Seed           bool   // Discovery only, no ledger or database (see seed.go)
+	NTPServer      string // Empty disables NTP clock checks
+	Gossip         p2p.GossipConfig
+	BlockAssembler string // Name in consensus.Assemblers
+	
+	// RPC access control (see configureRPCAccess)
+	RPCTLS            rpc.TLSConfig
+	RPCCORSOrigins    []string
+	RPCRestrictWrites bool
+	RPCAccess         []string // "method=level" overrides
+	RPCRateLimit      rpc.RateLimitConfig
+	RPCCosts          []string // "method=cost" overrides
+	BlockLimits    consensus.BlockLimits
+	Timeouts       consensus.TimeoutConfig // Round timeouts of validators
+
+	// EmptyBlockInterval is the longest a proposer waits before proposing
+	// a block without transactions; 0 proposes one every BlockTime
+	EmptyBlockInterval time.Duration
+
+	// Opt-in scanning service for light wallets (see scanservice.go)
+	ScanServiceEnabled bool
+	ScanService        wallet.ScanServiceConfig
+	
+	// Message bus publishers of node events (see events.go); empty
+	// disables each
+	ZMQPub      string // ZeroMQ PUB bind address
+	NATSURL     string
+	NATSSubject string // Subject prefix
+	
+	// The P2P key is kept encrypted in the data directory so the peer
+	// ID survives restarts (see p2p/identity.go), under a passphrase
+	// from outside it (see identity.go); NewIdentity replaces it
+	IdentityPassphraseFile string
+	NewIdentity            bool
+	
+	// Ephemeral nodes keep everything in memory and write nothing to
+	// DataDir (see ephemeral.go)
+	Ephemeral bool
+	
+	// Unix socket for 'node ctl', empty to disable, and the token its
+	// requests are signed with (see control.go)
+	ControlSocket    string
+	ControlTokenFile string
+	
+	// Directory for reports of recovered panics, empty for none (see
+	// crash.go)
+	CrashDir string
+	
+	// Value of every flag, to tell which ones a reload changed
+	flagValues map[string]string
 }
 
 func main() {
+	// Offline state tools run instead of the node
+	if runStateCommand(os.Args[1:]) {
+		return
+	}
+	
 	// Parse flags
-	cfg := parseFlags()
+	cfg, err := parseConfig(os.Args[1:], flag.ExitOnError)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	
+	if err := setLogLevel(cfg.LogLevel); err != nil {
+		log.Fatalf("Invalid log level: %v", err)
+	}
+	
+	// Seed nodes only help peers find each other
+	if cfg.Seed {
+		runSeed(cfg)
+		return
+	}
 	
 	// Initialize node
 	node, err := NewNode(cfg)
@@ -42,47 +136,164 @@ func main() {
 		log.Fatalf("Failed to start node: %v", err)
 	}
 	
-	log.Printf("Node started successfully")
-	log.Printf("Peer ID: %s", node.network.GetHostID())
-	log.Printf("Listening on: %v", node.network.GetMultiaddrs())
+	infof("Node started successfully")
+	infof("Peer ID: %s", node.network.GetHostID())
+	infof("Listening on: %v", node.network.GetMultiaddrs())
 	
-	// Wait for shutdown signal
+	// Wait for shutdown signal or a stop over the control socket,
+	// reloading the configuration on SIGHUP
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	<-sigChan
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+wait:
+	for {
+		select {
+		case sig := <-sigChan:
+			if sig != syscall.SIGHUP {
+				break wait
+			}
+			if _, err := node.reloadConfig(); err != nil {
+				warnf("Failed to reload configuration: %v", err)
+			}
+		case <-node.stopRequested:
+			break wait
+		}
+	}
 	
-	log.Println("Shutting down...")
+	infof("Shutting down...")
 	node.Stop()
 }
 
 type Node struct {
 	config    *Config
+	chainID   string
 	db        *storage.Database
 	state     *ledger.State
 	consensus *consensus.Engine
 	network   *p2p.Network
+	rpc       *rpc.Server
+	control   *rpc.Server // nil without a control socket (see control.go)
+	rosetta   *rosetta.Server
+	sync      *p2p.SyncManager
+	
+	// Closed when a stop is requested over the control socket
+	stopRequested chan struct{}
+	stopOnce      sync.Once
+	
+	// genesisHash is the canonical hash of the chain's genesis, pinned
+	// in the database (see genesis.go)
+	genesisHash types.Hash
+	
+	scanService *wallet.ScanService // nil unless enabled
+	
+	// Node events and the publishers stopped with the node (see events.go)
+	events     *notify.Bus
+	publishers []func()
+	
+	// blockMu serializes applying blocks from gossip and sync
+	blockMu sync.Mutex
+	
+	// State snapshots served to and downloaded from peers (see statesync.go)
+	stateMu         sync.RWMutex
+	stateSnap       *types.ChunkedState
+	stateSyncCancel context.CancelFunc
+	stateSyncDone   chan struct{}
+	
+	// Latest heartbeat per validator (see heartbeat.go)
+	heartbeatMu sync.RWMutex
+	heartbeats  map[types.PublicKey]*heartbeatEntry
+	
+	// Gossiped blocks ahead of the chain, and how peers sending them
+	// behave (see futureblocks.go)
+	futureMu       sync.Mutex
+	futureBlocks   map[uint64]*futureBlock
+	futureLimiters map[string]*rate.Limiter
+	blockStrikes   map[string]int
+	
+	// Block and vote payloads already handled (see dedup.go)
+	seenBlocks *seenCache
+	seenVotes  *seenCache
+	
+	// Panics recovered per task (see crash.go)
+	panicMu sync.Mutex
+	panics  map[string]uint64
+	
+	// Configuration last loaded by a reload (see config.go)
+	reloadMu sync.Mutex
+	loaded   *Config
 	
 	// Transaction pool
-	txPool []*types.Transaction
+	txPool    []*types.Transaction      // Arrival order
+	txIndex   map[types.Hash]*poolEntry // txPool by hash (see mempool.go)
+	txPoolMu  sync.Mutex
+	poolLimit atomic.Int64             // Most transactions pooled; 0 for no limit
+	
+	// Staking transactions waiting for a block, one per validator (see
+	// staking.go)
+	stakingMu   sync.Mutex
+	stakingPool map[types.PublicKey]*types.StakingTx
+	assembler consensus.BlockAssembler // Chooses proposal transactions
+	slots     consensus.SlotClock      // When to propose (see produceBlocks)
 	
 	// Validator identity
 	validatorKey ed25519.PrivateKey
 	validatorPub types.PublicKey
 	isValidator  bool
+	
+	// Chain progress for health checks (see health.go)
+	healthMu           sync.RWMutex
+	bestPeerHeight     uint64
+	lastBlockTime      time.Time
+	lastProposalHeight uint64
+	clockOffset        time.Duration // See clock.go
+	clockSource        string
 }
 
 func NewNode(cfg *Config) (*Node, error) {
+	if err := configureEphemeral(cfg); err != nil {
+		return nil, err
+	}
+	
+	// Archive nodes keep every block, so they cannot start from a snapshot
+	if cfg.Archive && cfg.StateSync {
+		return nil, fmt.Errorf("-archive and -state-sync cannot be used together")
+	}
+	if cfg.EmptyBlockInterval < 0 {
+		return nil, fmt.Errorf("-empty-block-interval must not be negative")
+	}
+	if cfg.ScanServiceEnabled && (cfg.ScanService.MaxWallets < 1 || cfg.ScanService.TTL <= 0) {
+		return nil, fmt.Errorf("-scan-service-max-wallets and -scan-service-ttl must be positive")
+	}
+	if err := checkLimits(cfg); err != nil {
+		return nil, err
+	}
+	assembler, err := consensus.GetAssembler(cfg.BlockAssembler)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.BlockLimits.Validate(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Timeouts.Validate(); err != nil {
+		return nil, err
+	}
+	
 	// Open database
-	db, err := storage.Open(cfg.DataDir + "/blockchain.db")
+	db, err := storage.OpenEngine(cfg.DBEngine, cfg.DataDir+"/blockchain.db", storage.Options{Archive: cfg.Archive})
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 	
+	// Check the chain before consensus resumes if the node crashed
+	if err := checkCleanShutdown(cfg, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	
 	// Initialize state
 	state := ledger.NewState()
 	
 	// Load or create genesis
-	genesis, err := loadGenesis(db, cfg.GenesisFile)
+	genesis, genesisHash, err := loadGenesis(db, cfg.GenesisFile)
 	if err != nil {
 		db.Close()
 		return nil, fmt.Errorf("failed to load genesis: %w", err)
@@ -92,13 +303,30 @@ func NewNode(cfg *Config) (*Node, error) {
 		db.Close()
 		return nil, fmt.Errorf("failed to initialize genesis: %w", err)
 	}
+	slots, err := consensus.NewSlotClock(genesis.GenesisTime)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	
+	// Warn early about scheduled forks this build cannot follow
+	for _, fork := range genesis.Forks {
+		if fork.Version > types.ProtocolVersion {
+			warnf("Fork %q at height %d requires protocol version %d, this node supports %d; upgrade before then",
+				fork.Name, fork.Height, fork.Version, types.ProtocolVersion)
+		}
+	}
 	
 	// Load validator key if provided
 	var validatorKey ed25519.PrivateKey
 	var validatorPub types.PublicKey
 	isValidator := false
 	
-	if cfg.ValidatorKey != "" {
+	if cfg.Archive {
+		if cfg.ValidatorKey != "" {
+			warnf("Archive node: ignoring -validator, no blocks or votes will be produced")
+		}
+	} else if cfg.ValidatorKey != "" {
 		key, err := loadValidatorKey(cfg.ValidatorKey)
 		if err != nil {
 			db.Close()
@@ -111,13 +339,44 @@ func NewNode(cfg *Config) (*Node, error) {
 	
 	// Create consensus engine
 	consensusEngine := consensus.NewEngine(state, validatorKey, validatorPub)
+	consensusEngine.SetTimeouts(cfg.Timeouts)
 	if err := consensusEngine.UpdateValidatorSet(); err != nil {
 		db.Close()
 		return nil, fmt.Errorf("failed to update validator set: %w", err)
 	}
 	
+	// Resume the round a validator was in before a crash
+	if isValidator && !cfg.Ephemeral {
+		replayed, err := consensusEngine.OpenWAL(cfg.DataDir + "/consensus.wal")
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to open consensus WAL: %w", err)
+		}
+		if replayed > 0 {
+			infof("Replayed %d consensus WAL entries", replayed)
+		}
+	}
+	
+	if cfg.RewardAddress != "" {
+		addr, pid, err := wallet.ParseAddress(genesis.Network, cfg.RewardAddress)
+		if err != nil || pid != nil {
+			db.Close()
+			return nil, fmt.Errorf("invalid reward address (standard address required): %v", err)
+		}
+		consensusEngine.SetRewardAddress(addr)
+	} else if isValidator && genesis.Emission.InitialSubsidy > 0 {
+		warnf("No -reward-address set; proposed blocks will not claim the block reward")
+	}
+	
+	// Load the P2P identity, so peers can keep protecting this node
+	identity, err := loadIdentity(cfg)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	
 	// Create P2P network
-	network, err := p2p.NewNetwork(cfg.P2PPort, cfg.BootstrapPeers)
+	network, err := p2p.NewNetwork(genesis.ChainID, cfg.P2PPort, cfg.BootstrapPeers, cfg.Proxy, cfg.Gossip, identity)
 	if err != nil {
 		db.Close()
 		return nil, fmt.Errorf("failed to create network: %w", err)
@@ -125,20 +384,104 @@ func NewNode(cfg *Config) (*Node, error) {
 	
 	node := &Node{
 		config:       cfg,
+		chainID:      genesis.ChainID,
+		genesisHash:  genesisHash,
 		db:           db,
 		state:        state,
 		consensus:    consensusEngine,
 		network:      network,
 		txPool:       make([]*types.Transaction, 0),
+		txIndex:      make(map[types.Hash]*poolEntry),
+		stakingPool:  make(map[types.PublicKey]*types.StakingTx),
+		assembler:    assembler,
+		slots:        slots,
+		heartbeats:   make(map[types.PublicKey]*heartbeatEntry),
+		
+		stopRequested: make(chan struct{}),
+		
+		futureBlocks:   make(map[uint64]*futureBlock),
+		futureLimiters: make(map[string]*rate.Limiter),
+		blockStrikes:   make(map[string]int),
+		panics:         make(map[string]uint64),
+		seenBlocks:     newSeenCache(),
+		seenVotes:      newSeenCache(),
+		
+		loaded: cfg,
+		
+		events:       notify.NewBus(),
 		validatorKey: validatorKey,
 		validatorPub: validatorPub,
 		isValidator:  isValidator,
 	}
 	
+	node.poolLimit.Store(int64(cfg.MempoolMaxTxs))
+	network.SetMinPeers(cfg.MinPeers)
+	
 	// Set up message handlers
+	network.SetPanicHandler(node.notePanic)
+	network.SetStatusFunc(node.status)
 	network.SetBlockHandler(node.handleBlock)
+	network.SetProposalHandler(node.handleProposal)
 	network.SetTxHandler(node.handleTransaction)
 	network.SetVoteHandler(node.handleVote)
+	network.SetHeartbeatHandler(node.handleHeartbeat)
+	network.SetStakingHandler(node.handleStakingTx)
+	network.SetDandelionConfig(cfg.Dandelion)
+	network.SetTxLookup(node.pooledTransaction)
+	network.SetBlockProvider(db.GetBlock)
+	consensusEngine.SetBlockProvider(db.GetBlock)
+	consensusEngine.SetValidatorSetProvider(db.GetValidatorSet)
+	network.SetStateProvider(node.servedState)
+	node.recordValidatorSet(state.GetHeight() + 1)
+	
+	// Download missing blocks from all peers in parallel
+	node.sync = p2p.NewSyncManager(network, p2p.DefaultSyncConfig(), state.GetHeight, node.applyBlock)
+	node.sync.SetHeaderVerifier(consensusEngine.VerifyCertificate) // Bodies only for certified headers
+	
+	// Set up RPC server
+	if cfg.RPCAddr != "" {
+		node.rpc = rpc.NewServer(cfg.RPCAddr)
+		node.rpc.SetPanicHandler(func(method string, value interface{}, stack []byte) {
+			node.notePanic("RPC method "+method, value, stack)
+		})
+		node.registerRPCMethods()
+		if cfg.ScanServiceEnabled {
+			node.registerScanServiceMethods()
+		}
+		node.registerHealthEndpoints()
+		node.registerMetricsEndpoint()
+		
+		// Admin methods need a token kept in the data directory
+		adminToken, err := loadAdminToken(cfg)
+		if err != nil {
+			network.Close()
+			db.Close()
+			return nil, fmt.Errorf("failed to load admin token: %w", err)
+		}
+		node.rpc.SetAdminToken(adminToken)
+		node.registerAdminMethods()
+		
+		if err := node.configureRPCAccess(cfg); err != nil {
+			network.Close()
+			db.Close()
+			return nil, fmt.Errorf("invalid RPC configuration: %w", err)
+		}
+	}
+	
+	// Set up Rosetta API server
+	if cfg.RosettaAddr != "" {
+		node.rosetta = node.newRosettaServer(cfg.RosettaAddr)
+	}
+	
+	// Set up the local control socket
+	if cfg.ControlSocket != "" {
+		node.control, err = node.newControlServer(cfg)
+		if err != nil {
+			network.Close()
+			db.Close()
+			return nil, err
+		}
+	}
 	
 	return node, nil
 }
@@ -149,34 +492,139 @@ func (n *Node) Start() error {
 		return err
 	}
 	
-	// Sync blockchain
-	go n.syncBlockchain()
+	// Start RPC server
+	if n.rpc != nil {
+		if err := n.rpc.Start(); err != nil {
+			return fmt.Errorf("failed to start RPC server: %w", err)
+		}
+		infof("RPC listening on %s", n.rpc.Addr())
+	}
+	
+	// Start Rosetta API server
+	if n.rosetta != nil {
+		if err := n.rosetta.Start(); err != nil {
+			return fmt.Errorf("failed to start Rosetta server: %w", err)
+		}
+		infof("Rosetta API listening on %s", n.rosetta.Addr())
+	}
+	
+	// Start control socket
+	if n.control != nil {
+		if err := n.control.Start(); err != nil {
+			return fmt.Errorf("failed to start control socket: %w", err)
+		}
+		infof("Control socket listening on %s", n.control.Addr())
+	}
+	
+	if err := n.startEventPublishers(); err != nil {
+		return err
+	}
+	
+	// Warn early if the system clock is off
+	n.supervise("clock monitor", n.monitorClock)
+	
+	// Sync blockchain, starting from a state snapshot if enabled
+	if n.config.StateSync {
+		n.startStateSync()
+	} else {
+		n.sync.Start()
+		infof("Blockchain sync started")
+	}
+	
+	infof("Running as %s node", n.config.Role)
+	if n.config.Archive {
+		infof("Archive node: serving RPC and sync, not validating")
+	}
 	
 	// Start block production if validator
 	if n.isValidator {
-		go n.produceBlocks()
+		n.supervise("block production", n.produceBlocks)
+		n.supervise("heartbeats", n.sendHeartbeats)
+		n.supervise("round timer", n.watchRounds)
 	}
 	
 	return nil
 }
 
 func (n *Node) Stop() {
+	if n.rpc != nil {
+		n.rpc.Close()
+	}
+	if n.rosetta != nil {
+		n.rosetta.Close()
+	}
+	if n.control != nil {
+		n.control.Close()
+	}
+	n.stopStateSync()
+	n.sync.Stop()
+	n.stopEventPublishers()
 	n.network.Close()
+	n.consensus.CloseWAL()
 	n.db.Close()
+	markCleanShutdown(n.config)
 }
 
-func (n *Node) handleBlock(data []byte) error {
+func (n *Node) handleBlock(from string, data []byte) error {
 	var msg p2p.Message
 	if err := json.Unmarshal(data, &msg); err != nil {
 		return err
 	}
 	
+	// Copies relayed by several peers are handled once
+	key, fresh := n.seenBlocks.add(msg.Data)
+	if !fresh {
+		return nil
+	}
+	
 	var block types.Block
 	if err := json.Unmarshal(msg.Data, &block); err != nil {
 		return err
 	}
 	
-	log.Printf("Received block at height %d", block.Header.Height)
+	debugf("Received block at height %d", block.Header.Height)
+	
+	// Only finalized blocks are gossiped here; candidates arrive on the
+	// proposal topic (see proposal.go). Blocks ahead of the next height
+	// wait for their parent or are left to sync (see futureblocks.go).
+	height := n.state.GetHeight()
+	if block.Header.Height <= height {
+		return nil // Finalized locally and received as well
+	}
+	if block.Header.Height > height+1 {
+		if !n.bufferFutureBlock(from, &block) {
+			n.seenBlocks.forget(key) // Another peer's copy may get through
+		}
+		return nil
+	}
+	
+	// The certificate is checked with the rest of the block
+	if err := n.applyBlock(&block); err != nil {
+		if errors.Is(err, p2p.ErrInvalidBlock) {
+			n.penalizeBlockPeer(from, err)
+		} else {
+			n.seenBlocks.forget(key)
+		}
+		return err
+	}
+	n.notePeerHeight(block.Header.Height)
+	n.applyFutureBlocks()
+	
+	return nil
+}
+
+// applyBlock validates the next block of the chain and stores it.
+// Validation failures wrap p2p.ErrInvalidBlock so sync can penalize the
+// peer that served the block. A panic stops the node (see exitOnPanic).
+func (n *Node) applyBlock(block *types.Block) error {
+	n.blockMu.Lock()
+	defer n.blockMu.Unlock()
+	defer n.exitOnPanic("apply block")
+	
+	// The block may have been finalized locally and received as well
+	if block.Header.Height <= n.state.GetHeight() {
+		return nil
+	}
 	
 	// Get previous block
 	prevBlock, err := n.db.GetBlock(block.Header.Height - 1)
@@ -184,18 +632,22 @@ func (n *Node) handleBlock(data []byte) error {
 		return fmt.Errorf("failed to get previous block: %w", err)
 	}
 	
-	// Validate block
-	if err := n.consensus.ValidateBlock(&block, prevBlock); err != nil {
-		return fmt.Errorf("invalid block: %w", err)
+	// Validate block. A block of a protocol version this node does not
+	// support is no fault of the peer that sent it.
+	if err := n.consensus.ValidateBlock(block, prevBlock); err != nil {
+		if errors.Is(err, consensus.ErrUpgradeRequired) {
+			return err
+		}
+		return fmt.Errorf("%w: %w", p2p.ErrInvalidBlock, err)
 	}
 	
 	// Apply to state
-	if err := n.state.ApplyBlock(&block); err != nil {
-		return fmt.Errorf("failed to apply block: %w", err)
+	if err := n.state.ApplyBlock(block); err != nil {
+		return fmt.Errorf("%w: failed to apply block: %w", p2p.ErrInvalidBlock, err)
 	}
 	
 	// Save to database
-	if err := n.db.SaveBlock(&block); err != nil {
+	if err := n.db.SaveBlock(block); err != nil {
 		return fmt.Errorf("failed to save block: %w", err)
 	}
 	
@@ -203,11 +655,42 @@ func (n *Node) handleBlock(data []byte) error {
 		return fmt.Errorf("failed to update height: %w", err)
 	}
 	
-	log.Printf("Block %d finalized", block.Header.Height)
+	// Follow active set rotations and jailing
+	if err := n.consensus.UpdateValidatorSet(); err != nil {
+		warnf("Failed to update validator set: %v", err)
+	}
+	n.recordValidatorSet(block.Header.Height + 1)
+	if n.state.ValidatorSet().IsEpochEnd(block.Header.Height) {
+		n.recordEpochSummary(block.Header.Height)
+	}
+	if err := n.consensus.StartHeight(block); err != nil {
+		warnf("Failed to update consensus WAL: %v", err)
+	}
+	
+	if block.Header.Height%StateSnapshotInterval == 0 {
+		n.takeStateSnapshot()
+	}
+	
+	n.noteBlockApplied()
+	n.publishBlock(block)
+	infof("Block %d finalized", block.Header.Height)
 	
 	return nil
 }
 
+// recordValidatorSet stores the current validator set as the one voting
+// from height on, unless the stored set at that height is the same
+func (n *Node) recordValidatorSet(height uint64) {
+	set := n.consensus.ValidatorSetSnapshot(height)
+	if stored, err := n.db.GetValidatorSet(height); err == nil && stored.SameVoters(set) {
+		return
+	}
+	
+	if err := n.db.SaveValidatorSet(set); err != nil {
+		warnf("Failed to store validator set: %v", err)
+	}
+}
+
 func (n *Node) handleTransaction(data []byte) error {
 	var msg p2p.Message
 	if err := json.Unmarshal(data, &msg); err != nil {
@@ -219,55 +702,143 @@ func (n *Node) handleTransaction(data []byte) error {
 		return err
 	}
 	
+	return n.addToPool(&tx)
+}
+
+// addToPool validates a transaction and adds it to the pool. A
+// transaction already in the pool is ignored, since stem relay can
+// deliver it once directly and again through gossip. Refusals are
+// *types.RejectError.
+func (n *Node) addToPool(tx *types.Transaction) error {
 	// Validate transaction
-	if err := n.state.ValidateTransaction(&tx); err != nil {
-		return fmt.Errorf("invalid transaction: %w", err)
+	if err := n.state.ValidateTransaction(tx); err != nil {
+		return types.Reject(types.RejectCodeOf(err), fmt.Errorf("invalid transaction: %w", err))
 	}
 	
+	hash := tx.Hash()
+	
 	// Add to pool
-	n.txPool = append(n.txPool, &tx)
+	size := encodedSize(tx)
+	n.txPoolMu.Lock()
+	pooled, err := n.checkPoolAdmission(hash, size)
+	if pooled || err != nil {
+		n.txPoolMu.Unlock()
+		return err
+	}
+	n.indexTx(tx, hash, size)
+	n.txPoolMu.Unlock()
 	
-	log.Printf("Transaction added to pool: %s", tx.Hash())
+	n.publishTx(tx, hash)
+	infof("Transaction added to pool: %s", hash)
 	
 	return nil
 }
 
+// pooledTransaction returns a transaction from the pool, or nil
+func (n *Node) pooledTransaction(hash types.Hash) *types.Transaction {
+	n.txPoolMu.Lock()
+	defer n.txPoolMu.Unlock()
+	
+	if entry, ok := n.txIndex[hash]; ok {
+		return entry.tx
+	}
+	return nil
+}
+
+// submitTransaction adds a locally submitted transaction to the pool
+// and relays it to peers through the stem phase
+func (n *Node) submitTransaction(tx *types.Transaction) error {
+	if err := n.addToPool(tx); err != nil {
+		return err
+	}
+	
+	return n.network.RelayTransaction(tx)
+}
+
+// status reports this node's chain and protocol version to peers
+func (n *Node) status() p2p.Status {
+	height := n.state.GetHeight()
+	return p2p.Status{
+		ChainID:         n.chainID,
+		GenesisHash:     n.genesisHash.String(),
+		ProtocolVersion: types.ProtocolVersion,
+		ActiveVersion:   n.state.ProtocolVersionAt(height),
+		Height:          height,
+		Time:            time.Now().UnixMilli(),
+	}
+}
+
 func (n *Node) handleVote(data []byte) error {
 	var msg p2p.Message
 	if err := json.Unmarshal(data, &msg); err != nil {
 		return err
 	}
 	
-	var vote types.ValidatorSignature
-	if err := json.Unmarshal(msg.Data, &vote); err != nil {
-		return err
+	// Copies relayed by several peers are checked once
+	key, fresh := n.seenVotes.add(msg.Data)
+	if !fresh {
+		return nil
 	}
 	
-	// Get current block being voted on
-	latestBlock, err := n.db.GetLatestBlock()
-	if err != nil {
+	var vote types.Vote
+	if err := json.Unmarshal(msg.Data, &vote); err != nil {
 		return err
 	}
 	
-	blockHash := latestBlock.Header.Hash()
-	
-	// Collect vote
-	if err := n.consensus.CollectVote(&vote, blockHash); err != nil {
+	// Collect vote. Commit votes for anything but the proposal we hold,
+	// such as late votes for a finalized block, are only checked for
+	// double votes.
+	if err := n.consensus.CollectVote(&vote); err != nil {
+		if errors.Is(err, consensus.ErrNotProposal) {
+			debugf("Vote from %s at height %d round %d is not for our proposal", vote.Validator.String()[:8], vote.Height, vote.Round)
+			n.seenVotes.forget(key)
+			return nil
+		}
+		if errors.Is(err, consensus.ErrDuplicateVote) {
+			warnf("Validator %s voted twice at height %d round %d; the evidence is kept for the next block", vote.Validator.String()[:8], vote.Height, vote.Round)
+		}
 		return fmt.Errorf("failed to collect vote: %w", err)
 	}
 	
-	log.Printf("Vote received from %s", vote.Validator.String()[:8])
+	debugf("Vote received from %s", vote.Validator.String()[:8])
 	
-	return nil
+	// A prevote may complete the polka we commit on
+	if vote.Prevote {
+		return n.tryCommitVote()
+	}
+	return n.tryFinalize()
 }
 
+// produceBlocks tries to propose once per slot, at the slot boundaries
+// counted from genesis time, so validators act in step however their
+// clocks and start times differ. Slots missed while the process was
+// stopped or suspended are skipped rather than proposed late, and no
+// blocks are proposed while the node is catching up with its peers.
 func (n *Node) produceBlocks() {
-	ticker := time.NewTicker(2 * time.Second)
-	defer ticker.Stop()
+	last := n.slots.SlotAt(n.adjustedNow())
 	
-	for range ticker.C {
+	for {
+		now := n.adjustedNow()
+		time.Sleep(n.slots.NextSlotStart(now).Sub(now))
+		
+		slot := n.slots.SlotAt(n.adjustedNow())
+		if slot <= last {
+			continue // Clock stepped back
+		}
+		if missed := slot - last - 1; missed > 0 {
+			debugf("Skipped %d missed slots", missed)
+		}
+		last = slot
+		
+		// A proposal on a stale tip would only be rejected; sync first
+		height := n.state.GetHeight()
+		if best := n.bestKnownHeight(); best > height+SyncTolerance {
+			debugf("Not proposing in slot %d: %d blocks behind peers", slot, best-height)
+			continue
+		}
+		
 		if err := n.proposeBlock(); err != nil {
-			log.Printf("Failed to propose block: %v", err)
+			errorf("Failed to propose block: %v", err)
 		}
 	}
 }
@@ -276,8 +847,8 @@ func (n *Node) proposeBlock() error {
 	// Get current height
 	height := n.state.GetHeight()
 	
-	// Check if we're the proposer
-	proposer, err := n.consensus.SelectProposer(height+1, 0)
+	// Check if we're the proposer of the current round
+	proposer, err := n.consensus.SelectProposer(height+1, n.consensus.Round())
 	if err != nil {
 		return err
 	}
@@ -292,50 +863,234 @@ func (n *Node) proposeBlock() error {
 		return err
 	}
 	
-	// Create block with pending transactions
-	txs := n.txPool
-	n.txPool = make([]*types.Transaction, 0) // Clear pool
-	
-	block, err := n.consensus.ProposeBlock(txs, prevBlock)
-	if err != nil {
-		return err
+	// A proposal already made this round (possibly before a restart)
+	// is sent again, since a second block would conflict with it, and
+	// a block with a polka in an earlier round is proposed again
+	proposal := n.consensus.PendingProposal(height + 1)
+	if proposal == nil {
+		// Create block with pending transactions
+		txs, staking, ok := n.takeBlockTransactions(prevBlock)
+		if !ok {
+			return nil
+		}
+		
+		block, err := n.consensus.ProposeBlock(txs, staking, prevBlock)
+		if err != nil {
+			return err
+		}
+		proposal = &types.Proposal{Round: block.Header.Round, Block: block}
 	}
 	
-	log.Printf("Proposing block at height %d with %d transactions", block.Header.Height, len(txs))
+	block := proposal.Block
+	if proposal.IsRepeat() {
+		infof("Proposing block %s at height %d again in round %d (polka in round %d)",
+			block.Header.Hash().String()[:8], block.Header.Height, proposal.Round, proposal.POLRound)
+	} else {
+		infof("Proposing block at height %d with %d transactions", block.Header.Height, len(block.Transactions))
+	}
 	
-	// Vote for our own block
-	vote, err := n.consensus.VoteForBlock(block)
-	if err != nil {
+	// Broadcast the proposal for the other validators to vote on
+	if err := n.consensus.SetProposal(proposal); err != nil {
 		return err
 	}
-	
-	// Broadcast block
-	if err := n.network.BroadcastBlock(block); err != nil {
+	if err := n.network.BroadcastProposal(proposal); err != nil {
 		return err
 	}
+	n.noteProposal(block.Header.Height)
 	
-	// Broadcast our vote
-	if err := n.network.BroadcastVote(vote); err != nil {
-		return err
+	// Prevote for our own proposal. A validator with 2/3 of the stake
+	// commits and finalizes on its own votes.
+	return n.prevoteProposal()
+}
+
+// takeBlockTransactions takes the transactions and staking transactions
+// of the block after prevBlock from the pools. ok is false, and nothing
+// is taken, if the block would be empty and may be skipped.
+func (n *Node) takeBlockTransactions(prevBlock *types.Block) (txs []*types.Transaction, staking []*types.StakingTx, ok bool) {
+	n.txPoolMu.Lock()
+	defer n.txPoolMu.Unlock()
+	
+	txs = n.assembler.Assemble(n.payableTransactions(), consensus.AssemblyContext{
+		Height: prevBlock.Header.Height + 1,
+		Limits: n.config.BlockLimits,
+		Params: n.state,
+	})
+	txs, staking = n.stakingForBlock(txs)
+	if len(txs) == 0 && len(staking) == 0 && n.skipEmptyBlock(prevBlock) {
+		return nil, nil, false
+	}
+	n.takeFromPool(txs)
+	return txs, staking, true
+}
+
+// payableTransactions returns the pooled transactions paying at least
+// the next block's base fee. The rest stay pooled in case it falls
+// again. Callers hold txPoolMu.
+func (n *Node) payableTransactions() []*types.Transaction {
+	baseFee := n.state.BaseFee()
+	if baseFee == 0 {
+		return n.txPool
 	}
 	
-	return nil
+	payable := make([]*types.Transaction, 0, len(n.txPool))
+	for _, tx := range n.txPool {
+		if tx.Fee >= tx.MinFee(baseFee) {
+			payable = append(payable, tx)
+		}
+	}
+	return payable
 }
 
-func (n *Node) syncBlockchain() {
-	// TODO: Implement blockchain synchronization
-	// For Phase 1, we assume genesis start
-	log.Println("Blockchain sync started")
+// takeFromPool removes the transactions of a proposal from the pool,
+// along with any that spend the same key images. Callers hold txPoolMu.
+func (n *Node) takeFromPool(txs []*types.Transaction) {
+	taken := make(map[types.Hash]bool, len(txs))
+	spent := make(map[types.PublicKey]bool)
+	for _, tx := range txs {
+		taken[tx.Hash()] = true
+		for _, input := range tx.AllInputs() {
+			spent[input.KeyImage] = true
+		}
+	}
+	
+	remaining := make([]*types.Transaction, 0, len(n.txPool))
+	for _, tx := range n.txPool {
+		hash := tx.Hash()
+		if taken[hash] {
+			delete(n.txIndex, hash)
+			continue
+		}
+		conflict := false
+		for _, input := range tx.AllInputs() {
+			if spent[input.KeyImage] {
+				conflict = true
+				break
+			}
+		}
+		if conflict {
+			debugf("Dropping transaction %s: conflicts with the proposal", hash)
+			delete(n.txIndex, hash)
+			continue
+		}
+		remaining = append(remaining, tx)
+	}
+	n.txPool = remaining
+}
+
+// skipEmptyBlock reports whether an empty block may be left out because
+// the last one is younger than EmptyBlockInterval. Timestamps still
+// advance at least that often while the chain is idle.
+func (n *Node) skipEmptyBlock(prevBlock *types.Block) bool {
+	interval := n.config.EmptyBlockInterval
+	if interval <= 0 {
+		return false
+	}
+	
+	age := time.Since(time.Unix(prevBlock.Header.Timestamp, 0))
+	if age >= interval {
+		return false
+	}
+	
+	debugf("No transactions; skipping block %d for %s", prevBlock.Header.Height+1, (interval - age).Round(time.Second))
+	return true
 }
 
-func parseFlags() *Config {
-	dataDir := flag.String("datadir", "./data", "Data directory")
-	p2pPort := flag.Int("port", 9000, "P2P listen port")
-	bootstrap := flag.String("bootstrap", "", "Bootstrap peer addresses (comma-separated)")
-	validatorKey := flag.String("validator", "", "Path to validator key file")
-	genesisFile := flag.String("genesis", "genesis.json", "Genesis file path")
+// parseConfig parses the node's command line. Flags it does not give
+// are read from the -config file, if any, before the role's defaults
+// are applied.
+func parseConfig(args []string, errorHandling flag.ErrorHandling) (*Config, error) {
+	fs := flag.NewFlagSet("node", errorHandling)
+	if errorHandling == flag.ContinueOnError {
+		fs.SetOutput(io.Discard) // Errors are returned instead
+	}
+	configFile := fs.String("config", "", "JSON file of flag values (flag name to value) for flags not given on the command line; reloaded on SIGHUP and by the reloadConfig admin method")
+	dataDir := fs.String("datadir", "./data", "Data directory")
+	p2pPort := fs.Int("port", 9000, "P2P listen port")
+	bootstrap := fs.String("bootstrap", "", "Bootstrap peer addresses (comma-separated)")
+	validatorKey := fs.String("validator", "", "Path to validator key file")
+	genesisFile := fs.String("genesis", "genesis.json", "Genesis file path")
+	rpcAddr := fs.String("rpc", "127.0.0.1:9100", "RPC listen address (empty to disable)")
+	
+	dandelion := p2p.DefaultDandelionConfig()
+	fs.BoolVar(&dandelion.Enabled, "dandelion", dandelion.Enabled, "Relay own transactions through a Dandelion++ stem before gossip")
+	fs.DurationVar(&dandelion.EmbargoTimeout, "embargo", dandelion.EmbargoTimeout, "Time to wait for a stem transaction to appear in gossip before fluffing it")
+	fs.Float64Var(&dandelion.FluffProbability, "fluff-probability", dandelion.FluffProbability, "Chance a stem node fluffs instead of forwarding")
 	
-	flag.Parse()
+	gossip := p2p.DefaultGossipConfig()
+	fs.IntVar(&gossip.D, "gossip-d", gossip.D, "Target number of mesh peers per gossip topic")
+	fs.IntVar(&gossip.Dlo, "gossip-dlo", gossip.Dlo, "Mesh peers per topic below which more are grafted")
+	fs.IntVar(&gossip.Dhi, "gossip-dhi", gossip.Dhi, "Mesh peers per topic above which some are pruned")
+	fs.DurationVar(&gossip.HeartbeatInterval, "gossip-heartbeat", gossip.HeartbeatInterval, "GossipSub mesh maintenance interval")
+	fs.BoolVar(&gossip.PeerScoring, "peer-scoring", gossip.PeerScoring, "Score gossip peers and drop those below the thresholds")
+	fs.Float64Var(&gossip.GossipThreshold, "gossip-threshold", gossip.GossipThreshold, "Peer score below which gossip to and from a peer is ignored")
+	fs.Float64Var(&gossip.PublishThreshold, "publish-threshold", gossip.PublishThreshold, "Peer score below which own messages are not published to a peer")
+	fs.Float64Var(&gossip.GraylistThreshold, "graylist-threshold", gossip.GraylistThreshold, "Peer score below which all messages from a peer are dropped")
+	fs.Float64Var(&gossip.AcceptPXThreshold, "accept-px-threshold", gossip.AcceptPXThreshold, "Peer score needed to accept peer exchange when pruned")
+	
+	proxyAddr := fs.String("proxy", "", "SOCKS5 proxy for outbound P2P connections (e.g. 127.0.0.1:9050 for Tor)")
+	noAdvertise := fs.Bool("no-advertise", false, "Do not advertise listen addresses to peers (with -proxy)")
+	readyMinPeers := fs.Int("ready-min-peers", 1, "Peers required before /readyz reports ready")
+	minPeers := fs.Int("min-peers", p2p.MinPeers, "Connections below which the node asks its peers for more")
+	mempoolMaxTxs := fs.Int("mempool-max-txs", 0, "Most transactions kept in the pool; more are refused until blocks include some (0 for no limit)")
+	var rpcTLS rpc.TLSConfig
+	fs.StringVar(&rpcTLS.CertFile, "rpc-tls-cert", "", "TLS certificate file for the RPC server (serves HTTPS with -rpc-tls-key)")
+	fs.StringVar(&rpcTLS.KeyFile, "rpc-tls-key", "", "TLS private key file for the RPC server")
+	fs.StringVar(&rpcTLS.ClientCAFile, "rpc-client-ca", "", "CA file for RPC client certificates, accepted in place of the admin token")
+	rpcCORS := fs.String("rpc-cors", "", "Browser origins allowed to call the RPC server (comma-separated, * for any)")
+	rpcRestrictWrites := fs.Bool("rpc-restrict-writes", false, "Require the admin token or a client certificate for methods that submit transactions")
+	rpcAccess := fs.String("rpc-access", "", "Per-method access overrides as method=public|write|admin (comma-separated)")
+	rpcRateLimit := rpc.DefaultRateLimitConfig()
+	fs.BoolVar(&rpcRateLimit.Enabled, "rpc-rate-limit", rpcRateLimit.Enabled, "Limit RPC requests per client IP, answering 429 when exceeded")
+	fs.Float64Var(&rpcRateLimit.Rate, "rpc-rate", rpcRateLimit.Rate, "Steady RPC request cost per second allowed per IP")
+	fs.IntVar(&rpcRateLimit.Burst, "rpc-burst", rpcRateLimit.Burst, "RPC request cost an idle IP may spend at once")
+	fs.Float64Var(&rpcRateLimit.AuthRate, "rpc-auth-rate", rpcRateLimit.AuthRate, "Steady RPC request cost per second for authenticated clients (0 for unlimited)")
+	fs.IntVar(&rpcRateLimit.AuthBurst, "rpc-auth-burst", rpcRateLimit.AuthBurst, "RPC request cost an idle authenticated client may spend at once")
+	rpcCosts := fs.String("rpc-cost", "", "Per-method RPC cost overrides as method=cost (comma-separated)")
+	adminTokenFile := fs.String("admin-token-file", "", "Admin RPC token file (default <datadir>/admin.token, created if missing)")
+	controlSocket := fs.String("control-socket", "", "Unix socket for local control with 'node ctl' (default <datadir>/control.sock, none with -ephemeral; \"none\" to disable)")
+	controlTokenFile := fs.String("control-token-file", "", "Token signing control socket requests (default <datadir>/control.token, created if missing)")
+	identityPassFile := fs.String("identity-passphrase-file", "", "Passphrase file encrypting the P2P identity key, outside the data directory (default $APEX_IDENTITY_PASSPHRASE, or a prompt)")
+	newIdentity := fs.Bool("new-identity", false, "Replace the P2P identity key, giving this node a new peer ID")
+	logLevelName := fs.String("log-level", "info", "Log level: debug, info, warn or error")
+	rewardAddress := fs.String("reward-address", "", "Wallet address receiving block rewards when proposing")
+	rosettaAddr := fs.String("rosetta", "", "Rosetta API listen address (empty to disable)")
+	stateSync := fs.Bool("state-sync", false, "Download a verified state snapshot from peers instead of replaying old blocks")
+	ntpServer := fs.String("ntp-server", DefaultNTPServer, "NTP server for clock offset checks (empty to disable; not used with -proxy)")
+	seed := fs.Bool("seed", false, "Run a discovery-only seed node: handshake and peer exchange, no consensus, ledger or database")
+	blockLimits := consensus.DefaultBlockLimits()
+	fs.IntVar(&blockLimits.MaxTransactions, "block-max-txs", blockLimits.MaxTransactions, "Most transactions this node puts in a proposed block")
+	fs.IntVar(&blockLimits.MaxBytes, "block-max-bytes", blockLimits.MaxBytes, "Most transaction bytes this node puts in a proposed block")
+	timeouts := consensus.DefaultTimeoutConfig()
+	fs.DurationVar(&timeouts.Propose, "timeout-propose", timeouts.Propose, "Wait for a round 0 proposal before moving to the next round and proposer")
+	fs.DurationVar(&timeouts.ProposeDelta, "timeout-propose-delta", timeouts.ProposeDelta, "Added to the proposal wait for each further round")
+	fs.Float64Var(&timeouts.LatencyFactor, "timeout-latency-factor", timeouts.LatencyFactor, "Multiple of the observed p95 proposal propagation latency added to the proposal and vote waits")
+	fs.DurationVar(&timeouts.MaxPropose, "timeout-propose-max", timeouts.MaxPropose, "Longest proposal wait in any round")
+	fs.DurationVar(&timeouts.Commit, "timeout-commit", timeouts.Commit, "Wait for the votes on a round 0 proposal, from its arrival, before moving to the next round")
+	fs.DurationVar(&timeouts.CommitDelta, "timeout-commit-delta", timeouts.CommitDelta, "Added to the vote wait for each further round")
+	fs.DurationVar(&timeouts.MaxCommit, "timeout-commit-max", timeouts.MaxCommit, "Longest vote wait in any round")
+	blockAssembler := fs.String("block-assembler", consensus.DefaultAssembler, "Transaction selection policy for proposed blocks: greedy (highest fee per byte first) or fifo")
+	emptyBlockInterval := fs.Duration("empty-block-interval", 0, "Longest wait before proposing a block without transactions (0 proposes one every block time)")
+	scanService := wallet.DefaultScanServiceConfig()
+	scanServiceEnabled := fs.Bool("scan-service", false, "Scan the chain for light wallets that register their view keys over RPC (the node learns their incoming payments)")
+	fs.IntVar(&scanService.MaxWallets, "scan-service-max-wallets", scanService.MaxWallets, "Most light wallets registered with the scanning service at once")
+	fs.DurationVar(&scanService.TTL, "scan-service-ttl", scanService.TTL, "Time after which an unused scanning registration and its view key are forgotten")
+	zmqPub := fs.String("zmq-pub", "", "Bind a ZeroMQ PUB socket publishing block, tx and finalized events (e.g. tcp://127.0.0.1:28332)")
+	natsURL := fs.String("nats", "", "Publish block, tx and finalized events to a NATS server (e.g. nats://127.0.0.1:4222)")
+	natsSubject := fs.String("nats-subject", notify.DefaultNATSSubject, "Subject prefix of NATS events, published on <prefix>.<type>")
+	archive := fs.Bool("archive", false, "Run a non-validating archive node for RPC and sync serving: never proposes or votes, keeps full history (same as -role archive)")
+	role := fs.String("role", "", "Node profile setting defaults for the other flags: "+strings.Join(RoleNames(), ", ")+" (default validator with -validator, archive with -archive, else full)")
+	ephemeral := fs.Bool("ephemeral", false, "Run entirely in memory: the chain, P2P identity and admin token are never written to -datadir and are lost on exit")
+	crashDir := fs.String("crash-dir", "", "Write a report with the stack trace of every recovered panic to this directory (empty to only log them)")
+	dbEngine := fs.String("db-engine", storage.DefaultEngine, "Storage engine: "+strings.Join(storage.EngineNames(), " or ")+" (memory keeps the chain in RAM only)")
+	
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if *configFile != "" {
+		if err := applyConfigFile(fs, *configFile, setFlags(fs)); err != nil {
+			return nil, err
+		}
+	}
 	
 	bootstrapPeers := []string{}
 	if *bootstrap != "" {
@@ -344,38 +1099,138 @@ func parseFlags() *Config {
 		bootstrapPeers = []string{*bootstrap}
 	}
 	
-	return &Config{
+	var rpcCORSOrigins, rpcAccessEntries, rpcCostEntries []string
+	if *rpcCORS != "" {
+		rpcCORSOrigins = strings.Split(*rpcCORS, ",")
+	}
+	if *rpcAccess != "" {
+		rpcAccessEntries = strings.Split(*rpcAccess, ",")
+	}
+	if *rpcCosts != "" {
+		rpcCostEntries = strings.Split(*rpcCosts, ",")
+	}
+	
+	if *adminTokenFile == "" {
+		*adminTokenFile = *dataDir + "/admin.token"
+	}
+	if *controlTokenFile == "" {
+		*controlTokenFile = *dataDir + "/control.token"
+	}
+	switch *controlSocket {
+	case "":
+		if !*ephemeral {
+			*controlSocket = *dataDir + "/control.sock"
+		}
+	case "none":
+		*controlSocket = ""
+	}
+	
+	var proxy *p2p.ProxyConfig
+	if *proxyAddr != "" {
+		proxy = &p2p.ProxyConfig{
+			Addr:        *proxyAddr,
+			NoAdvertise: *noAdvertise,
+		}
+	}
+	
+	cfg := &Config{
+		ConfigFile:     *configFile,
 		DataDir:        *dataDir,
 		P2PPort:        *p2pPort,
 		BootstrapPeers: bootstrapPeers,
 		ValidatorKey:   *validatorKey,
 		GenesisFile:    *genesisFile,
+		RPCAddr:        *rpcAddr,
+		Dandelion:      dandelion,
+		Proxy:          proxy,
+		ReadyMinPeers:  *readyMinPeers,
+		MinPeers:       *minPeers,
+		MempoolMaxTxs:  *mempoolMaxTxs,
+		AdminTokenFile: *adminTokenFile,
+		LogLevel:       *logLevelName,
+		RewardAddress:  *rewardAddress,
+		RosettaAddr:    *rosettaAddr,
+		StateSync:      *stateSync,
+		Role:           *role,
+		Archive:        *archive,
+		DBEngine:       *dbEngine,
+		Seed:           *seed,
+		NTPServer:      *ntpServer,
+		Gossip:         gossip,
+		BlockAssembler: *blockAssembler,
+		BlockLimits:    blockLimits,
+		Timeouts:       timeouts,
+		
+		RPCTLS:            rpcTLS,
+		RPCCORSOrigins:    rpcCORSOrigins,
+		RPCRestrictWrites: *rpcRestrictWrites,
+		RPCAccess:         rpcAccessEntries,
+		RPCRateLimit:      rpcRateLimit,
+		RPCCosts:          rpcCostEntries,
+		
+		EmptyBlockInterval: *emptyBlockInterval,
+		
+		ScanServiceEnabled: *scanServiceEnabled,
+		ScanService:        scanService,
+		
+		ZMQPub:      *zmqPub,
+		NATSURL:     *natsURL,
+		NATSSubject: *natsSubject,
+		
+		IdentityPassphraseFile: *identityPassFile,
+		NewIdentity:            *newIdentity,
+		
+		Ephemeral: *ephemeral,
+		CrashDir:  *crashDir,
+		
+		ControlSocket:    *controlSocket,
+		ControlTokenFile: *controlTokenFile,
+		
+		flagValues: flagValues(fs),
 	}
+	if err := configureRole(cfg, setFlags(fs)); err != nil {
+		return nil, err
+	}
+	return cfg, nil
 }
 
-func loadGenesis(db *storage.Database, genesisFile string) (*types.GenesisConfig, error) {
-	// Try to load from database first
+// loadGenesis returns the chain's genesis and its canonical hash
+func loadGenesis(db *storage.Database, genesisFile string) (*types.GenesisConfig, types.Hash, error) {
+	// Try to load from database first. The database is pinned to its
+	// genesis, so a genesis file of another network is refused.
 	genesis, err := db.GetGenesis()
 	if err == nil {
-		return genesis, nil
+		hash, err := pinnedGenesisHash(db, genesis)
+		if err != nil {
+			return nil, types.Hash{}, err
+		}
+		return genesis, hash, checkGenesisFile(hash, genesisFile)
 	}
 	
-	// Load from file
+	// Load from file, refusing one that is malformed
 	data, err := os.ReadFile(genesisFile)
 	if err != nil {
-		return nil, err
+		return nil, types.Hash{}, err
 	}
 	
-	if err := json.Unmarshal(data, &genesis); err != nil {
-		return nil, err
+	genesis, err = types.ParseGenesis(data)
+	if err != nil {
+		return nil, types.Hash{}, err
+	}
+	hash, err := genesis.Hash()
+	if err != nil {
+		return nil, types.Hash{}, err
 	}
 	
 	// Save to database
 	if err := db.SaveGenesis(genesis); err != nil {
-		return nil, err
+		return nil, types.Hash{}, err
+	}
+	if err := db.SaveGenesisHash(hash); err != nil {
+		return nil, types.Hash{}, err
 	}
 	
-	return genesis, nil
+	return genesis, hash, nil
 }
 
 func loadValidatorKey(path string) (*crypto.KeyPair, error) {
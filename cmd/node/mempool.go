@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"blockchain/p2p"
+	"blockchain/rpc"
+	"blockchain/types"
+)
+
+// MaxTxSize bounds the encoded size of a pooled transaction, so that it
+// fits a stem or gossip message with room for the envelope
+const MaxTxSize = p2p.MaxStemMessageSize - 1024
+
+// errPoolFull is returned while the pool holds -mempool-max-txs
+// transactions
+var errPoolFull = types.Reject(types.RejectPoolFull, errors.New("transaction pool is full"))
+
+// poolEntry is the index record of a pooled transaction
+type poolEntry struct {
+	tx    *types.Transaction
+	size  int // Encoded size, as gossiped and stored
+	added time.Time
+}
+
+// feeRate returns the fee paid per encoded byte
+func (e *poolEntry) feeRate() float64 {
+	if e.size == 0 {
+		return 0
+	}
+	return float64(e.tx.Fee) / float64(e.size)
+}
+
+// encodedSize returns the encoded size of a transaction as gossiped and
+// stored
+func encodedSize(tx *types.Transaction) int {
+	data, err := json.Marshal(tx)
+	if err != nil {
+		return 0
+	}
+	return len(data)
+}
+
+// checkPoolAdmission reports whether a transaction of size bytes is
+// already pooled, or returns an error when there is no room for it.
+// Callers hold txPoolMu.
+func (n *Node) checkPoolAdmission(hash types.Hash, size int) (bool, error) {
+	if _, ok := n.txIndex[hash]; ok {
+		return true, nil
+	}
+	if size > MaxTxSize {
+		return false, types.Reject(types.RejectTooLarge, fmt.Errorf("transaction of %d bytes exceeds %d", size, MaxTxSize))
+	}
+	if limit := n.poolLimit.Load(); limit > 0 && int64(len(n.txPool)) >= limit {
+		return false, errPoolFull
+	}
+	return false, nil
+}
+
+// indexTx appends a transaction to the pool and its index. Callers hold
+// txPoolMu.
+func (n *Node) indexTx(tx *types.Transaction, hash types.Hash, size int) {
+	n.txPool = append(n.txPool, tx)
+	n.txIndex[hash] = &poolEntry{tx: tx, size: size, added: time.Now()}
+}
+
+// rejectError returns a transaction rejection as an RPC error carrying
+// its reject code. Other errors are returned unchanged.
+func rejectError(err error) error {
+	var rejectErr *types.RejectError
+	if !errors.As(err, &rejectErr) {
+		return err
+	}
+	data, _ := json.Marshal(map[string]types.RejectCode{"reject_code": rejectErr.Code})
+	return &rpc.Error{Code: rpc.CodeTxRejected, Message: err.Error(), Data: data}
+}
+
+// mempoolTxEntry describes one pooled transaction
+type mempoolTxEntry struct {
+	Hash    string  `json:"hash"`
+	Fee     uint64  `json:"fee"`
+	Size    int     `json:"size"`
+	FeeRate float64 `json:"fee_rate"` // Fee per encoded byte
+	Payable bool    `json:"payable"`  // Pays the next block's base fee
+	Time    int64   `json:"time"`     // Unix time it entered the pool
+}
+
+// describe returns the mempoolTxEntry of an index record under baseFee
+func (e *poolEntry) describe(hash types.Hash, baseFee uint64) mempoolTxEntry {
+	return mempoolTxEntry{
+		Hash:    hash.String(),
+		Fee:     e.tx.Fee,
+		Size:    e.size,
+		FeeRate: e.feeRate(),
+		Payable: e.tx.Fee >= e.tx.MinFee(baseFee),
+		Time:    e.added.Unix(),
+	}
+}
+
+func (n *Node) rpcGetMempoolTx(params json.RawMessage) (interface{}, error) {
+	var req struct {
+		Hash string `json:"hash"`
+	}
+	if err := rpc.DecodeParams(params, &req); err != nil {
+		return nil, err
+	}
+
+	hash, err := types.HashFromString(req.Hash)
+	if err != nil {
+		return nil, rpc.InvalidParams(err)
+	}
+
+	baseFee := n.state.BaseFee()
+
+	n.txPoolMu.Lock()
+	defer n.txPoolMu.Unlock()
+
+	entry, ok := n.txIndex[hash]
+	if !ok {
+		return nil, errors.New("transaction not in mempool")
+	}
+	return struct {
+		mempoolTxEntry
+		Tx *types.Transaction `json:"tx"`
+	}{entry.describe(hash, baseFee), entry.tx}, nil
+}
+
+// rpcGetMempoolHashes lists the pooled transactions with their fee
+// rates, highest first, the order the greedy assembler picks them in
+func (n *Node) rpcGetMempoolHashes(params json.RawMessage) (interface{}, error) {
+	baseFee := n.state.BaseFee()
+
+	n.txPoolMu.Lock()
+	entries := make([]mempoolTxEntry, 0, len(n.txPool))
+	for _, tx := range n.txPool {
+		hash := tx.Hash()
+		entries = append(entries, n.txIndex[hash].describe(hash, baseFee))
+	}
+	n.txPoolMu.Unlock()
+
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].FeeRate > entries[j].FeeRate })
+	return entries, nil
+}
+
+// mempoolAcceptResult is the outcome of one transaction of
+// testMempoolAccept
+type mempoolAcceptResult struct {
+	Hash         string           `json:"hash,omitempty"`
+	Allowed      bool             `json:"allowed"`
+	RejectCode   types.RejectCode `json:"reject_code,omitempty"`
+	RejectReason string           `json:"reject_reason,omitempty"`
+	Fee          uint64           `json:"fee,omitempty"`
+	Size         int              `json:"size,omitempty"`
+	FeeRate      float64          `json:"fee_rate,omitempty"`
+	Payable      bool             `json:"payable,omitempty"` // Pays the next block's base fee
+}
+
+// reject records why a transaction would be refused
+func (r *mempoolAcceptResult) reject(err error) {
+	r.RejectCode = types.RejectCodeOf(err)
+	r.RejectReason = err.Error()
+}
+
+// rpcTestMempoolAccept runs the pool's admission checks on a batch of
+// transactions without adding or relaying them, so exchanges can check
+// a withdrawal before broadcasting it. Each transaction is checked
+// against the current state and pool on its own; two that spend the same
+// key image may both be allowed.
+func (n *Node) rpcTestMempoolAccept(params json.RawMessage) (interface{}, error) {
+	var req struct {
+		Txs []*types.Transaction `json:"txs"`
+	}
+	if err := rpc.DecodeParams(params, &req); err != nil {
+		return nil, err
+	}
+	if len(req.Txs) == 0 {
+		return nil, rpc.InvalidParams(errors.New("missing txs"))
+	}
+	if len(req.Txs) > maxTxBatch {
+		return nil, rpc.InvalidParams(fmt.Errorf("at most %d txs per batch", maxTxBatch))
+	}
+
+	baseFee := n.state.BaseFee()
+	results := make([]mempoolAcceptResult, len(req.Txs))
+	for i, tx := range req.Txs {
+		if tx == nil {
+			results[i].reject(errors.New("missing tx"))
+			continue
+		}
+		hash := tx.Hash()
+		results[i].Hash = hash.String()
+
+		if err := n.state.ValidateTransaction(tx); err != nil {
+			results[i].reject(fmt.Errorf("invalid transaction: %w", err))
+			continue
+		}
+
+		entry := poolEntry{tx: tx, size: encodedSize(tx)}
+		n.txPoolMu.Lock()
+		pooled, err := n.checkPoolAdmission(hash, entry.size)
+		n.txPoolMu.Unlock()
+		switch {
+		case pooled:
+			results[i].reject(types.Reject(types.RejectDuplicate, errors.New("transaction already in mempool")))
+			continue
+		case err != nil:
+			results[i].reject(err)
+			continue
+		}
+
+		results[i].Allowed = true
+		results[i].Fee = tx.Fee
+		results[i].Size = entry.size
+		results[i].FeeRate = entry.feeRate()
+		results[i].Payable = tx.Fee >= tx.MinFee(baseFee)
+	}
+
+	return results, nil
+}
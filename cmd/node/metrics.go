@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"blockchain/p2p"
+)
+
+// registerMetricsEndpoint exposes node counters in the Prometheus text
+// format on the RPC listener
+func (n *Node) registerMetricsEndpoint() {
+	n.rpc.HandleHTTP("/metrics", n.handleMetrics)
+}
+
+// handleMetrics writes P2P traffic, gossip propagation and RPC
+// throttling counters, and ring signature cache hits.
+// Per-peer series cover connected peers only, bounding the number of
+// series to MaxPeers.
+func (n *Node) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	bw := n.network.Bandwidth()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	writeMetricHeader(w, "apex_p2p_peers", "gauge", "Connected peers")
+	writeMetric(w, "apex_p2p_peers", float64(n.network.GetConnectedPeerCount()))
+
+	writeMetricHeader(w, "apex_p2p_bytes_total", "counter", "P2P bytes received and sent")
+	writeMetric(w, "apex_p2p_bytes_total", float64(bw.Total.BytesIn), "direction", "in")
+	writeMetric(w, "apex_p2p_bytes_total", float64(bw.Total.BytesOut), "direction", "out")
+
+	writeMetricHeader(w, "apex_p2p_bytes_per_second", "gauge", "Recent P2P bandwidth")
+	writeMetric(w, "apex_p2p_bytes_per_second", bw.Total.RateIn, "direction", "in")
+	writeMetric(w, "apex_p2p_bytes_per_second", bw.Total.RateOut, "direction", "out")
+
+	writeMetricHeader(w, "apex_p2p_protocol_bytes_total", "counter", "P2P bytes by stream protocol")
+	for _, proto := range bw.Protocols {
+		writeMetric(w, "apex_p2p_protocol_bytes_total", float64(proto.BytesIn), "protocol", proto.Protocol, "direction", "in")
+		writeMetric(w, "apex_p2p_protocol_bytes_total", float64(proto.BytesOut), "protocol", proto.Protocol, "direction", "out")
+	}
+
+	writeMetricHeader(w, "apex_p2p_peer_bytes_total", "counter", "P2P bytes by connected peer")
+	for _, p := range bw.Peers {
+		if !p.Connected {
+			continue
+		}
+		writeMetric(w, "apex_p2p_peer_bytes_total", float64(p.BytesIn), "peer", p.ID, "direction", "in")
+		writeMetric(w, "apex_p2p_peer_bytes_total", float64(p.BytesOut), "peer", p.ID, "direction", "out")
+	}
+
+	writePropagationMetrics(w, n.network.Propagation())
+
+	writeMetricHeader(w, "apex_gossip_duplicates_total", "counter", "Gossiped blocks and votes dropped as copies of ones already handled")
+	writeMetric(w, "apex_gossip_duplicates_total", float64(n.seenBlocks.duplicateCount()), "kind", "block")
+	writeMetric(w, "apex_gossip_duplicates_total", float64(n.seenVotes.duplicateCount()), "kind", "vote")
+
+	writeMetricHeader(w, "apex_stem_rejects_total", "counter", "Transactions refused by stem peers, by reject code")
+	for _, r := range n.network.StemRejects() {
+		writeMetric(w, "apex_stem_rejects_total", float64(r.Count), "code", string(r.Code))
+	}
+
+	hits, misses := n.state.SigCacheStats()
+	writeMetricHeader(w, "apex_ledger_sig_cache_total", "counter", "Ring signature checks answered by the cache or verified")
+	writeMetric(w, "apex_ledger_sig_cache_total", float64(hits), "result", "hit")
+	writeMetric(w, "apex_ledger_sig_cache_total", float64(misses), "result", "miss")
+
+	writeMetricHeader(w, "apex_rpc_throttled_total", "counter", "RPC calls rejected by rate limiting")
+	for _, t := range n.rpc.Throttled() {
+		writeMetric(w, "apex_rpc_throttled_total", float64(t.Count), "method", t.Method)
+	}
+
+	writeMetricHeader(w, "apex_panics_total", "counter", "Panics recovered without stopping the node")
+	for _, p := range n.panicCounts() {
+		writeMetric(w, "apex_panics_total", float64(p.Count), "task", p.Task)
+	}
+}
+
+// writePropagationMetrics writes the gossip latency histogram, recent
+// percentiles and direct/relayed message counts per topic
+func writePropagationMetrics(w io.Writer, stats []p2p.PropagationStats) {
+	writeMetricHeader(w, "apex_gossip_propagation_seconds", "histogram", "Time from publication to receipt of gossip messages")
+	for _, s := range stats {
+		for i, bound := range p2p.PropagationBuckets {
+			writeMetric(w, "apex_gossip_propagation_seconds_bucket", float64(s.Buckets[i]),
+				"topic", s.Topic, "le", strconv.FormatFloat(bound, 'g', -1, 64))
+		}
+		writeMetric(w, "apex_gossip_propagation_seconds_bucket", float64(s.Count), "topic", s.Topic, "le", "+Inf")
+		writeMetric(w, "apex_gossip_propagation_seconds_sum", s.Sum, "topic", s.Topic)
+		writeMetric(w, "apex_gossip_propagation_seconds_count", float64(s.Count), "topic", s.Topic)
+	}
+
+	writeMetricHeader(w, "apex_gossip_propagation_recent_seconds", "gauge", "Propagation latency percentiles over recent messages")
+	for _, s := range stats {
+		writeMetric(w, "apex_gossip_propagation_recent_seconds", s.P50, "topic", s.Topic, "quantile", "0.5")
+		writeMetric(w, "apex_gossip_propagation_recent_seconds", s.P95, "topic", s.Topic, "quantile", "0.95")
+	}
+
+	writeMetricHeader(w, "apex_gossip_messages_total", "counter", "Gossip messages received straight from the publisher or through relays")
+	for _, s := range stats {
+		writeMetric(w, "apex_gossip_messages_total", float64(s.Direct), "topic", s.Topic, "source", "direct")
+		writeMetric(w, "apex_gossip_messages_total", float64(s.Relayed), "topic", s.Topic, "source", "relayed")
+	}
+}
+
+// metricLabel escapes a label value
+var metricLabel = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func writeMetricHeader(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// writeMetric writes one sample; labels are name/value pairs
+func writeMetric(w io.Writer, name string, value float64, labels ...string) {
+	if len(labels) > 0 {
+		pairs := make([]string, 0, len(labels)/2)
+		for i := 0; i+1 < len(labels); i += 2 {
+			pairs = append(pairs, fmt.Sprintf(`%s="%s"`, labels[i], metricLabel.Replace(labels[i+1])))
+		}
+		name += "{" + strings.Join(pairs, ",") + "}"
+	}
+	fmt.Fprintf(w, "%s %g\n", name, value)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+// Exit codes of the offline commands, so scripts can tell a failed
+// command from a mistyped one
+const (
+	exitFailure = 1 // The command failed (log.Fatalf)
+	exitUsage   = 2 // Bad arguments, as for flag parsing errors
+)
+
+var (
+	jsonOutput  bool
+	quietOutput bool
+
+	// resultOut receives -json results and data written to "-"; stdout
+	// may be redirected for human-readable messages
+	resultOut io.Writer = os.Stdout
+)
+
+// addOutputFlags adds -json and -quiet to a command's flags
+func addOutputFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&jsonOutput, "json", false, "Print the result as JSON on stdout (messages go to stderr)")
+	fs.BoolVar(&quietOutput, "quiet", false, "Print nothing but errors (and the JSON result with -json)")
+}
+
+// setupOutput applies -json and -quiet once flags are parsed. Messages
+// for people go to os.Stdout, so it is pointed at stderr or discarded,
+// leaving the real stdout to the result alone.
+func setupOutput() {
+	switch {
+	case quietOutput:
+		devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+		if err == nil {
+			os.Stdout = devNull
+		}
+	case jsonOutput:
+		os.Stdout = os.Stderr
+	}
+
+	if jsonOutput {
+		log.SetFlags(0)
+		log.SetOutput(jsonErrorWriter{os.Stderr})
+	}
+}
+
+// printResult prints the result of a command with -json
+func printResult(v interface{}) {
+	if !jsonOutput {
+		return
+	}
+	enc := json.NewEncoder(resultOut)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	enc.Encode(v)
+}
+
+// usageFatal prints a usage message and exits
+func usageFatal(usage string) {
+	log.Print(usage)
+	os.Exit(exitUsage)
+}
+
+// jsonErrorWriter writes log messages, such as those of log.Fatalf, as
+// {"error": message}
+type jsonErrorWriter struct {
+	w io.Writer
+}
+
+func (j jsonErrorWriter) Write(p []byte) (int, error) {
+	enc := json.NewEncoder(j.w)
+	enc.SetEscapeHTML(false) // Usage messages are full of <args>
+	if err := enc.Encode(map[string]string{"error": strings.TrimRight(string(p), "\n")}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"blockchain/consensus"
+	"blockchain/p2p"
+	"blockchain/types"
+)
+
+// handleProposal receives a candidate block from the proposal topic
+func (n *Node) handleProposal(data []byte) error {
+	var msg p2p.Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return err
+	}
+
+	var proposal types.Proposal
+	if err := json.Unmarshal(msg.Data, &proposal); err != nil {
+		return err
+	}
+	if proposal.Block == nil {
+		return errors.New("proposal without a block")
+	}
+	block := proposal.Block
+
+	debugf("Received proposal at height %d round %d", block.Header.Height, proposal.Round)
+
+	// Proposals for other heights cannot be validated against our tip
+	if block.Header.Height != n.state.GetHeight()+1 {
+		return nil
+	}
+
+	return n.acceptProposal(&proposal)
+}
+
+// acceptProposal validates a candidate block for the next height and,
+// on a validator, prevotes for it (see consensus/locking.go). The block
+// is applied once the round's proposer has commit votes from 2/3 of the
+// stake and broadcasts it (see tryFinalize).
+func (n *Node) acceptProposal(proposal *types.Proposal) error {
+	block := proposal.Block
+
+	// Once a round has timed out its proposal is not voted on, since
+	// other validators may be voting on the next round's
+	if proposal.Round < n.consensus.Round() {
+		debugf("Ignoring proposal at height %d from past round %d", block.Header.Height, proposal.Round)
+		return nil
+	}
+	if held := n.consensus.Proposal(block.Header.Height); held != nil && held.Round == proposal.Round {
+		return n.consensus.SetProposal(proposal) // Already voted, or conflicting
+	}
+
+	// A block is proposed again only in a round after its polka, which
+	// is no earlier than the round it was made for
+	if proposal.Round < block.Header.Round || (proposal.IsRepeat() && (proposal.POLRound < block.Header.Round || proposal.POLRound >= proposal.Round)) {
+		return fmt.Errorf("proposal at height %d round %d has block of round %d with polka in round %d",
+			block.Header.Height, proposal.Round, block.Header.Round, proposal.POLRound)
+	}
+
+	if err := n.validateProposal(block); err != nil {
+		return fmt.Errorf("invalid proposal at height %d: %w", block.Header.Height, err)
+	}
+
+	if err := n.consensus.SetProposal(proposal); err != nil {
+		return err
+	}
+
+	if n.isValidator {
+		return n.prevoteProposal()
+	}
+	return nil
+}
+
+// prevoteProposal prevotes for the proposal held, unless locked on
+// another block, and broadcasts the vote
+func (n *Node) prevoteProposal() error {
+	vote, err := n.consensus.Prevote()
+	if errors.Is(err, consensus.ErrLocked) {
+		debugf("Not prevoting: %v", err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := n.castVote(vote); err != nil {
+		return err
+	}
+	return n.tryCommitVote()
+}
+
+// tryCommitVote casts our commit vote for the proposal held once its
+// prevotes carry 2/3 of the stake, locking on it
+func (n *Node) tryCommitVote() error {
+	if !n.isValidator {
+		return nil
+	}
+	vote, err := n.consensus.CommitVote()
+	if errors.Is(err, consensus.ErrNoPolka) || errors.Is(err, consensus.ErrNotProposal) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if vote != nil {
+		if err := n.castVote(vote); err != nil {
+			return err
+		}
+	}
+	return n.tryFinalize()
+}
+
+// castVote counts one of our own votes and broadcasts it
+func (n *Node) castVote(vote *types.Vote) error {
+	if err := n.consensus.CollectVote(vote); err != nil {
+		return err
+	}
+	return n.network.BroadcastVote(vote)
+}
+
+// validateProposal checks a candidate block against the block before
+// it. blockMu keeps a block being applied from changing the tip under it.
+func (n *Node) validateProposal(block *types.Block) error {
+	n.blockMu.Lock()
+	defer n.blockMu.Unlock()
+
+	prevBlock, err := n.db.GetBlock(block.Header.Height - 1)
+	if err != nil {
+		return err
+	}
+	return n.consensus.ValidateProposal(block, prevBlock)
+}
+
+// tryFinalize applies the proposal of our round for the next height
+// once it has commit votes from 2/3 of the stake, and broadcasts it with
+// its certificate on the block topic. Only the round's proposer
+// finalizes: the certificate feeds liveness tracking, so every node must
+// apply the same one.
+func (n *Node) tryFinalize() error {
+	height := n.state.GetHeight() + 1
+	proposal := n.consensus.Proposal(height)
+	if proposal == nil || !n.isValidator {
+		return nil
+	}
+	if proposer, err := n.consensus.SelectProposer(height, proposal.Round); err != nil || proposer != n.validatorPub {
+		return nil
+	}
+	if !n.consensus.HasQuorum() {
+		return nil
+	}
+
+	block := *proposal.Block
+	if err := n.consensus.FinalizeBlock(&block); err != nil {
+		return err
+	}
+	if err := n.applyBlock(&block); err != nil {
+		return err
+	}
+
+	return n.network.BroadcastBlock(&block)
+}
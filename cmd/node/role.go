@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Node roles, set with -role
+const (
+	RoleValidator = "validator" // Proposes and votes; RPC writes need the admin token
+	RoleFull      = "full"      // Validates and serves the chain
+	RoleArchive   = "archive"   // Keeps full history for RPC and sync, never validates
+	RoleLight     = "light"     // Starts from a state snapshot instead of replaying blocks
+)
+
+// role is the profile of one -role: defaults for the flags left unset,
+// and the flags it cannot be combined with
+type role struct {
+	defaults func(cfg *Config, set map[string]bool)
+	check    func(cfg *Config) error
+}
+
+// roles are the profiles -role can select
+var roles = map[string]role{
+	RoleValidator: {
+		defaults: func(cfg *Config, set map[string]bool) {
+			if !set["rpc-restrict-writes"] {
+				cfg.RPCRestrictWrites = true
+			}
+		},
+		check: func(cfg *Config) error {
+			if cfg.ValidatorKey == "" {
+				return fmt.Errorf("the %s role needs -validator", RoleValidator)
+			}
+			return conflicting(cfg, RoleValidator, "archive", "scan-service", "rosetta")
+		},
+	},
+	RoleFull: {
+		check: func(cfg *Config) error {
+			return conflicting(cfg, RoleFull, "validator", "archive")
+		},
+	},
+	RoleArchive: {
+		defaults: func(cfg *Config, set map[string]bool) {
+			cfg.Archive = true
+			if !set["rpc-rate-limit"] {
+				cfg.RPCRateLimit.Enabled = true
+			}
+		},
+		check: func(cfg *Config) error {
+			return conflicting(cfg, RoleArchive, "validator", "state-sync")
+		},
+	},
+	RoleLight: {
+		defaults: func(cfg *Config, set map[string]bool) {
+			if !set["state-sync"] {
+				cfg.StateSync = true
+			}
+		},
+		check: func(cfg *Config) error {
+			return conflicting(cfg, RoleLight, "validator", "archive", "scan-service", "rosetta")
+		},
+	},
+}
+
+// RoleNames returns the names of the node roles, sorted
+func RoleNames() []string {
+	names := make([]string, 0, len(roles))
+	for name := range roles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// configureRole applies the defaults of cfg.Role to the flags missing
+// from set, the flags given, then rejects options the role cannot be
+// combined with. Without -role, a node is a validator with -validator,
+// an archive node with -archive and a full node otherwise.
+func configureRole(cfg *Config, set map[string]bool) error {
+	if cfg.Seed {
+		if cfg.Role != "" {
+			return fmt.Errorf("seed nodes take no -role")
+		}
+		return nil
+	}
+
+	if cfg.Role == "" {
+		switch {
+		case cfg.Archive:
+			cfg.Role = RoleArchive
+		case cfg.ValidatorKey != "":
+			cfg.Role = RoleValidator
+		default:
+			cfg.Role = RoleFull
+		}
+	}
+	r, ok := roles[cfg.Role]
+	if !ok {
+		return fmt.Errorf("unknown role %q (available: %s)", cfg.Role, strings.Join(RoleNames(), ", "))
+	}
+
+	if r.defaults != nil {
+		r.defaults(cfg, set)
+	}
+	return r.check(cfg)
+}
+
+// conflicting fails if any of the named options is enabled in cfg
+func conflicting(cfg *Config, roleName string, options ...string) error {
+	enabled := map[string]bool{
+		"validator":    cfg.ValidatorKey != "",
+		"archive":      cfg.Archive,
+		"state-sync":   cfg.StateSync,
+		"scan-service": cfg.ScanServiceEnabled,
+		"rosetta":      cfg.RosettaAddr != "",
+	}
+	for _, option := range options {
+		if enabled[option] {
+			return fmt.Errorf("-%s cannot be used with the %s role", option, roleName)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"blockchain/rosetta"
+	"blockchain/storage"
+	"blockchain/types"
+)
+
+// rosettaBackend serves chain data from the database and pool and
+// relay access from the node
+type rosettaBackend struct {
+	*storage.Database
+	node *Node
+}
+
+func (b *rosettaBackend) MempoolTransactions() []*types.Transaction {
+	b.node.txPoolMu.Lock()
+	defer b.node.txPoolMu.Unlock()
+	
+	txs := make([]*types.Transaction, len(b.node.txPool))
+	copy(txs, b.node.txPool)
+	return txs
+}
+
+func (b *rosettaBackend) SubmitTransaction(tx *types.Transaction) error {
+	return b.node.submitTransaction(tx)
+}
+
+// GetBaseFee implements wallet.BaseFeeReader, so suggested fees cover
+// the base fee
+func (b *rosettaBackend) GetBaseFee() (uint64, error) {
+	return b.node.state.BaseFee(), nil
+}
+
+// GetDustLimit implements wallet.DustLimitReader, so change too small
+// to keep goes to the fee
+func (b *rosettaBackend) GetDustLimit() (uint64, error) {
+	return b.node.state.DustLimit(), nil
+}
+
+// GetRingPolicy implements wallet.RingPolicyReader, so rings follow the
+// network's ring size
+func (b *rosettaBackend) GetRingPolicy() (types.RingPolicy, error) {
+	return b.node.state.RingPolicy(), nil
+}
+
+// GetMaturity implements wallet.MaturityReader, so wallets neither
+// spend nor pick as decoys outputs the next block would reject
+func (b *rosettaBackend) GetMaturity() (types.MaturityConfig, error) {
+	return b.node.state.Maturity(), nil
+}
+
+// GetNextProtocolVersion implements wallet.ProtocolReader, so wallets
+// tag outputs once the next block accepts view tags
+func (b *rosettaBackend) GetNextProtocolVersion() (uint32, error) {
+	return b.node.state.ProtocolVersionAt(b.node.state.GetHeight() + 1), nil
+}
+
+// GetRingMemberIndexes implements wallet.RingMemberReader from the
+// ledger's index rather than a walk of the database
+func (b *rosettaBackend) GetRingMemberIndexes(keys []types.PublicKey) ([]uint64, error) {
+	return b.node.state.RingMemberIndexes(keys)
+}
+
+func (b *rosettaBackend) PeerIDs() []string {
+	peers := b.node.network.ListPeers()
+	ids := make([]string, len(peers))
+	for i, peer := range peers {
+		ids[i] = peer.ID
+	}
+	return ids
+}
+
+// newRosettaServer creates the Rosetta API server for the node
+func (n *Node) newRosettaServer(addr string) *rosetta.Server {
+	return rosetta.NewServer(addr, &rosettaBackend{Database: n.db, node: n})
+}
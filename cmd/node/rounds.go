@@ -0,0 +1,100 @@
+package main
+
+import (
+	"time"
+
+	"blockchain/p2p"
+)
+
+// roundCheckInterval is how often a validator checks whether the
+// proposal of the current round is overdue
+const roundCheckInterval = 250 * time.Millisecond
+
+// watchRounds moves the height being decided to the next round, and so
+// to the next proposer, when no proposal arrives within the round's
+// propose timeout, or when the proposal held does not gather its votes
+// within the commit timeout from its arrival (see
+// consensus.TimeoutConfig). Validators locked on a block carry the lock
+// into the next round (see consensus/locking.go). Rounds are timed on
+// the monotonic clock.
+func (n *Node) watchRounds() {
+	ticker := time.NewTicker(roundCheckInterval)
+	defer ticker.Stop()
+
+	var (
+		height     uint64
+		round      uint32
+		roundStart time.Time
+		proposed   bool // The proposal arrived; roundStart is when
+	)
+	for range ticker.C {
+		next, current := n.state.GetHeight()+1, n.consensus.Round()
+		if next != height || current != round || n.waitingForTransactions() {
+			height, round, roundStart, proposed = next, current, time.Now(), false
+			continue
+		}
+
+		// Blocks are not proposed or voted on while catching up
+		if n.bestKnownHeight() > height-1+SyncTolerance {
+			roundStart = time.Now()
+			continue
+		}
+		if !proposed && n.consensus.Proposal(height) != nil {
+			roundStart, proposed = time.Now(), true
+			continue
+		}
+
+		latency := n.proposalLatency()
+		timeout, missing := n.consensus.ProposeTimeout(latency), "proposal"
+		if proposed {
+			timeout, missing = n.consensus.CommitTimeout(latency), "commit"
+		}
+		if time.Since(roundStart) < timeout {
+			continue
+		}
+
+		advanced, err := n.consensus.AdvanceRound(height)
+		if err != nil {
+			warnf("Failed to change round: %v", err)
+			continue
+		}
+		proposer, _ := n.consensus.SelectProposer(height, advanced)
+		infof("No %s for height %d in round %d after %s (p95 latency %s); round %d proposer is %s",
+			missing, height, round, timeout.Round(time.Millisecond), latency.Round(time.Millisecond), advanced, proposer.String()[:8])
+		round, roundStart, proposed = advanced, time.Now(), false
+	}
+}
+
+// proposalLatency returns the recent p95 propagation latency of
+// proposals, or 0 before any were received
+func (n *Node) proposalLatency() time.Duration {
+	for _, stats := range n.network.Propagation() {
+		if stats.Topic == p2p.ProposalTopic {
+			return time.Duration(stats.P95 * float64(time.Second))
+		}
+	}
+	return 0
+}
+
+// waitingForTransactions reports whether the proposer may be holding
+// back an empty block (see skipEmptyBlock), in which case a missing
+// proposal is no reason to change rounds
+func (n *Node) waitingForTransactions() bool {
+	interval := n.config.EmptyBlockInterval
+	if interval <= 0 {
+		return false
+	}
+
+	n.txPoolMu.Lock()
+	pooled := len(n.txPool)
+	n.txPoolMu.Unlock()
+	if pooled > 0 {
+		return false
+	}
+
+	prevBlock, err := n.db.GetLatestBlock()
+	if err != nil {
+		return false
+	}
+	return time.Since(time.Unix(prevBlock.Header.Timestamp, 0)) < interval
+}
@@ -0,0 +1,589 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"blockchain/crypto"
+	"blockchain/rpc"
+	"blockchain/storage"
+	"blockchain/types"
+	"blockchain/wallet"
+)
+
+// maxTxBatch bounds the transactions of one sendRawTransactions call
+const maxTxBatch = 1000
+
+// defaultRPCCosts weighs methods for rate limiting; others cost 1
+var defaultRPCCosts = map[string]int{
+	"sendRawTransaction":   2,
+	"sendRawTransactions":  20,
+	"testMempoolAccept":    20,
+	"getMempoolHashes":     5,
+	"verifyTxProof":        2,
+	"isKeyImageSpent":      2,
+	"getRingMemberIndexes": 2,
+	"getBlockFilters":      10,
+	"getValidatorHistory":  10,
+	"getConstructionData":  50,
+	"registerScanWallet":   20,
+	"getScanOutputs":       50,
+}
+
+// registerRPCMethods exposes node functionality over RPC
+func (n *Node) registerRPCMethods() {
+	n.rpc.Register("getHeight", n.rpcGetHeight)
+	n.rpc.Register("getChainId", n.rpcGetChainID)
+	n.rpc.Register("getStatus", n.rpcGetStatus)
+	n.rpc.Register("getBlock", n.rpcGetBlock)
+	n.rpc.Register("getTransaction", n.rpcGetTransaction)
+	n.rpc.Register("getBlockFilters", n.rpcGetBlockFilters)
+	n.rpc.Register("getConstructionData", n.rpcGetConstructionData)
+	n.rpc.Register("verifyTxProof", n.rpcVerifyTxProof)
+	n.rpc.Register("isKeyImageSpent", n.rpcIsKeyImageSpent)
+	n.rpc.Register("getRingMemberIndexes", n.rpcGetRingMemberIndexes)
+	n.rpc.RegisterWrite("sendRawTransaction", n.rpcSendRawTransaction)
+	n.rpc.RegisterWrite("sendRawTransactions", n.rpcSendRawTransactions)
+	n.rpc.Register("testMempoolAccept", n.rpcTestMempoolAccept)
+	n.rpc.Register("getMempoolTx", n.rpcGetMempoolTx)
+	n.rpc.Register("getMempoolHashes", n.rpcGetMempoolHashes)
+	n.rpc.Register("getForks", n.rpcGetForks)
+	n.rpc.Register("getSupply", n.rpcGetSupply)
+	n.rpc.Register("getSupplyInfo", n.rpcGetSupplyInfo)
+	n.rpc.Register("getTreasury", n.rpcGetTreasury)
+	n.rpc.Register("getBaseFee", n.rpcGetBaseFee)
+	n.rpc.Register("getDenomination", n.rpcGetDenomination)
+	n.rpc.Register("getDustLimit", n.rpcGetDustLimit)
+	n.rpc.Register("getRingPolicy", n.rpcGetRingPolicy)
+	n.rpc.Register("getMaturity", n.rpcGetMaturity)
+	n.rpc.Register("getSyncStatus", n.rpcGetSyncStatus)
+	n.rpc.Register("getValidators", n.rpcGetValidators)
+	n.rpc.Register("getValidatorSet", n.rpcGetValidatorSet)
+	n.rpc.Register("getEpochSummary", n.rpcGetEpochSummary)
+	n.rpc.Register("getValidatorHistory", n.rpcGetValidatorHistory)
+	n.rpc.Register("getValidatorLiveness", n.rpcGetValidatorLiveness)
+	n.rpc.Register("getStakingNonce", n.rpcGetStakingNonce)
+	n.rpc.RegisterWrite("submitStakingTx", n.rpcSubmitStakingTx)
+}
+
+// configureRPCAccess applies the TLS, CORS, per-method access and rate
+// limit settings. Overrides are "method=level" and "method=cost"
+// entries and must come after all methods are registered.
+func (n *Node) configureRPCAccess(cfg *Config) error {
+	if cfg.RPCTLS.CertFile != "" || cfg.RPCTLS.KeyFile != "" {
+		if err := n.rpc.SetTLS(cfg.RPCTLS); err != nil {
+			return err
+		}
+	} else if cfg.RPCTLS.ClientCAFile != "" {
+		return errors.New("-rpc-client-ca needs -rpc-tls-cert and -rpc-tls-key")
+	}
+
+	n.rpc.SetCORSOrigins(cfg.RPCCORSOrigins)
+	n.rpc.SetRestrictWrites(cfg.RPCRestrictWrites)
+
+	for _, entry := range cfg.RPCAccess {
+		method, level, ok := strings.Cut(entry, "=")
+		if !ok {
+			return fmt.Errorf("invalid -rpc-access entry %q (want method=level)", entry)
+		}
+		access, err := rpc.ParseAccess(level)
+		if err != nil {
+			return err
+		}
+		if err := n.rpc.SetAccess(method, access); err != nil {
+			return err
+		}
+	}
+
+	limits, err := rpcRateLimits(cfg)
+	if err != nil {
+		return err
+	}
+	n.rpc.SetRateLimit(limits)
+
+	return nil
+}
+
+// rpcRateLimits returns the checked request quotas of cfg, with its
+// "method=cost" overrides on top of defaultRPCCosts
+func rpcRateLimits(cfg *Config) (rpc.RateLimitConfig, error) {
+	limits := cfg.RPCRateLimit
+	limits.Costs = make(map[string]int, len(defaultRPCCosts))
+	for method, cost := range defaultRPCCosts {
+		limits.Costs[method] = cost
+	}
+	for _, entry := range cfg.RPCCosts {
+		method, value, ok := strings.Cut(entry, "=")
+		cost, err := strconv.Atoi(value)
+		if !ok || err != nil {
+			return rpc.RateLimitConfig{}, fmt.Errorf("invalid -rpc-cost entry %q (want method=cost)", entry)
+		}
+		limits.Costs[method] = cost
+	}
+	if err := limits.Validate(); err != nil {
+		return rpc.RateLimitConfig{}, err
+	}
+	return limits, nil
+}
+
+func (n *Node) rpcGetHeight(params json.RawMessage) (interface{}, error) {
+	height, err := n.db.GetLatestHeight()
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]uint64{"height": height}, nil
+}
+
+func (n *Node) rpcGetChainID(params json.RawMessage) (interface{}, error) {
+	network, err := n.db.GetNetwork()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{
+		"chain_id":     n.chainID,
+		"genesis_hash": n.genesisHash.String(),
+		"network":      string(network),
+	}, nil
+}
+
+// rpcGetStatus returns the status this node gives peers in the P2P
+// handshake, so operators can check which network a node is on
+func (n *Node) rpcGetStatus(params json.RawMessage) (interface{}, error) {
+	return n.status(), nil
+}
+
+func (n *Node) rpcGetBlock(params json.RawMessage) (interface{}, error) {
+	var req struct {
+		Height uint64 `json:"height"`
+	}
+	if err := rpc.DecodeParams(params, &req); err != nil {
+		return nil, err
+	}
+
+	block, err := n.db.GetBlock(req.Height)
+	if err != nil {
+		return nil, notFound(err, fmt.Sprintf("block %d", req.Height))
+	}
+	return block, nil
+}
+
+// rpcGetBlockFilters serves the compact filters of a block range for
+// light wallets (see types.BlockFilter)
+func (n *Node) rpcGetBlockFilters(params json.RawMessage) (interface{}, error) {
+	var req struct {
+		FromHeight uint64 `json:"from_height"`
+		Count      uint64 `json:"count"`
+	}
+	if err := rpc.DecodeParams(params, &req); err != nil {
+		return nil, err
+	}
+	if req.Count == 0 || req.Count > wallet.MaxFilterBatch {
+		return nil, rpc.InvalidParams(fmt.Errorf("count must be between 1 and %d", wallet.MaxFilterBatch))
+	}
+
+	filters := make([]*types.BlockFilter, 0, req.Count)
+	for height := req.FromHeight; height < req.FromHeight+req.Count; height++ {
+		block, err := n.db.GetBlock(height)
+		if err != nil {
+			break // Serve the prefix we have
+		}
+		filters = append(filters, types.BuildBlockFilter(block))
+	}
+	return map[string]interface{}{"filters": filters}, nil
+}
+
+// rpcGetConstructionData serves the outputs, rings and fee an offline
+// wallet needs to build a transaction (see wallet.ConstructionData)
+func (n *Node) rpcGetConstructionData(params json.RawMessage) (interface{}, error) {
+	var req struct {
+		Outputs []string `json:"outputs"`
+		Decoys  int      `json:"decoys"`
+	}
+	if err := rpc.DecodeParams(params, &req); err != nil {
+		return nil, err
+	}
+	if req.Decoys == 0 {
+		req.Decoys = wallet.RingDecoys(n.state.RingPolicy())
+	}
+	if err := n.state.RingPolicy().Check(req.Decoys + 1); err != nil {
+		return nil, rpc.InvalidParams(err)
+	}
+
+	// The backend reports what only the ledger state knows, such as the
+	// base fee and ring member indexes
+	data, err := wallet.NewConstructionData(&rosettaBackend{Database: n.db, node: n}, req.Outputs, req.Decoys)
+	if err != nil {
+		return nil, rpc.InvalidParams(err)
+	}
+	return data, nil
+}
+
+func (n *Node) rpcGetTransaction(params json.RawMessage) (interface{}, error) {
+	var req struct {
+		Hash string `json:"hash"`
+	}
+	if err := rpc.DecodeParams(params, &req); err != nil {
+		return nil, err
+	}
+
+	hash, err := types.HashFromString(req.Hash)
+	if err != nil {
+		return nil, rpc.InvalidParams(err)
+	}
+
+	tx, err := n.db.GetTransaction(hash)
+	if err != nil {
+		return nil, notFound(err, "transaction "+hash.String())
+	}
+	return tx, nil
+}
+
+// notFound names what was looked up when the database does not have it.
+// Other errors, such as storage.ErrCorrupt, are returned unchanged.
+func notFound(err error, what string) error {
+	if errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("%s not found", what)
+	}
+	return err
+}
+
+func (n *Node) rpcVerifyTxProof(params json.RawMessage) (interface{}, error) {
+	var proof crypto.TxProof
+	if err := rpc.DecodeParams(params, &proof); err != nil {
+		return nil, err
+	}
+
+	tx, err := n.db.GetTransaction(proof.TxHash)
+	if err != nil {
+		return nil, notFound(err, "transaction "+proof.TxHash.String())
+	}
+
+	result := struct {
+		Valid  bool   `json:"valid"`
+		Amount uint64 `json:"amount"`
+		Error  string `json:"error,omitempty"`
+	}{}
+
+	amount, err := crypto.VerifyTxProof(&proof, tx)
+	if err != nil {
+		result.Error = err.Error()
+		return result, nil
+	}
+
+	result.Valid = true
+	result.Amount = amount
+	return result, nil
+}
+
+// rpcIsKeyImageSpent reports which of a batch of key images are spent,
+// in request order, so restored and view-only wallets can find their
+// spent outputs without scanning every block
+func (n *Node) rpcIsKeyImageSpent(params json.RawMessage) (interface{}, error) {
+	var req struct {
+		KeyImages []types.PublicKey `json:"key_images"`
+	}
+	if err := rpc.DecodeParams(params, &req); err != nil {
+		return nil, err
+	}
+	if len(req.KeyImages) == 0 || len(req.KeyImages) > wallet.MaxKeyImageBatch {
+		return nil, rpc.InvalidParams(fmt.Errorf("need between 1 and %d key images", wallet.MaxKeyImageBatch))
+	}
+
+	spent := make([]bool, len(req.KeyImages))
+	for i, keyImage := range req.KeyImages {
+		spent[i] = n.state.IsKeyImageSpent(keyImage)
+	}
+	return struct {
+		Spent []bool `json:"spent"`
+	}{Spent: spent}, nil
+}
+
+// rpcGetRingMemberIndexes reports the global output index of the
+// members of one ring, or null while rings do not reference them
+func (n *Node) rpcGetRingMemberIndexes(params json.RawMessage) (interface{}, error) {
+	var req struct {
+		Keys []types.PublicKey `json:"keys"`
+	}
+	if err := rpc.DecodeParams(params, &req); err != nil {
+		return nil, err
+	}
+	if len(req.Keys) == 0 || len(req.Keys) > types.MaxRingSize {
+		return nil, rpc.InvalidParams(fmt.Errorf("need between 1 and %d keys", types.MaxRingSize))
+	}
+
+	indexes, err := n.state.RingMemberIndexes(req.Keys)
+	if err != nil {
+		return nil, rpc.InvalidParams(err)
+	}
+	return struct {
+		Indexes []uint64 `json:"indexes"`
+	}{Indexes: indexes}, nil
+}
+
+func (n *Node) rpcSendRawTransaction(params json.RawMessage) (interface{}, error) {
+	var req struct {
+		Tx *types.Transaction `json:"tx"`
+	}
+	if err := rpc.DecodeParams(params, &req); err != nil {
+		return nil, err
+	}
+	if req.Tx == nil {
+		return nil, rpc.InvalidParams(errors.New("missing tx"))
+	}
+
+	if err := n.submitTransaction(req.Tx); err != nil {
+		return nil, rejectError(err)
+	}
+
+	return map[string]string{"hash": req.Tx.Hash().String()}, nil
+}
+
+// txSubmitResult is the outcome of one transaction of a batch
+type txSubmitResult struct {
+	Hash       string           `json:"hash,omitempty"`
+	Error      string           `json:"error,omitempty"`
+	RejectCode types.RejectCode `json:"reject_code,omitempty"`
+}
+
+// rpcSendRawTransactions adds a batch of transactions to the pool and
+// announces the accepted ones to peers by hash in one message. Results
+// are in request order; a rejected transaction does not fail the rest.
+func (n *Node) rpcSendRawTransactions(params json.RawMessage) (interface{}, error) {
+	var req struct {
+		Txs []*types.Transaction `json:"txs"`
+	}
+	if err := rpc.DecodeParams(params, &req); err != nil {
+		return nil, err
+	}
+	if len(req.Txs) == 0 {
+		return nil, rpc.InvalidParams(errors.New("missing txs"))
+	}
+	if len(req.Txs) > maxTxBatch {
+		return nil, rpc.InvalidParams(fmt.Errorf("at most %d txs per batch", maxTxBatch))
+	}
+
+	results := make([]txSubmitResult, len(req.Txs))
+	accepted := make([]*types.Transaction, 0, len(req.Txs))
+	for i, tx := range req.Txs {
+		if tx == nil {
+			results[i].Error = "missing tx"
+			results[i].RejectCode = types.RejectInvalid
+			continue
+		}
+		if err := n.addToPool(tx); err != nil {
+			results[i].Error = err.Error()
+			results[i].RejectCode = types.RejectCodeOf(err)
+			continue
+		}
+		results[i].Hash = tx.Hash().String()
+		accepted = append(accepted, tx)
+	}
+
+	if err := n.network.BroadcastTxBatch(accepted); err != nil {
+		warnf("Failed to announce transaction batch: %v", err)
+	}
+
+	return results, nil
+}
+
+func (n *Node) rpcGetForks(params json.RawMessage) (interface{}, error) {
+	height := n.state.GetHeight()
+
+	return struct {
+		Height          uint64             `json:"height"`
+		ProtocolVersion uint32             `json:"protocol_version"`
+		ActiveVersion   uint32             `json:"active_version"`
+		Forks           types.ForkSchedule `json:"forks"`
+		Next            *types.Fork        `json:"next,omitempty"`
+	}{
+		Height:          height,
+		ProtocolVersion: types.ProtocolVersion,
+		ActiveVersion:   n.state.ProtocolVersionAt(height),
+		Forks:           n.state.Forks(),
+		Next:            n.state.Forks().Next(height),
+	}, nil
+}
+
+func (n *Node) rpcGetSupply(params json.RawMessage) (interface{}, error) {
+	state := n.state.View()
+	height := state.GetHeight()
+	emission := state.Emission()
+
+	return struct {
+		Height      uint64               `json:"height"`
+		TotalSupply uint64               `json:"total_supply"`
+		NextSubsidy uint64               `json:"next_subsidy"`
+		Emission    types.EmissionConfig `json:"emission"`
+	}{
+		Height:      height,
+		TotalSupply: state.GetTotalSupply(),
+		NextSubsidy: emission.Subsidy(height + 1),
+		Emission:    emission,
+	}, nil
+}
+
+// rpcGetSupplyInfo breaks the supply down by how coins were created and
+// destroyed, for economics dashboards
+func (n *Node) rpcGetSupplyInfo(params json.RawMessage) (interface{}, error) {
+	state := n.state.View()
+	height := state.GetHeight()
+	total := state.GetTotalSupply()
+	supplyCap := state.Emission().SupplyCap()
+
+	return struct {
+		Height      uint64 `json:"height"`
+		TotalSupply uint64 `json:"total_supply"`
+		SupplyCap   uint64 `json:"supply_cap"`
+		Unissued    uint64 `json:"unissued"` // Left to emit before the cap
+		Staked      uint64 `json:"staked"`
+		types.SupplyStats
+	}{
+		Height:      height,
+		TotalSupply: total,
+		SupplyCap:   supplyCap,
+		Unissued:    supplyCap - total,
+		Staked:      state.GetTotalStake(),
+		SupplyStats: state.SupplyStats(),
+	}, nil
+}
+
+// rpcGetBaseFee reports the base fee the next block burns from every
+// transaction
+func (n *Node) rpcGetBaseFee(params json.RawMessage) (interface{}, error) {
+	return struct {
+		Height    uint64                `json:"height"`
+		BaseFee   uint64                `json:"base_fee"` // 0 while the fee market is off
+		FeeMarket types.FeeMarketConfig `json:"fee_market"`
+	}{
+		Height:    n.state.GetHeight(),
+		BaseFee:   n.state.BaseFee(),
+		FeeMarket: n.state.FeeMarket(),
+	}, nil
+}
+
+// rpcGetDenomination reports how amounts are written for people. RPC
+// amounts are always in base units.
+func (n *Node) rpcGetDenomination(params json.RawMessage) (interface{}, error) {
+	d, err := n.db.GetDenomination()
+	if err != nil {
+		return nil, err
+	}
+
+	return struct {
+		Symbol   string `json:"symbol"`
+		Decimals uint8  `json:"decimals"`
+	}{
+		Symbol:   d.Unit(),
+		Decimals: d.Decimals,
+	}, nil
+}
+
+// rpcGetDustLimit reports the smallest amount an output of the next
+// block may carry
+func (n *Node) rpcGetDustLimit(params json.RawMessage) (interface{}, error) {
+	return struct {
+		Height    uint64 `json:"height"`
+		DustLimit uint64 `json:"dust_limit"` // 0 while the limit is off
+	}{
+		Height:    n.state.GetHeight(),
+		DustLimit: n.state.DustLimit(),
+	}, nil
+}
+
+// rpcGetRingPolicy reports the ring size bounds of the next block. The
+// zero policy means none are enforced yet.
+func (n *Node) rpcGetRingPolicy(params json.RawMessage) (interface{}, error) {
+	return n.state.RingPolicy(), nil
+}
+
+// rpcGetMaturity reports the depths outputs must be buried under to be
+// spent or used as decoys in the next block
+func (n *Node) rpcGetMaturity(params json.RawMessage) (interface{}, error) {
+	maturity := n.state.Maturity()
+	return struct {
+		Height                uint64 `json:"height"`
+		Confirmations         uint64 `json:"confirmations"`
+		CoinbaseConfirmations uint64 `json:"coinbase_confirmations"`
+	}{
+		Height:                n.state.GetHeight(),
+		Confirmations:         maturity.Required(false),
+		CoinbaseConfirmations: maturity.Required(true),
+	}, nil
+}
+
+func (n *Node) rpcGetSyncStatus(params json.RawMessage) (interface{}, error) {
+	return n.sync.Status(), nil
+}
+
+func (n *Node) rpcGetValidators(params json.RawMessage) (interface{}, error) {
+	state := n.state.View()
+	height := state.GetHeight()
+	cfg := state.ValidatorSet()
+
+	return struct {
+		Height              uint64                  `json:"height"`
+		MaxValidators       int                     `json:"max_validators"`
+		EpochLength         uint64                  `json:"epoch_length"`
+		NextRotation        uint64                  `json:"next_rotation"`
+		MinValidatorStake   uint64                  `json:"min_validator_stake"`
+		MinSelfBond         uint64                  `json:"min_self_bond"`
+		MaxCommission       uint32                  `json:"max_commission"`
+		MaxCommissionChange uint32                  `json:"max_commission_change"`
+		Active              []*types.ValidatorState `json:"active"`
+		Queued              []*types.ValidatorState `json:"queued"`
+		Jailed              []*types.ValidatorState `json:"jailed"`
+		Unbonding           []*types.ValidatorState `json:"unbonding"`
+	}{
+		Height:              height,
+		MaxValidators:       cfg.MaxValidators,
+		EpochLength:         cfg.Epoch(),
+		NextRotation:        cfg.NextRotation(height),
+		MinValidatorStake:   cfg.MinValidatorStake,
+		MinSelfBond:         cfg.MinSelfBond,
+		MaxCommission:       cfg.CommissionCap(),
+		MaxCommissionChange: cfg.MaxCommissionChange,
+		Active:              state.GetActiveValidators(),
+		Queued:              state.GetQueuedValidators(),
+		Jailed:              state.GetJailedValidators(),
+		Unbonding:           state.GetUnbondingValidators(),
+	}, nil
+}
+
+// rpcGetStakingNonce returns the nonce a validator's next staking
+// transaction must carry
+func (n *Node) rpcGetStakingNonce(params json.RawMessage) (interface{}, error) {
+	var req struct {
+		Validator types.PublicKey `json:"validator"`
+	}
+	if err := rpc.DecodeParams(params, &req); err != nil {
+		return nil, err
+	}
+
+	return struct {
+		Validator types.PublicKey `json:"validator"`
+		Nonce     uint64          `json:"nonce"`
+	}{
+		Validator: req.Validator,
+		Nonce:     n.state.StakingNonce(req.Validator),
+	}, nil
+}
+
+// rpcGetValidatorSet returns the validator set that voted on the block
+// at height, for checking its certificate without the ledger
+func (n *Node) rpcGetValidatorSet(params json.RawMessage) (interface{}, error) {
+	var req struct {
+		Height uint64 `json:"height"`
+	}
+	if err := rpc.DecodeParams(params, &req); err != nil {
+		return nil, err
+	}
+	if tip := n.state.GetHeight() + 1; req.Height == 0 || req.Height > tip {
+		return nil, rpc.InvalidParams(fmt.Errorf("height must be between 1 and %d", tip))
+	}
+
+	return n.db.GetValidatorSet(req.Height)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"blockchain/ledger"
+	"blockchain/rpc"
+	"blockchain/types"
+)
+
+// newRPCTestNode returns a node at genesis serving the RPC methods that
+// only read the ledger and mempool. Panics in methods are counted in
+// panics instead of logged.
+func newRPCTestNode(t testing.TB, panics *atomic.Int64) *Node {
+	t.Helper()
+	state := ledger.NewState()
+	if err := state.InitializeGenesis(&types.GenesisConfig{ChainID: "rpc-test"}); err != nil {
+		t.Fatal(err)
+	}
+
+	n := &Node{
+		state:       state,
+		txPool:      make([]*types.Transaction, 0),
+		txIndex:     make(map[types.Hash]*poolEntry),
+		stakingPool: make(map[types.PublicKey]*types.StakingTx),
+		rpc:         rpc.NewServer(""),
+	}
+	n.poolLimit.Store(100)
+
+	n.rpc.Register("isKeyImageSpent", n.rpcIsKeyImageSpent)
+	n.rpc.Register("getRingMemberIndexes", n.rpcGetRingMemberIndexes)
+	n.rpc.Register("testMempoolAccept", n.rpcTestMempoolAccept)
+	n.rpc.Register("getMempoolTx", n.rpcGetMempoolTx)
+	n.rpc.Register("getStakingNonce", n.rpcGetStakingNonce)
+	n.rpc.Register("getBaseFee", n.rpcGetBaseFee)
+	n.rpc.SetPanicHandler(func(string, interface{}, []byte) { panics.Add(1) })
+	return n
+}
+
+// FuzzRPC sends arbitrary request bodies to the node's RPC methods. No
+// input may panic a method, and every answer must be a JSON-RPC
+// response.
+func FuzzRPC(f *testing.F) {
+	f.Add([]byte(`{"jsonrpc":"2.0","id":1,"method":"isKeyImageSpent","params":{"key_images":["0101010101010101010101010101010101010101010101010101010101010101"]}}`))
+	f.Add([]byte(`{"jsonrpc":"2.0","id":1,"method":"getRingMemberIndexes","params":{"keys":[]}}`))
+	f.Add([]byte(`{"jsonrpc":"2.0","id":1,"method":"testMempoolAccept","params":{"txs":[null,{"Version":1,"Inputs":[null]}]}}`))
+	f.Add([]byte(`{"jsonrpc":"2.0","id":1,"method":"testMempoolAccept","params":{"txs":[{"Version":1,"Outputs":[{"Amount":1}]}]}}`))
+	f.Add([]byte(`{"jsonrpc":"2.0","id":1,"method":"getMempoolTx","params":{"hash":"zz"}}`))
+	f.Add([]byte(`{"jsonrpc":"2.0","id":"a","method":"getStakingNonce","params":{"validator":12}}`))
+	f.Add([]byte(`{"jsonrpc":"2.0","method":"getBaseFee"}`))
+	f.Add([]byte(`[1,2`))
+
+	var panics atomic.Int64
+	n := newRPCTestNode(f, &panics)
+
+	f.Fuzz(func(t *testing.T, body []byte) {
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		n.rpc.ServeHTTP(w, req)
+
+		if panics.Load() > 0 {
+			t.Fatalf("method panicked on %s", body)
+		}
+		var resp rpc.Response
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("response %q is not JSON-RPC: %v", w.Body.String(), err)
+		}
+		if resp.Error == nil && resp.Result == nil {
+			t.Fatalf("response to %s has neither result nor error", body)
+		}
+	})
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+
+	"blockchain/rpc"
+	"blockchain/wallet"
+)
+
+// registerScanServiceMethods exposes the opt-in scanning service for
+// light wallets (see wallet.ScanService). Registering hands the node a
+// wallet's view key, so the operator learns its incoming payments.
+func (n *Node) registerScanServiceMethods() {
+	n.scanService = wallet.NewScanService(n.db, n.config.ScanService)
+
+	n.rpc.RegisterWrite("registerScanWallet", n.rpcRegisterScanWallet)
+	n.rpc.RegisterWrite("unregisterScanWallet", n.rpcUnregisterScanWallet)
+	n.rpc.Register("getScanOutputs", n.rpcGetScanOutputs)
+}
+
+func (n *Node) rpcRegisterScanWallet(params json.RawMessage) (interface{}, error) {
+	var reg wallet.ScanRegistration
+	if err := rpc.DecodeParams(params, &reg); err != nil {
+		return nil, err
+	}
+
+	token, err := n.scanService.Register(&reg)
+	if err != nil {
+		return nil, rpc.InvalidParams(err)
+	}
+	return map[string]string{"token": token}, nil
+}
+
+func (n *Node) rpcUnregisterScanWallet(params json.RawMessage) (interface{}, error) {
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := rpc.DecodeParams(params, &req); err != nil {
+		return nil, err
+	}
+
+	if !n.scanService.Unregister(req.Token) {
+		return nil, scanTokenError()
+	}
+	return map[string]bool{"unregistered": true}, nil
+}
+
+func (n *Node) rpcGetScanOutputs(params json.RawMessage) (interface{}, error) {
+	var req struct {
+		Token      string `json:"token"`
+		FromHeight uint64 `json:"from_height"`
+	}
+	if err := rpc.DecodeParams(params, &req); err != nil {
+		return nil, err
+	}
+
+	result, err := n.scanService.Outputs(req.Token, req.FromHeight)
+	if errors.Is(err, wallet.ErrUnknownScanToken) {
+		return nil, scanTokenError()
+	}
+	return result, err
+}
+
+// scanTokenError tells a wallet to register again
+func scanTokenError() *rpc.Error {
+	return &rpc.Error{Code: rpc.CodeUnauthorized, Message: wallet.ErrUnknownScanToken.Error()}
+}
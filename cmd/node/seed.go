@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	libp2pcrypto "github.com/libp2p/go-libp2p/core/crypto"
+
+	"blockchain/p2p"
+	"blockchain/types"
+)
+
+// runSeed runs a discovery-only seed node until interrupted. It keeps
+// no ledger or database: it answers handshakes for the chain named in
+// the genesis file and hands out addresses of other peers. Only its
+// libp2p key is stored, so its bootstrap address survives restarts,
+// unless it is ephemeral.
+func runSeed(cfg *Config) {
+	data, err := os.ReadFile(cfg.GenesisFile)
+	if err != nil {
+		log.Fatalf("Failed to read genesis: %v", err)
+	}
+	genesis, err := types.ParseGenesis(data)
+	if err != nil {
+		log.Fatalf("Failed to parse genesis: %v", err)
+	}
+	genesisHash, err := genesis.Hash()
+	if err != nil {
+		log.Fatalf("Failed to hash genesis: %v", err)
+	}
+
+	identity, err := loadSeedIdentity(cfg)
+	if err != nil {
+		log.Fatalf("Failed to load seed key: %v", err)
+	}
+
+	network, err := p2p.NewSeedNetwork(genesis.ChainID, cfg.P2PPort, cfg.BootstrapPeers, cfg.Proxy, identity)
+	if err != nil {
+		log.Fatalf("Failed to create network: %v", err)
+	}
+	defer network.Close()
+
+	// Without a ledger the seed reports the genesis rules; nodes only
+	// check that it is on their chain and genesis and can run their
+	// active version
+	network.SetStatusFunc(func() p2p.Status {
+		return p2p.Status{
+			ChainID:         genesis.ChainID,
+			GenesisHash:     genesisHash.String(),
+			ProtocolVersion: types.ProtocolVersion,
+			ActiveVersion:   genesis.Forks.VersionAt(0),
+			Time:            time.Now().UnixMilli(),
+			Seed:            true,
+		}
+	})
+
+	if err := network.StartSeed(); err != nil {
+		log.Fatalf("Failed to start seed: %v", err)
+	}
+
+	infof("Seed node for %s started", genesis.ChainID)
+	for _, addr := range network.GetMultiaddrs() {
+		infof("Bootstrap address: %s/p2p/%s", addr, network.GetHostID())
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	<-sigChan
+
+	infof("Shutting down...")
+}
+
+// loadSeedIdentity loads the seed's P2P key, encrypted like that of
+// other nodes, which -new-identity rotates, or creates a key in memory
+// for an ephemeral seed. The unencrypted seed.key of older seeds is
+// encrypted in its place, so their bootstrap address survives.
+func loadSeedIdentity(cfg *Config) (libp2pcrypto.PrivKey, error) {
+	if cfg.Ephemeral {
+		return p2p.NewIdentity()
+	}
+
+	if err := os.MkdirAll(cfg.DataDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+	plainPath, keyPath := cfg.DataDir+"/seed.key", cfg.DataDir+"/p2p.key"
+	if cfg.NewIdentity {
+		if err := os.Remove(plainPath); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	passphrase, err := identityPassphrase(cfg, keyPath)
+	if err != nil {
+		return nil, err
+	}
+	imported, err := p2p.ImportIdentity(plainPath, keyPath, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if imported {
+		infof("Encrypted the seed key %s into %s", plainPath, keyPath)
+	}
+
+	identity, created, err := p2p.LoadOrCreateEncryptedIdentity(keyPath, passphrase, cfg.NewIdentity)
+	if err != nil {
+		return nil, err
+	}
+	if created {
+		infof("Created new P2P identity")
+	}
+	return identity, nil
+}
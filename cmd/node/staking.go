@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"blockchain/p2p"
+	"blockchain/rpc"
+	"blockchain/types"
+)
+
+// handleStakingTx pools a gossiped staking transaction for the blocks
+// this node proposes
+func (n *Node) handleStakingTx(data []byte) error {
+	var msg p2p.Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return err
+	}
+
+	var stx types.StakingTx
+	if err := json.Unmarshal(msg.Data, &stx); err != nil {
+		return err
+	}
+
+	_, err := n.addStakingTx(&stx)
+	return err
+}
+
+// addStakingTx validates a staking transaction and pools it, at most
+// one per validator since each must carry the next nonce. It reports
+// whether the transaction was new. A pooled transaction is replaced
+// once a block has consumed its nonce.
+func (n *Node) addStakingTx(stx *types.StakingTx) (bool, error) {
+	if err := n.state.ValidateStakingTx(stx); err != nil {
+		return false, fmt.Errorf("invalid staking transaction: %w", err)
+	}
+
+	n.stakingMu.Lock()
+	defer n.stakingMu.Unlock()
+
+	if pooled, ok := n.stakingPool[stx.Validator]; ok {
+		if pooled.Hash() == stx.Hash() {
+			return false, nil
+		}
+		if n.state.ValidateStakingTx(pooled) == nil {
+			return false, errors.New("validator already has a staking transaction waiting for a block")
+		}
+	}
+	n.stakingPool[stx.Validator] = stx
+
+	infof("Staking transaction added to pool for %s", stx.Validator.String()[:8])
+	return true, nil
+}
+
+// stakingForBlock picks the pooled staking transactions for a proposal
+// holding txs, and drops the ones no longer valid. A bond goes in only
+// with its funding transaction; funding transactions whose bond is not
+// included are left out of txs and stay pooled.
+func (n *Node) stakingForBlock(txs []*types.Transaction) ([]*types.Transaction, []*types.StakingTx) {
+	n.stakingMu.Lock()
+	defer n.stakingMu.Unlock()
+
+	included := make(map[types.Hash]bool, len(txs))
+	for _, tx := range txs {
+		included[tx.Hash()] = true
+	}
+
+	staking := make([]*types.StakingTx, 0, len(n.stakingPool))
+	funded := make(map[types.Hash]bool)
+	for validator, stx := range n.stakingPool {
+		if err := n.state.ValidateStakingTx(stx); err != nil {
+			debugf("Dropping staking transaction of %s: %v", validator.String()[:8], err)
+			delete(n.stakingPool, validator)
+			continue
+		}
+		if stx.Type == types.StakingBond {
+			if !included[stx.Funding] {
+				continue // Funding transaction not pooled yet, or not payable
+			}
+			funded[stx.Funding] = true
+		}
+		staking = append(staking, stx)
+	}
+	sort.Slice(staking, func(i, j int) bool {
+		return bytes.Compare(staking[i].Validator[:], staking[j].Validator[:]) < 0
+	})
+
+	kept := make([]*types.Transaction, 0, len(txs))
+	for _, tx := range txs {
+		if tx.HasBonds() && !funded[tx.Hash()] {
+			continue
+		}
+		kept = append(kept, tx)
+	}
+	return kept, staking
+}
+
+// rpcSubmitStakingTx pools a signed staking transaction and gossips it
+// to the other validators, so whichever proposes next includes it
+func (n *Node) rpcSubmitStakingTx(params json.RawMessage) (interface{}, error) {
+	var req struct {
+		StakingTx *types.StakingTx `json:"staking_tx"`
+	}
+	if err := rpc.DecodeParams(params, &req); err != nil {
+		return nil, err
+	}
+	if req.StakingTx == nil {
+		return nil, rpc.InvalidParams(errors.New("missing staking_tx"))
+	}
+
+	added, err := n.addStakingTx(req.StakingTx)
+	if err != nil {
+		return nil, rpc.InvalidParams(err)
+	}
+	if added {
+		if err := n.network.BroadcastStakingTx(req.StakingTx); err != nil {
+			warnf("Failed to broadcast staking transaction: %v", err)
+		}
+	}
+
+	return map[string]string{"hash": req.StakingTx.Hash().String()}, nil
+}
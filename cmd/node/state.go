@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"blockchain/ledger"
+	"blockchain/storage"
+	"blockchain/types"
+)
+
+// Snapshot file formats
+const (
+	SnapshotFormatJSON   = "json"
+	SnapshotFormatBinary = "binary"
+)
+
+// runStateCommand runs an offline state tool named by the first
+// argument. It reports false when args do not name one.
+func runStateCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+
+	switch args[0] {
+	case "export-state":
+		exportState(args[1:])
+	case "import-state":
+		importState(args[1:])
+	case "verify":
+		verifyChain(args[1:]) // See verify.go
+	case "conformance":
+		runConformance(args[1:]) // See conformance.go
+	case "approve-treasury-spend":
+		approveTreasurySpend(args[1:]) // See treasury.go
+	case "status":
+		nodeStatus(args[1:]) // See status.go
+	case "validator":
+		validatorCommand(args[1:]) // See validatorstatus.go
+	case "genesis":
+		genesisCommand(args[1:]) // See genesis.go
+	case "ctl":
+		ctlCommand(args[1:]) // See control.go
+	default:
+		return false
+	}
+	return true
+}
+
+// exportState replays the stored chain up to a height and writes the
+// resulting ledger state. The node must be stopped first.
+func exportState(args []string) {
+	fs := flag.NewFlagSet("export-state", flag.ExitOnError)
+	dataDir := fs.String("datadir", "./data", "Data directory")
+	height := fs.Uint64("height", 0, "Height to export (0 for the latest block)")
+	out := fs.String("out", "-", "Output file (- for stdout)")
+	format := fs.String("format", SnapshotFormatJSON, "Output format: json or binary")
+	addOutputFlags(fs)
+	fs.Parse(args)
+	setupOutput()
+	if jsonOutput && *out == "-" {
+		usageFatal("-json needs -out <file>: the state would share stdout with the result")
+	}
+
+	db, err := storage.OpenReadOnly(*dataDir + "/blockchain.db")
+	if err != nil {
+		log.Fatalf("Failed to open database (is the node still running?): %v", err)
+	}
+	defer db.Close()
+
+	snap, err := replayState(db, *height)
+	if err != nil {
+		log.Fatalf("Failed to rebuild state: %v", err)
+	}
+
+	data, err := encodeSnapshot(snap, *format)
+	if err != nil {
+		log.Fatalf("Failed to encode state: %v", err)
+	}
+
+	if err := writeOutput(*out, data); err != nil {
+		log.Fatalf("Failed to write state: %v", err)
+	}
+
+	if *out != "-" {
+		fmt.Printf("Exported state at height %d to %s\n", snap.Height, *out)
+		fmt.Printf("  Outputs:    %d\n", len(snap.UTXOs))
+		fmt.Printf("  Key images: %d\n", len(snap.KeyImages))
+		fmt.Printf("  Validators: %d\n", len(snap.Validators))
+		fmt.Printf("  Supply:     %d\n", snap.TotalSupply)
+		fmt.Printf("  Minted:     %d\n", snap.Supply.Minted)
+		fmt.Printf("  Burned:     %d\n", snap.Supply.Burned)
+	}
+
+	printResult(map[string]interface{}{
+		"file":       *out,
+		"chain_id":   snap.ChainID,
+		"height":     snap.Height,
+		"block_hash": snap.BlockHash,
+		"outputs":    len(snap.UTXOs),
+		"key_images": len(snap.KeyImages),
+		"validators": len(snap.Validators),
+		"supply":     snap.TotalSupply,
+		"minted":     snap.Supply.Minted,
+		"burned":     snap.Supply.Burned,
+	})
+}
+
+// importState turns an exported state into the genesis file of a new
+// chain
+func importState(args []string) {
+	fs := flag.NewFlagSet("import-state", flag.ExitOnError)
+	in := fs.String("in", "", "Exported state file")
+	chainID := fs.String("chain-id", "", "Chain ID of the new chain")
+	genesisTime := fs.String("genesis-time", "", "Genesis time of the new chain (default now, RFC 3339)")
+	out := fs.String("out", "-", "Genesis file to write (- for stdout)")
+	addOutputFlags(fs)
+	fs.Parse(args)
+	setupOutput()
+
+	if *in == "" || *chainID == "" {
+		usageFatal("Usage: node import-state -in <state file> -chain-id <id> [-genesis-time <time>] [-out <genesis file>]")
+	}
+	if jsonOutput && *out == "-" {
+		usageFatal("-json needs -out <file>: the genesis would share stdout with the result")
+	}
+
+	data, err := os.ReadFile(*in)
+	if err != nil {
+		log.Fatalf("Failed to read state: %v", err)
+	}
+
+	snap, err := decodeSnapshot(data)
+	if err != nil {
+		log.Fatalf("Failed to decode state: %v", err)
+	}
+
+	if snap.ChainID == *chainID {
+		log.Fatalf("New chain must not reuse chain ID %q", *chainID)
+	}
+
+	if err := ledger.ValidateSnapshot(snap); err != nil {
+		log.Fatalf("Invalid state: %v", err)
+	}
+
+	if *genesisTime == "" {
+		*genesisTime = time.Now().UTC().Format(time.RFC3339)
+	} else if _, err := time.Parse(time.RFC3339, *genesisTime); err != nil {
+		log.Fatalf("Invalid genesis time: %v", err)
+	}
+
+	genesis := &types.GenesisConfig{
+		ChainID:           *chainID,
+		GenesisTime:       *genesisTime,
+		InitialSupply:     snap.TotalSupply,
+		InitialValidators: snap.Validators,
+		InitialState:      snap,
+	}
+	if err := genesis.Validate(); err != nil {
+		log.Fatalf("Invalid genesis: %v", err)
+	}
+
+	genesisData, err := json.MarshalIndent(genesis, "", "  ")
+	if err != nil {
+		log.Fatalf("Failed to encode genesis: %v", err)
+	}
+
+	if err := writeOutput(*out, genesisData); err != nil {
+		log.Fatalf("Failed to write genesis: %v", err)
+	}
+
+	if *out != "-" {
+		fmt.Printf("Wrote genesis for %s to %s\n", *chainID, *out)
+		fmt.Printf("  Seeded from %s at height %d\n", snap.ChainID, snap.Height)
+	}
+
+	printResult(map[string]interface{}{
+		"file":        *out,
+		"chain_id":    *chainID,
+		"seeded_from": snap.ChainID,
+		"height":      snap.Height,
+	})
+}
+
+// replayState rebuilds ledger state from genesis by applying the stored
+// blocks up to height
+func replayState(db *storage.Database, height uint64) (*types.StateSnapshot, error) {
+	genesis, err := db.GetGenesis()
+	if err != nil {
+		return nil, fmt.Errorf("no genesis in database: %w", err)
+	}
+
+	latest, err := db.GetLatestHeight()
+	if err != nil {
+		return nil, err
+	}
+	if height == 0 {
+		height = latest
+	}
+	if height > latest {
+		return nil, fmt.Errorf("height %d is above the latest block %d", height, latest)
+	}
+
+	state := ledger.NewState()
+	if err := state.InitializeGenesis(genesis); err != nil {
+		return nil, err
+	}
+
+	var blockHash string
+	for h := uint64(1); h <= height; h++ {
+		block, err := db.GetBlock(h)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load block %d: %w", h, err)
+		}
+		if err := state.ApplyBlock(block); err != nil {
+			return nil, fmt.Errorf("failed to apply block %d: %w", h, err)
+		}
+		blockHash = block.Header.Hash().String()
+	}
+
+	snap := state.Export()
+	snap.ChainID = genesis.ChainID
+	snap.BlockHash = blockHash
+
+	return snap, nil
+}
+
+// encodeSnapshot serializes a snapshot in the given format
+func encodeSnapshot(snap *types.StateSnapshot, format string) ([]byte, error) {
+	switch format {
+	case SnapshotFormatJSON:
+		return json.MarshalIndent(snap, "", "  ")
+	case SnapshotFormatBinary:
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(snap); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+}
+
+// decodeSnapshot reads a snapshot in either format
+func decodeSnapshot(data []byte) (*types.StateSnapshot, error) {
+	var snap types.StateSnapshot
+
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		if err := json.Unmarshal(data, &snap); err != nil {
+			return nil, err
+		}
+		return &snap, nil
+	}
+
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&snap); err != nil {
+		return nil, err
+	}
+	return &snap, nil
+}
+
+// writeOutput writes data to a file, or to stdout for "-"
+func writeOutput(path string, data []byte) error {
+	if path == "-" {
+		_, err := resultOut.Write(append(data, '\n'))
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"blockchain/consensus"
+	"blockchain/p2p"
+	"blockchain/types"
+)
+
+// StateSnapshotInterval is how often, in blocks, the state is chunked
+// for serving to peers using state sync
+const StateSnapshotInterval = 1000
+
+// stateSyncAttempts and stateSyncRetry bound how long to look for a
+// snapshot while peers connect before replaying blocks instead
+const (
+	stateSyncAttempts = 5
+	stateSyncRetry    = 5 * time.Second
+)
+
+// servedState returns the snapshot offered to syncing peers
+func (n *Node) servedState() *types.ChunkedState {
+	n.stateMu.RLock()
+	defer n.stateMu.RUnlock()
+	return n.stateSnap
+}
+
+// takeStateSnapshot chunks the current state for serving (must hold
+// blockMu). Chunking works on a view in the background, so it does not
+// hold up the next block.
+func (n *Node) takeStateSnapshot() {
+	view := n.state.View()
+
+	go func() {
+		defer n.recoverPanic("state snapshot")
+
+		cs := types.NewChunkedState(view.Export())
+
+		n.stateMu.Lock()
+		defer n.stateMu.Unlock()
+		if n.stateSnap != nil && n.stateSnap.Manifest.Height >= cs.Manifest.Height {
+			return // Overtaken by a later snapshot
+		}
+		n.stateSnap = cs
+
+		debugf("State snapshot taken at height %d (%d chunks)", cs.Manifest.Height, cs.Manifest.Chunks)
+	}()
+}
+
+// startStateSync downloads a state snapshot in the background, then
+// starts block sync to replay the blocks after it
+func (n *Node) startStateSync() {
+	ctx, cancel := context.WithCancel(context.Background())
+	n.stateSyncCancel = cancel
+	n.stateSyncDone = make(chan struct{})
+
+	go func() {
+		defer close(n.stateSyncDone)
+		defer n.recoverPanic("state sync")
+
+		n.runStateSync(ctx)
+		if ctx.Err() == nil {
+			n.sync.Start()
+			infof("Blockchain sync started")
+		}
+	}()
+
+	infof("State sync started")
+}
+
+// stopStateSync cancels a running state sync and waits for it
+func (n *Node) stopStateSync() {
+	if n.stateSyncCancel == nil {
+		return
+	}
+	n.stateSyncCancel()
+	<-n.stateSyncDone
+}
+
+// runStateSync looks for a snapshot, retrying while peers connect. On
+// any failure block sync replays the chain from the local tip instead.
+func (n *Node) runStateSync(ctx context.Context) {
+	cfg := p2p.DefaultStateSyncConfig()
+
+	for attempt := 1; ; attempt++ {
+		synced, err := n.network.SyncState(ctx, cfg, n.state.GetHeight(), n.consensus.VerifyCertificate)
+		if err == nil {
+			if err := n.importState(synced); err != nil {
+				warnf("State sync failed: %v; replaying blocks instead", err)
+			}
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if attempt == stateSyncAttempts {
+			infof("State sync: %v; replaying blocks instead", err)
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(stateSyncRetry):
+		}
+	}
+}
+
+// importState installs a downloaded snapshot and stores the block at its
+// height as the parent of the next block
+func (n *Node) importState(synced *p2p.SyncedState) error {
+	n.blockMu.Lock()
+	defer n.blockMu.Unlock()
+
+	snap, anchor := synced.Snapshot, synced.Anchor
+	if height := n.state.GetHeight(); height >= snap.Height {
+		return fmt.Errorf("already at height %d", height)
+	}
+	if err := consensus.VerifyTxRoot(anchor); err != nil {
+		return fmt.Errorf("block %d: %w", anchor.Header.Height, err)
+	}
+
+	if err := n.state.Restore(snap); err != nil {
+		return fmt.Errorf("failed to restore state: %w", err)
+	}
+	if err := n.consensus.UpdateValidatorSet(); err != nil {
+		return fmt.Errorf("failed to update validator set: %w", err)
+	}
+	n.recordValidatorSet(snap.Height + 1)
+	if err := n.consensus.StartHeight(anchor); err != nil {
+		warnf("Failed to update consensus WAL: %v", err)
+	}
+
+	if err := n.db.SaveBlock(anchor); err != nil {
+		return fmt.Errorf("failed to save block: %w", err)
+	}
+	if err := n.db.UpdateLatestHeight(anchor.Header.Height); err != nil {
+		return fmt.Errorf("failed to update height: %w", err)
+	}
+
+	n.takeStateSnapshot()
+	n.noteBlockApplied()
+	infof("State synced to height %d (%d outputs, %d validators)", snap.Height, len(snap.UTXOs), len(snap.Validators))
+
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// statusTimeout bounds the readiness request of the status command
+const statusTimeout = 10 * time.Second
+
+// nodeStatus prints the readiness report of a running node, from
+// /readyz on its RPC listener, and exits non-zero when it is not ready
+func nodeStatus(args []string) {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	rpcURL := fs.String("rpc", "http://127.0.0.1:9100", "RPC URL of the node")
+	addOutputFlags(fs)
+	fs.Parse(args)
+	setupOutput()
+
+	client := &http.Client{Timeout: statusTimeout}
+	resp, err := client.Get(strings.TrimSuffix(*rpcURL, "/") + "/readyz")
+	if err != nil {
+		log.Fatalf("Failed to reach node: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var report healthReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		log.Fatalf("Invalid status from node (%s): %v", resp.Status, err)
+	}
+	ready := resp.StatusCode == http.StatusOK
+
+	fmt.Printf("Status:  %s\n", report.Status)
+	fmt.Printf("Height:  %d (best peer height %d)\n", report.Sync.Height, report.Sync.BestPeerHeight)
+	fmt.Printf("Peers:   %d\n", report.Peers)
+	if report.Consensus.Validator {
+		fmt.Printf("Validator: active=%t\n", report.Consensus.Active)
+	}
+	if report.Clock.Source != "" {
+		fmt.Printf("Clock offset: %s (%s)\n", report.Clock.Offset, report.Clock.Source)
+	}
+	for _, problem := range report.Problems {
+		fmt.Printf("Problem: %s\n", problem)
+	}
+
+	printResult(struct {
+		Ready bool `json:"ready"`
+		*healthReport
+	}{ready, &report})
+
+	if !ready {
+		os.Exit(exitFailure)
+	}
+}
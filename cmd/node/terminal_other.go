@@ -0,0 +1,11 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// readPassphrase is only implemented on Linux. Elsewhere the passphrase
+// comes from -identity-passphrase-file or the environment.
+func readPassphrase(prompt string) (string, error) {
+	return "", errors.New("passphrase prompts are not supported on this platform")
+}
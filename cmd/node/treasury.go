@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"golang.org/x/crypto/ed25519"
+
+	"blockchain/types"
+)
+
+func (n *Node) rpcGetTreasury(params json.RawMessage) (interface{}, error) {
+	height := n.state.GetHeight()
+	treasury := n.state.Treasury()
+	emission := n.state.Emission()
+
+	return struct {
+		Height          uint64 `json:"height"`
+		TreasuryPercent uint64 `json:"treasury_percent"`
+		NextCredit      uint64 `json:"next_credit"` // Share of the next block's subsidy
+		types.Treasury
+	}{
+		Height:          height,
+		TreasuryPercent: emission.TreasuryPercent,
+		NextCredit:      emission.TreasuryShare(n.state.BlockSubsidy(height + 1)),
+		Treasury:        treasury,
+	}, nil
+}
+
+// approveTreasurySpend adds a validator's approval to a treasury spend
+// transaction file. Validators pass the file around until approvals
+// carry 2/3 of the stake, then anyone submits it.
+func approveTreasurySpend(args []string) {
+	fs := flag.NewFlagSet("approve-treasury-spend", flag.ExitOnError)
+	keyFile := fs.String("validator", "", "Path to validator key file")
+	chainID := fs.String("chain-id", "", "Chain the spend is for")
+	in := fs.String("in", "", "Treasury spend transaction file")
+	out := fs.String("out", "", "Output file (default: overwrite -in)")
+	addOutputFlags(fs)
+	fs.Parse(args)
+	setupOutput()
+
+	if *keyFile == "" || *chainID == "" || *in == "" {
+		usageFatal("Usage: node approve-treasury-spend -validator <key file> -chain-id <id> -in <tx file> [-out <file>]")
+	}
+	if jsonOutput && *out == "-" {
+		usageFatal("-json needs -out <file>: the transaction would share stdout with the result")
+	}
+	if *out == "" {
+		*out = *in
+	}
+
+	key, err := loadValidatorKey(*keyFile)
+	if err != nil {
+		log.Fatalf("Failed to load validator key: %v", err)
+	}
+	if len(key.PrivateKey) != ed25519.PrivateKeySize {
+		log.Fatal("Validator key cannot sign")
+	}
+
+	data, err := os.ReadFile(*in)
+	if err != nil {
+		log.Fatalf("Failed to read transaction: %v", err)
+	}
+	var tx types.Transaction
+	if err := json.Unmarshal(data, &tx); err != nil {
+		log.Fatalf("Failed to decode transaction: %v", err)
+	}
+	if tx.Treasury == nil {
+		log.Fatal("Not a treasury spend")
+	}
+
+	amount, err := tx.OutputSum()
+	if err != nil {
+		log.Fatalf("Invalid outputs: %v", err)
+	}
+	fmt.Printf("Proposal %d: %s\n", tx.Treasury.Nonce, tx.Treasury.Proposal)
+	fmt.Printf("  Pays %d in %d outputs\n", amount, len(tx.Outputs))
+
+	sigHash := types.TreasurySigningHash(*chainID, tx.PrefixHash())
+	approval := types.TreasuryApproval{Validator: key.PublicKey}
+	copy(approval.Signature[:], ed25519.Sign(key.PrivateKey, sigHash[:]))
+
+	// Signing again replaces this validator's earlier approval
+	approvals := make([]types.TreasuryApproval, 0, len(tx.Treasury.Approvals)+1)
+	for _, a := range tx.Treasury.Approvals {
+		if a.Validator != key.PublicKey {
+			approvals = append(approvals, a)
+		}
+	}
+	tx.Treasury.Approvals = append(approvals, approval)
+
+	data, err = json.MarshalIndent(&tx, "", "  ")
+	if err != nil {
+		log.Fatalf("Failed to encode transaction: %v", err)
+	}
+	if err := writeOutput(*out, data); err != nil {
+		log.Fatalf("Failed to write transaction: %v", err)
+	}
+	fmt.Printf("Approved by %s (%d approvals)\n", key.PublicKey, len(tx.Treasury.Approvals))
+	printResult(map[string]interface{}{
+		"file":      *out,
+		"proposal":  tx.Treasury.Nonce,
+		"amount":    amount,
+		"validator": key.PublicKey.String(),
+		"approvals": len(tx.Treasury.Approvals),
+	})
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"blockchain/ledger"
+	"blockchain/rpc"
+	"blockchain/types"
+)
+
+// Defaults and bounds of the validatorStatus admin method
+const (
+	defaultStatusBlocks = 100
+	maxStatusBlocks     = 10000
+	defaultStatusSlots  = 100
+	maxStatusSlots      = 1000
+)
+
+// validatorParticipation counts what a validator did over recent blocks
+type validatorParticipation struct {
+	Blocks   uint64 `json:"blocks"`   // Blocks looked at, ending at the tip
+	Proposed uint64 `json:"proposed"` // Of those, proposed by the validator
+	Signed   uint64 `json:"signed"`   // Of those, with its vote in the certificate
+	Rewards  uint64 `json:"rewards"`  // Coinbase amounts of the blocks it proposed
+}
+
+// upcomingProposal is a height the validator proposes in round 0 if the
+// validator set does not change first
+type upcomingProposal struct {
+	Height   uint64    `json:"height"`
+	Expected time.Time `json:"expected"` // Assuming one block per slot
+}
+
+// validatorStatusReport is the result of the validatorStatus admin
+// method
+type validatorStatusReport struct {
+	Validator      types.PublicKey        `json:"validator"`
+	Height         uint64                 `json:"height"`
+	Status         string                 `json:"status"` // active, queued, jailed, inactive or unstaked
+	StakedAmount   uint64                 `json:"staked_amount"`
+	SelfBond       uint64                 `json:"self_bond"`
+	Commission     uint32                 `json:"commission"` // Basis points
+	SlashCount     uint32                 `json:"slash_count"`
+	JailedUntil    uint64                 `json:"jailed_until,omitempty"`
+	UnbondingUntil uint64                 `json:"unbonding_until,omitempty"`
+	MissedBlocks   uint64                 `json:"missed_blocks"` // Over the liveness window
+	MaxMissed      uint64                 `json:"max_missed"`    // Missed votes before it is jailed
+	Window         uint64                 `json:"window"`
+	Recent         validatorParticipation `json:"recent"`
+	NextProposals  []upcomingProposal     `json:"next_proposals"`
+}
+
+// rpcValidatorStatus reports on this node's validator: its stake and
+// standing, what it did over the last blocks, and when it is next due
+// to propose within the next slots heights
+func (n *Node) rpcValidatorStatus(params json.RawMessage) (interface{}, error) {
+	var req struct {
+		Blocks uint64 `json:"blocks"`
+		Slots  uint64 `json:"slots"`
+	}
+	if len(params) > 0 && string(params) != "null" {
+		if err := rpc.DecodeParams(params, &req); err != nil {
+			return nil, err
+		}
+	}
+	if req.Blocks == 0 {
+		req.Blocks = defaultStatusBlocks
+	}
+	if req.Slots == 0 {
+		req.Slots = defaultStatusSlots
+	}
+	if req.Blocks > maxStatusBlocks || req.Slots > maxStatusSlots {
+		return nil, rpc.InvalidParams(fmt.Errorf("at most %d blocks and %d slots", maxStatusBlocks, maxStatusSlots))
+	}
+	if !n.isValidator {
+		return nil, errors.New("node is not running as a validator (-validator)")
+	}
+
+	return n.validatorStatus(req.Blocks, req.Slots)
+}
+
+// validatorStatus builds the validatorStatus report
+func (n *Node) validatorStatus(blocks, slots uint64) (*validatorStatusReport, error) {
+	state := n.state.View()
+	liveness := state.Liveness()
+	report := &validatorStatusReport{
+		Validator:     n.validatorPub,
+		Height:        state.GetHeight(),
+		Status:        "unstaked",
+		MaxMissed:     liveness.MaxMissed(),
+		Window:        liveness.Window(),
+		NextProposals: []upcomingProposal{},
+	}
+
+	val, err := state.GetValidator(n.validatorPub)
+	switch {
+	case err == nil:
+		report.Status = validatorStatus(val)
+		report.StakedAmount = val.StakedAmount
+		report.SelfBond = val.SelfBond
+		report.Commission = val.Commission
+		report.SlashCount = val.SlashCount
+		report.JailedUntil = val.JailedUntil
+		report.UnbondingUntil = val.UnbondingUntil
+		report.MissedBlocks = val.MissedCount
+	case !errors.Is(err, ledger.ErrValidatorNotFound):
+		return nil, err
+	}
+
+	recent, err := n.recentParticipation(report.Height, blocks)
+	if err != nil {
+		return nil, err
+	}
+	report.Recent = recent
+
+	// Heights are expected one slot apart from the next slot on
+	nextSlot := n.slots.NextSlotStart(n.adjustedNow())
+	for height := report.Height + 1; height <= report.Height+slots; height++ {
+		proposer, err := n.consensus.SelectProposer(height, 0)
+		if err != nil {
+			break // No proposers until the set changes
+		}
+		if proposer == n.validatorPub {
+			report.NextProposals = append(report.NextProposals, upcomingProposal{
+				Height:   height,
+				Expected: nextSlot.Add(time.Duration(height-report.Height-1) * n.slots.Duration).UTC(),
+			})
+		}
+	}
+
+	return report, nil
+}
+
+// recentParticipation counts this validator's proposals, votes and
+// rewards over up to count blocks ending at tip
+func (n *Node) recentParticipation(tip, count uint64) (validatorParticipation, error) {
+	var p validatorParticipation
+	for height := tip; height > 0 && p.Blocks < count; height-- {
+		block, err := n.db.GetBlock(height)
+		if err != nil {
+			return p, notFound(err, fmt.Sprintf("block %d", height))
+		}
+		p.Blocks++
+
+		if block.Header.Proposer == n.validatorPub {
+			p.Proposed++
+			if len(block.Transactions) > 0 && block.Transactions[0].IsCoinbase() {
+				reward, err := block.Transactions[0].OutputSum()
+				if err != nil {
+					return p, err
+				}
+				p.Rewards += reward
+			}
+		}
+		for _, vote := range block.Validators {
+			if vote.Validator == n.validatorPub {
+				p.Signed++
+				break
+			}
+		}
+	}
+	return p, nil
+}
+
+// validatorCommand runs a validator subcommand against a running node
+func validatorCommand(args []string) {
+	if len(args) == 0 || args[0] != "status" {
+		usageFatal("Usage: node validator status [-rpc <url>] [-datadir <dir>] [-blocks <n>] [-slots <n>]")
+	}
+	validatorStatusCommand(args[1:])
+}
+
+// validatorStatusCommand prints the validatorStatus report of a running
+// validator node
+func validatorStatusCommand(args []string) {
+	fs := flag.NewFlagSet("validator status", flag.ExitOnError)
+	rpcURL := fs.String("rpc", "http://127.0.0.1:9100", "RPC URL of the node")
+	dataDir := fs.String("datadir", "./data", "Data directory of the node, for its admin token")
+	tokenFile := fs.String("admin-token-file", "", "Admin RPC token file (default <datadir>/admin.token)")
+	blocks := fs.Uint64("blocks", defaultStatusBlocks, "Recent blocks to count proposals, votes and rewards over")
+	slots := fs.Uint64("slots", defaultStatusSlots, "Upcoming heights to look for proposal slots in")
+	addOutputFlags(fs)
+	fs.Parse(args)
+	setupOutput()
+
+	if *tokenFile == "" {
+		*tokenFile = *dataDir + "/admin.token"
+	}
+	token, err := os.ReadFile(*tokenFile)
+	if err != nil {
+		log.Fatalf("Failed to read admin token: %v", err)
+	}
+
+	client := rpc.NewClient(*rpcURL)
+	client.SetAuthToken(strings.TrimSpace(string(token)))
+
+	var report validatorStatusReport
+	params := map[string]uint64{"blocks": *blocks, "slots": *slots}
+	if err := client.Call("validatorStatus", params, &report); err != nil {
+		log.Fatalf("Failed to get validator status: %v", err)
+	}
+
+	fmt.Printf("Validator:  %s\n", report.Validator)
+	fmt.Printf("Status:     %s at height %d\n", report.Status, report.Height)
+	fmt.Printf("Stake:      %d (self-bonded %d), commission %.2f%%\n",
+		report.StakedAmount, report.SelfBond, float64(report.Commission)/100)
+	if report.Status == "jailed" {
+		fmt.Printf("Jailed:     until height %d\n", report.JailedUntil)
+	}
+	if report.UnbondingUntil > report.Height {
+		fmt.Printf("Unbonding:  until height %d\n", report.UnbondingUntil)
+	}
+	fmt.Printf("Slashed:    %d times\n", report.SlashCount)
+	fmt.Printf("Missed:     %d of the last %d votes (jailed after %d)\n", report.MissedBlocks, report.Window, report.MaxMissed)
+	fmt.Printf("Last %d blocks: proposed %d, signed %d, rewards %d\n",
+		report.Recent.Blocks, report.Recent.Proposed, report.Recent.Signed, report.Recent.Rewards)
+	if len(report.NextProposals) == 0 {
+		fmt.Printf("No proposal slots in the next %d heights\n", *slots)
+	}
+	for _, p := range report.NextProposals {
+		fmt.Printf("Proposes:   height %d, about %s\n", p.Height, p.Expected.Local().Format(time.RFC3339))
+	}
+
+	printResult(report)
+}
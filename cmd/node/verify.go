@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"blockchain/consensus"
+	"blockchain/ledger"
+	"blockchain/storage"
+	"blockchain/types"
+)
+
+// verifyProgressInterval is how often verify reports progress, in blocks
+const verifyProgressInterval = 1000
+
+// verifyChain re-validates the stored chain without networking and
+// reports the first inconsistency. The node must be stopped first.
+func verifyChain(args []string) {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	dataDir := fs.String("datadir", "./data", "Data directory")
+	from := fs.Uint64("from", 0, "First height to fully validate")
+	to := fs.Uint64("to", 0, "Last height to validate (0 for the latest block)")
+	addOutputFlags(fs)
+	fs.Parse(args)
+	setupOutput()
+
+	db, err := storage.OpenReadOnly(*dataDir + "/blockchain.db")
+	if err != nil {
+		log.Fatalf("Failed to open database (is the node still running?): %v", err)
+	}
+	defer db.Close()
+
+	first := max(*from, 1)
+	last, err := verifyBlocks(db, *from, *to)
+	if err != nil {
+		fmt.Printf("Verification FAILED: %v\n", err)
+		printResult(map[string]interface{}{"valid": false, "error": err.Error(), "last_valid": last})
+		db.Close()
+		os.Exit(exitFailure)
+	}
+
+	if last >= first {
+		fmt.Printf("Verified blocks %d to %d\n", first, last)
+	} else {
+		fmt.Println("No blocks to verify")
+	}
+	printResult(map[string]interface{}{"valid": true, "from": first, "to": last})
+}
+
+// verifyBlocks replays the chain from genesis up to height to. Blocks
+// from height from on get the checks of a newly received block, plus
+// their database indexes; earlier blocks are only applied to rebuild
+// state. It returns the last height verified.
+func verifyBlocks(db *storage.Database, from, to uint64) (uint64, error) {
+	genesis, err := db.GetGenesis()
+	if err != nil {
+		return 0, fmt.Errorf("no genesis in database: %w", err)
+	}
+
+	latest, err := db.GetLatestHeight()
+	if err != nil {
+		return 0, err
+	}
+	if to == 0 {
+		to = latest
+	}
+	if to > latest {
+		return 0, fmt.Errorf("height %d is above the latest block %d", to, latest)
+	}
+	if from > to {
+		return 0, fmt.Errorf("-from %d is above -to %d", from, to)
+	}
+
+	state := ledger.NewState()
+	if err := state.InitializeGenesis(genesis); err != nil {
+		return 0, err
+	}
+
+	engine := consensus.NewEngine(state, nil, types.PublicKey{})
+	engine.SetBlockProvider(db.GetBlock)
+	if err := engine.UpdateValidatorSet(); err != nil {
+		return 0, err
+	}
+
+	// Block 1 builds on the stored genesis block, if there is one
+	prev, _ := db.GetBlock(0)
+
+	for height := uint64(1); height <= to; height++ {
+		block, err := db.GetBlock(height)
+		if err != nil {
+			return height - 1, fmt.Errorf("block %d: failed to load: %w", height, err)
+		}
+
+		if height >= from {
+			if err := verifyBlock(db, engine, block, prev, height); err != nil {
+				return height - 1, fmt.Errorf("block %d: %w", height, err)
+			}
+		}
+
+		if err := state.ApplyBlock(block); err != nil {
+			return height - 1, fmt.Errorf("block %d: failed to apply: %w", height, err)
+		}
+		if err := engine.UpdateValidatorSet(); err != nil {
+			return height - 1, fmt.Errorf("block %d: failed to update validator set: %w", height, err)
+		}
+
+		if height%verifyProgressInterval == 0 {
+			fmt.Printf("At block %d of %d\n", height, to)
+		}
+		prev = block
+	}
+
+	return to, nil
+}
+
+// verifyBlock checks one stored block against the state of its parent
+func verifyBlock(db *storage.Database, engine *consensus.Engine, block, prev *types.Block, height uint64) error {
+	if block.Header.Height != height {
+		return fmt.Errorf("stored under height %d but has height %d", height, block.Header.Height)
+	}
+	if prev == nil {
+		return errors.New("no parent block stored")
+	}
+
+	// Certificate, heights, hashes, roots, timestamps, proposer,
+	// transaction signatures, amounts and double spends
+	if err := engine.ValidateBlock(block, prev); err != nil {
+		return err
+	}
+
+	// The hash and transaction indexes must point back at this block
+	byHash, err := db.GetBlockByHash(block.Header.Hash())
+	if err != nil {
+		return fmt.Errorf("missing from hash index: %w", err)
+	}
+	if byHash.Header.Height != height {
+		return fmt.Errorf("hash index points at height %d", byHash.Header.Height)
+	}
+	for _, tx := range block.Transactions {
+		if _, err := db.GetTransaction(tx.Hash()); err != nil {
+			return fmt.Errorf("transaction %s missing from index: %w", tx.Hash(), err)
+		}
+	}
+
+	return nil
+}
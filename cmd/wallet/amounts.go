@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strconv"
+
+	"blockchain/types"
+	"blockchain/wallet"
+)
+
+// denom is how the chain writes amounts, nil until looked up
+var denom *types.Denomination
+
+// denomination returns how the chain writes amounts: as saved in the
+// wallet metadata, or else as the node reports it. It returns nil if
+// neither is available, for offline wallets that never synced, which
+// then read and print amounts in base units.
+func denomination() *types.Denomination {
+	if denom != nil {
+		return denom
+	}
+
+	if meta, err := loadMetadata(); err == nil && meta.Denomination != nil {
+		denom = meta.Denomination
+		return denom
+	}
+
+	chain, closeChain, err := openChain()
+	if err != nil {
+		return nil
+	}
+	defer closeChain()
+	if reader, ok := chain.(wallet.DenominationReader); ok {
+		if d, err := reader.GetDenomination(); err == nil {
+			denom = &d
+		}
+	}
+	return denom
+}
+
+// rememberDenomination saves the chain's denomination in meta, so
+// commands run offline later can still write amounts in coins
+func rememberDenomination(meta *wallet.Metadata, chain wallet.ChainReader) {
+	if meta.Denomination != nil {
+		return
+	}
+	if reader, ok := chain.(wallet.DenominationReader); ok {
+		if d, err := reader.GetDenomination(); err == nil {
+			meta.Denomination = &d
+			denom = &d
+		}
+	}
+}
+
+// formatAmount writes an amount of base units in coins
+func formatAmount(amount uint64) string {
+	d := denomination()
+	if d == nil {
+		return strconv.FormatUint(amount, 10)
+	}
+	return d.Format(amount)
+}
+
+// parseAmount reads an amount given in coins, or in base units while the
+// denomination is unknown
+func parseAmount(s string) (uint64, error) {
+	d := denomination()
+	if d == nil {
+		return types.Denomination{}.Parse(s)
+	}
+	return d.Parse(s)
+}
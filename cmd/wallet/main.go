@@ -3,270 +3,2850 @@ package main
 import (
 	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
 	
 	"blockchain/crypto"
+	"blockchain/notify"
+	"blockchain/rpc"
+	"blockchain/storage"
 	"blockchain/types"
+	"blockchain/wallet"
+)
+
+var (
+	walletFile = flag.String("wallet", wallet.DefaultFile, "Wallet file path")
+	networkArg = flag.String("network", "", "Network of the wallet: mainnet or testnet (default: the wallet file's, or testnet for a new wallet)")
+	dataDir    = flag.String("datadir", "./data", "Node data directory to scan")
+	nodeURL    = flag.String("node", "", "Node RPC URL (e.g. http://127.0.0.1:9100); overrides -datadir")
+	msigFile   = flag.String("multisig", wallet.DefaultMultisigFile, "Multisig wallet file path")
+	proxyAddr  = flag.String("proxy", "", "SOCKS5 proxy for node RPC connections (e.g. 127.0.0.1:9050 for Tor)")
+	accountArg = flag.String("account", "", "Account label or index (default: the primary account)")
+	remoteScan = flag.Bool("remote-scan", false, "Let the node scan for this wallet using its view key (the node learns incoming payments)")
+	filterSync = flag.Bool("filter-sync", false, "Download compact block filters and only the blocks that match, keeping the view key private")
+	rescanFrom = flag.Int64("rescan-from", -1, "Rescan from this height instead of the saved scan checkpoint")
 )
 
 func main() {
-	if len(os.Args) < 2 {
+	flag.Usage = printUsage
+	flag.Parse()
+	setupOutput()
+	
+	args := flag.Args()
+	if len(args) < 1 {
 		printUsage()
-		os.Exit(1)
+		usageExit()
 	}
 	
-	command := os.Args[1]
+	command := args[0]
+	args = args[1:]
 	
 	switch command {
 	case "generate":
 		generateWallet()
 	case "address":
 		showAddress()
+	case "export-viewkey":
+		exportViewKey(args)
+	case "export-key-images":
+		exportKeyImages(args)
+	case "import-key-images":
+		importKeyImages(args)
+	case "forget-remote-scan":
+		forgetRemoteScan()
+	case "integrated-address":
+		integratedAddress(args)
 	case "send":
-		sendTransaction()
+		sendTransaction(args)
+	case "burn":
+		burnCoins(args)
+	case "create-unsigned":
+		createUnsigned(args)
+	case "construction-data":
+		fetchConstructionData(args)
+	case "build-offline":
+		buildOffline(args)
+	case "sign":
+		signTransaction(args)
+	case "submit":
+		submitTransaction(args)
+	case "sponsor":
+		sponsorTransaction(args)
 	case "balance":
 		queryBalance()
+	case "scan":
+		scanOutputs(args)
 	case "stake":
-		stakeTokens()
+		stakeTokens(args)
+	case "set-commission":
+		setCommission(args)
+	case "unjail":
+		unjailValidator(args)
+	case "unbond":
+		unbondValidator(args)
+	case "release":
+		releaseStake()
+	case "submit-staking":
+		submitStaking(args)
+	case "get-tx-key":
+		getTxKey(args)
+	case "prove":
+		proveTransaction(args)
+	case "verify-proof":
+		verifyProof(args)
+	case "serve":
+		serveWallet(args)
+	case "utxos":
+		utxosCommand(args)
+	case "contacts":
+		contactsCommand(args)
+	case "history":
+		showHistory(args)
+	case "multisig":
+		multisigCommand(args)
+	case "accounts":
+		accountsCommand(args)
+	case "settings":
+		settingsCommand(args)
+	case "swap":
+		swapCommand(args)
+	case "shell":
+		walletShell(args)
 	default:
 		fmt.Printf("Unknown command: %s\n", command)
 		printUsage()
-		os.Exit(1)
+		usageExit()
 	}
 }
 
 func printUsage() {
-	fmt.Println("Usage:")
-	fmt.Println("  wallet generate              - Generate new wallet keys")
+	fmt.Println("Usage: wallet [-wallet file] [-network name] [-account name] [-datadir dir | -node url [-proxy addr]] [-remote-scan | -filter-sync] [-rescan-from height] [-json] [-quiet] <command>")
+	fmt.Println()
+	fmt.Println("With -json, commands print their result as JSON on stdout and errors as {\"error\": ...}")
+	fmt.Println("on stderr. Exit status is 0 on success, 1 on failure and 2 on usage errors.")
+	fmt.Println("Amounts are in coins (e.g. 1.5 or \"1.5 APEX\"); -fee flags are in base units.")
+	fmt.Println("Wallets belong to mainnet or testnet (-network), whose addresses start apex: and tapex:;")
+	fmt.Println("they refuse addresses and nodes of the other network.")
+	fmt.Println()
+	fmt.Println("Commands:")
+	fmt.Println("  wallet generate              - Generate new wallet keys (for -network, default testnet)")
 	fmt.Println("  wallet address               - Show wallet address")
-	fmt.Println("  wallet send <to> <amount>    - Send private transaction")
+	fmt.Println("  wallet export-viewkey [file] - Export a view-only (watch) wallet")
+	fmt.Println("  wallet export-key-images [file]")
+	fmt.Println("                               - Export key images for a view-only wallet")
+	fmt.Println("  wallet import-key-images <file>")
+	fmt.Println("                               - Import key images so spent outputs are detected")
+	fmt.Println("  wallet -node <url> forget-remote-scan")
+	fmt.Println("                               - Remove the view key from the node's scanning service")
+	fmt.Println("  wallet integrated-address [payment_id]")
+	fmt.Println("                               - Address with embedded payment ID")
+	fmt.Println("  wallet send [-payment-id id] [-memo text] [-from-utxo ref] <to> <amount>")
+	fmt.Println("                               - Send private transaction")
+	fmt.Println("  wallet burn [-from-utxo ref] <amount>")
+	fmt.Println("                               - Destroy coins in a provably unspendable output")
+	fmt.Println("  wallet create-unsigned [-payment-id id] [-memo text] [-from-utxo ref] [-sponsored] <to> <amount> [file]")
+	fmt.Println("                               - Build an unsigned transaction (online)")
+	fmt.Println("  wallet construction-data [-cover n] [-decoys n] [-out file] <ref>...")
+	fmt.Println("                               - Fetch outputs, decoys and fees to build offline (online)")
+	fmt.Println("  wallet build-offline [-payment-id id] [-memo text] [-fee n] <data> <ref> <to> <amount> [file]")
+	fmt.Println("                               - Build an unsigned transaction from construction data")
+	fmt.Println("  wallet sign <unsigned> [out] - Sign an unsigned transaction (offline)")
+	fmt.Println("  wallet submit <signed>       - Broadcast a signed transaction (online)")
+	fmt.Println("  wallet sponsor [-max-fee n] <signed> [out]")
+	fmt.Println("                               - Pay the fee of someone else's sponsored transaction")
 	fmt.Println("  wallet balance               - Query wallet balance")
-	fmt.Println("  wallet stake <amount>        - Stake tokens as validator")
+	fmt.Println("  wallet scan [from_height]    - List outputs belonging to this wallet")
+	fmt.Println("  wallet stake [-nonce n] <amount> [commission_bps]")
+	fmt.Println("                               - Burn tokens to bond them as validator stake")
+	fmt.Println("  wallet set-commission [-nonce n] <bps>")
+	fmt.Println("                               - Change the validator commission rate")
+	fmt.Println("  wallet unjail [-nonce n]     - Rejoin the validator set after downtime jailing")
+	fmt.Println("  wallet unbond [-nonce n]     - Leave the validator set and start unbonding the stake")
+	fmt.Println("  wallet -node <url> release   - Pay the stake back to the wallet once unbonding ends")
+	fmt.Println("  wallet submit-staking <file> - Broadcast a saved staking transaction (online)")
+	fmt.Println("  wallet get-tx-key <txhash>   - Export the tx keys of a sent transaction")
+	fmt.Println("  wallet prove <txhash> <address> [file]")
+	fmt.Println("                               - Prove a payment to an address")
+	fmt.Println("  wallet verify-proof <file>   - Verify a payment proof against the chain")
+	fmt.Println("  wallet history [from_height] - List incoming and outgoing transactions")
+	fmt.Println("  wallet -node <url> serve [-listen addr] [-token-file file]")
+	fmt.Println("                               - Run the wallet daemon with an authenticated API")
+	fmt.Println("  wallet shell [-lock-after d] - Interactive session; locks after 5m without input")
+	fmt.Println()
+	fmt.Println("Coin control (outputs are referenced as <tx_hash>:<index>):")
+	fmt.Println("  wallet utxos list [-all]                       - List unspent outputs")
+	fmt.Println("  wallet utxos freeze <ref>                      - Exclude an output from selection")
+	fmt.Println("  wallet utxos unfreeze <ref>                    - Make a frozen output selectable")
+	fmt.Println()
+	fmt.Println("Accounts (separate balances in one wallet; select with -account):")
+	fmt.Println("  wallet accounts list                           - List accounts and balances")
+	fmt.Println("  wallet accounts new <label>                    - Create an account")
+	fmt.Println("  wallet accounts rename <account> <label>       - Change an account label")
+	fmt.Println("  wallet accounts addresses                      - List the account's subaddresses")
+	fmt.Println("  wallet accounts new-address                    - Create a subaddress in the account")
+	fmt.Println()
+	fmt.Println("Address book (labels can be used in place of addresses):")
+	fmt.Println("  wallet contacts add <label> <address>          - Save a labeled address")
+	fmt.Println("  wallet contacts list                           - List saved addresses")
+	fmt.Println("  wallet contacts remove <label>                 - Delete a saved address")
+	fmt.Println()
+	fmt.Println("Atomic swaps (hashed timelock contracts):")
+	fmt.Println("  wallet swap key                                - Create a swap key for a counterparty")
+	fmt.Println("  wallet swap initiate [-timeout n] <key> <amount>")
+	fmt.Println("                                                 - Lock coins to a new secret")
+	fmt.Println("  wallet swap participate [-timeout n] <key> <hash> <amount>")
+	fmt.Println("                                                 - Lock coins to the initiator's hash")
+	fmt.Println("  wallet swap inspect <ref>                      - Show a contract and any revealed secret")
+	fmt.Println("  wallet swap redeem <ref> [secret]              - Claim a contract with its secret")
+	fmt.Println("  wallet swap refund <ref>                       - Take back a contract after its timeout")
+	fmt.Println()
+	fmt.Println("Output settings (how sends lay out their outputs and sweep dust):")
+	fmt.Println("  wallet settings                                - Show settings")
+	fmt.Println("  wallet settings set <name> <value>             - Change split-outputs, always-change,")
+	fmt.Println("                                                   shuffle-outputs, sweep-below or")
+	fmt.Println("                                                   sweep-max-fee (base units)")
+	fmt.Println()
+	fmt.Println("Multisig commands (M-of-N wallets):")
+	fmt.Println("  wallet multisig export [file]                  - Export setup info to share")
+	fmt.Println("  wallet multisig import -threshold M <info>...  - Create the multisig wallet")
+	fmt.Println("  wallet multisig address                        - Show multisig address")
+	fmt.Println("  wallet multisig balance                        - Query multisig balance")
+	fmt.Println("  wallet multisig transfer <to> <amount> [file]  - Create and co-sign a spend")
+	fmt.Println("  wallet multisig sign <file>                    - Add your signature to a spend")
 }
 
 func generateWallet() {
 	// Generate wallet keys
-	wallet, err := crypto.GenerateWalletKeys()
+	keys, err := crypto.GenerateWalletKeys()
 	if err != nil {
 		log.Fatalf("Failed to generate wallet: %v", err)
 	}
 	
 	// Save to file
-	data, err := json.MarshalIndent(wallet, "", "  ")
-	if err != nil {
-		log.Fatalf("Failed to marshal wallet: %v", err)
-	}
-	
-	filename := "wallet.json"
-	if err := os.WriteFile(filename, data, 0600); err != nil {
+	filename := *walletFile
+	network := flagNetwork()
+	if err := wallet.Save(filename, keys, network); err != nil {
 		log.Fatalf("Failed to save wallet: %v", err)
 	}
 	
 	// Show address
-	addr := wallet.GetAddress()
+	addr := keys.GetAddress()
 	fmt.Println("Wallet generated successfully!")
 	fmt.Println("Saved to:", filename)
+	fmt.Println("Network: ", network)
 	fmt.Println()
 	fmt.Println("Your stealth address:")
 	fmt.Println("  View Key: ", hex.EncodeToString(addr.ViewKey[:]))
 	fmt.Println("  Spend Key:", hex.EncodeToString(addr.SpendKey[:]))
 	fmt.Println()
 	fmt.Println("⚠️  KEEP YOUR WALLET FILE SECURE!")
+	
+	printResult(map[string]string{
+		"file":      filename,
+		"network":   string(network),
+		"address":   wallet.FormatAddress(network, addr),
+		"view_key":  hex.EncodeToString(addr.ViewKey[:]),
+		"spend_key": hex.EncodeToString(addr.SpendKey[:]),
+	})
 }
 
 func showAddress() {
-	wallet, err := loadWallet()
+	keys, err := loadWallet()
 	if err != nil {
 		log.Fatalf("Failed to load wallet: %v", err)
 	}
 	
-	addr := wallet.GetAddress()
+	account := selectedAccount()
+	addr := wallet.SubaddressAddress(keys, wallet.SubaddressIndex{Account: account.Index})
+	if account.Index != wallet.PrimaryAccount {
+		fmt.Printf("Account: %s (%d)\n", account.Label, account.Index)
+	}
 	fmt.Println("Your stealth address:")
 	fmt.Println("  View Key: ", hex.EncodeToString(addr.ViewKey[:]))
 	fmt.Println("  Spend Key:", hex.EncodeToString(addr.SpendKey[:]))
+	fmt.Println()
+	fmt.Println("  Address:", wallet.FormatAddress(walletNetwork(), addr))
+	if !keys.CanSpend() {
+		fmt.Println()
+		fmt.Println("This is a view-only wallet")
+	}
+	
+	printResult(map[string]interface{}{
+		"address":   wallet.FormatAddress(walletNetwork(), addr),
+		"network":   string(walletNetwork()),
+		"view_key":  hex.EncodeToString(addr.ViewKey[:]),
+		"spend_key": hex.EncodeToString(addr.SpendKey[:]),
+		"account":   account.Index,
+		"view_only": !keys.CanSpend(),
+	})
+}
+
+func exportViewKey(args []string) {
+	filename := "wallet_viewonly.json"
+	if len(args) > 0 {
+		filename = args[0]
+	}
+	
+	keys, err := loadWallet()
+	if err != nil {
+		log.Fatalf("Failed to load wallet: %v", err)
+	}
+	
+	if err := wallet.Save(filename, keys.ViewOnly(), walletNetwork()); err != nil {
+		log.Fatalf("Failed to save view-only wallet: %v", err)
+	}
+	
+	fmt.Println("View-only wallet exported to:", filename)
+	fmt.Println()
+	fmt.Println("This file can scan incoming outputs and compute balances")
+	fmt.Println("but cannot spend funds. Use it with: wallet -wallet", filename, "balance")
+	
+	printResult(map[string]string{"file": filename})
+}
+
+// exportKeyImages writes the key images of all the wallet's outputs, so
+// a view-only copy can tell which were spent
+func exportKeyImages(args []string) {
+	filename := "key_images.json"
+	if len(args) > 0 {
+		filename = args[0]
+	}
+	
+	keys, err := loadWallet()
+	if err != nil {
+		log.Fatalf("Failed to load wallet: %v", err)
+	}
+	meta, err := loadMetadata()
+	if err != nil {
+		log.Fatalf("Failed to load wallet metadata: %v", err)
+	}
+	
+	result, err := syncChain(keys, meta)
+	if err != nil {
+		log.Fatalf("Failed to scan blockchain: %v", err)
+	}
+	export, err := wallet.ExportKeyImages(result)
+	if err != nil {
+		log.Fatalf("Failed to export key images: %v", err)
+	}
+	if err := writeJSON(filename, export); err != nil {
+		log.Fatalf("Failed to save key images: %v", err)
+	}
+	
+	fmt.Printf("Exported %d key images to %s\n", len(export.KeyImages), filename)
+	fmt.Println()
+	fmt.Println("Key images reveal which outputs are spent; share them only with your own view-only wallet.")
+	fmt.Println("Import them with: wallet -wallet <view-only file> import-key-images", filename)
+	
+	printResult(map[string]interface{}{"file": filename, "key_images": len(export.KeyImages)})
+}
+
+// importKeyImages stores key images exported by the full wallet
+func importKeyImages(args []string) {
+	if len(args) < 1 {
+		fmt.Println("Usage: wallet import-key-images <file>")
+		usageExit()
+	}
+	
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		log.Fatalf("Failed to read key images: %v", err)
+	}
+	var export wallet.KeyImageExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		log.Fatalf("Invalid key image file: %v", err)
+	}
+	
+	meta, err := loadMetadata()
+	if err != nil {
+		log.Fatalf("Failed to load wallet metadata: %v", err)
+	}
+	count, err := meta.ImportKeyImages(&export)
+	if err != nil {
+		log.Fatalf("Failed to import key images: %v", err)
+	}
+	if err := meta.Save(); err != nil {
+		log.Fatalf("Failed to save wallet metadata: %v", err)
+	}
+	
+	fmt.Printf("Imported %d key images\n", count)
+	fmt.Println("Spent outputs are now excluded from balance and utxos.")
+	
+	printResult(map[string]int{"imported": count})
 }
 
-func sendTransaction() {
-	if len(os.Args) < 4 {
-		fmt.Println("Usage: wallet send <recipient_address> <amount>")
-		os.Exit(1)
+// forgetRemoteScan unregisters the wallet from the node's scanning
+// service, which then drops its view key
+func forgetRemoteScan() {
+	if *nodeURL == "" {
+		log.Fatalf("Remote scanning needs a node connection (-node <url>)")
 	}
+	meta, err := loadMetadata()
+	if err != nil {
+		log.Fatalf("Failed to load wallet metadata: %v", err)
+	}
+	
+	reg, ok := meta.RemoteScans[*nodeURL]
+	if !ok {
+		fmt.Println("The wallet is not registered with this node.")
+		printResult(map[string]bool{"unregistered": false})
+		return
+	}
+	if err := remoteChain().UnregisterScan(reg.Token); err != nil && !wallet.IsUnknownScanToken(err) {
+		log.Fatalf("Failed to unregister: %v", err)
+	}
+	delete(meta.RemoteScans, *nodeURL)
+	if err := meta.Save(); err != nil {
+		log.Fatalf("Failed to save wallet metadata: %v", err)
+	}
+	
+	fmt.Println("The node no longer holds this wallet's view key.")
+	
+	printResult(map[string]bool{"unregistered": true})
+}
+
+func integratedAddress(args []string) {
+	keys, err := loadWallet()
+	if err != nil {
+		log.Fatalf("Failed to load wallet: %v", err)
+	}
+	
+	var pid types.PaymentID
+	if len(args) > 0 {
+		pid, err = wallet.ParsePaymentID(args[0])
+	} else {
+		pid, err = wallet.NewPaymentID()
+	}
+	if err != nil {
+		log.Fatalf("Failed to get payment ID: %v", err)
+	}
+	
+	addr := wallet.SubaddressAddress(keys, wallet.SubaddressIndex{Account: selectedAccount().Index})
+	fmt.Println("Payment ID:", pid)
+	fmt.Println("Integrated address:")
+	fmt.Println(" ", wallet.FormatIntegratedAddress(walletNetwork(), addr, pid))
 	
-	recipientStr := os.Args[2]
-	amountStr := os.Args[3]
+	printResult(map[string]string{
+		"address":    wallet.FormatIntegratedAddress(walletNetwork(), addr, pid),
+		"payment_id": pid.String(),
+	})
+}
+
+func sendTransaction(args []string) {
+	fs := flag.NewFlagSet("send", flag.ExitOnError)
+	paymentIDStr := fs.String("payment-id", "", "Payment ID to attach (hex, 8 bytes)")
+	memo := fs.String("memo", "", "Memo encrypted to the recipient (costs extra fee per byte)")
+	fromUTXO := fs.String("from-utxo", "", "Spend this output (<tx_hash>:<index>) instead of selecting one")
+	fs.Parse(args)
+	args = fs.Args()
 	
-	// Parse amount
-	var amount uint64
-	fmt.Sscanf(amountStr, "%d", &amount)
+	if len(args) < 2 {
+		fmt.Println("Usage: wallet send [-payment-id id] [-memo text] [-from-utxo ref] <recipient_address> <amount>")
+		usageExit()
+	}
 	
-	// Parse recipient address
-	recipient, err := parseAddress(recipientStr)
+	payment, err := parsePayment(args[0], args[1], *paymentIDStr, *memo)
 	if err != nil {
-		log.Fatalf("Invalid recipient address: %v", err)
+		log.Fatalf("Invalid payment: %v", err)
 	}
 	
 	// Load wallet
-	wallet, err := loadWallet()
+	keys, err := loadWallet()
 	if err != nil {
 		log.Fatalf("Failed to load wallet: %v", err)
 	}
 	
-	// Build transaction
-	tx, err := buildPrivateTransaction(wallet, recipient, amount)
+	if !keys.CanSpend() {
+		log.Fatalf("Cannot send from a view-only wallet (use create-unsigned)")
+	}
+	
+	// Build and sign in one step
+	unsigned, sent, dust, err := buildTransaction(keys, payment, *fromUTXO, false, true)
 	if err != nil {
 		log.Fatalf("Failed to build transaction: %v", err)
 	}
 	
+	tx, err := unsigned.Sign(keys)
+	if err != nil {
+		log.Fatalf("Failed to sign transaction: %v", err)
+	}
+	if dust != nil {
+		if err := sponsorDust(keys, tx, dust); err != nil {
+			log.Fatalf("Failed to sweep dust: %v", err)
+		}
+	}
+	
+	// Keep the tx keys so the payment can be proven later
+	meta, err := loadMetadata()
+	if err != nil {
+		log.Fatalf("Failed to load wallet metadata: %v", err)
+	}
+	meta.RecordSent(tx.Hash(), sent)
+	if err := meta.Save(); err != nil {
+		log.Fatalf("Failed to save wallet metadata: %v", err)
+	}
+	
 	fmt.Println("Transaction created:")
-	fmt.Printf("  Amount: %d\n", amount)
-	fmt.Printf("  Fee: %d\n", tx.Fee)
+	fmt.Printf("  Amount: %s\n", formatAmount(payment.Amount))
+	fmt.Printf("  Fee: %s\n", formatAmount(tx.Fee))
+	if dust != nil {
+		fmt.Printf("  Swept dust: %s\n", dust.Ref())
+	}
+	if payment.PaymentID != nil {
+		fmt.Printf("  Payment ID: %s\n", payment.PaymentID)
+	}
+	if payment.Memo != nil {
+		fmt.Printf("  Memo: %q\n", payment.Memo)
+	}
 	fmt.Printf("  Hash: %s\n", tx.Hash())
 	fmt.Println()
-	fmt.Println("Broadcasting to network...")
-	
-	// TODO: Broadcast to network
-	// For Phase 1, save to file
-	txData, _ := json.MarshalIndent(tx, "", "  ")
-	txFile := fmt.Sprintf("tx_%s.json", tx.Hash().String()[:8])
-	os.WriteFile(txFile, txData, 0644)
 	
-	fmt.Printf("Transaction saved to %s\n", txFile)
-	fmt.Println("Use node to broadcast this transaction")
+	result := map[string]interface{}{"amount": payment.Amount}
+	if payment.PaymentID != nil {
+		result["payment_id"] = payment.PaymentID.String()
+	}
+	if dust != nil {
+		result["swept"] = dust.Ref()
+	}
+	submitOrSave(tx, result)
 }
 
-func queryBalance() {
-	wallet, err := loadWallet()
+// burnCoins destroys amount coins. The burn output is public, so anyone
+// can verify the coins are gone; the change stays private.
+func burnCoins(args []string) {
+	fs := flag.NewFlagSet("burn", flag.ExitOnError)
+	fromUTXO := fs.String("from-utxo", "", "Spend this output (<tx_hash>:<index>) instead of selecting one")
+	fs.Parse(args)
+	args = fs.Args()
+	
+	if len(args) < 1 {
+		fmt.Println("Usage: wallet burn [-from-utxo ref] <amount>")
+		usageExit()
+	}
+	
+	amount, err := parseAmount(args[0])
+	if err != nil || amount == 0 {
+		log.Fatalf("Invalid amount: %s", args[0])
+	}
+	
+	keys, err := loadWallet()
 	if err != nil {
 		log.Fatalf("Failed to load wallet: %v", err)
 	}
+	if !keys.CanSpend() {
+		log.Fatalf("Cannot burn from a view-only wallet")
+	}
+	
+	unsigned, _, err := buildUnsigned(keys, wallet.Payment{Amount: amount, Burn: true}, *fromUTXO, false)
+	if err != nil {
+		log.Fatalf("Failed to build transaction: %v", err)
+	}
 	
-	// TODO: Scan blockchain for owned outputs
-	// For Phase 1, this would require connecting to a node
+	tx, err := unsigned.Sign(keys)
+	if err != nil {
+		log.Fatalf("Failed to sign transaction: %v", err)
+	}
 	
-	fmt.Println("Scanning blockchain for your outputs...")
-	fmt.Println()
-	fmt.Println("Balance: 0 (scanning not yet implemented)")
+	fmt.Println("Burn transaction created:")
+	fmt.Printf("  Burned: %s\n", formatAmount(amount))
+	fmt.Printf("  Fee: %s\n", formatAmount(tx.Fee))
+	fmt.Printf("  Hash: %s\n", tx.Hash())
 	fmt.Println()
-	fmt.Println("To check balance, you need to:")
-	fmt.Println("1. Connect to a node")
-	fmt.Println("2. Scan all transaction outputs")
-	fmt.Println("3. Identify outputs belonging to your wallet")
 	
-	_ = wallet
+	submitOrSave(tx, map[string]interface{}{"burned": amount})
 }
 
-func stakeTokens() {
-	if len(os.Args) < 3 {
-		fmt.Println("Usage: wallet stake <amount>")
-		os.Exit(1)
+func createUnsigned(args []string) {
+	fs := flag.NewFlagSet("create-unsigned", flag.ExitOnError)
+	paymentIDStr := fs.String("payment-id", "", "Payment ID to attach (hex, 8 bytes)")
+	memo := fs.String("memo", "", "Memo encrypted to the recipient (costs extra fee per byte)")
+	fromUTXO := fs.String("from-utxo", "", "Spend this output (<tx_hash>:<index>) instead of selecting one")
+	sponsored := fs.Bool("sponsored", false, "Leave the fee to a sponsor (see 'wallet sponsor')")
+	fs.Parse(args)
+	args = fs.Args()
+	
+	if len(args) < 2 {
+		fmt.Println("Usage: wallet create-unsigned [-payment-id id] [-memo text] [-from-utxo ref] [-sponsored] <recipient_address> <amount> [file]")
+		usageExit()
 	}
 	
-	amountStr := os.Args[2]
+	payment, err := parsePayment(args[0], args[1], *paymentIDStr, *memo)
+	if err != nil {
+		log.Fatalf("Invalid payment: %v", err)
+	}
 	
-	var amount uint64
-	fmt.Sscanf(amountStr, "%d", &amount)
+	filename := "unsigned_tx.json"
+	if len(args) > 2 {
+		filename = args[2]
+	}
 	
-	wallet, err := loadWallet()
+	// A view-only wallet is enough to build the transaction
+	keys, err := loadWallet()
 	if err != nil {
 		log.Fatalf("Failed to load wallet: %v", err)
 	}
 	
-	// Create staking transaction
-	stakingTx := &types.StakingTx{
-		Type:      types.StakingBond,
-		Validator: wallet.SpendKeyPair.PublicKey,
-		Amount:    amount,
+	unsigned, sent, err := buildUnsigned(keys, payment, *fromUTXO, *sponsored)
+	if err != nil {
+		log.Fatalf("Failed to build transaction: %v", err)
+	}
+	
+	// The final hash is unknown until signing, so track the tx keys
+	// as pending until the signed transaction is submitted
+	meta, err := loadMetadata()
+	if err != nil {
+		log.Fatalf("Failed to load wallet metadata: %v", err)
+	}
+	meta.RecordPending(unsigned.ID(), sent)
+	if err := meta.Save(); err != nil {
+		log.Fatalf("Failed to save wallet metadata: %v", err)
 	}
 	
-	// Sign staking transaction
-	// TODO: Proper signature
+	if err := writeJSON(filename, unsigned); err != nil {
+		log.Fatalf("Failed to save unsigned transaction: %v", err)
+	}
 	
-	fmt.Println("Staking transaction created:")
-	fmt.Printf("  Validator: %s\n", stakingTx.Validator.String())
-	fmt.Printf("  Amount: %d\n", amount)
-	fmt.Println()
+	fmt.Printf("Unsigned transaction saved to %s\n", filename)
+	fmt.Println("Copy it to the offline machine and run: wallet sign", filename)
 	
-	// Save to file
-	data, _ := json.MarshalIndent(stakingTx, "", "  ")
-	filename := "staking_tx.json"
-	os.WriteFile(filename, data, 0644)
+	printResult(map[string]interface{}{"file": filename, "fee": unsigned.Fee})
+}
+
+// fetchConstructionData saves what an offline wallet needs to spend the
+// given outputs, asking the node about cover outputs too
+func fetchConstructionData(args []string) {
+	fs := flag.NewFlagSet("construction-data", flag.ExitOnError)
+	cover := fs.Int("cover", 3, "Random outputs requested alongside yours so the node cannot tell which you spend")
+	decoys := fs.Int("decoys", 0, "Decoys per ring (0 follows the network's ring size)")
+	out := fs.String("out", "construction_data.json", "Output file")
+	fs.Parse(args)
+	args = fs.Args()
 	
-	fmt.Printf("Staking transaction saved to %s\n", filename)
-	fmt.Println("Submit this to the network to become a validator")
+	if len(args) < 1 {
+		fmt.Println("Usage: wallet construction-data [-cover n] [-decoys n] [-out file] <ref>...")
+		usageExit()
+	}
+	if len(args)+*cover > wallet.MaxConstructionOutputs {
+		log.Fatalf("At most %d outputs, including cover, can be requested", wallet.MaxConstructionOutputs)
+	}
+	
+	chain, closeChain, err := openChain()
+	if err != nil {
+		log.Fatalf("Failed to open chain: %v", err)
+	}
+	defer closeChain()
+	
+	refs, err := wallet.BlindRefs(chain, args, *cover)
+	if err != nil {
+		log.Fatalf("Failed to pick cover outputs: %v", err)
+	}
+	
+	var data *wallet.ConstructionData
+	if rc, ok := chain.(*wallet.RemoteChain); ok {
+		data, err = rc.GetConstructionData(refs, *decoys)
+	} else {
+		data, err = wallet.NewConstructionData(chain, refs, *decoys)
+	}
+	if err != nil {
+		log.Fatalf("Failed to get construction data: %v", err)
+	}
+	
+	if err := writeJSON(*out, data); err != nil {
+		log.Fatalf("Failed to save construction data: %v", err)
+	}
+	
+	fmt.Printf("Construction data for %d outputs (%d requested) saved to %s\n", len(data.Outputs), len(args), *out)
+	fmt.Println("Copy it to the offline machine and run: wallet build-offline", *out, "<ref> <to> <amount>")
+	
+	printResult(map[string]interface{}{"file": *out, "outputs": refs})
 }
 
-func loadWallet() (*crypto.WalletKeys, error) {
-	data, err := os.ReadFile("wallet.json")
+// buildOffline builds an unsigned transaction from construction data,
+// without chain access
+func buildOffline(args []string) {
+	fs := flag.NewFlagSet("build-offline", flag.ExitOnError)
+	paymentIDStr := fs.String("payment-id", "", "Payment ID to attach (hex, 8 bytes)")
+	memo := fs.String("memo", "", "Memo encrypted to the recipient (costs extra fee per byte)")
+	fee := fs.Uint64("fee", 0, "Fee to pay (default: the minimum at the data's base fee)")
+	fs.Parse(args)
+	args = fs.Args()
+	
+	if len(args) < 4 {
+		fmt.Println("Usage: wallet build-offline [-payment-id id] [-memo text] [-fee n] <data_file> <ref> <recipient_address> <amount> [file]")
+		usageExit()
+	}
+	
+	raw, err := os.ReadFile(args[0])
 	if err != nil {
-		return nil, fmt.Errorf("wallet file not found. Run 'wallet generate' first")
+		log.Fatalf("Failed to read construction data: %v", err)
+	}
+	var data wallet.ConstructionData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		log.Fatalf("Invalid construction data: %v", err)
+	}
+	if data.Denomination != nil {
+		denom = data.Denomination
 	}
 	
-	var wallet crypto.WalletKeys
-	if err := json.Unmarshal(data, &wallet); err != nil {
-		return nil, err
+	payment, err := parsePayment(args[2], args[3], *paymentIDStr, *memo)
+	if err != nil {
+		log.Fatalf("Invalid payment: %v", err)
+	}
+	payments := []wallet.Payment{payment}
+	if *fee == 0 {
+		if *fee, err = data.SuggestFee(payments); err != nil {
+			log.Fatalf("Failed to compute fee: %v", err)
+		}
+	}
+	
+	filename := "unsigned_tx.json"
+	if len(args) > 4 {
+		filename = args[4]
+	}
+	
+	keys, err := loadWallet()
+	if err != nil {
+		log.Fatalf("Failed to load wallet: %v", err)
+	}
+	meta, err := loadMetadata()
+	if err != nil {
+		log.Fatalf("Failed to load wallet metadata: %v", err)
+	}
+	
+	unsigned, sent, err := data.BuildUnsigned(keys, args[1], payments, *fee, meta.OutputPolicy, meta.Subaddresses()...)
+	if err != nil {
+		log.Fatalf("Failed to build transaction: %v", err)
+	}
+	
+	meta.RecordPending(unsigned.ID(), sent)
+	if err := meta.Save(); err != nil {
+		log.Fatalf("Failed to save wallet metadata: %v", err)
+	}
+	if err := writeJSON(filename, unsigned); err != nil {
+		log.Fatalf("Failed to save unsigned transaction: %v", err)
+	}
+	
+	fmt.Printf("Unsigned transaction saved to %s (fee %s)\n", filename, formatAmount(*fee))
+	fmt.Println("Sign it with: wallet sign", filename)
+	
+	printResult(map[string]interface{}{"file": filename, "fee": *fee})
+}
+
+func signTransaction(args []string) {
+	if len(args) < 1 {
+		fmt.Println("Usage: wallet sign <unsigned_file> [signed_file]")
+		usageExit()
+	}
+	
+	filename := "signed_tx.json"
+	if len(args) > 1 {
+		filename = args[1]
+	}
+	
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		log.Fatalf("Failed to read unsigned transaction: %v", err)
+	}
+	
+	var unsigned wallet.UnsignedTx
+	if err := json.Unmarshal(data, &unsigned); err != nil {
+		log.Fatalf("Invalid unsigned transaction: %v", err)
 	}
 	
-	return &wallet, nil
+	keys, err := loadWallet()
+	if err != nil {
+		log.Fatalf("Failed to load wallet: %v", err)
+	}
+	
+	tx, err := unsigned.Sign(keys)
+	if err != nil {
+		log.Fatalf("Failed to sign transaction: %v", err)
+	}
+	
+	if err := writeJSON(filename, tx); err != nil {
+		log.Fatalf("Failed to save signed transaction: %v", err)
+	}
+	
+	fmt.Println("Transaction signed:")
+	fmt.Printf("  Hash: %s\n", tx.Hash())
+	fmt.Printf("  Fee: %s\n", formatAmount(tx.Fee))
+	fmt.Println()
+	fmt.Printf("Signed transaction saved to %s\n", filename)
+	printResult(map[string]interface{}{
+		"tx_hash":       tx.Hash().String(),
+		"fee":           tx.Fee,
+		"file":          filename,
+		"needs_sponsor": wallet.NeedsSponsor(tx),
+	})
+	if wallet.NeedsSponsor(tx) {
+		fmt.Println("Send it to the sponsor, who runs: wallet sponsor", filename)
+		return
+	}
+	fmt.Println("Copy it to the online machine and run: wallet -node <url> submit", filename)
 }
 
-func parseAddress(addrStr string) (types.Address, error) {
-	// Expected format: viewkey:spendkey (both hex)
-	// For Phase 1 simplification
-	var addr types.Address
+func sponsorTransaction(args []string) {
+	fs := flag.NewFlagSet("sponsor", flag.ExitOnError)
+	maxFee := fs.Uint64("max-fee", 0, "Highest fee to pay (default: the base fee plus memo fees)")
+	fs.Parse(args)
+	args = fs.Args()
+	
+	if len(args) < 1 {
+		fmt.Println("Usage: wallet sponsor [-max-fee amount] <signed_file> [sponsored_file]")
+		usageExit()
+	}
+	
+	filename := "sponsored_tx.json"
+	if len(args) > 1 {
+		filename = args[1]
+	}
 	
-	// Parse hex strings
-	viewKeyHex := addrStr[:64]  // First 64 chars
-	spendKeyHex := addrStr[65:] // After colon
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		log.Fatalf("Failed to read transaction: %v", err)
+	}
+	
+	var tx types.Transaction
+	if err := json.Unmarshal(data, &tx); err != nil {
+		log.Fatalf("Invalid transaction: %v", err)
+	}
+	
+	keys, err := loadWallet()
+	if err != nil {
+		log.Fatalf("Failed to load wallet: %v", err)
+	}
+	meta, err := loadMetadata()
+	if err != nil {
+		log.Fatalf("Failed to load wallet metadata: %v", err)
+	}
 	
-	viewKey, err := hex.DecodeString(viewKeyHex)
+	chain, closeChain, err := openChain()
 	if err != nil {
-		return addr, err
+		log.Fatalf("Failed to open chain: %v", err)
+	}
+	defer closeChain()
+	
+	// By default only the minimum fee is paid, plus any base fee
+	if *maxFee == 0 {
+		if *maxFee, err = wallet.SuggestFee(chain, nil); err != nil {
+			log.Fatalf("Failed to get fee: %v", err)
+		}
+		*maxFee += uint64(tx.MemoSize()) * types.MemoFeePerByte
 	}
 	
-	spendKey, err := hex.DecodeString(spendKeyHex)
+	full, err := syncWallet(keys, meta, chain)
 	if err != nil {
-		return addr, err
+		log.Fatalf("Failed to scan chain: %v", err)
+	}
+	result := full.Account(selectedAccount().Index)
+	meta.ApplyFrozen(result)
+	
+	if err := wallet.Sponsor(keys, chain, result, &tx, *maxFee); err != nil {
+		log.Fatalf("Failed to sponsor transaction: %v", err)
+	}
+	
+	if err := writeJSON(filename, &tx); err != nil {
+		log.Fatalf("Failed to save sponsored transaction: %v", err)
 	}
 	
-	copy(addr.ViewKey[:], viewKey)
-	copy(addr.SpendKey[:], spendKey)
+	fmt.Println("Transaction sponsored:")
+	fmt.Printf("  Hash: %s\n", tx.Hash())
+	fmt.Printf("  Fee paid: %s\n", formatAmount(tx.Fee))
+	fmt.Println()
+	fmt.Printf("Sponsored transaction saved to %s\n", filename)
+	fmt.Println("Return it to the sender, who runs: wallet -node <url> submit", filename)
 	
-	return addr, nil
+	printResult(map[string]interface{}{"tx_hash": tx.Hash().String(), "fee": tx.Fee, "file": filename})
 }
 
-func buildPrivateTransaction(wallet *crypto.WalletKeys, recipient types.Address, amount uint64) (*types.Transaction, error) {
-	// Phase 1 simplified transaction builder
-	// In production, this would:
-	// 1. Scan for owned UTXOs
-	// 2. Select inputs to cover amount + fee
-	// 3. Create ring signature with decoys
-	// 4. Generate stealth addresses for outputs
+func submitTransaction(args []string) {
+	if len(args) < 1 {
+		fmt.Println("Usage: wallet -node <url> submit <signed_file>")
+		usageExit()
+	}
+	if *nodeURL == "" {
+		log.Fatalf("submit requires -node")
+	}
 	
-	// Generate stealth output for recipient
-	output, ephemeral, err := crypto.GenerateStealthAddress(recipient)
+	data, err := os.ReadFile(args[0])
 	if err != nil {
-		return nil, err
+		log.Fatalf("Failed to read transaction: %v", err)
+	}
+	
+	var tx types.Transaction
+	if err := json.Unmarshal(data, &tx); err != nil {
+		log.Fatalf("Invalid transaction: %v", err)
+	}
+	if wallet.NeedsSponsor(&tx) {
+		log.Fatalf("Transaction is waiting for its sponsor; have them run: wallet sponsor %s", args[0])
+	}
+	
+	if err := submitToNode(&tx); err != nil {
+		log.Fatalf("Failed to submit transaction: %v", err)
+	}
+	
+	// Record tx keys created by create-unsigned under the final hash
+	meta, err := loadMetadata()
+	if err == nil && meta.ResolvePending(&tx) {
+		if err := meta.Save(); err != nil {
+			log.Printf("Failed to save wallet metadata: %v", err)
+		}
+	}
+	
+	fmt.Printf("Transaction %s submitted\n", tx.Hash())
+	printResult(map[string]string{"tx_hash": tx.Hash().String()})
+}
+
+// parsePayment builds a payment from command arguments
+func parsePayment(recipientStr, amountStr, paymentIDStr, memo string) (wallet.Payment, error) {
+	amount, err := parseAmount(amountStr)
+	if err != nil {
+		return wallet.Payment{}, err
+	}
+	if amount == 0 {
+		return wallet.Payment{}, fmt.Errorf("amount must be positive")
 	}
 	
-	output.Amount = amount
+	// Allow address book labels in place of addresses
+	meta, err := loadMetadata()
+	if err != nil {
+		return wallet.Payment{}, err
+	}
 	
-	// Create change output (simplified - assume we have exact amount)
-	// In production, scan for owned UTXOs and create change
+	payment, err := wallet.ParsePayment(walletNetwork(), meta.ResolveContact(recipientStr), amount, paymentIDStr)
+	if err != nil {
+		return payment, err
+	}
 	
-	// Create transaction
-	tx := &types.Transaction{
-		Version: 1,
-		Inputs:  make([]*types.TxInput, 0), // TODO: Add real inputs
-		Outputs: []*types.TxOutput{output},
-		Fee:     1000, // Fixed fee for Phase 1
+	if len(memo) > types.MaxMemoSize {
+		return payment, fmt.Errorf("memo exceeds %d bytes", types.MaxMemoSize)
+	}
+	if memo != "" {
+		payment.Memo = []byte(memo)
 	}
 	
-	// TODO: Create ring signature for inputs
-	// For now, transaction is incomplete but demonstrates structure
+	return payment, nil
+}
+
+// buildUnsigned scans the chain and builds an unsigned transaction,
+// spending fromUTXO if given and otherwise any unfrozen output. The fee
+// of a sponsored transaction is left to its sponsor.
+func buildUnsigned(keys *crypto.WalletKeys, payment wallet.Payment, fromUTXO string, sponsored bool) (*wallet.UnsignedTx, []*wallet.SentOutput, error) {
+	unsigned, sent, _, err := buildTransaction(keys, payment, fromUTXO, sponsored, false)
+	return unsigned, sent, err
+}
+
+// buildTransaction is buildUnsigned which, if sweep is set, pays the fee
+// with a dust output as the wallet settings ask. The dust output is
+// returned, or nil if none is swept; it must be added to the signed
+// transaction with sponsorDust.
+func buildTransaction(keys *crypto.WalletKeys, payment wallet.Payment, fromUTXO string, sponsored, sweep bool) (*wallet.UnsignedTx, []*wallet.SentOutput, *wallet.OwnedOutput, error) {
+	meta, err := loadMetadata()
+	if err != nil {
+		return nil, nil, nil, err
+	}
 	
-	_ = ephemeral // Will be used for ECDH
+	chain, closeChain, err := openChain()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer closeChain()
 	
-	return tx, nil
-}
\ No newline at end of file
+	// Only the selected account's outputs are spent
+	full, err := syncWallet(keys, meta, chain)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	result := full.Account(selectedAccount().Index)
+	meta.ApplyFrozen(result)
+	
+	payments := []wallet.Payment{payment}
+	fee, err := wallet.SuggestFee(chain, payments)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if fromUTXO == "" {
+		if sponsored {
+			unsigned, sent, err := wallet.BuildSponsored(keys, chain, result, payments, fee, meta.OutputPolicy)
+			return unsigned, sent, nil, err
+		}
+		
+		// Fall back to a plain send if no other output funds the payment
+		if dust := wallet.SelectDust(result, fee, meta.OutputPolicy); sweep && dust != nil {
+			unsigned, sent, err := wallet.BuildSweep(keys, chain, result, payments, dust, meta.OutputPolicy)
+			if err == nil {
+				return unsigned, sent, dust, nil
+			}
+		}
+		unsigned, sent, err := wallet.BuildUnsigned(keys, chain, result, payments, fee, meta.OutputPolicy)
+		return unsigned, sent, nil, err
+	}
+	
+	txHash, index, err := wallet.ParseOutputRef(fromUTXO)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	input, err := result.Find(txHash, index)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if sponsored {
+		unsigned, sent, err := wallet.BuildSponsoredFrom(keys, chain, input, payments, fee, meta.OutputPolicy)
+		return unsigned, sent, nil, err
+	}
+	unsigned, sent, err := wallet.BuildUnsignedFrom(keys, chain, input, payments, fee, meta.OutputPolicy)
+	return unsigned, sent, nil, err
+}
+
+// sponsorDust pays the fee of tx, built by buildTransaction, with the
+// dust output it swept
+func sponsorDust(keys *crypto.WalletKeys, tx *types.Transaction, dust *wallet.OwnedOutput) error {
+	chain, closeChain, err := openChain()
+	if err != nil {
+		return err
+	}
+	defer closeChain()
+	
+	return wallet.SponsorFrom(keys, chain, dust, tx, dust.Amount)
+}
+
+// submitToNode sends a signed transaction to the node RPC, unless the
+// node is on another network than the wallet
+func submitToNode(tx *types.Transaction) error {
+	chain := remoteChain()
+	if err := wallet.CheckNetwork(chain, walletNetwork()); err != nil {
+		return err
+	}
+	return chain.Client().Call("sendRawTransaction", map[string]interface{}{"tx": tx}, nil)
+}
+
+// writeJSON saves v as indented JSON
+func writeJSON(filename string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0644)
+}
+
+func queryBalance() {
+	keys, err := loadWallet()
+	if err != nil {
+		log.Fatalf("Failed to load wallet: %v", err)
+	}
+	
+	fmt.Println("Scanning blockchain for your outputs...")
+	
+	result, err := scanAccount(keys, 0)
+	if err != nil {
+		log.Fatalf("Failed to scan blockchain: %v", err)
+	}
+	
+	fmt.Println()
+	fmt.Printf("Scanned up to height: %d\n", result.ScannedHeight)
+	fmt.Printf("Outputs found: %d\n", len(result.Outputs))
+	
+	if !result.SpendsKnown() {
+		// Without the spend key we cannot derive key images, so
+		// spent outputs are indistinguishable from unspent ones
+		fmt.Printf("Total received: %s\n", formatAmount(result.Received()))
+		fmt.Println()
+		fmt.Println("View-only wallet: spent outputs cannot be detected,")
+		fmt.Println("so this is the total received, not the spendable balance.")
+		fmt.Println("Import key images from the full wallet to see it (import-key-images).")
+		printResult(map[string]interface{}{
+			"scanned_height": result.ScannedHeight,
+			"outputs":        len(result.Outputs),
+			"received":       result.Received(),
+			"spends_known":   false,
+		})
+		return
+	}
+	
+	fmt.Printf("Balance: %s\n", formatAmount(result.Balance()))
+	printResult(map[string]interface{}{
+		"scanned_height": result.ScannedHeight,
+		"outputs":        len(result.Outputs),
+		"received":       result.Received(),
+		"balance":        result.Balance(),
+		"spends_known":   true,
+	})
+}
+
+func scanOutputs(args []string) {
+	var fromHeight uint64
+	if len(args) > 0 {
+		fmt.Sscanf(args[0], "%d", &fromHeight)
+	}
+	
+	keys, err := loadWallet()
+	if err != nil {
+		log.Fatalf("Failed to load wallet: %v", err)
+	}
+	
+	result, err := scanAccount(keys, fromHeight)
+	if err != nil {
+		log.Fatalf("Failed to scan blockchain: %v", err)
+	}
+	
+	fmt.Printf("Scanned up to height %d, found %d outputs\n", result.ScannedHeight, len(result.Outputs))
+	for _, out := range result.Outputs {
+		status := "unspent"
+		if out.KeyImage == (types.PublicKey{}) {
+			status = "unknown (view-only)"
+		} else if out.Spent {
+			status = "spent"
+		}
+		
+		fmt.Printf("  %s:%d  height=%d  amount=%s  %s",
+			out.TxHash.String()[:16], out.OutputIndex, out.BlockHeight, formatAmount(out.Amount), status)
+		if out.PaymentID != nil {
+			fmt.Printf("  payment_id=%s", out.PaymentID)
+		}
+		if out.Memo != nil {
+			fmt.Printf("  memo=%q", out.Memo)
+		}
+		fmt.Println()
+	}
+	
+	printResult(map[string]interface{}{"scanned_height": result.ScannedHeight, "outputs": result.Outputs})
+}
+
+// scanChain scans the whole chain for outputs owned by keys, paid to
+// their main address or one of subaddresses. It keeps no checkpoint, so
+// it suits keys other than the wallet's own (see syncChain).
+func scanChain(keys *crypto.WalletKeys, fromHeight uint64, subaddresses ...wallet.SubaddressIndex) (*wallet.ScanResult, error) {
+	chain, closeChain, err := openChain()
+	if err != nil {
+		return nil, err
+	}
+	defer closeChain()
+	
+	result, err := wallet.Scan(keys, chain, fromHeight, subaddresses...)
+	if err != nil {
+		return nil, err
+	}
+	
+	// View-only wallets see spends through imported key images
+	meta, err := loadMetadata()
+	if err != nil {
+		return nil, err
+	}
+	if err := meta.ResolveSpends(result, chain); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// syncChain brings the wallet's scan checkpoint up to the chain tip and
+// returns its outputs
+func syncChain(keys *crypto.WalletKeys, meta *wallet.Metadata) (*wallet.ScanResult, error) {
+	chain, closeChain, err := openChain()
+	if err != nil {
+		return nil, err
+	}
+	defer closeChain()
+	
+	return syncWallet(keys, meta, chain)
+}
+
+// syncWallet scans the blocks added since the checkpoint in meta, or
+// since -rescan-from, and saves the new checkpoint
+func syncWallet(keys *crypto.WalletKeys, meta *wallet.Metadata, chain wallet.ChainReader) (*wallet.ScanResult, error) {
+	if meta.ScanCache == nil {
+		meta.ScanCache = &wallet.ScanCache{}
+	}
+	if *rescanFrom >= 0 {
+		meta.ScanCache.Rewind(uint64(*rescanFrom))
+	}
+	
+	var result *wallet.ScanResult
+	var err error
+	switch {
+	case *remoteScan && *filterSync:
+		return nil, fmt.Errorf("-remote-scan and -filter-sync cannot be used together")
+	case *remoteScan:
+		result, err = remoteSync(keys, meta, chain)
+	case *filterSync:
+		filters, ok := chain.(wallet.FilterReader)
+		if !ok {
+			return nil, fmt.Errorf("-filter-sync needs a node connection (-node <url>)")
+		}
+		result, err = wallet.SyncFiltered(keys, filters, meta.ScanCache, meta.Subaddresses()...)
+	default:
+		result, err = wallet.Sync(keys, chain, meta.ScanCache, meta.Subaddresses()...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	rememberDenomination(meta, chain)
+	if err := meta.Save(); err != nil {
+		return nil, err
+	}
+	
+	// View-only wallets see spends through imported key images
+	if err := meta.ResolveSpends(result, chain); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// remoteSync syncs through the node's scanning service, registering the
+// wallet's view key with it first if needed
+func remoteSync(keys *crypto.WalletKeys, meta *wallet.Metadata, chain wallet.ChainReader) (*wallet.ScanResult, error) {
+	rc, ok := chain.(*wallet.RemoteChain)
+	if !ok {
+		return nil, fmt.Errorf("-remote-scan needs a node connection (-node <url>)")
+	}
+	
+	subaddresses := meta.Subaddresses()
+	reg := meta.RemoteScans[*nodeURL]
+	for retried := false; ; retried = true {
+		if !reg.Covers(subaddresses) {
+			if reg != nil {
+				rc.UnregisterScan(reg.Token) // The new registration replaces it
+			}
+			var err error
+			if reg, err = rc.RegisterScan(keys, subaddresses); err != nil {
+				return nil, fmt.Errorf("failed to register with the scanning service: %w", err)
+			}
+			meta.RemoteScans[*nodeURL] = reg
+		}
+		
+		result, err := wallet.SyncRemote(keys, rc, reg.Token, meta.ScanCache, subaddresses...)
+		if wallet.IsUnknownScanToken(err) && !retried {
+			reg = nil // Forgotten by the node, e.g. after a restart
+			continue
+		}
+		return result, err
+	}
+}
+
+// scanAccount returns the outputs of the selected account received at
+// fromHeight or later
+func scanAccount(keys *crypto.WalletKeys, fromHeight uint64) (*wallet.ScanResult, error) {
+	meta, err := loadMetadata()
+	if err != nil {
+		return nil, err
+	}
+	
+	full, err := syncChain(keys, meta)
+	if err != nil {
+		return nil, err
+	}
+	
+	result := full.Account(selectedAccount().Index)
+	received := result.Outputs[:0]
+	for _, out := range result.Outputs {
+		if out.BlockHeight >= fromHeight {
+			received = append(received, out)
+		}
+	}
+	result.Outputs = received
+	return result, nil
+}
+
+// remoteChain connects to the node RPC, through the proxy if set
+func remoteChain() *wallet.RemoteChain {
+	chain := wallet.NewRemoteChain(*nodeURL)
+	if *proxyAddr != "" {
+		chain.Client().SetProxy(*proxyAddr)
+	}
+	return chain
+}
+
+// openChain connects to the node RPC if -node is set, otherwise opens
+// the local node database read-only
+func openChain() (wallet.ChainReader, func(), error) {
+	if *nodeURL != "" {
+		return remoteChain(), func() {}, nil
+	}
+	
+	db, err := storage.OpenReadOnly(*dataDir + "/blockchain.db")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open chain database (is the node stopped?): %w", err)
+	}
+	
+	return db, func() { db.Close() }, nil
+}
+
+// chainID returns the ID of the chain the wallet is connected to
+func chainID() (string, error) {
+	chain, closeChain, err := openChain()
+	if err != nil {
+		return "", err
+	}
+	defer closeChain()
+	
+	return chain.GetChainID()
+}
+
+// stakeTokens bonds stake to the wallet's validator. The stake is paid
+// for by a transaction burning the amount for the validator, which must
+// land in the same block as the bond.
+func stakeTokens(args []string) {
+	nonce, args := parseStakingFlags("stake", args)
+	if len(args) < 1 {
+		fmt.Println("Usage: wallet stake [-nonce n] <amount> [commission_bps]")
+		usageExit()
+	}
+	
+	amount, err := parseAmount(args[0])
+	if err != nil || amount == 0 {
+		log.Fatalf("Invalid amount: %s", args[0])
+	}
+	
+	commission := parseCommission(args[1:])
+	
+	keys, err := loadWallet()
+	if err != nil {
+		log.Fatalf("Failed to load wallet: %v", err)
+	}
+	
+	if !keys.CanSpend() {
+		log.Fatalf("Cannot stake from a view-only wallet")
+	}
+	validator := keys.SpendKeyPair.PublicKey
+	
+	// Burn the stake for the validator
+	unsigned, _, err := buildUnsigned(keys, wallet.Payment{Amount: amount, Burn: true, Bond: &validator}, "", false)
+	if err != nil {
+		log.Fatalf("Failed to build funding transaction: %v", err)
+	}
+	funding, err := unsigned.Sign(keys)
+	if err != nil {
+		log.Fatalf("Failed to sign funding transaction: %v", err)
+	}
+	
+	// Create staking transaction
+	// All stake is self-bonded until delegation exists
+	stakingTx := &types.StakingTx{
+		Type:       types.StakingBond,
+		Validator:  validator,
+		Amount:     amount,
+		SelfBond:   amount,
+		Commission: commission,
+		Funding:    funding.Hash(),
+	}
+	signStakingTx(keys, stakingTx, nonce)
+	
+	fmt.Println("Staking transaction created:")
+	fmt.Printf("  Validator: %s\n", stakingTx.Validator.String())
+	fmt.Printf("  Amount: %s\n", formatAmount(amount))
+	fmt.Printf("  Commission: %s\n", formatCommission(commission))
+	fmt.Printf("  Funding: %s (fee %s)\n", funding.Hash(), formatAmount(funding.Fee))
+	fmt.Println()
+	
+	result := map[string]interface{}{"funding_tx": funding.Hash().String(), "fee": funding.Fee}
+	if *nodeURL != "" {
+		if err := submitToNode(funding); err != nil {
+			log.Fatalf("Failed to submit funding transaction: %v", err)
+		}
+		submitStakingOrSave(stakingTx, result)
+		return
+	}
+	
+	txFile := fmt.Sprintf("tx_%s.json", funding.Hash().String()[:8])
+	if err := writeJSON(txFile, funding); err != nil {
+		log.Fatalf("Failed to save funding transaction: %v", err)
+	}
+	fmt.Printf("Funding transaction saved to %s\n", txFile)
+	fmt.Println("Submit it before the staking transaction: wallet -node <url> submit", txFile)
+	result["funding_file"] = txFile
+	submitStakingOrSave(stakingTx, result)
+}
+
+func setCommission(args []string) {
+	nonce, args := parseStakingFlags("set-commission", args)
+	if len(args) < 1 {
+		fmt.Println("Usage: wallet set-commission [-nonce n] <commission_bps>")
+		usageExit()
+	}
+	commission := parseCommission(args)
+	
+	keys, err := loadWallet()
+	if err != nil {
+		log.Fatalf("Failed to load wallet: %v", err)
+	}
+	
+	if !keys.CanSpend() {
+		log.Fatalf("Cannot change commission from a view-only wallet")
+	}
+	
+	stakingTx := &types.StakingTx{
+		Type:       types.StakingSetCommission,
+		Validator:  keys.SpendKeyPair.PublicKey,
+		Commission: commission,
+	}
+	signStakingTx(keys, stakingTx, nonce)
+	
+	fmt.Println("Commission change created:")
+	fmt.Printf("  Validator: %s\n", stakingTx.Validator.String())
+	fmt.Printf("  Commission: %s\n", formatCommission(commission))
+	fmt.Println()
+	
+	fmt.Println("Rates may change once per epoch, within the chain's limits")
+	submitStakingOrSave(stakingTx, map[string]interface{}{})
+}
+
+func unjailValidator(args []string) {
+	nonce, _ := parseStakingFlags("unjail", args)
+	
+	keys, err := loadWallet()
+	if err != nil {
+		log.Fatalf("Failed to load wallet: %v", err)
+	}
+	
+	if !keys.CanSpend() {
+		log.Fatalf("Cannot unjail from a view-only wallet")
+	}
+	
+	stakingTx := &types.StakingTx{
+		Type:      types.StakingUnjail,
+		Validator: keys.SpendKeyPair.PublicKey,
+	}
+	signStakingTx(keys, stakingTx, nonce)
+	
+	fmt.Println("Unjail transaction created:")
+	fmt.Printf("  Validator: %s\n", stakingTx.Validator.String())
+	fmt.Println()
+	
+	fmt.Println("It is accepted once the jail period is over (see getValidators)")
+	submitStakingOrSave(stakingTx, map[string]interface{}{})
+}
+
+func unbondValidator(args []string) {
+	nonce, _ := parseStakingFlags("unbond", args)
+	
+	keys, err := loadWallet()
+	if err != nil {
+		log.Fatalf("Failed to load wallet: %v", err)
+	}
+	
+	if !keys.CanSpend() {
+		log.Fatalf("Cannot unbond from a view-only wallet")
+	}
+	
+	stakingTx := &types.StakingTx{
+		Type:      types.StakingUnbond,
+		Validator: keys.SpendKeyPair.PublicKey,
+	}
+	signStakingTx(keys, stakingTx, nonce)
+	
+	fmt.Println("Unbond transaction created:")
+	fmt.Printf("  Validator: %s\n", stakingTx.Validator.String())
+	fmt.Println()
+	
+	fmt.Printf("The stake can be released %d blocks after it is accepted (see release)\n", types.UnbondingPeriod)
+	submitStakingOrSave(stakingTx, map[string]interface{}{})
+}
+
+// releaseStake pays the wallet's validator stake back to the wallet
+// once its unbonding period is over
+func releaseStake() {
+	if *nodeURL == "" {
+		log.Fatalf("Releasing stake needs -node to look up the stake")
+	}
+	
+	keys, err := loadWallet()
+	if err != nil {
+		log.Fatalf("Failed to load wallet: %v", err)
+	}
+	
+	if !keys.CanSpend() {
+		log.Fatalf("Cannot release stake from a view-only wallet")
+	}
+	validator := keys.SpendKeyPair.PublicKey
+	
+	var info struct {
+		Height    uint64                  `json:"height"`
+		Unbonding []*types.ValidatorState `json:"unbonding"`
+	}
+	if err := remoteChain().Client().Call("getValidators", nil, &info); err != nil {
+		log.Fatalf("Failed to get validators: %v", err)
+	}
+	var val *types.ValidatorState
+	for _, v := range info.Unbonding {
+		if v.PublicKey == validator {
+			val = v
+		}
+	}
+	if val == nil {
+		log.Fatalf("Validator %s is not unbonding", validator)
+	}
+	if info.Height+1 < val.UnbondingUntil {
+		log.Fatalf("Stake is unbonding until height %d (now %d)", val.UnbondingUntil, info.Height)
+	}
+	
+	id, err := chainID()
+	if err != nil {
+		log.Fatalf("Failed to get chain ID: %v", err)
+	}
+	tx, err := wallet.BuildStakeRelease(keys, val.StakedAmount, val.UnbondingUntil, id)
+	if err != nil {
+		log.Fatalf("Failed to build stake release: %v", err)
+	}
+	
+	fmt.Println("Stake release created:")
+	fmt.Printf("  Validator: %s\n", validator.String())
+	fmt.Printf("  Amount: %s\n", formatAmount(val.StakedAmount))
+	fmt.Printf("  Hash: %s\n", tx.Hash())
+	fmt.Println()
+	
+	submitOrSave(tx, map[string]interface{}{"released": val.StakedAmount})
+}
+
+// parseStakingFlags reads the flags shared by staking commands. A
+// negative nonce means the node is asked for it.
+func parseStakingFlags(name string, args []string) (int64, []string) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	nonce := fs.Int64("nonce", -1, "Staking nonce of the validator (default: ask the node)")
+	fs.Parse(args)
+	return *nonce, fs.Args()
+}
+
+// signStakingTx sets the nonce of a staking transaction and signs it for
+// the connected chain
+func signStakingTx(keys *crypto.WalletKeys, stakingTx *types.StakingTx, nonce int64) {
+	if nonce < 0 {
+		if *nodeURL == "" {
+			log.Fatalf("Staking transactions need -node to look up the nonce, or -nonce")
+		}
+		var result struct {
+			Nonce uint64 `json:"nonce"`
+		}
+		params := map[string]interface{}{"validator": stakingTx.Validator}
+		if err := remoteChain().Client().Call("getStakingNonce", params, &result); err != nil {
+			log.Fatalf("Failed to get staking nonce: %v", err)
+		}
+		nonce = int64(result.Nonce)
+	}
+	stakingTx.Nonce = uint64(nonce)
+	
+	id, err := chainID()
+	if err != nil {
+		log.Fatalf("Failed to get chain ID: %v", err)
+	}
+	if err := wallet.SignStakingTx(keys, stakingTx, id); err != nil {
+		log.Fatalf("Failed to sign staking transaction: %v", err)
+	}
+}
+
+// parseCommission reads an optional commission rate in basis points
+func parseCommission(args []string) uint32 {
+	if len(args) == 0 {
+		return 0
+	}
+	commission, err := strconv.ParseUint(args[0], 10, 32)
+	if err != nil || commission > types.CommissionDenominator {
+		log.Fatalf("Invalid commission %q: want basis points from 0 to %d", args[0], types.CommissionDenominator)
+	}
+	return uint32(commission)
+}
+
+// formatCommission shows basis points as a percentage
+func formatCommission(commission uint32) string {
+	return fmt.Sprintf("%d.%02d%%", commission/100, commission%100)
+}
+
+// submitStakingOrSave sends a staking transaction to the node for the
+// next block, or without -node saves it for submit-staking
+func submitStakingOrSave(stakingTx *types.StakingTx, result map[string]interface{}) {
+	result["staking_tx"] = stakingTx
+	
+	if *nodeURL != "" {
+		if err := submitStakingToNode(stakingTx); err != nil {
+			log.Fatalf("Failed to submit staking transaction: %v", err)
+		}
+		fmt.Println("Staking transaction submitted")
+		result["submitted"] = true
+		printResult(result)
+		return
+	}
+	
+	filename := "staking_tx.json"
+	if err := writeJSON(filename, stakingTx); err != nil {
+		log.Fatalf("Failed to save staking transaction: %v", err)
+	}
+	fmt.Printf("Staking transaction saved to %s\n", filename)
+	fmt.Println("Submit it with: wallet -node <url> submit-staking", filename)
+	result["submitted"] = false
+	result["file"] = filename
+	printResult(result)
+}
+
+// submitStakingToNode sends a signed staking transaction to the node
+// RPC, unless the node is on another network than the wallet
+func submitStakingToNode(stakingTx *types.StakingTx) error {
+	chain := remoteChain()
+	if err := wallet.CheckNetwork(chain, walletNetwork()); err != nil {
+		return err
+	}
+	return chain.Client().Call("submitStakingTx", map[string]interface{}{"staking_tx": stakingTx}, nil)
+}
+
+// submitStaking sends a staking transaction saved by a staking command
+func submitStaking(args []string) {
+	if len(args) < 1 {
+		fmt.Println("Usage: wallet -node <url> submit-staking <file>")
+		usageExit()
+	}
+	if *nodeURL == "" {
+		log.Fatalf("submit-staking requires -node")
+	}
+	
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		log.Fatalf("Failed to read staking transaction: %v", err)
+	}
+	var stakingTx types.StakingTx
+	if err := json.Unmarshal(data, &stakingTx); err != nil {
+		log.Fatalf("Invalid staking transaction: %v", err)
+	}
+	
+	if err := submitStakingToNode(&stakingTx); err != nil {
+		log.Fatalf("Failed to submit staking transaction: %v", err)
+	}
+	fmt.Printf("Staking transaction %s submitted\n", stakingTx.Hash())
+	printResult(map[string]string{"hash": stakingTx.Hash().String()})
+}
+
+func getTxKey(args []string) {
+	if len(args) < 1 {
+		fmt.Println("Usage: wallet get-tx-key <txhash>")
+		usageExit()
+	}
+	
+	txHash, err := types.HashFromString(args[0])
+	if err != nil {
+		log.Fatalf("Invalid transaction hash: %v", err)
+	}
+	
+	meta, err := loadMetadata()
+	if err != nil {
+		log.Fatalf("Failed to load wallet metadata: %v", err)
+	}
+	
+	sent, err := meta.GetSent(txHash)
+	if err != nil {
+		log.Fatalf("Failed to get tx keys: %v", err)
+	}
+	
+	fmt.Println("Tx keys for", txHash)
+	keys := make([]map[string]interface{}, 0, len(sent))
+	for _, out := range sent {
+		fmt.Printf("  output %d: %s\n", out.OutputIndex, hex.EncodeToString(out.TxKey.Seed()))
+		fmt.Printf("    recipient: %s\n", wallet.FormatAddress(walletNetwork(), out.Recipient))
+		keys = append(keys, map[string]interface{}{
+			"output_index": out.OutputIndex,
+			"tx_key":       hex.EncodeToString(out.TxKey.Seed()),
+			"recipient":    wallet.FormatAddress(walletNetwork(), out.Recipient),
+		})
+	}
+	
+	printResult(map[string]interface{}{"tx_hash": txHash.String(), "keys": keys})
+}
+
+func proveTransaction(args []string) {
+	if len(args) < 2 {
+		fmt.Println("Usage: wallet prove <txhash> <address> [file]")
+		usageExit()
+	}
+	
+	txHash, err := types.HashFromString(args[0])
+	if err != nil {
+		log.Fatalf("Invalid transaction hash: %v", err)
+	}
+	
+	addr, _, err := wallet.ParseAddress(walletNetwork(), args[1])
+	if err != nil {
+		log.Fatalf("Invalid address: %v", err)
+	}
+	
+	filename := fmt.Sprintf("tx_proof_%s.json", txHash.String()[:8])
+	if len(args) > 2 {
+		filename = args[2]
+	}
+	
+	meta, err := loadMetadata()
+	if err != nil {
+		log.Fatalf("Failed to load wallet metadata: %v", err)
+	}
+	
+	sent, err := meta.GetSent(txHash)
+	if err != nil {
+		log.Fatalf("Failed to get tx keys: %v", err)
+	}
+	
+	var proof *crypto.TxProof
+	for _, out := range sent {
+		if out.Recipient == addr {
+			proof = crypto.GenerateTxProof(txHash, out.TxKey, addr)
+			break
+		}
+	}
+	if proof == nil {
+		log.Fatalf("Transaction %s did not pay this address", txHash)
+	}
+	
+	data, err := json.MarshalIndent(proof, "", "  ")
+	if err != nil {
+		log.Fatalf("Failed to marshal proof: %v", err)
+	}
+	if err := os.WriteFile(filename, data, 0644); err != nil {
+		log.Fatalf("Failed to save proof: %v", err)
+	}
+	
+	fmt.Printf("Payment proof saved to %s\n", filename)
+	fmt.Println("The recipient or an auditor can check it with: wallet verify-proof", filename)
+	
+	printResult(map[string]string{"file": filename})
+}
+
+func verifyProof(args []string) {
+	if len(args) < 1 {
+		fmt.Println("Usage: wallet verify-proof <file>")
+		usageExit()
+	}
+	
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		log.Fatalf("Failed to read proof: %v", err)
+	}
+	
+	var proof crypto.TxProof
+	if err := json.Unmarshal(data, &proof); err != nil {
+		log.Fatalf("Invalid proof file: %v", err)
+	}
+	
+	chain, closeChain, err := openChain()
+	if err != nil {
+		log.Fatalf("Failed to open chain: %v", err)
+	}
+	defer closeChain()
+	
+	tx, err := chain.GetTransaction(proof.TxHash)
+	if err != nil {
+		log.Fatalf("Transaction %s not found: %v", proof.TxHash, err)
+	}
+	
+	amount, err := crypto.VerifyTxProof(&proof, tx)
+	if err != nil {
+		fmt.Printf("Proof INVALID: %v\n", err)
+		printResult(map[string]interface{}{"valid": false, "error": err.Error()})
+		os.Exit(exitFailure)
+	}
+	
+	fmt.Println("Proof VALID")
+	fmt.Printf("  Transaction: %s\n", proof.TxHash)
+	fmt.Printf("  Address: %s\n", wallet.FormatAddress(walletNetwork(), proof.Address))
+	fmt.Printf("  Amount paid: %s\n", formatAmount(amount))
+	printResult(map[string]interface{}{
+		"valid":   true,
+		"tx_hash": proof.TxHash.String(),
+		"address": wallet.FormatAddress(walletNetwork(), proof.Address),
+		"amount":  amount,
+	})
+}
+
+func serveWallet(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	listen := fs.String("listen", "127.0.0.1:9200", "API listen address")
+	tokenFile := fs.String("token-file", "", "API token file (default <wallet>.token, created if missing)")
+	interval := fs.Duration("interval", wallet.DefaultScanInterval, "Chain scan interval")
+	webhooks := fs.String("webhooks", "", "Webhook configuration file (JSON) for payment notifications")
+	fs.Parse(args)
+	
+	if *nodeURL == "" {
+		log.Fatalf("The wallet daemon needs a node connection (-node <url>)")
+	}
+	
+	keys, err := loadWallet()
+	if err != nil {
+		log.Fatalf("Failed to load wallet: %v", err)
+	}
+	
+	meta, err := loadMetadata()
+	if err != nil {
+		log.Fatalf("Failed to load wallet metadata: %v", err)
+	}
+	if *rescanFrom >= 0 && meta.ScanCache != nil {
+		meta.ScanCache.Rewind(uint64(*rescanFrom))
+	}
+	
+	if *tokenFile == "" {
+		*tokenFile = strings.TrimSuffix(*walletFile, filepath.Ext(*walletFile)) + ".token"
+	}
+	token, err := rpc.LoadOrCreateToken(*tokenFile)
+	if err != nil {
+		log.Fatalf("Failed to load API token: %v", err)
+	}
+	
+	daemon, err := wallet.NewDaemon(keys, walletNetwork(), meta, remoteChain(), *listen, token, *interval)
+	if err != nil {
+		log.Fatalf("Failed to create wallet daemon: %v", err)
+	}
+	
+	if *webhooks != "" {
+		cfg, err := notify.LoadConfig(*webhooks)
+		if err != nil {
+			log.Fatalf("Failed to load webhook config: %v", err)
+		}
+		notifier, err := notify.New(cfg)
+		if err != nil {
+			log.Fatalf("Failed to start webhooks: %v", err)
+		}
+		defer notifier.Close()
+		daemon.SetNotifier(notifier)
+		fmt.Printf("Sending webhooks to %d endpoint(s)\n", len(cfg.Endpoints))
+	}
+	
+	fmt.Println("Scanning blockchain...")
+	if err := daemon.Start(); err != nil {
+		log.Fatalf("Failed to start wallet daemon: %v", err)
+	}
+	
+	fmt.Printf("Wallet API listening on http://%s\n", daemon.Addr())
+	fmt.Printf("Send the token in %s as 'Authorization: Bearer <token>'\n", *tokenFile)
+	
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	<-sigChan
+	
+	fmt.Println("Shutting down...")
+	daemon.Stop()
+}
+
+func utxosCommand(args []string) {
+	if len(args) < 1 {
+		printUsage()
+		usageExit()
+	}
+	
+	meta, err := loadMetadata()
+	if err != nil {
+		log.Fatalf("Failed to load wallet metadata: %v", err)
+	}
+	
+	switch args[0] {
+	case "list":
+		listUTXOs(meta, args[1:])
+	case "freeze", "unfreeze":
+		if len(args) < 2 {
+			fmt.Printf("Usage: wallet utxos %s <tx_hash>:<index>\n", args[0])
+			usageExit()
+		}
+		txHash, index, err := wallet.ParseOutputRef(args[1])
+		if err != nil {
+			log.Fatalf("Invalid output reference: %v", err)
+		}
+		
+		status := "frozen"
+		if args[0] == "freeze" {
+			meta.Freeze(txHash, index)
+		} else if err := meta.Unfreeze(txHash, index); err != nil {
+			log.Fatalf("Failed to unfreeze output: %v", err)
+		} else {
+			status = "unfrozen"
+		}
+		
+		if err := meta.Save(); err != nil {
+			log.Fatalf("Failed to save wallet metadata: %v", err)
+		}
+		fmt.Printf("Output %s %s\n", args[1], status)
+		printResult(map[string]string{"output": args[1], "status": status})
+	default:
+		fmt.Printf("Unknown utxos command: %s\n", args[0])
+		printUsage()
+		usageExit()
+	}
+}
+
+func listUTXOs(meta *wallet.Metadata, args []string) {
+	fs := flag.NewFlagSet("utxos list", flag.ExitOnError)
+	all := fs.Bool("all", false, "Include spent outputs")
+	fs.Parse(args)
+	
+	keys, err := loadWallet()
+	if err != nil {
+		log.Fatalf("Failed to load wallet: %v", err)
+	}
+	
+	result, err := scanAccount(keys, 0)
+	if err != nil {
+		log.Fatalf("Failed to scan blockchain: %v", err)
+	}
+	meta.ApplyFrozen(result)
+	
+	var spendable, frozen uint64
+	listed := make([]map[string]interface{}, 0, len(result.Outputs))
+	for _, out := range result.Outputs {
+		if out.Spent && !*all {
+			continue
+		}
+		
+		status := "unspent"
+		switch {
+		case out.Spent:
+			status = "spent"
+		case out.Frozen:
+			status = "frozen"
+			frozen += out.Amount
+		default:
+			spendable += out.Amount
+		}
+		
+		fmt.Printf("  %s  height=%d  amount=%s  %s\n", out.Ref(), out.BlockHeight, formatAmount(out.Amount), status)
+		listed = append(listed, map[string]interface{}{
+			"ref":    out.Ref(),
+			"height": out.BlockHeight,
+			"amount": out.Amount,
+			"status": status,
+		})
+	}
+	
+	fmt.Println()
+	fmt.Printf("Spendable: %s\n", formatAmount(spendable))
+	fmt.Printf("Frozen: %s\n", formatAmount(frozen))
+	if !result.SpendsKnown() {
+		fmt.Println("View-only wallet: spent outputs cannot be detected.")
+	}
+	
+	printResult(map[string]interface{}{
+		"outputs":      listed,
+		"spendable":    spendable,
+		"frozen":       frozen,
+		"spends_known": result.SpendsKnown(),
+	})
+}
+
+func contactsCommand(args []string) {
+	if len(args) < 1 {
+		printUsage()
+		usageExit()
+	}
+	
+	meta, err := loadMetadata()
+	if err != nil {
+		log.Fatalf("Failed to load wallet metadata: %v", err)
+	}
+	
+	switch args[0] {
+	case "add":
+		if len(args) < 3 {
+			fmt.Println("Usage: wallet contacts add <label> <address>")
+			usageExit()
+		}
+		if err := meta.AddContact(walletNetwork(), args[1], args[2]); err != nil {
+			log.Fatalf("Failed to add contact: %v", err)
+		}
+		if err := meta.Save(); err != nil {
+			log.Fatalf("Failed to save wallet metadata: %v", err)
+		}
+		fmt.Printf("Contact %s saved\n", args[1])
+		printResult(map[string]string{"label": args[1], "address": meta.Contacts[args[1]]})
+	case "list":
+		if len(meta.Contacts) == 0 {
+			fmt.Println("Address book is empty")
+		}
+		for _, label := range meta.ContactLabels() {
+			fmt.Printf("  %s  %s\n", label, meta.Contacts[label])
+		}
+		printResult(meta.Contacts)
+	case "remove":
+		if len(args) < 2 {
+			fmt.Println("Usage: wallet contacts remove <label>")
+			usageExit()
+		}
+		if err := meta.RemoveContact(args[1]); err != nil {
+			log.Fatalf("Failed to remove contact: %v", err)
+		}
+		if err := meta.Save(); err != nil {
+			log.Fatalf("Failed to save wallet metadata: %v", err)
+		}
+		fmt.Printf("Contact %s removed\n", args[1])
+		printResult(map[string]string{"removed": args[1]})
+	default:
+		fmt.Printf("Unknown contacts command: %s\n", args[0])
+		printUsage()
+		usageExit()
+	}
+}
+
+func settingsCommand(args []string) {
+	meta, err := loadMetadata()
+	if err != nil {
+		log.Fatalf("Failed to load wallet metadata: %v", err)
+	}
+	
+	if len(args) == 0 || args[0] == "show" {
+		settings := make(map[string]string, len(wallet.OutputOptions))
+		for _, name := range wallet.OutputOptions {
+			fmt.Printf("  %-16s %s\n", name, meta.OutputPolicy.Get(name))
+			settings[name] = meta.OutputPolicy.Get(name)
+		}
+		printResult(settings)
+		return
+	}
+	
+	if args[0] != "set" || len(args) < 3 {
+		fmt.Println("Usage: wallet settings set <name> <value>")
+		usageExit()
+	}
+	if err := meta.OutputPolicy.Set(args[1], args[2]); err != nil {
+		log.Fatalf("Failed to change setting: %v", err)
+	}
+	if err := meta.Save(); err != nil {
+		log.Fatalf("Failed to save wallet metadata: %v", err)
+	}
+	fmt.Printf("%s set to %s\n", args[1], meta.OutputPolicy.Get(args[1]))
+	printResult(map[string]string{args[1]: meta.OutputPolicy.Get(args[1])})
+}
+
+func accountsCommand(args []string) {
+	if len(args) < 1 {
+		printUsage()
+		usageExit()
+	}
+	
+	keys, err := loadWallet()
+	if err != nil {
+		log.Fatalf("Failed to load wallet: %v", err)
+	}
+	
+	meta, err := loadMetadata()
+	if err != nil {
+		log.Fatalf("Failed to load wallet metadata: %v", err)
+	}
+	
+	switch args[0] {
+	case "list":
+		result, err := syncChain(keys, meta)
+		if err != nil {
+			log.Fatalf("Failed to scan blockchain: %v", err)
+		}
+		
+		accounts := make([]map[string]interface{}, 0)
+		for _, account := range meta.Accounts() {
+			part := result.Account(account.Index)
+			amount := part.Balance()
+			if !result.SpendsKnown() {
+				amount = part.Received()
+			}
+			fmt.Printf("  %d  %-16s  balance=%s  subaddresses=%d\n", account.Index, account.Label, formatAmount(amount), account.Subaddresses)
+			accounts = append(accounts, map[string]interface{}{
+				"index":        account.Index,
+				"label":        account.Label,
+				"balance":      amount,
+				"subaddresses": account.Subaddresses,
+			})
+		}
+		if !result.SpendsKnown() {
+			fmt.Println()
+			fmt.Println("View-only wallet: balances are totals received.")
+		}
+		printResult(map[string]interface{}{"accounts": accounts, "spends_known": result.SpendsKnown()})
+	case "new":
+		if len(args) < 2 {
+			fmt.Println("Usage: wallet accounts new <label>")
+			usageExit()
+		}
+		account, err := meta.CreateAccount(args[1])
+		if err != nil {
+			log.Fatalf("Failed to create account: %v", err)
+		}
+		if err := meta.Save(); err != nil {
+			log.Fatalf("Failed to save wallet metadata: %v", err)
+		}
+		address := wallet.FormatAddress(walletNetwork(), wallet.SubaddressAddress(keys, wallet.SubaddressIndex{Account: account.Index}))
+		fmt.Printf("Account %s created with index %d\n", account.Label, account.Index)
+		fmt.Println("  Address:", address)
+		printResult(map[string]interface{}{"index": account.Index, "label": account.Label, "address": address})
+	case "rename":
+		if len(args) < 3 {
+			fmt.Println("Usage: wallet accounts rename <account> <label>")
+			usageExit()
+		}
+		account, err := meta.FindAccount(args[1])
+		if err != nil {
+			log.Fatalf("Failed to find account: %v", err)
+		}
+		if err := meta.RenameAccount(account, args[2]); err != nil {
+			log.Fatalf("Failed to rename account: %v", err)
+		}
+		if err := meta.Save(); err != nil {
+			log.Fatalf("Failed to save wallet metadata: %v", err)
+		}
+		fmt.Printf("Account %d renamed to %s\n", account.Index, args[2])
+		printResult(map[string]interface{}{"index": account.Index, "label": args[2]})
+	case "addresses":
+		account := selectedAccount()
+		fmt.Printf("Account %s (%d):\n", account.Label, account.Index)
+		addresses := make([]string, 0, account.Subaddresses)
+		network := walletNetwork()
+		for i := uint32(0); i < account.Subaddresses; i++ {
+			address := wallet.FormatAddress(network, wallet.SubaddressAddress(keys, wallet.SubaddressIndex{Account: account.Index, Index: i}))
+			fmt.Printf("  %d  %s\n", i, address)
+			addresses = append(addresses, address)
+		}
+		printResult(map[string]interface{}{"account": account.Index, "addresses": addresses})
+	case "new-address":
+		sub := meta.NewSubaddress(selectedAccount())
+		if err := meta.Save(); err != nil {
+			log.Fatalf("Failed to save wallet metadata: %v", err)
+		}
+		fmt.Printf("Subaddress %d of account %d:\n", sub.Index, sub.Account)
+		address := wallet.FormatAddress(walletNetwork(), wallet.SubaddressAddress(keys, sub))
+		fmt.Println(" ", address)
+		printResult(map[string]interface{}{
+			"account": sub.Account,
+			"index":   sub.Index,
+			"address": address,
+		})
+	default:
+		fmt.Printf("Unknown accounts command: %s\n", args[0])
+		printUsage()
+		usageExit()
+	}
+}
+
+func showHistory(args []string) {
+	var fromHeight uint64
+	if len(args) > 0 {
+		fmt.Sscanf(args[0], "%d", &fromHeight)
+	}
+	
+	keys, err := loadWallet()
+	if err != nil {
+		log.Fatalf("Failed to load wallet: %v", err)
+	}
+	
+	meta, err := loadMetadata()
+	if err != nil {
+		log.Fatalf("Failed to load wallet metadata: %v", err)
+	}
+	
+	result, err := scanAccount(keys, fromHeight)
+	if err != nil {
+		log.Fatalf("Failed to scan blockchain: %v", err)
+	}
+	
+	entries := wallet.BuildHistory(result, meta)
+	
+	fmt.Printf("Scanned up to height %d, found %d transactions\n", result.ScannedHeight, len(entries))
+	transfers := make([]wallet.TransferEntry, 0, len(entries))
+	for _, entry := range entries {
+		sign := "+"
+		if entry.Direction == wallet.DirectionOut {
+			sign = "-"
+		}
+		
+		fmt.Printf("  height=%d  %-3s  %s%s  %s",
+			entry.Height, entry.Direction, sign, formatAmount(entry.Amount), entry.TxHash.String()[:16])
+		for _, pid := range entry.PaymentIDs {
+			fmt.Printf("  payment_id=%s", pid)
+		}
+		for _, memo := range entry.Memos {
+			fmt.Printf("  memo=%q", memo)
+		}
+		if len(entry.Labels) > 0 {
+			fmt.Printf("  to=%s", strings.Join(entry.Labels, ","))
+		}
+		fmt.Println()
+		
+		transfer := wallet.TransferEntry{
+			TxHash:    entry.TxHash.String(),
+			Height:    entry.Height,
+			Direction: entry.Direction,
+			Amount:    entry.Amount,
+			Memos:     entry.Memos,
+			Labels:    entry.Labels,
+		}
+		for _, pid := range entry.PaymentIDs {
+			transfer.PaymentIDs = append(transfer.PaymentIDs, pid.String())
+		}
+		transfers = append(transfers, transfer)
+	}
+	
+	if result.ViewOnly {
+		fmt.Println()
+		fmt.Println("View-only wallet: outgoing transactions cannot be detected.")
+	}
+	
+	printResult(map[string]interface{}{"scanned_height": result.ScannedHeight, "transfers": transfers})
+}
+
+func multisigCommand(args []string) {
+	if len(args) < 1 {
+		printUsage()
+		usageExit()
+	}
+	
+	sub := args[0]
+	args = args[1:]
+	
+	switch sub {
+	case "export":
+		multisigExport(args)
+	case "import":
+		multisigImport(args)
+	case "address":
+		multisigAddress()
+	case "balance":
+		multisigBalance()
+	case "transfer":
+		multisigTransfer(args)
+	case "sign":
+		multisigSign(args)
+	default:
+		fmt.Printf("Unknown multisig command: %s\n", sub)
+		printUsage()
+		usageExit()
+	}
+}
+
+func multisigExport(args []string) {
+	filename := "multisig_info.json"
+	if len(args) > 0 {
+		filename = args[0]
+	}
+	
+	keys, err := loadWallet()
+	if err != nil {
+		log.Fatalf("Failed to load wallet: %v", err)
+	}
+	if !keys.CanSpend() {
+		log.Fatalf("A view-only wallet cannot join a multisig wallet")
+	}
+	
+	if err := writeJSON(filename, wallet.ExportMultisigInfo(keys)); err != nil {
+		log.Fatalf("Failed to save multisig info: %v", err)
+	}
+	if err := os.Chmod(filename, 0600); err != nil {
+		log.Fatalf("Failed to protect multisig info: %v", err)
+	}
+	
+	fmt.Printf("Multisig info saved to %s\n", filename)
+	fmt.Println("Share it only with the other participants: it contains your view key.")
+	
+	printResult(map[string]string{"file": filename})
+}
+
+func multisigImport(args []string) {
+	fs := flag.NewFlagSet("multisig import", flag.ExitOnError)
+	threshold := fs.Uint("threshold", 0, "Signatures required to spend (M)")
+	fs.Parse(args)
+	args = fs.Args()
+	
+	if *threshold == 0 || *threshold > 255 || len(args) < 1 {
+		fmt.Println("Usage: wallet multisig import -threshold M <info_file>...")
+		fmt.Println("Pass the info files of all other participants.")
+		usageExit()
+	}
+	
+	keys, err := loadWallet()
+	if err != nil {
+		log.Fatalf("Failed to load wallet: %v", err)
+	}
+	
+	// Our own info is always included
+	infos := []*wallet.MultisigInfo{wallet.ExportMultisigInfo(keys)}
+	for _, filename := range args {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			log.Fatalf("Failed to read %s: %v", filename, err)
+		}
+		var info wallet.MultisigInfo
+		if err := json.Unmarshal(data, &info); err != nil {
+			log.Fatalf("Invalid multisig info %s: %v", filename, err)
+		}
+		if info.SpendKey == keys.SpendKeyPair.PublicKey {
+			continue
+		}
+		infos = append(infos, &info)
+	}
+	
+	mw, err := wallet.NewMultisigWallet(keys, infos, uint8(*threshold))
+	if err != nil {
+		log.Fatalf("Failed to create multisig wallet: %v", err)
+	}
+	mw.Network = walletNetwork()
+	
+	if err := mw.Save(*msigFile); err != nil {
+		log.Fatalf("Failed to save multisig wallet: %v", err)
+	}
+	
+	fmt.Printf("%d-of-%d multisig wallet saved to %s\n", mw.Threshold, len(mw.Participants), *msigFile)
+	fmt.Println()
+	fmt.Println("Multisig address:")
+	fmt.Println(" ", wallet.FormatMultisigAddress(mw.Network, mw.Address()))
+	
+	printResult(multisigSummary(mw))
+}
+
+func multisigAddress() {
+	mw, err := wallet.LoadMultisig(*msigFile)
+	if err != nil {
+		log.Fatalf("Failed to load multisig wallet: %v", err)
+	}
+	
+	fmt.Printf("%d-of-%d multisig address:\n", mw.Threshold, len(mw.Participants))
+	fmt.Println(" ", wallet.FormatMultisigAddress(mw.Network, mw.Address()))
+	
+	printResult(multisigSummary(mw))
+}
+
+func multisigBalance() {
+	mw, err := wallet.LoadMultisig(*msigFile)
+	if err != nil {
+		log.Fatalf("Failed to load multisig wallet: %v", err)
+	}
+	
+	result, err := scanChain(mw.ScanKeys(), 0)
+	if err != nil {
+		log.Fatalf("Failed to scan blockchain: %v", err)
+	}
+	
+	fmt.Printf("Scanned up to height: %d\n", result.ScannedHeight)
+	fmt.Printf("Outputs found: %d\n", len(result.Outputs))
+	fmt.Printf("Balance: %s\n", formatAmount(result.Balance()))
+	
+	printResult(map[string]interface{}{
+		"scanned_height": result.ScannedHeight,
+		"outputs":        len(result.Outputs),
+		"balance":        result.Balance(),
+	})
+}
+
+func multisigTransfer(args []string) {
+	if len(args) < 2 {
+		fmt.Println("Usage: wallet multisig transfer <to> <amount> [file]")
+		usageExit()
+	}
+	
+	payment, err := parsePayment(args[0], args[1], "", "")
+	if err != nil {
+		log.Fatalf("Invalid payment: %v", err)
+	}
+	
+	filename := "multisig_tx.json"
+	if len(args) > 2 {
+		filename = args[2]
+	}
+	
+	mw, err := wallet.LoadMultisig(*msigFile)
+	if err != nil {
+		log.Fatalf("Failed to load multisig wallet: %v", err)
+	}
+	
+	result, err := scanChain(mw.ScanKeys(), 0)
+	if err != nil {
+		log.Fatalf("Failed to scan blockchain: %v", err)
+	}
+	
+	payments := []wallet.Payment{payment}
+	tx, err := mw.BuildTx(result, payments, wallet.RequiredFee(payments))
+	if err != nil {
+		log.Fatalf("Failed to build transaction: %v", err)
+	}
+	
+	saveMultisigTx(mw, tx, filename)
+}
+
+func multisigSign(args []string) {
+	if len(args) < 1 {
+		fmt.Println("Usage: wallet multisig sign <file>")
+		usageExit()
+	}
+	
+	mw, err := wallet.LoadMultisig(*msigFile)
+	if err != nil {
+		log.Fatalf("Failed to load multisig wallet: %v", err)
+	}
+	
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		log.Fatalf("Failed to read transaction: %v", err)
+	}
+	
+	var tx types.Transaction
+	if err := json.Unmarshal(data, &tx); err != nil {
+		log.Fatalf("Invalid transaction: %v", err)
+	}
+	
+	saveMultisigTx(mw, &tx, args[0])
+}
+
+// saveMultisigTx co-signs a multisig transaction and writes it back
+func saveMultisigTx(mw *wallet.MultisigWallet, tx *types.Transaction, filename string) {
+	id, err := chainID()
+	if err != nil {
+		log.Fatalf("Failed to get chain ID: %v", err)
+	}
+	
+	sigs, err := mw.Sign(tx, id)
+	if err != nil {
+		log.Fatalf("Failed to sign transaction: %v", err)
+	}
+	
+	if err := writeJSON(filename, tx); err != nil {
+		log.Fatalf("Failed to save transaction: %v", err)
+	}
+	
+	fmt.Printf("Transaction %s signed (%d of %d signatures)\n", tx.Hash().String()[:16], sigs, mw.Threshold)
+	printResult(map[string]interface{}{
+		"tx_hash":    tx.Hash().String(),
+		"file":       filename,
+		"signatures": sigs,
+		"threshold":  mw.Threshold,
+	})
+	if sigs < int(mw.Threshold) {
+		fmt.Printf("Send %s to another participant to run: wallet multisig sign %s\n", filename, filename)
+		return
+	}
+	fmt.Println("Ready to broadcast: wallet -node <url> submit", filename)
+}
+
+// multisigSummary is the -json result describing a multisig wallet
+func multisigSummary(mw *wallet.MultisigWallet) map[string]interface{} {
+	return map[string]interface{}{
+		"address":      wallet.FormatMultisigAddress(mw.Network, mw.Address()),
+		"threshold":    mw.Threshold,
+		"participants": len(mw.Participants),
+	}
+}
+
+func loadWallet() (*crypto.WalletKeys, error) {
+	if os.Getenv(sessionEnv) != "" {
+		return sessionKeys()
+	}
+	return wallet.Load(*walletFile)
+}
+
+// walletNetwork returns the network of the wallet file, which -network
+// must agree with. A wallet file not created yet is for -network.
+func walletNetwork() types.Network {
+	network, err := wallet.LoadNetwork(*walletFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return flagNetwork()
+	}
+	if err != nil {
+		log.Fatalf("Failed to read wallet network: %v", err)
+	}
+	if *networkArg != "" && types.Network(*networkArg) != network {
+		log.Fatalf("%s is a %s wallet, not %s", *walletFile, network, *networkArg)
+	}
+	return network
+}
+
+// flagNetwork returns the network chosen with -network, by default
+// testnet
+func flagNetwork() types.Network {
+	network := types.Network(*networkArg)
+	if err := network.Validate(); err != nil {
+		fmt.Println(err)
+		usageExit()
+	}
+	return network.OrDefault()
+}
+
+func loadMetadata() (*wallet.Metadata, error) {
+	return wallet.LoadMetadata(wallet.MetadataPath(*walletFile))
+}
+
+// selectedAccount returns the account chosen with -account
+func selectedAccount() *wallet.Account {
+	meta, err := loadMetadata()
+	if err != nil {
+		log.Fatalf("Failed to load wallet metadata: %v", err)
+	}
+	
+	if *accountArg == "" {
+		return meta.Accounts()[wallet.PrimaryAccount]
+	}
+	account, err := meta.FindAccount(*accountArg)
+	if err != nil {
+		log.Fatalf("Invalid -account: %v", err)
+	}
+	return account
+}
+
+func swapCommand(args []string) {
+	if len(args) < 1 {
+		printUsage()
+		usageExit()
+	}
+	
+	sub := args[0]
+	args = args[1:]
+	
+	switch sub {
+	case "key":
+		swapKey()
+	case "initiate":
+		swapLock(args, true)
+	case "participate":
+		swapLock(args, false)
+	case "inspect":
+		swapInspect(args)
+	case "redeem":
+		swapRedeem(args)
+	case "refund":
+		swapRefund(args)
+	default:
+		fmt.Printf("Unknown swap command: %s\n", sub)
+		printUsage()
+		usageExit()
+	}
+}
+
+func swapKey() {
+	keys, err := loadWallet()
+	if err != nil {
+		log.Fatalf("Failed to load wallet: %v", err)
+	}
+	meta, err := loadMetadata()
+	if err != nil {
+		log.Fatalf("Failed to load wallet metadata: %v", err)
+	}
+	
+	key, err := meta.NewSwapKey(keys)
+	if err != nil {
+		log.Fatalf("Failed to derive swap key: %v", err)
+	}
+	if err := meta.Save(); err != nil {
+		log.Fatalf("Failed to save wallet metadata: %v", err)
+	}
+	
+	fmt.Println("Swap key:", key.PublicKey)
+	fmt.Println("Give it to your counterparty; they lock their coins to it.")
+	
+	printResult(map[string]string{"swap_key": key.PublicKey.String()})
+}
+
+// swapLock locks coins in a swap contract paying the counterparty's
+// swap key. The initiator creates the secret; the participant locks to
+// the hash of the initiator's secret with a shorter timeout.
+func swapLock(args []string, initiator bool) {
+	name, usage, timeout := "participate", "<their_swap_key> <hash> <amount>", uint64(wallet.DefaultParticipantTimeout)
+	if initiator {
+		name, usage, timeout = "initiate", "<their_swap_key> <amount>", wallet.DefaultInitiatorTimeout
+	}
+	
+	fs := flag.NewFlagSet("swap "+name, flag.ExitOnError)
+	timeoutBlocks := fs.Uint64("timeout", timeout, "Blocks until the locked amount can be refunded")
+	fs.Parse(args)
+	args = fs.Args()
+	
+	want := 2
+	if !initiator {
+		want = 3
+	}
+	if len(args) < want {
+		fmt.Printf("Usage: wallet swap %s [-timeout blocks] %s\n", name, usage)
+		usageExit()
+	}
+	
+	theirKey, err := wallet.ParseSwapKey(args[0])
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	amount, err := parseAmount(args[want-1])
+	if err != nil || amount == 0 {
+		log.Fatalf("Invalid amount: %s", args[want-1])
+	}
+	
+	var secret []byte
+	var hash types.Hash
+	if initiator {
+		secret, hash, err = wallet.NewSwapSecret()
+	} else {
+		hash, err = wallet.ParseSwapHash(args[1])
+	}
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	
+	keys, err := loadWallet()
+	if err != nil {
+		log.Fatalf("Failed to load wallet: %v", err)
+	}
+	if !keys.CanSpend() {
+		log.Fatalf("Cannot lock coins from a view-only wallet")
+	}
+	meta, err := loadMetadata()
+	if err != nil {
+		log.Fatalf("Failed to load wallet metadata: %v", err)
+	}
+	
+	refundKey, err := meta.NewSwapKey(keys)
+	if err != nil {
+		log.Fatalf("Failed to derive swap key: %v", err)
+	}
+	lock := &types.HashLock{
+		Hash:         hash,
+		RecipientKey: theirKey,
+		RefundKey:    refundKey.PublicKey,
+		RefundHeight: chainHeight() + *timeoutBlocks,
+	}
+	
+	unsigned, _, err := buildUnsigned(keys, wallet.Payment{Amount: amount, HashLock: lock}, "", false)
+	if err != nil {
+		log.Fatalf("Failed to build transaction: %v", err)
+	}
+	tx, err := unsigned.Sign(keys)
+	if err != nil {
+		log.Fatalf("Failed to sign transaction: %v", err)
+	}
+	
+	// Keep the secret and refund key before anything is broadcast
+	if initiator {
+		meta.SaveSwapSecret(secret)
+	}
+	if err := meta.Save(); err != nil {
+		log.Fatalf("Failed to save wallet metadata: %v", err)
+	}
+	
+	var index uint32
+	for i, out := range tx.Outputs {
+		if out.HashLock != nil {
+			index = uint32(i)
+		}
+	}
+	
+	fmt.Println("Swap contract created:")
+	fmt.Printf("  Output: %s\n", wallet.FormatOutputRef(tx.Hash(), index))
+	fmt.Printf("  Amount: %s\n", formatAmount(amount))
+	fmt.Printf("  Hash: %s\n", hash)
+	fmt.Printf("  Refundable from height: %d\n", lock.RefundHeight)
+	fmt.Println()
+	if initiator {
+		fmt.Println("The secret is saved in the wallet metadata and revealed when you redeem.")
+	}
+	fmt.Println("Send the output and hash to your counterparty, who checks them with: wallet swap inspect <output>")
+	fmt.Println()
+	
+	submitOrSave(tx, map[string]interface{}{
+		"output":        wallet.FormatOutputRef(tx.Hash(), index),
+		"amount":        amount,
+		"hash":          hash.String(),
+		"refund_height": lock.RefundHeight,
+	})
+}
+
+func swapInspect(args []string) {
+	if len(args) < 1 {
+		fmt.Println("Usage: wallet swap inspect <tx_hash>:<index>")
+		usageExit()
+	}
+	
+	out := findHashLock(args[0])
+	lock := out.Lock
+	
+	fmt.Printf("Swap contract %s:\n", out.Ref())
+	fmt.Printf("  Amount: %s\n", formatAmount(out.Amount))
+	fmt.Printf("  Hash: %s\n", lock.Hash)
+	fmt.Printf("  Recipient key: %s%s\n", lock.RecipientKey, swapKeyNote(lock.RecipientKey))
+	fmt.Printf("  Refund key: %s%s\n", lock.RefundKey, swapKeyNote(lock.RefundKey))
+	fmt.Printf("  Created at height: %d\n", out.BlockHeight)
+	fmt.Printf("  Refundable from height: %d\n", lock.RefundHeight)
+	
+	result := map[string]interface{}{
+		"output":         out.Ref(),
+		"amount":         out.Amount,
+		"hash":           lock.Hash.String(),
+		"recipient_key":  lock.RecipientKey.String(),
+		"refund_key":     lock.RefundKey.String(),
+		"created_height": out.BlockHeight,
+		"refund_height":  lock.RefundHeight,
+	}
+	switch {
+	case !out.Spent:
+		fmt.Println("  Status: locked")
+		result["status"] = "locked"
+	case len(out.Preimage) > 0:
+		fmt.Printf("  Status: redeemed in %s\n", out.SpentTxHash)
+		fmt.Printf("  Secret: %s\n", hex.EncodeToString(out.Preimage))
+		result["status"], result["spent_tx_hash"] = "redeemed", out.SpentTxHash.String()
+		result["secret"] = hex.EncodeToString(out.Preimage)
+	default:
+		fmt.Printf("  Status: refunded in %s\n", out.SpentTxHash)
+		result["status"], result["spent_tx_hash"] = "refunded", out.SpentTxHash.String()
+	}
+	printResult(result)
+}
+
+func swapRedeem(args []string) {
+	if len(args) < 1 {
+		fmt.Println("Usage: wallet swap redeem <tx_hash>:<index> [secret]")
+		usageExit()
+	}
+	
+	keys, meta := loadSwapWallet()
+	out := findHashLock(args[0])
+	
+	key, err := meta.FindSwapKey(keys, out.Lock.RecipientKey)
+	if err != nil {
+		log.Fatalf("Cannot redeem %s: %v", out.Ref(), err)
+	}
+	
+	// The initiator has the secret; the participant takes it from the
+	// initiator's redeem on the other chain
+	secret, ok := meta.SwapSecret(out.Lock.Hash)
+	if len(args) > 1 {
+		if secret, err = hex.DecodeString(args[1]); err != nil || len(secret) == 0 {
+			log.Fatalf("Invalid secret")
+		}
+	} else if !ok {
+		log.Fatalf("No secret saved for hash %s; pass the secret revealed by your counterparty", out.Lock.Hash)
+	}
+	
+	spendHashLock(keys, out, secret, key)
+}
+
+func swapRefund(args []string) {
+	if len(args) < 1 {
+		fmt.Println("Usage: wallet swap refund <tx_hash>:<index>")
+		usageExit()
+	}
+	
+	keys, meta := loadSwapWallet()
+	out := findHashLock(args[0])
+	
+	key, err := meta.FindSwapKey(keys, out.Lock.RefundKey)
+	if err != nil {
+		log.Fatalf("Cannot refund %s: %v", out.Ref(), err)
+	}
+	if next := chainHeight() + 1; next < out.Lock.RefundHeight {
+		log.Fatalf("Swap can be refunded from height %d, the next block is %d", out.Lock.RefundHeight, next)
+	}
+	
+	spendHashLock(keys, out, nil, key)
+}
+
+// spendHashLock redeems or refunds a swap contract to the wallet
+func spendHashLock(keys *crypto.WalletKeys, out *wallet.HashLockOutput, secret []byte, key *crypto.KeyPair) {
+	chain, closeChain, err := openChain()
+	if err != nil {
+		log.Fatalf("Failed to open chain: %v", err)
+	}
+	fee, err := wallet.SuggestFee(chain, nil)
+	if err != nil {
+		closeChain()
+		log.Fatalf("Failed to get fee: %v", err)
+	}
+	tx, err := wallet.BuildHashLockSpend(keys, chain, out, secret, key, fee)
+	closeChain()
+	if err != nil {
+		log.Fatalf("Failed to build transaction: %v", err)
+	}
+	
+	fmt.Printf("Moving %s from %s to this wallet (fee %s)\n", formatAmount(out.Amount-tx.Fee), out.Ref(), formatAmount(tx.Fee))
+	fmt.Printf("  Hash: %s\n", tx.Hash())
+	fmt.Println()
+	submitOrSave(tx, map[string]interface{}{"output": out.Ref(), "amount": out.Amount - tx.Fee})
+}
+
+// loadSwapWallet loads a wallet able to sign swap spends and its metadata
+func loadSwapWallet() (*crypto.WalletKeys, *wallet.Metadata) {
+	keys, err := loadWallet()
+	if err != nil {
+		log.Fatalf("Failed to load wallet: %v", err)
+	}
+	if !keys.CanSpend() {
+		log.Fatalf("View-only wallets cannot spend swap contracts")
+	}
+	meta, err := loadMetadata()
+	if err != nil {
+		log.Fatalf("Failed to load wallet metadata: %v", err)
+	}
+	return keys, meta
+}
+
+// findHashLock looks up a swap contract by output reference
+func findHashLock(ref string) *wallet.HashLockOutput {
+	txHash, index, err := wallet.ParseOutputRef(ref)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	
+	chain, closeChain, err := openChain()
+	if err != nil {
+		log.Fatalf("Failed to open chain: %v", err)
+	}
+	defer closeChain()
+	
+	out, err := wallet.FindHashLock(chain, txHash, index)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	return out
+}
+
+// swapKeyNote marks swap keys that belong to this wallet
+func swapKeyNote(key types.PublicKey) string {
+	keys, err := loadWallet()
+	if err != nil || !keys.CanSpend() {
+		return ""
+	}
+	meta, err := loadMetadata()
+	if err != nil {
+		return ""
+	}
+	if _, err := meta.FindSwapKey(keys, key); err == nil {
+		return " (yours)"
+	}
+	return ""
+}
+
+// chainHeight returns the latest block height
+func chainHeight() uint64 {
+	chain, closeChain, err := openChain()
+	if err != nil {
+		log.Fatalf("Failed to open chain: %v", err)
+	}
+	defer closeChain()
+	
+	height, err := chain.GetLatestHeight()
+	if err != nil {
+		log.Fatalf("Failed to get chain height: %v", err)
+	}
+	return height
+}
+
+// submitOrSave broadcasts a transaction when connected to a node, and
+// otherwise saves it for 'wallet submit'. The -json result is result
+// with the transaction's hash, fee and fate added.
+func submitOrSave(tx *types.Transaction, result map[string]interface{}) {
+	result["tx_hash"] = tx.Hash().String()
+	result["fee"] = tx.Fee
+	
+	if *nodeURL != "" {
+		fmt.Println("Broadcasting to network...")
+		if err := submitToNode(tx); err != nil {
+			log.Fatalf("Failed to submit transaction: %v", err)
+		}
+		fmt.Println("Transaction submitted")
+		result["submitted"] = true
+		printResult(result)
+		return
+	}
+	
+	txFile := fmt.Sprintf("tx_%s.json", tx.Hash().String()[:8])
+	if err := writeJSON(txFile, tx); err != nil {
+		log.Fatalf("Failed to save transaction: %v", err)
+	}
+	fmt.Printf("Transaction saved to %s\n", txFile)
+	fmt.Println("Submit it with: wallet -node <url> submit", txFile)
+	result["submitted"] = false
+	result["file"] = txFile
+	printResult(result)
+}
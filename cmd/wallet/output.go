@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+// Exit codes, so scripts can tell a failed command from a mistyped one
+const (
+	exitFailure = 1 // The command failed (log.Fatalf)
+	exitUsage   = 2 // Bad arguments, as for flag parsing errors
+)
+
+var (
+	jsonOutput = flag.Bool("json", false, "Print each command's result as JSON on stdout (messages go to stderr)")
+	quiet      = flag.Bool("quiet", false, "Print nothing but errors (and the JSON result with -json)")
+
+	// resultOut receives -json results; stdout may be redirected for
+	// human-readable messages
+	resultOut io.Writer = os.Stdout
+)
+
+// setupOutput applies -json and -quiet. Commands print messages for
+// people to os.Stdout, so it is pointed at stderr or discarded, leaving
+// the real stdout to the result alone.
+func setupOutput() {
+	switch {
+	case *quiet:
+		devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+		if err == nil {
+			os.Stdout = devNull
+		}
+	case *jsonOutput:
+		os.Stdout = os.Stderr
+	}
+
+	if *jsonOutput {
+		log.SetFlags(0)
+		log.SetOutput(jsonErrorWriter{os.Stderr})
+	}
+}
+
+// printResult prints the result of a command with -json
+func printResult(v interface{}) {
+	if !*jsonOutput {
+		return
+	}
+	enc := json.NewEncoder(resultOut)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	enc.Encode(v)
+}
+
+// usageExit exits after a usage message
+func usageExit() {
+	os.Exit(exitUsage)
+}
+
+// jsonErrorWriter writes log messages, such as those of log.Fatalf, as
+// {"error": message}
+type jsonErrorWriter struct {
+	w io.Writer
+}
+
+func (j jsonErrorWriter) Write(p []byte) (int, error) {
+	enc := json.NewEncoder(j.w)
+	enc.SetEscapeHTML(false) // Usage messages are full of <args>
+	if err := enc.Encode(map[string]string{"error": strings.TrimRight(string(p), "\n")}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,504 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"blockchain/crypto"
+	"blockchain/wallet"
+)
+
+// sessionEnv is set for commands run from the wallet shell. They read
+// the session's keys from stdin instead of the wallet file.
+const sessionEnv = "APEX_WALLET_SESSION"
+
+// DefaultLockAfter is how long a shell session stays unlocked while idle
+const DefaultLockAfter = 5 * time.Minute
+
+// shellCommands are the wallet commands the shell runs, with the
+// subcommands it completes
+var shellCommands = map[string][]string{
+	"generate":           nil,
+	"address":            nil,
+	"export-viewkey":     nil,
+	"export-key-images":  nil,
+	"import-key-images":  nil,
+	"forget-remote-scan": nil,
+	"integrated-address": nil,
+	"send":               nil,
+	"burn":               nil,
+	"create-unsigned":    nil,
+	"construction-data":  nil,
+	"build-offline":      nil,
+	"sign":               nil,
+	"submit":             nil,
+	"sponsor":            nil,
+	"balance":            nil,
+	"scan":               nil,
+	"stake":              nil,
+	"set-commission":     nil,
+	"unjail":             nil,
+	"unbond":             nil,
+	"release":            nil,
+	"submit-staking":     nil,
+	"get-tx-key":         nil,
+	"prove":              nil,
+	"verify-proof":       nil,
+	"serve":              nil,
+	"history":            nil,
+	"utxos":              {"list", "freeze", "unfreeze"},
+	"contacts":           {"add", "list", "remove"},
+	"settings":           {"set"},
+	"accounts":           {"list", "new", "rename", "addresses", "new-address"},
+	"multisig":           {"export", "import", "address", "balance", "transfer", "sign"},
+	"swap":               {"key", "initiate", "participate", "inspect", "redeem", "refund"},
+}
+
+// shellBuiltins are handled by the shell itself
+var shellBuiltins = []string{"help", "lock", "unlock", "exit", "quit"}
+
+// sessionKeys reads the keys sent by the wallet shell, once
+var sessionKeys = sync.OnceValues(func() (*crypto.WalletKeys, error) {
+	var keys crypto.WalletKeys
+	if err := json.NewDecoder(os.Stdin).Decode(&keys); err != nil {
+		return nil, fmt.Errorf("failed to read keys from the wallet shell: %w", err)
+	}
+	return &keys, nil
+})
+
+// shell is an interactive wallet session. It loads the wallet keys once
+// and runs each command as a child process given those keys, so a
+// failing command does not end the session.
+type shell struct {
+	exe       string
+	globals   []string // Global flags passed to every command
+	lockAfter time.Duration
+
+	keys   *crypto.WalletKeys // Nil while locked
+	input  chan byte          // Closed at the end of input
+	fd     int
+	prompt bool // Whether stdin is a terminal
+
+	history []string
+}
+
+func walletShell(args []string) {
+	fs := flag.NewFlagSet("shell", flag.ExitOnError)
+	lockAfter := fs.Duration("lock-after", DefaultLockAfter, "Lock the session after this long without input (0 to never lock)")
+	fs.Parse(args)
+
+	if *jsonOutput || *quiet {
+		log.Print("Usage: wallet shell is interactive; pass -json or -quiet to commands run from it instead")
+		usageExit()
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		log.Fatalf("Failed to find the wallet binary: %v", err)
+	}
+
+	s := &shell{
+		exe:       exe,
+		globals:   globalFlags(),
+		lockAfter: *lockAfter,
+		input:     make(chan byte),
+		fd:        int(os.Stdin.Fd()),
+	}
+	if info, err := os.Stdin.Stat(); err == nil {
+		s.prompt = info.Mode()&os.ModeCharDevice != 0
+	}
+	if err := s.unlock(); err != nil {
+		log.Fatalf("Failed to load wallet: %v", err)
+	}
+
+	// Ctrl-C stops the running command, not the shell
+	signal.Notify(make(chan os.Signal, 1), os.Interrupt)
+
+	go readInput(os.Stdin, s.input)
+
+	fmt.Println("Wallet shell. Type 'help' for commands, Tab to complete, 'exit' to leave.")
+	for {
+		line, ok := s.readLine()
+		if !ok {
+			break
+		}
+		words, err := splitArgs(line)
+		if err != nil {
+			fmt.Println("Error:", err)
+			continue
+		}
+		if len(words) == 0 {
+			continue
+		}
+		if !s.run(words) {
+			break
+		}
+	}
+	s.lock()
+}
+
+// run runs one command line and reports whether the session goes on
+func (s *shell) run(words []string) bool {
+	switch words[0] {
+	case "exit", "quit":
+		return false
+	case "help":
+		printUsage()
+		fmt.Println()
+		fmt.Println("Shell commands (type commands without 'wallet'; global flags apply to all):")
+		fmt.Println("  lock                         - Forget the keys until 'unlock'")
+		fmt.Println("  unlock                       - Load the wallet keys again")
+		fmt.Println("  exit                         - Leave the shell")
+		return true
+	case "lock":
+		s.lock()
+		fmt.Println("Session locked")
+		return true
+	case "unlock":
+		if err := s.unlock(); err != nil {
+			fmt.Println("Failed to unlock:", err)
+		}
+		return true
+	case "shell":
+		fmt.Println("Already in the wallet shell")
+		return true
+	}
+
+	if _, ok := shellCommands[words[0]]; !ok {
+		fmt.Printf("Unknown command: %s (type 'help' for commands)\n", words[0])
+		return true
+	}
+	if s.keys == nil {
+		fmt.Println("Session is locked; type 'unlock' to continue")
+		return true
+	}
+
+	keys, err := json.Marshal(s.keys)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return true
+	}
+	cmd := exec.Command(s.exe, append(slices.Clone(s.globals), words...)...)
+	cmd.Env = append(os.Environ(), sessionEnv+"=1")
+	cmd.Stdin = bytes.NewReader(keys)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			fmt.Printf("Failed to run %s: %v\n", words[0], err)
+		}
+	}
+	return true
+}
+
+// unlock loads the wallet keys for the session
+func (s *shell) unlock() error {
+	keys, err := wallet.Load(*walletFile)
+	if err != nil {
+		return err
+	}
+	s.lock()
+	s.keys = keys
+
+	addr := wallet.FormatAddress(walletNetwork(), keys.GetAddress())
+	if keys.CanSpend() {
+		fmt.Printf("Unlocked %s (%s)\n", *walletFile, addr)
+	} else {
+		fmt.Printf("Unlocked view-only wallet %s (%s)\n", *walletFile, addr)
+	}
+	return nil
+}
+
+// lock wipes the session's private keys
+func (s *shell) lock() {
+	if s.keys == nil {
+		return
+	}
+	for _, kp := range []*crypto.KeyPair{s.keys.ViewKeyPair, s.keys.SpendKeyPair} {
+		if kp != nil {
+			clear(kp.PrivateKey)
+		}
+	}
+	s.keys = nil
+}
+
+// readLine reads a command line. On a terminal it edits the line in raw
+// mode, completing words on Tab and recalling earlier lines with the
+// arrow keys. The session locks if no key is pressed for lockAfter.
+func (s *shell) readLine() (string, bool) {
+	raw := false
+	if s.prompt {
+		if restore, err := makeRaw(s.fd); err == nil {
+			defer restore()
+			raw = true
+		}
+	}
+
+	var line []byte
+	recall := len(s.history) // History entry shown by the arrow keys
+	redraw := func() {
+		if raw {
+			fmt.Print("\r\x1b[K")
+		}
+		if s.prompt {
+			fmt.Print(s.promptText(), string(line))
+		}
+	}
+	show := func(msg string) {
+		fmt.Print("\r\n", msg, "\r\n")
+		redraw()
+	}
+	setLine := func(text string) {
+		line = append(line[:0], text...)
+		redraw()
+	}
+	next := func() byte {
+		return <-s.input
+	}
+
+	var idle <-chan time.Time
+	var timer *time.Timer
+	if s.lockAfter > 0 && s.keys != nil {
+		timer = time.NewTimer(s.lockAfter)
+		defer timer.Stop()
+		idle = timer.C
+	}
+
+	redraw()
+	for {
+		var b byte
+		var ok bool
+		select {
+		case b, ok = <-s.input:
+			if !ok {
+				if s.prompt {
+					fmt.Println()
+				}
+				return string(line), len(line) > 0
+			}
+		case <-idle:
+			s.lock()
+			idle = nil
+			show(fmt.Sprintf("Session locked after %v without input; type 'unlock' to continue", s.lockAfter))
+			continue
+		}
+		if idle != nil {
+			timer.Reset(s.lockAfter)
+		}
+
+		if !raw {
+			switch b {
+			case '\n':
+				return string(line), true
+			case '\r':
+			default:
+				line = append(line, b)
+			}
+			continue
+		}
+
+		switch b {
+		case '\r', '\n':
+			fmt.Print("\r\n")
+			text := string(line)
+			if strings.TrimSpace(text) != "" && (len(s.history) == 0 || s.history[len(s.history)-1] != text) {
+				s.history = append(s.history, text)
+			}
+			return text, true
+		case 3: // Ctrl-C
+			fmt.Print("^C\r\n")
+			setLine("")
+		case 4: // Ctrl-D
+			if len(line) == 0 {
+				fmt.Print("\r\n")
+				return "", false
+			}
+		case 21: // Ctrl-U
+			setLine("")
+		case 8, 127: // Backspace
+			if len(line) > 0 {
+				_, size := utf8.DecodeLastRune(line)
+				setLine(string(line[:len(line)-size]))
+			}
+		case '\t':
+			prefix, matches := complete(string(line))
+			common := commonPrefix(matches)
+			if len(matches) == 1 {
+				common += " "
+			}
+			switch {
+			case len(common) > len(prefix):
+				setLine(string(line) + common[len(prefix):])
+			case len(matches) > 1:
+				show(strings.Join(matches, "  "))
+			}
+		case 27: // Escape sequence; the up and down arrows recall history
+			if c := next(); c != '[' && c != 'O' {
+				continue
+			}
+			c := next()
+			for c >= '0' && c <= '9' || c == ';' {
+				c = next()
+			}
+			switch {
+			case c == 'A' && recall > 0:
+				recall--
+				setLine(s.history[recall])
+			case c == 'B' && recall < len(s.history):
+				recall++
+				if recall == len(s.history) {
+					setLine("")
+				} else {
+					setLine(s.history[recall])
+				}
+			}
+		default:
+			if b >= ' ' {
+				line = append(line, b)
+				os.Stdout.Write([]byte{b})
+			}
+		}
+	}
+}
+
+// promptText returns the prompt, which shows whether the session is
+// locked
+func (s *shell) promptText() string {
+	if s.keys == nil {
+		return "wallet (locked)> "
+	}
+	return "wallet> "
+}
+
+// readInput sends the bytes read from r to input
+func readInput(r io.Reader, input chan<- byte) {
+	defer close(input)
+	buf := make([]byte, 256)
+	for {
+		n, err := r.Read(buf)
+		for _, b := range buf[:n] {
+			input <- b
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// globalFlags returns the global flags given on the command line, to
+// pass on to commands run from the shell
+func globalFlags() []string {
+	var args []string
+	flag.Visit(func(f *flag.Flag) {
+		args = append(args, "-"+f.Name+"="+f.Value.String())
+	})
+	return args
+}
+
+// complete returns the last word of line and the words it may be
+// completed to
+func complete(line string) (string, []string) {
+	words := strings.Fields(line)
+	if len(words) == 0 || strings.HasSuffix(line, " ") {
+		words = append(words, "")
+	}
+
+	var options []string
+	switch len(words) {
+	case 1:
+		options = slices.Clone(shellBuiltins)
+		for name := range shellCommands {
+			options = append(options, name)
+		}
+	case 2:
+		options = shellCommands[words[0]]
+	}
+
+	prefix := words[len(words)-1]
+	var matches []string
+	for _, option := range options {
+		if strings.HasPrefix(option, prefix) {
+			matches = append(matches, option)
+		}
+	}
+	sort.Strings(matches)
+	return prefix, matches
+}
+
+// commonPrefix returns the longest prefix shared by words
+func commonPrefix(words []string) string {
+	if len(words) == 0 {
+		return ""
+	}
+	prefix := words[0]
+	for _, w := range words[1:] {
+		for !strings.HasPrefix(w, prefix) {
+			_, size := utf8.DecodeLastRuneInString(prefix)
+			prefix = prefix[:len(prefix)-size]
+		}
+	}
+	return prefix
+}
+
+// splitArgs splits a command line into words. Single and double quotes
+// group words with spaces, and a backslash escapes the next character.
+func splitArgs(line string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\\' && quote != '\'':
+			if i+1 >= len(runes) {
+				return nil, errors.New("trailing backslash")
+			}
+			i++
+			word.WriteRune(runes[i])
+			inWord = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("unterminated quote")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
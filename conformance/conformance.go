@@ -0,0 +1,141 @@
+// Package conformance records and checks state transition vectors: a
+// genesis, a sequence of blocks, and the state every block leads to. A
+// suite recorded from one node lets refactors and other
+// implementations prove they reach the same state roots.
+package conformance
+
+import (
+	"errors"
+	"fmt"
+
+	"blockchain/ledger"
+	"blockchain/types"
+)
+
+// FormatSuite identifies conformance suite files
+const FormatSuite = "conformance-suite"
+
+// Suite is a genesis and the blocks applied to it, each with the state
+// it must produce
+type Suite struct {
+	Format  string               `json:"format"`
+	Genesis *types.GenesisConfig `json:"genesis"`
+	Steps   []*Step              `json:"steps"`
+}
+
+// Step is one block and the state after applying it
+type Step struct {
+	Block    *types.Block `json:"block"`
+	Expected Expected     `json:"expected"`
+}
+
+// Expected is the state a block must lead to. Validators is the active
+// set, ranked by stake.
+type Expected struct {
+	Height      uint64            `json:"height"`
+	StateRoot   types.Hash        `json:"state_root"`
+	TotalSupply uint64            `json:"total_supply"`
+	Supply      types.SupplyStats `json:"supply"`
+	Validators  []Validator       `json:"validators"`
+}
+
+// Validator is an active validator and its stake
+type Validator struct {
+	PublicKey    types.PublicKey `json:"public_key"`
+	StakedAmount uint64          `json:"staked_amount"`
+}
+
+// Record applies blocks to the genesis state, in height order starting
+// at 1, and captures the state after each
+func Record(genesis *types.GenesisConfig, blocks []*types.Block) (*Suite, error) {
+	state, err := newState(genesis)
+	if err != nil {
+		return nil, err
+	}
+
+	suite := &Suite{Format: FormatSuite, Genesis: genesis, Steps: make([]*Step, 0, len(blocks))}
+	for _, block := range blocks {
+		if err := state.ApplyBlock(block); err != nil {
+			return nil, fmt.Errorf("block %d: %w", block.Header.Height, err)
+		}
+		suite.Steps = append(suite.Steps, &Step{Block: block, Expected: capture(state)})
+	}
+	return suite, nil
+}
+
+// Check replays the suite and fails at the first block that is
+// rejected or leads to another state. It returns the number of steps
+// that matched.
+func (s *Suite) Check() (int, error) {
+	if s.Format != FormatSuite {
+		return 0, errors.New("not a conformance suite")
+	}
+	if s.Genesis == nil {
+		return 0, errors.New("conformance suite has no genesis")
+	}
+	state, err := newState(s.Genesis)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, step := range s.Steps {
+		if step == nil || step.Block == nil {
+			return i, fmt.Errorf("step %d has no block", i)
+		}
+		if err := state.ApplyBlock(step.Block); err != nil {
+			return i, fmt.Errorf("block %d: %w", step.Block.Header.Height, err)
+		}
+		if err := compare(step.Expected, capture(state)); err != nil {
+			return i, fmt.Errorf("block %d: %w", step.Block.Header.Height, err)
+		}
+	}
+	return len(s.Steps), nil
+}
+
+func newState(genesis *types.GenesisConfig) (*ledger.State, error) {
+	state := ledger.NewState()
+	if err := state.InitializeGenesis(genesis); err != nil {
+		return nil, fmt.Errorf("invalid genesis: %w", err)
+	}
+	return state, nil
+}
+
+// capture reads the state a step checks
+func capture(state *ledger.State) Expected {
+	active := state.GetActiveValidators()
+	validators := make([]Validator, len(active))
+	for i, val := range active {
+		validators[i] = Validator{PublicKey: val.PublicKey, StakedAmount: val.StakedAmount}
+	}
+	return Expected{
+		Height:      state.GetHeight(),
+		StateRoot:   state.ComputeStateRoot(),
+		TotalSupply: state.GetTotalSupply(),
+		Supply:      state.SupplyStats(),
+		Validators:  validators,
+	}
+}
+
+// compare reports the first field in which got differs from want
+func compare(want, got Expected) error {
+	switch {
+	case got.Height != want.Height:
+		return fmt.Errorf("height %d, expected %d", got.Height, want.Height)
+	case got.StateRoot != want.StateRoot:
+		return fmt.Errorf("state root %s, expected %s", got.StateRoot, want.StateRoot)
+	case got.TotalSupply != want.TotalSupply:
+		return fmt.Errorf("total supply %d, expected %d", got.TotalSupply, want.TotalSupply)
+	case got.Supply != want.Supply:
+		return fmt.Errorf("supply %+v, expected %+v", got.Supply, want.Supply)
+	case len(got.Validators) != len(want.Validators):
+		return fmt.Errorf("%d active validators, expected %d", len(got.Validators), len(want.Validators))
+	}
+	for i := range want.Validators {
+		if got.Validators[i] != want.Validators[i] {
+			return fmt.Errorf("active validator %d is %x with stake %d, expected %x with stake %d",
+				i, got.Validators[i].PublicKey[:8], got.Validators[i].StakedAmount,
+				want.Validators[i].PublicKey[:8], want.Validators[i].StakedAmount)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,405 @@
+package conformance
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+
+	"blockchain/crypto"
+	"blockchain/ledger"
+	"blockchain/types"
+)
+
+// update rewrites the golden suites instead of checking them. Blocks are
+// signed with fresh keys, so every file changes; only update after a
+// deliberate change of the state transition.
+var update = flag.Bool("update", false, "rewrite the golden suites in testdata")
+
+// goldenSuites builds each suite in testdata
+var goldenSuites = map[string]func(*testing.T) *Suite{
+	"transfers.json": transfersSuite,
+	"upgrades.json":  upgradesSuite,
+}
+
+// TestGoldenSuites replays every suite in testdata through the ledger
+func TestGoldenSuites(t *testing.T) {
+	if *update {
+		for name, build := range goldenSuites {
+			data, err := json.MarshalIndent(build(t), "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join("testdata", name), append(data, '\n'), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	files, err := filepath.Glob(filepath.Join("testdata", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) < len(goldenSuites) {
+		t.Fatalf("found %d suites in testdata, expected %d", len(files), len(goldenSuites))
+	}
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var suite Suite
+			if err := json.Unmarshal(data, &suite); err != nil {
+				t.Fatal(err)
+			}
+			matched, err := suite.Check()
+			if err != nil {
+				t.Fatalf("after %d of %d blocks: %v", matched, len(suite.Steps), err)
+			}
+			if matched == 0 {
+				t.Fatal("suite has no blocks")
+			}
+		})
+	}
+}
+
+// TestCheckDetectsChanges checks that a suite fails once a block or an
+// expected state is changed
+func TestCheckDetectsChanges(t *testing.T) {
+	suite := transfersSuite(t)
+	if _, err := suite.Check(); err != nil {
+		t.Fatal(err)
+	}
+
+	last := suite.Steps[len(suite.Steps)-1]
+	last.Expected.TotalSupply++
+	if matched, err := suite.Check(); err == nil || matched != len(suite.Steps)-1 {
+		t.Fatalf("changed supply: matched %d, %v", matched, err)
+	}
+	last.Expected.TotalSupply--
+
+	first := suite.Steps[0]
+	first.Block.Transactions[0].Outputs[0].Amount++
+	if matched, err := suite.Check(); err == nil || matched != 0 {
+		t.Fatalf("changed coinbase: matched %d, %v", matched, err)
+	}
+}
+
+// chain builds the blocks of a suite, applying each to its own state so
+// rewards and indexes are known
+type chain struct {
+	t          *testing.T
+	genesis    *types.GenesisConfig
+	state      *ledger.State
+	blocks     []*types.Block
+	validators []ed25519.PrivateKey
+	prev       types.Hash
+}
+
+func newChain(t *testing.T, genesis *types.GenesisConfig, validators int) *chain {
+	c := &chain{t: t, genesis: genesis}
+	for i := 0; i < validators; i++ {
+		pub, priv, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.validators = append(c.validators, priv)
+		var key types.PublicKey
+		copy(key[:], pub)
+		genesis.InitialValidators = append(genesis.InitialValidators, types.ValidatorState{
+			PublicKey:    key,
+			StakedAmount: 100000,
+			SelfBond:     100000,
+			Active:       true,
+		})
+	}
+
+	state, err := newState(genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.state = state
+	return c
+}
+
+// block applies the next block with txs after a coinbase claiming its
+// reward, certified by the validators numbered in signers
+func (c *chain) block(txs []*types.Transaction, signers []int, edit func(*types.Block)) *types.Block {
+	c.t.Helper()
+	height := c.state.GetHeight() + 1
+	reward, err := c.state.BlockReward(height, txs)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if reward > 0 {
+		coinbase := &types.Transaction{Version: 1, Outputs: []*types.TxOutput{c.output(reward)}}
+		txs = append([]*types.Transaction{coinbase}, txs...)
+	}
+
+	block := &types.Block{
+		Header: types.BlockHeader{
+			Version:       c.state.ProtocolVersionAt(height),
+			Height:        height,
+			Timestamp:     1700000000 + int64(height)*5,
+			PrevBlockHash: c.prev,
+			Proposer:      c.genesis.InitialValidators[int(height)%len(c.validators)].PublicKey,
+		},
+		Transactions: txs,
+	}
+	if edit != nil {
+		edit(block)
+	}
+	hash := block.Header.Hash()
+	for _, i := range signers {
+		block.Validators = append(block.Validators, c.vote(i, height, hash))
+	}
+
+	if err := c.state.ApplyBlock(block); err != nil {
+		c.t.Fatalf("block %d: %v", height, err)
+	}
+	c.blocks = append(c.blocks, block)
+	c.prev = hash
+	return block
+}
+
+// vote returns validator i's commit vote for a block
+func (c *chain) vote(i int, height uint64, hash types.Hash) types.ValidatorSignature {
+	vote := types.ValidatorSignature{Validator: c.genesis.InitialValidators[i].PublicKey}
+	sig := ed25519.Sign(c.validators[i], types.NewCommitVote(c.genesis.ChainID, height, 0, hash).SignBytes())
+	copy(vote.Signature[:], sig)
+	return vote
+}
+
+// payment returns a transaction paying outputs and fee with a fresh
+// key. Before ring members are referenced by index the ring may be any
+// keys.
+func (c *chain) payment(version uint8, fee uint64, outputs ...*types.TxOutput) *types.Transaction {
+	c.t.Helper()
+	kp := c.keyPair()
+	tx := c.transaction(version, kp, fee, outputs)
+	c.sign(tx, kp, []types.PublicKey{c.keyPair().PublicKey, c.keyPair().PublicKey})
+	return tx
+}
+
+// spend returns a transaction paying outputs and fee by spending the
+// output of owned, with the ring members named by output index
+func (c *chain) spend(version uint8, owned *crypto.KeyPair, decoys []types.PublicKey, fee uint64, outputs ...*types.TxOutput) *types.Transaction {
+	c.t.Helper()
+	ring := append([]types.PublicKey{owned.PublicKey}, decoys...)
+	indexes, err := c.state.RingMemberIndexes(ring)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	sort.Sort(byIndex{indexes, ring})
+
+	tx := c.transaction(version, owned, fee, outputs)
+	tx.Inputs[0].RingOffsets = types.RingOffsets(indexes)
+	signer, err := crypto.NewOrderedRingSigner(owned.PrivateKey, owned.PublicKey, ring)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	sigHash := types.TxSigningHash(c.genesis.ChainID, tx.PrefixHash())
+	if tx.RingSignature, err = signer.Sign(sigHash[:]); err != nil {
+		c.t.Fatal(err)
+	}
+	return tx
+}
+
+// transaction returns an unsigned transaction whose single input, with
+// kp's key image, covers outputs and fee
+func (c *chain) transaction(version uint8, kp *crypto.KeyPair, fee uint64, outputs []*types.TxOutput) *types.Transaction {
+	c.t.Helper()
+	amount := fee
+	for _, out := range outputs {
+		amount += out.Amount
+	}
+	return &types.Transaction{
+		Version: version,
+		Inputs: []*types.TxInput{{
+			KeyImage: crypto.GenerateKeyImage(kp.PrivateKey, kp.PublicKey),
+			Amount:   amount,
+		}},
+		Outputs: outputs,
+		Fee:     fee,
+	}
+}
+
+// owned returns an output of amount whose one-time key is a key pair
+// the chain can spend it with
+func (c *chain) owned(amount uint64) (*types.TxOutput, *crypto.KeyPair) {
+	c.t.Helper()
+	kp := c.keyPair()
+	out := c.output(amount)
+	out.StealthAddr.SpendKey = kp.PublicKey
+	return out, kp
+}
+
+// byIndex sorts ring members by their global output index
+type byIndex struct {
+	indexes []uint64
+	keys    []types.PublicKey
+}
+
+func (b byIndex) Len() int           { return len(b.indexes) }
+func (b byIndex) Less(i, j int) bool { return b.indexes[i] < b.indexes[j] }
+func (b byIndex) Swap(i, j int) {
+	b.indexes[i], b.indexes[j] = b.indexes[j], b.indexes[i]
+	b.keys[i], b.keys[j] = b.keys[j], b.keys[i]
+}
+
+// output returns an output of amount to a fresh stealth address
+func (c *chain) output(amount uint64) *types.TxOutput {
+	c.t.Helper()
+	keys, err := crypto.GenerateWalletKeys()
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	out, _, err := crypto.GenerateStealthAddress(keys.GetAddress())
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	out.Amount = amount
+	return out
+}
+
+// sign ring-signs tx with kp hidden among decoys
+func (c *chain) sign(tx *types.Transaction, kp *crypto.KeyPair, decoys []types.PublicKey) {
+	c.t.Helper()
+	signer, err := crypto.NewRingSigner(kp.PrivateKey, kp.PublicKey, decoys)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	sigHash := types.TxSigningHash(c.genesis.ChainID, tx.PrefixHash())
+	if tx.RingSignature, err = signer.Sign(sigHash[:]); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *chain) keyPair() *crypto.KeyPair {
+	c.t.Helper()
+	kp, err := crypto.GenerateKeyPair()
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return kp
+}
+
+func (c *chain) suite() *Suite {
+	c.t.Helper()
+	suite, err := Record(c.genesis, c.blocks)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return suite
+}
+
+// transfersSuite pins down the base rules: coinbases claiming the
+// subsidy, which halves every 4 blocks, less the treasury's share, plus
+// fees; payments spending key images; and liveness records of the
+// validators that signed
+func transfersSuite(t *testing.T) *Suite {
+	c := newChain(t, &types.GenesisConfig{
+		ChainID:       "conformance-transfers",
+		InitialSupply: 10_000_000,
+		Emission: types.EmissionConfig{
+			InitialSubsidy:    1000,
+			ReductionInterval: 4,
+			ReductionPercent:  50,
+			TailEmission:      100,
+			TreasuryPercent:   10,
+		},
+	}, 2)
+
+	c.block(nil, []int{0, 1}, nil)
+	c.block([]*types.Transaction{c.payment(1, 10, c.output(5000))}, []int{0, 1}, nil)
+	c.block([]*types.Transaction{
+		c.payment(1, 0, c.output(700), c.output(300)),
+		c.payment(1, 25, c.output(1)),
+	}, []int{0}, nil)
+	for i := 0; i < 6; i++ {
+		c.block([]*types.Transaction{c.payment(1, uint64(i), c.output(100))}, []int{0, 1}, nil)
+	}
+	return c.suite()
+}
+
+// upgradesSuite pins down forks: burns from version 6, then from version
+// 14 rings named by output index, a validator bonded with a burn in the
+// same block, a late vote for the parent, and an unbond
+func upgradesSuite(t *testing.T) *Suite {
+	c := newChain(t, &types.GenesisConfig{
+		ChainID:       "conformance-upgrades",
+		InitialSupply: 10_000_000,
+		Emission:      types.EmissionConfig{InitialSubsidy: 500},
+		ValidatorSet: types.ValidatorSetConfig{
+			MinValidatorStake:   5000,
+			MinSelfBond:         1000,
+			MaxCommission:       2000,
+			MaxCommissionChange: 100,
+		},
+		Forks: types.ForkSchedule{
+			{Name: "burns", Version: types.TxVersionBurn, Height: 3},
+			{Name: "staking", Version: types.StakingVersion, Height: 14},
+		},
+	}, 2)
+
+	// Outputs the chain can spend once rings name them by index
+	outputs := make([]*types.TxOutput, 4)
+	keys := make([]*crypto.KeyPair, 4)
+	for i := range outputs {
+		outputs[i], keys[i] = c.owned(20000)
+	}
+	c.block([]*types.Transaction{c.payment(1, 0, outputs...)}, []int{0, 1}, nil)
+	c.block(nil, []int{0, 1}, nil)
+
+	burn := &types.TxOutput{Amount: 250, Burn: true}
+	c.block([]*types.Transaction{c.payment(types.TxVersionBurn, 5, c.output(750), burn)}, []int{0, 1}, nil)
+	for c.state.GetHeight() < 12 {
+		c.block(nil, []int{0, 1}, nil)
+	}
+	// Validator 1 votes too late for the certificate of block 13, so
+	// block 14, the first of version 14, carries its vote
+	parent := c.block(nil, []int{0}, nil)
+
+	// Bond a new validator, paid by a burn in the same block
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var validator types.PublicKey
+	copy(validator[:], pub)
+	bond := &types.TxOutput{Amount: 8000, Burn: true, Bond: &validator}
+	funding := c.spend(types.TxVersionBond, keys[0], []types.PublicKey{keys[1].PublicKey, keys[2].PublicKey}, 20, bond, c.output(11980))
+	stake := &types.StakingTx{
+		Type:       types.StakingBond,
+		Validator:  validator,
+		Amount:     8000,
+		SelfBond:   8000,
+		Commission: 500,
+		Funding:    funding.Hash(),
+	}
+	c.signStaking(stake, priv)
+	c.block([]*types.Transaction{funding}, []int{0, 1}, func(block *types.Block) {
+		block.Staking = []*types.StakingTx{stake}
+		block.LastCommit = []types.ValidatorSignature{c.vote(1, parent.Header.Height, parent.Header.Hash())}
+	})
+
+	// Validator 1 leaves the set
+	unbond := &types.StakingTx{Type: types.StakingUnbond, Validator: c.genesis.InitialValidators[1].PublicKey}
+	c.signStaking(unbond, c.validators[1])
+	c.block(nil, []int{0, 1}, func(block *types.Block) {
+		block.Staking = []*types.StakingTx{unbond}
+	})
+	c.block(nil, []int{0}, nil)
+	return c.suite()
+}
+
+// signStaking signs a staking transaction with its validator's key
+func (c *chain) signStaking(stx *types.StakingTx, priv ed25519.PrivateKey) {
+	hash := stx.SigningHash(c.genesis.ChainID)
+	copy(stx.Signature[:], ed25519.Sign(priv, hash[:]))
+}
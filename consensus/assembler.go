@@ -0,0 +1,201 @@
+package consensus
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"blockchain/types"
+)
+
+// BlockLimits bounds what a proposer puts into one block. They are
+// proposer policy, not validity rules.
+type BlockLimits struct {
+	MaxTransactions int // Excluding the coinbase
+	MaxBytes        int // Encoded size of the transactions
+}
+
+// DefaultBlockLimits returns the limits used unless configured otherwise
+func DefaultBlockLimits() BlockLimits {
+	return BlockLimits{
+		MaxTransactions: 1000,
+		MaxBytes:        2 << 20,
+	}
+}
+
+// Validate checks the limits are usable
+func (l BlockLimits) Validate() error {
+	if l.MaxTransactions <= 0 {
+		return fmt.Errorf("max transactions per block must be positive")
+	}
+	if l.MaxBytes <= 0 {
+		return fmt.Errorf("max block size must be positive")
+	}
+	return nil
+}
+
+// ParamStore gives assemblers read access to chain parameters.
+// *ledger.State implements it.
+type ParamStore interface {
+	ChainID() string
+	ProtocolVersionAt(height uint64) uint32
+	Emission() types.EmissionConfig
+}
+
+// AssemblyContext describes the block being assembled
+type AssemblyContext struct {
+	Height uint64
+	Limits BlockLimits
+	Params ParamStore
+}
+
+// BlockAssembler chooses and orders the transactions of a proposal.
+// pool is a snapshot of the mempool in arrival order and must not be
+// modified; transactions not returned stay in the mempool.
+type BlockAssembler interface {
+	Assemble(pool []*types.Transaction, ctx AssemblyContext) []*types.Transaction
+}
+
+// Assemblers lists the policies selectable by name. Alternative
+// policies are added here from an init function.
+var Assemblers = map[string]BlockAssembler{
+	"greedy": GreedyAssembler{},
+	"fifo":   FIFOAssembler{},
+}
+
+// DefaultAssembler is the name of the policy used unless configured
+// otherwise
+const DefaultAssembler = "greedy"
+
+// GetAssembler looks up a policy by name
+func GetAssembler(name string) (BlockAssembler, error) {
+	a, ok := Assemblers[name]
+	if !ok {
+		names := make([]string, 0, len(Assemblers))
+		for n := range Assemblers {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown block assembler %q (available: %s)", name, strings.Join(names, ", "))
+	}
+	return a, nil
+}
+
+// GreedyAssembler fills the block with the highest fee per byte first.
+// A transaction spending a key image already taken by a better paying
+// one is left out, as is one that no longer fits; smaller ones after it
+// may still be included.
+type GreedyAssembler struct{}
+
+// Assemble implements BlockAssembler
+func (GreedyAssembler) Assemble(pool []*types.Transaction, ctx AssemblyContext) []*types.Transaction {
+	type candidate struct {
+		tx   *types.Transaction
+		size int
+	}
+
+	candidates := make([]candidate, 0, len(pool))
+	for _, tx := range pool {
+		candidates = append(candidates, candidate{tx: tx, size: txSize(tx)})
+	}
+
+	// Compare fee rates without division: a.fee/a.size > b.fee/b.size.
+	// Stable, so equal rates keep arrival order.
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		return float64(a.tx.Fee)*float64(b.size) > float64(b.tx.Fee)*float64(a.size)
+	})
+
+	selected := make([]*types.Transaction, 0, min(len(candidates), ctx.Limits.MaxTransactions))
+	spent := make(map[types.PublicKey]bool)
+	bytes := 0
+	for _, c := range candidates {
+		if len(selected) >= ctx.Limits.MaxTransactions {
+			break
+		}
+		if bytes+c.size > ctx.Limits.MaxBytes || spendsAny(c.tx, spent) {
+			continue
+		}
+
+		markSpent(c.tx, spent)
+		selected = append(selected, c.tx)
+		bytes += c.size
+	}
+
+	return selected
+}
+
+// FIFOAssembler takes transactions in arrival order until the block is
+// full, ignoring fees
+type FIFOAssembler struct{}
+
+// Assemble implements BlockAssembler
+func (FIFOAssembler) Assemble(pool []*types.Transaction, ctx AssemblyContext) []*types.Transaction {
+	selected := make([]*types.Transaction, 0, min(len(pool), ctx.Limits.MaxTransactions))
+	spent := make(map[types.PublicKey]bool)
+	bytes := 0
+	for _, tx := range pool {
+		if len(selected) >= ctx.Limits.MaxTransactions {
+			break
+		}
+		size := txSize(tx)
+		if bytes+size > ctx.Limits.MaxBytes {
+			break
+		}
+		if spendsAny(tx, spent) {
+			continue
+		}
+
+		markSpent(tx, spent)
+		selected = append(selected, tx)
+		bytes += size
+	}
+
+	return selected
+}
+
+// txSize returns the encoded size of a transaction as stored and
+// gossiped
+func txSize(tx *types.Transaction) int {
+	data, err := json.Marshal(tx)
+	if err != nil {
+		return 0
+	}
+	return len(data)
+}
+
+// treasuryKey stands in for the key image of treasury spends, so a block
+// gets at most one
+var treasuryKey = types.PublicKey{}
+
+// spendsAny reports whether a transaction spends one of the key images.
+// A stake release spends its validator's key, so a block releases each
+// stake once.
+func spendsAny(tx *types.Transaction, spent map[types.PublicKey]bool) bool {
+	if tx.IsTreasurySpend() && spent[treasuryKey] {
+		return true
+	}
+	if tx.IsStakeRelease() && spent[tx.Release.Validator] {
+		return true
+	}
+	for _, input := range tx.AllInputs() {
+		if spent[input.KeyImage] {
+			return true
+		}
+	}
+	return false
+}
+
+// markSpent records the key images a selected transaction spends
+func markSpent(tx *types.Transaction, spent map[types.PublicKey]bool) {
+	if tx.IsTreasurySpend() {
+		spent[treasuryKey] = true
+	}
+	if tx.IsStakeRelease() {
+		spent[tx.Release.Validator] = true
+	}
+	for _, input := range tx.AllInputs() {
+		spent[input.KeyImage] = true
+	}
+}
@@ -0,0 +1,121 @@
+package consensus
+
+import (
+	"errors"
+	"fmt"
+
+	"blockchain/crypto"
+	"blockchain/types"
+)
+
+// quorumStake returns the stake needed for finality out of total: the
+// least amount above two thirds of it, so that any two quorums share
+// more than a third of the stake. It is computed in integers, in parts
+// that cannot overflow.
+func quorumStake(total uint64) uint64 {
+	return total/3*2 + total%3*2/3 + 1
+}
+
+// voteSignBytes returns the bytes a commit vote for a block signs
+func voteSignBytes(chainID string, height uint64, blockHash types.Hash, vote *types.ValidatorSignature) []byte {
+	return types.NewCommitVote(chainID, height, vote.Round, blockHash).SignBytes()
+}
+
+// ValidatorSetProvider looks up the validator set that votes on the
+// block at height
+type ValidatorSetProvider func(height uint64) (*types.ValidatorSetSnapshot, error)
+
+// SetValidatorSetProvider gives the engine the stored validator set
+// history, so certificates are checked against the set of their height.
+// Without one the current set is used.
+func (e *Engine) SetValidatorSetProvider(provider ValidatorSetProvider) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.validatorSets = provider
+}
+
+// ValidatorSetSnapshot returns the current validator set as the set
+// voting from height on
+func (e *Engine) ValidatorSetSnapshot(height uint64) *types.ValidatorSetSnapshot {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.currentSet(height)
+}
+
+// currentSet copies the current validator set (must hold lock)
+func (e *Engine) currentSet(height uint64) *types.ValidatorSetSnapshot {
+	snap := &types.ValidatorSetSnapshot{
+		Height:     height,
+		Epoch:      height / e.state.ValidatorSet().Epoch(),
+		TotalStake: e.totalStake,
+		Validators: make([]types.ValidatorState, 0, len(e.validatorSet)),
+	}
+	for _, val := range e.validatorSet {
+		snap.Validators = append(snap.Validators, *val)
+	}
+	return snap
+}
+
+// VerifyCertificate checks that the votes of a signed header come from
+// the validator set at its height and carry more than 2/3 of its stake.
+// Each vote must sign the header hash at the header's height, all in
+// the same round, since the locking that keeps two blocks from both
+// being committed (see locking.go) counts the commit votes of a single
+// round. The signatures are checked together as one batch once the
+// voters are known.
+// NOTE: Phase 1 only stores sets up to the local tip, so headers synced
+// ahead of it are checked against the current set.
+func (e *Engine) VerifyCertificate(sh *types.SignedHeader) error {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	set := e.currentSet(sh.Header.Height)
+	if e.validatorSets != nil {
+		if stored, err := e.validatorSets(sh.Header.Height); err == nil {
+			set = stored
+		}
+	}
+
+	if set.TotalStake == 0 {
+		return errors.New("no validator stake to verify against")
+	}
+
+	stakes := set.Stakes()
+	chainID := e.state.ChainID()
+	blockHash := sh.Header.Hash()
+	seen := make(map[types.PublicKey]bool)
+	batch := crypto.NewBatchVerifier(len(sh.Validators))
+
+	var signed uint64
+	for i := range sh.Validators {
+		vote := &sh.Validators[i]
+		stake, ok := stakes[vote.Validator]
+		if !ok {
+			return fmt.Errorf("vote from %w %s", ErrUnknownValidator, vote.Validator)
+		}
+		if seen[vote.Validator] {
+			return fmt.Errorf("%w from %s", ErrDuplicateVote, vote.Validator)
+		}
+		if vote.Round != sh.Validators[0].Round {
+			return fmt.Errorf("votes from rounds %d and %d in one certificate", sh.Validators[0].Round, vote.Round)
+		}
+		seen[vote.Validator] = true
+
+		batch.Add(vote.Validator, voteSignBytes(chainID, sh.Header.Height, blockHash, vote), vote.Signature)
+		signed += stake
+	}
+
+	if ok, valid := batch.Verify(); !ok {
+		for i, vote := range sh.Validators {
+			if !valid[i] {
+				return fmt.Errorf("%w from %s", ErrInvalidVote, vote.Validator)
+			}
+		}
+	}
+
+	if need := quorumStake(set.TotalStake); signed < need {
+		return fmt.Errorf("%w: votes carry %d stake, finality needs %d of %d", ErrInsufficientQuorum, signed, need, set.TotalStake)
+	}
+
+	return nil
+}
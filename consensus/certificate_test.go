@@ -0,0 +1,70 @@
+package consensus
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"blockchain/types"
+)
+
+func TestQuorumStake(t *testing.T) {
+	tests := []struct {
+		total, need uint64
+	}{
+		{1, 1},
+		{3, 3},
+		{4, 3},
+		{5, 4},
+		{6, 5},
+		{300, 201},
+		{math.MaxUint64, math.MaxUint64/3*2 + 1},
+	}
+	for _, tt := range tests {
+		if need := quorumStake(tt.total); need != tt.need {
+			t.Errorf("quorumStake(%d) = %d, want %d", tt.total, need, tt.need)
+		}
+	}
+}
+
+// TestQuorumOfFour checks that of four validators of equal stake two
+// cannot finalize a block, nor give it a polka, and three can. Each
+// bonds a stake of 1, where a rounded-down threshold would be 2.
+func TestQuorumOfFour(t *testing.T) {
+	engines := newStakedTestEngines(t, 4, 1)
+	block := testBlock(0, "a")
+	propose(t, engines, &types.Proposal{Round: 0, Block: block}, 0)
+
+	var prevotes []*types.Vote
+	var sigs []types.ValidatorSignature
+	for _, e := range engines {
+		vote, err := e.signVote(1, 0, block.Header.Hash(), true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		prevotes = append(prevotes, vote)
+		if vote, err = e.signVote(1, 0, block.Header.Hash(), false); err != nil {
+			t.Fatal(err)
+		}
+		sigs = append(sigs, vote.Commit())
+	}
+
+	deliver(t, engines, prevotes[:2], 0)
+	if _, err := engines[0].CommitVote(); !errors.Is(err, ErrNoPolka) {
+		t.Fatalf("commit vote with prevotes from two of four: %v", err)
+	}
+	deliver(t, engines, prevotes[2:3], 0)
+	if _, err := engines[0].CommitVote(); err != nil {
+		t.Fatalf("commit vote with prevotes from three of four: %v", err)
+	}
+
+	signed := *block
+	signed.Validators = sigs[:2]
+	if err := engines[0].VerifyCertificate(signed.SignedHeader()); !errors.Is(err, ErrInsufficientQuorum) {
+		t.Fatalf("certificate signed by two of four: %v", err)
+	}
+	signed.Validators = sigs[:3]
+	if err := engines[0].VerifyCertificate(signed.SignedHeader()); err != nil {
+		t.Fatalf("certificate signed by three of four: %v", err)
+	}
+}
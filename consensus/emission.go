@@ -0,0 +1,51 @@
+package consensus
+
+import (
+	"blockchain/crypto"
+	"blockchain/types"
+)
+
+// SetRewardAddress sets where this validator's coinbase pays the block
+// subsidy and fees. Without one, proposed blocks have no coinbase.
+func (e *Engine) SetRewardAddress(addr types.Address) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.rewardAddr = &addr
+}
+
+// BlockReward returns the subsidy plus fees the next block, at height,
+// may claim (see ledger.State.BlockReward)
+func (e *Engine) BlockReward(height uint64, txs []*types.Transaction) (uint64, error) {
+	return e.state.BlockReward(height, txs)
+}
+
+// createCoinbase pays the block reward to the reward address (must hold
+// lock). It returns nil when there is nothing to pay, or the reward is
+// below the dust limit.
+func (e *Engine) createCoinbase(height uint64, txs []*types.Transaction) (*types.Transaction, error) {
+	reward, err := e.BlockReward(height, txs)
+	if err != nil {
+		return nil, err
+	}
+	if e.rewardAddr == nil || reward == 0 || reward < e.state.DustLimit() {
+		return nil, nil
+	}
+
+	output, ephemeral, err := crypto.GenerateStealthAddress(*e.rewardAddr)
+	if err != nil {
+		return nil, err
+	}
+	output.Amount = reward
+
+	version := uint8(1)
+	if e.state.ProtocolVersionAt(height) >= types.TxVersionViewTag {
+		version = types.TxVersionViewTag
+		tag := crypto.ViewTag(ephemeral, *e.rewardAddr)
+		output.ViewTag = &tag
+	}
+
+	return &types.Transaction{
+		Version: version,
+		Outputs: []*types.TxOutput{output},
+	}, nil
+}
@@ -1,9 +1,12 @@
 package consensus
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/binary"
 	"errors"
+	"fmt"
+	"sort"
 	"sync"
 	"time"
 	
@@ -14,9 +17,6 @@ import (
 
 const (
 	BlockTime        = 2 * time.Second
-	BFTQuorum        = 2.0 / 3.0 // 2/3 majority for finality
-	UnbondingPeriod  = 100        // blocks
-	SlashPercentage  = 10         // 10% of stake slashed
 )
 
 // Engine manages PoS consensus and BFT finality
@@ -33,11 +33,42 @@ type Engine struct {
 	// Local validator identity (if this node is a validator)
 	validatorKey ed25519.PrivateKey
 	validatorPub types.PublicKey
+	rewardAddr   *types.Address // Coinbase destination (see emission.go)
+	
+	// Earlier blocks for the median-time-past rule (see timestamp.go)
+	blocks BlockProvider
+	
+	// Stored validator sets for old certificates (see certificate.go)
+	validatorSets ValidatorSetProvider
 	
 	// Block proposal and voting
-	pendingBlock    *types.Block
-	votes           map[types.PublicKey]*types.ValidatorSignature
-	proposalTimeout time.Duration
+	pendingBlock    *types.Block    // Our own proposal, kept in the WAL
+	proposal        *types.Proposal // Candidate for the next height being voted on
+	votes           map[types.PublicKey]*types.ValidatorSignature // Commit votes for it
+	timeouts        TimeoutConfig // See timeout.go
+	
+	// Prevotes of the height being decided, the block this validator
+	// committed to and the latest block with prevotes from 2/3 of the
+	// stake, with their rounds (see locking.go)
+	prevotes    map[voteKey]*types.Vote
+	locked      *types.Block
+	lockedRound uint32
+	valid       *types.Block
+	validRound  uint32
+	
+	// First vote of each validator per round of the height being
+	// decided, and double votes seen (see evidence.go)
+	roundVotes map[voteKey]*types.Vote
+	evidence   map[types.Hash]*types.DoubleVote
+	
+	// Last committed block and the votes for it that missed its
+	// certificate (see lastcommit.go)
+	committed *types.Block
+	lateVotes map[types.PublicKey]*types.Vote
+	
+	// Crash recovery (see wal.go)
+	wal    *WAL
+	signed map[signedKey]types.Hash // Blocks we signed at the heights not yet committed
 }
 
 // NewEngine creates a new consensus engine
@@ -47,7 +78,12 @@ func NewEngine(state *ledger.State, validatorPriv ed25519.PrivateKey, validatorP
 		validatorKey:    validatorPriv,
 		validatorPub:    validatorPub,
 		votes:           make(map[types.PublicKey]*types.ValidatorSignature),
-		proposalTimeout: BlockTime,
+		timeouts:        DefaultTimeoutConfig(),
+		roundVotes:      make(map[voteKey]*types.Vote),
+		evidence:        make(map[types.Hash]*types.DoubleVote),
+		lateVotes:       make(map[types.PublicKey]*types.Vote),
+		prevotes:        make(map[voteKey]*types.Vote),
+		signed:          make(map[signedKey]types.Hash),
 	}
 }
 
@@ -76,7 +112,7 @@ func (e *Engine) SelectProposer(height uint64, round uint32) (types.PublicKey, e
 	defer e.mu.RUnlock()
 	
 	if len(e.validatorSet) == 0 {
-		return types.PublicKey{}, errors.New("no validators in set")
+		return types.PublicKey{}, fmt.Errorf("%w: no validators in set", ErrNoProposer)
 	}
 	
 	// Weighted random selection based on stake
@@ -85,12 +121,26 @@ func (e *Engine) SelectProposer(height uint64, round uint32) (types.PublicKey, e
 	binary.BigEndian.PutUint64(seed[0:8], height)
 	binary.BigEndian.PutUint32(seed[8:12], round)
 	
+	// Validators jailed since the set was last refreshed never propose
+	var stake uint64
+	for _, val := range e.validatorSet {
+		if !val.Jailed {
+			stake += val.StakedAmount
+		}
+	}
+	if stake == 0 {
+		return types.PublicKey{}, fmt.Errorf("%w: all validators in set are jailed", ErrNoProposer)
+	}
+	
 	hash := sha256.Sum256(seed)
-	selection := binary.BigEndian.Uint64(hash[:8]) % e.totalStake
+	selection := binary.BigEndian.Uint64(hash[:8]) % stake
 	
 	// Select validator by cumulative stake
 	var cumulative uint64
 	for _, val := range e.validatorSet {
+		if val.Jailed {
+			continue
+		}
 		cumulative += val.StakedAmount
 		if selection < cumulative {
 			return val.PublicKey, nil
@@ -101,24 +151,38 @@ func (e *Engine) SelectProposer(height uint64, round uint32) (types.PublicKey, e
 	return e.validatorSet[0].PublicKey, nil
 }
 
-// ProposeBlock creates a new block proposal
-func (e *Engine) ProposeBlock(txs []*types.Transaction, prevBlock *types.Block) (*types.Block, error) {
+// ProposeBlock creates a new block proposal. Staking transactions are
+// included from StakingVersion on; a bond's funding transaction must be
+// among txs.
+func (e *Engine) ProposeBlock(txs []*types.Transaction, staking []*types.StakingTx, prevBlock *types.Block) (*types.Block, error) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 	
 	height := prevBlock.Header.Height + 1
 	
-	// Compute transaction root
-	txRoot := computeTxRoot(txs)
+	// Follow the protocol version scheduled for this height
+	version := e.state.ProtocolVersionAt(height)
+	if version > types.ProtocolVersion {
+		return nil, fmt.Errorf("height %d requires protocol version %d, this node supports %d; %w", height, version, types.ProtocolVersion, ErrUpgradeRequired)
+	}
+	
+	// Pay the block reward to ourselves
+	coinbase, err := e.createCoinbase(height, txs)
+	if err != nil {
+		return nil, err
+	}
+	if coinbase != nil {
+		txs = append([]*types.Transaction{coinbase}, txs...)
+	}
 	
 	// Compute state root
 	stateRoot := e.state.ComputeStateRoot()
 	
 	header := types.BlockHeader{
+		Version:       version,
 		Height:        height,
-		Timestamp:     time.Now().Unix(),
+		Timestamp:     e.proposalTime(prevBlock),
 		PrevBlockHash: prevBlock.Header.Hash(),
-		TxRoot:        txRoot,
 		StateRoot:     stateRoot,
 		Proposer:      e.validatorPub,
 		Round:         e.currentRound,
@@ -130,68 +194,95 @@ func (e *Engine) ProposeBlock(txs []*types.Transaction, prevBlock *types.Block)
 		Validators:   make([]types.ValidatorSignature, 0),
 	}
 	
-	return block, nil
-}
-
-// VoteForBlock creates a validator signature for a block
-func (e *Engine) VoteForBlock(block *types.Block) (*types.ValidatorSignature, error) {
-	e.mu.RLock()
-	defer e.mu.RUnlock()
-	
-	// Verify we're a validator
-	if e.validatorKey == nil {
-		return nil, errors.New("not a validator")
+	// Punish the double votes seen since they were last included. Their
+	// validators' stake stays bonded for the slash, so its release waits.
+	if version >= types.EvidenceVersion {
+		block.Evidence = e.pendingEvidence()
+		block.Transactions = withoutReleases(block.Transactions, block.Evidence)
 	}
 	
-	// Sign block hash
-	blockHash := block.Header.Hash()
-	signature := ed25519.Sign(e.validatorKey, blockHash[:])
+	// Carry the staking changes, and the votes for the parent that came
+	// too late for its certificate
+	if version >= types.StakingVersion && len(staking) > 0 {
+		block.Staking = staking
+	}
+	if version >= types.LastCommitVersion {
+		block.LastCommit = e.lastCommit(header.PrevBlockHash)
+	}
 	
-	var sig types.Signature
-	copy(sig[:], signature)
+	// Compute transaction root
+	block.Header.TxRoot = computeTxRoot(block)
 	
-	vote := &types.ValidatorSignature{
-		Validator: e.validatorPub,
-		Signature: sig,
-		Round:     e.currentRound,
+	// Log the proposal before it can be broadcast
+	if err := e.writeWAL(&WALEntry{Type: WALProposal, Height: height, Round: e.currentRound, Block: block}); err != nil {
+		return nil, err
 	}
+	e.pendingBlock = block
 	
-	return vote, nil
+	return block, nil
 }
 
-// CollectVote adds a validator vote to the pending block
-func (e *Engine) CollectVote(vote *types.ValidatorSignature, blockHash types.Hash) error {
+// CollectVote checks a validator's vote for the next height. Prevotes
+// are kept for the round they are in (see locking.go). A commit vote for
+// the current proposal in its round counts towards the certificate; any
+// other fails with ErrNotProposal. A commit vote for a different block
+// than the validator already voted for in the same round is kept as
+// evidence for a later block (see evidence.go) and fails with
+// ErrDuplicateVote. A commit vote for the block just committed is kept
+// for the next block to carry (see lastcommit.go).
+func (e *Engine) CollectVote(vote *types.Vote) error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 	
+	if !vote.Prevote && e.isLateVote(vote) {
+		return e.collectLateVote(vote)
+	}
+	if vote.Height != e.state.GetHeight()+1 {
+		return fmt.Errorf("%w: vote for height %d", ErrNotProposal, vote.Height)
+	}
+	
 	// Verify validator is in set
 	validator, err := e.state.GetValidator(vote.Validator)
 	if err != nil {
-		return errors.New("unknown validator")
+		return ErrUnknownValidator
 	}
 	
+	if validator.Jailed {
+		return fmt.Errorf("%w: jailed until height %d", ErrInactiveValidator, validator.JailedUntil)
+	}
 	if !validator.Active {
-		return errors.New("inactive validator")
+		return ErrInactiveValidator
 	}
 	
-	// Verify signature
-	pubKey := ed25519.PublicKey(vote.Validator[:])
-	valid := ed25519.Verify(pubKey, blockHash[:], vote.Signature[:])
-	if !valid {
-		return errors.New("invalid signature")
+	// Verify signature over chain ID, height, round and block hash
+	if !ed25519.Verify(vote.Validator[:], vote.Canonical(e.state.ChainID()).SignBytes(), vote.Signature[:]) {
+		return fmt.Errorf("%w (wrong chain?)", ErrInvalidVote)
+	}
+	
+	if vote.Prevote {
+		e.collectPrevote(vote)
+		return nil
 	}
 	
 	// Check for double-voting (slashing condition)
-	if existing, exists := e.votes[vote.Validator]; exists {
-		if existing.Round == vote.Round {
-			// Double vote detected - slash validator
-			e.slashValidator(vote.Validator, "double-vote")
-			return errors.New("double-vote detected")
-		}
+	if err := e.recordVote(vote); err != nil {
+		return err
+	}
+	
+	p := e.proposal
+	if p == nil || p.Block.Header.Height != vote.Height || p.Round != vote.Round || p.Block.Header.Hash() != vote.BlockHash {
+		return ErrNotProposal
+	}
+	commit := vote.Commit()
+	if existing, exists := e.votes[vote.Validator]; exists && *existing == commit {
+		return nil // Already have it (e.g. replayed from the WAL)
 	}
 	
 	// Store vote
-	e.votes[vote.Validator] = vote
+	if err := e.writeWAL(&WALEntry{Type: WALVote, Height: vote.Height, Round: vote.Round, Vote: &commit}); err != nil {
+		return err
+	}
+	e.votes[vote.Validator] = &commit
 	
 	return nil
 }
@@ -200,7 +291,12 @@ func (e *Engine) CollectVote(vote *types.ValidatorSignature, blockHash types.Has
 func (e *Engine) HasQuorum() bool {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
-	
+	return e.hasQuorum()
+}
+
+// hasQuorum checks the collected votes against the quorum (must hold
+// lock)
+func (e *Engine) hasQuorum() bool {
 	var voteStake uint64
 	for validator := range e.votes {
 		val, err := e.state.GetValidator(validator)
@@ -210,70 +306,120 @@ func (e *Engine) HasQuorum() bool {
 		voteStake += val.StakedAmount
 	}
 	
-	quorumThreshold := uint64(float64(e.totalStake) * BFTQuorum)
-	return voteStake >= quorumThreshold
+	return voteStake >= quorumStake(e.totalStake)
 }
 
-// FinalizeBlock finalizes a block with validator signatures
+// FinalizeBlock attaches the collected votes to the proposal as its
+// finality certificate. The votes are kept until StartHeight.
 func (e *Engine) FinalizeBlock(block *types.Block) error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 	
-	// Add all votes to block
-	for _, vote := range e.votes {
-		block.Validators = append(block.Validators, *vote)
+	if e.proposal == nil || block.Header.Hash() != e.proposal.Block.Header.Hash() {
+		return ErrNotProposal
 	}
-	
-	// Verify quorum
-	if !e.HasQuorum() {
-		return errors.New("insufficient validator votes for finality")
+	if !e.hasQuorum() {
+		return ErrInsufficientQuorum
 	}
 	
-	// Clear votes for next round
-	e.votes = make(map[types.PublicKey]*types.ValidatorSignature)
-	e.currentRound++
+	// Sorted, so every node builds the same certificate
+	block.Validators = make([]types.ValidatorSignature, 0, len(e.votes))
+	for _, vote := range e.votes {
+		block.Validators = append(block.Validators, *vote)
+	}
+	sort.Slice(block.Validators, func(i, j int) bool {
+		return bytes.Compare(block.Validators[i].Validator[:], block.Validators[j].Validator[:]) < 0
+	})
 	
 	return nil
 }
 
-// slashValidator penalizes a validator for misbehavior
-func (e *Engine) slashValidator(validator types.PublicKey, reason string) {
-	err := e.state.UpdateValidator(validator, func(val *types.ValidatorState) {
-		// Slash stake
-		slashAmount := val.StakedAmount * SlashPercentage / 100
-		val.StakedAmount -= slashAmount
-		
-		// Increment slash count
-		val.SlashCount++
-		
-		// Deactivate if slashed too many times
-		if val.SlashCount >= 3 {
-			val.Active = false
+// SetProposal records the candidate block for the next height. Only one
+// proposal is accepted per round; receiving it again is not an error. A
+// proposal from a later round replaces the one held and moves the engine
+// to its round. Proposals from rounds the engine has left fail with
+// ErrStaleRound.
+func (e *Engine) SetProposal(proposal *types.Proposal) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	
+	height, round := proposal.Block.Header.Height, proposal.Round
+	if round < e.currentRound {
+		return ErrStaleRound
+	}
+	if p := e.proposal; p != nil && p.Block.Header.Height == height && p.Round == round {
+		if p.Block.Header.Hash() != proposal.Block.Header.Hash() {
+			return fmt.Errorf("conflicting proposal at height %d round %d", height, round)
 		}
-	})
+		return nil
+	}
+	if round > e.currentRound {
+		if err := e.enterRound(height, round); err != nil {
+			return err
+		}
+	}
+	e.proposal = proposal
+	e.noteValid()
+	return nil
+}
+
+// Proposal returns the candidate for height, or nil
+func (e *Engine) Proposal(height uint64) *types.Proposal {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
 	
-	if err != nil {
-		// Log error (in real impl)
-		return
+	if e.proposal == nil || e.proposal.Block.Header.Height != height {
+		return nil
 	}
+	return e.proposal
 }
 
-// ValidateBlock validates a proposed block
+// ValidateBlock validates a finalized block: a certificate of votes
+// from 2/3 of the stake, checked first since it is cheap, and then the
+// block itself (see ValidateProposal). Blocks from gossip, sync and the
+// database all pass through here, so none is trusted without votes.
 func (e *Engine) ValidateBlock(block *types.Block, prevBlock *types.Block) error {
+	if err := e.VerifyCertificate(block.SignedHeader()); err != nil {
+		return fmt.Errorf("invalid certificate: %w", err)
+	}
+	
+	return e.ValidateProposal(block, prevBlock)
+}
+
+// ValidateProposal validates a candidate block before it has votes
+func (e *Engine) ValidateProposal(block *types.Block, prevBlock *types.Block) error {
 	// Validate height
 	if block.Header.Height != prevBlock.Header.Height+1 {
 		return errors.New("invalid block height")
 	}
 	
+	// Validate protocol version against the fork schedule
+	version := e.state.ProtocolVersionAt(block.Header.Height)
+	if version > types.ProtocolVersion {
+		return fmt.Errorf("height %d requires protocol version %d, this node supports %d; %w", block.Header.Height, version, types.ProtocolVersion, ErrUpgradeRequired)
+	}
+	if block.Header.Version != version {
+		return fmt.Errorf("block version %d, expected %d at height %d", block.Header.Version, version, block.Header.Height)
+	}
+	
 	// Validate previous block hash
 	if block.Header.PrevBlockHash != prevBlock.Header.Hash() {
 		return errors.New("invalid previous block hash")
 	}
 	
-	// Validate timestamp (not too far in future)
-	now := time.Now().Unix()
-	if block.Header.Timestamp > now+60 {
-		return errors.New("block timestamp too far in future")
+	// The header must commit to exactly these transactions
+	if err := VerifyTxRoot(block); err != nil {
+		return err
+	}
+	
+	// The header commits to the parent state so state sync can prove it
+	if block.Header.StateRoot != e.state.ComputeStateRoot() {
+		return errors.New("state root does not match parent state")
+	}
+	
+	// Validate timestamp (after median time past, not too far in future)
+	if err := e.checkTimestamp(block, prevBlock); err != nil {
+		return err
 	}
 	
 	// Validate proposer
@@ -283,46 +429,55 @@ func (e *Engine) ValidateBlock(block *types.Block, prevBlock *types.Block) error
 	}
 	
 	if proposer != block.Header.Proposer {
-		return errors.New("invalid proposer for this round")
+		return ErrInvalidProposer
 	}
 	
-	// Validate transactions
-	for _, tx := range block.Transactions {
-		if err := e.state.ValidateTransaction(tx); err != nil {
-			return err
-		}
+	// Validate transactions, coinbase and evidence with the checks
+	// ApplyBlock makes, so a valid block always applies
+	return e.state.ValidateBlockBody(block)
+}
+
+// VerifyTxRoot checks that a block's transactions and evidence match
+// its header
+func VerifyTxRoot(block *types.Block) error {
+	if block.Header.TxRoot != computeTxRoot(block) {
+		return errors.New("transaction root does not match transactions")
 	}
-	
 	return nil
 }
 
-// computeTxRoot computes Merkle root of transactions (simplified)
-func computeTxRoot(txs []*types.Transaction) types.Hash {
-	h := sha256.New()
+// computeTxRoot computes Merkle root of transactions (simplified). From
+// EvidenceVersion on it covers the block's evidence too, and from
+// StakingVersion its staking transactions and late votes.
+func computeTxRoot(block *types.Block) types.Hash {
+	h := types.NewHasher(types.TagTxRoot).Uint32(uint32(len(block.Transactions)))
 	
-	for _, tx := range txs {
+	for _, tx := range block.Transactions {
 		txHash := tx.Hash()
-		h.Write(txHash[:])
+		h.Fixed(txHash[:])
+	}
+	
+	if block.Header.Version >= types.EvidenceVersion {
+		h.Uint32(uint32(len(block.Evidence)))
+		for _, ev := range block.Evidence {
+			evHash := ev.Hash()
+			h.Fixed(evHash[:])
+		}
 	}
 	
-	return sha256.Sum256(h.Sum(nil))
+	if block.Header.Version >= types.StakingVersion {
+		h.Uint32(uint32(len(block.Staking)))
+		for _, stx := range block.Staking {
+			stxHash := stx.Hash()
+			h.Fixed(stxHash[:])
+		}
+		h.Uint32(uint32(len(block.LastCommit)))
+		for _, vote := range block.LastCommit {
+			h.Fixed(vote.Validator[:])
+			h.Fixed(vote.Signature[:])
+			h.Uint32(vote.Round)
+		}
+	}
+	
+	return h.Sum()
 }
-
-// ProcessStakingTx processes a staking transaction
-func (e *Engine) ProcessStakingTx(stx *types.StakingTx, height uint64) error {
-	switch stx.Type {
-	case types.StakingBond:
-		// Add validator
-		return e.state.AddValidator(stx.Validator, stx.Amount, height)
-		
-	case types.StakingUnbond:
-		// Mark for unbonding
-		return e.state.UpdateValidator(stx.Validator, func(val *types.ValidatorState) {
-			val.Active = false
-			val.UnbondingUntil = height + UnbondingPeriod
-		})
-		
-	default:
-		return errors.New("unknown staking type")
-	}
-}
\ No newline at end of file
@@ -0,0 +1,54 @@
+package consensus
+
+import "errors"
+
+// Errors callers can tell apart with errors.Is
+var (
+	// ErrNotValidator is returned when a node without a validator key is
+	// asked to vote
+	ErrNotValidator = errors.New("not a validator")
+
+	// ErrNoProposer is returned when no validator in the set can propose
+	ErrNoProposer = errors.New("no validator can propose")
+
+	// ErrUnknownValidator is returned for a vote from a key that is not
+	// a validator
+	ErrUnknownValidator = errors.New("unknown validator")
+
+	// ErrInactiveValidator is returned for a vote from a jailed or
+	// unbonded validator
+	ErrInactiveValidator = errors.New("inactive validator")
+
+	// ErrInvalidVote is returned for a vote whose signature does not
+	// cover the block, height, round and chain
+	ErrInvalidVote = errors.New("invalid vote signature")
+
+	// ErrDuplicateVote is returned for a second vote of a validator for
+	// another block in the same round, kept as evidence to slash it, or
+	// a second vote of the same validator in a certificate
+	ErrDuplicateVote = errors.New("duplicate vote")
+
+	// ErrNotProposal is returned when finalizing, or collecting a vote
+	// for, a block other than the current proposal
+	ErrNotProposal = errors.New("block is not the current proposal")
+
+	// ErrLocked is returned when asked to prevote for a block other than
+	// the one this validator is locked on (see locking.go)
+	ErrLocked = errors.New("locked on another block")
+
+	// ErrNoPolka is returned when asked to commit to a proposal before
+	// its prevotes carry more than 2/3 of the stake
+	ErrNoPolka = errors.New("proposal lacks prevotes from more than 2/3 of the stake")
+
+	// ErrInsufficientQuorum is returned until votes carry more than 2/3
+	// of the stake
+	ErrInsufficientQuorum = errors.New("insufficient validator votes for finality")
+
+	// ErrInvalidProposer is returned for a block proposed by a validator
+	// other than the one its round selects
+	ErrInvalidProposer = errors.New("invalid proposer for this round")
+
+	// ErrUpgradeRequired is returned for blocks of a protocol version
+	// this node does not support
+	ErrUpgradeRequired = errors.New("upgrade required")
+)
@@ -0,0 +1,114 @@
+package consensus
+
+import (
+	"bytes"
+	"sort"
+
+	"blockchain/types"
+)
+
+// voteKey identifies the vote a validator may cast in one round
+type voteKey struct {
+	validator types.PublicKey
+	round     uint32
+}
+
+// recordVote remembers the first vote of a validator in each round of
+// the height being decided. A vote for a different block in the same
+// round is a double vote: it is kept as evidence for a later block to
+// punish, and ErrDuplicateVote is returned (must hold lock).
+func (e *Engine) recordVote(vote *types.Vote) error {
+	key := voteKey{validator: vote.Validator, round: vote.Round}
+	first, ok := e.roundVotes[key]
+	if !ok {
+		e.roundVotes[key] = vote
+		return nil
+	}
+	if first.BlockHash == vote.BlockHash {
+		return nil
+	}
+
+	ev := newDoubleVote(first, vote)
+	e.evidence[ev.Hash()] = ev
+	return ErrDuplicateVote
+}
+
+// newDoubleVote makes the evidence of two votes by one validator for
+// different blocks at the same height and round
+func newDoubleVote(a, b *types.Vote) *types.DoubleVote {
+	if bytes.Compare(a.BlockHash[:], b.BlockHash[:]) > 0 {
+		a, b = b, a
+	}
+	return &types.DoubleVote{
+		Validator:  a.Validator,
+		Height:     a.Height,
+		Round:      a.Round,
+		BlockA:     a.BlockHash,
+		SignatureA: a.Signature,
+		BlockB:     b.BlockHash,
+		SignatureB: b.Signature,
+	}
+}
+
+// PendingEvidence returns the double votes the next block would punish
+func (e *Engine) PendingEvidence() []*types.DoubleVote {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.pendingEvidence()
+}
+
+// pendingEvidence returns the evidence the next block may include: the
+// earliest double vote of each validator the state accepts, ordered by
+// validator (must hold lock)
+func (e *Engine) pendingEvidence() []*types.DoubleVote {
+	byValidator := make(map[types.PublicKey]*types.DoubleVote)
+	for _, ev := range e.evidence {
+		if e.state.ValidateEvidence(ev) != nil {
+			continue
+		}
+		if kept, ok := byValidator[ev.Validator]; ok && kept.Height <= ev.Height {
+			continue
+		}
+		byValidator[ev.Validator] = ev
+	}
+
+	evidence := make([]*types.DoubleVote, 0, len(byValidator))
+	for _, ev := range byValidator {
+		evidence = append(evidence, ev)
+	}
+	sort.Slice(evidence, func(i, j int) bool {
+		return bytes.Compare(evidence[i].Validator[:], evidence[j].Validator[:]) < 0
+	})
+	return evidence
+}
+
+// withoutReleases returns txs without the stake releases of validators
+// punished by evidence, which a block may not carry along with it
+func withoutReleases(txs []*types.Transaction, evidence []*types.DoubleVote) []*types.Transaction {
+	if len(evidence) == 0 {
+		return txs
+	}
+	punished := make(map[types.PublicKey]bool, len(evidence))
+	for _, ev := range evidence {
+		punished[ev.Validator] = true
+	}
+
+	kept := make([]*types.Transaction, 0, len(txs))
+	for _, tx := range txs {
+		if tx.IsStakeRelease() && punished[tx.Release.Validator] {
+			continue
+		}
+		kept = append(kept, tx)
+	}
+	return kept
+}
+
+// pruneEvidence drops evidence no later block could include, once it is
+// too old or its validator was punished (must hold lock)
+func (e *Engine) pruneEvidence() {
+	for hash, ev := range e.evidence {
+		if e.state.ValidateEvidence(ev) != nil {
+			delete(e.evidence, hash)
+		}
+	}
+}
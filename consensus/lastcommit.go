@@ -0,0 +1,76 @@
+package consensus
+
+import (
+	"bytes"
+	"sort"
+
+	"blockchain/types"
+)
+
+// noteCommitted keeps the votes for a committed block that are not in
+// its certificate. The proposer closes the certificate at 2/3 of the
+// stake, so honest votes arriving after that are carried by the next
+// block instead and still count for liveness (must hold lock).
+func (e *Engine) noteCommitted(block *types.Block) {
+	e.committed = block
+	e.lateVotes = make(map[types.PublicKey]*types.Vote)
+
+	hash := block.Header.Hash()
+	for _, vote := range e.roundVotes {
+		if vote.Height == block.Header.Height && vote.BlockHash == hash {
+			e.addLateVote(vote)
+		}
+	}
+}
+
+// collectLateVote keeps a vote for the committed block that came after
+// its certificate was closed (must hold lock)
+func (e *Engine) collectLateVote(vote *types.Vote) error {
+	commit := vote.Commit()
+	if err := e.state.ValidateLastVote(&commit, vote.BlockHash); err != nil {
+		return err
+	}
+	e.addLateVote(vote)
+	return nil
+}
+
+// addLateVote keeps a vote for the committed block unless its
+// certificate already has one from the validator (must hold lock)
+func (e *Engine) addLateVote(vote *types.Vote) {
+	for _, signed := range e.committed.Validators {
+		if signed.Validator == vote.Validator {
+			return
+		}
+	}
+	e.lateVotes[vote.Validator] = vote
+}
+
+// isLateVote reports whether a vote is for the committed block (must
+// hold lock)
+func (e *Engine) isLateVote(vote *types.Vote) bool {
+	c := e.committed
+	return c != nil && vote.Height == c.Header.Height && vote.BlockHash == c.Header.Hash()
+}
+
+// lastCommit returns the late votes a block on parent may carry, sorted
+// by validator (must hold lock)
+func (e *Engine) lastCommit(parent types.Hash) []types.ValidatorSignature {
+	if e.committed == nil || e.committed.Header.Hash() != parent {
+		return nil
+	}
+
+	votes := make([]types.ValidatorSignature, 0, len(e.lateVotes))
+	for _, vote := range e.lateVotes {
+		commit := vote.Commit()
+		if e.state.ValidateLastVote(&commit, parent) == nil {
+			votes = append(votes, commit)
+		}
+	}
+	if len(votes) == 0 {
+		return nil
+	}
+	sort.Slice(votes, func(i, j int) bool {
+		return bytes.Compare(votes[i].Validator[:], votes[j].Validator[:]) < 0
+	})
+	return votes
+}
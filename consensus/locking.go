@@ -0,0 +1,129 @@
+package consensus
+
+import (
+	"fmt"
+
+	"blockchain/types"
+)
+
+// Voting on a proposal takes two steps, as in Tendermint. A validator
+// first prevotes for a valid proposal; once prevotes for it in its
+// round carry more than 2/3 of the stake (a polka) it locks on the
+// block and casts its commit vote, and more than 2/3 of the stake in
+// commit votes finalize it. A locked validator prevotes in later rounds only for its locked
+// block, or for a block that had a polka in a round since it locked.
+// Any two quorums share more than a third of the stake, so two blocks
+// never both gather a quorum of commit votes at one height unless more
+// than a third of the stake signs against its lock, while a
+// round whose votes fell short can still be followed by one that
+// finishes: the latest block with a polka is proposed again unchanged
+// (see PendingProposal), and validators locked on it vote for it.
+
+// Prevote returns our prevote for the proposal of the current round.
+// It fails with ErrLocked if we are locked on another block and the
+// proposal does not offer again a block whose polka is newer than our
+// lock.
+func (e *Engine) Prevote() (*types.Vote, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.validatorKey == nil {
+		return nil, ErrNotValidator
+	}
+	p := e.proposal
+	if p == nil || p.Round != e.currentRound {
+		return nil, ErrNotProposal
+	}
+
+	hash := p.Block.Header.Hash()
+	if e.locked != nil && e.locked.Header.Hash() != hash {
+		unlocked := p.IsRepeat() && p.POLRound >= e.lockedRound && p.POLRound < p.Round && e.hasPolka(p.POLRound, hash)
+		if !unlocked {
+			return nil, fmt.Errorf("%w %s from round %d", ErrLocked, e.locked.Header.Hash(), e.lockedRound)
+		}
+	}
+	return e.signVote(p.Block.Header.Height, p.Round, hash, true)
+}
+
+// CommitVote locks on the proposal of the current round and returns our
+// commit vote for it, once its prevotes in that round carry more than
+// 2/3 of the stake. Before that it fails with ErrNoPolka; once the vote is cast it
+// returns nil.
+func (e *Engine) CommitVote() (*types.Vote, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.validatorKey == nil {
+		return nil, ErrNotValidator
+	}
+	p := e.proposal
+	if p == nil || p.Round != e.currentRound {
+		return nil, ErrNotProposal
+	}
+
+	height, hash := p.Block.Header.Height, p.Block.Header.Hash()
+	if !e.hasPolka(p.Round, hash) {
+		return nil, ErrNoPolka
+	}
+	if _, cast := e.signed[signedKey{height: height, round: p.Round}]; cast {
+		return nil, nil
+	}
+
+	// The lock is logged before the vote can be released, so it holds
+	// after a restart
+	if err := e.writeWAL(&WALEntry{Type: WALLock, Height: height, Round: p.Round, Block: p.Block}); err != nil {
+		return nil, err
+	}
+	e.lock(p.Block, p.Round)
+
+	return e.signVote(height, p.Round, hash, false)
+}
+
+// lock locks on block from round (must hold lock)
+func (e *Engine) lock(block *types.Block, round uint32) {
+	e.locked, e.lockedRound = block, round
+	if e.valid == nil || e.validRound <= round {
+		e.valid, e.validRound = block, round
+	}
+}
+
+// collectPrevote keeps the first prevote of a validator in each round
+// of the height being decided. A second one for another block is
+// dropped: evidence covers commit votes only. (must hold lock)
+func (e *Engine) collectPrevote(vote *types.Vote) {
+	key := voteKey{validator: vote.Validator, round: vote.Round}
+	if _, ok := e.prevotes[key]; ok {
+		return
+	}
+	e.prevotes[key] = vote
+	e.noteValid()
+}
+
+// noteValid remembers the proposal held as the block to propose again
+// in later rounds once it has a polka in its round (must hold lock)
+func (e *Engine) noteValid() {
+	p := e.proposal
+	if p == nil || (e.valid != nil && e.validRound >= p.Round) {
+		return
+	}
+	if e.hasPolka(p.Round, p.Block.Header.Hash()) {
+		e.valid, e.validRound = p.Block, p.Round
+	}
+}
+
+// hasPolka reports whether prevotes for hash in round carry more than
+// 2/3 of the stake (must hold lock)
+func (e *Engine) hasPolka(round uint32, hash types.Hash) bool {
+	var stake uint64
+	for key, vote := range e.prevotes {
+		if key.round != round || vote.BlockHash != hash {
+			continue
+		}
+		val, err := e.state.GetValidator(key.validator)
+		if err != nil {
+			continue
+		}
+		stake += val.StakedAmount
+	}
+	return stake >= quorumStake(e.totalStake)
+}
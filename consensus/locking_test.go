@@ -0,0 +1,291 @@
+package consensus
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+
+	"blockchain/ledger"
+	"blockchain/types"
+)
+
+// newTestEngines returns an engine for each of n validators of equal
+// stake, each on its own state at genesis
+func newTestEngines(t *testing.T, n int) []*Engine {
+	t.Helper()
+	return newStakedTestEngines(t, n, 100000)
+}
+
+// newStakedTestEngines is newTestEngines with each validator bonding
+// stake
+func newStakedTestEngines(t *testing.T, n int, stake uint64) []*Engine {
+	t.Helper()
+	genesis := &types.GenesisConfig{ChainID: "consensus-test"}
+	keys := make([]ed25519.PrivateKey, n)
+	for i := range keys {
+		pub, priv, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[i] = priv
+		var key types.PublicKey
+		copy(key[:], pub)
+		genesis.InitialValidators = append(genesis.InitialValidators, types.ValidatorState{
+			PublicKey:    key,
+			StakedAmount: stake,
+			SelfBond:     stake,
+			Active:       true,
+		})
+	}
+
+	engines := make([]*Engine, n)
+	for i, key := range keys {
+		state := ledger.NewState()
+		if err := state.InitializeGenesis(genesis); err != nil {
+			t.Fatal(err)
+		}
+		engines[i] = NewEngine(state, key, genesis.InitialValidators[i].PublicKey)
+		if err := engines[i].UpdateValidatorSet(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return engines
+}
+
+// testBlock returns a block at height 1 made for round
+func testBlock(round uint32, memo string) *types.Block {
+	block := &types.Block{
+		Header:       types.BlockHeader{Height: 1, Round: round},
+		Transactions: []*types.Transaction{{Version: 1, Outputs: []*types.TxOutput{{Amount: 1, Memo: []byte(memo)}}}},
+	}
+	block.Header.TxRoot = computeTxRoot(block)
+	return block
+}
+
+// propose gives the proposal to the engines numbered in to
+func propose(t *testing.T, engines []*Engine, p *types.Proposal, to ...int) {
+	t.Helper()
+	for _, i := range to {
+		if err := engines[i].SetProposal(p); err != nil {
+			t.Fatalf("validator %d: %v", i, err)
+		}
+	}
+}
+
+// deliver gives each vote to the engines numbered in to
+func deliver(t *testing.T, engines []*Engine, votes []*types.Vote, to ...int) {
+	t.Helper()
+	for _, vote := range votes {
+		for _, i := range to {
+			if err := engines[i].CollectVote(vote); err != nil && !errors.Is(err, ErrNotProposal) {
+				t.Fatalf("validator %d: %v", i, err)
+			}
+		}
+	}
+}
+
+// prevote returns the prevotes of the engines numbered in from, failing
+// unless exactly those not in locked may prevote
+func prevote(t *testing.T, engines []*Engine, from []int, locked ...int) []*types.Vote {
+	t.Helper()
+	isLocked := make(map[int]bool)
+	for _, i := range locked {
+		isLocked[i] = true
+	}
+
+	var votes []*types.Vote
+	for _, i := range from {
+		vote, err := engines[i].Prevote()
+		if isLocked[i] {
+			if !errors.Is(err, ErrLocked) {
+				t.Fatalf("validator %d: prevote against its lock: %v", i, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("validator %d: %v", i, err)
+		}
+		votes = append(votes, vote)
+	}
+	return votes
+}
+
+// advance moves every engine to the next round
+func advance(t *testing.T, engines []*Engine) {
+	t.Helper()
+	for i, e := range engines {
+		if _, err := e.AdvanceRound(1); err != nil {
+			t.Fatalf("validator %d: %v", i, err)
+		}
+	}
+}
+
+// TestLockedValidatorsFinishLaterRound checks that a height whose votes
+// fell short in one round finishes in a later one. Two of four
+// validators lock on block A in round 0 before the round times out;
+// they refuse block B in round 1, and A, proposed again in round 2,
+// is committed by all.
+func TestLockedValidatorsFinishLaterRound(t *testing.T) {
+	engines := newTestEngines(t, 4)
+	all := []int{0, 1, 2, 3}
+
+	// Round 0: all prevote A, but only validators 0 and 1 see the polka
+	// before the round times out
+	a := testBlock(0, "a")
+	propose(t, engines, &types.Proposal{Round: 0, Block: a}, all...)
+	deliver(t, engines, prevote(t, engines, all), 0, 1, 2)
+	var commits []*types.Vote
+	for _, i := range []int{0, 1} {
+		vote, err := engines[i].CommitVote()
+		if err != nil {
+			t.Fatal(err)
+		}
+		commits = append(commits, vote)
+	}
+	deliver(t, engines, commits, all...)
+	if engines[0].HasQuorum() {
+		t.Fatal("two commit votes of four made a quorum")
+	}
+	if _, err := engines[3].CommitVote(); !errors.Is(err, ErrNoPolka) {
+		t.Fatalf("commit vote without a polka: %v", err)
+	}
+	advance(t, engines)
+
+	// Round 1: the locked validators refuse B, so it has no polka
+	b := testBlock(1, "b")
+	propose(t, engines, &types.Proposal{Round: 1, Block: b}, all...)
+	deliver(t, engines, prevote(t, engines, all, 0, 1), all...)
+	if _, err := engines[2].CommitVote(); !errors.Is(err, ErrNoPolka) {
+		t.Fatalf("commit vote without a polka: %v", err)
+	}
+	advance(t, engines)
+
+	// Round 2: validator 2 saw A's polka and proposes it again
+	p := engines[2].PendingProposal(1)
+	if p == nil || p.Block.Header.Hash() != a.Header.Hash() || p.Round != 2 || p.POLRound != 0 {
+		t.Fatalf("validator 2 proposes %+v, want A again", p)
+	}
+	propose(t, engines, p, all...)
+	deliver(t, engines, prevote(t, engines, all), all...)
+	commits = nil
+	for _, i := range all {
+		vote, err := engines[i].CommitVote()
+		if err != nil {
+			t.Fatalf("validator %d: %v", i, err)
+		}
+		commits = append(commits, vote)
+	}
+	deliver(t, engines, commits, all...)
+	if !engines[2].HasQuorum() {
+		t.Fatal("no quorum for A in round 2")
+	}
+
+	block := *a
+	if err := engines[2].FinalizeBlock(&block); err != nil {
+		t.Fatal(err)
+	}
+	if err := engines[0].VerifyCertificate(block.SignedHeader()); err != nil {
+		t.Fatalf("certificate of round 2: %v", err)
+	}
+}
+
+// TestLockReleasedByLaterPolka checks that a validator locked on a
+// block prevotes for another only once that one has a polka in a round
+// after its lock, and that a certificate must not mix rounds
+func TestLockReleasedByLaterPolka(t *testing.T) {
+	engines := newTestEngines(t, 4)
+	all := []int{0, 1, 2, 3}
+
+	// Round 0: validator 0 alone sees A's polka and locks on it
+	a := testBlock(0, "a")
+	propose(t, engines, &types.Proposal{Round: 0, Block: a}, all...)
+	deliver(t, engines, prevote(t, engines, all), 0)
+	lockVote, err := engines[0].CommitVote()
+	if err != nil {
+		t.Fatal(err)
+	}
+	advance(t, engines)
+
+	// Round 1: B has a polka without validator 0, which sees it only
+	// after refusing B
+	b := testBlock(1, "b")
+	propose(t, engines, &types.Proposal{Round: 1, Block: b}, all...)
+	votes := prevote(t, engines, all, 0)
+	deliver(t, engines, votes, all...)
+	if _, err := engines[0].CommitVote(); !errors.Is(err, ErrNoPolka) && err != nil {
+		t.Fatal(err)
+	}
+	advance(t, engines)
+
+	// Round 2: B proposed again with its polka releases the lock
+	p := engines[1].PendingProposal(1)
+	if p == nil || p.Block.Header.Hash() != b.Header.Hash() || p.POLRound != 1 {
+		t.Fatalf("validator 1 proposes %+v, want B again", p)
+	}
+	propose(t, engines, p, 0)
+	if _, err := engines[0].Prevote(); err != nil {
+		t.Fatalf("prevote for B after its polka: %v", err)
+	}
+
+	// A repeat naming a polka the validator has not seen does not
+	propose(t, engines, &types.Proposal{Round: 3, POLRound: 1, Block: testBlock(1, "c")}, 0)
+	if _, err := engines[0].Prevote(); !errors.Is(err, ErrLocked) {
+		t.Fatalf("prevote for a block without a polka: %v", err)
+	}
+
+	// Votes of two rounds do not make a certificate
+	vote, err := engines[1].signVote(1, 1, a.Header.Hash(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vote2, err := engines[2].signVote(1, 1, a.Header.Hash(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mixed := *a
+	mixed.Validators = []types.ValidatorSignature{lockVote.Commit(), vote.Commit(), vote2.Commit()}
+	if err := engines[3].VerifyCertificate(mixed.SignedHeader()); err == nil {
+		t.Fatal("certificate mixing rounds 0 and 1 accepted")
+	}
+}
+
+// TestLockSurvivesRestart checks that a validator restarted from its
+// WAL keeps its lock and its votes
+func TestLockSurvivesRestart(t *testing.T) {
+	engines := newTestEngines(t, 4)
+	all := []int{0, 1, 2, 3}
+	path := t.TempDir() + "/consensus.wal"
+	if _, err := engines[0].OpenWAL(path); err != nil {
+		t.Fatal(err)
+	}
+
+	a := testBlock(0, "a")
+	propose(t, engines, &types.Proposal{Round: 0, Block: a}, all...)
+	deliver(t, engines, prevote(t, engines, all), 0)
+	if _, err := engines[0].CommitVote(); err != nil {
+		t.Fatal(err)
+	}
+	if err := engines[0].CloseWAL(); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := NewEngine(engines[0].state, engines[0].validatorKey, engines[0].validatorPub)
+	if err := restarted.UpdateValidatorSet(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := restarted.OpenWAL(path); err != nil {
+		t.Fatal(err)
+	}
+	defer restarted.CloseWAL()
+
+	if err := restarted.SetProposal(&types.Proposal{Round: 1, Block: testBlock(1, "b")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := restarted.Prevote(); !errors.Is(err, ErrLocked) {
+		t.Fatalf("prevote against the lock after a restart: %v", err)
+	}
+	if _, err := restarted.signVote(1, 0, testBlock(0, "b").Header.Hash(), true); err == nil {
+		t.Fatal("signed a second prevote in round 0 after a restart")
+	}
+}
@@ -0,0 +1,54 @@
+package consensus
+
+import (
+	"fmt"
+	"time"
+)
+
+// SlotClock divides wall-clock time into block production slots of
+// BlockTime, counted from genesis. Validators propose at slot
+// boundaries, so their schedules line up no matter when each process
+// started.
+type SlotClock struct {
+	Genesis  time.Time
+	Duration time.Duration
+}
+
+// NewSlotClock returns the slot clock of a chain from its genesis time
+// (RFC 3339). Without one, slots are aligned to the Unix epoch, which
+// still lines validators up with each other.
+func NewSlotClock(genesisTime string) (SlotClock, error) {
+	clock := SlotClock{Genesis: time.Unix(0, 0), Duration: BlockTime}
+	if genesisTime == "" {
+		return clock, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, genesisTime)
+	if err != nil {
+		return clock, fmt.Errorf("invalid genesis time %q: %w", genesisTime, err)
+	}
+	clock.Genesis = t
+	return clock, nil
+}
+
+// SlotAt returns the slot containing t. Times before genesis are in
+// slot 0.
+func (c SlotClock) SlotAt(t time.Time) uint64 {
+	if !t.After(c.Genesis) {
+		return 0
+	}
+	return uint64(t.Sub(c.Genesis) / c.Duration)
+}
+
+// SlotStart returns the time slot begins
+func (c SlotClock) SlotStart(slot uint64) time.Time {
+	return c.Genesis.Add(time.Duration(slot) * c.Duration)
+}
+
+// NextSlotStart returns the first slot boundary after t
+func (c SlotClock) NextSlotStart(t time.Time) time.Time {
+	if t.Before(c.Genesis) {
+		return c.Genesis
+	}
+	return c.SlotStart(c.SlotAt(t) + 1)
+}
@@ -0,0 +1,143 @@
+package consensus
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"blockchain/types"
+)
+
+// ErrStaleRound is returned for a proposal from a round the engine has
+// moved past. Validators do not vote on it: others may have moved on to
+// a block of a later round.
+var ErrStaleRound = errors.New("proposal from an earlier round")
+
+// TimeoutConfig sets how long a validator waits for the proposal of a
+// round, and then for the votes that commit it, before moving to the
+// next round and its proposer. The waits grow each round, so validators
+// that gave up at slightly different times meet again, and with the
+// observed proposal propagation latency, so slow links do not cause
+// round changes. Timeouts run on the local monotonic clock from the
+// start of the round or the arrival of its proposal, never from block
+// timestamps, so skewed wall clocks do not shorten them.
+type TimeoutConfig struct {
+	Propose       time.Duration // Wait in round 0, the proposer's grace period
+	ProposeDelta  time.Duration // Added per round
+	LatencyFactor float64       // Multiple of the p95 proposal latency added
+	MaxPropose    time.Duration // Longest wait in any round
+	Commit        time.Duration // Wait for prevotes and commit votes on a round 0 proposal
+	CommitDelta   time.Duration // Added per round
+	MaxCommit     time.Duration // Longest wait for votes in any round
+}
+
+// DefaultTimeoutConfig returns the timeouts used unless configured
+// otherwise: a round 0 proposer has a slot past its own to propose, and
+// a proposal two slots to gather its votes
+func DefaultTimeoutConfig() TimeoutConfig {
+	return TimeoutConfig{
+		Propose:       2 * BlockTime,
+		ProposeDelta:  BlockTime / 2,
+		LatencyFactor: 3,
+		MaxPropose:    30 * time.Second,
+		Commit:        2 * BlockTime,
+		CommitDelta:   BlockTime / 2,
+		MaxCommit:     30 * time.Second,
+	}
+}
+
+// Validate checks the timeouts are usable
+func (c TimeoutConfig) Validate() error {
+	if c.Propose < BlockTime {
+		return fmt.Errorf("propose timeout must be at least the block time (%s)", BlockTime)
+	}
+	if c.ProposeDelta < 0 || c.LatencyFactor < 0 {
+		return fmt.Errorf("propose timeout increments must not be negative")
+	}
+	if c.MaxPropose < c.Propose {
+		return fmt.Errorf("max propose timeout must be at least the propose timeout")
+	}
+	if c.Commit < BlockTime {
+		return fmt.Errorf("commit timeout must be at least the block time (%s)", BlockTime)
+	}
+	if c.CommitDelta < 0 {
+		return fmt.Errorf("commit timeout increment must not be negative")
+	}
+	if c.MaxCommit < c.Commit {
+		return fmt.Errorf("max commit timeout must be at least the commit timeout")
+	}
+	return nil
+}
+
+// ProposeTimeout returns the wait for the proposal of round, given the
+// recently observed proposal propagation latency
+func (c TimeoutConfig) ProposeTimeout(round uint32, latency time.Duration) time.Duration {
+	timeout := c.Propose + time.Duration(round)*c.ProposeDelta + time.Duration(c.LatencyFactor*float64(latency))
+	return min(timeout, c.MaxPropose)
+}
+
+// CommitTimeout returns the wait for the votes on the proposal of
+// round, from its arrival, given the recently observed proposal
+// propagation latency. Votes cross the network twice, as prevotes and
+// as commit votes.
+func (c TimeoutConfig) CommitTimeout(round uint32, latency time.Duration) time.Duration {
+	timeout := c.Commit + time.Duration(round)*c.CommitDelta + time.Duration(2*c.LatencyFactor*float64(latency))
+	return min(timeout, c.MaxCommit)
+}
+
+// SetTimeouts sets the round timeouts
+func (e *Engine) SetTimeouts(timeouts TimeoutConfig) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.timeouts = timeouts
+}
+
+// ProposeTimeout returns the wait for the proposal of the current round
+func (e *Engine) ProposeTimeout(latency time.Duration) time.Duration {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.timeouts.ProposeTimeout(e.currentRound, latency)
+}
+
+// CommitTimeout returns the wait for the votes on the proposal of the
+// current round
+func (e *Engine) CommitTimeout(latency time.Duration) time.Duration {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.timeouts.CommitTimeout(e.currentRound, latency)
+}
+
+// Round returns the current round of the height being decided
+func (e *Engine) Round() uint32 {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.currentRound
+}
+
+// AdvanceRound moves height to the next round after its proposal, or
+// the votes on it, timed out, and returns the new round. A proposal
+// held from an earlier round is dropped with its commit votes; prevotes
+// and the lock are kept (see locking.go).
+func (e *Engine) AdvanceRound(height uint64) (uint32, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := e.enterRound(height, e.currentRound+1); err != nil {
+		return 0, err
+	}
+	return e.currentRound, nil
+}
+
+// enterRound moves height to a later round (must hold lock)
+func (e *Engine) enterRound(height uint64, round uint32) error {
+	if err := e.writeWAL(&WALEntry{Type: WALRound, Height: height, Round: round}); err != nil {
+		return err
+	}
+	e.currentRound = round
+
+	if p := e.proposal; p != nil && p.Block.Header.Height == height && p.Round < round {
+		e.proposal = nil
+		e.votes = make(map[types.PublicKey]*types.ValidatorSignature)
+	}
+	return nil
+}
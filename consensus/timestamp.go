@@ -0,0 +1,78 @@
+package consensus
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"blockchain/types"
+)
+
+const (
+	// MedianTimeBlocks is how many previous blocks the median time past
+	// is taken over
+	MedianTimeBlocks = 11
+
+	// MaxFutureBlockTime is how far ahead of the local clock a block
+	// timestamp may be
+	MaxFutureBlockTime = 60 * time.Second
+)
+
+// BlockProvider looks up a stored block by height
+type BlockProvider func(height uint64) (*types.Block, error)
+
+// SetBlockProvider gives the engine access to earlier blocks for the
+// median-time-past rule. Without one only the parent block is used.
+func (e *Engine) SetBlockProvider(provider BlockProvider) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.blocks = provider
+}
+
+// MedianTimePast returns the median timestamp of the MedianTimeBlocks
+// blocks ending at prev. Blocks missing locally, such as those before a
+// state sync anchor, are left out.
+func (e *Engine) MedianTimePast(prev *types.Block) int64 {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return medianTimePast(e.blocks, prev)
+}
+
+func medianTimePast(provider BlockProvider, prev *types.Block) int64 {
+	times := []int64{prev.Header.Timestamp}
+	for height := prev.Header.Height; height > 0 && len(times) < MedianTimeBlocks && provider != nil; {
+		height--
+		block, err := provider(height)
+		if err != nil {
+			break
+		}
+		times = append(times, block.Header.Timestamp)
+	}
+
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	return times[len(times)/2]
+}
+
+// checkTimestamp applies the median-time-past and future drift rules
+func (e *Engine) checkTimestamp(block, prev *types.Block) error {
+	if mtp := e.MedianTimePast(prev); block.Header.Timestamp <= mtp {
+		return fmt.Errorf("block timestamp %d not after median time past %d", block.Header.Timestamp, mtp)
+	}
+
+	if limit := time.Now().Add(MaxFutureBlockTime).Unix(); block.Header.Timestamp > limit {
+		return fmt.Errorf("block timestamp %ds ahead of local clock (check system time)", block.Header.Timestamp-time.Now().Unix())
+	}
+
+	return nil
+}
+
+// proposalTime returns the timestamp for a block on top of prev: the
+// local time, raised above the median time past if the clock is behind
+// (must hold lock)
+func (e *Engine) proposalTime(prev *types.Block) int64 {
+	now := time.Now().Unix()
+	if mtp := medianTimePast(e.blocks, prev); now <= mtp {
+		return mtp + 1
+	}
+	return now
+}
@@ -0,0 +1,380 @@
+package consensus
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"golang.org/x/crypto/ed25519"
+
+	"blockchain/types"
+)
+
+// WAL entry types
+const (
+	WALProposal = "proposal" // Block we proposed
+	WALVote     = "vote"     // Vote received (or cast) for the current proposal
+	WALSigned   = "signed"   // Our own signature, written before it is released
+	WALRound    = "round"    // Round or height transition
+	WALLock     = "lock"     // Block we committed to, written before the commit vote
+)
+
+// maxWALEntry bounds one log line (a proposal carries a whole block)
+const maxWALEntry = 64 << 20
+
+// WALEntry is one record of the consensus write-ahead log
+type WALEntry struct {
+	Type      string                    `json:"type"`
+	Height    uint64                    `json:"height"`
+	Round     uint32                    `json:"round"`
+	Block     *types.Block              `json:"block,omitempty"`
+	Vote      *types.ValidatorSignature `json:"vote,omitempty"`
+	BlockHash *types.Hash               `json:"block_hash,omitempty"`
+	Prevote   bool                      `json:"prevote,omitempty"` // Of a signature
+}
+
+// WAL is an append-only log of consensus messages for the heights not
+// yet committed. Every entry is synced to disk before the engine acts on
+// it, so a validator that crashes mid-round resumes with the same votes
+// and lock, and never signs a conflicting block after restart.
+type WAL struct {
+	mu      sync.Mutex
+	path    string
+	file    *os.File
+	entries []*WALEntry
+}
+
+// OpenWAL opens or creates the log at path and returns it with the
+// entries already recorded. A partly written last entry is dropped.
+func OpenWAL(path string) (*WAL, []*WALEntry, error) {
+	entries, err := readWAL(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	w := &WAL{path: path, entries: entries}
+
+	// Rewrite so a torn entry left by a crash is not appended to
+	if err := w.rewrite(); err != nil {
+		return nil, nil, err
+	}
+
+	return w, entries, nil
+}
+
+// readWAL decodes entries until the end of the file or the first bad line
+func readWAL(path string) ([]*WALEntry, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []*WALEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), maxWALEntry)
+	for scanner.Scan() {
+		var entry WALEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			break
+		}
+		entries = append(entries, &entry)
+	}
+
+	return entries, nil
+}
+
+// Write appends an entry and syncs it to disk
+func (w *WAL) Write(entry *WALEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return errors.New("WAL closed")
+	}
+	if _, err := w.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("WAL write failed: %w", err)
+	}
+	if err := w.file.Sync(); err != nil {
+		return fmt.Errorf("WAL sync failed: %w", err)
+	}
+
+	w.entries = append(w.entries, entry)
+	return nil
+}
+
+// Truncate drops entries below height
+func (w *WAL) Truncate(height uint64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	kept := w.entries[:0]
+	for _, entry := range w.entries {
+		if entry.Height >= height {
+			kept = append(kept, entry)
+		}
+	}
+	if len(kept) == len(w.entries) {
+		return nil
+	}
+	w.entries = kept
+
+	return w.rewrite()
+}
+
+// rewrite replaces the log file with the entries in memory (must hold
+// lock)
+func (w *WAL) rewrite() error {
+	if w.file != nil {
+		w.file.Close()
+		w.file = nil
+	}
+
+	tmp := w.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	out := bufio.NewWriter(f)
+	for _, entry := range w.entries {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		out.Write(append(data, '\n'))
+	}
+	if err := out.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	f.Close()
+
+	if err := os.Rename(tmp, w.path); err != nil {
+		return err
+	}
+
+	w.file, err = os.OpenFile(w.path, os.O_APPEND|os.O_WRONLY, 0600)
+	return err
+}
+
+// Close closes the log file
+func (w *WAL) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// OpenWAL attaches a write-ahead log at path and replays the entries
+// for the latest committed height and the one in progress. It returns
+// the number of entries replayed.
+func (e *Engine) OpenWAL(path string) (int, error) {
+	wal, entries, err := OpenWAL(path)
+	if err != nil {
+		return 0, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.wal = wal
+
+	height := e.state.GetHeight()
+	replayed := 0
+	for _, entry := range entries {
+		if entry.Height < height {
+			continue
+		}
+
+		switch entry.Type {
+		case WALProposal:
+			if entry.Block != nil && entry.Height == height+1 {
+				e.pendingBlock = entry.Block
+			}
+		case WALVote:
+			if entry.Vote != nil && entry.Height == height+1 {
+				e.votes[entry.Vote.Validator] = entry.Vote
+			}
+		case WALSigned:
+			if entry.BlockHash != nil {
+				e.signed[signedKey{height: entry.Height, round: entry.Round, prevote: entry.Prevote}] = *entry.BlockHash
+			}
+		case WALLock:
+			if entry.Block != nil && entry.Height == height+1 {
+				e.lock(entry.Block, entry.Round)
+			}
+		case WALRound:
+			if entry.Height == height+1 {
+				e.currentRound = entry.Round
+			}
+		default:
+			continue
+		}
+		replayed++
+	}
+
+	// Proposals from an older round are not reused
+	if e.pendingBlock != nil && e.pendingBlock.Header.Round != e.currentRound {
+		e.pendingBlock = nil
+	}
+	if e.pendingBlock != nil {
+		e.proposal = &types.Proposal{Round: e.currentRound, Block: e.pendingBlock}
+	}
+
+	// Commit votes count only for the proposal held, in its round
+	for validator, vote := range e.votes {
+		if e.proposal == nil || vote.Round != e.currentRound {
+			delete(e.votes, validator)
+		}
+	}
+
+	if err := wal.Truncate(height); err != nil {
+		return replayed, err
+	}
+
+	return replayed, nil
+}
+
+// CloseWAL closes the write-ahead log, if any
+func (e *Engine) CloseWAL() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.wal == nil {
+		return nil
+	}
+	err := e.wal.Close()
+	e.wal = nil
+	return err
+}
+
+// StartHeight moves the engine on once block is committed. Votes, the
+// lock and the proposal of the finished height are dropped from memory
+// and from the log; votes for the block that missed its certificate are
+// kept for the next block.
+func (e *Engine) StartHeight(block *types.Block) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	height := block.Header.Height
+	e.noteCommitted(block)
+	e.votes = make(map[types.PublicKey]*types.ValidatorSignature)
+	e.roundVotes = make(map[voteKey]*types.Vote)
+	e.prevotes = make(map[voteKey]*types.Vote)
+	e.locked, e.lockedRound = nil, 0
+	e.valid, e.validRound = nil, 0
+	e.pruneEvidence()
+	e.currentRound = 0
+	if e.pendingBlock != nil && e.pendingBlock.Header.Height <= height {
+		e.pendingBlock = nil
+	}
+	if e.proposal != nil && e.proposal.Block.Header.Height <= height {
+		e.proposal = nil
+	}
+	for key := range e.signed {
+		if key.height <= height {
+			delete(e.signed, key)
+		}
+	}
+
+	if err := e.writeWAL(&WALEntry{Type: WALRound, Height: height + 1, Round: e.currentRound}); err != nil {
+		return err
+	}
+	if e.wal != nil {
+		return e.wal.Truncate(height)
+	}
+	return nil
+}
+
+// PendingProposal returns what we must propose for height in the
+// current round, or nil for a new block: our recorded proposal of this
+// round, broadcast again since a new block would be a conflicting
+// signature, or else the latest block with prevotes from 2/3 of the
+// stake, proposed again unchanged so validators locked on it can vote.
+func (e *Engine) PendingProposal(height uint64) *types.Proposal {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if b := e.pendingBlock; b != nil && b.Header.Height == height && b.Header.Round == e.currentRound {
+		return &types.Proposal{Round: e.currentRound, Block: b}
+	}
+	if e.valid != nil && e.valid.Header.Height == height && e.validRound < e.currentRound {
+		return &types.Proposal{Round: e.currentRound, POLRound: e.validRound, Block: e.valid}
+	}
+	return nil
+}
+
+// signedKey identifies a vote this validator signs: one prevote and one
+// commit vote at most per height and round
+type signedKey struct {
+	height  uint64
+	round   uint32
+	prevote bool
+}
+
+// checkSigned refuses to sign a second block with a vote of the same
+// type, height and round, which would be a double vote. Which block may
+// be signed in a later round is up to the lock (see locking.go). (must
+// hold lock)
+func (e *Engine) checkSigned(key signedKey, hash types.Hash) error {
+	signed, ok := e.signed[key]
+	if !ok || signed == hash {
+		return nil
+	}
+	return fmt.Errorf("already signed block %s at height %d round %d, not signing another", signed, key.height, key.round)
+}
+
+// signVote records our prevote or commit vote in the log, then signs it
+// (must hold lock)
+func (e *Engine) signVote(height uint64, round uint32, hash types.Hash, prevote bool) (*types.Vote, error) {
+	key := signedKey{height: height, round: round, prevote: prevote}
+	if err := e.checkSigned(key, hash); err != nil {
+		return nil, err
+	}
+
+	entry := &WALEntry{Type: WALSigned, Height: height, Round: round, BlockHash: &hash, Prevote: prevote}
+	if err := e.writeWAL(entry); err != nil {
+		return nil, err
+	}
+	e.signed[key] = hash
+
+	vote := &types.Vote{
+		Height:    height,
+		Round:     round,
+		BlockHash: hash,
+		Validator: e.validatorPub,
+		Prevote:   prevote,
+	}
+	copy(vote.Signature[:], ed25519.Sign(e.validatorKey, vote.Canonical(e.state.ChainID()).SignBytes()))
+	return vote, nil
+}
+
+// writeWAL appends an entry if a log is attached (must hold lock)
+func (e *Engine) writeWAL(entry *WALEntry) error {
+	if e.wal == nil {
+		return nil
+	}
+	return e.wal.Write(entry)
+}
@@ -0,0 +1,80 @@
+package crypto
+
+import (
+	"runtime"
+	"sync"
+
+	"blockchain/types"
+	"golang.org/x/crypto/ed25519"
+)
+
+// minParallelBatch is the smallest batch worth spreading across cores;
+// smaller ones are verified in place
+const minParallelBatch = 8
+
+// BatchVerifier verifies many ed25519 signatures at once, such as the
+// votes of a finality certificate. golang.org/x/crypto has no batch
+// equation, so the signatures are checked one by one but spread across
+// all cores; the result is exactly that of ed25519.Verify on each.
+type BatchVerifier struct {
+	entries []batchEntry
+}
+
+type batchEntry struct {
+	pub     types.PublicKey
+	message []byte
+	sig     types.Signature
+}
+
+// NewBatchVerifier creates a verifier for about size signatures
+func NewBatchVerifier(size int) *BatchVerifier {
+	return &BatchVerifier{entries: make([]batchEntry, 0, size)}
+}
+
+// Add queues a signature by pub over message. The message must not
+// change until Verify returns.
+func (v *BatchVerifier) Add(pub types.PublicKey, message []byte, sig types.Signature) {
+	v.entries = append(v.entries, batchEntry{pub: pub, message: message, sig: sig})
+}
+
+// Len returns the number of queued signatures
+func (v *BatchVerifier) Len() int {
+	return len(v.entries)
+}
+
+// Verify checks every queued signature. It reports whether all are
+// valid and, for each in the order added, whether it is.
+func (v *BatchVerifier) Verify() (bool, []bool) {
+	valid := make([]bool, len(v.entries))
+
+	workers := runtime.GOMAXPROCS(0)
+	if len(v.entries) < minParallelBatch || workers == 1 {
+		for i := range v.entries {
+			valid[i] = v.entries[i].verify()
+		}
+	} else {
+		workers = min(workers, len(v.entries))
+		var wg sync.WaitGroup
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				for i := w; i < len(v.entries); i += workers {
+					valid[i] = v.entries[i].verify()
+				}
+			}(w)
+		}
+		wg.Wait()
+	}
+
+	for _, ok := range valid {
+		if !ok {
+			return false, valid
+		}
+	}
+	return true, valid
+}
+
+func (e *batchEntry) verify() bool {
+	return ed25519.Verify(ed25519.PublicKey(e.pub[:]), e.message, e.sig[:])
+}
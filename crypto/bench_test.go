@@ -0,0 +1,122 @@
+package crypto
+
+import (
+	"testing"
+
+	"blockchain/types"
+)
+
+// benchRingSize is the ring size signed and verified, that of a typical
+// mainnet ring
+const benchRingSize = 11
+
+func BenchmarkRingSign(b *testing.B) {
+	signer := newBenchSigner(b)
+	message := []byte("bench")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := signer.Sign(message); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRingVerify(b *testing.B) {
+	message := []byte("bench")
+	sig, err := newBenchSigner(b).Sign(message)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if !VerifyRingSignature(sig, message) {
+			b.Fatal("ring signature does not verify")
+		}
+	}
+}
+
+func BenchmarkStealthAddress(b *testing.B) {
+	addr := newBenchWalletKeys(b).GetAddress()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := GenerateStealthAddress(addr); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkKeyImage(b *testing.B) {
+	kp, err := GenerateKeyPair()
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		GenerateKeyImage(kp.PrivateKey, kp.PublicKey)
+	}
+}
+
+// BenchmarkScanOutput scans outputs paid to someone else, as a wallet
+// does for almost every output of the chain
+func BenchmarkScanOutput(b *testing.B) {
+	benchScanOutput(b, false)
+}
+
+// BenchmarkScanTaggedOutput is BenchmarkScanOutput for outputs with a
+// view tag
+func BenchmarkScanTaggedOutput(b *testing.B) {
+	benchScanOutput(b, true)
+}
+
+func benchScanOutput(b *testing.B, viewTag bool) {
+	keys := newBenchWalletKeys(b)
+	recipient := newBenchWalletKeys(b).GetAddress()
+	output, ephemeral, err := GenerateStealthAddress(recipient)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if viewTag {
+		tag := ViewTag(ephemeral, recipient)
+		output.ViewTag = &tag
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := keys.ScanTransaction(output); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "outputs/s")
+}
+
+func newBenchWalletKeys(b *testing.B) *WalletKeys {
+	keys, err := GenerateWalletKeys()
+	if err != nil {
+		b.Fatal(err)
+	}
+	return keys
+}
+
+func newBenchSigner(b *testing.B) *RingSigner {
+	kp, err := GenerateKeyPair()
+	if err != nil {
+		b.Fatal(err)
+	}
+	decoys := make([]types.PublicKey, benchRingSize-1)
+	for i := range decoys {
+		decoy, err := GenerateKeyPair()
+		if err != nil {
+			b.Fatal(err)
+		}
+		decoys[i] = decoy.PublicKey
+	}
+	signer, err := NewRingSigner(kp.PrivateKey, kp.PublicKey, decoys)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return signer
+}
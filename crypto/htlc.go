@@ -0,0 +1,48 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+
+	"blockchain/types"
+	"golang.org/x/crypto/ed25519"
+)
+
+// HashLockKeyImage returns the key image of a hash-locked output. Like
+// MultisigKeyImage it is derived from the output reference.
+func HashLockKeyImage(txHash types.Hash, index uint32) types.PublicKey {
+	buf := make([]byte, 4)
+	binary.BigEndian.PutUint32(buf, index)
+
+	h := sha256.New()
+	h.Write([]byte("hashlock_key_image"))
+	h.Write(txHash[:])
+	h.Write(buf)
+
+	var keyImage types.PublicKey
+	copy(keyImage[:], h.Sum(nil))
+	return keyImage
+}
+
+// SwapKey returns key pair index of the keys a wallet uses in hash
+// locks. They are derived from the private spend key, so a restored
+// wallet can still redeem or refund its swaps.
+func (wk *WalletKeys) SwapKey(index uint32) (*KeyPair, error) {
+	if !wk.CanSpend() {
+		return nil, errors.New("view-only wallet has no swap keys")
+	}
+
+	var idx [4]byte
+	binary.BigEndian.PutUint32(idx[:], index)
+
+	h := sha256.New()
+	h.Write([]byte("apex/swap-key/v1"))
+	h.Write(wk.SpendKeyPair.PrivateKey[:32])
+	h.Write(idx[:])
+	priv := ed25519.NewKeyFromSeed(h.Sum(nil))
+
+	var pub types.PublicKey
+	copy(pub[:], priv.Public().(ed25519.PublicKey))
+	return &KeyPair{PrivateKey: priv, PublicKey: pub}, nil
+}
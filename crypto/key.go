@@ -63,6 +63,20 @@ func (wk *WalletKeys) GetAddress() types.Address {
 	}
 }
 
+// ViewOnly returns a copy of the wallet keys without the private spend key.
+// The result can scan for incoming outputs but cannot spend them.
+func (wk *WalletKeys) ViewOnly() *WalletKeys {
+	return &WalletKeys{
+		ViewKeyPair:  wk.ViewKeyPair,
+		SpendKeyPair: &KeyPair{PublicKey: wk.SpendKeyPair.PublicKey},
+	}
+}
+
+// CanSpend reports whether the wallet holds its private spend key
+func (wk *WalletKeys) CanSpend() bool {
+	return wk.SpendKeyPair != nil && len(wk.SpendKeyPair.PrivateKey) == ed25519.PrivateKeySize
+}
+
 // GenerateStealthAddress creates a one-time address for a recipient
 // This implements a simplified Diffie-Hellman stealth address scheme
 func GenerateStealthAddress(recipientAddr types.Address) (*types.TxOutput, *KeyPair, error) {
@@ -97,6 +111,11 @@ func (wk *WalletKeys) ScanTransaction(output *types.TxOutput) (bool, *types.Publ
 	// Compute shared secret: a * R (view_priv * tx_public_key)
 	sharedSecret := computeSharedSecret(wk.ViewKeyPair.PrivateKey, output.TxPublicKey)
 	
+	// A view tag rules out most other outputs before the key derivation
+	if output.ViewTag != nil && *output.ViewTag != viewTag(sharedSecret) {
+		return false, nil, nil
+	}
+	
 	// Derive expected one-time key
 	expectedKey := deriveOneTimeKey(sharedSecret, wk.SpendKeyPair.PublicKey)
 	
@@ -110,6 +129,10 @@ func (wk *WalletKeys) ScanTransaction(output *types.TxOutput) (bool, *types.Publ
 
 // DeriveSpendKey derives the private key to spend a stealth output
 func (wk *WalletKeys) DeriveSpendKey(output *types.TxOutput) (ed25519.PrivateKey, error) {
+	if !wk.CanSpend() {
+		return nil, errors.New("view-only wallet cannot derive spend keys")
+	}
+	
 	// Verify this output belongs to us
 	belongs, _, err := wk.ScanTransaction(output)
 	if err != nil {
@@ -131,6 +154,37 @@ func (wk *WalletKeys) DeriveSpendKey(output *types.TxOutput) (ed25519.PrivateKey
 	return oneTimePriv, nil
 }
 
+// EncryptPaymentID encrypts a payment ID for the recipient of an output
+// using the sender's ephemeral key from GenerateStealthAddress
+func EncryptPaymentID(pid types.PaymentID, ephemeral *KeyPair, recipientAddr types.Address) types.PaymentID {
+	sharedSecret := computeSharedSecret(ephemeral.PrivateKey, recipientAddr.ViewKey)
+	return xorPaymentID(pid, sharedSecret)
+}
+
+// DecryptPaymentID recovers the payment ID of an output owned by this wallet
+func (wk *WalletKeys) DecryptPaymentID(output *types.TxOutput) types.PaymentID {
+	if output.PaymentID.IsZero() {
+		return types.PaymentID{}
+	}
+	
+	sharedSecret := computeSharedSecret(wk.ViewKeyPair.PrivateKey, output.TxPublicKey)
+	return xorPaymentID(output.PaymentID, sharedSecret)
+}
+
+// xorPaymentID masks a payment ID with a keystream derived from the shared secret
+func xorPaymentID(pid types.PaymentID, sharedSecret [32]byte) types.PaymentID {
+	h := sha256.New()
+	h.Write([]byte("payment_id"))
+	h.Write(sharedSecret[:])
+	mask := h.Sum(nil)
+	
+	var result types.PaymentID
+	for i := range result {
+		result[i] = pid[i] ^ mask[i]
+	}
+	return result
+}
+
 // computeSharedSecret performs ECDH (simplified for Phase 1)
 func computeSharedSecret(privKey ed25519.PrivateKey, pubKey types.PublicKey) [32]byte {
 	// WARNING: This is NOT proper ECDH on Ed25519
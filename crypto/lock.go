@@ -0,0 +1,70 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+
+	"blockchain/types"
+	"golang.org/x/crypto/ed25519"
+)
+
+// LockKeyImage returns the key image of an output with a Lock. Like
+// MultisigKeyImage it is derived from the output reference.
+func LockKeyImage(txHash types.Hash, index uint32) types.PublicKey {
+	buf := make([]byte, 4)
+	binary.BigEndian.PutUint32(buf, index)
+
+	h := sha256.New()
+	h.Write([]byte("lock_key_image"))
+	h.Write(txHash[:])
+	h.Write(buf)
+
+	var keyImage types.PublicKey
+	copy(keyImage[:], h.Sum(nil))
+	return keyImage
+}
+
+// SignWitness creates a signature for a witness spending through path.
+// The key must be one of the path's keys.
+func SignWitness(path types.SpendPath, key *KeyPair, sigHash types.Hash) (*types.MultisigSignature, error) {
+	for i, k := range path.Keys() {
+		if k != key.PublicKey {
+			continue
+		}
+
+		var sig types.Signature
+		copy(sig[:], ed25519.Sign(key.PrivateKey, sigHash[:]))
+
+		return &types.MultisigSignature{
+			KeyIndex:  uint8(i),
+			Signature: sig,
+		}, nil
+	}
+
+	return nil, errors.New("key cannot sign for this spend path")
+}
+
+// VerifyWitnessSignatures checks witness signatures against the keys
+// they index and returns the indexes that signed. Any invalid or
+// duplicate signature fails the whole witness.
+func VerifyWitnessSignatures(keys []types.PublicKey, sigHash types.Hash, sigs []types.MultisigSignature) (map[uint8]bool, error) {
+	signed := make(map[uint8]bool)
+
+	for _, sig := range sigs {
+		if int(sig.KeyIndex) >= len(keys) {
+			return nil, errors.New("signature key index out of range")
+		}
+		if signed[sig.KeyIndex] {
+			return nil, errors.New("duplicate signature")
+		}
+
+		key := keys[sig.KeyIndex]
+		if !ed25519.Verify(ed25519.PublicKey(key[:]), sigHash[:], sig.Signature[:]) {
+			return nil, errors.New("invalid signature")
+		}
+		signed[sig.KeyIndex] = true
+	}
+
+	return signed, nil
+}
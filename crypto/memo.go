@@ -0,0 +1,53 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+
+	"blockchain/types"
+)
+
+// EncryptMemo encrypts a memo for the recipient of an output using the
+// sender's ephemeral key from GenerateStealthAddress
+// NOTE: The ciphertext length reveals the memo length
+func EncryptMemo(memo []byte, ephemeral *KeyPair, recipientAddr types.Address) ([]byte, error) {
+	if len(memo) > types.MaxMemoSize {
+		return nil, fmt.Errorf("memo exceeds %d bytes", types.MaxMemoSize)
+	}
+
+	sharedSecret := computeSharedSecret(ephemeral.PrivateKey, recipientAddr.ViewKey)
+	return xorMemo(memo, sharedSecret), nil
+}
+
+// DecryptMemo recovers the memo of an output owned by this wallet
+func (wk *WalletKeys) DecryptMemo(output *types.TxOutput) []byte {
+	if len(output.Memo) == 0 {
+		return nil
+	}
+
+	sharedSecret := computeSharedSecret(wk.ViewKeyPair.PrivateKey, output.TxPublicKey)
+	return xorMemo(output.Memo, sharedSecret)
+}
+
+// xorMemo masks a memo with a keystream of hashed counter blocks
+func xorMemo(memo []byte, sharedSecret [32]byte) []byte {
+	result := make([]byte, len(memo))
+	counter := make([]byte, 4)
+
+	for offset := 0; offset < len(memo); offset += sha256.Size {
+		binary.BigEndian.PutUint32(counter, uint32(offset/sha256.Size))
+
+		h := sha256.New()
+		h.Write([]byte("memo"))
+		h.Write(sharedSecret[:])
+		h.Write(counter)
+		block := h.Sum(nil)
+
+		for i := 0; i < sha256.Size && offset+i < len(memo); i++ {
+			result[offset+i] = memo[offset+i] ^ block[i]
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,146 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+
+	"blockchain/types"
+	"golang.org/x/crypto/ed25519"
+)
+
+// MaxMultisigParticipants bounds N so key indexes fit in a byte
+const MaxMultisigParticipants = 16
+
+// SortMultisigKeys orders participant keys so every participant derives
+// the same group keys regardless of import order
+func SortMultisigKeys(keys []types.PublicKey) []types.PublicKey {
+	sorted := make([]types.PublicKey, len(keys))
+	copy(sorted, keys)
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i][:], sorted[j][:]) < 0
+	})
+	return sorted
+}
+
+// ValidateMultisigParams checks an M-of-N configuration
+func ValidateMultisigParams(threshold uint8, keys []types.PublicKey) error {
+	if len(keys) < 2 || len(keys) > MaxMultisigParticipants {
+		return fmt.Errorf("multisig needs 2 to %d participants", MaxMultisigParticipants)
+	}
+	if threshold < 1 || int(threshold) > len(keys) {
+		return errors.New("multisig threshold must be between 1 and the number of participants")
+	}
+
+	seen := make(map[types.PublicKey]bool)
+	for _, k := range keys {
+		if seen[k] {
+			return errors.New("duplicate multisig participant")
+		}
+		seen[k] = true
+	}
+
+	return nil
+}
+
+// AggregateMultisigKey derives the spend key that identifies an M-of-N
+// group. It is used for scanning, not for signing.
+func AggregateMultisigKey(threshold uint8, keys []types.PublicKey) types.PublicKey {
+	h := sha256.New()
+	h.Write([]byte("multisig"))
+	h.Write([]byte{threshold})
+	for _, k := range SortMultisigKeys(keys) {
+		h.Write(k[:])
+	}
+
+	var agg types.PublicKey
+	copy(agg[:], h.Sum(nil))
+	return agg
+}
+
+// MultisigViewKey derives the shared view keypair from the participants'
+// view key seeds. Every participant can scan the group's outputs.
+func MultisigViewKey(viewSeeds [][]byte) (*KeyPair, error) {
+	sorted := make([][]byte, len(viewSeeds))
+	copy(sorted, viewSeeds)
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i], sorted[j]) < 0
+	})
+
+	h := sha256.New()
+	h.Write([]byte("multisig_view"))
+	for _, seed := range sorted {
+		if len(seed) != ed25519.SeedSize {
+			return nil, errors.New("invalid view key seed")
+		}
+		h.Write(seed)
+	}
+
+	priv := ed25519.NewKeyFromSeed(h.Sum(nil))
+
+	var pub types.PublicKey
+	copy(pub[:], priv.Public().(ed25519.PublicKey))
+
+	return &KeyPair{PrivateKey: priv, PublicKey: pub}, nil
+}
+
+// GenerateMultisigOutput creates an output spendable by M of N participants
+func GenerateMultisigOutput(addr types.MultisigAddress) (*types.TxOutput, *KeyPair, error) {
+	if err := ValidateMultisigParams(addr.Threshold, addr.SpendKeys); err != nil {
+		return nil, nil, err
+	}
+
+	// Pay the group key so the shared view key can find the output
+	output, ephemeral, err := GenerateStealthAddress(types.Address{
+		ViewKey:  addr.ViewKey,
+		SpendKey: AggregateMultisigKey(addr.Threshold, addr.SpendKeys),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	output.Multisig = &types.MultisigCondition{
+		Threshold: addr.Threshold,
+		Keys:      SortMultisigKeys(addr.SpendKeys),
+	}
+
+	return output, ephemeral, nil
+}
+
+// MultisigKeyImage returns the key image of a multisig output. It is
+// derived from the output reference so double-spends are still caught.
+func MultisigKeyImage(txHash types.Hash, index uint32) types.PublicKey {
+	buf := make([]byte, 4)
+	binary.BigEndian.PutUint32(buf, index)
+
+	h := sha256.New()
+	h.Write([]byte("multisig_key_image"))
+	h.Write(txHash[:])
+	h.Write(buf)
+
+	var keyImage types.PublicKey
+	copy(keyImage[:], h.Sum(nil))
+	return keyImage
+}
+
+// SignMultisig creates a participant signature over a transaction hash
+func SignMultisig(cond *types.MultisigCondition, spendKey *KeyPair, txHash types.Hash) (*types.MultisigSignature, error) {
+	for i, k := range cond.Keys {
+		if k != spendKey.PublicKey {
+			continue
+		}
+
+		var sig types.Signature
+		copy(sig[:], ed25519.Sign(spendKey.PrivateKey, txHash[:]))
+
+		return &types.MultisigSignature{
+			KeyIndex:  uint8(i),
+			Signature: sig,
+		}, nil
+	}
+
+	return nil, errors.New("key is not a participant of this multisig output")
+}
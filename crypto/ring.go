@@ -52,6 +52,32 @@ func NewRingSigner(realPriv ed25519.PrivateKey, realPub types.PublicKey, decoys
 	}, nil
 }
 
+// NewOrderedRingSigner creates a signer for a ring given in full, with
+// the real key at whatever position the ring order puts it, such as
+// global output index order
+func NewOrderedRingSigner(realPriv ed25519.PrivateKey, realPub types.PublicKey, ring []types.PublicKey) (*RingSigner, error) {
+	if len(ring) < 3 {
+		return nil, errors.New("need at least 2 decoy keys for anonymity")
+	}
+	
+	realIndex := -1
+	for i, pk := range ring {
+		if pk == realPub {
+			realIndex = i
+		}
+	}
+	if realIndex < 0 {
+		return nil, errors.New("real key is not in the ring")
+	}
+	
+	return &RingSigner{
+		realIndex: realIndex,
+		realPriv:  realPriv,
+		ring:      ring,
+		keyImage:  GenerateKeyImage(realPriv, realPub),
+	}, nil
+}
+
 // Sign creates a ring signature (Simplified LSAG - Linkable Spontaneous Anonymous Group)
 func (rs *RingSigner) Sign(message []byte) (*types.RingSignature, error) {
 	n := len(rs.ring)
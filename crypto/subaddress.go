@@ -0,0 +1,49 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+
+	"golang.org/x/crypto/ed25519"
+	"blockchain/types"
+)
+
+// Subaddress returns the keys of subaddress index within account.
+// Subaddresses share the wallet's view key, so one scan finds outputs
+// paid to any of them; (0, 0) is the main address.
+// The spend public key is derived from the private view key, so
+// view-only wallets can scan subaddresses; the private spend key needs
+// the wallet's private spend key.
+// NOTE: Phase 1 derivation is hash-based like the stealth scheme
+// TODO Phase 2: D = B + Hs(a || account || index)·G
+func (wk *WalletKeys) Subaddress(account, index uint32) *WalletKeys {
+	if account == 0 && index == 0 {
+		return wk
+	}
+
+	var idx [8]byte
+	binary.BigEndian.PutUint32(idx[:4], account)
+	binary.BigEndian.PutUint32(idx[4:], index)
+
+	h := sha256.New()
+	h.Write([]byte("apex/subaddress/v1"))
+	h.Write(wk.ViewKeyPair.PrivateKey[:32])
+	h.Write(wk.SpendKeyPair.PublicKey[:])
+	h.Write(idx[:])
+	var spendPub types.PublicKey
+	copy(spendPub[:], h.Sum(nil))
+
+	spend := &KeyPair{PublicKey: spendPub}
+	if wk.CanSpend() {
+		h := sha256.New()
+		h.Write([]byte("apex/subaddress-spend/v1"))
+		h.Write(wk.SpendKeyPair.PrivateKey[:32])
+		h.Write(spendPub[:])
+		spend.PrivateKey = ed25519.NewKeyFromSeed(h.Sum(nil))
+	}
+
+	return &WalletKeys{
+		ViewKeyPair:  wk.ViewKeyPair,
+		SpendKeyPair: spend,
+	}
+}
@@ -0,0 +1,23 @@
+package crypto
+
+import (
+	"crypto/sha256"
+
+	"blockchain/types"
+)
+
+// ViewTag returns the view tag of an output for a recipient, using the
+// sender's ephemeral key from GenerateStealthAddress. A wallet whose
+// shared secret gives another tag skips the output without deriving its
+// one-time key; one in 256 outputs that are not the wallet's still pass.
+func ViewTag(ephemeral *KeyPair, recipientAddr types.Address) uint8 {
+	return viewTag(computeSharedSecret(ephemeral.PrivateKey, recipientAddr.ViewKey))
+}
+
+// viewTag derives the view tag from a shared secret
+func viewTag(sharedSecret [32]byte) uint8 {
+	h := sha256.New()
+	h.Write([]byte("view_tag"))
+	h.Write(sharedSecret[:])
+	return h.Sum(nil)[0]
+}
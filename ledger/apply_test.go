@@ -0,0 +1,130 @@
+package ledger
+
+import (
+	"math/rand"
+	"testing"
+
+	"blockchain/crypto"
+	"blockchain/types"
+)
+
+// stateRoot returns the root a state sync manifest would carry
+func stateRoot(s *State) types.Hash {
+	return types.NewChunkedState(s.Export()).Manifest.StateRoot()
+}
+
+// randomBlock returns the next block for state with one to three
+// transactions and maybe a coinbase. When invalid is set one rule is
+// broken, picked at random; spent are the key pairs spent so far.
+func randomBlock(t *testing.T, rng *rand.Rand, state *State, spent []*crypto.KeyPair, invalid bool) (*types.Block, []*crypto.KeyPair) {
+	t.Helper()
+	var txs []*types.Transaction
+	for i := rng.Intn(3); i >= 0; i-- {
+		kp, err := crypto.GenerateKeyPair()
+		if err != nil {
+			t.Fatal(err)
+		}
+		fee := uint64(rng.Intn(20))
+		txs = append(txs, newTestSpend(t, kp, 1000, func(tx *types.Transaction) {
+			tx.Outputs[0].Amount -= fee
+			tx.Fee = fee
+		}))
+		spent = append(spent, kp)
+	}
+
+	reward, err := state.BlockReward(state.GetHeight()+1, txs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claim := uint64(rng.Int63n(int64(reward) + 1))
+
+	if invalid {
+		switch rng.Intn(4) {
+		case 0: // Spend a key image again
+			txs = append(txs, newTestSpend(t, spent[rng.Intn(len(spent))], 500, nil))
+		case 1: // Claim more than the reward
+			claim = reward + 1
+		case 2: // Break a signature
+			txs[rng.Intn(len(txs))].Outputs[0].Memo = []byte("changed")
+		case 3: // Spend more than the inputs
+			txs = append(txs, newTestTx(t, 1000, func(tx *types.Transaction) { tx.Outputs[0].Amount = 1001 }))
+		}
+	}
+
+	if claim > 0 {
+		txs = append([]*types.Transaction{newTestCoinbase(t, claim)}, txs...)
+	}
+	block := &types.Block{Header: types.BlockHeader{Height: state.GetHeight() + 1}, Transactions: txs}
+	return block, spent
+}
+
+// TestApplyBlockAtomic checks over random chains that a block is
+// applied whole or not at all: a rejected block leaves the state root
+// and height as they were, whichever of its rules it breaks
+func TestApplyBlockAtomic(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	state := newTestState(t)
+	var spent []*crypto.KeyPair
+
+	for i := 0; i < 40; i++ {
+		invalid := i > 0 && rng.Intn(2) == 0
+		block, more := randomBlock(t, rng, state, spent, invalid)
+		root, height := stateRoot(state), state.GetHeight()
+
+		err := state.ApplyBlock(block)
+		if invalid {
+			if err == nil {
+				t.Fatalf("block %d: invalid block applied", i)
+			}
+			if stateRoot(state) != root || state.GetHeight() != height {
+				t.Fatalf("block %d: rejected block changed the state", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("block %d: %v", i, err)
+		}
+		spent = more
+	}
+}
+
+// TestApplyRevert checks over random chains that reverting a block by
+// restoring the state from before it gives back the same root, whether
+// from a view or an export, and that applying it again gives the same
+// state as the first time
+func TestApplyRevert(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	state := newTestState(t)
+	var spent []*crypto.KeyPair
+
+	for i := 0; i < 20; i++ {
+		block, more := randomBlock(t, rng, state, spent, false)
+		spent = more
+
+		before := stateRoot(state)
+		view := state.View()
+		if err := state.ApplyBlock(block); err != nil {
+			t.Fatalf("block %d: %v", i, err)
+		}
+		after := stateRoot(state)
+		if after == before {
+			t.Fatalf("block %d: applying did not change the state root", i)
+		}
+		if stateRoot(view) != before {
+			t.Fatalf("block %d: view taken before the block changed", i)
+		}
+
+		if err := state.Restore(view.Export()); err != nil {
+			t.Fatalf("block %d: revert: %v", i, err)
+		}
+		if stateRoot(state) != before {
+			t.Fatalf("block %d: revert did not restore the state root", i)
+		}
+		if err := state.ApplyBlock(block); err != nil {
+			t.Fatalf("block %d: applying again after revert: %v", i, err)
+		}
+		if stateRoot(state) != after {
+			t.Fatalf("block %d: applying again gave another state root", i)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package ledger
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"blockchain/crypto"
+	"blockchain/types"
+)
+
+const (
+	// benchRingSize is the ring size of benchmark transactions, that of
+	// a typical mainnet ring
+	benchRingSize = 11
+
+	benchChainID = "bench"
+)
+
+// BenchmarkApplyBlock validates and applies a block of 10,000
+// ring-signed transactions to a fresh state
+func BenchmarkApplyBlock(b *testing.B) {
+	const txs = 10000
+	block := &types.Block{
+		Header:       types.BlockHeader{Height: 1},
+		Transactions: newBenchTransactions(b, txs),
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		state := newBenchState(b)
+		b.StartTimer()
+		if err := state.ApplyBlock(block); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(b.N*txs)/b.Elapsed().Seconds(), "tx/s")
+}
+
+// BenchmarkStateLookupParallel looks up outputs and key images from
+// every CPU, as RPC and relay checks do, while another goroutine keeps
+// taking the state's write lock
+func BenchmarkStateLookupParallel(b *testing.B) {
+	txs := newBenchTransactions(b, 100)
+	state := newBenchState(b)
+	if err := state.ApplyBlock(&types.Block{Header: types.BlockHeader{Height: 1}, Transactions: txs}); err != nil {
+		b.Fatal(err)
+	}
+	kp, err := crypto.GenerateKeyPair()
+	if err != nil {
+		b.Fatal(err)
+	}
+	validator := kp.PublicKey
+	if err := state.AddValidator(validator, 1, 0, 0, 1); err != nil {
+		b.Fatal(err)
+	}
+
+	hashes := make([]types.Hash, len(txs))
+	for i, tx := range txs {
+		hashes[i] = tx.Hash()
+	}
+
+	done := make(chan struct{})
+	var writer sync.WaitGroup
+	writer.Add(1)
+	go func() {
+		defer writer.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				state.UpdateValidator(validator, func(val *types.ValidatorState) { val.StakingNonce++ })
+			}
+		}
+	}()
+	defer writer.Wait()
+	defer close(done)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	// b.Fatal must not be called outside the benchmark goroutine
+	var missed atomic.Bool
+	b.RunParallel(func(pb *testing.PB) {
+		for i := 0; pb.Next(); i++ {
+			if _, err := state.GetUTXO(hashes[i%len(hashes)], 0); err != nil {
+				missed.Store(true)
+			}
+			if !state.IsKeyImageSpent(txs[i%len(txs)].Inputs[0].KeyImage) {
+				missed.Store(true)
+			}
+		}
+	})
+	if missed.Load() {
+		b.Fatal("lookup missed an applied output or key image")
+	}
+	b.ReportMetric(float64(2*b.N)/b.Elapsed().Seconds(), "lookups/s")
+}
+
+// newBenchState returns a state at genesis holding the whole money
+// supply, so any number of benchmark transactions can be applied
+func newBenchState(b *testing.B) *State {
+	state := NewState()
+	genesis := &types.GenesisConfig{ChainID: benchChainID, InitialSupply: types.MoneySupply}
+	if err := state.InitializeGenesis(genesis); err != nil {
+		b.Fatal(err)
+	}
+	return state
+}
+
+// newBenchTransactions creates n valid transactions, each spending a
+// fresh key with a full ring. Before protocol version 10 rings need not
+// name outputs, so the state needs no outputs to spend.
+func newBenchTransactions(b *testing.B, n int) []*types.Transaction {
+	keys, err := crypto.GenerateWalletKeys()
+	if err != nil {
+		b.Fatal(err)
+	}
+	recipient := keys.GetAddress()
+	decoys := make([]types.PublicKey, benchRingSize-1)
+	for i := range decoys {
+		decoy, err := crypto.GenerateKeyPair()
+		if err != nil {
+			b.Fatal(err)
+		}
+		decoys[i] = decoy.PublicKey
+	}
+
+	txs := make([]*types.Transaction, n)
+	for i := range txs {
+		kp, err := crypto.GenerateKeyPair()
+		if err != nil {
+			b.Fatal(err)
+		}
+		output, _, err := crypto.GenerateStealthAddress(recipient)
+		if err != nil {
+			b.Fatal(err)
+		}
+		output.Amount = 1000
+
+		tx := &types.Transaction{
+			Version: 1,
+			Inputs: []*types.TxInput{{
+				KeyImage: crypto.GenerateKeyImage(kp.PrivateKey, kp.PublicKey),
+				Amount:   1000,
+			}},
+			Outputs: []*types.TxOutput{output},
+		}
+		signer, err := crypto.NewRingSigner(kp.PrivateKey, kp.PublicKey, decoys)
+		if err != nil {
+			b.Fatal(err)
+		}
+		sigHash := types.TxSigningHash(benchChainID, tx.PrefixHash())
+		if tx.RingSignature, err = signer.Sign(sigHash[:]); err != nil {
+			b.Fatal(err)
+		}
+		txs[i] = tx
+	}
+	return txs
+}
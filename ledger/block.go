@@ -0,0 +1,82 @@
+package ledger
+
+import (
+	"errors"
+	"fmt"
+
+	"blockchain/types"
+)
+
+// ValidateBlockBody checks the transactions, coinbase, staking
+// transactions, evidence and late votes of the next block exactly as
+// ApplyBlock does, so a block that passes can be applied
+func (s *State) ValidateBlockBody(block *types.Block) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.validateBlockBody(block)
+}
+
+// validateBlockBody checks everything a block changes the state with
+// (must hold lock)
+func (s *State) validateBlockBody(block *types.Block) error {
+	if err := s.validateBlockTransactions(block); err != nil {
+		return err
+	}
+	if err := s.validateStaking(block); err != nil {
+		return err
+	}
+	if err := s.validateEvidence(block); err != nil {
+		return err
+	}
+	return s.validateLastCommit(block)
+}
+
+// validateBlockTransactions checks every transaction of a block against
+// the parent state with the rules of ValidateTransaction, and the rules
+// between them: only the first may be a coinbase, only one may spend the
+// treasury since each needs the next nonce, only one may release each
+// validator's stake, none of a validator the block punishes, and no two
+// may spend the same key image. The coinbase is checked against the block reward
+// (see coinbase.go) (must hold lock).
+func (s *State) validateBlockTransactions(block *types.Block) error {
+	seen := make(map[types.PublicKey]bool)
+	treasurySpends := 0
+	released := make(map[types.PublicKey]bool)
+	for i, tx := range block.Transactions {
+		if tx.IsCoinbase() {
+			if i != 0 {
+				return errors.New("coinbase must be the first transaction")
+			}
+			if err := s.validateCoinbase(block); err != nil {
+				return err
+			}
+			continue
+		}
+		if tx.IsTreasurySpend() {
+			if treasurySpends++; treasurySpends > 1 {
+				return errors.New("block spends the treasury more than once")
+			}
+		}
+		if r := tx.Release; r != nil {
+			if released[r.Validator] {
+				return fmt.Errorf("transaction %d: stake released twice in block", i)
+			}
+			released[r.Validator] = true
+			for _, ev := range block.Evidence {
+				if ev.Validator == r.Validator {
+					return fmt.Errorf("transaction %d: stake released in a block punishing its validator", i)
+				}
+			}
+		}
+		if err := s.validateTransaction(tx); err != nil {
+			return fmt.Errorf("transaction %d: %w", i, err)
+		}
+		for _, input := range tx.AllInputs() {
+			if seen[input.KeyImage] {
+				return fmt.Errorf("transaction %d: key image spent twice in block", i)
+			}
+			seen[input.KeyImage] = true
+		}
+	}
+	return nil
+}
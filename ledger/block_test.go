@@ -0,0 +1,316 @@
+package ledger
+
+import (
+	"strings"
+	"testing"
+
+	"blockchain/crypto"
+	"blockchain/types"
+)
+
+const testChainID = "ledger-test"
+
+// newTestState returns a state after genesis with room for a subsidy of
+// 50 per block
+func newTestState(t testing.TB) *State {
+	t.Helper()
+	state := NewState()
+	genesis := &types.GenesisConfig{
+		ChainID:       testChainID,
+		InitialSupply: 1_000_000,
+		Emission:      types.EmissionConfig{InitialSubsidy: 50},
+	}
+	if err := state.InitializeGenesis(genesis); err != nil {
+		t.Fatal(err)
+	}
+	return state
+}
+
+// newTestTx returns a valid transaction spending a fresh key of amount
+// with a ring of three, changed by edit before it is signed
+func newTestTx(t testing.TB, amount uint64, edit func(tx *types.Transaction)) *types.Transaction {
+	t.Helper()
+	kp, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newTestSpend(t, kp, amount, edit)
+}
+
+// newTestSpend is newTestTx spending kp
+func newTestSpend(t testing.TB, kp *crypto.KeyPair, amount uint64, edit func(tx *types.Transaction)) *types.Transaction {
+	t.Helper()
+	keys, err := crypto.GenerateWalletKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, _, err := crypto.GenerateStealthAddress(keys.GetAddress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	output.Amount = amount
+
+	tx := &types.Transaction{
+		Version: 1,
+		Inputs: []*types.TxInput{{
+			KeyImage: crypto.GenerateKeyImage(kp.PrivateKey, kp.PublicKey),
+			Amount:   amount,
+		}},
+		Outputs: []*types.TxOutput{output},
+	}
+	if edit != nil {
+		edit(tx)
+	}
+
+	decoys := make([]types.PublicKey, 2)
+	for i := range decoys {
+		decoy, err := crypto.GenerateKeyPair()
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoys[i] = decoy.PublicKey
+	}
+	signer, err := crypto.NewRingSigner(kp.PrivateKey, kp.PublicKey, decoys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sigHash := types.TxSigningHash(testChainID, tx.PrefixHash())
+	if tx.RingSignature, err = signer.Sign(sigHash[:]); err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+// newTestCoinbase returns a coinbase paying amount
+func newTestCoinbase(t testing.TB, amount uint64) *types.Transaction {
+	t.Helper()
+	keys, err := crypto.GenerateWalletKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, _, err := crypto.GenerateStealthAddress(keys.GetAddress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	output.Amount = amount
+	return &types.Transaction{Version: 1, Outputs: []*types.TxOutput{output}}
+}
+
+func testBlock(txs ...*types.Transaction) *types.Block {
+	return &types.Block{Header: types.BlockHeader{Height: 1}, Transactions: txs}
+}
+
+// TestMempoolBlockParity checks that a transaction the mempool accepts
+// is accepted alone in a block, and one it refuses is refused by both
+// ValidateBlockBody and ApplyBlock
+func TestMempoolBlockParity(t *testing.T) {
+	cases := []struct {
+		name  string
+		tx    func(t *testing.T) *types.Transaction
+		valid bool
+	}{
+		{"valid", func(t *testing.T) *types.Transaction { return newTestTx(t, 1000, nil) }, true},
+		{"bad signature", func(t *testing.T) *types.Transaction {
+			tx := newTestTx(t, 1000, nil)
+			tx.Outputs[0].Amount = 999 // Changes the signed prefix
+			return tx
+		}, false},
+		{"outputs exceed inputs", func(t *testing.T) *types.Transaction {
+			return newTestTx(t, 1000, func(tx *types.Transaction) { tx.Outputs[0].Amount = 1001 })
+		}, false},
+		{"inactive version", func(t *testing.T) *types.Transaction {
+			return newTestTx(t, 1000, func(tx *types.Transaction) { tx.Version = types.ProtocolVersion + 1 })
+		}, false},
+		{"long memo", func(t *testing.T) *types.Transaction {
+			return newTestTx(t, 1000, func(tx *types.Transaction) {
+				tx.Outputs[0].Memo = []byte(strings.Repeat("m", types.MaxMemoSize+1))
+			})
+		}, false},
+		{"burn before its version", func(t *testing.T) *types.Transaction {
+			return newTestTx(t, 1000, func(tx *types.Transaction) { tx.Outputs[0].Burn = true })
+		}, false},
+		{"bond before its version", func(t *testing.T) *types.Transaction {
+			return newTestTx(t, 1000, func(tx *types.Transaction) {
+				tx.Outputs[0].Bond = &tx.Outputs[0].StealthAddr.SpendKey
+			})
+		}, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tx := c.tx(t)
+			state := newTestState(t)
+
+			mempoolErr := state.ValidateTransaction(tx)
+			bodyErr := state.ValidateBlockBody(testBlock(tx))
+			applyErr := state.ApplyBlock(testBlock(tx))
+
+			if (mempoolErr == nil) != c.valid {
+				t.Fatalf("mempool: got %v, want valid=%v", mempoolErr, c.valid)
+			}
+			if (bodyErr == nil) != (mempoolErr == nil) {
+				t.Fatalf("mempool %v, ValidateBlockBody %v", mempoolErr, bodyErr)
+			}
+			if (applyErr == nil) != (mempoolErr == nil) {
+				t.Fatalf("mempool %v, ApplyBlock %v", mempoolErr, applyErr)
+			}
+		})
+	}
+}
+
+// TestBlockRules checks the rules between the transactions of a block,
+// which the mempool cannot check one transaction at a time
+func TestBlockRules(t *testing.T) {
+	t.Run("key image spent twice", func(t *testing.T) {
+		state := newTestState(t)
+		kp, err := crypto.GenerateKeyPair()
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx := newTestSpend(t, kp, 1000, nil)
+		double := newTestSpend(t, kp, 500, nil)
+
+		for _, single := range []*types.Transaction{tx, double} {
+			if err := state.ValidateTransaction(single); err != nil {
+				t.Fatalf("mempool refused a transaction alone: %v", err)
+			}
+		}
+		if err := state.ValidateBlockBody(testBlock(tx, double)); err == nil {
+			t.Fatal("block spending a key image twice validated")
+		}
+	})
+
+	t.Run("spent key image", func(t *testing.T) {
+		state := newTestState(t)
+		tx := newTestTx(t, 1000, nil)
+		if err := state.ApplyBlock(testBlock(tx)); err != nil {
+			t.Fatal(err)
+		}
+		if state.ValidateTransaction(tx) == nil {
+			t.Fatal("mempool accepted a spent key image")
+		}
+		next := testBlock(tx)
+		next.Header.Height = 2
+		if state.ValidateBlockBody(next) == nil {
+			t.Fatal("block spending a spent key image validated")
+		}
+	})
+}
+
+// TestCoinbase checks that blocks check their coinbase against the
+// reward in the ledger, whoever validates them
+func TestCoinbase(t *testing.T) {
+	state := newTestState(t)
+	tip := newTestTx(t, 1000, func(tx *types.Transaction) {
+		tx.Outputs[0].Amount = 990
+		tx.Fee = 10
+	})
+
+	reward, err := state.BlockReward(1, []*types.Transaction{tip})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reward != 60 {
+		t.Fatalf("reward %d, want subsidy 50 plus fee 10", reward)
+	}
+
+	if state.ValidateTransaction(newTestCoinbase(t, 1)) == nil {
+		t.Fatal("mempool accepted a coinbase")
+	}
+	if err := state.ValidateBlockBody(testBlock(tip, newTestCoinbase(t, 1))); err == nil {
+		t.Fatal("coinbase after another transaction validated")
+	}
+
+	over := testBlock(newTestCoinbase(t, reward+1), tip)
+	if err := state.ValidateBlockBody(over); err == nil {
+		t.Fatal("coinbase claiming more than the reward validated")
+	}
+	if err := state.ApplyBlock(over); err == nil {
+		t.Fatal("coinbase claiming more than the reward applied")
+	}
+
+	burn := newTestCoinbase(t, reward)
+	burn.Outputs[0].Burn = true
+	if err := state.ValidateBlockBody(testBlock(burn, tip)); err == nil {
+		t.Fatal("coinbase burning its reward validated")
+	}
+
+	if err := state.ApplyBlock(testBlock(newTestCoinbase(t, reward), tip)); err != nil {
+		t.Fatalf("coinbase claiming the reward: %v", err)
+	}
+	if supply := state.GetTotalSupply(); supply != 1_000_000+50 {
+		t.Fatalf("supply %d, want the initial supply plus the subsidy", supply)
+	}
+}
+
+// TestCoinbaseDust checks that coinbase outputs are held to the dust
+// limit like those of transactions
+func TestCoinbaseDust(t *testing.T) {
+	state := NewState()
+	genesis := &types.GenesisConfig{
+		ChainID:       testChainID,
+		InitialSupply: 1_000_000,
+		Emission:      types.EmissionConfig{InitialSubsidy: 50},
+		DustLimit:     20,
+		Forks:         types.ForkSchedule{{Name: "dust", Version: types.DustLimitVersion, Height: 1}},
+	}
+	if err := state.InitializeGenesis(genesis); err != nil {
+		t.Fatal(err)
+	}
+
+	split := newTestCoinbase(t, 40)
+	split.Outputs = append(split.Outputs, newTestCoinbase(t, 10).Outputs...)
+	if err := state.ValidateBlockBody(testBlock(split)); err == nil {
+		t.Fatal("coinbase output below the dust limit validated")
+	}
+	if err := state.ApplyBlock(testBlock(split)); err == nil {
+		t.Fatal("coinbase output below the dust limit applied")
+	}
+
+	split.Outputs[0].Amount, split.Outputs[1].Amount = 30, 20
+	if err := state.ApplyBlock(testBlock(split)); err != nil {
+		t.Fatalf("coinbase outputs at the dust limit: %v", err)
+	}
+}
+
+// TestValidatorCopies checks that the validators handed out by the
+// getters are copies, which applying a block leaves unchanged while
+// other goroutines read them
+func TestValidatorCopies(t *testing.T) {
+	state := NewState()
+	validator := types.PublicKey{1}
+	genesis := &types.GenesisConfig{
+		ChainID: testChainID,
+		InitialValidators: []types.ValidatorState{
+			{PublicKey: validator, StakedAmount: 1000, SelfBond: 1000, Active: true},
+		},
+	}
+	if err := state.InitializeGenesis(genesis); err != nil {
+		t.Fatal(err)
+	}
+
+	val, err := state.GetValidator(validator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	active := state.GetActiveValidators()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			_ = val.MissedCount + active[0].MissedCount
+		}
+	}()
+	if err := state.ApplyBlock(testBlock()); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+
+	if val.MissedCount != 0 || active[0].MissedCount != 0 {
+		t.Fatal("applying a block changed a validator handed out before")
+	}
+	if val, _ = state.GetValidator(validator); val.MissedCount != 1 {
+		t.Fatalf("validator missed %d blocks, want the one applied", val.MissedCount)
+	}
+}
@@ -0,0 +1,96 @@
+package ledger
+
+import (
+	"errors"
+	"fmt"
+
+	"blockchain/types"
+)
+
+// BlockReward returns the subsidy plus fees the block at height, the
+// next one, may claim with txs. The subsidy stops once the supply cap
+// is reached, and the treasury's share of it is credited by ApplyBlock
+// instead. Of each fee only the tip above the base fee may be claimed;
+// the base fee is burned.
+func (s *State) BlockReward(height uint64, txs []*types.Transaction) (uint64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.blockReward(height, txs)
+}
+
+// blockReward returns what a coinbase at height may claim (must hold
+// lock)
+func (s *State) blockReward(height uint64, txs []*types.Transaction) (uint64, error) {
+	subsidy := s.blockSubsidy(height)
+	subsidy -= s.emission.TreasuryShare(subsidy)
+	baseFee := s.baseFeeAt(height)
+
+	reward := subsidy
+	for _, tx := range txs {
+		if !tx.PaysBaseFee() || tx.Fee <= baseFee {
+			continue
+		}
+		var err error
+		if reward, err = types.AddAmounts(reward, tx.Fee-baseFee); err != nil {
+			return 0, err
+		}
+	}
+	return reward, nil
+}
+
+// validateCoinbase checks that a block's coinbase is plain outputs, held
+// to the same output rules and dust limit as transactions, claiming no
+// more than the subsidy plus the fees of the block's other transactions
+// (must hold lock)
+func (s *State) validateCoinbase(block *types.Block) error {
+	coinbase := block.Transactions[0]
+
+	if coinbase.RingSignature != nil || coinbase.Fee != 0 || coinbase.FeePayer != nil {
+		return errors.New("coinbase must not carry a signature or fee")
+	}
+	if len(coinbase.Outputs) == 0 {
+		return errors.New("coinbase has no outputs")
+	}
+	if version := s.forks.VersionAt(block.Header.Height); uint32(coinbase.Version) > version {
+		return fmt.Errorf("coinbase version %d not active (protocol version %d)", coinbase.Version, version)
+	}
+	if coinbase.HasViewTags() && coinbase.Version < types.TxVersionViewTag {
+		return fmt.Errorf("view tags need transaction version %d", types.TxVersionViewTag)
+	}
+
+	for _, output := range coinbase.Outputs {
+		if len(output.Memo) > types.MaxMemoSize {
+			return fmt.Errorf("memo exceeds %d bytes", types.MaxMemoSize)
+		}
+		if output.HashLock != nil {
+			return errors.New("coinbase cannot create hash-locked outputs")
+		}
+		if output.Lock != nil {
+			return errors.New("coinbase cannot create locked outputs")
+		}
+		if output.Burn {
+			return errors.New("coinbase cannot burn its reward")
+		}
+	}
+	if err := validateOutputs(coinbase.Outputs); err != nil {
+		return err
+	}
+	if err := coinbase.CheckDust(s.dustLimitAt(block.Header.Height)); err != nil {
+		return err
+	}
+
+	claimed, err := coinbase.OutputSum()
+	if err != nil {
+		return err
+	}
+
+	reward, err := s.blockReward(block.Header.Height, block.Transactions)
+	if err != nil {
+		return err
+	}
+	if claimed > reward {
+		return fmt.Errorf("coinbase claims %d, block reward is %d", claimed, reward)
+	}
+
+	return nil
+}
@@ -0,0 +1,20 @@
+package ledger
+
+import "blockchain/types"
+
+// DustLimit returns the smallest amount an output of the next block may
+// carry, 0 while the limit is off
+func (s *State) DustLimit() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.dustLimitAt(s.height + 1)
+}
+
+// dustLimitAt returns the dust limit of the block at height (must hold
+// lock)
+func (s *State) dustLimitAt(height uint64) uint64 {
+	if s.forks.VersionAt(height) < types.DustLimitVersion {
+		return 0
+	}
+	return s.dustLimit
+}
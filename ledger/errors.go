@@ -0,0 +1,26 @@
+package ledger
+
+import "errors"
+
+// Errors callers can tell apart with errors.Is. Validation failures
+// also carry a types.RejectCode.
+var (
+	// ErrUTXONotFound is returned for an output that was never created
+	// or has been pruned
+	ErrUTXONotFound = errors.New("UTXO not found")
+
+	// ErrValidatorNotFound is returned for a key that never staked
+	ErrValidatorNotFound = errors.New("validator not found")
+
+	// ErrKeyImageSpent is returned for a transaction spending a key
+	// image already spent on chain
+	ErrKeyImageSpent = errors.New("key image already spent")
+
+	// ErrDuplicateKeyImage is returned for a transaction spending the
+	// same key image twice
+	ErrDuplicateKeyImage = errors.New("key image spent twice in transaction")
+
+	// ErrUnbalanced is returned for a transaction whose inputs do not
+	// cover exactly its outputs and fee
+	ErrUnbalanced = errors.New("transaction amounts do not balance")
+)
@@ -0,0 +1,88 @@
+package ledger
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/ed25519"
+
+	"blockchain/types"
+)
+
+// ValidateEvidence checks that the next block may punish a double vote
+func (s *State) ValidateEvidence(ev *types.DoubleVote) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.checkEvidence(ev, s.height+1)
+}
+
+// validateEvidence checks the double votes a block punishes, at most
+// one per validator (must hold lock)
+func (s *State) validateEvidence(block *types.Block) error {
+	if len(block.Evidence) == 0 {
+		return nil
+	}
+	if s.forks.VersionAt(block.Header.Height) < types.EvidenceVersion {
+		return fmt.Errorf("evidence needs protocol version %d", types.EvidenceVersion)
+	}
+
+	seen := make(map[types.PublicKey]bool)
+	for i, ev := range block.Evidence {
+		if seen[ev.Validator] {
+			return fmt.Errorf("evidence %d: validator punished twice in block", i)
+		}
+		seen[ev.Validator] = true
+		if err := s.checkEvidence(ev, block.Header.Height); err != nil {
+			return fmt.Errorf("evidence %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// checkEvidence checks a double vote for the block at height: two
+// different blocks signed by a known validator at one earlier height
+// and round of this chain, no older than MaxEvidenceAge and later than
+// the last double vote it was punished for (must hold lock)
+func (s *State) checkEvidence(ev *types.DoubleVote, height uint64) error {
+	if ev.Height >= height {
+		return errors.New("evidence is not from an earlier height")
+	}
+	if height-ev.Height > types.MaxEvidenceAge {
+		return fmt.Errorf("evidence from height %d is older than %d blocks", ev.Height, types.MaxEvidenceAge)
+	}
+	if bytes.Compare(ev.BlockA[:], ev.BlockB[:]) >= 0 {
+		return errors.New("evidence must name two different blocks in byte order")
+	}
+
+	val, ok := s.validators[ev.Validator]
+	if !ok {
+		return ErrValidatorNotFound
+	}
+	if ev.Height <= val.EvidenceHeight {
+		return fmt.Errorf("validator already punished for a double vote at height %d", val.EvidenceHeight)
+	}
+
+	a, b := ev.Votes(s.chainID)
+	if !ed25519.Verify(ev.Validator[:], a.SignBytes(), ev.SignatureA[:]) ||
+		!ed25519.Verify(ev.Validator[:], b.SignBytes(), ev.SignatureB[:]) {
+		return errors.New("invalid vote signature in evidence")
+	}
+	return nil
+}
+
+// applyEvidence slashes the validators a block has evidence against and
+// jails them for DoubleVoteJailBlocks per slash on record (must hold
+// lock)
+func (s *State) applyEvidence(block *types.Block) {
+	for _, ev := range block.Evidence {
+		val := s.validators[ev.Validator]
+		s.slashStake(val, types.DoubleVoteSlashPercent)
+		val.SlashCount++
+		val.EvidenceHeight = ev.Height
+
+		// The validator may unjail once the period is over and its stake
+		// is back above minimum
+		val.Jail(block.Header.Height + types.DoubleVoteJailBlocks*uint64(val.SlashCount))
+	}
+}
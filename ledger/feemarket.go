@@ -0,0 +1,42 @@
+package ledger
+
+import "blockchain/types"
+
+// BaseFee returns the base fee the next block charges every transaction,
+// 0 while the fee market is off
+func (s *State) BaseFee() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.baseFeeAt(s.height + 1)
+}
+
+// FeeMarket returns the base fee parameters
+func (s *State) FeeMarket() types.FeeMarketConfig {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.feeMarket
+}
+
+// baseFeeAt returns the base fee of the block at height, which must be
+// the next one (must hold lock)
+func (s *State) baseFeeAt(height uint64) uint64 {
+	if !s.feeMarket.Enabled() || s.forks.VersionAt(height) < types.FeeMarketVersion {
+		return 0
+	}
+	return s.baseFee
+}
+
+// updateBaseFee moves the base fee by how full block was (must hold
+// lock, before the height advances)
+func (s *State) updateBaseFee(block *types.Block) {
+	if s.baseFeeAt(block.Header.Height) == 0 {
+		return
+	}
+	var count uint64
+	for _, tx := range block.Transactions {
+		if tx.PaysBaseFee() {
+			count++
+		}
+	}
+	s.baseFee = s.feeMarket.NextBaseFee(s.baseFee, count)
+}
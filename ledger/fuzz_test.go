@@ -0,0 +1,40 @@
+package ledger
+
+import (
+	"encoding/json"
+	"testing"
+
+	"blockchain/types"
+)
+
+// FuzzValidateTransaction checks that validating any decodable
+// transaction never panics, and that the mempool and block pipelines
+// agree on it. Signed transactions for testChainID are in the seed
+// corpus under testdata, since seeds must be the same in every fuzzing
+// process.
+func FuzzValidateTransaction(f *testing.F) {
+	f.Add([]byte(`{"Version":1,"Outputs":[{"Amount":50}]}`))
+	f.Add([]byte(`{"Version":1,"Inputs":[{"Amount":1000}],"Outputs":[{"Amount":1001}]}`))
+	f.Add([]byte(`{"Version":5,"Treasury":{"Nonce":0}}`))
+	f.Add([]byte(`{"Version":14,"Inputs":[{"Amount":1}],"Outputs":[{"Amount":1,"Burn":true,"Bond":"0100000000000000000000000000000000000000000000000000000000000000"}]}`))
+
+	state := newTestState(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var tx types.Transaction
+		if err := json.Unmarshal(data, &tx); err != nil {
+			return
+		}
+
+		mempoolErr := state.ValidateTransaction(&tx)
+		bodyErr := state.ValidateBlockBody(testBlock(&tx))
+		if tx.IsCoinbase() {
+			if mempoolErr == nil {
+				t.Fatal("mempool accepted a coinbase")
+			}
+			return
+		}
+		if (mempoolErr == nil) != (bodyErr == nil) {
+			t.Fatalf("mempool %v, ValidateBlockBody %v", mempoolErr, bodyErr)
+		}
+	})
+}
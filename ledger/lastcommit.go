@@ -0,0 +1,79 @@
+package ledger
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/ed25519"
+
+	"blockchain/crypto"
+	"blockchain/types"
+)
+
+// ValidateLastVote checks that the next block may carry a late vote for
+// the current tip, whose hash is tipHash
+func (s *State) ValidateLastVote(vote *types.ValidatorSignature, tipHash types.Hash) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if err := s.checkLastVoter(vote.Validator); err != nil {
+		return err
+	}
+	canonical := types.NewCommitVote(s.chainID, s.height, vote.Round, tipHash)
+	if !ed25519.Verify(vote.Validator[:], canonical.SignBytes(), vote.Signature[:]) {
+		return errors.New("invalid vote signature")
+	}
+	return nil
+}
+
+// validateLastCommit checks the late votes of a block: votes of active
+// validators for its parent, sorted by validator with no duplicates.
+// Votes already in the parent's certificate are allowed and count once
+// (must hold lock).
+func (s *State) validateLastCommit(block *types.Block) error {
+	if len(block.LastCommit) == 0 {
+		return nil
+	}
+	if s.forks.VersionAt(block.Header.Height) < types.LastCommitVersion {
+		return fmt.Errorf("late votes need protocol version %d", types.LastCommitVersion)
+	}
+	if block.Header.Height < 2 {
+		return errors.New("genesis has no votes")
+	}
+
+	height := block.Header.Height - 1
+	batch := crypto.NewBatchVerifier(len(block.LastCommit))
+	for i, vote := range block.LastCommit {
+		if i > 0 && bytes.Compare(block.LastCommit[i-1].Validator[:], vote.Validator[:]) >= 0 {
+			return errors.New("late votes must be sorted by validator without duplicates")
+		}
+		if err := s.checkLastVoter(vote.Validator); err != nil {
+			return fmt.Errorf("late vote %d: %w", i, err)
+		}
+		canonical := types.NewCommitVote(s.chainID, height, vote.Round, block.Header.PrevBlockHash)
+		batch.Add(vote.Validator, canonical.SignBytes(), vote.Signature)
+	}
+
+	if ok, valid := batch.Verify(); !ok {
+		for i := range block.LastCommit {
+			if !valid[i] {
+				return fmt.Errorf("late vote %d: invalid vote signature", i)
+			}
+		}
+	}
+	return nil
+}
+
+// checkLastVoter checks that a late vote is from a validator whose
+// liveness is tracked (must hold lock)
+func (s *State) checkLastVoter(pubKey types.PublicKey) error {
+	val, ok := s.validators[pubKey]
+	if !ok {
+		return ErrValidatorNotFound
+	}
+	if !val.Active {
+		return errors.New("validator is not active")
+	}
+	return nil
+}
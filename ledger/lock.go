@@ -0,0 +1,174 @@
+package ledger
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"blockchain/crypto"
+	"blockchain/types"
+)
+
+// validateLock checks the conditions of a new output. Every path must
+// be satisfiable and need at least one signature, so a revealed secret
+// or an expired timelock alone never lets anyone take the output.
+func validateLock(lock *types.Lock) error {
+	if len(lock.Paths) == 0 || len(lock.Paths) > types.MaxLockPaths {
+		return fmt.Errorf("lock needs 1 to %d spend paths", types.MaxLockPaths)
+	}
+
+	for i, path := range lock.Paths {
+		if len(path) == 0 || len(path) > types.MaxPathConditions {
+			return fmt.Errorf("spend path %d needs 1 to %d conditions", i, types.MaxPathConditions)
+		}
+		if len(path.Keys()) > types.MaxPathKeys {
+			return fmt.Errorf("spend path %d has more than %d keys", i, types.MaxPathKeys)
+		}
+
+		signed := false
+		for _, cond := range path {
+			switch cond.Type {
+			case types.ConditionKey:
+				if len(cond.Keys) != 1 {
+					return fmt.Errorf("spend path %d: key condition needs exactly one key", i)
+				}
+				signed = true
+			case types.ConditionMultisig:
+				if err := crypto.ValidateMultisigParams(cond.Threshold, cond.Keys); err != nil {
+					return fmt.Errorf("spend path %d: %w", i, err)
+				}
+				signed = true
+			case types.ConditionTimelock, types.ConditionHashLock:
+				if len(cond.Keys) > 0 {
+					return fmt.Errorf("spend path %d: %s condition takes no keys", i, cond.Type)
+				}
+			default:
+				return fmt.Errorf("spend path %d: unknown condition type %d", i, cond.Type)
+			}
+		}
+		if !signed {
+			return fmt.Errorf("spend path %d needs a key or multisig condition", i)
+		}
+	}
+
+	return nil
+}
+
+// verifyWitness checks that a witness meets every condition of the path
+// it names, for a spend signed over sigHash in a block at height
+func verifyWitness(lock *types.Lock, w *types.Witness, sigHash types.Hash, height uint64) error {
+	if int(w.Path) >= len(lock.Paths) {
+		return errors.New("witness spend path out of range")
+	}
+	path := lock.Paths[w.Path]
+
+	signed, err := crypto.VerifyWitnessSignatures(path.Keys(), sigHash, w.Signatures)
+	if err != nil {
+		return err
+	}
+
+	// Signatures index the keys of all conditions in order
+	offset := 0
+	hashLocked := false
+	for _, cond := range path {
+		count := 0
+		for i := range cond.Keys {
+			if signed[uint8(offset+i)] {
+				count++
+			}
+		}
+		offset += len(cond.Keys)
+
+		switch cond.Type {
+		case types.ConditionKey:
+			if count == 0 {
+				return errors.New("missing signature")
+			}
+		case types.ConditionMultisig:
+			if count < int(cond.Threshold) {
+				return fmt.Errorf("multisig needs %d signatures, have %d", cond.Threshold, count)
+			}
+		case types.ConditionTimelock:
+			if height < cond.Height {
+				return types.Reject(types.RejectImmature, fmt.Errorf("output cannot be spent this way before height %d", cond.Height))
+			}
+		case types.ConditionHashLock:
+			if len(w.Preimage) > types.MaxPreimageSize {
+				return types.Reject(types.RejectTooLarge, fmt.Errorf("preimage exceeds %d bytes", types.MaxPreimageSize))
+			}
+			if sha256.Sum256(w.Preimage) != cond.Hash {
+				return errors.New("preimage does not match hash lock")
+			}
+			hashLocked = true
+		default:
+			return fmt.Errorf("unknown condition type %d", cond.Type)
+		}
+	}
+
+	if !hashLocked && len(w.Preimage) > 0 {
+		return errors.New("preimage given for a spend path without a hash lock")
+	}
+
+	return nil
+}
+
+// validateLockedInput checks that an input spending an output by
+// reference (multisig, hash lock or Lock) names an existing output and
+// meets its conditions (must hold lock)
+func (s *State) validateLockedInput(tx *types.Transaction, input *types.TxInput) error {
+	w := input.SpendWitness()
+
+	utxo, exists := s.utxos.get(makeUTXOKey(w.TxHash, w.OutputIndex))
+	if !exists {
+		return errors.New("input references unknown or spent output")
+	}
+	if utxo.Spent {
+		return types.Reject(types.RejectDoubleSpend, errors.New("input references unknown or spent output"))
+	}
+	out := utxo.Output
+
+	// Each kind of spend must match its kind of output, and has its own
+	// key image
+	var keyImage types.PublicKey
+	switch {
+	case input.Multisig != nil:
+		if out.Multisig == nil {
+			return errors.New("multisig input references a non-multisig output")
+		}
+		keyImage = crypto.MultisigKeyImage(w.TxHash, w.OutputIndex)
+	case input.HashLock != nil:
+		if out.HashLock == nil {
+			return errors.New("hash lock input references an output without a hash lock")
+		}
+		keyImage = crypto.HashLockKeyImage(w.TxHash, w.OutputIndex)
+	default:
+		if out.Lock == nil {
+			return errors.New("witness references an output without a lock")
+		}
+		keyImage = crypto.LockKeyImage(w.TxHash, w.OutputIndex)
+	}
+
+	if input.KeyImage != keyImage {
+		return errors.New("invalid key image for locked input")
+	}
+
+	if input.Amount != out.Amount {
+		return errors.New("locked input amount does not match output")
+	}
+
+	// Spends are checked against the height of the block including them
+	sigHash := types.TxSigningHash(s.chainID, tx.PrefixHash())
+	return verifyWitness(out.SpendLock(), w, sigHash, s.height+1)
+}
+
+// lockKinds counts the ways an output is locked or an input spends by
+// reference; at most one is allowed
+func lockKinds(multisig, hashLock, lock bool) int {
+	n := 0
+	for _, set := range []bool{multisig, hashLock, lock} {
+		if set {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,54 @@
+package ledger
+
+import (
+	"fmt"
+
+	"blockchain/types"
+)
+
+// Maturity returns the depths outputs must be buried under to be spent
+// or used as decoys in the next block
+func (s *State) Maturity() types.MaturityConfig {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.maturityAt(s.height + 1)
+}
+
+// maturityAt returns the maturity rules of the block at height. Before
+// MaturityVersion every output only needs MinRingMemberAge blocks (must
+// hold lock).
+func (s *State) maturityAt(height uint64) types.MaturityConfig {
+	if s.forks.VersionAt(height) < types.MaturityVersion {
+		return types.MaturityConfig{CoinbaseConfirmations: types.MinRingMemberAge}
+	}
+	return s.maturity
+}
+
+// checkReferenceMaturity checks that the outputs tx spends by reference
+// are mature at height. Ring members are checked with their rings.
+// Multisig outputs are indexed like ring members, which records whether
+// a coinbase created them; hash locks and locks never come from one
+// (must hold lock).
+func (s *State) checkReferenceMaturity(tx *types.Transaction, height uint64) error {
+	if s.forks.VersionAt(height) < types.MaturityVersion {
+		return nil
+	}
+	for _, input := range tx.Inputs {
+		w := input.SpendWitness()
+		if w == nil {
+			continue
+		}
+		utxo, exists := s.utxos.get(makeUTXOKey(w.TxHash, w.OutputIndex))
+		if !exists {
+			continue // Rejected by validateLockedInput
+		}
+		coinbase := false
+		if index, ok := s.ringIndex[utxo.Output.StealthAddr.SpendKey]; ok {
+			coinbase = s.ringOutputs[index].Coinbase
+		}
+		if !s.maturity.Mature(utxo.BlockHeight, height, coinbase) {
+			return fmt.Errorf("output %x:%d is younger than %d blocks", w.TxHash[:8], w.OutputIndex, s.maturity.Required(coinbase))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package ledger
+
+import (
+	"fmt"
+
+	"blockchain/types"
+)
+
+// RingPolicy returns the ring size bounds of the next block, the zero
+// policy while they are not enforced. Wallets should not build rings
+// above MaxRingSize either way.
+func (s *State) RingPolicy() types.RingPolicy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ringPolicyAt(s.height + 1)
+}
+
+// ringPolicyAt returns the ring size bounds of the block at height (must
+// hold lock)
+func (s *State) ringPolicyAt(height uint64) types.RingPolicy {
+	if s.forks.VersionAt(height) < types.RingSizeVersion {
+		return types.RingPolicy{}
+	}
+	return s.ringPolicy
+}
+
+// checkRingSizes checks the sender's and the sponsor's ring signatures
+// against the bounds in force at height (must hold lock)
+func (s *State) checkRingSizes(tx *types.Transaction, height uint64) error {
+	if s.forks.VersionAt(height) < types.RingSizeVersion {
+		return nil
+	}
+	policy := s.ringPolicy
+	if tx.RingSignature != nil {
+		if err := policy.Check(len(tx.RingSignature.Ring)); err != nil {
+			return err
+		}
+	}
+	if tx.FeePayer != nil && tx.FeePayer.RingSignature != nil {
+		if err := policy.Check(len(tx.FeePayer.RingSignature.Ring)); err != nil {
+			return fmt.Errorf("invalid fee payer: %w", err)
+		}
+	}
+	return nil
+}
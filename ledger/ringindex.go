@@ -0,0 +1,94 @@
+package ledger
+
+import (
+	"fmt"
+
+	"blockchain/types"
+)
+
+// indexOutput gives the next global output index to an output created
+// at height (must hold lock)
+func (s *State) indexOutput(key types.PublicKey, height uint64, coinbase bool) {
+	if _, ok := s.ringIndex[key]; !ok {
+		s.ringIndex[key] = uint64(len(s.ringOutputs))
+	}
+	s.ringOutputs = append(s.ringOutputs, types.IndexedOutput{Key: key, Height: height, Coinbase: coinbase})
+}
+
+// RingMemberIndexes returns the global output index of each key, or nil
+// while ring members of the next block are not referenced by index. It
+// fails if any key is not a possible ring member.
+func (s *State) RingMemberIndexes(keys []types.PublicKey) ([]uint64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.forks.VersionAt(s.height+1) < types.TxVersionRingIndex {
+		return nil, nil
+	}
+	indexes := make([]uint64, len(keys))
+	for i, key := range keys {
+		index, ok := s.ringIndex[key]
+		if !ok {
+			return nil, fmt.Errorf("output key %x is not indexed", key[:8])
+		}
+		indexes[i] = index
+	}
+	return indexes, nil
+}
+
+// checkRingMembers checks that the rings of tx, ringInputs of which
+// spend by ring signature, name indexed outputs mature enough to be
+// ring members at height (must hold lock)
+func (s *State) checkRingMembers(tx *types.Transaction, ringInputs int, height uint64) error {
+	if s.forks.VersionAt(height) < types.TxVersionRingIndex {
+		return nil
+	}
+
+	if ringInputs > 0 {
+		if tx.Version < types.TxVersionRingIndex {
+			return types.Reject(types.RejectBadRing, fmt.Errorf("ring members must be referenced by output index (transaction version %d)", types.TxVersionRingIndex))
+		}
+		for _, input := range tx.Inputs {
+			if input.SpendWitness() != nil {
+				continue
+			}
+			if err := s.checkRing(input.RingOffsets, tx.RingSignature, height); err != nil {
+				return err
+			}
+		}
+	}
+
+	if tx.FeePayer != nil && tx.FeePayer.Input != nil {
+		if err := s.checkRing(tx.FeePayer.Input.RingOffsets, tx.FeePayer.RingSignature, height); err != nil {
+			return fmt.Errorf("invalid fee payer: %w", err)
+		}
+	}
+	return nil
+}
+
+// checkRing checks that offsets name the members of sig's ring, in
+// order (must hold lock)
+func (s *State) checkRing(offsets []uint64, sig *types.RingSignature, height uint64) error {
+	indexes, err := types.ResolveOffsets(offsets)
+	if err != nil {
+		return types.Reject(types.RejectBadRing, err)
+	}
+	if len(indexes) != len(sig.Ring) {
+		return types.Reject(types.RejectBadRing, fmt.Errorf("%d ring member offsets for a ring of %d", len(indexes), len(sig.Ring)))
+	}
+
+	maturity := s.maturityAt(height)
+	for i, index := range indexes {
+		if index >= uint64(len(s.ringOutputs)) {
+			return types.Reject(types.RejectBadRing, fmt.Errorf("ring member %d: no output %d", i, index))
+		}
+		member := s.ringOutputs[index]
+		if member.Key != sig.Ring[i] {
+			return types.Reject(types.RejectBadRing, fmt.Errorf("ring member %d is not output %d", i, index))
+		}
+		if !maturity.Mature(member.Height, height, member.Coinbase) {
+			return types.Reject(types.RejectImmature, fmt.Errorf("ring member %d is younger than %d blocks", i, maturity.Required(member.Coinbase)))
+		}
+	}
+	return nil
+}
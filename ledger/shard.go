@@ -0,0 +1,108 @@
+package ledger
+
+import (
+	"hash/maphash"
+	"maps"
+	"sync"
+)
+
+// mapShards is the number of shards of the UTXO set and of the spent
+// key images
+const mapShards = 64
+
+// shardedMap is a map split into shards by key hash, each behind a lock
+// of its own, so lookups neither wait for the state lock nor contend on
+// one shared lock word. Writers still hold the state lock, which keeps
+// them ordered; the shard locks only order them against lookups.
+type shardedMap[K comparable, V any] struct {
+	seed   maphash.Seed
+	shards [mapShards]mapShard[K, V]
+}
+
+type mapShard[K comparable, V any] struct {
+	mu     sync.RWMutex
+	m      map[K]V
+	shared bool // A view shares m, so the next write copies it (see view.go)
+}
+
+func newShardedMap[K comparable, V any]() *shardedMap[K, V] {
+	sm := &shardedMap[K, V]{seed: maphash.MakeSeed()}
+	for i := range sm.shards {
+		sm.shards[i].m = make(map[K]V)
+	}
+	return sm
+}
+
+func (sm *shardedMap[K, V]) shard(key K) *mapShard[K, V] {
+	return &sm.shards[maphash.Comparable(sm.seed, key)%mapShards]
+}
+
+func (sm *shardedMap[K, V]) get(key K) (V, bool) {
+	shard := sm.shard(key)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+	value, ok := shard.m[key]
+	return value, ok
+}
+
+// set stores a value, first copying the key's shard if a view shares it.
+// Values are never changed in place, so views keep the ones they saw.
+func (sm *shardedMap[K, V]) set(key K, value V) {
+	shard := sm.shard(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if shard.shared {
+		shard.m = maps.Clone(shard.m)
+		shard.shared = false
+	}
+	shard.m[key] = value
+}
+
+func (sm *shardedMap[K, V]) len() int {
+	n := 0
+	for i := range sm.shards {
+		shard := &sm.shards[i]
+		shard.mu.RLock()
+		n += len(shard.m)
+		shard.mu.RUnlock()
+	}
+	return n
+}
+
+// each calls fn for every entry, one shard at a time
+func (sm *shardedMap[K, V]) each(fn func(K, V)) {
+	for i := range sm.shards {
+		shard := &sm.shards[i]
+		shard.mu.RLock()
+		for key, value := range shard.m {
+			fn(key, value)
+		}
+		shard.mu.RUnlock()
+	}
+}
+
+// reset empties the map, leaving shared shards to their views
+func (sm *shardedMap[K, V]) reset() {
+	for i := range sm.shards {
+		shard := &sm.shards[i]
+		shard.mu.Lock()
+		shard.m = make(map[K]V)
+		shard.shared = false
+		shard.mu.Unlock()
+	}
+}
+
+// view returns a copy of the map sharing every shard with it until
+// either is written to
+func (sm *shardedMap[K, V]) view() *shardedMap[K, V] {
+	view := &shardedMap[K, V]{seed: sm.seed}
+	for i := range sm.shards {
+		shard := &sm.shards[i]
+		shard.mu.Lock()
+		shard.shared = true
+		view.shards[i].m = shard.m
+		view.shards[i].shared = true
+		shard.mu.Unlock()
+	}
+	return view
+}
@@ -0,0 +1,112 @@
+package ledger
+
+import (
+	"sync"
+
+	"blockchain/crypto"
+	"blockchain/types"
+)
+
+// SigCacheSize is how many verified ring signatures the state remembers.
+// A full mempool is far smaller, so transactions checked on admission
+// are still cached when their block arrives.
+const SigCacheSize = 32768
+
+// sigCache remembers ring signatures that verified, keyed by RingSigHash,
+// so a transaction checked on mempool admission is not verified again
+// when its block is validated. Only valid signatures are cached, and the
+// oldest entry is dropped once it is full. It is cleared when the
+// protocol version changes and when the state is replaced, as both may
+// change what a valid signature is.
+type sigCache struct {
+	mu      sync.Mutex
+	version uint32
+	entries map[types.Hash]struct{}
+	order   []types.Hash // ring buffer of entries, oldest at next
+	next    int
+	hits    uint64
+	misses  uint64
+}
+
+func newSigCache() *sigCache {
+	return &sigCache{
+		entries: make(map[types.Hash]struct{}),
+		order:   make([]types.Hash, 0, SigCacheSize),
+	}
+}
+
+// verify checks sig over payload under protocol version, consulting the
+// cache first
+func (c *sigCache) verify(version uint32, payload types.Hash, sig *types.RingSignature) bool {
+	key := types.RingSigHash(payload, sig)
+
+	c.mu.Lock()
+	if version != c.version {
+		c.clear()
+		c.version = version
+	}
+	_, ok := c.entries[key]
+	if ok {
+		c.hits++
+	} else {
+		c.misses++
+	}
+	c.mu.Unlock()
+	if ok {
+		return true
+	}
+
+	if !crypto.VerifyRingSignature(sig, payload[:]) {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if version == c.version {
+		c.add(key)
+	}
+	return true
+}
+
+// add caches a key, evicting the oldest entry when full (must hold lock)
+func (c *sigCache) add(key types.Hash) {
+	if _, ok := c.entries[key]; ok {
+		return
+	}
+	if len(c.order) < SigCacheSize {
+		c.order = append(c.order, key)
+	} else {
+		delete(c.entries, c.order[c.next])
+		c.order[c.next] = key
+		c.next = (c.next + 1) % SigCacheSize
+	}
+	c.entries[key] = struct{}{}
+}
+
+// clear empties the cache (must hold lock)
+func (c *sigCache) clear() {
+	c.entries = make(map[types.Hash]struct{})
+	c.order = c.order[:0]
+	c.next = 0
+}
+
+// reset empties the cache
+func (c *sigCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.clear()
+}
+
+// SigCacheStats reports how many ring signature checks the cache
+// answered and how many needed verifying
+func (s *State) SigCacheStats() (hits, misses uint64) {
+	s.sigCache.mu.Lock()
+	defer s.sigCache.mu.Unlock()
+	return s.sigCache.hits, s.sigCache.misses
+}
+
+// verifyRingSignature checks a ring signature over payload in the next
+// block (must hold lock)
+func (s *State) verifyRingSignature(sig *types.RingSignature, payload types.Hash) bool {
+	return s.sigCache.verify(s.forks.VersionAt(s.height+1), payload, sig)
+}
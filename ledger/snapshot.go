@@ -0,0 +1,187 @@
+package ledger
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	"blockchain/types"
+)
+
+// Export dumps the current state. Spent outputs are left out since the
+// key images already record them.
+func (s *State) Export() *types.StateSnapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.export()
+}
+
+// export dumps the current state (must hold lock)
+func (s *State) export() *types.StateSnapshot {
+	snap := &types.StateSnapshot{
+		Height:      s.height,
+		TotalSupply: s.totalSupply,
+		Supply:      s.supply,
+		Treasury:    s.treasury,
+		BaseFee:     s.baseFee,
+		UTXOs:       make([]*types.UTXO, 0, s.utxos.len()),
+		KeyImages:   make([]types.PublicKey, 0, s.spentKeyImages.len()),
+		Validators:  make([]types.ValidatorState, 0, len(s.validators)),
+	}
+
+	s.utxos.each(func(_ string, utxo *types.UTXO) {
+		if !utxo.Spent {
+			copied := *utxo // Callers may change the snapshot
+			snap.UTXOs = append(snap.UTXOs, &copied)
+		}
+	})
+	sort.Slice(snap.UTXOs, func(i, j int) bool {
+		a, b := snap.UTXOs[i], snap.UTXOs[j]
+		if c := bytes.Compare(a.TxHash[:], b.TxHash[:]); c != 0 {
+			return c < 0
+		}
+		return a.OutputIndex < b.OutputIndex
+	})
+
+	s.spentKeyImages.each(func(keyImage types.PublicKey, _ bool) {
+		snap.KeyImages = append(snap.KeyImages, keyImage)
+	})
+	sort.Slice(snap.KeyImages, func(i, j int) bool {
+		return bytes.Compare(snap.KeyImages[i][:], snap.KeyImages[j][:]) < 0
+	})
+
+	for _, val := range s.validators {
+		snap.Validators = append(snap.Validators, *cloneValidator(val))
+	}
+	sort.Slice(snap.Validators, func(i, j int) bool {
+		return bytes.Compare(snap.Validators[i].PublicKey[:], snap.Validators[j].PublicKey[:]) < 0
+	})
+
+	// The index joins the state root only when it is used, so roots of
+	// earlier heights are unchanged
+	if s.forks.VersionAt(s.height+1) >= types.TxVersionRingIndex {
+		snap.RingOutputs = append([]types.IndexedOutput(nil), s.ringOutputs...)
+	}
+
+	return snap
+}
+
+// ValidateSnapshot checks a snapshot before it is used to seed a chain
+func ValidateSnapshot(snap *types.StateSnapshot) error {
+	utxos := make(map[string]bool, len(snap.UTXOs))
+	for _, utxo := range snap.UTXOs {
+		if utxo == nil || utxo.Output == nil {
+			return errors.New("snapshot contains an empty output")
+		}
+		key := makeUTXOKey(utxo.TxHash, utxo.OutputIndex)
+		if utxos[key] {
+			return fmt.Errorf("duplicate output %s:%d", utxo.TxHash, utxo.OutputIndex)
+		}
+		utxos[key] = true
+	}
+
+	keyImages := make(map[types.PublicKey]bool, len(snap.KeyImages))
+	for _, keyImage := range snap.KeyImages {
+		if keyImages[keyImage] {
+			return errors.New("duplicate key image")
+		}
+		keyImages[keyImage] = true
+	}
+
+	validators := make(map[types.PublicKey]bool, len(snap.Validators))
+	for _, val := range snap.Validators {
+		if validators[val.PublicKey] {
+			return errors.New("duplicate validator")
+		}
+		validators[val.PublicKey] = true
+	}
+
+	return nil
+}
+
+// restoreSnapshot loads a snapshot as the genesis state of a new chain.
+// Outputs are re-based to height 0 (must hold lock).
+func (s *State) restoreSnapshot(snap *types.StateSnapshot) error {
+	if err := ValidateSnapshot(snap); err != nil {
+		return err
+	}
+
+	for _, utxo := range snap.UTXOs {
+		s.utxos.set(makeUTXOKey(utxo.TxHash, utxo.OutputIndex), &types.UTXO{
+			TxHash:      utxo.TxHash,
+			OutputIndex: utxo.OutputIndex,
+			Output:      utxo.Output,
+			BlockHeight: 0,
+		})
+	}
+
+	// Spent outputs of the old chain cannot be ring members here, as
+	// they are not in the snapshot
+	for _, utxo := range snap.UTXOs {
+		if utxo.Output.IsRingMember() {
+			s.indexOutput(utxo.Output.StealthAddr.SpendKey, 0, false)
+		}
+	}
+
+	for _, keyImage := range snap.KeyImages {
+		s.spentKeyImages.set(keyImage, true)
+	}
+
+	for i := range snap.Validators {
+		val := snap.Validators[i]
+		s.validators[val.PublicKey] = &val
+	}
+
+	return nil
+}
+
+// Restore replaces the ledger state with a snapshot taken at a later
+// height, such as one downloaded by state sync. Chain parameters from
+// genesis are kept. Snapshots taken before ring members are referenced
+// by index carry no global output index, so a node restored from one
+// cannot validate rings once they are.
+func (s *State) Restore(snap *types.StateSnapshot) error {
+	if err := ValidateSnapshot(snap); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.copyOnWrite(); err != nil {
+		return err
+	}
+
+	s.sigCache.reset()
+	s.utxos.reset()
+	for _, utxo := range snap.UTXOs {
+		restored := *utxo
+		restored.Spent = false // Not covered by the state root
+		s.utxos.set(makeUTXOKey(utxo.TxHash, utxo.OutputIndex), &restored)
+	}
+
+	s.spentKeyImages.reset()
+	for _, keyImage := range snap.KeyImages {
+		s.spentKeyImages.set(keyImage, true)
+	}
+
+	s.validators = make(map[types.PublicKey]*types.ValidatorState, len(snap.Validators))
+	for i := range snap.Validators {
+		val := snap.Validators[i]
+		s.validators[val.PublicKey] = &val
+	}
+
+	s.ringOutputs = nil
+	s.ringIndex = make(map[types.PublicKey]uint64, len(snap.RingOutputs))
+	for _, out := range snap.RingOutputs {
+		s.indexOutput(out.Key, out.Height, out.Coinbase)
+	}
+
+	s.height = snap.Height
+	s.totalSupply = snap.TotalSupply
+	s.supply = snap.Supply
+	s.treasury = snap.Treasury
+	s.baseFee = snap.BaseFee
+
+	return nil
+}
@@ -0,0 +1,267 @@
+package ledger
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/ed25519"
+
+	"blockchain/types"
+)
+
+// ValidateStakingTx checks that a staking transaction may be applied by
+// the next block. Whether a bond's funding transaction is in the block
+// is checked with the block.
+func (s *State) ValidateStakingTx(stx *types.StakingTx) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.checkStakingTx(stx, s.height+1)
+}
+
+// checkStakingTx checks that a staking transaction is signed by its
+// validator for this chain, carries the validator's next nonce, so a
+// captured transaction cannot be replayed, and that its change is
+// allowed at height. A new validator starts at nonce 0 (must hold lock).
+func (s *State) checkStakingTx(stx *types.StakingTx, height uint64) error {
+	val, exists := s.validators[stx.Validator]
+
+	var expected uint64
+	if exists {
+		expected = val.StakingNonce
+	}
+	if stx.Nonce != expected {
+		return fmt.Errorf("staking nonce %d, expected %d", stx.Nonce, expected)
+	}
+
+	sigHash := stx.SigningHash(s.chainID)
+	if !ed25519.Verify(stx.Validator[:], sigHash[:], stx.Signature[:]) {
+		return errors.New("invalid staking signature (signed for another chain?)")
+	}
+
+	if stx.Type != types.StakingBond && !exists {
+		return ErrValidatorNotFound
+	}
+
+	// Unbonding stake waits to be released (see validateStakeRelease)
+	// and may not change meanwhile
+	if exists && val.UnbondingUntil != 0 {
+		return fmt.Errorf("validator is unbonding until height %d", val.UnbondingUntil)
+	}
+
+	switch stx.Type {
+	case types.StakingBond:
+		// Stake is paid for by burning coins, all bonded by the operator
+		// until delegation exists
+		if stx.Funding == (types.Hash{}) {
+			return errors.New("bond has no funding transaction")
+		}
+		if stx.SelfBond != stx.Amount {
+			return fmt.Errorf("self-bond %d must equal amount %d", stx.SelfBond, stx.Amount)
+		}
+		if !exists {
+			// Enforce minimum stake, self-bond and commission limits
+			return s.validatorSet.CheckBond(stx.Amount, stx.SelfBond, stx.Commission)
+		}
+		if stx.Amount == 0 {
+			return errors.New("bond has no amount")
+		}
+		if _, err := types.AddAmounts(val.StakedAmount, stx.Amount); err != nil {
+			return err
+		}
+		return nil
+
+	case types.StakingUnbond:
+		return nil
+
+	case types.StakingSetCommission:
+		return s.validatorSet.CheckCommissionChange(val, stx.Commission, height)
+
+	case types.StakingUnjail:
+		if !val.Jailed {
+			return errors.New("validator is not jailed")
+		}
+		if height < val.JailedUntil {
+			return fmt.Errorf("validator is jailed until height %d", val.JailedUntil)
+		}
+		if val.StakedAmount < s.validatorSet.MinValidatorStake {
+			return fmt.Errorf("stake %d below minimum %d; bond more before unjailing", val.StakedAmount, s.validatorSet.MinValidatorStake)
+		}
+		return nil
+
+	default:
+		return errors.New("unknown staking type")
+	}
+}
+
+// validateStaking checks the staking transactions of a block, at most
+// one per validator, and that each bond is paid for by exactly one of
+// its transactions burning the bonded amount for the validator. Every
+// transaction with bond burns must fund a bond of the block, so coins
+// are never burned for stake that is not created (must hold lock).
+func (s *State) validateStaking(block *types.Block) error {
+	funding := make(map[types.Hash]*types.Transaction)
+	for _, tx := range block.Transactions {
+		if tx.HasBonds() {
+			funding[tx.Hash()] = tx
+		}
+	}
+	if len(block.Staking) == 0 && len(funding) == 0 {
+		return nil
+	}
+	if s.forks.VersionAt(block.Header.Height) < types.StakingVersion {
+		return fmt.Errorf("staking transactions need protocol version %d", types.StakingVersion)
+	}
+
+	seen := make(map[types.PublicKey]bool)
+	for i, stx := range block.Staking {
+		if seen[stx.Validator] {
+			return fmt.Errorf("staking transaction %d: validator changed twice in block", i)
+		}
+		seen[stx.Validator] = true
+		if err := s.checkStakingTx(stx, block.Header.Height); err != nil {
+			return fmt.Errorf("staking transaction %d: %w", i, err)
+		}
+		if stx.Type != types.StakingBond {
+			continue
+		}
+
+		tx, ok := funding[stx.Funding]
+		if !ok {
+			return fmt.Errorf("staking transaction %d: funding transaction %s not in block", i, stx.Funding)
+		}
+		delete(funding, stx.Funding)
+		validator, amount, err := tx.Bonded()
+		if err != nil {
+			return fmt.Errorf("staking transaction %d: %w", i, err)
+		}
+		if validator != stx.Validator || amount != stx.Amount {
+			return fmt.Errorf("staking transaction %d: funding burns %d for %s, bond is %d", i, amount, validator, stx.Amount)
+		}
+	}
+
+	if len(funding) > 0 {
+		return errors.New("block burns coins for stake without a matching bond")
+	}
+	return nil
+}
+
+// applyStaking makes the changes of a block's staking transactions and
+// consumes their nonces (must hold lock)
+func (s *State) applyStaking(block *types.Block) {
+	height := block.Header.Height
+	for _, stx := range block.Staking {
+		val, exists := s.validators[stx.Validator]
+
+		switch stx.Type {
+		case types.StakingBond:
+			// Bonding to an existing validator tops up its stake
+			if exists {
+				val.StakedAmount += stx.Amount // Checked for overflow
+				val.SelfBond += stx.SelfBond
+				break
+			}
+
+			// With a capped set, new validators wait for the next rotation
+			capped := s.validatorSet.MaxValidators > 0
+			val = &types.ValidatorState{
+				PublicKey:    stx.Validator,
+				StakedAmount: stx.Amount,
+				Active:       !capped,
+				Queued:       capped,
+				JoinedHeight: height,
+				SelfBond:     stx.SelfBond,
+				Commission:   stx.Commission,
+
+				CommissionEpoch: height / s.validatorSet.Epoch(),
+			}
+			s.validators[stx.Validator] = val
+
+		case types.StakingUnbond:
+			val.Active = false
+			val.Queued = false
+			val.UnbondingUntil = height + types.UnbondingPeriod
+
+		case types.StakingSetCommission:
+			val.Commission = stx.Commission
+			val.CommissionEpoch = height / s.validatorSet.Epoch()
+
+		case types.StakingUnjail:
+			// Like a new validator, it waits for the next rotation when
+			// the set is capped
+			capped := s.validatorSet.MaxValidators > 0
+			val.Jailed = false
+			val.JailedUntil = 0
+			val.Active = !capped
+			val.Queued = capped
+		}
+
+		val.StakingNonce++
+	}
+}
+
+// validateStakeRelease checks a transaction paying back a validator's
+// stake: plain outputs adding up to the stake, signed by the validator
+// once its unbonding period is over (must hold lock)
+func (s *State) validateStakeRelease(tx *types.Transaction) error {
+	r := tx.Release
+
+	if tx.Version < types.TxVersionBond {
+		return fmt.Errorf("stake releases need transaction version %d", types.TxVersionBond)
+	}
+	if len(tx.Inputs) > 0 || tx.FeePayer != nil || tx.RingSignature != nil || tx.Treasury != nil {
+		return errors.New("stake release cannot have inputs or signatures of its own")
+	}
+	if tx.Fee != 0 {
+		return errors.New("stake release pays no fee")
+	}
+	if len(tx.Outputs) == 0 {
+		return errors.New("stake release has no outputs")
+	}
+	for _, output := range tx.Outputs {
+		if output.SpendLock() != nil || output.Burn {
+			return errors.New("stake release outputs must be plain")
+		}
+		if len(output.Memo) > types.MaxMemoSize {
+			return types.Reject(types.RejectTooLarge, fmt.Errorf("memo exceeds %d bytes", types.MaxMemoSize))
+		}
+	}
+	if err := tx.CheckDust(s.dustLimitAt(s.height + 1)); err != nil {
+		return err
+	}
+
+	val, ok := s.validators[r.Validator]
+	if !ok {
+		return ErrValidatorNotFound
+	}
+	if val.UnbondingUntil == 0 || r.Until != val.UnbondingUntil {
+		return fmt.Errorf("validator is not unbonding until height %d", r.Until)
+	}
+	if s.height+1 < val.UnbondingUntil {
+		return fmt.Errorf("stake is unbonding until height %d", val.UnbondingUntil)
+	}
+	amount, err := tx.OutputSum()
+	if err != nil {
+		return err
+	}
+	if amount != val.StakedAmount {
+		return fmt.Errorf("release pays %d, stake is %d", amount, val.StakedAmount)
+	}
+
+	sigHash := types.ReleaseSigningHash(s.chainID, tx.PrefixHash())
+	if !ed25519.Verify(r.Validator[:], sigHash[:], r.Signature[:]) {
+		return errors.New("invalid stake release signature")
+	}
+	return nil
+}
+
+// StakingNonce returns the nonce a validator's next staking transaction
+// must carry
+func (s *State) StakingNonce(pubKey types.PublicKey) uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if val, ok := s.validators[pubKey]; ok {
+		return val.StakingNonce
+	}
+	return 0
+}
@@ -0,0 +1,114 @@
+package ledger
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+
+	"blockchain/types"
+)
+
+// newTestRelease returns a stake release paying amount to a fresh
+// address, signed with priv
+func newTestRelease(t *testing.T, priv ed25519.PrivateKey, validator types.PublicKey, amount, until uint64) *types.Transaction {
+	t.Helper()
+	tx := newTestCoinbase(t, amount)
+	tx.Version = types.TxVersionBond
+	tx.Release = &types.StakeRelease{Validator: validator, Until: until}
+	sigHash := types.ReleaseSigningHash(testChainID, tx.PrefixHash())
+	copy(tx.Release.Signature[:], ed25519.Sign(priv, sigHash[:]))
+	return tx
+}
+
+// signStaking signs a staking transaction with priv for the test chain
+func signStaking(priv ed25519.PrivateKey, stx *types.StakingTx) *types.StakingTx {
+	sigHash := stx.SigningHash(testChainID)
+	copy(stx.Signature[:], ed25519.Sign(priv, sigHash[:]))
+	return stx
+}
+
+// TestStakeRelease checks that an unbonding validator's stake is frozen
+// until the unbonding period ends, and is then paid back out once, by a
+// transaction the validator signs, to outputs adding up to the stake
+func TestStakeRelease(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var validator types.PublicKey
+	copy(validator[:], pub)
+
+	const stake = 5000
+	state := NewState()
+	genesis := &types.GenesisConfig{
+		ChainID:           testChainID,
+		InitialSupply:     1_000_000,
+		InitialValidators: []types.ValidatorState{{PublicKey: validator, StakedAmount: stake, SelfBond: stake, Active: true}},
+		Forks:             types.ForkSchedule{{Name: "staking", Version: types.StakingVersion, Height: 1}},
+	}
+	if err := state.InitializeGenesis(genesis); err != nil {
+		t.Fatal(err)
+	}
+
+	unbond := signStaking(priv, &types.StakingTx{Type: types.StakingUnbond, Validator: validator})
+	if err := state.ApplyBlock(&types.Block{Header: types.BlockHeader{Height: 1}, Staking: []*types.StakingTx{unbond}}); err != nil {
+		t.Fatal(err)
+	}
+	val, err := state.GetValidator(validator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	until := val.UnbondingUntil
+	if until != 1+types.UnbondingPeriod || val.Active {
+		t.Fatalf("unbonding until %d, active %t; want %d and inactive", until, val.Active, 1+types.UnbondingPeriod)
+	}
+
+	bond := signStaking(priv, &types.StakingTx{Type: types.StakingBond, Validator: validator, Amount: 100, SelfBond: 100, Nonce: 1, Funding: types.Hash{1}})
+	if err := state.ValidateStakingTx(bond); err == nil || !strings.Contains(err.Error(), "unbonding") {
+		t.Fatalf("bond to an unbonding validator: %v", err)
+	}
+
+	if err := state.ValidateTransaction(newTestRelease(t, priv, validator, stake, until)); err == nil {
+		t.Fatal("stake released before the unbonding period ended")
+	}
+	for height := uint64(2); height < until; height++ {
+		if err := state.ApplyBlock(&types.Block{Header: types.BlockHeader{Height: height}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := state.ValidateTransaction(newTestRelease(t, priv, validator, stake+1, until)); err == nil {
+		t.Fatal("release paying more than the stake validated")
+	}
+	other, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stranger types.PublicKey
+	copy(stranger[:], other)
+	if err := state.ValidateTransaction(newTestRelease(t, priv, stranger, stake, until)); err == nil {
+		t.Fatal("release of another validator's stake validated")
+	}
+
+	release := newTestRelease(t, priv, validator, stake, until)
+	supply := state.GetTotalSupply()
+	if err := state.ApplyBlock(&types.Block{Header: types.BlockHeader{Height: until}, Transactions: []*types.Transaction{release}}); err != nil {
+		t.Fatalf("release after the unbonding period: %v", err)
+	}
+	if _, err := state.GetUTXO(release.Hash(), 0); err != nil {
+		t.Fatalf("released output: %v", err)
+	}
+	if got := state.GetTotalSupply(); got != supply+stake {
+		t.Fatalf("supply %d, want %d", got, supply+stake)
+	}
+	if stats := state.SupplyStats(); stats.Released != stake {
+		t.Fatalf("released %d, want %d", stats.Released, stake)
+	}
+	if _, err := state.GetValidator(validator); err != ErrValidatorNotFound {
+		t.Fatalf("released validator still known: %v", err)
+	}
+	if err := state.ValidateTransaction(release); err == nil {
+		t.Fatal("stake released twice")
+	}
+}
@@ -1,10 +1,11 @@
 package ledger
 
 import (
-	"crypto/sha256"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"sync"
+	"sync/atomic"
 	
 	"blockchain/types"
 )
@@ -13,11 +14,12 @@ import (
 type State struct {
 	mu sync.RWMutex
 	
-	// UTXO set: key = hash(txhash + output_index)
-	utxos map[string]*types.UTXO
+	// UTXO set: key = hash(txhash + output_index). Both maps are
+	// sharded so lookups skip mu (see shard.go).
+	utxos *shardedMap[string, *types.UTXO]
 	
 	// Spent key images to prevent double-spend
-	spentKeyImages map[types.PublicKey]bool
+	spentKeyImages *shardedMap[types.PublicKey, bool]
 	
 	// Validator states
 	validators map[types.PublicKey]*types.ValidatorState
@@ -25,67 +27,204 @@ type State struct {
 	// Current blockchain height
 	height uint64
 	
-	// Total supply
+	// Total supply, and how it came about (see types/supply.go)
 	totalSupply uint64
+	supply      types.SupplyStats
+	
+	// Community fund credited from every subsidy (see treasury.go)
+	treasury types.Treasury
+	
+	// Scheduled protocol upgrades
+	forks types.ForkSchedule
+	
+	// Chain ID bound into every signature
+	chainID string
+	
+	// Block subsidy schedule
+	emission types.EmissionConfig
+	
+	// Burned base fee and its parameters (see feemarket.go)
+	feeMarket types.FeeMarketConfig
+	baseFee   uint64
+	
+	// Smallest output amount (see dust.go)
+	dustLimit uint64
+	
+	// Ring size bounds (see ring.go)
+	ringPolicy types.RingPolicy
+	
+	// Global output index of every output that may be a ring member,
+	// spent or not, and each key's first index (see ringindex.go)
+	ringOutputs []types.IndexedOutput
+	ringIndex   map[types.PublicKey]uint64
+	
+	// Confirmations outputs need before they are spent (see maturity.go)
+	maturity types.MaturityConfig
+	
+	// Active validator set cap and rotation interval
+	validatorSet types.ValidatorSetConfig
+	
+	// Downtime jailing parameters
+	liveness types.LivenessConfig
+	
+	// Ring signatures already verified (see sigcache.go)
+	sigCache *sigCache
+	
+	// Set while a view shares the maps above, and on views themselves
+	// (see view.go)
+	shared   atomic.Bool
+	readOnly bool
 }
 
 // NewState creates a new state instance
 func NewState() *State {
 	return &State{
-		utxos:          make(map[string]*types.UTXO),
-		spentKeyImages: make(map[types.PublicKey]bool),
+		utxos:          newShardedMap[string, *types.UTXO](),
+		spentKeyImages: newShardedMap[types.PublicKey, bool](),
+		sigCache:       newSigCache(),
 		validators:     make(map[types.PublicKey]*types.ValidatorState),
+		ringIndex:      make(map[types.PublicKey]uint64),
 		height:         0,
 		totalSupply:    0,
 	}
 }
 
-// ApplyBlock applies a block to the state
+// ApplyBlock applies a block to the state. It validates the block's
+// transactions first, so a block is applied whole or not at all.
 func (s *State) ApplyBlock(block *types.Block) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if err := s.copyOnWrite(); err != nil {
+		return err
+	}
 	
 	// Validate block height
 	if block.Header.Height != s.height+1 {
 		return errors.New("invalid block height")
 	}
 	
+	// Transactions pass the same checks as in the mempool (see block.go)
+	if err := s.validateBlockBody(block); err != nil {
+		return err
+	}
+	
+	// The coinbase creates coins; fees leave circulation unless the
+	// coinbase claims them back, burns leave it for good. Stake releases
+	// bring back coins burned for stake.
+	supply := s.totalSupply
+	var claimed, fees, burned, released uint64
+	for _, tx := range block.Transactions {
+		var err error
+		if tx.IsCoinbase() {
+			if claimed, err = tx.OutputSum(); err == nil {
+				supply, err = types.AddAmounts(supply, claimed)
+			}
+		} else {
+			if supply, err = types.SubAmounts(supply, tx.Fee); err == nil {
+				fees, err = types.AddAmounts(fees, tx.Fee)
+			}
+			if err == nil {
+				var burn uint64
+				if burn, err = tx.BurnedAmount(); err == nil {
+					supply, err = types.SubAmounts(supply, burn)
+					burned += burn // At most the supply, so it cannot overflow
+				}
+			}
+			if err == nil && tx.IsStakeRelease() {
+				var stake uint64
+				if stake, err = tx.OutputSum(); err == nil {
+					supply, err = types.AddAmounts(supply, stake)
+					released += stake // At most the supply, so it cannot overflow
+				}
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("invalid supply change: %w", err)
+		}
+	}
+	
+	// The treasury's share of the subsidy is created with the block,
+	// whether or not the proposer claims the rest
+	share := s.emission.TreasuryShare(s.blockSubsidy(block.Header.Height))
+	supply, err := types.AddAmounts(supply, share)
+	if err != nil {
+		return fmt.Errorf("invalid supply change: %w", err)
+	}
+	if supply > s.emission.SupplyCap() {
+		return fmt.Errorf("block raises supply to %d, above cap %d", supply, s.emission.SupplyCap())
+	}
+	stats := s.supply
+	if err := stats.ApplyBlockReward(claimed+share, fees); err != nil {
+		return err
+	}
+	if err := stats.Burn(burned); err != nil {
+		return err
+	}
+	if err := stats.Release(released); err != nil {
+		return err
+	}
+	
 	// Process each transaction
 	for _, tx := range block.Transactions {
 		if err := s.applyTransaction(tx, block.Header.Height); err != nil {
 			return err
 		}
 	}
+	s.totalSupply = supply
+	s.supply = stats
+	s.treasury.Balance += share // At most the supply, so it cannot overflow
+	s.updateBaseFee(block)
+	s.applyStaking(block)
+	s.applyEvidence(block)
 	
 	// Update height
 	s.height = block.Header.Height
 	
+	s.trackLiveness(block)
+	if s.validatorSet.IsEpochEnd(s.height) {
+		s.rotateValidators()
+	}
+	
 	return nil
 }
 
-// applyTransaction applies a transaction to state (must hold lock)
+// applyTransaction applies a transaction checked by
+// validateBlockTransactions to state (must hold lock)
 func (s *State) applyTransaction(tx *types.Transaction, blockHeight uint64) error {
-	// Verify no double-spend via key images
-	for _, input := range tx.Inputs {
-		if s.spentKeyImages[input.KeyImage] {
-			return errors.New("double-spend detected: key image already spent")
+	if tx.Treasury != nil {
+		if err := s.spendTreasury(tx); err != nil {
+			return err
 		}
 	}
 	
-	// Verify ring signatures
-	if tx.RingSignature != nil {
-		// TODO: Verify ring signature
-		// For now, we assume valid
+	// A released validator's stake is paid out, so it is gone
+	if tx.Release != nil {
+		delete(s.validators, tx.Release.Validator)
 	}
 	
 	// Mark key images as spent
-	for _, input := range tx.Inputs {
-		s.spentKeyImages[input.KeyImage] = true
+	for _, input := range tx.AllInputs() {
+		s.spentKeyImages.set(input.KeyImage, true)
+		
+		// Inputs spending by reference name their output, so it can be
+		// marked directly. Views may hold the old UTXO, so it is
+		// replaced rather than changed.
+		if w := input.SpendWitness(); w != nil {
+			utxoKey := makeUTXOKey(w.TxHash, w.OutputIndex)
+			utxo, _ := s.utxos.get(utxoKey)
+			spent := *utxo
+			spent.Spent = true
+			s.utxos.set(utxoKey, &spent)
+		}
 	}
 	
-	// Add new outputs to UTXO set
+	// Add new outputs to UTXO set, including the sponsor's change. Burns
+	// keep their index but are never spendable.
 	txHash := tx.Hash()
-	for i, output := range tx.Outputs {
+	for i, output := range tx.AllOutputs() {
+		if output.Burn {
+			continue
+		}
 		utxoKey := makeUTXOKey(txHash, uint32(i))
 		
 		utxo := &types.UTXO{
@@ -96,7 +235,10 @@ func (s *State) applyTransaction(tx *types.Transaction, blockHeight uint64) erro
 			Spent:       false,
 		}
 		
-		s.utxos[utxoKey] = utxo
+		s.utxos.set(utxoKey, utxo)
+		if output.IsRingMember() {
+			s.indexOutput(output.StealthAddr.SpendKey, blockHeight, tx.IsCoinbase())
+		}
 	}
 	
 	return nil
@@ -106,44 +248,239 @@ func (s *State) applyTransaction(tx *types.Transaction, blockHeight uint64) erro
 func (s *State) ValidateTransaction(tx *types.Transaction) error {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
+	return s.validateTransaction(tx)
+}
+
+// validateTransaction validates a transaction for the next block (must
+// hold lock)
+func (s *State) validateTransaction(tx *types.Transaction) error {
+	// Coinbase transactions are only valid as part of a block
+	if tx.IsCoinbase() {
+		return errors.New("transaction has no inputs")
+	}
+	
+	// Newer transaction formats are only valid once their fork is active
+	if version := s.forks.VersionAt(s.height + 1); uint32(tx.Version) > version {
+		return fmt.Errorf("transaction version %d not active (protocol version %d)", tx.Version, version)
+	}
+	
+	// Treasury spends and stake releases have no inputs and are
+	// authorized by validators
+	if tx.Treasury != nil {
+		return s.validateTreasurySpend(tx)
+	}
+	if tx.Release != nil {
+		return s.validateStakeRelease(tx)
+	}
+	
+	// Older versions do not sign hash locks, so they may not carry any
+	if tx.HasHashLocks() && tx.Version < types.TxVersionHashLock {
+		return fmt.Errorf("hash locks need transaction version %d", types.TxVersionHashLock)
+	}
+	if tx.HasLocks() && tx.Version < types.TxVersionLock {
+		return fmt.Errorf("locks need transaction version %d", types.TxVersionLock)
+	}
+	if tx.HasBurns() && tx.Version < types.TxVersionBurn {
+		return fmt.Errorf("burns need transaction version %d", types.TxVersionBurn)
+	}
+	if tx.HasViewTags() && tx.Version < types.TxVersionViewTag {
+		return fmt.Errorf("view tags need transaction version %d", types.TxVersionViewTag)
+	}
+	if tx.HasBonds() {
+		if tx.Version < types.TxVersionBond {
+			return fmt.Errorf("bonds need transaction version %d", types.TxVersionBond)
+		}
+		if _, _, err := tx.Bonded(); err != nil {
+			return err
+		}
+	}
+	if err := validateOutputs(tx.Outputs); err != nil {
+		return err
+	}
+	
+	// Check for double-spend, including inputs naming the same output
+	seen := make(map[types.PublicKey]bool)
+	for _, input := range tx.AllInputs() {
+		if s.isKeyImageSpent(input.KeyImage) {
+			return types.Reject(types.RejectDoubleSpend, ErrKeyImageSpent)
+		}
+		if seen[input.KeyImage] {
+			return types.Reject(types.RejectDoubleSpend, ErrDuplicateKeyImage)
+		}
+		seen[input.KeyImage] = true
+	}
 	
-	// Check for double-spend
+	// Outputs too small to be worth spending only bloat the UTXO set
+	if err := tx.CheckDust(s.dustLimitAt(s.height + 1)); err != nil {
+		return err
+	}
+	
+	// A sponsor pays the fee from its own input, checked on its own
+	if tx.FeePayer != nil {
+		if err := s.validateFeePayer(tx); err != nil {
+			return fmt.Errorf("invalid fee payer: %w", err)
+		}
+	}
+	
+	// Multisig, hash lock and lock inputs are authorized by meeting the
+	// conditions of the output they name, all other inputs by the ring
+	// signature
+	ringInputs := 0
 	for _, input := range tx.Inputs {
-		if s.spentKeyImages[input.KeyImage] {
-			return errors.New("key image already spent")
+		if lockKinds(input.Multisig != nil, input.HashLock != nil, input.Witness != nil) > 1 {
+			return errors.New("input can spend only one multisig, hash lock or lock condition")
+		}
+		if input.SpendWitness() != nil {
+			if err := s.validateLockedInput(tx, input); err != nil {
+				return err
+			}
+			continue
 		}
+		ringInputs++
 	}
 	
 	// Verify ring signature
-	if tx.RingSignature == nil {
-		return errors.New("missing ring signature")
+	if ringInputs > 0 && tx.RingSignature == nil {
+		return types.Reject(types.RejectBadRing, errors.New("missing ring signature"))
+	}
+	if err := s.checkRingSizes(tx, s.height+1); err != nil {
+		return types.Reject(types.RejectBadRing, err)
+	}
+	if err := s.checkRingMembers(tx, ringInputs, s.height+1); err != nil {
+		return err
+	}
+	if err := s.checkReferenceMaturity(tx, s.height+1); err != nil {
+		return types.Reject(types.RejectImmature, err)
+	}
+	if tx.RingSignature != nil {
+		sigHash := types.TxSigningHash(s.chainID, tx.PrefixHash())
+		if !s.verifyRingSignature(tx.RingSignature, sigHash) {
+			return types.Reject(types.RejectBadRing, errors.New("invalid ring signature (signed for another chain?)"))
+		}
+	}
+	
+	// Memos are size-limited and pay a per-byte fee
+	for _, output := range tx.Outputs {
+		if len(output.Memo) > types.MaxMemoSize {
+			return types.Reject(types.RejectTooLarge, fmt.Errorf("memo exceeds %d bytes", types.MaxMemoSize))
+		}
+	}
+	if memoFee := uint64(tx.MemoSize()) * types.MemoFeePerByte; tx.Fee < memoFee {
+		return types.Reject(types.RejectInsufficientFee, fmt.Errorf("fee %d below memo fee %d", tx.Fee, memoFee))
+	}
+	
+	// The base fee is burned on top of the memo fee
+	if baseFee := s.baseFeeAt(s.height + 1); tx.Fee < tx.MinFee(baseFee) {
+		return types.Reject(types.RejectInsufficientFee, fmt.Errorf("fee %d below base fee %d plus memo fee", tx.Fee, baseFee))
 	}
 	
 	// Verify amounts balance (simplified - amounts are visible in Phase 1)
-	var inputSum, outputSum uint64
-	for _, input := range tx.Inputs {
-		inputSum += input.Amount
+	inputSum, err := tx.InputSum()
+	if err != nil {
+		return fmt.Errorf("invalid input amounts: %w", err)
 	}
-	for _, output := range tx.Outputs {
-		outputSum += output.Amount
+	outputSum, err := tx.OutputSum()
+	if err != nil {
+		return fmt.Errorf("invalid output amounts: %w", err)
+	}
+	spent, err := types.AddAmounts(outputSum, tx.Fee)
+	if err != nil {
+		return fmt.Errorf("invalid fee: %w", err)
 	}
 	
-	if inputSum != outputSum+tx.Fee {
-		return errors.New("transaction amounts do not balance")
+	// The sender's inputs only cover the outputs of a sponsored transaction
+	if tx.FeePayer != nil {
+		spent = outputSum
+	}
+	
+	if inputSum != spent {
+		return ErrUnbalanced
 	}
 	
 	return nil
 }
 
-// GetUTXO retrieves a UTXO by transaction hash and output index
-func (s *State) GetUTXO(txHash types.Hash, index uint32) (*types.UTXO, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+// validateOutputs checks the conditions of the outputs a transaction or
+// coinbase creates
+func validateOutputs(outputs []*types.TxOutput) error {
+	for _, output := range outputs {
+		if output.Burn {
+			if err := output.ValidateBurn(); err != nil {
+				return err
+			}
+			continue
+		}
+		if lockKinds(output.Multisig != nil, output.HashLock != nil, output.Lock != nil) > 1 {
+			return errors.New("output can have only one of a multisig, hash lock or lock condition")
+		}
+		if output.ViewTag != nil && (output.HashLock != nil || output.Lock != nil) {
+			return errors.New("only stealth outputs can carry a view tag")
+		}
+		if output.Lock != nil {
+			if err := validateLock(output.Lock); err != nil {
+				return fmt.Errorf("invalid lock: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// validateFeePayer checks the sponsor of a transaction: its input must
+// be signed by its own ring signature over FeePayerHash and cover exactly
+// the fee plus its change (must hold lock)
+func (s *State) validateFeePayer(tx *types.Transaction) error {
+	fp := tx.FeePayer
+	
+	if tx.Version < types.TxVersionFeePayer {
+		return fmt.Errorf("needs transaction version %d", types.TxVersionFeePayer)
+	}
+	if len(tx.Inputs) == 0 {
+		return errors.New("sponsored transaction has no inputs of its own")
+	}
+	if fp.Input == nil || fp.RingSignature == nil {
+		return errors.New("missing input or ring signature")
+	}
+	if fp.Input.SpendWitness() != nil {
+		return errors.New("input must be a ring-signed spend")
+	}
+	if fp.RingSignature.KeyImage != fp.Input.KeyImage {
+		return errors.New("ring signature does not match input key image")
+	}
+	sigHash := types.TxSigningHash(s.chainID, tx.FeePayerHash())
+	if !s.verifyRingSignature(fp.RingSignature, sigHash) {
+		return types.Reject(types.RejectBadRing, errors.New("invalid ring signature"))
+	}
 	
+	var change uint64
+	if fp.Change != nil {
+		if len(fp.Change.Memo) > 0 {
+			return errors.New("change cannot carry a memo")
+		}
+		if fp.Change.SpendLock() != nil || fp.Change.Burn || fp.Change.ViewTag != nil {
+			return errors.New("change must be a plain output without a view tag")
+		}
+		change = fp.Change.Amount
+	}
+	covered, err := types.AddAmounts(tx.Fee, change)
+	if err != nil {
+		return err
+	}
+	if fp.Input.Amount != covered {
+		return fmt.Errorf("input %d does not match fee %d plus change %d", fp.Input.Amount, tx.Fee, change)
+	}
+	
+	return nil
+}
+
+// GetUTXO retrieves a UTXO by transaction hash and output index. It
+// takes only the lock of the output's shard, so it does not wait for a
+// block being applied, but may see some of its outputs before others;
+// use a View for a consistent answer.
+func (s *State) GetUTXO(txHash types.Hash, index uint32) (*types.UTXO, error) {
 	key := makeUTXOKey(txHash, index)
-	utxo, exists := s.utxos[key]
+	utxo, exists := s.utxos.get(key)
 	if !exists {
-		return nil, errors.New("UTXO not found")
+		return nil, ErrUTXONotFound
 	}
 	
 	return utxo, nil
@@ -154,98 +491,301 @@ func (s *State) GetAllUTXOs() []*types.UTXO {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	
-	utxos := make([]*types.UTXO, 0, len(s.utxos))
-	for _, utxo := range s.utxos {
+	utxos := make([]*types.UTXO, 0, s.utxos.len())
+	s.utxos.each(func(_ string, utxo *types.UTXO) {
 		if !utxo.Spent {
 			utxos = append(utxos, utxo)
 		}
-	}
+	})
 	
 	return utxos
 }
 
-// IsKeyImageSpent checks if a key image has been spent
+// IsKeyImageSpent checks if a key image has been spent. Like GetUTXO,
+// it takes only the lock of the key image's shard.
 func (s *State) IsKeyImageSpent(keyImage types.PublicKey) bool {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	
-	return s.spentKeyImages[keyImage]
+	return s.isKeyImageSpent(keyImage)
+}
+
+func (s *State) isKeyImageSpent(keyImage types.PublicKey) bool {
+	spent, _ := s.spentKeyImages.get(keyImage)
+	return spent
 }
 
 // AddValidator adds a new validator to the set
-func (s *State) AddValidator(pubKey types.PublicKey, stake uint64, height uint64) error {
+func (s *State) AddValidator(pubKey types.PublicKey, stake, selfBond uint64, commission uint32, height uint64) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if err := s.copyOnWrite(); err != nil {
+		return err
+	}
 	
 	if _, exists := s.validators[pubKey]; exists {
 		return errors.New("validator already exists")
 	}
 	
+	// With a capped set, new validators wait for the next rotation
+	capped := s.validatorSet.MaxValidators > 0
 	s.validators[pubKey] = &types.ValidatorState{
 		PublicKey:    pubKey,
 		StakedAmount: stake,
-		Active:       true,
+		Active:       !capped,
+		Queued:       capped,
 		JoinedHeight: height,
+		SelfBond:     selfBond,
+		Commission:   commission,
+		
+		CommissionEpoch: height / s.validatorSet.Epoch(),
 	}
 	
 	return nil
 }
 
+// slashStake takes percent of a validator's stake and records it in the
+// supply stats (must hold lock)
+func (s *State) slashStake(val *types.ValidatorState, percent uint64) {
+	// Split the product so large stakes cannot overflow
+	slash := val.StakedAmount/100*percent + val.StakedAmount%100*percent/100
+	val.StakedAmount -= slash
+	s.supply.Slashed += slash
+}
+
 // UpdateValidator updates validator state
 func (s *State) UpdateValidator(pubKey types.PublicKey, update func(*types.ValidatorState)) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if err := s.copyOnWrite(); err != nil {
+		return err
+	}
 	
 	val, exists := s.validators[pubKey]
 	if !exists {
-		return errors.New("validator not found")
+		return ErrValidatorNotFound
 	}
 	
 	update(val)
 	return nil
 }
 
-// GetValidator retrieves a validator's state
+// GetValidator retrieves a copy of a validator's state; changes go
+// through UpdateValidator
 func (s *State) GetValidator(pubKey types.PublicKey) (*types.ValidatorState, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	
 	val, exists := s.validators[pubKey]
 	if !exists {
-		return nil, errors.New("validator not found")
+		return nil, ErrValidatorNotFound
 	}
 	
-	return val, nil
+	return cloneValidator(val), nil
 }
 
-// GetActiveValidators returns all active validators
+// GetActiveValidators returns the active set, ranked by stake
 func (s *State) GetActiveValidators() []*types.ValidatorState {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	
 	active := make([]*types.ValidatorState, 0)
 	for _, val := range s.validators {
-		if val.Active {
-			active = append(active, val)
+		if val.Active && !val.Jailed {
+			active = append(active, cloneValidator(val))
 		}
 	}
+	types.RankValidators(active)
 	
 	return active
 }
 
-// ComputeStateRoot computes Merkle root of UTXO set
-func (s *State) ComputeStateRoot() types.Hash {
+// GetQueuedValidators returns validators waiting for a slot in the
+// active set, ranked by stake
+func (s *State) GetQueuedValidators() []*types.ValidatorState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	
+	queued := make([]*types.ValidatorState, 0)
+	for _, val := range s.validators {
+		if val.Queued {
+			queued = append(queued, cloneValidator(val))
+		}
+	}
+	types.RankValidators(queued)
+	
+	return queued
+}
+
+// GetJailedValidators returns validators jailed for downtime
+func (s *State) GetJailedValidators() []*types.ValidatorState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	
+	jailed := make([]*types.ValidatorState, 0)
+	for _, val := range s.validators {
+		if val.Jailed {
+			jailed = append(jailed, cloneValidator(val))
+		}
+	}
+	types.RankValidators(jailed)
+	
+	return jailed
+}
+
+// GetUnbondingValidators returns validators whose stake is unbonding or
+// waiting to be released, ranked by stake
+func (s *State) GetUnbondingValidators() []*types.ValidatorState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	
+	unbonding := make([]*types.ValidatorState, 0)
+	for _, val := range s.validators {
+		if val.UnbondingUntil != 0 {
+			unbonding = append(unbonding, cloneValidator(val))
+		}
+	}
+	types.RankValidators(unbonding)
+	
+	return unbonding
+}
+
+// Liveness returns the downtime jailing parameters
+func (s *State) Liveness() types.LivenessConfig {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.liveness
+}
+
+// ValidatorSet returns the active set parameters
+func (s *State) ValidatorSet() types.ValidatorSetConfig {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
+	return s.validatorSet
+}
+
+// trackLiveness records which active validators voted on a block and,
+// from LastCommitVersion on, jails those that missed too many blocks in
+// the window. The block's late votes mark their validators as having
+// signed the parent; a miss of the block itself only counts once the
+// next block could no longer carry the vote (must hold lock).
+func (s *State) trackLiveness(block *types.Block) {
+	height := block.Header.Height
+	signed := make(map[types.PublicKey]bool, len(block.Validators))
+	for _, vote := range block.Validators {
+		signed[vote.Validator] = true
+	}
+	late := make(map[types.PublicKey]bool, len(block.LastCommit))
+	for _, vote := range block.LastCommit {
+		late[vote.Validator] = true
+	}
+	jailing := s.forks.VersionAt(height) >= types.LastCommitVersion
 	
-	// Simplified: hash all UTXO keys
-	h := sha256.New()
+	window := s.liveness.Window()
+	for _, val := range s.validators {
+		if !val.Active {
+			continue
+		}
+		
+		if late[val.PublicKey] {
+			val.MarkSigned(height-1, window, true)
+		}
+		val.MarkSigned(height, window, signed[val.PublicKey])
+		
+		missed := val.MissedCount
+		if val.MissedAt(height, window) {
+			missed-- // May still be carried by the next block
+		}
+		if jailing && missed > s.liveness.MaxMissed() {
+			s.jailValidator(val, height)
+		}
+	}
+}
+
+// jailValidator slashes a validator for downtime and removes it from the
+// set until it unjails (must hold lock)
+func (s *State) jailValidator(val *types.ValidatorState, height uint64) {
+	s.slashStake(val, s.liveness.SlashPercent())
+	val.Jail(height + s.liveness.JailBlocks())
+}
+
+// rotateValidators activates the top eligible validators by stake and
+// queues the rest (must hold lock)
+func (s *State) rotateValidators() {
+	eligible := make([]*types.ValidatorState, 0, len(s.validators))
+	for _, val := range s.validators {
+		if val.Eligible() {
+			eligible = append(eligible, val)
+		}
+	}
+	types.RankValidators(eligible)
 	
-	for key := range s.utxos {
-		h.Write([]byte(key))
+	for i, val := range eligible {
+		val.Active = s.validatorSet.MaxValidators == 0 || i < s.validatorSet.MaxValidators
+		val.Queued = !val.Active
 	}
+}
+
+// ComputeStateRoot computes the Merkle root of the chunked state (see
+// types.StateManifest), so state sync chunks can be proven against it.
+// NOTE: Phase 1 rebuilds the whole tree on every call.
+func (s *State) ComputeStateRoot() types.Hash {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	
-	return sha256.Sum256(h.Sum(nil))
+	cs := types.NewChunkedState(s.export())
+	return cs.Manifest.StateRoot()
+}
+
+// ChainID returns the chain ID from genesis
+func (s *State) ChainID() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.chainID
+}
+
+// Emission returns the block subsidy schedule
+func (s *State) Emission() types.EmissionConfig {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.emission
+}
+
+// GetTotalSupply returns the coins in circulation
+func (s *State) GetTotalSupply() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.totalSupply
+}
+
+// SupplyStats returns how the total supply came about
+func (s *State) SupplyStats() types.SupplyStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.supply
+}
+
+// GetTotalStake returns the stake bonded by all validators
+func (s *State) GetTotalStake() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	
+	var total uint64
+	for _, val := range s.validators {
+		total += val.StakedAmount
+	}
+	return total
+}
+
+// Forks returns the chain's fork schedule
+func (s *State) Forks() types.ForkSchedule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.forks
+}
+
+// ProtocolVersionAt returns the protocol version in force at a height
+func (s *State) ProtocolVersionAt(height uint64) uint32 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.forks.VersionAt(height)
 }
 
 // GetHeight returns current blockchain height
@@ -266,17 +806,84 @@ func makeUTXOKey(txHash types.Hash, index uint32) string {
 func (s *State) InitializeGenesis(genesis *types.GenesisConfig) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if err := s.copyOnWrite(); err != nil {
+		return err
+	}
+	
+	if err := genesis.Forks.Validate(); err != nil {
+		return fmt.Errorf("invalid fork schedule: %w", err)
+	}
+	s.forks = genesis.Forks
+	s.sigCache.reset()
+	
+	if err := genesis.Emission.Validate(); err != nil {
+		return fmt.Errorf("invalid emission: %w", err)
+	}
+	s.emission = genesis.Emission
+	
+	if err := genesis.FeeMarket.Validate(); err != nil {
+		return fmt.Errorf("invalid fee market: %w", err)
+	}
+	s.feeMarket = genesis.FeeMarket
+	s.baseFee = genesis.FeeMarket.InitialBaseFee
+	
+	if err := genesis.ValidatorSet.Validate(); err != nil {
+		return fmt.Errorf("invalid validator set: %w", err)
+	}
+	s.validatorSet = genesis.ValidatorSet
+	
+	if err := genesis.Liveness.Validate(); err != nil {
+		return fmt.Errorf("invalid liveness config: %w", err)
+	}
+	s.liveness = genesis.Liveness
 	
-	// Add initial validators
-	for _, val := range genesis.InitialValidators {
+	if err := genesis.Denomination.Validate(); err != nil {
+		return fmt.Errorf("invalid denomination: %w", err)
+	}
+	
+	if err := types.CheckAmount(genesis.DustLimit); err != nil {
+		return fmt.Errorf("invalid dust limit: %w", err)
+	}
+	s.dustLimit = genesis.DustLimit
+	
+	if err := genesis.RingSize.Validate(); err != nil {
+		return fmt.Errorf("invalid ring size: %w", err)
+	}
+	s.ringPolicy = genesis.RingSize
+	
+	if err := genesis.Maturity.Validate(); err != nil {
+		return fmt.Errorf("invalid maturity: %w", err)
+	}
+	s.maturity = genesis.Maturity
+	
+	if genesis.InitialSupply > s.emission.SupplyCap() {
+		return fmt.Errorf("initial supply %d exceeds supply cap %d", genesis.InitialSupply, s.emission.SupplyCap())
+	}
+	s.chainID = genesis.ChainID
+	
+	// Add initial validators. Each gets its own copy, so the state never
+	// shares one with the genesis config or another validator.
+	for i := range genesis.InitialValidators {
+		val := genesis.InitialValidators[i]
 		s.validators[val.PublicKey] = &val
 	}
 	
 	// Pre-allocate UTXOs
 	// TODO: Create genesis transaction with pre-allocated outputs
 	
+	// Carry over state exported from another chain
+	if genesis.InitialState != nil {
+		if err := s.restoreSnapshot(genesis.InitialState); err != nil {
+			return fmt.Errorf("invalid initial state: %w", err)
+		}
+	}
+	
 	s.totalSupply = genesis.InitialSupply
+	s.supply = types.SupplyStats{Genesis: genesis.InitialSupply}
 	s.height = 0
 	
+	// The first epoch starts with the top validators by stake
+	s.rotateValidators()
+	
 	return nil
 }
\ No newline at end of file
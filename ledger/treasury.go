@@ -0,0 +1,147 @@
+package ledger
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/ed25519"
+
+	"blockchain/types"
+)
+
+// BlockSubsidy returns the newly created coins of a block at height,
+// treasury share included. The subsidy stops once the supply cap is
+// reached.
+func (s *State) BlockSubsidy(height uint64) uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.blockSubsidy(height)
+}
+
+// blockSubsidy returns the capped subsidy at height (must hold lock)
+func (s *State) blockSubsidy(height uint64) uint64 {
+	subsidy := s.emission.Subsidy(height)
+	room, err := types.SubAmounts(s.emission.SupplyCap(), s.totalSupply)
+	if err != nil {
+		return 0
+	}
+	if subsidy > room {
+		return room
+	}
+	return subsidy
+}
+
+// Treasury returns the treasury balance and spend count
+func (s *State) Treasury() types.Treasury {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.treasury
+}
+
+// validateTreasurySpend checks a transaction paying out of the
+// treasury: plain outputs covered by the balance, the next nonce, and
+// approvals from validators holding 2/3 of the active stake (must hold
+// lock)
+func (s *State) validateTreasurySpend(tx *types.Transaction) error {
+	ts := tx.Treasury
+
+	if tx.Version < types.TxVersionTreasury {
+		return fmt.Errorf("treasury spends need transaction version %d", types.TxVersionTreasury)
+	}
+	if err := ts.ValidateShape(); err != nil {
+		return err
+	}
+	if len(tx.Inputs) > 0 || tx.FeePayer != nil || tx.RingSignature != nil || tx.Release != nil {
+		return errors.New("treasury spend cannot have inputs or signatures of its own")
+	}
+	if tx.Fee != 0 {
+		return errors.New("treasury spend pays no fee")
+	}
+	if len(tx.Outputs) == 0 {
+		return errors.New("treasury spend has no outputs")
+	}
+	for _, output := range tx.Outputs {
+		if output.SpendLock() != nil || output.Burn {
+			return errors.New("treasury spend outputs must be plain")
+		}
+		if len(output.Memo) > types.MaxMemoSize {
+			return types.Reject(types.RejectTooLarge, fmt.Errorf("memo exceeds %d bytes", types.MaxMemoSize))
+		}
+	}
+
+	// A spend whose nonce was used has been overtaken by another
+	if ts.Nonce < s.treasury.Spends {
+		return types.Reject(types.RejectExpired, fmt.Errorf("treasury spend nonce %d, expected %d", ts.Nonce, s.treasury.Spends))
+	}
+	if ts.Nonce != s.treasury.Spends {
+		return fmt.Errorf("treasury spend nonce %d, expected %d", ts.Nonce, s.treasury.Spends)
+	}
+	amount, err := tx.OutputSum()
+	if err != nil {
+		return err
+	}
+	if amount > s.treasury.Balance {
+		return fmt.Errorf("treasury spend of %d exceeds balance %d", amount, s.treasury.Balance)
+	}
+
+	return s.checkApprovals(tx)
+}
+
+// checkApprovals checks that validators holding 2/3 of the active stake
+// signed a treasury spend (must hold lock)
+func (s *State) checkApprovals(tx *types.Transaction) error {
+	var total uint64
+	for _, val := range s.validators {
+		if val.Active && !val.Jailed {
+			total += val.StakedAmount
+		}
+	}
+	if total == 0 {
+		return errors.New("no active stake to approve treasury spends")
+	}
+
+	sigHash := types.TreasurySigningHash(s.chainID, tx.PrefixHash())
+	seen := make(map[types.PublicKey]bool)
+
+	var approved uint64
+	for _, a := range tx.Treasury.Approvals {
+		val, ok := s.validators[a.Validator]
+		if !ok || !val.Active || val.Jailed {
+			return fmt.Errorf("approval from %s, not an active validator", a.Validator)
+		}
+		if seen[a.Validator] {
+			return fmt.Errorf("duplicate approval from %s", a.Validator)
+		}
+		seen[a.Validator] = true
+
+		if !ed25519.Verify(ed25519.PublicKey(a.Validator[:]), sigHash[:], a.Signature[:]) {
+			return fmt.Errorf("invalid approval signature from %s", a.Validator)
+		}
+		approved += val.StakedAmount
+	}
+
+	if approved*3 < total*2 {
+		return fmt.Errorf("approvals carry %d of %d active stake, need 2/3", approved, total)
+	}
+	return nil
+}
+
+// spendTreasury takes a treasury spend's outputs out of the balance
+// (must hold lock)
+func (s *State) spendTreasury(tx *types.Transaction) error {
+	if tx.Treasury.Nonce != s.treasury.Spends {
+		return fmt.Errorf("treasury spend nonce %d, expected %d", tx.Treasury.Nonce, s.treasury.Spends)
+	}
+	amount, err := tx.OutputSum()
+	if err != nil {
+		return err
+	}
+	balance, err := types.SubAmounts(s.treasury.Balance, amount)
+	if err != nil {
+		return fmt.Errorf("treasury spend exceeds balance: %w", err)
+	}
+
+	s.treasury.Balance = balance
+	s.treasury.Spends++
+	return nil
+}
@@ -0,0 +1,86 @@
+package ledger
+
+import (
+	"errors"
+	"maps"
+	"slices"
+
+	"blockchain/types"
+)
+
+// errReadOnly is returned by writes to a view
+var errReadOnly = errors.New("state view is read-only")
+
+// View returns a read-only snapshot of the state at its current height.
+// Reads of a view never wait for a block being applied, and keep seeing
+// the same height however far the chain moves on, so a caller making
+// several reads gets answers that agree. Every read method of State
+// works on a view; writes fail.
+//
+// A view shares the state's maps until the state's next write, which
+// copies them first. Views taken between two blocks share one copy. The
+// UTXO set and key images are copied a shard at a time, only the shards
+// written to (see shard.go).
+func (s *State) View() *State {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	s.shared.Store(true)
+	view := &State{
+		utxos:          s.utxos.view(),
+		spentKeyImages: s.spentKeyImages.view(),
+		validators:     s.validators,
+		height:         s.height,
+		totalSupply:    s.totalSupply,
+		supply:         s.supply,
+		treasury:       s.treasury,
+		forks:          s.forks,
+		chainID:        s.chainID,
+		emission:       s.emission,
+		feeMarket:      s.feeMarket,
+		baseFee:        s.baseFee,
+		dustLimit:      s.dustLimit,
+		ringPolicy:     s.ringPolicy,
+		// Writes only append past the view's length
+		ringOutputs:  s.ringOutputs[:len(s.ringOutputs):len(s.ringOutputs)],
+		ringIndex:    s.ringIndex,
+		maturity:     s.maturity,
+		validatorSet: s.validatorSet,
+		liveness:     s.liveness,
+		sigCache:     s.sigCache,
+		readOnly:     true,
+	}
+	view.shared.Store(true)
+	return view
+}
+
+// copyOnWrite gives the state validators and a ring index of its own
+// before a write if views share them, and fails on a view (must hold
+// lock). Validator states are updated in place, so they are copied too.
+func (s *State) copyOnWrite() error {
+	if s.readOnly {
+		return errReadOnly
+	}
+	if !s.shared.Load() {
+		return nil
+	}
+
+	validators := make(map[types.PublicKey]*types.ValidatorState, len(s.validators))
+	for key, val := range s.validators {
+		validators[key] = cloneValidator(val)
+	}
+	s.validators = validators
+
+	s.ringIndex = maps.Clone(s.ringIndex)
+
+	s.shared.Store(false)
+	return nil
+}
+
+// cloneValidator returns a copy of a validator sharing no memory with
+// it, so it can be read while the state changes the original
+func cloneValidator(val *types.ValidatorState) *types.ValidatorState {
+	copied := *val
+	copied.MissedBlocks = slices.Clone(val.MissedBlocks)
+	return &copied
+}
@@ -0,0 +1,61 @@
+package notify
+
+import (
+	"sync"
+	"time"
+)
+
+// Node event types, published on the node's event bus. The node adds
+// blocks only once they are final, so the finalized event of a block
+// follows its block event and carries the commit votes.
+const (
+	EventTx        EventType = "tx"        // A transaction entered the pool
+	EventFinalized EventType = "finalized" // A block's commit certificate
+)
+
+// Subscriber receives events from a Bus. Notify must not block: it is
+// called from the code publishing the event, so subscribers queue
+// events and deliver them on their own goroutine.
+type Subscriber interface {
+	Notify(e *Event)
+}
+
+// Bus fans events out to subscribers such as a Notifier or the message
+// bus publishers
+type Bus struct {
+	mu   sync.RWMutex
+	subs []Subscriber
+}
+
+// NewBus creates an event bus without subscribers
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe adds a subscriber receiving every later event
+func (b *Bus) Subscribe(s Subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subs = append(b.subs, s)
+}
+
+// Active reports whether the bus has subscribers, so publishers can skip
+// building events nobody receives
+func (b *Bus) Active() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.subs) > 0
+}
+
+// Publish hands an event to every subscriber
+func (b *Bus) Publish(e *Event) {
+	if e.Created == 0 {
+		e.Created = time.Now().Unix()
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, s := range b.subs {
+		s.Notify(e)
+	}
+}
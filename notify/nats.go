@@ -0,0 +1,233 @@
+package notify
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultNATSSubject prefixes the subjects events are published on
+const DefaultNATSSubject = "apex"
+
+// natsDialTimeout bounds connecting to the server and its handshake
+const natsDialTimeout = 10 * time.Second
+
+// NATSPublisher publishes events to a NATS server, each on the subject
+// "<prefix>.<type>" with the JSON event as payload. It speaks the core
+// NATS text protocol over plain TCP and reconnects with backoff when the
+// connection drops; events published while disconnected are queued up
+// to DefaultQueueSize.
+type NATSPublisher struct {
+	addr   string
+	user   string
+	pass   string
+	token  string
+	prefix string
+
+	queue chan *delivery
+	quit  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// NewNATSPublisher starts publishing to the server at rawURL
+// ("nats://[user:pass@]host:port", or "nats://token@host:port")
+func NewNATSPublisher(rawURL, prefix string) (*NATSPublisher, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "nats" || u.Host == "" {
+		return nil, fmt.Errorf("invalid NATS URL %q", rawURL)
+	}
+	if prefix == "" {
+		prefix = DefaultNATSSubject
+	}
+	if strings.ContainsAny(prefix, " \t\r\n*>") {
+		return nil, fmt.Errorf("invalid NATS subject prefix %q", prefix)
+	}
+
+	p := &NATSPublisher{
+		addr:   u.Host,
+		prefix: prefix,
+		queue:  make(chan *delivery, DefaultQueueSize),
+		quit:   make(chan struct{}),
+	}
+	if u.Port() == "" {
+		p.addr = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	if u.User != nil {
+		if pass, ok := u.User.Password(); ok {
+			p.user, p.pass = u.User.Username(), pass
+		} else {
+			p.token = u.User.Username()
+		}
+	}
+
+	p.wg.Add(1)
+	go p.run()
+	return p, nil
+}
+
+// Notify implements Subscriber
+func (p *NATSPublisher) Notify(e *Event) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("NATS event %s not sent: %v", e.ID, err)
+		return
+	}
+
+	select {
+	case p.queue <- &delivery{id: e.ID, typ: e.Type, body: body}:
+	default:
+		log.Printf("NATS queue is full, dropping event %s", e.ID)
+	}
+}
+
+// Close disconnects from the server. Queued events are lost.
+func (p *NATSPublisher) Close() {
+	close(p.quit)
+	p.wg.Wait()
+}
+
+// run keeps a connection open and publishes queued events on it
+func (p *NATSPublisher) run() {
+	defer p.wg.Done()
+
+	backoff := minBackoff
+	for {
+		err := p.session()
+		if err == nil {
+			return // Closed
+		}
+		log.Printf("NATS connection to %s failed: %v", p.addr, err)
+
+		select {
+		case <-p.quit:
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// session connects and publishes until the connection fails or the
+// publisher is closed, which returns nil
+func (p *NATSPublisher) session() error {
+	conn, err := net.DialTimeout("tcp", p.addr, natsDialTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	conn.SetDeadline(time.Now().Add(natsDialTimeout))
+	if err := p.handshake(conn, r); err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Time{})
+
+	// The server pings idle clients and drops those that do not answer.
+	// The reader answers, and reports server errors and disconnects.
+	var writeMu sync.Mutex
+	failed := make(chan error, 1)
+	go func() {
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				failed <- err
+				return
+			}
+			switch {
+			case strings.HasPrefix(line, "PING"):
+				writeMu.Lock()
+				_, err = conn.Write([]byte("PONG\r\n"))
+				writeMu.Unlock()
+				if err != nil {
+					failed <- err
+					return
+				}
+			case strings.HasPrefix(line, "-ERR"):
+				failed <- fmt.Errorf("server error: %s", strings.TrimSpace(line[4:]))
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-p.quit:
+			return nil
+		case err := <-failed:
+			return err
+		case d := <-p.queue:
+			subject := p.prefix + "." + string(d.typ)
+			writeMu.Lock()
+			_, err := fmt.Fprintf(conn, "PUB %s %d\r\n%s\r\n", subject, len(d.body), d.body)
+			writeMu.Unlock()
+			if err != nil {
+				log.Printf("NATS event %s not sent: %v", d.id, err)
+				return err
+			}
+		}
+	}
+}
+
+// handshake reads the server INFO and sends CONNECT, checking with a
+// PING that the server accepted it
+func (p *NATSPublisher) handshake(conn net.Conn, r *bufio.Reader) error {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		return errors.New("not a NATS server")
+	}
+	var info struct {
+		TLSRequired bool `json:"tls_required"`
+	}
+	if err := json.Unmarshal([]byte(line[5:]), &info); err == nil && info.TLSRequired {
+		return errors.New("server requires TLS, which is not supported")
+	}
+
+	connect := map[string]interface{}{
+		"verbose":  false,
+		"pedantic": false,
+		"name":     "apex-node",
+		"lang":     "go",
+		"protocol": 0,
+	}
+	if p.user != "" {
+		connect["user"], connect["pass"] = p.user, p.pass
+	}
+	if p.token != "" {
+		connect["auth_token"] = p.token
+	}
+	opts, err := json.Marshal(connect)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(conn, "CONNECT %s\r\nPING\r\n", opts); err != nil {
+		return err
+	}
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		switch {
+		case strings.HasPrefix(line, "PONG"):
+			return nil
+		case strings.HasPrefix(line, "PING"):
+			if _, err := conn.Write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("server refused connection: %s", strings.TrimSpace(line[4:]))
+		}
+	}
+}
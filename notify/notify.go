@@ -0,0 +1,302 @@
+// Package notify delivers chain events to payment processors as signed
+// webhooks. Each configured endpoint gets its own queue, so a slow or
+// failing endpoint never delays the others, and failed deliveries are
+// retried with exponential backoff.
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// EventType tells what an Event reports
+type EventType string
+
+const (
+	EventBlock           EventType = "block"            // A block was added
+	EventPaymentReceived EventType = "payment_received" // An output paid the wallet
+	EventTxFinalized     EventType = "tx_finalized"     // A transaction spending the wallet's outputs was finalized
+)
+
+// Webhook request headers
+const (
+	HeaderEvent     = "X-Apex-Event"
+	HeaderDelivery  = "X-Apex-Delivery" // Event ID, the same on every retry
+	HeaderTimestamp = "X-Apex-Timestamp"
+	HeaderSignature = "X-Apex-Signature"
+)
+
+// Delivery defaults used when the configuration leaves them unset
+const (
+	DefaultMaxAttempts = 8
+	DefaultTimeout     = 10 * time.Second
+	DefaultQueueSize   = 1024
+
+	// Backoff doubles from minBackoff after each failed attempt
+	minBackoff = time.Second
+	maxBackoff = 5 * time.Minute
+)
+
+// Endpoint is an HTTP endpoint receiving webhooks
+type Endpoint struct {
+	URL    string      `json:"url"`
+	Secret string      `json:"secret"`           // HMAC-SHA256 key
+	Events []EventType `json:"events,omitempty"` // Empty for all events
+}
+
+// Config lists the endpoints to notify
+type Config struct {
+	Endpoints   []Endpoint `json:"endpoints"`
+	MaxAttempts int        `json:"max_attempts,omitempty"` // Per event and endpoint
+	TimeoutSecs int        `json:"timeout_secs,omitempty"` // Per attempt
+}
+
+// LoadConfig reads a JSON webhook configuration file
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid webhook config: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// Validate checks the endpoints
+func (c *Config) Validate() error {
+	if len(c.Endpoints) == 0 {
+		return errors.New("no webhook endpoints configured")
+	}
+	for _, e := range c.Endpoints {
+		u, err := url.Parse(e.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid webhook URL %q", e.URL)
+		}
+		if e.Secret == "" {
+			return fmt.Errorf("webhook %s has no secret", e.URL)
+		}
+		for _, t := range e.Events {
+			if t != EventBlock && t != EventPaymentReceived && t != EventTxFinalized {
+				return fmt.Errorf("webhook %s: unknown event %q", e.URL, t)
+			}
+		}
+	}
+	if c.MaxAttempts < 0 || c.TimeoutSecs < 0 {
+		return errors.New("max_attempts and timeout_secs must not be negative")
+	}
+	return nil
+}
+
+// Event is the body of a webhook
+type Event struct {
+	// ID identifies the event. It is derived from what the event
+	// reports, so receivers can drop duplicates, including those sent
+	// again after a restart.
+	ID      string      `json:"id"`
+	Type    EventType   `json:"type"`
+	Created int64       `json:"created"` // Unix time
+	Data    interface{} `json:"data"`
+}
+
+// Notifier posts events to the configured endpoints
+type Notifier struct {
+	endpoints   []*endpoint
+	client      *http.Client
+	maxAttempts int
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// endpoint is an Endpoint with its delivery queue
+type endpoint struct {
+	Endpoint
+	queue chan *delivery
+}
+
+// delivery is a queued event, encoded once for all endpoints
+type delivery struct {
+	id   string
+	typ  EventType
+	body []byte
+}
+
+// New starts a notifier delivering to cfg's endpoints
+func New(cfg *Config) (*Notifier, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	timeout := DefaultTimeout
+	if cfg.TimeoutSecs > 0 {
+		timeout = time.Duration(cfg.TimeoutSecs) * time.Second
+	}
+	n := &Notifier{
+		client:      &http.Client{Timeout: timeout},
+		maxAttempts: cfg.MaxAttempts,
+		quit:        make(chan struct{}),
+	}
+	if n.maxAttempts == 0 {
+		n.maxAttempts = DefaultMaxAttempts
+	}
+
+	for _, e := range cfg.Endpoints {
+		ep := &endpoint{Endpoint: e, queue: make(chan *delivery, DefaultQueueSize)}
+		n.endpoints = append(n.endpoints, ep)
+		n.wg.Add(1)
+		go n.deliver(ep)
+	}
+	return n, nil
+}
+
+// Wants reports whether any endpoint receives events of type t
+func (n *Notifier) Wants(t EventType) bool {
+	for _, ep := range n.endpoints {
+		if ep.wants(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Notify queues an event for every endpoint that wants it. Events are
+// dropped, with a log message, when an endpoint's queue is full.
+func (n *Notifier) Notify(e *Event) {
+	if e.Created == 0 {
+		e.Created = time.Now().Unix()
+	}
+	body, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("Webhook event %s not sent: %v", e.ID, err)
+		return
+	}
+	d := &delivery{id: e.ID, typ: e.Type, body: body}
+
+	for _, ep := range n.endpoints {
+		if !ep.wants(e.Type) {
+			continue
+		}
+		select {
+		case ep.queue <- d:
+		default:
+			log.Printf("Webhook queue for %s is full, dropping event %s", ep.URL, e.ID)
+		}
+	}
+}
+
+// Close stops delivery. Queued events not yet delivered are lost.
+func (n *Notifier) Close() {
+	close(n.quit)
+	n.wg.Wait()
+}
+
+func (ep *endpoint) wants(t EventType) bool {
+	return len(ep.Events) == 0 || slices.Contains(ep.Events, t)
+}
+
+// deliver posts an endpoint's queued events in order, retrying each
+// until it is accepted or runs out of attempts
+func (n *Notifier) deliver(ep *endpoint) {
+	defer n.wg.Done()
+
+	for {
+		var d *delivery
+		select {
+		case <-n.quit:
+			return
+		case d = <-ep.queue:
+		}
+
+		backoff := minBackoff
+		for attempt := 1; ; attempt++ {
+			err := n.post(ep, d)
+			if err == nil {
+				break
+			}
+			if attempt >= n.maxAttempts {
+				log.Printf("Webhook to %s failed after %d attempts: %v", ep.URL, attempt, err)
+				break
+			}
+
+			select {
+			case <-n.quit:
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, maxBackoff)
+		}
+	}
+}
+
+// post makes one delivery attempt. Any 2xx status accepts the event.
+func (n *Notifier) post(ep *endpoint, d *delivery) error {
+	req, err := http.NewRequest(http.MethodPost, ep.URL, bytes.NewReader(d.body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, string(d.typ))
+	req.Header.Set(HeaderDelivery, d.id)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(ep.Secret, timestamp, d.body))
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("endpoint answered %s", resp.Status)
+	}
+	return nil
+}
+
+// Sign returns the signature header of a webhook: "sha256=" and the hex
+// HMAC-SHA256 of the timestamp, a dot and the body, keyed by secret
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature of a received webhook and that its
+// timestamp is within tolerance of now, which stops replays
+func Verify(secret string, header http.Header, body []byte, tolerance time.Duration) error {
+	timestamp := header.Get(HeaderTimestamp)
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("missing or invalid webhook timestamp")
+	}
+	if age := time.Since(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+		return errors.New("webhook timestamp outside tolerance")
+	}
+
+	want := Sign(secret, timestamp, body)
+	if !hmac.Equal([]byte(header.Get(HeaderSignature)), []byte(want)) {
+		return errors.New("invalid webhook signature")
+	}
+	return nil
+}
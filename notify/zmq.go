@@ -0,0 +1,389 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ZMTP framing, as in ZeroMQ RFC 23 (ZMTP 3.0) with the NULL mechanism
+const (
+	zmtpMore    = 0x01
+	zmtpLong    = 0x02
+	zmtpCommand = 0x04
+
+	zmtpGreetingSize = 64
+
+	// Subscriptions and commands from subscribers are tiny; anything
+	// larger is a broken or hostile peer
+	zmtpMaxInbound = 4096
+
+	zmqHandshakeTimeout = 10 * time.Second
+	zmqPeerQueueSize    = 1024
+)
+
+// ZMQPublisher is a ZeroMQ PUB socket bound to a TCP address. Every
+// event is sent to the SUB sockets subscribed to its topic as a two
+// frame message: the event type, then the JSON event. Like a ZeroMQ PUB
+// socket it drops messages for subscribers that fall behind.
+type ZMQPublisher struct {
+	listener net.Listener
+
+	mu    sync.Mutex
+	peers map[*zmqPeer]bool
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// zmqPeer is a connected subscriber
+type zmqPeer struct {
+	conn  net.Conn
+	queue chan [][]byte
+
+	mu     sync.Mutex
+	topics map[string]bool // Subscribed topic prefixes
+}
+
+// NewZMQPublisher binds a publisher to endpoint ("tcp://host:port", or
+// "host:port")
+func NewZMQPublisher(endpoint string) (*ZMQPublisher, error) {
+	addr := strings.TrimPrefix(endpoint, "tcp://")
+	if strings.Contains(addr, "://") {
+		return nil, fmt.Errorf("unsupported ZeroMQ endpoint %q: only tcp is supported", endpoint)
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &ZMQPublisher{
+		listener: listener,
+		peers:    make(map[*zmqPeer]bool),
+		quit:     make(chan struct{}),
+	}
+	p.wg.Add(1)
+	go p.accept()
+	return p, nil
+}
+
+// Addr returns the address the publisher is bound to
+func (p *ZMQPublisher) Addr() string {
+	return p.listener.Addr().String()
+}
+
+// Notify implements Subscriber
+func (p *ZMQPublisher) Notify(e *Event) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("ZeroMQ event %s not sent: %v", e.ID, err)
+		return
+	}
+	msg := [][]byte{[]byte(e.Type), body}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for peer := range p.peers {
+		if !peer.subscribed(msg[0]) {
+			continue
+		}
+		select {
+		case peer.queue <- msg:
+		default:
+		}
+	}
+}
+
+// Close unbinds the publisher and disconnects subscribers
+func (p *ZMQPublisher) Close() {
+	close(p.quit)
+	p.listener.Close()
+
+	p.mu.Lock()
+	for peer := range p.peers {
+		peer.conn.Close()
+	}
+	p.mu.Unlock()
+
+	p.wg.Wait()
+}
+
+func (p *ZMQPublisher) accept() {
+	defer p.wg.Done()
+
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			select {
+			case <-p.quit:
+				return
+			default:
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+			log.Printf("ZeroMQ publisher stopped accepting: %v", err)
+			return
+		}
+
+		p.wg.Add(1)
+		go p.serve(conn)
+	}
+}
+
+// serve handshakes with a subscriber, then sends it events while
+// reading its subscriptions
+func (p *ZMQPublisher) serve(conn net.Conn) {
+	defer p.wg.Done()
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(zmqHandshakeTimeout))
+	if err := zmtpHandshake(conn); err != nil {
+		return
+	}
+	conn.SetDeadline(time.Time{})
+
+	peer := &zmqPeer{
+		conn:   conn,
+		queue:  make(chan [][]byte, zmqPeerQueueSize),
+		topics: make(map[string]bool),
+	}
+	p.mu.Lock()
+	select {
+	case <-p.quit:
+		p.mu.Unlock()
+		return
+	default:
+	}
+	p.peers[peer] = true
+	p.mu.Unlock()
+
+	defer func() {
+		p.mu.Lock()
+		delete(p.peers, peer)
+		p.mu.Unlock()
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		peer.readSubscriptions()
+	}()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-p.quit:
+			return
+		case msg := <-peer.queue:
+			if err := zmtpWriteMessage(conn, msg); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// subscribed reports whether the peer subscribed to a prefix of topic
+func (peer *zmqPeer) subscribed(topic []byte) bool {
+	peer.mu.Lock()
+	defer peer.mu.Unlock()
+	for prefix := range peer.topics {
+		if bytes.HasPrefix(topic, []byte(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// readSubscriptions applies subscribe and cancel requests until the
+// connection fails. ZMTP 3.0 peers send them as messages starting with
+// 1 or 0, ZMTP 3.1 peers as SUBSCRIBE and CANCEL commands.
+func (peer *zmqPeer) readSubscriptions() {
+	for {
+		flags, body, err := zmtpReadFrame(peer.conn)
+		if err != nil {
+			return
+		}
+
+		var subscribe bool
+		var topic []byte
+		switch {
+		case flags&zmtpCommand != 0:
+			name, data, err := zmtpParseCommand(body)
+			if err != nil {
+				return
+			}
+			switch name {
+			case "SUBSCRIBE":
+				subscribe, topic = true, data
+			case "CANCEL":
+				topic = data
+			default:
+				continue
+			}
+		case len(body) > 0 && body[0] <= 1:
+			subscribe, topic = body[0] == 1, body[1:]
+		default:
+			continue
+		}
+
+		peer.mu.Lock()
+		if subscribe {
+			peer.topics[string(topic)] = true
+		} else {
+			delete(peer.topics, string(topic))
+		}
+		peer.mu.Unlock()
+	}
+}
+
+// zmtpHandshake exchanges greetings and READY commands as a PUB socket
+// with the NULL security mechanism
+func zmtpHandshake(conn net.Conn) error {
+	greeting := make([]byte, zmtpGreetingSize)
+	greeting[0], greeting[9] = 0xFF, 0x7F
+	greeting[10], greeting[11] = 3, 0 // ZMTP 3.0
+	copy(greeting[12:32], "NULL")
+	if _, err := conn.Write(greeting); err != nil {
+		return err
+	}
+
+	peer := make([]byte, zmtpGreetingSize)
+	if _, err := io.ReadFull(conn, peer); err != nil {
+		return err
+	}
+	if peer[0] != 0xFF || peer[9] != 0x7F || peer[10] < 3 {
+		return errors.New("peer does not speak ZMTP 3")
+	}
+	if string(bytes.TrimRight(peer[12:32], "\x00")) != "NULL" {
+		return errors.New("peer wants a security mechanism other than NULL")
+	}
+
+	ready := zmtpCommandBody("READY", zmtpProperty("Socket-Type", "PUB"))
+	if err := zmtpWriteFrame(conn, zmtpCommand, ready); err != nil {
+		return err
+	}
+
+	flags, body, err := zmtpReadFrame(conn)
+	if err != nil {
+		return err
+	}
+	name, props, err := zmtpParseCommand(body)
+	if err != nil || flags&zmtpCommand == 0 || name != "READY" {
+		return errors.New("peer did not send READY")
+	}
+	socketType, err := zmtpFindProperty(props, "Socket-Type")
+	if err != nil {
+		return err
+	}
+	if socketType != "SUB" && socketType != "XSUB" {
+		return fmt.Errorf("peer socket type %s cannot connect to PUB", socketType)
+	}
+	return nil
+}
+
+func zmtpProperty(name, value string) []byte {
+	prop := []byte{byte(len(name))}
+	prop = append(prop, name...)
+	prop = binary.BigEndian.AppendUint32(prop, uint32(len(value)))
+	return append(prop, value...)
+}
+
+func zmtpCommandBody(name string, data []byte) []byte {
+	body := []byte{byte(len(name))}
+	body = append(body, name...)
+	return append(body, data...)
+}
+
+func zmtpParseCommand(body []byte) (string, []byte, error) {
+	if len(body) == 0 || len(body) < 1+int(body[0]) {
+		return "", nil, errors.New("malformed ZMTP command")
+	}
+	n := int(body[0])
+	return string(body[1 : 1+n]), body[1+n:], nil
+}
+
+// zmtpFindProperty looks up a property of a READY command
+func zmtpFindProperty(props []byte, name string) (string, error) {
+	for len(props) > 0 {
+		n := int(props[0])
+		if len(props) < 1+n+4 {
+			break
+		}
+		key := string(props[1 : 1+n])
+		props = props[1+n:]
+		size := binary.BigEndian.Uint32(props)
+		props = props[4:]
+		if uint64(size) > uint64(len(props)) {
+			break
+		}
+		if strings.EqualFold(key, name) {
+			return string(props[:size]), nil
+		}
+		props = props[size:]
+	}
+	return "", fmt.Errorf("peer READY has no %s", name)
+}
+
+func zmtpWriteFrame(w io.Writer, flags byte, body []byte) error {
+	var header []byte
+	if len(body) > 255 {
+		header = binary.BigEndian.AppendUint64([]byte{flags | zmtpLong}, uint64(len(body)))
+	} else {
+		header = []byte{flags, byte(len(body))}
+	}
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(body)
+	return err
+}
+
+// zmtpWriteMessage writes a multipart message
+func zmtpWriteMessage(w io.Writer, parts [][]byte) error {
+	for i, part := range parts {
+		var flags byte
+		if i < len(parts)-1 {
+			flags = zmtpMore
+		}
+		if err := zmtpWriteFrame(w, flags, part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func zmtpReadFrame(r io.Reader) (byte, []byte, error) {
+	var header [9]byte
+	if _, err := io.ReadFull(r, header[:2]); err != nil {
+		return 0, nil, err
+	}
+	flags := header[0]
+	size := uint64(header[1])
+	if flags&zmtpLong != 0 {
+		if _, err := io.ReadFull(r, header[2:9]); err != nil {
+			return 0, nil, err
+		}
+		size = binary.BigEndian.Uint64(header[1:9])
+	}
+	if size > zmtpMaxInbound {
+		return 0, nil, errors.New("ZMTP frame too large")
+	}
+
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return flags, body, nil
+}
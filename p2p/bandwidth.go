@@ -0,0 +1,98 @@
+package p2p
+
+import (
+	"sort"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/metrics"
+)
+
+// bandwidthIdle is how long counters of a peer or protocol without
+// traffic are kept
+const bandwidthIdle = time.Hour
+
+// TrafficStats counts bytes sent and received
+type TrafficStats struct {
+	BytesIn  int64   `json:"bytes_in"`
+	BytesOut int64   `json:"bytes_out"`
+	RateIn   float64 `json:"rate_in"` // Bytes per second, recent average
+	RateOut  float64 `json:"rate_out"`
+}
+
+// PeerTraffic is the traffic exchanged with one peer
+type PeerTraffic struct {
+	ID        string `json:"id"`
+	Connected bool   `json:"connected"`
+	TrafficStats
+}
+
+// ProtocolTraffic is the traffic of one stream protocol, such as
+// gossipsub or block sync
+type ProtocolTraffic struct {
+	Protocol string `json:"protocol"`
+	TrafficStats
+}
+
+// BandwidthReport breaks down the node's P2P traffic. Peers and
+// protocols are sorted by total bytes, largest first.
+type BandwidthReport struct {
+	Total     TrafficStats      `json:"total"`
+	Peers     []PeerTraffic     `json:"peers"`
+	Protocols []ProtocolTraffic `json:"protocols"`
+}
+
+func trafficStats(s metrics.Stats) TrafficStats {
+	return TrafficStats{
+		BytesIn:  s.TotalIn,
+		BytesOut: s.TotalOut,
+		RateIn:   s.RateIn,
+		RateOut:  s.RateOut,
+	}
+}
+
+// Bandwidth reports traffic totals and per-peer and per-protocol
+// counters since the node started. Peers idle for an hour are dropped.
+func (n *Network) Bandwidth() *BandwidthReport {
+	report := &BandwidthReport{
+		Total:     trafficStats(n.bandwidth.GetBandwidthTotals()),
+		Peers:     make([]PeerTraffic, 0),
+		Protocols: make([]ProtocolTraffic, 0),
+	}
+
+	for p, stats := range n.bandwidth.GetBandwidthByPeer() {
+		report.Peers = append(report.Peers, PeerTraffic{
+			ID:           p.String(),
+			Connected:    len(n.host.Network().ConnsToPeer(p)) > 0,
+			TrafficStats: trafficStats(stats),
+		})
+	}
+	sort.Slice(report.Peers, func(i, j int) bool {
+		return report.Peers[i].total() > report.Peers[j].total()
+	})
+
+	for proto, stats := range n.bandwidth.GetBandwidthByProtocol() {
+		name := string(proto)
+		if name == "" {
+			name = "unknown" // Counted before protocol negotiation
+		}
+		report.Protocols = append(report.Protocols, ProtocolTraffic{
+			Protocol:     name,
+			TrafficStats: trafficStats(stats),
+		})
+	}
+	sort.Slice(report.Protocols, func(i, j int) bool {
+		return report.Protocols[i].total() > report.Protocols[j].total()
+	})
+
+	return report
+}
+
+func (s TrafficStats) total() int64 {
+	return s.BytesIn + s.BytesOut
+}
+
+// trimBandwidth forgets counters of peers and protocols idle for
+// bandwidthIdle
+func (n *Network) trimBandwidth() {
+	n.bandwidth.TrimIdle(time.Now().Add(-bandwidthIdle))
+}
@@ -0,0 +1,192 @@
+package p2p
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"blockchain/types"
+)
+
+const (
+	// BlocksProtocolID is the stream protocol used to download block
+	// ranges during sync
+	BlocksProtocolID = "/blockchain/blocks/1.0.0"
+
+	// HeadersProtocolID is the stream protocol used to download signed
+	// headers ahead of block bodies
+	HeadersProtocolID = "/blockchain/headers/1.0.0"
+
+	// MaxBlocksPerRequest and MaxHeadersPerRequest bound the blocks and
+	// headers served for one request
+	MaxBlocksPerRequest  = 128
+	MaxHeadersPerRequest = 512
+
+	// maxBlocksRequestSize and maxBlocksResponseSize bound the messages
+	maxBlocksRequestSize  = 256
+	maxBlocksResponseSize = 64 << 20
+
+	blocksServeTimeout = 30 * time.Second
+)
+
+// BlockProvider returns the local block at height
+type BlockProvider func(height uint64) (*types.Block, error)
+
+// blocksRequest asks for Count blocks from height From. A zero Count
+// only asks for the peer's height.
+type blocksRequest struct {
+	From  uint64 `json:"from"`
+	Count uint64 `json:"count"`
+}
+
+// blocksResponse carries the serving peer's height and the requested
+// blocks it has, in height order
+type blocksResponse struct {
+	Height uint64         `json:"height"`
+	Blocks []*types.Block `json:"blocks"`
+}
+
+// SetBlockProvider enables serving blocks to syncing peers
+func (n *Network) SetBlockProvider(provider BlockProvider) {
+	n.blockProvider = provider
+}
+
+// startBlockServer registers the block, header and filter range
+// handlers
+func (n *Network) startBlockServer() {
+	if n.blockProvider == nil {
+		return
+	}
+	n.host.SetStreamHandler(BlocksProtocolID, n.handleBlocksRequest)
+	n.host.SetStreamHandler(HeadersProtocolID, n.handleHeadersRequest)
+	n.host.SetStreamHandler(FiltersProtocolID, n.handleFiltersRequest)
+}
+
+// handleBlocksRequest serves a block range from local storage
+func (n *Network) handleBlocksRequest(s network.Stream) {
+	defer s.Close()
+	s.SetDeadline(time.Now().Add(blocksServeTimeout))
+
+	var req blocksRequest
+	if err := json.NewDecoder(io.LimitReader(s, maxBlocksRequestSize)).Decode(&req); err != nil {
+		s.Reset()
+		return
+	}
+	if req.Count > MaxBlocksPerRequest {
+		req.Count = MaxBlocksPerRequest
+	}
+
+	resp := blocksResponse{Blocks: make([]*types.Block, 0, req.Count)}
+	if n.status != nil {
+		resp.Height = n.status().Height
+	}
+
+	for height := req.From; height < req.From+req.Count; height++ {
+		block, err := n.blockProvider(height)
+		if err != nil {
+			break // Serve the prefix we have
+		}
+		resp.Blocks = append(resp.Blocks, block)
+	}
+
+	if err := json.NewEncoder(s).Encode(&resp); err != nil {
+		s.Reset()
+	}
+}
+
+// requestBlocks downloads up to count blocks from height from. It
+// returns the peer's reported height with the blocks.
+func (n *Network) requestBlocks(ctx context.Context, p peer.ID, from, count uint64) (*blocksResponse, error) {
+	s, err := n.host.NewStream(ctx, p, BlocksProtocolID)
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		s.SetDeadline(deadline)
+	}
+
+	if err := json.NewEncoder(s).Encode(&blocksRequest{From: from, Count: count}); err != nil {
+		s.Reset()
+		return nil, err
+	}
+
+	var resp blocksResponse
+	if err := json.NewDecoder(io.LimitReader(s, maxBlocksResponseSize)).Decode(&resp); err != nil {
+		s.Reset()
+		return nil, fmt.Errorf("bad blocks response: %w", err)
+	}
+
+	return &resp, nil
+}
+
+// headersResponse carries the serving peer's height and the requested
+// signed headers it has, in height order
+type headersResponse struct {
+	Height  uint64                `json:"height"`
+	Headers []*types.SignedHeader `json:"headers"`
+}
+
+// handleHeadersRequest serves a range of signed headers
+func (n *Network) handleHeadersRequest(s network.Stream) {
+	defer s.Close()
+	s.SetDeadline(time.Now().Add(blocksServeTimeout))
+
+	var req blocksRequest
+	if err := json.NewDecoder(io.LimitReader(s, maxBlocksRequestSize)).Decode(&req); err != nil {
+		s.Reset()
+		return
+	}
+	if req.Count > MaxHeadersPerRequest {
+		req.Count = MaxHeadersPerRequest
+	}
+
+	resp := headersResponse{Headers: make([]*types.SignedHeader, 0, req.Count)}
+	if n.status != nil {
+		resp.Height = n.status().Height
+	}
+
+	for height := req.From; height < req.From+req.Count; height++ {
+		block, err := n.blockProvider(height)
+		if err != nil {
+			break
+		}
+		resp.Headers = append(resp.Headers, block.SignedHeader())
+	}
+
+	if err := json.NewEncoder(s).Encode(&resp); err != nil {
+		s.Reset()
+	}
+}
+
+// requestHeaders downloads up to count signed headers from height from
+func (n *Network) requestHeaders(ctx context.Context, p peer.ID, from, count uint64) (*headersResponse, error) {
+	s, err := n.host.NewStream(ctx, p, HeadersProtocolID)
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		s.SetDeadline(deadline)
+	}
+
+	if err := json.NewEncoder(s).Encode(&blocksRequest{From: from, Count: count}); err != nil {
+		s.Reset()
+		return nil, err
+	}
+
+	var resp headersResponse
+	if err := json.NewDecoder(io.LimitReader(s, maxBlocksResponseSize)).Decode(&resp); err != nil {
+		s.Reset()
+		return nil, fmt.Errorf("bad headers response: %w", err)
+	}
+
+	return &resp, nil
+}
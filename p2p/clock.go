@@ -0,0 +1,31 @@
+package p2p
+
+import (
+	"sort"
+	"time"
+)
+
+// clockOffset returns how far a peer's clock, sent in Unix milliseconds
+// during the handshake, is ahead of ours. Transit time is ignored, so
+// offsets are accurate to about one network round trip.
+func clockOffset(remoteMillis int64) time.Duration {
+	return time.Duration(remoteMillis-time.Now().UnixMilli()) * time.Millisecond
+}
+
+// PeerClockOffset returns the median clock offset of connected peers
+// relative to the local clock, and the number of peers it is based on
+func (n *Network) PeerClockOffset() (time.Duration, int) {
+	n.peerMutex.RLock()
+	offsets := make([]time.Duration, 0, len(n.peerClock))
+	for _, offset := range n.peerClock {
+		offsets = append(offsets, offset)
+	}
+	n.peerMutex.RUnlock()
+
+	if len(offsets) == 0 {
+		return 0, 0
+	}
+
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	return offsets[len(offsets)/2], len(offsets)
+}
@@ -0,0 +1,335 @@
+package p2p
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"blockchain/types"
+)
+
+// Dandelion++ relay: a new transaction is first passed along a "stem" of
+// single peers over direct streams, then "fluffed" into gossip by a
+// random node along the way. Observers of the gossip layer see the
+// fluffing node rather than the sender.
+// NOTE: Phase 1 uses one stem peer per epoch for all transactions;
+// Dandelion++ proper keeps two and maps each inbound peer to one.
+
+const (
+	// StemProtocolID is the stream protocol used for stem relay
+	StemProtocolID = "/blockchain/stem/1.0.0"
+
+	// MaxStemMessageSize bounds a single stem message
+	MaxStemMessageSize = 1 << 20
+
+	// stemSeenTTL is how long relayed transactions are remembered so
+	// stem loops are not relayed again
+	stemSeenTTL = 10 * time.Minute
+)
+
+// DandelionConfig controls stem/fluff relay
+type DandelionConfig struct {
+	Enabled bool
+
+	// FluffProbability is the chance a stem node fluffs instead of
+	// forwarding along the stem
+	FluffProbability float64
+
+	// EmbargoTimeout is how long a stem node waits to see the
+	// transaction in gossip before fluffing it itself. A random
+	// extra of up to half the timeout is added per transaction.
+	EmbargoTimeout time.Duration
+
+	// EpochDuration is how often the stem peer is re-selected
+	EpochDuration time.Duration
+}
+
+// DefaultDandelionConfig returns the default relay settings
+func DefaultDandelionConfig() DandelionConfig {
+	return DandelionConfig{
+		Enabled:          true,
+		FluffProbability: 0.1,
+		EmbargoTimeout:   30 * time.Second,
+		EpochDuration:    10 * time.Minute,
+	}
+}
+
+// dandelion holds stem relay state
+type dandelion struct {
+	config DandelionConfig
+
+	mu         sync.Mutex
+	stemPeer   peer.ID
+	epochStart time.Time
+
+	// Embargo timers of transactions seen in the stem phase
+	embargoes map[types.Hash]*time.Timer
+
+	// When each stem transaction was first relayed
+	seen map[types.Hash]time.Time
+
+	// Refusals received from stem peers per code (see reject.go)
+	rejects map[types.RejectCode]uint64
+}
+
+// SetDandelionConfig configures stem/fluff relay. It must be called
+// before Start.
+func (n *Network) SetDandelionConfig(cfg DandelionConfig) {
+	n.dandelion.config = cfg
+}
+
+// RelayTransaction sends a locally created transaction into the stem
+// phase, falling back to gossip when no stem peer is available
+func (n *Network) RelayTransaction(tx *types.Transaction) error {
+	if !n.dandelion.config.Enabled {
+		return n.BroadcastTransaction(tx)
+	}
+
+	data, err := encodeTxMessage(tx)
+	if err != nil {
+		return err
+	}
+
+	// The originator also keeps an embargo in case the stem dies
+	n.setEmbargo(messageHash(data), data)
+
+	if err := n.stem(data); err != nil {
+		fmt.Printf("Stem relay failed, fluffing: %v\n", err)
+		return n.fluff(data)
+	}
+
+	return nil
+}
+
+// newDandelion creates relay state with the default settings
+func newDandelion() dandelion {
+	return dandelion{
+		config:    DefaultDandelionConfig(),
+		embargoes: make(map[types.Hash]*time.Timer),
+		seen:      make(map[types.Hash]time.Time),
+		rejects:   make(map[types.RejectCode]uint64),
+	}
+}
+
+// startStem registers the stem protocol handler
+func (n *Network) startStem() {
+	n.host.SetStreamHandler(StemProtocolID, n.handleStemStream)
+}
+
+// handleStemStream receives a transaction from the previous stem node.
+// The stream is closed once the transaction is validated, before it is
+// relayed on, so the sender does not wait for the rest of the stem.
+func (n *Network) handleStemStream(s network.Stream) {
+	data, err := io.ReadAll(io.LimitReader(s, MaxStemMessageSize+1))
+	if err != nil {
+		s.Reset()
+		return
+	}
+	if len(data) > MaxStemMessageSize {
+		s.Reset()
+		return
+	}
+
+	n.updatePeer(s.Conn().RemotePeer())
+
+	hash := messageHash(data)
+
+	// A transaction relayed before has looped back; its embargo timer
+	// will fluff it if needed
+	n.dandelion.mu.Lock()
+	_, seen := n.dandelion.seen[hash]
+	n.dandelion.mu.Unlock()
+	if seen {
+		s.Close()
+		return
+	}
+
+	// Validate before relaying so invalid transactions go nowhere, and
+	// tell the sender why
+	if n.txHandler != nil {
+		if err := n.txHandler(data); err != nil {
+			fmt.Printf("Error handling stem transaction: %v\n", err)
+			sendReject(s, data, err)
+			s.Close()
+			return
+		}
+	}
+	s.Close()
+
+	n.setEmbargo(hash, data)
+
+	if rand.Float64() < n.dandelion.config.FluffProbability {
+		n.fluff(data)
+		return
+	}
+
+	if err := n.stem(data); err != nil {
+		n.fluff(data)
+	}
+}
+
+// handleGossipTx ends the embargo of transactions seen in gossip before
+// passing them to the transaction handler
+func (n *Network) handleGossipTx(data []byte) error {
+	n.clearEmbargo(messageHash(data))
+
+	if n.txHandler == nil {
+		return nil
+	}
+	return n.txHandler(data)
+}
+
+// stem forwards a transaction message to the current stem peer and
+// waits for it to be validated. A refusal is noted but is no error: the
+// peer was reached, and relaying elsewhere would not change its answer.
+func (n *Network) stem(data []byte) error {
+	p, err := n.currentStemPeer()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(n.ctx, 10*time.Second)
+	defer cancel()
+
+	s, err := n.host.NewStream(ctx, p, StemProtocolID)
+	if err != nil {
+		n.resetStemPeer()
+		return err
+	}
+
+	if _, err := s.Write(data); err != nil {
+		s.Reset()
+		n.resetStemPeer()
+		return err
+	}
+	if err := s.CloseWrite(); err != nil {
+		s.Reset()
+		return err
+	}
+
+	// The transaction was delivered even if no reply comes in time
+	reject, err := readReject(s)
+	if err != nil {
+		s.Reset()
+		return nil
+	}
+	if reject != nil {
+		n.noteReject(p.String(), reject)
+	}
+	return s.Close()
+}
+
+// fluff publishes a transaction message to gossip. The publish time is
+// set here rather than by the originator, so it reveals nothing about
+// the stem.
+func (n *Network) fluff(data []byte) error {
+	n.clearEmbargo(messageHash(data))
+	return n.pubsub.Publish(n.topic(TxTopic), stampOrigin(data))
+}
+
+// currentStemPeer returns the stem peer of this epoch, choosing a new
+// random connected peer when the epoch ends or the peer is gone
+func (n *Network) currentStemPeer() (peer.ID, error) {
+	d := &n.dandelion
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.stemPeer != "" && time.Since(d.epochStart) < d.config.EpochDuration &&
+		n.host.Network().Connectedness(d.stemPeer) == network.Connected {
+		return d.stemPeer, nil
+	}
+
+	var peers []peer.ID
+	for _, p := range n.host.Network().Peers() {
+		if !n.isSeed(p) {
+			peers = append(peers, p)
+		}
+	}
+	if len(peers) == 0 {
+		return "", errors.New("no peers for stem relay")
+	}
+
+	d.stemPeer = peers[rand.Intn(len(peers))]
+	d.epochStart = time.Now()
+	return d.stemPeer, nil
+}
+
+// resetStemPeer forces a new stem peer on the next relay
+func (n *Network) resetStemPeer() {
+	n.dandelion.mu.Lock()
+	n.dandelion.stemPeer = ""
+	n.dandelion.mu.Unlock()
+}
+
+// setEmbargo fluffs a stem transaction if it is not seen in gossip in
+// time, and remembers it so it is relayed only once
+func (n *Network) setEmbargo(hash types.Hash, data []byte) {
+	d := &n.dandelion
+	timeout := d.config.EmbargoTimeout
+	if timeout > 0 {
+		timeout += time.Duration(rand.Int63n(int64(timeout)/2 + 1))
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	for h, at := range d.seen {
+		if now.Sub(at) > stemSeenTTL {
+			delete(d.seen, h)
+		}
+	}
+	d.seen[hash] = now
+
+	d.embargoes[hash] = time.AfterFunc(timeout, func() {
+		if n.ctx.Err() != nil {
+			return
+		}
+		fmt.Printf("Embargo expired, fluffing transaction\n")
+		n.fluff(data)
+	})
+}
+
+// clearEmbargo stops the embargo timer of a transaction
+func (n *Network) clearEmbargo(hash types.Hash) {
+	d := &n.dandelion
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if timer, exists := d.embargoes[hash]; exists {
+		timer.Stop()
+		delete(d.embargoes, hash)
+	}
+}
+
+// encodeTxMessage encodes a transaction as a gossip message
+func encodeTxMessage(tx *types.Transaction) ([]byte, error) {
+	data, err := json.Marshal(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(Message{
+		Type: "transaction",
+		Data: data,
+	})
+}
+
+// messageHash identifies a transaction message for embargo tracking.
+// The publish time is left out, since each fluffing node sets its own.
+func messageHash(data []byte) types.Hash {
+	var msg Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return sha256.Sum256(data)
+	}
+	return sha256.Sum256(append([]byte(msg.Type+"\x00"), msg.Data...))
+}
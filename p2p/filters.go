@@ -0,0 +1,88 @@
+package p2p
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"blockchain/types"
+)
+
+const (
+	// FiltersProtocolID is the stream protocol used by light clients to
+	// download compact block filters (see types.BlockFilter)
+	FiltersProtocolID = "/blockchain/filters/1.0.0"
+
+	// MaxFiltersPerRequest bounds the filters served for one request
+	MaxFiltersPerRequest = 1000
+)
+
+// FiltersResponse carries the serving peer's height and the requested
+// block filters it has, in height order
+type FiltersResponse struct {
+	Height  uint64               `json:"height"`
+	Filters []*types.BlockFilter `json:"filters"`
+}
+
+// handleFiltersRequest builds and serves the filters of a block range
+func (n *Network) handleFiltersRequest(s network.Stream) {
+	defer s.Close()
+	s.SetDeadline(time.Now().Add(blocksServeTimeout))
+
+	var req blocksRequest
+	if err := json.NewDecoder(io.LimitReader(s, maxBlocksRequestSize)).Decode(&req); err != nil {
+		s.Reset()
+		return
+	}
+	if req.Count > MaxFiltersPerRequest {
+		req.Count = MaxFiltersPerRequest
+	}
+
+	resp := FiltersResponse{Filters: make([]*types.BlockFilter, 0, req.Count)}
+	if n.status != nil {
+		resp.Height = n.status().Height
+	}
+
+	for height := req.From; height < req.From+req.Count; height++ {
+		block, err := n.blockProvider(height)
+		if err != nil {
+			break
+		}
+		resp.Filters = append(resp.Filters, types.BuildBlockFilter(block))
+	}
+
+	if err := json.NewEncoder(s).Encode(&resp); err != nil {
+		s.Reset()
+	}
+}
+
+// RequestFilters downloads up to count block filters from height from
+func (n *Network) RequestFilters(ctx context.Context, p peer.ID, from, count uint64) (*FiltersResponse, error) {
+	s, err := n.host.NewStream(ctx, p, FiltersProtocolID)
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		s.SetDeadline(deadline)
+	}
+
+	if err := json.NewEncoder(s).Encode(&blocksRequest{From: from, Count: count}); err != nil {
+		s.Reset()
+		return nil, err
+	}
+
+	var resp FiltersResponse
+	if err := json.NewDecoder(io.LimitReader(s, maxBlocksResponseSize)).Decode(&resp); err != nil {
+		s.Reset()
+		return nil, fmt.Errorf("bad filters response: %w", err)
+	}
+
+	return &resp, nil
+}
@@ -0,0 +1,194 @@
+package p2p
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+)
+
+// GossipConfig controls the GossipSub mesh and v1.1 peer scoring
+type GossipConfig struct {
+	// Mesh degree: target, low and high watermarks of peers per topic
+	D   int
+	Dlo int
+	Dhi int
+
+	HeartbeatInterval time.Duration
+
+	// PeerScoring enables GossipSub v1.1 scoring (see peerScoreParams).
+	// Peers below the thresholds are ignored for gossip, not published
+	// to, and finally graylisted (all their messages dropped).
+	PeerScoring       bool
+	GossipThreshold   float64
+	PublishThreshold  float64
+	GraylistThreshold float64
+	AcceptPXThreshold float64 // Score needed to accept peer exchange on prune
+}
+
+// DefaultGossipConfig returns the standard GossipSub mesh with scoring on
+func DefaultGossipConfig() GossipConfig {
+	return GossipConfig{
+		D:                 pubsub.GossipSubD,
+		Dlo:               pubsub.GossipSubDlo,
+		Dhi:               pubsub.GossipSubDhi,
+		HeartbeatInterval: pubsub.GossipSubHeartbeatInterval,
+		PeerScoring:       true,
+		GossipThreshold:   -500,
+		PublishThreshold:  -1000,
+		GraylistThreshold: -2500,
+		AcceptPXThreshold: 100,
+	}
+}
+
+// Validate checks the mesh degrees and threshold ordering
+func (c GossipConfig) Validate() error {
+	if c.D < 2 || c.Dlo < 1 || c.Dlo > c.D || c.D > c.Dhi {
+		return fmt.Errorf("gossip degrees must satisfy 1 <= Dlo <= D <= Dhi and D >= 2 (got %d/%d/%d)", c.Dlo, c.D, c.Dhi)
+	}
+	if c.HeartbeatInterval <= 0 {
+		return errors.New("gossip heartbeat interval must be positive")
+	}
+	if !c.PeerScoring {
+		return nil
+	}
+	if c.GossipThreshold > 0 || c.PublishThreshold > c.GossipThreshold || c.GraylistThreshold > c.PublishThreshold {
+		return errors.New("score thresholds must satisfy 0 >= gossip >= publish >= graylist")
+	}
+	if c.AcceptPXThreshold < 0 {
+		return errors.New("accept-PX threshold must not be negative")
+	}
+	return nil
+}
+
+// routerParams returns the GossipSub router parameters. Dout and
+// Dscore follow D so that any valid degrees are accepted.
+func (c GossipConfig) routerParams() pubsub.GossipSubParams {
+	params := pubsub.DefaultGossipSubParams()
+	params.D = c.D
+	params.Dlo = c.Dlo
+	params.Dhi = c.Dhi
+	params.HeartbeatInterval = c.HeartbeatInterval
+	params.Dout = min(params.Dout, c.Dlo-1, c.D/2-1)
+	params.Dscore = min(params.Dscore, c.Dhi)
+	return params
+}
+
+// thresholds returns the peer score thresholds
+func (c GossipConfig) thresholds() *pubsub.PeerScoreThresholds {
+	return &pubsub.PeerScoreThresholds{
+		GossipThreshold:             c.GossipThreshold,
+		PublishThreshold:            c.PublishThreshold,
+		GraylistThreshold:           c.GraylistThreshold,
+		AcceptPXThreshold:           c.AcceptPXThreshold,
+		OpportunisticGraftThreshold: 5,
+	}
+}
+
+// gossipOptions returns the pubsub options for a chain's gossip
+func gossipOptions(chainID string, cfg GossipConfig, bans *banList) []pubsub.Option {
+	opts := []pubsub.Option{
+		pubsub.WithSubscriptionFilter(topicFilter(chainID)),
+		pubsub.WithGossipSubParams(cfg.routerParams()),
+	}
+	if cfg.PeerScoring {
+		opts = append(opts, pubsub.WithPeerScore(peerScoreParams(chainID, bans), cfg.thresholds()))
+	}
+	return opts
+}
+
+// peerScoreParams scores peers per topic. Long-lived mesh peers that
+// deliver new blocks and votes first score highest. Transactions are
+// cheap to create, so first deliveries on the tx topic earn little
+// while malformed messages there cost as much as anywhere: a sybil
+// flooding transactions cannot outscore honest peers and is pruned from
+// the mesh. Banned peers are graylisted, and many peers from one IP are
+// penalized.
+func peerScoreParams(chainID string, bans *banList) *pubsub.PeerScoreParams {
+	return &pubsub.PeerScoreParams{
+		Topics: map[string]*pubsub.TopicScoreParams{
+			TopicName(chainID, BlockTopic):      topicScore(0.5, 50),
+			TopicName(chainID, ProposalTopic):   topicScore(0.5, 50),
+			TopicName(chainID, VoteTopic):       topicScore(0.3, 100),
+			TopicName(chainID, TxTopic):         topicScore(0.1, 10),
+			TopicName(chainID, TxAnnounceTopic): topicScore(0.1, 10),
+			TopicName(chainID, HeartbeatTopic):  topicScore(0.05, 5),
+			TopicName(chainID, StakingTopic):    topicScore(0.1, 10),
+		},
+		TopicScoreCap: 100,
+
+		AppSpecificScore: func(p peer.ID) float64 {
+			if bans.isBanned(p) {
+				return -10000
+			}
+			return 0
+		},
+		AppSpecificWeight: 1,
+
+		IPColocationFactorWeight:    -50,
+		IPColocationFactorThreshold: 5,
+
+		BehaviourPenaltyWeight:    -10,
+		BehaviourPenaltyThreshold: 6,
+		BehaviourPenaltyDecay:     pubsub.ScoreParameterDecay(time.Hour),
+
+		DecayInterval: pubsub.DefaultDecayInterval,
+		DecayToZero:   pubsub.DefaultDecayToZero,
+		RetainScore:   6 * time.Hour,
+	}
+}
+
+// topicScore returns the score function of one topic. weight scales the
+// topic against others; firstDeliveryCap bounds the reward for
+// forwarding new messages first. Invalid messages are penalized
+// quadratically on every topic.
+func topicScore(weight, firstDeliveryCap float64) *pubsub.TopicScoreParams {
+	return &pubsub.TopicScoreParams{
+		TopicWeight: weight,
+
+		TimeInMeshWeight:  0.01,
+		TimeInMeshQuantum: time.Minute,
+		TimeInMeshCap:     60, // An hour in the mesh
+
+		FirstMessageDeliveriesWeight: 1,
+		FirstMessageDeliveriesDecay:  pubsub.ScoreParameterDecay(time.Hour),
+		FirstMessageDeliveriesCap:    firstDeliveryCap,
+
+		InvalidMessageDeliveriesWeight: -1000 / weight, // Same penalty on every topic
+		InvalidMessageDeliveriesDecay:  pubsub.ScoreParameterDecay(time.Hour),
+	}
+}
+
+// registerValidators rejects gossip that is not a well-formed message
+// of the topic's type. Rejections count as invalid deliveries against
+// the forwarding peer's score.
+func (n *Network) registerValidators() error {
+	msgTypes := map[string]string{
+		BlockTopic:     "block",
+		ProposalTopic:  "proposal",
+		TxTopic:        "transaction",
+		VoteTopic:      "vote",
+		HeartbeatTopic: "heartbeat",
+		StakingTopic:   "staking",
+	}
+
+	for base, msgType := range msgTypes {
+		msgType := msgType
+		validate := func(_ context.Context, _ peer.ID, msg *pubsub.Message) pubsub.ValidationResult {
+			var m Message
+			if err := json.Unmarshal(msg.Data, &m); err != nil || m.Type != msgType || len(m.Data) == 0 {
+				return pubsub.ValidationReject
+			}
+			return pubsub.ValidationAccept
+		}
+		if err := n.pubsub.RegisterTopicValidator(n.topic(base), validate); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
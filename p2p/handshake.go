@@ -0,0 +1,177 @@
+package p2p
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const (
+	// HandshakeProtocolID is the stream protocol peers use to exchange
+	// their Status after connecting
+	HandshakeProtocolID = "/blockchain/handshake/1.0.0"
+
+	// maxStatusSize bounds a handshake message
+	maxStatusSize = 4096
+
+	handshakeTimeout = 10 * time.Second
+)
+
+// Status is what a node tells its peers about itself on connect
+type Status struct {
+	ChainID string `json:"chain_id"`
+
+	// GenesisHash is the canonical hash of the chain's genesis (see
+	// types.GenesisConfig.Hash), so networks sharing a chain ID are told
+	// apart. Older nodes leave it empty.
+	GenesisHash string `json:"genesis_hash,omitempty"`
+
+	// ProtocolVersion is the newest rule set the node implements,
+	// ActiveVersion the one in force at its current height
+	ProtocolVersion uint32 `json:"protocol_version"`
+	ActiveVersion   uint32 `json:"active_version"`
+	Height          uint64 `json:"height"`
+
+	// Time is the sender's clock in Unix milliseconds (0 if not sent)
+	Time int64 `json:"time,omitempty"`
+
+	// Seed nodes serve only peer exchange, not blocks or transactions
+	Seed bool `json:"seed,omitempty"`
+}
+
+// StatusFunc reports the local node's current status
+type StatusFunc func() Status
+
+// SetStatusFunc enables the handshake. Peers on another chain or unable
+// to follow the active protocol version are disconnected.
+func (n *Network) SetStatusFunc(status StatusFunc) {
+	n.status = status
+}
+
+// startHandshake registers the handshake handler and greets every peer
+// this node dials
+func (n *Network) startHandshake() {
+	if n.status == nil {
+		return
+	}
+
+	n.host.SetStreamHandler(HandshakeProtocolID, n.handleHandshake)
+	n.host.Network().Notify(&network.NotifyBundle{
+		ConnectedF: func(_ network.Network, c network.Conn) {
+			// The dialing side starts the exchange
+			if c.Stat().Direction == network.DirOutbound {
+				go n.handshake(c.RemotePeer())
+			}
+		},
+		DisconnectedF: func(net network.Network, c network.Conn) {
+			if len(net.ConnsToPeer(c.RemotePeer())) == 0 {
+				n.peerMutex.Lock()
+				delete(n.peerStatus, c.RemotePeer())
+				delete(n.peerClock, c.RemotePeer())
+				n.peerMutex.Unlock()
+			}
+		},
+	})
+
+	// Bootstrap peers were dialed before the handler was registered
+	for _, c := range n.host.Network().Conns() {
+		if c.Stat().Direction == network.DirOutbound {
+			go n.handshake(c.RemotePeer())
+		}
+	}
+}
+
+// handshake sends our status to a peer and checks the reply
+func (n *Network) handshake(p peer.ID) {
+	defer n.recoverPanic("handshake")
+	ctx, cancel := context.WithTimeout(n.ctx, handshakeTimeout)
+	defer cancel()
+
+	s, err := n.host.NewStream(ctx, p, HandshakeProtocolID)
+	if err != nil {
+		fmt.Printf("Handshake with %s failed: %v\n", p, err)
+		return
+	}
+	defer s.Close()
+	s.SetDeadline(time.Now().Add(handshakeTimeout))
+
+	if err := json.NewEncoder(s).Encode(n.status()); err != nil {
+		s.Reset()
+		return
+	}
+
+	var remote Status
+	if err := json.NewDecoder(io.LimitReader(s, maxStatusSize)).Decode(&remote); err != nil {
+		s.Reset()
+		return
+	}
+
+	n.acceptStatus(p, remote)
+}
+
+// handleHandshake answers a peer's handshake with our status
+func (n *Network) handleHandshake(s network.Stream) {
+	defer s.Close()
+	s.SetDeadline(time.Now().Add(handshakeTimeout))
+
+	var remote Status
+	if err := json.NewDecoder(io.LimitReader(s, maxStatusSize)).Decode(&remote); err != nil {
+		s.Reset()
+		return
+	}
+
+	if err := json.NewEncoder(s).Encode(n.status()); err != nil {
+		s.Reset()
+		return
+	}
+
+	n.acceptStatus(s.Conn().RemotePeer(), remote)
+}
+
+// acceptStatus records a peer's status, or disconnects the peer if it
+// cannot follow our chain
+func (n *Network) acceptStatus(p peer.ID, remote Status) {
+	if err := checkStatus(n.status(), remote); err != nil {
+		fmt.Printf("Disconnecting peer %s: %v\n", p, err)
+		n.host.Network().ClosePeer(p)
+		return
+	}
+
+	local := n.status()
+	if remote.ActiveVersion > local.ProtocolVersion {
+		fmt.Printf("Peer %s runs protocol version %d, this node supports %d; upgrade required\n", p, remote.ActiveVersion, local.ProtocolVersion)
+	}
+
+	n.peerMutex.Lock()
+	n.peerStatus[p] = remote
+	if remote.Time != 0 {
+		n.peerClock[p] = clockOffset(remote.Time)
+	}
+	n.peerMutex.Unlock()
+}
+
+// checkStatus reports why a peer cannot follow the local chain
+func checkStatus(local, remote Status) error {
+	if remote.ChainID != local.ChainID {
+		return fmt.Errorf("chain ID %q does not match %q", remote.ChainID, local.ChainID)
+	}
+	if remote.GenesisHash != "" && local.GenesisHash != "" && remote.GenesisHash != local.GenesisHash {
+		return fmt.Errorf("genesis hash %s does not match %s", remote.GenesisHash, local.GenesisHash)
+	}
+	if remote.ProtocolVersion < local.ActiveVersion {
+		return fmt.Errorf("protocol version %d is below active version %d", remote.ProtocolVersion, local.ActiveVersion)
+	}
+	return nil
+}
+
+// isSeed reports whether a peer announced itself as a seed node
+func (n *Network) isSeed(p peer.ID) bool {
+	n.peerMutex.RLock()
+	defer n.peerMutex.RUnlock()
+	return n.peerStatus[p].Seed
+}
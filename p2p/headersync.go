@@ -0,0 +1,117 @@
+package p2p
+
+import (
+	"fmt"
+
+	"blockchain/types"
+)
+
+// HeaderWindow bounds how far verified headers may run ahead of the
+// local chain
+const HeaderWindow = 8192
+
+// SetHeaderVerifier enables header-first sync: headers are downloaded
+// from one peer at a time, linked by hash and checked with verify, and
+// bodies are only requested for verified headers. Call before Start.
+func (sm *SyncManager) SetHeaderVerifier(verify HeaderVerifier) {
+	sm.verify = verify
+}
+
+// scheduleHeaders requests the next batch of headers (must hold lock)
+func (sm *SyncManager) scheduleHeaders(local uint64) {
+	for height := range sm.headers {
+		if height <= local {
+			delete(sm.headers, height)
+		}
+	}
+	if sm.headerTip < local {
+		sm.resetHeaders()
+	}
+
+	if sm.headerInflight || sm.headerTip >= local+HeaderWindow {
+		return
+	}
+
+	p, sp := sm.pickPeer(sm.headerTip + 1)
+	if sp == nil {
+		return
+	}
+
+	count := sp.best - sm.headerTip
+	if count > MaxHeadersPerRequest {
+		count = MaxHeadersPerRequest
+	}
+	sm.request(p, sp, blockRange{from: sm.headerTip + 1, count: count}, requestHeaders)
+}
+
+// resetHeaders drops all verified headers and restarts header sync from
+// the local tip (must hold lock)
+func (sm *SyncManager) resetHeaders() {
+	local := sm.height()
+
+	sm.headers = make(map[uint64]types.Hash)
+	sm.headerTip = local
+	sm.headerTipHash = types.Hash{}
+
+	// The genesis block is not stored, so block 1 is not linked
+	if local > 0 && sm.net.blockProvider != nil {
+		if block, err := sm.net.blockProvider(local); err == nil {
+			sm.headerTipHash = block.Header.Hash()
+		}
+	}
+}
+
+// handleHeaders verifies a batch of signed headers and extends the
+// verified header chain with them (must hold lock)
+func (sm *SyncManager) handleHeaders(res *rangeResult, sp *syncPeer) {
+	if res.err != nil {
+		sm.penalize(res.peer, sp, res.err)
+		return
+	}
+
+	// Headers were reset while the request was running
+	if res.r.from != sm.headerTip+1 {
+		return
+	}
+
+	headers := res.headers.Headers
+	if uint64(len(headers)) > res.r.count {
+		sm.penalize(res.peer, sp, fmt.Errorf("%w: %d headers served for a request of %d", ErrInvalidBlock, len(headers), res.r.count))
+		return
+	}
+
+	for i, sh := range headers {
+		height := res.r.from + uint64(i)
+
+		var err error
+		switch {
+		case sh == nil || sh.Header.Height != height:
+			err = fmt.Errorf("header %d of range from %d has the wrong height", i, res.r.from)
+		case sm.headerTipHash != (types.Hash{}) && sh.Header.PrevBlockHash != sm.headerTipHash:
+			err = fmt.Errorf("header %d does not link to header %d", height, height-1)
+		default:
+			if verr := sm.verify(sh); verr != nil {
+				err = fmt.Errorf("header %d: %v", height, verr)
+			}
+		}
+		if err != nil {
+			sm.penalize(res.peer, sp, fmt.Errorf("%w: %v", ErrInvalidBlock, err))
+			return
+		}
+
+		hash := sh.Header.Hash()
+		sm.headers[height] = hash
+		sm.headerTip = height
+		sm.headerTipHash = hash
+	}
+
+	sp.failures = 0
+	if res.headers.Height > sp.best {
+		sp.best = res.headers.Height
+	}
+
+	// A short response means the peer has no more headers yet
+	if got := uint64(len(headers)); got < res.r.count && sp.best >= res.r.from+got {
+		sp.best = res.r.from + got - 1
+	}
+}
@@ -0,0 +1,42 @@
+package p2p
+
+import (
+	"encoding/json"
+
+	"blockchain/types"
+)
+
+// HeartbeatTopic carries validator heartbeats
+const HeartbeatTopic = "heartbeats"
+
+// SetHeartbeatHandler sets the handler for heartbeat messages
+func (n *Network) SetHeartbeatHandler(handler MessageHandler) {
+	n.heartbeatHandler = handler
+}
+
+// startHeartbeats subscribes to validator heartbeats
+func (n *Network) startHeartbeats() error {
+	sub, err := n.pubsub.Subscribe(n.topic(HeartbeatTopic))
+	if err != nil {
+		return err
+	}
+	n.heartbeatSub = sub
+
+	go n.handleMessages(sub, ignoreSender(n.heartbeatHandler))
+	return nil
+}
+
+// BroadcastHeartbeat gossips a signed validator heartbeat
+func (n *Network) BroadcastHeartbeat(hb *types.Heartbeat) error {
+	data, err := json.Marshal(hb)
+	if err != nil {
+		return err
+	}
+
+	msg := Message{
+		Type: "heartbeat",
+		Data: data,
+	}
+
+	return n.publish(n.topic(HeartbeatTopic), msg)
+}
@@ -0,0 +1,198 @@
+package p2p
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Key derivation parameters of encrypted identity files
+const (
+	identityFileVersion = 1
+	identitySaltSize    = 16
+
+	identityScryptN = 1 << 15
+	identityScryptR = 8
+	identityScryptP = 1
+)
+
+// identityFile is the on-disk form of an encrypted libp2p key. The key
+// is sealed with XChaCha20-Poly1305 under a key derived from the
+// passphrase with scrypt; the peer ID is kept in the clear for operators.
+type identityFile struct {
+	Version    int    `json:"version"`
+	PeerID     string `json:"peer_id"`
+	Salt       string `json:"salt"`
+	Nonce      string `json:"nonce"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+// NewIdentity generates a libp2p private key that is kept nowhere, for
+// nodes that must not write to disk
+func NewIdentity() (crypto.PrivKey, error) {
+	key, _, err := crypto.GenerateEd25519Key(nil)
+	return key, err
+}
+
+// ImportIdentity encrypts the unencrypted libp2p key at plainPath, as
+// kept by older seed nodes, to path with passphrase and removes the
+// plain file, so the peer ID survives. It reports false if there is no
+// key at plainPath.
+func ImportIdentity(plainPath, path string, passphrase []byte) (bool, error) {
+	data, err := os.ReadFile(plainPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	key, err := crypto.UnmarshalPrivateKey(data)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", plainPath, err)
+	}
+	if _, err := os.Stat(path); err == nil {
+		return false, fmt.Errorf("both %s and %s exist", plainPath, path)
+	}
+
+	data, err = encryptIdentity(key, passphrase)
+	if err != nil {
+		return false, err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return false, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return false, err
+	}
+
+	return true, os.Remove(plainPath)
+}
+
+// LoadOrCreateEncryptedIdentity reads the libp2p private key encrypted
+// at path with passphrase. A new Ed25519 key is created if the file does
+// not exist, or replacing it when rotate is set; created reports which.
+func LoadOrCreateEncryptedIdentity(path string, passphrase []byte, rotate bool) (key crypto.PrivKey, created bool, err error) {
+	if !rotate {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			key, err := decryptIdentity(data, passphrase)
+			if err != nil {
+				return nil, false, fmt.Errorf("%s: %w", path, err)
+			}
+			return key, false, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, false, err
+		}
+	}
+
+	key, _, err = crypto.GenerateEd25519Key(nil)
+	if err != nil {
+		return nil, false, err
+	}
+	data, err := encryptIdentity(key, passphrase)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Replace any old key atomically, so a crash cannot leave neither
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return nil, false, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return nil, false, err
+	}
+
+	return key, true, nil
+}
+
+// encryptIdentity seals a libp2p key into an identity file
+func encryptIdentity(key crypto.PrivKey, passphrase []byte) ([]byte, error) {
+	id, err := peer.IDFromPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := crypto.MarshalPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, identitySaltSize)
+	nonce := make([]byte, chacha20poly1305.NonceSizeX)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	aead, err := identityCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(identityFile{
+		Version:    identityFileVersion,
+		PeerID:     id.String(),
+		Salt:       hex.EncodeToString(salt),
+		Nonce:      hex.EncodeToString(nonce),
+		Ciphertext: hex.EncodeToString(aead.Seal(nil, nonce, plain, nil)),
+	}, "", "  ")
+}
+
+// decryptIdentity opens an identity file
+func decryptIdentity(data, passphrase []byte) (crypto.PrivKey, error) {
+	var f identityFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("invalid identity file: %w", err)
+	}
+	if f.Version != identityFileVersion {
+		return nil, fmt.Errorf("unsupported identity file version %d", f.Version)
+	}
+
+	salt, err := hex.DecodeString(f.Salt)
+	if err != nil {
+		return nil, errors.New("invalid identity file salt")
+	}
+	nonce, err := hex.DecodeString(f.Nonce)
+	if err != nil || len(nonce) != chacha20poly1305.NonceSizeX {
+		return nil, errors.New("invalid identity file nonce")
+	}
+	sealed, err := hex.DecodeString(f.Ciphertext)
+	if err != nil {
+		return nil, errors.New("invalid identity file ciphertext")
+	}
+
+	aead, err := identityCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return nil, errors.New("wrong passphrase or corrupted identity file")
+	}
+
+	return crypto.UnmarshalPrivateKey(plain)
+}
+
+// identityCipher derives the identity file cipher from a passphrase
+func identityCipher(passphrase, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, salt, identityScryptN, identityScryptR, identityScryptP, chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, err
+	}
+	return chacha20poly1305.NewX(key)
+}
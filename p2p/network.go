@@ -4,11 +4,15 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 	
 	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/metrics"
 	"github.com/libp2p/go-libp2p/core/peer"
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
 	"github.com/multiformats/go-multiaddr"
@@ -18,7 +22,7 @@ import (
 
 const (
 	ProtocolID    = "/blockchain/1.0.0"
-	BlockTopic    = "blocks"
+	BlockTopic    = "blocks"       // Base topic names, namespaced by TopicName
 	TxTopic       = "transactions"
 	VoteTopic     = "votes"
 	MaxPeers      = 50
@@ -29,6 +33,9 @@ const (
 type Network struct {
 	host      host.Host
 	pubsub    *pubsub.PubSub
+	chainID   string // Namespaces gossip topics (see topics.go)
+	bandwidth *metrics.BandwidthCounter // See bandwidth.go
+	propagation *propagation            // See propagation.go
 	ctx       context.Context
 	cancel    context.CancelFunc
 	
@@ -38,56 +45,165 @@ type Network struct {
 	voteSub  *pubsub.Subscription
 	
 	// Message handlers
-	blockHandler MessageHandler
+	blockHandler PeerMessageHandler
 	txHandler    MessageHandler
 	voteHandler  MessageHandler
 	
+	// Validator heartbeats (see heartbeat.go)
+	heartbeatSub     *pubsub.Subscription
+	heartbeatHandler MessageHandler
+	
+	// Candidate blocks (see proposal.go)
+	proposalSub     *pubsub.Subscription
+	proposalHandler MessageHandler
+	
+	// Staking transactions (see staking.go)
+	stakingSub     *pubsub.Subscription
+	stakingHandler MessageHandler
+	
 	// Peer management
 	peers     map[peer.ID]time.Time
 	peerMutex sync.RWMutex
+	bans      *banList
+	
+	// Version handshake (see handshake.go)
+	status     StatusFunc
+	peerStatus map[peer.ID]Status
+	peerClock  map[peer.ID]time.Duration // Peer clock minus ours (see clock.go)
+	
+	// Stem/fluff transaction relay
+	dandelion dandelion
+	
+	// Batched transaction announcements (see txannounce.go)
+	txLookup      TxLookup
+	txAnnounceSub *pubsub.Subscription
+	
+	// Block range serving for syncing peers (see blocks.go)
+	blockProvider BlockProvider
+	
+	// State snapshot serving (see statesync.go)
+	stateProvider StateProvider
+	
+	// Discovery-only node without pubsub (see seed.go)
+	seed bool
+	
+	// Connections below which peer exchange finds more, 0 for MinPeers
+	// (see pex.go)
+	minPeers atomic.Int32
+	
+	// Told about panics recovered in handlers (see panic.go)
+	panicHandler PanicHandler
 }
 
 // MessageHandler processes incoming messages
 type MessageHandler func(data []byte) error
 
+// PeerMessageHandler processes incoming messages along with the ID of
+// the peer that forwarded them
+type PeerMessageHandler func(from string, data []byte) error
+
+// ignoreSender adapts a handler that does not need the forwarding peer
+func ignoreSender(handler MessageHandler) PeerMessageHandler {
+	if handler == nil {
+		return nil
+	}
+	return func(_ string, data []byte) error {
+		return handler(data)
+	}
+}
+
 // Message types
 type Message struct {
 	Type string          `json:"type"`
 	Data json.RawMessage `json:"data"`
+	
+	// Origin is the publish time in Unix milliseconds, rounded to
+	// OriginGranularity (see propagation.go)
+	Origin int64 `json:"origin,omitempty"`
 }
 
-// NewNetwork creates a new P2P network node
-func NewNetwork(listenPort int, bootstrapPeers []string) (*Network, error) {
+// NewNetwork creates a new P2P network node for one chain. A non-nil
+// proxy routes all outbound connections through SOCKS5. identity fixes
+// the peer ID; nil uses a fresh one.
+func NewNetwork(chainID string, listenPort int, bootstrapPeers []string, proxy *ProxyConfig, gossip GossipConfig, identity crypto.PrivKey) (*Network, error) {
+	if err := gossip.Validate(); err != nil {
+		return nil, err
+	}
+	
+	var extra []libp2p.Option
+	if identity != nil {
+		extra = append(extra, libp2p.Identity(identity))
+	}
+	
+	n, err := newNetwork(chainID, listenPort, proxy, extra...)
+	if err != nil {
+		return nil, err
+	}
+	
+	// Create pubsub instance
+	ps, err := pubsub.NewGossipSub(n.ctx, n.host, gossipOptions(chainID, gossip, n.bans)...)
+	if err != nil {
+		n.Close()
+		return nil, err
+	}
+	n.pubsub = ps
+	
+	n.connectBootstrap(bootstrapPeers)
+	
+	return n, nil
+}
+
+// newNetwork creates the libp2p host of a full or seed node
+func newNetwork(chainID string, listenPort int, proxy *ProxyConfig, extra ...libp2p.Option) (*Network, error) {
 	ctx, cancel := context.WithCancel(context.Background())
 	
-	// Create libp2p host
-	h, err := libp2p.New(
+	bans := newBanList()
+	bandwidth := metrics.NewBandwidthCounter()
+	
+	opts := []libp2p.Option{
 		libp2p.ListenAddrStrings(
 			fmt.Sprintf("/ip4/0.0.0.0/tcp/%d", listenPort),
 		),
-	)
-	if err != nil {
-		cancel()
-		return nil, err
+		libp2p.ConnectionGater(bans),
+		libp2p.BandwidthReporter(bandwidth),
 	}
+	opts = append(opts, extra...)
 	
-	// Create pubsub instance
-	ps, err := pubsub.NewGossipSub(ctx, h)
+	if proxy != nil {
+		proxyOpts, err := proxyOptions(proxy)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		opts = append(opts, proxyOpts...)
+	}
+	
+	// Create libp2p host
+	h, err := libp2p.New(opts...)
 	if err != nil {
 		cancel()
-		h.Close()
 		return nil, err
 	}
 	
 	n := &Network{
 		host:   h,
-		pubsub: ps,
+		chainID: chainID,
+		bandwidth: bandwidth,
+		propagation: newPropagation(),
 		ctx:    ctx,
 		cancel: cancel,
-		peers:  make(map[peer.ID]time.Time),
+		peers:     make(map[peer.ID]time.Time),
+		bans:      bans,
+		peerStatus: make(map[peer.ID]Status),
+		peerClock:  make(map[peer.ID]time.Duration),
+		dandelion: newDandelion(),
 	}
 	
-	// Connect to bootstrap peers (don't fail if connections fail)
+	return n, nil
+}
+
+// connectBootstrap dials the bootstrap peers (don't fail if connections fail)
+func (n *Network) connectBootstrap(bootstrapPeers []string) {
 	for _, addr := range bootstrapPeers {
 		if addr != "" {
 			if err := n.connectPeer(addr); err != nil {
@@ -97,35 +213,73 @@ func NewNetwork(listenPort int, bootstrapPeers []string) (*Network, error) {
 			}
 		}
 	}
-	
-	return n, nil
 }
 
 // Start starts the network services
 func (n *Network) Start() error {
+	// Reject malformed gossip before it is forwarded (see gossip.go)
+	if err := n.registerValidators(); err != nil {
+		return err
+	}
+	
 	// Subscribe to topics
-	blockSub, err := n.pubsub.Subscribe(BlockTopic)
+	blockSub, err := n.pubsub.Subscribe(n.topic(BlockTopic))
 	if err != nil {
 		return err
 	}
 	n.blockSub = blockSub
 	
-	txSub, err := n.pubsub.Subscribe(TxTopic)
+	txSub, err := n.pubsub.Subscribe(n.topic(TxTopic))
 	if err != nil {
 		return err
 	}
 	n.txSub = txSub
 	
-	voteSub, err := n.pubsub.Subscribe(VoteTopic)
+	voteSub, err := n.pubsub.Subscribe(n.topic(VoteTopic))
 	if err != nil {
 		return err
 	}
 	n.voteSub = voteSub
 	
+	// Block proposals, voted on before blocks are finalized
+	if err := n.startProposals(); err != nil {
+		return err
+	}
+	
+	// Validator online status (see heartbeat.go)
+	if err := n.startHeartbeats(); err != nil {
+		return err
+	}
+	
+	// Bonds, unbonds, commission changes and unjails (see staking.go)
+	if err := n.startStaking(); err != nil {
+		return err
+	}
+	
+	// Exchange chain ID and protocol version with peers
+	n.startHandshake()
+	
+	// Share peer addresses (see pex.go)
+	n.startPex()
+	
+	// Accept stem-phase transactions over direct streams
+	n.startStem()
+	
+	// Pull announced transaction batches from peers
+	if err := n.startTxAnnounce(); err != nil {
+		return err
+	}
+	
+	// Serve block ranges to syncing peers
+	n.startBlockServer()
+	
+	// Serve state snapshot chunks to peers using state sync
+	n.startStateServer()
+	
 	// Start message listeners
 	go n.handleMessages(blockSub, n.blockHandler)
-	go n.handleMessages(txSub, n.txHandler)
-	go n.handleMessages(voteSub, n.voteHandler)
+	go n.handleMessages(txSub, ignoreSender(n.handleGossipTx))
+	go n.handleMessages(voteSub, ignoreSender(n.voteHandler))
 	
 	// Start peer management
 	go n.managePeers()
@@ -133,8 +287,10 @@ func (n *Network) Start() error {
 	return nil
 }
 
-// SetBlockHandler sets the handler for block messages
-func (n *Network) SetBlockHandler(handler MessageHandler) {
+// SetBlockHandler sets the handler for finalized block messages. It is
+// told which peer forwarded each block, so it can penalize peers
+// sending blocks that do not connect.
+func (n *Network) SetBlockHandler(handler PeerMessageHandler) {
 	n.blockHandler = handler
 }
 
@@ -148,7 +304,8 @@ func (n *Network) SetVoteHandler(handler MessageHandler) {
 	n.voteHandler = handler
 }
 
-// BroadcastBlock broadcasts a block to the network
+// BroadcastBlock broadcasts a finalized block, with its certificate, to
+// the network
 func (n *Network) BroadcastBlock(block *types.Block) error {
 	data, err := json.Marshal(block)
 	if err != nil {
@@ -160,26 +317,22 @@ func (n *Network) BroadcastBlock(block *types.Block) error {
 		Data: data,
 	}
 	
-	return n.publish(BlockTopic, msg)
+	return n.publish(n.topic(BlockTopic), msg)
 }
 
-// BroadcastTransaction broadcasts a transaction to the network
+// BroadcastTransaction gossips a transaction to the network directly,
+// skipping the stem phase (see RelayTransaction)
 func (n *Network) BroadcastTransaction(tx *types.Transaction) error {
-	data, err := json.Marshal(tx)
+	data, err := encodeTxMessage(tx)
 	if err != nil {
 		return err
 	}
 	
-	msg := Message{
-		Type: "transaction",
-		Data: data,
-	}
-	
-	return n.publish(TxTopic, msg)
+	return n.fluff(data)
 }
 
 // BroadcastVote broadcasts a validator vote to the network
-func (n *Network) BroadcastVote(vote *types.ValidatorSignature) error {
+func (n *Network) BroadcastVote(vote *types.Vote) error {
 	data, err := json.Marshal(vote)
 	if err != nil {
 		return err
@@ -190,11 +343,13 @@ func (n *Network) BroadcastVote(vote *types.ValidatorSignature) error {
 		Data: data,
 	}
 	
-	return n.publish(VoteTopic, msg)
+	return n.publish(n.topic(VoteTopic), msg)
 }
 
 // publish publishes a message to a topic
 func (n *Network) publish(topic string, msg Message) error {
+	msg.Origin = originTime()
+	
 	data, err := json.Marshal(msg)
 	if err != nil {
 		return err
@@ -204,7 +359,7 @@ func (n *Network) publish(topic string, msg Message) error {
 }
 
 // handleMessages listens for messages on a subscription
-func (n *Network) handleMessages(sub *pubsub.Subscription, handler MessageHandler) {
+func (n *Network) handleMessages(sub *pubsub.Subscription, handler PeerMessageHandler) {
 	for {
 		msg, err := sub.Next(n.ctx)
 		if err != nil {
@@ -215,23 +370,32 @@ func (n *Network) handleMessages(sub *pubsub.Subscription, handler MessageHandle
 			continue
 		}
 		
-		// Skip messages from self
-		if msg.ReceivedFrom == n.host.ID() {
+		// Skip messages from self and banned peers
+		if msg.ReceivedFrom == n.host.ID() || n.bans.isBanned(msg.ReceivedFrom) {
 			continue
 		}
 		
 		// Update peer activity
 		n.updatePeer(msg.ReceivedFrom)
+		n.recordPropagation(msg)
 		
 		// Handle message
 		if handler != nil {
-			if err := handler(msg.Data); err != nil {
-				fmt.Printf("Error handling message: %v\n", err)
-			}
+			n.handleMessage(strings.TrimPrefix(sub.Topic(), n.topic("")), handler, msg)
 		}
 	}
 }
 
+// handleMessage passes one message to its handler. A handler that
+// panics loses the message, not the subscription.
+func (n *Network) handleMessage(topic string, handler PeerMessageHandler, msg *pubsub.Message) {
+	defer n.recoverPanic("gossip " + topic)
+	
+	if err := handler(msg.ReceivedFrom.String(), msg.Data); err != nil {
+		fmt.Printf("Error handling message: %v\n", err)
+	}
+}
+
 // connectPeer connects to a peer
 func (n *Network) connectPeer(addrStr string) error {
 	addr, err := multiaddr.NewMultiaddr(addrStr)
@@ -268,15 +432,25 @@ func (n *Network) updatePeer(p peer.ID) {
 	n.peers[p] = time.Now()
 }
 
-// managePeers periodically cleans up inactive peers
+// managePeers periodically cleans up inactive peers and finds new ones
 func (n *Network) managePeers() {
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
 	
+	discover := time.NewTicker(10 * time.Second)
+	defer discover.Stop()
+	
 	for {
 		select {
 		case <-ticker.C:
-			n.cleanupPeers()
+			// Seeds get no gossip to track activity by; their
+			// connection manager trims instead
+			if !n.seed {
+				n.cleanupPeers()
+			}
+			n.trimBandwidth()
+		case <-discover.C:
+			n.discoverPeers()
 		case <-n.ctx.Done():
 			return
 		}
@@ -305,6 +479,12 @@ func (n *Network) GetPeerCount() int {
 	return len(n.peers)
 }
 
+// GetConnectedPeerCount returns the number of peers with an open
+// connection, whether or not they have sent messages recently
+func (n *Network) GetConnectedPeerCount() int {
+	return len(n.host.Network().Peers())
+}
+
 // GetHostID returns this node's peer ID
 func (n *Network) GetHostID() peer.ID {
 	return n.host.ID()
@@ -0,0 +1,34 @@
+package p2p
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// PanicHandler is told about a panic recovered in a network goroutine:
+// the task that panicked, the panic value and the goroutine's stack
+type PanicHandler func(task string, value interface{}, stack []byte)
+
+// SetPanicHandler sets the function told about recovered panics. Without
+// one they are printed.
+func (n *Network) SetPanicHandler(handler PanicHandler) {
+	n.panicHandler = handler
+}
+
+// recoverPanic stops a panic in the calling goroutine from crashing the
+// node and reports it. It must be deferred directly.
+func (n *Network) recoverPanic(task string) {
+	if value := recover(); value != nil {
+		n.reportPanic(task, value)
+	}
+}
+
+// reportPanic passes a recovered panic to the panic handler
+func (n *Network) reportPanic(task string, value interface{}) {
+	stack := debug.Stack()
+	if n.panicHandler == nil {
+		fmt.Printf("Recovered panic in %s: %v\n%s", task, value, stack)
+		return
+	}
+	n.panicHandler(task, value, stack)
+}
@@ -0,0 +1,159 @@
+package p2p
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const (
+	// PexProtocolID is the stream protocol peers use to share addresses
+	// of other peers on the same chain
+	PexProtocolID = "/blockchain/pex/1.0.0"
+
+	// MaxPexPeers bounds the addresses returned for one request
+	MaxPexPeers = 32
+
+	// MinPeers is the connection count below which a node asks its peers
+	// for more
+	MinPeers = 8
+
+	// maxPexResponseSize bounds a peer exchange reply
+	maxPexResponseSize = 256 << 10
+
+	pexTimeout = 10 * time.Second
+)
+
+// startPex serves peer exchange requests
+func (n *Network) startPex() {
+	n.host.SetStreamHandler(PexProtocolID, n.handlePex)
+}
+
+// handlePex replies with a random sample of the peers that passed the
+// handshake, so only peers of our chain are handed out
+func (n *Network) handlePex(s network.Stream) {
+	defer s.Close()
+	s.SetDeadline(time.Now().Add(pexTimeout))
+
+	peers := n.pexPeers(s.Conn().RemotePeer())
+	if err := json.NewEncoder(s).Encode(peers); err != nil {
+		s.Reset()
+	}
+}
+
+// pexPeers returns up to MaxPexPeers handshaken peers with their listen
+// addresses learned through identify, leaving out exclude
+func (n *Network) pexPeers(exclude peer.ID) []peer.AddrInfo {
+	n.peerMutex.RLock()
+	ids := make([]peer.ID, 0, len(n.peerStatus))
+	for p := range n.peerStatus {
+		if p != exclude {
+			ids = append(ids, p)
+		}
+	}
+	n.peerMutex.RUnlock()
+
+	rand.Shuffle(len(ids), func(i, j int) { ids[i], ids[j] = ids[j], ids[i] })
+
+	peers := make([]peer.AddrInfo, 0, MaxPexPeers)
+	for _, p := range ids {
+		if len(peers) == MaxPexPeers {
+			break
+		}
+		if addrs := n.host.Peerstore().Addrs(p); len(addrs) > 0 {
+			peers = append(peers, peer.AddrInfo{ID: p, Addrs: addrs})
+		}
+	}
+	return peers
+}
+
+// requestPeers asks a peer for addresses of other peers
+func (n *Network) requestPeers(ctx context.Context, p peer.ID) ([]peer.AddrInfo, error) {
+	s, err := n.host.NewStream(ctx, p, PexProtocolID)
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		s.SetDeadline(deadline)
+	}
+
+	var peers []peer.AddrInfo
+	if err := json.NewDecoder(io.LimitReader(s, maxPexResponseSize)).Decode(&peers); err != nil {
+		s.Reset()
+		return nil, fmt.Errorf("bad peer exchange response: %w", err)
+	}
+	if len(peers) > MaxPexPeers {
+		peers = peers[:MaxPexPeers]
+	}
+
+	return peers, nil
+}
+
+// SetMinPeers sets the connection count below which the node asks its
+// peers for more. It may be changed while the network runs.
+func (n *Network) SetMinPeers(count int) {
+	n.minPeers.Store(int32(count))
+}
+
+// discoverPeers tops up connections from a random handshaken peer's
+// peer list when there are fewer than the target
+func (n *Network) discoverPeers() {
+	target := MinPeers
+	if count := n.minPeers.Load(); count > 0 {
+		target = int(count)
+	}
+	if n.seed {
+		target = SeedMinPeers
+	}
+
+	want := target - n.GetConnectedPeerCount()
+	if want <= 0 {
+		return
+	}
+
+	n.peerMutex.RLock()
+	sources := make([]peer.ID, 0, len(n.peerStatus))
+	for p := range n.peerStatus {
+		sources = append(sources, p)
+	}
+	n.peerMutex.RUnlock()
+	if len(sources) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(n.ctx, pexTimeout)
+	defer cancel()
+
+	peers, err := n.requestPeers(ctx, sources[rand.Intn(len(sources))])
+	if err != nil {
+		return // Seeds and older nodes may not serve peer exchange
+	}
+
+	for _, info := range peers {
+		if want == 0 {
+			break
+		}
+		if info.ID == n.host.ID() || n.bans.isBanned(info.ID) ||
+			n.host.Network().Connectedness(info.ID) == network.Connected {
+			continue
+		}
+		want--
+
+		// The handshake runs on connect and drops peers of other chains
+		go func(info peer.AddrInfo) {
+			ctx, cancel := context.WithTimeout(n.ctx, pexTimeout)
+			defer cancel()
+			if err := n.host.Connect(ctx, info); err == nil {
+				n.updatePeer(info.ID)
+			}
+		}(info)
+	}
+}
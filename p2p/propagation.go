@@ -0,0 +1,175 @@
+package p2p
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+)
+
+// OriginGranularity is the resolution of the publish time carried in
+// gossip envelopes. Coarse times are enough to tune the network without
+// fingerprinting the publisher's clock.
+const OriginGranularity = 100 * time.Millisecond
+
+// PropagationBuckets are the upper bounds, in seconds, of the
+// propagation latency histogram
+var PropagationBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// propagationSamples is how many recent latencies per topic the
+// percentiles are computed from
+const propagationSamples = 1024
+
+// PropagationStats describes how fast one topic's messages reach this
+// node: the time from publication to receipt, corrected by the
+// publisher's clock offset when it is a connected peer.
+// GossipSub forwards signed messages unchanged, so relays cannot count
+// hops in the envelope; Direct and Relayed tell whether a message came
+// straight from its publisher or through other peers.
+type PropagationStats struct {
+	Topic   string   `json:"topic"`
+	Count   uint64   `json:"count"`
+	Sum     float64  `json:"sum"`     // Seconds
+	Buckets []uint64 `json:"buckets"` // Cumulative counts per PropagationBuckets bound
+	P50     float64  `json:"p50"`     // Seconds, over recent messages
+	P95     float64  `json:"p95"`
+	Direct  uint64   `json:"direct"`
+	Relayed uint64   `json:"relayed"`
+}
+
+// propagation collects latencies per base topic
+type propagation struct {
+	mu     sync.Mutex
+	topics map[string]*topicPropagation
+}
+
+type topicPropagation struct {
+	count, direct, relayed uint64
+	sum                    float64
+	buckets                []uint64 // Per bucket, the last one unbounded
+	recent                 []float64
+	next                   int
+}
+
+func newPropagation() *propagation {
+	return &propagation{topics: make(map[string]*topicPropagation)}
+}
+
+// record adds one latency in seconds
+func (p *propagation) record(topic string, latency float64, direct bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	t, ok := p.topics[topic]
+	if !ok {
+		t = &topicPropagation{
+			buckets: make([]uint64, len(PropagationBuckets)+1),
+			recent:  make([]float64, 0, propagationSamples),
+		}
+		p.topics[topic] = t
+	}
+
+	t.count++
+	t.sum += latency
+	t.buckets[sort.SearchFloat64s(PropagationBuckets, latency)]++
+	if direct {
+		t.direct++
+	} else {
+		t.relayed++
+	}
+
+	if len(t.recent) < propagationSamples {
+		t.recent = append(t.recent, latency)
+	} else {
+		t.recent[t.next] = latency
+		t.next = (t.next + 1) % propagationSamples
+	}
+}
+
+// Propagation returns latency statistics per gossip topic, sorted by
+// topic
+func (n *Network) Propagation() []PropagationStats {
+	p := n.propagation
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := make([]PropagationStats, 0, len(p.topics))
+	for topic, t := range p.topics {
+		s := PropagationStats{
+			Topic:   topic,
+			Count:   t.count,
+			Sum:     t.sum,
+			Buckets: make([]uint64, len(PropagationBuckets)),
+			Direct:  t.direct,
+			Relayed: t.relayed,
+		}
+
+		var cumulative uint64
+		for i := range PropagationBuckets {
+			cumulative += t.buckets[i]
+			s.Buckets[i] = cumulative
+		}
+
+		recent := append([]float64(nil), t.recent...)
+		sort.Float64s(recent)
+		if len(recent) > 0 {
+			s.P50 = recent[len(recent)*50/100]
+			s.P95 = recent[len(recent)*95/100]
+		}
+
+		stats = append(stats, s)
+	}
+
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Topic < stats[j].Topic })
+	return stats
+}
+
+// originTime returns the coarse publish time for an envelope. Rounding
+// keeps the error unbiased, so averages stay accurate.
+func originTime() int64 {
+	return time.Now().Round(OriginGranularity).UnixMilli()
+}
+
+// stampOrigin sets the publish time of an encoded envelope. Messages
+// that do not decode are returned unchanged.
+func stampOrigin(data []byte) []byte {
+	var msg Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return data
+	}
+	msg.Origin = originTime()
+
+	stamped, err := json.Marshal(msg)
+	if err != nil {
+		return data
+	}
+	return stamped
+}
+
+// recordPropagation notes the latency of a received gossip message.
+// Messages without a publish time, from older nodes, are skipped.
+func (n *Network) recordPropagation(msg *pubsub.Message) {
+	var envelope struct {
+		Origin int64 `json:"origin"`
+	}
+	if err := json.Unmarshal(msg.Data, &envelope); err != nil || envelope.Origin == 0 {
+		return
+	}
+
+	// Move the publish time onto our clock if we know the publisher's
+	sent := time.UnixMilli(envelope.Origin)
+	author := msg.GetFrom()
+	n.peerMutex.RLock()
+	offset, known := n.peerClock[author]
+	n.peerMutex.RUnlock()
+	if known {
+		sent = sent.Add(-offset)
+	}
+
+	latency := max(time.Since(sent), 0)
+	topic := strings.TrimPrefix(msg.GetTopic(), n.topic(""))
+	n.propagation.record(topic, latency.Seconds(), msg.ReceivedFrom == author)
+}
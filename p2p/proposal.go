@@ -0,0 +1,43 @@
+package p2p
+
+import (
+	"encoding/json"
+
+	"blockchain/types"
+)
+
+// ProposalTopic carries candidate blocks before they have votes. The
+// block topic only carries finalized blocks with their certificate.
+const ProposalTopic = "proposals"
+
+// SetProposalHandler sets the handler for block proposals
+func (n *Network) SetProposalHandler(handler MessageHandler) {
+	n.proposalHandler = handler
+}
+
+// startProposals subscribes to block proposals
+func (n *Network) startProposals() error {
+	sub, err := n.pubsub.Subscribe(n.topic(ProposalTopic))
+	if err != nil {
+		return err
+	}
+	n.proposalSub = sub
+
+	go n.handleMessages(sub, ignoreSender(n.proposalHandler))
+	return nil
+}
+
+// BroadcastProposal gossips a candidate block for validators to vote on
+func (n *Network) BroadcastProposal(proposal *types.Proposal) error {
+	data, err := json.Marshal(proposal)
+	if err != nil {
+		return err
+	}
+
+	msg := Message{
+		Type: "proposal",
+		Data: data,
+	}
+
+	return n.publish(n.topic(ProposalTopic), msg)
+}
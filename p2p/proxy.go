@@ -0,0 +1,151 @@
+package p2p
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/transport"
+	"github.com/libp2p/go-libp2p/p2p/transport/tcp"
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+	"golang.org/x/net/proxy"
+)
+
+// ProxyConfig routes outbound P2P connections through a SOCKS5 proxy
+// such as Tor
+// NOTE: /dns peer addresses are still resolved locally by libp2p; use
+// IP or /onion3 addresses to avoid DNS leaks
+type ProxyConfig struct {
+	// Addr is the SOCKS5 proxy address (host:port)
+	Addr string
+
+	// NoAdvertise hides this node's listen addresses from peers
+	NoAdvertise bool
+}
+
+// proxyOptions returns libp2p options that send every outbound
+// connection through the proxy. Only TCP and onion transports are
+// enabled, since UDP-based transports cannot be proxied.
+func proxyOptions(cfg *ProxyConfig) ([]libp2p.Option, error) {
+	dialer, err := proxy.SOCKS5("tcp", cfg.Addr, nil, proxy.Direct)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy: %w", err)
+	}
+	ctxDialer, ok := dialer.(proxy.ContextDialer)
+	if !ok {
+		return nil, errors.New("proxy dialer does not support contexts")
+	}
+
+	opts := []libp2p.Option{
+		libp2p.NoTransports,
+		libp2p.Transport(tcp.NewTCPTransport, tcp.WithDialerForAddr(
+			func(multiaddr.Multiaddr) (tcp.ContextDialer, error) {
+				return ctxDialer, nil
+			},
+		)),
+		libp2p.Transport(func(upgrader transport.Upgrader, rcmgr network.ResourceManager) (*onionTransport, error) {
+			return &onionTransport{upgrader: upgrader, rcmgr: rcmgr, dialer: ctxDialer}, nil
+		}),
+	}
+
+	if cfg.NoAdvertise {
+		opts = append(opts, libp2p.AddrsFactory(func([]multiaddr.Multiaddr) []multiaddr.Multiaddr {
+			return nil
+		}))
+	}
+
+	return opts, nil
+}
+
+// onionTransport dials /onion3 addresses through a SOCKS5 proxy. It
+// cannot listen; onion services are configured in Tor and forward to
+// the node's TCP listener.
+type onionTransport struct {
+	upgrader transport.Upgrader
+	rcmgr    network.ResourceManager
+	dialer   proxy.ContextDialer
+}
+
+// Dial implements transport.Transport
+func (t *onionTransport) Dial(ctx context.Context, raddr multiaddr.Multiaddr, p peer.ID) (transport.CapableConn, error) {
+	target, err := onionTarget(raddr)
+	if err != nil {
+		return nil, err
+	}
+
+	scope, err := t.rcmgr.OpenConnection(network.DirOutbound, true, raddr)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := t.dialer.DialContext(ctx, "tcp", target)
+	if err != nil {
+		scope.Done()
+		return nil, err
+	}
+
+	local, err := manet.FromNetAddr(conn.LocalAddr())
+	if err != nil {
+		local = multiaddr.StringCast("/ip4/127.0.0.1/tcp/0")
+	}
+
+	c, err := t.upgrader.Upgrade(ctx, t, &onionConn{Conn: conn, local: local, remote: raddr}, network.DirOutbound, p, scope)
+	if err != nil {
+		scope.Done()
+		return nil, err
+	}
+	return c, nil
+}
+
+// CanDial implements transport.Transport
+func (t *onionTransport) CanDial(addr multiaddr.Multiaddr) bool {
+	_, err := onionTarget(addr)
+	return err == nil
+}
+
+// Listen implements transport.Transport
+func (t *onionTransport) Listen(multiaddr.Multiaddr) (transport.Listener, error) {
+	return nil, errors.New("onion transport cannot listen; configure an onion service in Tor")
+}
+
+// Protocols implements transport.Transport
+func (t *onionTransport) Protocols() []int {
+	return []int{multiaddr.P_ONION3}
+}
+
+// Proxy implements transport.Transport
+func (t *onionTransport) Proxy() bool {
+	return false
+}
+
+// onionTarget converts /onion3/<id>:<port> into a "<id>.onion:<port>"
+// dial target
+func onionTarget(addr multiaddr.Multiaddr) (string, error) {
+	value, err := addr.ValueForProtocol(multiaddr.P_ONION3)
+	if err != nil {
+		return "", err
+	}
+
+	parts := strings.Split(value, ":")
+	if len(parts) != 2 {
+		return "", fmt.Errorf("invalid onion3 address: %s", value)
+	}
+
+	return net.JoinHostPort(strings.ToLower(parts[0])+".onion", parts[1]), nil
+}
+
+// onionConn attaches multiaddrs to a proxied connection
+type onionConn struct {
+	net.Conn
+	local  multiaddr.Multiaddr
+	remote multiaddr.Multiaddr
+}
+
+func (c *onionConn) LocalMultiaddr() multiaddr.Multiaddr  { return c.local }
+func (c *onionConn) RemoteMultiaddr() multiaddr.Multiaddr { return c.remote }
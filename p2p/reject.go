@@ -0,0 +1,113 @@
+package p2p
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+
+	"blockchain/types"
+)
+
+// A stem node validates a transaction before relaying it. One it refuses
+// is answered with a RejectMessage on the stem stream, so the sender
+// learns why; accepted ones get no reply. Older peers close the stream
+// without reading replies or sending any.
+
+const (
+	// maxRejectSize bounds a reject reply
+	maxRejectSize = 1024
+
+	// maxRejectReason bounds the reason given in a reject reply
+	maxRejectReason = 256
+
+	// stemReplyTimeout is how long a stem sender waits for the receiver
+	// to validate the transaction
+	stemReplyTimeout = 5 * time.Second
+)
+
+// RejectMessage tells a stem sender why a transaction was refused
+type RejectMessage struct {
+	Type   string           `json:"type"` // "reject"
+	Hash   types.Hash       `json:"hash"`
+	Code   types.RejectCode `json:"code"`
+	Reason string           `json:"reason"`
+}
+
+// RejectCount is the number of refusals received from stem peers under
+// one code
+type RejectCount struct {
+	Code  types.RejectCode
+	Count uint64
+}
+
+// StemRejects returns the refusals received from stem peers since start
+// per code, sorted by code
+func (n *Network) StemRejects() []RejectCount {
+	d := &n.dandelion
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	counts := make([]RejectCount, 0, len(d.rejects))
+	for code, count := range d.rejects {
+		counts = append(counts, RejectCount{Code: code, Count: count})
+	}
+	sort.Slice(counts, func(i, j int) bool { return counts[i].Code < counts[j].Code })
+	return counts
+}
+
+// sendReject answers a stem message the transaction handler refused
+func sendReject(s network.Stream, data []byte, err error) {
+	reject := RejectMessage{
+		Type:   "reject",
+		Code:   types.RejectCodeOf(err),
+		Reason: err.Error(),
+	}
+	if len(reject.Reason) > maxRejectReason {
+		reject.Reason = reject.Reason[:maxRejectReason]
+	}
+	var msg Message
+	var tx types.Transaction
+	if json.Unmarshal(data, &msg) == nil && json.Unmarshal(msg.Data, &tx) == nil {
+		reject.Hash = tx.Hash()
+	}
+
+	reply, err := json.Marshal(reject)
+	if err != nil {
+		return
+	}
+	s.SetWriteDeadline(time.Now().Add(stemReplyTimeout))
+	s.Write(reply)
+}
+
+// readReject waits for the stem peer's reply to a transaction, returning
+// nil when it was accepted
+func readReject(s network.Stream) (*RejectMessage, error) {
+	s.SetReadDeadline(time.Now().Add(stemReplyTimeout))
+	data, err := io.ReadAll(io.LimitReader(s, maxRejectSize))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	var reject RejectMessage
+	if err := json.Unmarshal(data, &reject); err != nil || reject.Type != "reject" {
+		return nil, errors.New("invalid stem reply")
+	}
+	return &reject, nil
+}
+
+// noteReject records a refusal received from a stem peer
+func (n *Network) noteReject(from string, reject *RejectMessage) {
+	n.dandelion.mu.Lock()
+	n.dandelion.rejects[reject.Code]++
+	n.dandelion.mu.Unlock()
+
+	fmt.Printf("Stem peer %s rejected transaction %s (%s): %s\n", from, reject.Hash, reject.Code, reject.Reason)
+}
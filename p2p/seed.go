@@ -0,0 +1,54 @@
+package p2p
+
+import (
+	"errors"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/p2p/net/connmgr"
+)
+
+// Connection watermarks of a seed node. Above SeedMaxPeers the oldest
+// idle connections are closed down to SeedMinPeers.
+const (
+	SeedMinPeers = 100
+	SeedMaxPeers = 400
+
+	seedGracePeriod = time.Minute
+)
+
+// NewSeedNetwork creates a discovery-only node for one chain. It joins
+// no gossip topics and serves only the handshake and peer exchange, so
+// new nodes can find peers through it. identity fixes the peer ID that
+// bootstrap addresses refer to.
+func NewSeedNetwork(chainID string, listenPort int, bootstrapPeers []string, proxy *ProxyConfig, identity crypto.PrivKey) (*Network, error) {
+	cm, err := connmgr.NewConnManager(SeedMinPeers, SeedMaxPeers, connmgr.WithGracePeriod(seedGracePeriod))
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := newNetwork(chainID, listenPort, proxy, libp2p.Identity(identity), libp2p.ConnectionManager(cm))
+	if err != nil {
+		return nil, err
+	}
+	n.seed = true
+
+	n.connectBootstrap(bootstrapPeers)
+
+	return n, nil
+}
+
+// StartSeed starts the services of a seed node
+func (n *Network) StartSeed() error {
+	if !n.seed {
+		return errors.New("not a seed network")
+	}
+
+	n.startHandshake()
+	n.startPex()
+
+	go n.managePeers()
+
+	return nil
+}
@@ -0,0 +1,42 @@
+package p2p
+
+import (
+	"encoding/json"
+
+	"blockchain/types"
+)
+
+// StakingTopic carries staking transactions on their way to a proposer
+const StakingTopic = "staking"
+
+// SetStakingHandler sets the handler for staking transaction messages
+func (n *Network) SetStakingHandler(handler MessageHandler) {
+	n.stakingHandler = handler
+}
+
+// startStaking subscribes to staking transactions
+func (n *Network) startStaking() error {
+	sub, err := n.pubsub.Subscribe(n.topic(StakingTopic))
+	if err != nil {
+		return err
+	}
+	n.stakingSub = sub
+
+	go n.handleMessages(sub, ignoreSender(n.stakingHandler))
+	return nil
+}
+
+// BroadcastStakingTx gossips a signed staking transaction
+func (n *Network) BroadcastStakingTx(stx *types.StakingTx) error {
+	data, err := json.Marshal(stx)
+	if err != nil {
+		return err
+	}
+
+	msg := Message{
+		Type: "staking",
+		Data: data,
+	}
+
+	return n.publish(n.topic(StakingTopic), msg)
+}
@@ -0,0 +1,394 @@
+package p2p
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"blockchain/types"
+)
+
+// StateProtocolID is the stream protocol used to download state
+// snapshot chunks
+const StateProtocolID = "/blockchain/state/1.0.0"
+
+// ErrNoStateSnapshot is returned when no peer offers a snapshot far
+// enough ahead of the local chain
+var ErrNoStateSnapshot = errors.New("no usable state snapshot offered by peers")
+
+// StateProvider returns the snapshot offered to syncing peers, or nil
+type StateProvider func() *types.ChunkedState
+
+// StateSyncConfig tunes state sync
+type StateSyncConfig struct {
+	MinLag         uint64        // Only state sync when this many blocks behind
+	Workers        int           // Chunks downloaded in parallel
+	RequestTimeout time.Duration // Per manifest, header or chunk request
+	BanDuration    time.Duration // Ban for peers serving invalid chunks
+}
+
+// DefaultStateSyncConfig returns the default state sync tuning
+func DefaultStateSyncConfig() StateSyncConfig {
+	return StateSyncConfig{
+		MinLag:         1000,
+		Workers:        4,
+		RequestTimeout: 20 * time.Second,
+		BanDuration:    time.Hour,
+	}
+}
+
+// SyncedState is a verified snapshot with the block at its height, which
+// becomes the parent of the blocks replayed afterwards
+type SyncedState struct {
+	Snapshot *types.StateSnapshot
+	Anchor   *types.Block
+}
+
+// stateRequest asks for the offered manifest, or for one chunk of the
+// snapshot at Height
+type stateRequest struct {
+	Manifest bool   `json:"manifest,omitempty"`
+	Height   uint64 `json:"height,omitempty"`
+	Index    uint32 `json:"index,omitempty"`
+}
+
+// stateResponse carries a manifest, or a chunk with its Merkle proof.
+// Both are empty when the snapshot is not offered.
+type stateResponse struct {
+	Manifest *types.StateManifest `json:"manifest,omitempty"`
+	Chunk    *types.StateChunk    `json:"chunk,omitempty"`
+	Proof    []types.Hash         `json:"proof,omitempty"`
+}
+
+// SetStateProvider enables serving state snapshots to syncing peers
+func (n *Network) SetStateProvider(provider StateProvider) {
+	n.stateProvider = provider
+}
+
+// startStateServer registers the state chunk handler
+func (n *Network) startStateServer() {
+	if n.stateProvider == nil {
+		return
+	}
+	n.host.SetStreamHandler(StateProtocolID, n.handleStateRequest)
+}
+
+// handleStateRequest serves the manifest or one chunk of the offered
+// snapshot
+func (n *Network) handleStateRequest(s network.Stream) {
+	defer s.Close()
+	s.SetDeadline(time.Now().Add(blocksServeTimeout))
+
+	var req stateRequest
+	if err := json.NewDecoder(io.LimitReader(s, maxBlocksRequestSize)).Decode(&req); err != nil {
+		s.Reset()
+		return
+	}
+
+	var resp stateResponse
+	if cs := n.stateProvider(); cs != nil {
+		switch {
+		case req.Manifest:
+			resp.Manifest = &cs.Manifest
+		case req.Height == cs.Manifest.Height && req.Index < cs.Manifest.Chunks:
+			resp.Chunk = cs.Chunks[req.Index]
+			resp.Proof = cs.Proof(req.Index)
+		}
+	}
+
+	if err := json.NewEncoder(s).Encode(&resp); err != nil {
+		s.Reset()
+	}
+}
+
+// requestState sends one state request to a peer
+func (n *Network) requestState(ctx context.Context, p peer.ID, req *stateRequest) (*stateResponse, error) {
+	s, err := n.host.NewStream(ctx, p, StateProtocolID)
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		s.SetDeadline(deadline)
+	}
+
+	if err := json.NewEncoder(s).Encode(req); err != nil {
+		s.Reset()
+		return nil, err
+	}
+
+	var resp stateResponse
+	if err := json.NewDecoder(io.LimitReader(s, maxBlocksResponseSize)).Decode(&resp); err != nil {
+		s.Reset()
+		return nil, fmt.Errorf("bad state response: %w", err)
+	}
+
+	return &resp, nil
+}
+
+// offerKey identifies one snapshot across peers
+type offerKey struct {
+	height uint64
+	root   types.Hash
+}
+
+// stateOffer groups the peers offering one snapshot
+type stateOffer struct {
+	manifest types.StateManifest
+	peers    []peer.ID
+}
+
+// SyncState downloads the newest snapshot offered by peers that is at
+// least cfg.MinLag blocks ahead of local. The manifest is trusted only
+// once the signed header above it passes verify and commits to its
+// state root; every chunk is then checked against that root.
+func (n *Network) SyncState(ctx context.Context, cfg StateSyncConfig, local uint64, verify HeaderVerifier) (*SyncedState, error) {
+	offers := n.collectStateOffers(ctx, cfg)
+
+	for _, offer := range offers {
+		if offer.manifest.Height < local+cfg.MinLag {
+			break // Sorted by height
+		}
+
+		anchor, err := n.verifyStateOffer(ctx, cfg, offer, verify)
+		if err != nil {
+			fmt.Printf("State sync: snapshot at height %d rejected: %v\n", offer.manifest.Height, err)
+			continue
+		}
+
+		chunks, err := n.downloadChunks(ctx, cfg, offer)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			fmt.Printf("State sync: snapshot at height %d failed: %v\n", offer.manifest.Height, err)
+			continue
+		}
+
+		snap, err := types.AssembleState(&offer.manifest, chunks)
+		if err != nil {
+			return nil, err
+		}
+		return &SyncedState{Snapshot: snap, Anchor: anchor}, nil
+	}
+
+	return nil, ErrNoStateSnapshot
+}
+
+// collectStateOffers asks every connected peer for its manifest and
+// groups peers by snapshot, newest first
+func (n *Network) collectStateOffers(ctx context.Context, cfg StateSyncConfig) []*stateOffer {
+	n.peerMutex.RLock()
+	peers := make([]peer.ID, 0, len(n.peerStatus))
+	for p := range n.peerStatus {
+		peers = append(peers, p)
+	}
+	n.peerMutex.RUnlock()
+
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		offers = make(map[offerKey]*stateOffer)
+	)
+	for _, p := range peers {
+		wg.Add(1)
+		go func(p peer.ID) {
+			defer wg.Done()
+
+			reqCtx, cancel := context.WithTimeout(ctx, cfg.RequestTimeout)
+			defer cancel()
+
+			resp, err := n.requestState(reqCtx, p, &stateRequest{Manifest: true})
+			if err != nil || resp.Manifest == nil {
+				return
+			}
+
+			// Peers agree on a snapshot when height and root both match
+			key := offerKey{height: resp.Manifest.Height, root: resp.Manifest.StateRoot()}
+
+			mu.Lock()
+			defer mu.Unlock()
+			offer, ok := offers[key]
+			if !ok {
+				offer = &stateOffer{manifest: *resp.Manifest}
+				offers[key] = offer
+			}
+			offer.peers = append(offer.peers, p)
+		}(p)
+	}
+	wg.Wait()
+
+	sorted := make([]*stateOffer, 0, len(offers))
+	for _, offer := range offers {
+		sorted = append(sorted, offer)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].manifest.Height > sorted[j].manifest.Height
+	})
+
+	return sorted
+}
+
+// verifyStateOffer checks the manifest against the certified header
+// above the snapshot and fetches the block at the snapshot height
+func (n *Network) verifyStateOffer(ctx context.Context, cfg StateSyncConfig, offer *stateOffer, verify HeaderVerifier) (*types.Block, error) {
+	height := offer.manifest.Height
+
+	var lastErr error
+	for _, p := range offer.peers {
+		reqCtx, cancel := context.WithTimeout(ctx, cfg.RequestTimeout)
+		anchor, err := n.fetchStateAnchor(reqCtx, p, &offer.manifest, verify)
+		cancel()
+		if err == nil {
+			return anchor, nil
+		}
+		lastErr = fmt.Errorf("peer %s: %w", p, err)
+	}
+
+	return nil, fmt.Errorf("no peer proved the snapshot at height %d: %v", height, lastErr)
+}
+
+// fetchStateAnchor downloads and checks the header at height+1, whose
+// state root covers the snapshot, and the block at height
+func (n *Network) fetchStateAnchor(ctx context.Context, p peer.ID, m *types.StateManifest, verify HeaderVerifier) (*types.Block, error) {
+	headers, err := n.requestHeaders(ctx, p, m.Height+1, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(headers.Headers) != 1 || headers.Headers[0] == nil {
+		return nil, fmt.Errorf("header %d not available", m.Height+1)
+	}
+
+	sh := headers.Headers[0]
+	if sh.Header.Height != m.Height+1 {
+		return nil, fmt.Errorf("wrong header height %d", sh.Header.Height)
+	}
+	if err := verify(sh); err != nil {
+		return nil, err
+	}
+	if sh.Header.StateRoot != m.StateRoot() {
+		return nil, errors.New("manifest does not match the certified state root")
+	}
+
+	blocks, err := n.requestBlocks(ctx, p, m.Height, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(blocks.Blocks) != 1 || blocks.Blocks[0] == nil {
+		return nil, fmt.Errorf("block %d not available", m.Height)
+	}
+
+	anchor := blocks.Blocks[0]
+	if anchor.Header.Hash() != sh.Header.PrevBlockHash {
+		return nil, fmt.Errorf("block %d does not match the certified header", m.Height)
+	}
+
+	return anchor, nil
+}
+
+// chunkResult is one finished chunk download
+type chunkResult struct {
+	index uint32
+	peer  peer.ID
+	chunk *types.StateChunk
+	err   error
+}
+
+// downloadChunks fetches every chunk of an offer, spreading requests
+// over its peers. Failed chunks are retried on other peers; peers
+// serving chunks that fail their proof are banned.
+func (n *Network) downloadChunks(ctx context.Context, cfg StateSyncConfig, offer *stateOffer) ([]*types.StateChunk, error) {
+	m := &offer.manifest
+	chunks := make([]*types.StateChunk, m.Chunks)
+
+	missing := make([]uint32, m.Chunks)
+	for i := range missing {
+		missing[i] = uint32(i)
+	}
+	peers := append([]peer.ID(nil), offer.peers...)
+
+	for round := 0; len(missing) > 0; round++ {
+		if len(peers) == 0 {
+			return nil, errors.New("no peers left serving the snapshot")
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		batch := missing
+		if len(batch) > cfg.Workers {
+			batch = batch[:cfg.Workers]
+		}
+		missing = missing[len(batch):]
+
+		results := make(chan chunkResult, len(batch))
+		for i, index := range batch {
+			p := peers[(round+i)%len(peers)]
+			go func(index uint32, p peer.ID) {
+				reqCtx, cancel := context.WithTimeout(ctx, cfg.RequestTimeout)
+				defer cancel()
+
+				chunk, err := n.fetchChunk(reqCtx, p, m, index)
+				results <- chunkResult{index: index, peer: p, chunk: chunk, err: err}
+			}(index, p)
+		}
+
+		failed := make(map[peer.ID]bool)
+		for range batch {
+			res := <-results
+			if res.err == nil {
+				chunks[res.index] = res.chunk
+				continue
+			}
+
+			missing = append(missing, res.index)
+			if !failed[res.peer] {
+				failed[res.peer] = true
+				fmt.Printf("State sync: dropping peer %s: %v\n", res.peer, res.err)
+				if errors.Is(res.err, ErrInvalidBlock) {
+					if err := n.BanPeer(res.peer.String(), cfg.BanDuration); err != nil {
+						fmt.Printf("State sync: failed to ban peer %s: %v\n", res.peer, err)
+					}
+				}
+			}
+		}
+
+		remaining := peers[:0]
+		for _, p := range peers {
+			if !failed[p] {
+				remaining = append(remaining, p)
+			}
+		}
+		peers = remaining
+	}
+
+	return chunks, nil
+}
+
+// fetchChunk downloads one chunk and checks its proof
+func (n *Network) fetchChunk(ctx context.Context, p peer.ID, m *types.StateManifest, index uint32) (*types.StateChunk, error) {
+	resp, err := n.requestState(ctx, p, &stateRequest{Height: m.Height, Index: index})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Chunk == nil {
+		return nil, fmt.Errorf("chunk %d no longer offered", index)
+	}
+	if resp.Chunk.Index != index {
+		return nil, fmt.Errorf("%w: asked for chunk %d, got %d", ErrInvalidBlock, index, resp.Chunk.Index)
+	}
+	if err := m.VerifyChunk(resp.Chunk, resp.Proof); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBlock, err)
+	}
+
+	return resp.Chunk, nil
+}
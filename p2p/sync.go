@@ -0,0 +1,589 @@
+package p2p
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"blockchain/types"
+)
+
+// ErrInvalidBlock marks apply errors caused by the block itself. Peers
+// serving such blocks are banned; other apply errors are retried.
+var ErrInvalidBlock = errors.New("invalid block")
+
+// SyncConfig tunes block download
+type SyncConfig struct {
+	BatchSize      uint64        // Blocks per range request
+	MaxInflight    int           // Ranges downloading at once, across peers
+	RequestTimeout time.Duration // Deadline of one range request
+	Interval       time.Duration // How often peers are polled and work scheduled
+
+	// Peers failing MaxPeerFailures requests in a row, or serving an
+	// invalid block, are banned for BanDuration
+	MaxPeerFailures int
+	BanDuration     time.Duration
+}
+
+// DefaultSyncConfig returns the default sync settings
+func DefaultSyncConfig() SyncConfig {
+	return SyncConfig{
+		BatchSize:       64,
+		MaxInflight:     8,
+		RequestTimeout:  20 * time.Second,
+		Interval:        2 * time.Second,
+		MaxPeerFailures: 3,
+		BanDuration:     time.Hour,
+	}
+}
+
+// ApplyFunc validates and stores the next block of the local chain
+type ApplyFunc func(block *types.Block) error
+
+// HeaderVerifier checks the finality certificate of a signed header
+type HeaderVerifier func(sh *types.SignedHeader) error
+
+// HeightFunc returns the local chain height
+type HeightFunc func() uint64
+
+// peerSyncState is the download state of one peer
+type peerSyncState int
+
+const (
+	peerIdle        peerSyncState = iota // Ready for a request
+	peerDownloading                      // A range request is in flight
+	peerProbing                          // Asking only for the peer's height
+	peerHeaders                          // A header request is in flight
+)
+
+func (s peerSyncState) String() string {
+	switch s {
+	case peerDownloading:
+		return "downloading"
+	case peerProbing:
+		return "probing"
+	case peerHeaders:
+		return "headers"
+	default:
+		return "idle"
+	}
+}
+
+// syncPeer tracks what a peer has and how it behaves
+type syncPeer struct {
+	best      uint64 // Highest block the peer reported
+	state     peerSyncState
+	failures  int // Consecutive failed requests
+	lastProbe time.Time
+}
+
+// blockRange is a run of consecutive heights
+type blockRange struct {
+	from  uint64
+	count uint64
+}
+
+func (r blockRange) end() uint64 {
+	return r.from + r.count
+}
+
+// requestKind tells what a request asked for
+type requestKind int
+
+const (
+	requestBlocks requestKind = iota
+	requestProbe
+	requestHeaders
+)
+
+// rangeResult is a finished request
+type rangeResult struct {
+	peer    peer.ID
+	r       blockRange
+	kind    requestKind
+	resp    *blocksResponse  // Blocks and probes
+	headers *headersResponse // Headers
+	err     error
+	blocks  []*types.Block // Verified to be r.from, r.from+1, ...
+}
+
+// SyncManager downloads blocks from all peers in parallel. Each peer
+// serves one range at a time; ranges are applied strictly in height
+// order as they arrive. Failed ranges are retried on another peer.
+// With a header verifier, bodies are only fetched for headers whose
+// finality certificates have been checked (see headersync.go).
+type SyncManager struct {
+	net    *Network
+	cfg    SyncConfig
+	height HeightFunc
+	apply  ApplyFunc
+	verify HeaderVerifier
+
+	mu        sync.Mutex
+	peers     map[peer.ID]*syncPeer
+	retry     []blockRange            // Ranges to request again
+	nextFetch uint64                  // First height not yet requested
+	ready     map[uint64]*rangeResult // Downloaded ranges by first height
+	inflight  int
+
+	// Verified headers ahead of the local chain
+	headers        map[uint64]types.Hash
+	headerTip      uint64
+	headerTipHash  types.Hash
+	headerInflight bool
+
+	results chan *rangeResult
+	quit    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewSyncManager creates a sync manager applying downloaded blocks with
+// apply
+func NewSyncManager(net *Network, cfg SyncConfig, height HeightFunc, apply ApplyFunc) *SyncManager {
+	return &SyncManager{
+		net:     net,
+		cfg:     cfg,
+		height:  height,
+		apply:   apply,
+		peers:   make(map[peer.ID]*syncPeer),
+		ready:   make(map[uint64]*rangeResult),
+		headers: make(map[uint64]types.Hash),
+		results: make(chan *rangeResult),
+		quit:    make(chan struct{}),
+	}
+}
+
+// Start begins syncing in the background
+func (sm *SyncManager) Start() {
+	sm.wg.Add(1)
+	go sm.loop()
+}
+
+// Stop halts syncing and waits for outstanding requests
+func (sm *SyncManager) Stop() {
+	close(sm.quit)
+	sm.wg.Wait()
+}
+
+// NotePeerHeight records a height announced by a peer outside sync,
+// such as a gossiped block
+func (sm *SyncManager) NotePeerHeight(id string, height uint64) {
+	p, err := peer.Decode(id)
+	if err != nil {
+		return
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if sp, ok := sm.peers[p]; ok && height > sp.best {
+		sp.best = height
+	}
+}
+
+// SyncPeerStatus describes one peer in SyncStatus
+type SyncPeerStatus struct {
+	ID       string `json:"id"`
+	Height   uint64 `json:"height"`
+	State    string `json:"state"`
+	Failures int    `json:"failures,omitempty"`
+}
+
+// SyncStatus reports sync progress
+type SyncStatus struct {
+	Syncing      bool             `json:"syncing"`
+	Height       uint64           `json:"height"`
+	HeaderHeight uint64           `json:"header_height,omitempty"` // Highest verified header
+	TargetHeight uint64           `json:"target_height"`
+	Downloaded   int              `json:"downloaded"` // Blocks waiting to be applied
+	Peers        []SyncPeerStatus `json:"peers"`
+}
+
+// Status returns the current sync progress
+func (sm *SyncManager) Status() SyncStatus {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	status := SyncStatus{
+		Height:       sm.height(),
+		TargetHeight: sm.target(),
+		Peers:        make([]SyncPeerStatus, 0, len(sm.peers)),
+	}
+	status.Syncing = status.TargetHeight > status.Height
+	if sm.verify != nil && sm.headerTip > status.Height {
+		status.HeaderHeight = sm.headerTip
+	}
+
+	for _, res := range sm.ready {
+		status.Downloaded += len(res.blocks)
+	}
+	for p, sp := range sm.peers {
+		status.Peers = append(status.Peers, SyncPeerStatus{
+			ID:       p.String(),
+			Height:   sp.best,
+			State:    sp.state.String(),
+			Failures: sp.failures,
+		})
+	}
+	sort.Slice(status.Peers, func(i, j int) bool {
+		return status.Peers[i].ID < status.Peers[j].ID
+	})
+
+	return status
+}
+
+func (sm *SyncManager) loop() {
+	defer sm.wg.Done()
+
+	ticker := time.NewTicker(sm.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		// Blocks are applied without the lock, so status and peer
+		// heights stay available while a long run is applied
+		sm.mu.Lock()
+		sm.refreshPeers()
+		ready := sm.takeReady()
+		sm.mu.Unlock()
+
+		sm.applyReady(ready)
+
+		sm.mu.Lock()
+		sm.schedule()
+		sm.mu.Unlock()
+
+		select {
+		case <-sm.quit:
+			return
+		case res := <-sm.results:
+			sm.mu.Lock()
+			sm.handleResult(res)
+			sm.mu.Unlock()
+		case <-ticker.C:
+		}
+	}
+}
+
+// target returns the best height reported by any peer (must hold lock)
+func (sm *SyncManager) target() uint64 {
+	var best uint64
+	for _, sp := range sm.peers {
+		if sp.best > best {
+			best = sp.best
+		}
+	}
+	return best
+}
+
+// refreshPeers adds handshaken peers and drops disconnected idle ones
+// (must hold lock)
+func (sm *SyncManager) refreshPeers() {
+	connected := make(map[peer.ID]uint64)
+	sm.net.peerMutex.RLock()
+	for p, status := range sm.net.peerStatus {
+		if !status.Seed { // Seeds serve no blocks
+			connected[p] = status.Height
+		}
+	}
+	sm.net.peerMutex.RUnlock()
+
+	// The handshake height is only a starting point; responses and
+	// probes keep it current afterwards
+	for p, height := range connected {
+		if _, ok := sm.peers[p]; !ok {
+			sm.peers[p] = &syncPeer{best: height}
+		}
+	}
+
+	for p, sp := range sm.peers {
+		if _, ok := connected[p]; !ok && sp.state == peerIdle {
+			delete(sm.peers, p)
+		}
+	}
+}
+
+// schedule assigns ranges to idle peers and probes peers that have
+// nothing new (must hold lock)
+func (sm *SyncManager) schedule() {
+	local := sm.height()
+	if sm.nextFetch <= local {
+		sm.nextFetch = local + 1
+	}
+
+	// Ranges applied meanwhile (e.g. through gossip) need no retry
+	retry := sm.retry[:0]
+	for _, r := range sm.retry {
+		if r.end() > local+1 {
+			retry = append(retry, r)
+		}
+	}
+	sm.retry = retry
+
+	// Download at most MaxInflight ranges ahead of the local chain so
+	// unapplied blocks stay bounded, and only bodies of verified headers
+	window := local + uint64(sm.cfg.MaxInflight)*sm.cfg.BatchSize
+	if sm.verify != nil {
+		sm.scheduleHeaders(local)
+		if window > sm.headerTip {
+			window = sm.headerTip
+		}
+	}
+
+	for sm.inflight < sm.cfg.MaxInflight {
+		var r blockRange
+		fromRetry := len(sm.retry) > 0
+		if fromRetry {
+			r = sm.retry[0]
+		} else {
+			if sm.nextFetch > window {
+				break
+			}
+			r = blockRange{from: sm.nextFetch, count: sm.cfg.BatchSize}
+			if r.end() > window+1 {
+				r.count = window + 1 - r.from
+			}
+		}
+
+		p, sp := sm.pickPeer(r.from)
+		if sp == nil {
+			break
+		}
+		if r.end() > sp.best+1 {
+			r.count = sp.best + 1 - r.from
+		}
+
+		if fromRetry {
+			// Anything the peer cannot serve stays queued
+			if rest := sm.retry[0]; rest.end() > r.end() {
+				sm.retry[0] = blockRange{from: r.end(), count: rest.end() - r.end()}
+			} else {
+				sm.retry = sm.retry[1:]
+			}
+		} else {
+			sm.nextFetch = r.end()
+		}
+
+		sm.request(p, sp, r, requestBlocks)
+	}
+
+	// Peers that are behind may have moved on; ask for their height
+	for p, sp := range sm.peers {
+		if sp.state == peerIdle && sp.best <= local && time.Since(sp.lastProbe) >= sm.cfg.Interval {
+			sp.lastProbe = time.Now()
+			sm.request(p, sp, blockRange{from: local + 1}, requestProbe)
+		}
+	}
+}
+
+// pickPeer returns the idle peer with the fewest failures that has
+// height from (must hold lock)
+func (sm *SyncManager) pickPeer(from uint64) (peer.ID, *syncPeer) {
+	var bestID peer.ID
+	var best *syncPeer
+	for p, sp := range sm.peers {
+		if sp.state != peerIdle || sp.best < from {
+			continue
+		}
+		if best == nil || sp.failures < best.failures || (sp.failures == best.failures && sp.best > best.best) {
+			bestID, best = p, sp
+		}
+	}
+	return bestID, best
+}
+
+// request starts downloading a range from a peer (must hold lock)
+func (sm *SyncManager) request(p peer.ID, sp *syncPeer, r blockRange, kind requestKind) {
+	switch kind {
+	case requestProbe:
+		sp.state = peerProbing
+	case requestHeaders:
+		sp.state = peerHeaders
+		sm.headerInflight = true
+	default:
+		sp.state = peerDownloading
+		sm.inflight++
+	}
+
+	sm.wg.Add(1)
+	go func() {
+		defer sm.wg.Done()
+
+		ctx, cancel := context.WithTimeout(sm.net.ctx, sm.cfg.RequestTimeout)
+		defer cancel()
+
+		res := &rangeResult{peer: p, r: r, kind: kind}
+		if kind == requestHeaders {
+			res.headers, res.err = sm.net.requestHeaders(ctx, p, r.from, r.count)
+		} else {
+			res.resp, res.err = sm.net.requestBlocks(ctx, p, r.from, r.count)
+		}
+
+		select {
+		case sm.results <- res:
+		case <-sm.quit:
+		}
+	}()
+}
+
+// handleResult checks a finished request and queues its blocks for
+// applying (must hold lock)
+func (sm *SyncManager) handleResult(res *rangeResult) {
+	switch res.kind {
+	case requestBlocks:
+		sm.inflight--
+	case requestHeaders:
+		sm.headerInflight = false
+	}
+
+	sp, ok := sm.peers[res.peer]
+	if !ok {
+		// Banned or dropped while the request was running
+		if res.kind == requestBlocks {
+			sm.retry = append(sm.retry, res.r)
+		}
+		return
+	}
+	sp.state = peerIdle
+
+	if res.kind == requestHeaders {
+		sm.handleHeaders(res, sp)
+		return
+	}
+
+	if res.err == nil {
+		res.err = sm.checkRange(res)
+	}
+	if res.err != nil {
+		if res.kind == requestBlocks {
+			sm.retry = append(sm.retry, res.r)
+		}
+		sm.penalize(res.peer, sp, res.err)
+		return
+	}
+
+	sp.failures = 0
+	if res.resp.Height > sp.best {
+		sp.best = res.resp.Height
+	}
+	if res.kind == requestProbe {
+		return
+	}
+
+	// The peer may serve fewer blocks than asked, e.g. after a restart
+	if got := uint64(len(res.blocks)); got < res.r.count {
+		sm.retry = append(sm.retry, blockRange{from: res.r.from + got, count: res.r.count - got})
+		if sp.best >= res.r.from+got {
+			sp.best = res.r.from + got - 1
+		}
+	}
+	if len(res.blocks) > 0 {
+		sm.ready[res.r.from] = res
+	}
+}
+
+// checkRange verifies a response holds consecutive blocks starting at
+// the requested height, matching their verified headers (must hold lock)
+func (sm *SyncManager) checkRange(res *rangeResult) error {
+	if uint64(len(res.resp.Blocks)) > res.r.count {
+		return fmt.Errorf("%d blocks served for a request of %d", len(res.resp.Blocks), res.r.count)
+	}
+	for i, block := range res.resp.Blocks {
+		if block == nil || block.Header.Height != res.r.from+uint64(i) {
+			return fmt.Errorf("%w: block %d of range from %d has the wrong height", ErrInvalidBlock, i, res.r.from)
+		}
+		if hash, ok := sm.headers[block.Header.Height]; ok && block.Header.Hash() != hash {
+			return fmt.Errorf("%w: block %d does not match its verified header", ErrInvalidBlock, block.Header.Height)
+		}
+	}
+	res.blocks = res.resp.Blocks
+	return nil
+}
+
+// takeReady removes the downloaded ranges that continue the local chain
+// from the queue, in height order (must hold lock)
+func (sm *SyncManager) takeReady() []*rangeResult {
+	local := sm.height()
+
+	var taken []*rangeResult
+	for {
+		var next *rangeResult
+		for from, res := range sm.ready {
+			if res.r.from+uint64(len(res.blocks)) <= local+1 {
+				delete(sm.ready, from) // Already have these blocks
+				continue
+			}
+			if res.r.from <= local+1 {
+				next = res
+			}
+		}
+		if next == nil {
+			return taken
+		}
+		delete(sm.ready, next.r.from)
+		taken = append(taken, next)
+		local = next.r.from + uint64(len(next.blocks)) - 1
+	}
+}
+
+// applyReady applies ranges taken off the queue by takeReady. It must
+// not hold the lock, which it takes only when a block fails, to queue
+// what is left again.
+func (sm *SyncManager) applyReady(ready []*rangeResult) {
+	for j, next := range ready {
+		local := sm.height()
+		for i, block := range next.blocks {
+			if block.Header.Height <= local {
+				continue
+			}
+
+			if err := sm.apply(block); err != nil {
+				sm.mu.Lock()
+				defer sm.mu.Unlock()
+
+				for _, res := range ready[j+1:] {
+					sm.ready[res.r.from] = res
+				}
+				rest := blockRange{from: block.Header.Height, count: uint64(len(next.blocks) - i)}
+				if !errors.Is(err, ErrInvalidBlock) {
+					// Not the peer's fault; try again later
+					next.blocks = next.blocks[i:]
+					next.r = rest
+					sm.ready[rest.from] = next
+					fmt.Printf("Sync: failed to apply block %d: %v\n", block.Header.Height, err)
+					return
+				}
+
+				sm.retry = append(sm.retry, rest)
+				if sp, ok := sm.peers[next.peer]; ok {
+					sm.penalize(next.peer, sp, err)
+				}
+				// A body matching a certified header failed; the
+				// headers cannot be trusted either
+				sm.resetHeaders()
+				return
+			}
+		}
+	}
+}
+
+// penalize records a failed request. Invalid data bans the peer at
+// once; other failures ban it after MaxPeerFailures in a row.
+// (must hold lock)
+func (sm *SyncManager) penalize(p peer.ID, sp *syncPeer, err error) {
+	sp.failures++
+	if !errors.Is(err, ErrInvalidBlock) && sp.failures < sm.cfg.MaxPeerFailures {
+		fmt.Printf("Sync: request to %s failed: %v\n", p, err)
+		return
+	}
+
+	fmt.Printf("Sync: banning peer %s: %v\n", p, err)
+	delete(sm.peers, p)
+	if err := sm.net.BanPeer(p.String(), sm.cfg.BanDuration); err != nil {
+		fmt.Printf("Sync: failed to ban peer %s: %v\n", p, err)
+	}
+}
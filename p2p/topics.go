@@ -0,0 +1,38 @@
+package p2p
+
+import (
+	"fmt"
+
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+)
+
+// GossipVersion is the version of the gossip message encoding. It is
+// part of every topic name, so nodes with incompatible encodings never
+// exchange messages. Rule-set upgrades are negotiated by the handshake
+// (see handshake.go) and do not change topics.
+const GossipVersion = 1
+
+// TopicName returns the pubsub topic for a base topic such as
+// BlockTopic on one chain
+func TopicName(chainID, base string) string {
+	return fmt.Sprintf("/apex/%s/%d/%s", chainID, GossipVersion, base)
+}
+
+// gossipTopics lists the base topics this node joins
+var gossipTopics = []string{BlockTopic, ProposalTopic, TxTopic, TxAnnounceTopic, VoteTopic, HeartbeatTopic, StakingTopic}
+
+// topic returns the namespaced name of a base topic
+func (n *Network) topic(base string) string {
+	return TopicName(n.chainID, base)
+}
+
+// topicFilter only lets this chain's topics through. Peers' subscriptions
+// to other topics are ignored, and messages on them are dropped since we
+// never join those topics; networks sharing bootstrap nodes stay apart.
+func topicFilter(chainID string) pubsub.SubscriptionFilter {
+	topics := make([]string, len(gossipTopics))
+	for i, base := range gossipTopics {
+		topics[i] = TopicName(chainID, base)
+	}
+	return pubsub.NewAllowlistSubscriptionFilter(topics...)
+}
@@ -0,0 +1,226 @@
+package p2p
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+
+	"blockchain/types"
+)
+
+const (
+	// TxAnnounceTopic carries batches of transaction hashes. Receivers
+	// pull the transactions they lack from the forwarding peer.
+	TxAnnounceTopic = "tx-announce"
+
+	// TxFetchProtocolID is the stream protocol used to download announced
+	// transactions
+	TxFetchProtocolID = "/blockchain/txs/1.0.0"
+
+	// MaxAnnounceHashes bounds the hashes in one announcement or fetch
+	MaxAnnounceHashes = 500
+
+	// maxTxFetchRequestSize and maxTxFetchResponseSize bound the messages
+	maxTxFetchRequestSize  = 128 << 10
+	maxTxFetchResponseSize = 64 << 20
+
+	txFetchTimeout = 30 * time.Second
+)
+
+// TxLookup returns a pooled transaction by hash, or nil if it is not in
+// the pool
+type TxLookup func(hash types.Hash) *types.Transaction
+
+// txFetchRequest asks for pooled transactions by hash
+type txFetchRequest struct {
+	Hashes []types.Hash `json:"hashes"`
+}
+
+// txFetchResponse carries the requested transactions the peer has
+type txFetchResponse struct {
+	Txs []*types.Transaction `json:"txs"`
+}
+
+// SetTxLookup enables batched announcements: serving pooled
+// transactions to peers and skipping the fetch of ones already pooled
+func (n *Network) SetTxLookup(lookup TxLookup) {
+	n.txLookup = lookup
+}
+
+// startTxAnnounce joins the announcement topic and serves fetches. The
+// announcement validator downloads missing transactions before the
+// announcement is forwarded, so every forwarding peer can serve them.
+func (n *Network) startTxAnnounce() error {
+	if n.txLookup == nil {
+		return nil
+	}
+
+	n.host.SetStreamHandler(TxFetchProtocolID, n.handleTxFetch)
+
+	if err := n.pubsub.RegisterTopicValidator(n.topic(TxAnnounceTopic), n.validateTxAnnounce,
+		pubsub.WithValidatorTimeout(txFetchTimeout)); err != nil {
+		return err
+	}
+
+	sub, err := n.pubsub.Subscribe(n.topic(TxAnnounceTopic))
+	if err != nil {
+		return err
+	}
+	n.txAnnounceSub = sub
+
+	go n.handleMessages(sub, nil) // Transactions are handled in validation
+	return nil
+}
+
+// BroadcastTxBatch announces the hashes of pooled transactions in as few
+// messages as possible. The transactions skip the stem phase.
+func (n *Network) BroadcastTxBatch(txs []*types.Transaction) error {
+	for start := 0; start < len(txs); start += MaxAnnounceHashes {
+		end := min(start+MaxAnnounceHashes, len(txs))
+
+		hashes := make([]types.Hash, 0, end-start)
+		for _, tx := range txs[start:end] {
+			hashes = append(hashes, tx.Hash())
+		}
+
+		data, err := json.Marshal(hashes)
+		if err != nil {
+			return err
+		}
+
+		msg := Message{
+			Type: "tx-announce",
+			Data: data,
+		}
+		if err := n.publish(n.topic(TxAnnounceTopic), msg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateTxAnnounce fetches the announced transactions missing from the
+// pool and passes them to the transaction handler. Malformed
+// announcements are rejected. Transactions the peer cannot serve or the
+// pool refuses (possibly just included in a block) only stop the
+// announcement from being forwarded.
+func (n *Network) validateTxAnnounce(ctx context.Context, from peer.ID, msg *pubsub.Message) pubsub.ValidationResult {
+	var m Message
+	if err := json.Unmarshal(msg.Data, &m); err != nil || m.Type != "tx-announce" {
+		return pubsub.ValidationReject
+	}
+
+	var hashes []types.Hash
+	if err := json.Unmarshal(m.Data, &hashes); err != nil || len(hashes) == 0 || len(hashes) > MaxAnnounceHashes {
+		return pubsub.ValidationReject
+	}
+
+	var missing []types.Hash
+	for _, hash := range hashes {
+		if n.txLookup(hash) == nil {
+			missing = append(missing, hash)
+		}
+	}
+	if len(missing) == 0 {
+		return pubsub.ValidationAccept
+	}
+	if from == n.host.ID() {
+		return pubsub.ValidationIgnore // Announced transactions left our pool
+	}
+
+	txs, err := n.fetchTxs(ctx, from, missing)
+	if err != nil {
+		fmt.Printf("Failed to fetch announced transactions from %s: %v\n", from, err)
+		return pubsub.ValidationIgnore
+	}
+
+	for _, tx := range txs {
+		data, err := encodeTxMessage(tx)
+		if err != nil {
+			return pubsub.ValidationReject
+		}
+		if n.txHandler != nil {
+			if err := n.txHandler(data); err != nil {
+				fmt.Printf("Dropped announced transaction from %s: %v\n", from, err)
+				return pubsub.ValidationIgnore
+			}
+		}
+	}
+
+	if len(txs) < len(missing) {
+		return pubsub.ValidationIgnore
+	}
+	return pubsub.ValidationAccept
+}
+
+// handleTxFetch serves pooled transactions by hash
+func (n *Network) handleTxFetch(s network.Stream) {
+	defer s.Close()
+	s.SetDeadline(time.Now().Add(txFetchTimeout))
+
+	var req txFetchRequest
+	if err := json.NewDecoder(io.LimitReader(s, maxTxFetchRequestSize)).Decode(&req); err != nil {
+		s.Reset()
+		return
+	}
+	if len(req.Hashes) > MaxAnnounceHashes {
+		req.Hashes = req.Hashes[:MaxAnnounceHashes]
+	}
+
+	resp := txFetchResponse{Txs: make([]*types.Transaction, 0, len(req.Hashes))}
+	for _, hash := range req.Hashes {
+		if tx := n.txLookup(hash); tx != nil {
+			resp.Txs = append(resp.Txs, tx)
+		}
+	}
+
+	if err := json.NewEncoder(s).Encode(&resp); err != nil {
+		s.Reset()
+	}
+}
+
+// fetchTxs downloads transactions by hash. Only transactions that were
+// asked for are returned.
+func (n *Network) fetchTxs(ctx context.Context, p peer.ID, hashes []types.Hash) ([]*types.Transaction, error) {
+	s, err := n.host.NewStream(ctx, p, TxFetchProtocolID)
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		s.SetDeadline(deadline)
+	}
+
+	if err := json.NewEncoder(s).Encode(&txFetchRequest{Hashes: hashes}); err != nil {
+		s.Reset()
+		return nil, err
+	}
+
+	var resp txFetchResponse
+	if err := json.NewDecoder(io.LimitReader(s, maxTxFetchResponseSize)).Decode(&resp); err != nil {
+		s.Reset()
+		return nil, fmt.Errorf("bad txs response: %w", err)
+	}
+
+	wanted := make(map[types.Hash]bool, len(hashes))
+	for _, hash := range hashes {
+		wanted[hash] = true
+	}
+	for _, tx := range resp.Txs {
+		if tx == nil || !wanted[tx.Hash()] {
+			return nil, errors.New("peer sent unrequested transaction")
+		}
+		delete(wanted, tx.Hash())
+	}
+
+	return resp.Txs, nil
+}
@@ -0,0 +1,148 @@
+package rosetta
+
+import (
+	"encoding/hex"
+	"errors"
+	"sync"
+
+	"golang.org/x/crypto/ed25519"
+
+	"blockchain/crypto"
+	"blockchain/types"
+	"blockchain/wallet"
+)
+
+// CallRegisterViewKey is the /call method that registers an account.
+// Stealth outputs can only be attributed to an address with its private
+// view key, so balances are served for registered accounts only.
+const CallRegisterViewKey = "register_view_key"
+
+// account is a registered view-only wallet and its cached scan
+type account struct {
+	keys *crypto.WalletKeys
+
+	mu   sync.Mutex
+	scan *wallet.ScanResult
+
+	// Outputs spent by transactions submitted through this server. A
+	// view-only scan cannot detect spends itself.
+	spent map[string]bool
+}
+
+// accountStore holds the registered accounts by canonical address
+type accountStore struct {
+	mu       sync.RWMutex
+	accounts map[string]*account
+}
+
+func newAccountStore() *accountStore {
+	return &accountStore{accounts: make(map[string]*account)}
+}
+
+// register adds an account from its address on network and hex private
+// view key (32-byte seed or 64-byte key) and returns the canonical address
+func (as *accountStore) register(network types.Network, address, viewKey string) (string, error) {
+	addr, _, err := wallet.ParseAddress(network, address)
+	if err != nil {
+		return "", err
+	}
+
+	raw, err := hex.DecodeString(viewKey)
+	if err != nil {
+		return "", errors.New("view_key must be hex")
+	}
+
+	var priv ed25519.PrivateKey
+	switch len(raw) {
+	case ed25519.SeedSize:
+		priv = ed25519.NewKeyFromSeed(raw)
+	case ed25519.PrivateKeySize:
+		priv = ed25519.PrivateKey(raw)
+	default:
+		return "", errors.New("view_key must be 32 or 64 bytes")
+	}
+
+	pub := priv.Public().(ed25519.PublicKey)
+	if string(pub) != string(addr.ViewKey[:]) {
+		return "", errors.New("view_key does not match the address")
+	}
+
+	canonical := wallet.FormatAddress(network, addr)
+
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	if _, exists := as.accounts[canonical]; !exists {
+		as.accounts[canonical] = &account{
+			keys: &crypto.WalletKeys{
+				ViewKeyPair:  &crypto.KeyPair{PrivateKey: priv, PublicKey: addr.ViewKey},
+				SpendKeyPair: &crypto.KeyPair{PublicKey: addr.SpendKey},
+			},
+			spent: make(map[string]bool),
+		}
+	}
+
+	return canonical, nil
+}
+
+// get returns a registered account by its address on network
+func (as *accountStore) get(network types.Network, address string) (*account, error) {
+	addr, _, err := wallet.ParseAddress(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+
+	acct, ok := as.accounts[wallet.FormatAddress(network, addr)]
+	if !ok {
+		return nil, errors.New("account not registered")
+	}
+	return acct, nil
+}
+
+// refresh scans blocks added since the last call and returns a copy of
+// the account's outputs, with outputs spent through this server marked
+func (a *account) refresh(chain wallet.ChainReader) (*wallet.ScanResult, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.scan == nil {
+		a.scan = &wallet.ScanResult{ViewOnly: true}
+	}
+
+	latest, err := chain.GetLatestHeight()
+	if err != nil {
+		return nil, err
+	}
+
+	if latest > a.scan.ScannedHeight {
+		result, err := wallet.Scan(a.keys, chain, a.scan.ScannedHeight+1)
+		if err != nil {
+			return nil, err
+		}
+		a.scan.Outputs = append(a.scan.Outputs, result.Outputs...)
+		a.scan.ScannedHeight = result.ScannedHeight
+	}
+
+	scan := &wallet.ScanResult{
+		Outputs:       make([]*wallet.OwnedOutput, len(a.scan.Outputs)),
+		ScannedHeight: a.scan.ScannedHeight,
+		ViewOnly:      true,
+	}
+	for i, out := range a.scan.Outputs {
+		o := *out
+		o.Spent = a.spent[o.Ref()]
+		scan.Outputs[i] = &o
+	}
+
+	return scan, nil
+}
+
+// markSpent records an output spent by a submitted transaction
+func (a *account) markSpent(ref string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.spent[ref] = true
+}
@@ -0,0 +1,439 @@
+package rosetta
+
+// Construction flow. Ring signatures need the private spend key and a
+// wallet-built ring, which a generic Rosetta signer cannot produce, so
+// the signing payload is the wallet's unsigned transaction file: the
+// caller signs it with 'wallet sign' and passes the resulting signed
+// transaction, hex-encoded, as the signature bytes.
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"blockchain/types"
+	"blockchain/wallet"
+)
+
+// CurveType is the curve of ApexCoin spend keys
+const CurveType = "edwards25519"
+
+// transfer is a single recipient of a construction request
+type transfer struct {
+	Address string `json:"address"`
+	Amount  uint64 `json:"amount"`
+}
+
+// constructionTx is the opaque transaction passed between construction
+// endpoints
+type constructionTx struct {
+	Sender    string             `json:"sender"`
+	Transfers []transfer         `json:"transfers"`
+	Unsigned  *wallet.UnsignedTx `json:"unsigned"`
+	Signed    *types.Transaction `json:"signed,omitempty"`
+}
+
+// intent is the decoded form of TRANSFER operations
+type intent struct {
+	Sender    string     `json:"sender"`
+	Transfers []transfer `json:"transfers"`
+}
+
+// parseIntent decodes one debit from the sender and one credit per
+// recipient. The debit equals the sum of the credits; the fee is paid on
+// top and is not part of the intent.
+func (s *Server) parseIntent(ops []*Operation) (*intent, error) {
+	var in intent
+	var debit, credit uint64
+
+	for _, op := range ops {
+		if op == nil {
+			return nil, errors.New("null operation")
+		}
+		if op.Type != OpTransfer {
+			return nil, fmt.Errorf("unsupported operation type %q", op.Type)
+		}
+		if op.Account == nil || op.Amount == nil {
+			return nil, errors.New("transfer needs an account and amount")
+		}
+		if op.Amount.Currency == nil || *op.Amount.Currency != *s.currency {
+			return nil, errors.New("unsupported currency")
+		}
+
+		value, err := strconv.ParseInt(op.Amount.Value, 10, 64)
+		if err != nil || value == 0 {
+			return nil, fmt.Errorf("invalid amount %q", op.Amount.Value)
+		}
+
+		if value < 0 {
+			if in.Sender != "" {
+				return nil, errors.New("only one sender is supported")
+			}
+			in.Sender = op.Account.Address
+			debit = uint64(-value)
+			continue
+		}
+
+		if credit, err = types.AddAmounts(credit, uint64(value)); err != nil {
+			return nil, err
+		}
+		in.Transfers = append(in.Transfers, transfer{Address: op.Account.Address, Amount: uint64(value)})
+	}
+
+	if in.Sender == "" || len(in.Transfers) == 0 {
+		return nil, errors.New("need one sender and at least one recipient")
+	}
+	if debit != credit {
+		return nil, fmt.Errorf("sender debit %d does not match recipient credits %d", debit, credit)
+	}
+
+	return &in, nil
+}
+
+// payments converts transfers to addresses on network to wallet payments
+func payments(network types.Network, transfers []transfer) ([]wallet.Payment, error) {
+	result := make([]wallet.Payment, len(transfers))
+	for i, t := range transfers {
+		p, err := wallet.ParsePayment(network, t.Address, t.Amount, "")
+		if err != nil {
+			return nil, fmt.Errorf("recipient %s: %w", t.Address, err)
+		}
+		result[i] = p
+	}
+	return result, nil
+}
+
+// operations rebuilds the intent operations of a transaction
+func (s *Server) operations(in *intent) []*Operation {
+	ops := make([]*Operation, 0, len(in.Transfers)+1)
+
+	var total uint64
+	for _, t := range in.Transfers {
+		total += t.Amount
+	}
+
+	ops = append(ops, &Operation{
+		OperationIdentifier: &OperationIdentifier{Index: 0},
+		Type:                OpTransfer,
+		Account:             &AccountIdentifier{Address: in.Sender},
+		Amount:              s.amount(-int64(total)),
+	})
+	for _, t := range in.Transfers {
+		ops = append(ops, &Operation{
+			OperationIdentifier: &OperationIdentifier{Index: int64(len(ops))},
+			Type:                OpTransfer,
+			Account:             &AccountIdentifier{Address: t.Address},
+			Amount:              s.unsignedAmount(t.Amount),
+		})
+	}
+
+	return ops
+}
+
+// decodeTx decodes an opaque construction transaction
+func decodeTx(s string) (*constructionTx, *Error) {
+	var ctx constructionTx
+	if err := json.Unmarshal([]byte(s), &ctx); err != nil {
+		return nil, withDetails(ErrInvalidRequest, err)
+	}
+	if ctx.Unsigned == nil {
+		return nil, withDetails(ErrInvalidRequest, errors.New("missing unsigned transaction"))
+	}
+	return &ctx, nil
+}
+
+// encodeTx encodes an opaque construction transaction
+func encodeTx(ctx *constructionTx) (string, *Error) {
+	data, err := json.Marshal(ctx)
+	if err != nil {
+		return "", withDetails(ErrInternal, err)
+	}
+	return string(data), nil
+}
+
+// decodeSigned decodes a signed construction transaction
+func decodeSigned(s string) (*constructionTx, *Error) {
+	ctx, rerr := decodeTx(s)
+	if rerr != nil {
+		return nil, rerr
+	}
+	if ctx.Signed == nil {
+		return nil, withDetails(ErrInvalidRequest, errors.New("transaction is not signed"))
+	}
+	return ctx, nil
+}
+
+func (s *Server) constructionDerive(body json.RawMessage) (interface{}, *Error) {
+	var req struct {
+		networkRequest
+		PublicKey *PublicKey `json:"public_key"`
+		Metadata  struct {
+			ViewPublicKey string `json:"view_public_key"`
+		} `json:"metadata"`
+	}
+	if err := s.decode(body, &req, &req.networkRequest); err != nil {
+		return nil, err
+	}
+	if req.PublicKey == nil || req.PublicKey.CurveType != CurveType {
+		return nil, withDetails(ErrInvalidRequest, fmt.Errorf("public_key must use curve %s", CurveType))
+	}
+
+	// An address is a view key and spend key pair
+	var addr types.Address
+	if err := decodeKey(req.PublicKey.HexBytes, &addr.SpendKey); err != nil {
+		return nil, withDetails(ErrInvalidRequest, fmt.Errorf("public_key: %w", err))
+	}
+	if err := decodeKey(req.Metadata.ViewPublicKey, &addr.ViewKey); err != nil {
+		return nil, withDetails(ErrInvalidRequest, fmt.Errorf("metadata.view_public_key: %w", err))
+	}
+
+	return map[string]interface{}{
+		"account_identifier": &AccountIdentifier{Address: wallet.FormatAddress(s.network, addr)},
+	}, nil
+}
+
+// decodeKey decodes a hex public key
+func decodeKey(s string, dst *types.PublicKey) error {
+	raw, err := hex.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	if len(raw) != len(dst) {
+		return fmt.Errorf("key must be %d bytes", len(dst))
+	}
+	copy(dst[:], raw)
+	return nil
+}
+
+func (s *Server) constructionPreprocess(body json.RawMessage) (interface{}, *Error) {
+	var req struct {
+		networkRequest
+		Operations []*Operation `json:"operations"`
+	}
+	if err := s.decode(body, &req, &req.networkRequest); err != nil {
+		return nil, err
+	}
+
+	in, err := s.parseIntent(req.Operations)
+	if err != nil {
+		return nil, withDetails(ErrInvalidRequest, err)
+	}
+	if _, err := payments(s.network, in.Transfers); err != nil {
+		return nil, withDetails(ErrInvalidRequest, err)
+	}
+
+	return map[string]interface{}{"options": in}, nil
+}
+
+func (s *Server) constructionMetadata(body json.RawMessage) (interface{}, *Error) {
+	var req struct {
+		networkRequest
+		Options *intent `json:"options"`
+	}
+	if err := s.decode(body, &req, &req.networkRequest); err != nil {
+		return nil, err
+	}
+	if req.Options == nil {
+		return nil, withDetails(ErrInvalidRequest, errors.New("options are required"))
+	}
+
+	pays, err := payments(s.network, req.Options.Transfers)
+	if err != nil {
+		return nil, withDetails(ErrInvalidRequest, err)
+	}
+
+	chainID, err := s.backend.GetChainID()
+	if err != nil {
+		return nil, withDetails(ErrInternal, err)
+	}
+
+	fee, err := wallet.SuggestFee(s.backend, pays)
+	if err != nil {
+		return nil, withDetails(ErrInternal, err)
+	}
+	return map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"chain_id": chainID,
+			"fee":      fee,
+		},
+		"suggested_fee": []*Amount{s.unsignedAmount(fee)},
+	}, nil
+}
+
+func (s *Server) constructionPayloads(body json.RawMessage) (interface{}, *Error) {
+	var req struct {
+		networkRequest
+		Operations []*Operation `json:"operations"`
+		Metadata   struct {
+			ChainID string `json:"chain_id"`
+			Fee     uint64 `json:"fee"`
+		} `json:"metadata"`
+	}
+	if err := s.decode(body, &req, &req.networkRequest); err != nil {
+		return nil, err
+	}
+
+	in, err := s.parseIntent(req.Operations)
+	if err != nil {
+		return nil, withDetails(ErrInvalidRequest, err)
+	}
+	pays, err := payments(s.network, in.Transfers)
+	if err != nil {
+		return nil, withDetails(ErrInvalidRequest, err)
+	}
+	if req.Metadata.Fee < wallet.RequiredFee(pays) {
+		return nil, withDetails(ErrInvalidRequest, fmt.Errorf("fee must be at least %d", wallet.RequiredFee(pays)))
+	}
+
+	acct, err := s.accounts.get(s.network, in.Sender)
+	if err != nil {
+		return nil, withDetails(ErrAccountNotRegistered, err)
+	}
+	scan, err := acct.refresh(s.backend)
+	if err != nil {
+		return nil, withDetails(ErrInternal, err)
+	}
+
+	unsigned, _, err := wallet.BuildUnsigned(acct.keys, s.backend, scan, pays, req.Metadata.Fee, wallet.OutputPolicy{})
+	if err != nil {
+		return nil, withDetails(ErrInvalidRequest, err)
+	}
+	if req.Metadata.ChainID != "" && req.Metadata.ChainID != unsigned.ChainID {
+		return nil, withDetails(ErrInvalidNetwork, errors.New("metadata chain_id does not match this node"))
+	}
+
+	encoded, rerr := encodeTx(&constructionTx{Sender: in.Sender, Transfers: in.Transfers, Unsigned: unsigned})
+	if rerr != nil {
+		return nil, rerr
+	}
+
+	return map[string]interface{}{
+		"unsigned_transaction": encoded,
+		"payloads": []*SigningPayload{{
+			AccountIdentifier: &AccountIdentifier{Address: in.Sender},
+			HexBytes:          unsigned.ID(),
+			SignatureType:     SignatureType,
+		}},
+	}, nil
+}
+
+func (s *Server) constructionParse(body json.RawMessage) (interface{}, *Error) {
+	var req struct {
+		networkRequest
+		Signed      bool   `json:"signed"`
+		Transaction string `json:"transaction"`
+	}
+	if err := s.decode(body, &req, &req.networkRequest); err != nil {
+		return nil, err
+	}
+
+	ctx, rerr := decodeTx(req.Transaction)
+	if rerr != nil {
+		return nil, rerr
+	}
+	if req.Signed != (ctx.Signed != nil) {
+		return nil, withDetails(ErrInvalidRequest, fmt.Errorf("transaction signed state is %v", ctx.Signed != nil))
+	}
+
+	in := &intent{Sender: ctx.Sender, Transfers: ctx.Transfers}
+	signers := make([]*AccountIdentifier, 0)
+	if req.Signed {
+		signers = append(signers, &AccountIdentifier{Address: ctx.Sender})
+	}
+
+	return map[string]interface{}{
+		"operations":                 s.operations(in),
+		"account_identifier_signers": signers,
+	}, nil
+}
+
+func (s *Server) constructionCombine(body json.RawMessage) (interface{}, *Error) {
+	var req struct {
+		networkRequest
+		UnsignedTransaction string       `json:"unsigned_transaction"`
+		Signatures          []*Signature `json:"signatures"`
+	}
+	if err := s.decode(body, &req, &req.networkRequest); err != nil {
+		return nil, err
+	}
+	if len(req.Signatures) != 1 || req.Signatures[0] == nil {
+		return nil, withDetails(ErrInvalidRequest, errors.New("expected exactly one signature"))
+	}
+
+	ctx, rerr := decodeTx(req.UnsignedTransaction)
+	if rerr != nil {
+		return nil, rerr
+	}
+
+	// The signature is the transaction produced by 'wallet sign'
+	data, err := hex.DecodeString(req.Signatures[0].HexBytes)
+	if err != nil {
+		return nil, withDetails(ErrInvalidRequest, err)
+	}
+	var signed types.Transaction
+	if err := json.Unmarshal(data, &signed); err != nil {
+		return nil, withDetails(ErrInvalidRequest, fmt.Errorf("signature is not a signed transaction: %w", err))
+	}
+	if signed.RingSignature == nil || wallet.OutputsID(signed.Outputs) != ctx.Unsigned.ID() {
+		return nil, withDetails(ErrInvalidRequest, errors.New("signed transaction does not match the unsigned transaction"))
+	}
+	ctx.Signed = &signed
+
+	encoded, rerr := encodeTx(ctx)
+	if rerr != nil {
+		return nil, rerr
+	}
+
+	return map[string]interface{}{"signed_transaction": encoded}, nil
+}
+
+func (s *Server) constructionHash(body json.RawMessage) (interface{}, *Error) {
+	var req struct {
+		networkRequest
+		SignedTransaction string `json:"signed_transaction"`
+	}
+	if err := s.decode(body, &req, &req.networkRequest); err != nil {
+		return nil, err
+	}
+
+	ctx, rerr := decodeSigned(req.SignedTransaction)
+	if rerr != nil {
+		return nil, rerr
+	}
+
+	return map[string]interface{}{
+		"transaction_identifier": &TransactionIdentifier{Hash: ctx.Signed.Hash().String()},
+	}, nil
+}
+
+func (s *Server) constructionSubmit(body json.RawMessage) (interface{}, *Error) {
+	var req struct {
+		networkRequest
+		SignedTransaction string `json:"signed_transaction"`
+	}
+	if err := s.decode(body, &req, &req.networkRequest); err != nil {
+		return nil, err
+	}
+
+	ctx, rerr := decodeSigned(req.SignedTransaction)
+	if rerr != nil {
+		return nil, rerr
+	}
+
+	if err := s.backend.SubmitTransaction(ctx.Signed); err != nil {
+		return nil, withDetails(ErrSubmitFailed, err)
+	}
+
+	// View-only scans cannot see the spend, so remember it
+	if acct, err := s.accounts.get(s.network, ctx.Sender); err == nil {
+		for _, in := range ctx.Unsigned.Inputs {
+			acct.markSpent(wallet.FormatOutputRef(in.TxHash, in.OutputIndex))
+		}
+	}
+
+	return map[string]interface{}{
+		"transaction_identifier": &TransactionIdentifier{Hash: ctx.Signed.Hash().String()},
+	}, nil
+}
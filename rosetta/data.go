@@ -0,0 +1,410 @@
+package rosetta
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"blockchain/types"
+)
+
+// genesisIdentifier identifies block 0. The genesis block is implied by
+// the genesis file and never stored, so it has the zero hash.
+var genesisIdentifier = &BlockIdentifier{Index: 0, Hash: types.Hash{}.String()}
+
+// blockIdentifier returns the identifier of a stored block
+func blockIdentifier(block *types.Block) *BlockIdentifier {
+	return &BlockIdentifier{Index: int64(block.Header.Height), Hash: block.Header.Hash().String()}
+}
+
+// parentIdentifier returns the identifier of a block's parent
+func parentIdentifier(block *types.Block) *BlockIdentifier {
+	if block.Header.Height <= 1 {
+		return genesisIdentifier
+	}
+	return &BlockIdentifier{Index: int64(block.Header.Height - 1), Hash: block.Header.PrevBlockHash.String()}
+}
+
+// genesisTimestamp returns the genesis time in milliseconds
+func (s *Server) genesisTimestamp() (int64, error) {
+	genesis, err := s.backend.GetGenesis()
+	if err != nil {
+		return 0, err
+	}
+
+	t, err := time.Parse(time.RFC3339, genesis.GenesisTime)
+	if err != nil {
+		return 0, fmt.Errorf("invalid genesis time: %w", err)
+	}
+	return t.UnixNano() / int64(time.Millisecond), nil
+}
+
+func (s *Server) networkList(body json.RawMessage) (interface{}, *Error) {
+	chainID, err := s.backend.GetChainID()
+	if err != nil {
+		return nil, withDetails(ErrInternal, err)
+	}
+
+	return map[string]interface{}{
+		"network_identifiers": []*NetworkIdentifier{{Blockchain: Blockchain, Network: chainID}},
+	}, nil
+}
+
+func (s *Server) networkOptions(body json.RawMessage) (interface{}, *Error) {
+	var req networkRequest
+	if err := s.decode(body, &req, &req); err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"version": map[string]string{
+			"rosetta_version": Version,
+			"node_version":    fmt.Sprintf("%d", types.ProtocolVersion),
+		},
+		"allow": map[string]interface{}{
+			"operation_statuses":        []*OperationStatus{{Status: StatusSuccess, Successful: true}},
+			"operation_types":           []string{OpInput, OpOutput, OpFee, OpCoinbase, OpTreasury, OpRelease, OpBurn, OpTransfer},
+			"errors":                    allErrors,
+			"historical_balance_lookup": false,
+			"call_methods":              []string{CallRegisterViewKey},
+			"mempool_coins":             false,
+		},
+	}, nil
+}
+
+func (s *Server) networkStatus(body json.RawMessage) (interface{}, *Error) {
+	var req networkRequest
+	if err := s.decode(body, &req, &req); err != nil {
+		return nil, err
+	}
+
+	genesisTime, err := s.genesisTimestamp()
+	if err != nil {
+		return nil, withDetails(ErrInternal, err)
+	}
+
+	current, timestamp := genesisIdentifier, genesisTime
+	height, err := s.backend.GetLatestHeight()
+	if err != nil {
+		return nil, withDetails(ErrInternal, err)
+	}
+	if height > 0 {
+		block, err := s.backend.GetBlock(height)
+		if err != nil {
+			return nil, withDetails(ErrInternal, err)
+		}
+		current, timestamp = blockIdentifier(block), block.Header.Timestamp*1000
+	}
+
+	peers := make([]*Peer, 0)
+	for _, id := range s.backend.PeerIDs() {
+		peers = append(peers, &Peer{PeerID: id})
+	}
+
+	return map[string]interface{}{
+		"current_block_identifier": current,
+		"current_block_timestamp":  timestamp,
+		"genesis_block_identifier": genesisIdentifier,
+		"peers":                    peers,
+	}, nil
+}
+
+// findBlock resolves a partial block identifier. A nil block with no
+// error means the genesis block.
+func (s *Server) findBlock(id *PartialBlockIdentifier) (*types.Block, *Error) {
+	if id == nil || (id.Index == nil && id.Hash == nil) {
+		height, err := s.backend.GetLatestHeight()
+		if err != nil {
+			return nil, withDetails(ErrInternal, err)
+		}
+		idx := int64(height)
+		id = &PartialBlockIdentifier{Index: &idx}
+	}
+
+	var block *types.Block
+	switch {
+	case id.Index != nil:
+		if *id.Index < 0 {
+			return nil, withDetails(ErrInvalidRequest, errors.New("negative block index"))
+		}
+		if *id.Index == 0 {
+			break
+		}
+		b, err := s.backend.GetBlock(uint64(*id.Index))
+		if err != nil {
+			return nil, withDetails(ErrBlockNotFound, err)
+		}
+		block = b
+
+	default:
+		if *id.Hash == genesisIdentifier.Hash {
+			break
+		}
+		hash, err := types.HashFromString(*id.Hash)
+		if err != nil {
+			return nil, withDetails(ErrInvalidRequest, err)
+		}
+		b, err := s.backend.GetBlockByHash(hash)
+		if err != nil {
+			return nil, withDetails(ErrBlockNotFound, err)
+		}
+		block = b
+	}
+
+	// Both fields must agree when given together
+	if block != nil && id.Hash != nil && *id.Hash != block.Header.Hash().String() {
+		return nil, withDetails(ErrBlockNotFound, errors.New("block hash does not match index"))
+	}
+	if block == nil && ((id.Hash != nil && *id.Hash != genesisIdentifier.Hash) || (id.Index != nil && *id.Index != 0)) {
+		return nil, withDetails(ErrBlockNotFound, errors.New("block hash does not match index"))
+	}
+
+	return block, nil
+}
+
+func (s *Server) block(body json.RawMessage) (interface{}, *Error) {
+	var req struct {
+		networkRequest
+		BlockIdentifier *PartialBlockIdentifier `json:"block_identifier"`
+	}
+	if err := s.decode(body, &req, &req.networkRequest); err != nil {
+		return nil, err
+	}
+
+	block, rerr := s.findBlock(req.BlockIdentifier)
+	if rerr != nil {
+		return nil, rerr
+	}
+
+	if block == nil {
+		timestamp, err := s.genesisTimestamp()
+		if err != nil {
+			return nil, withDetails(ErrInternal, err)
+		}
+		return map[string]interface{}{
+			"block": &Block{
+				BlockIdentifier:       genesisIdentifier,
+				ParentBlockIdentifier: genesisIdentifier,
+				Timestamp:             timestamp,
+				Transactions:          []*Transaction{},
+			},
+		}, nil
+	}
+
+	txs := make([]*Transaction, len(block.Transactions))
+	for i, tx := range block.Transactions {
+		txs[i] = s.transaction(tx, true)
+	}
+
+	return map[string]interface{}{
+		"block": &Block{
+			BlockIdentifier:       blockIdentifier(block),
+			ParentBlockIdentifier: parentIdentifier(block),
+			Timestamp:             block.Header.Timestamp * 1000,
+			Transactions:          txs,
+		},
+	}, nil
+}
+
+func (s *Server) blockTransaction(body json.RawMessage) (interface{}, *Error) {
+	var req struct {
+		networkRequest
+		BlockIdentifier       *BlockIdentifier       `json:"block_identifier"`
+		TransactionIdentifier *TransactionIdentifier `json:"transaction_identifier"`
+	}
+	if err := s.decode(body, &req, &req.networkRequest); err != nil {
+		return nil, err
+	}
+	if req.BlockIdentifier == nil || req.TransactionIdentifier == nil {
+		return nil, withDetails(ErrInvalidRequest, errors.New("block_identifier and transaction_identifier are required"))
+	}
+
+	block, rerr := s.findBlock(&PartialBlockIdentifier{Index: &req.BlockIdentifier.Index, Hash: &req.BlockIdentifier.Hash})
+	if rerr != nil {
+		return nil, rerr
+	}
+	if block != nil {
+		for _, tx := range block.Transactions {
+			if tx.Hash().String() == req.TransactionIdentifier.Hash {
+				return map[string]interface{}{"transaction": s.transaction(tx, true)}, nil
+			}
+		}
+	}
+
+	return nil, withDetails(ErrTxNotFound, fmt.Errorf("transaction %s is not in block %d", req.TransactionIdentifier.Hash, req.BlockIdentifier.Index))
+}
+
+func (s *Server) mempool(body json.RawMessage) (interface{}, *Error) {
+	var req networkRequest
+	if err := s.decode(body, &req, &req); err != nil {
+		return nil, err
+	}
+
+	ids := make([]*TransactionIdentifier, 0)
+	for _, tx := range s.backend.MempoolTransactions() {
+		ids = append(ids, &TransactionIdentifier{Hash: tx.Hash().String()})
+	}
+
+	return map[string]interface{}{"transaction_identifiers": ids}, nil
+}
+
+func (s *Server) mempoolTransaction(body json.RawMessage) (interface{}, *Error) {
+	var req struct {
+		networkRequest
+		TransactionIdentifier *TransactionIdentifier `json:"transaction_identifier"`
+	}
+	if err := s.decode(body, &req, &req.networkRequest); err != nil {
+		return nil, err
+	}
+	if req.TransactionIdentifier == nil {
+		return nil, withDetails(ErrInvalidRequest, errors.New("transaction_identifier is required"))
+	}
+
+	for _, tx := range s.backend.MempoolTransactions() {
+		if tx.Hash().String() == req.TransactionIdentifier.Hash {
+			return map[string]interface{}{"transaction": s.transaction(tx, false)}, nil
+		}
+	}
+
+	return nil, withDetails(ErrTxNotFound, fmt.Errorf("transaction %s is not in the mempool", req.TransactionIdentifier.Hash))
+}
+
+// transaction maps a transaction to Rosetta operations. Inputs are
+// identified by key image and outputs by one-time key, since stealth
+// addresses hide the real sender and recipient. Operations of pending
+// transactions carry no status.
+func (s *Server) transaction(tx *types.Transaction, included bool) *Transaction {
+	ops := make([]*Operation, 0, len(tx.AllInputs())+len(tx.AllOutputs())+1)
+
+	var status *string
+	if included {
+		success := StatusSuccess
+		status = &success
+	}
+
+	add := func(opType string, account string, value *Amount) {
+		ops = append(ops, &Operation{
+			OperationIdentifier: &OperationIdentifier{Index: int64(len(ops))},
+			Type:                opType,
+			Status:              status,
+			Account:             &AccountIdentifier{Address: account},
+			Amount:              value,
+		})
+	}
+
+	for _, in := range tx.AllInputs() {
+		add(OpInput, in.KeyImage.String(), s.amount(-int64(in.Amount)))
+	}
+
+	outputType := OpOutput
+	if tx.IsCoinbase() {
+		outputType = OpCoinbase
+	} else if tx.IsTreasurySpend() {
+		outputType = OpTreasury
+	} else if tx.IsStakeRelease() {
+		outputType = OpRelease
+	}
+	for _, out := range tx.AllOutputs() {
+		if out.Burn {
+			ops = append(ops, &Operation{
+				OperationIdentifier: &OperationIdentifier{Index: int64(len(ops))},
+				Type:                OpBurn,
+				Status:              status,
+				Amount:              s.amount(-int64(out.Amount)),
+			})
+			continue
+		}
+		add(outputType, out.StealthAddr.SpendKey.String(), s.unsignedAmount(out.Amount))
+	}
+
+	if tx.Fee > 0 {
+		ops = append(ops, &Operation{
+			OperationIdentifier: &OperationIdentifier{Index: int64(len(ops))},
+			Type:                OpFee,
+			Status:              status,
+			Amount:              s.amount(-int64(tx.Fee)),
+		})
+	}
+
+	return &Transaction{
+		TransactionIdentifier: &TransactionIdentifier{Hash: tx.Hash().String()},
+		Operations:            ops,
+	}
+}
+
+func (s *Server) accountBalance(body json.RawMessage) (interface{}, *Error) {
+	var req struct {
+		networkRequest
+		AccountIdentifier *AccountIdentifier      `json:"account_identifier"`
+		BlockIdentifier   *PartialBlockIdentifier `json:"block_identifier"`
+	}
+	if err := s.decode(body, &req, &req.networkRequest); err != nil {
+		return nil, err
+	}
+	if req.AccountIdentifier == nil {
+		return nil, withDetails(ErrInvalidRequest, errors.New("account_identifier is required"))
+	}
+	if req.BlockIdentifier != nil {
+		return nil, withDetails(ErrUnsupported, errors.New("historical balance lookup"))
+	}
+
+	acct, err := s.accounts.get(s.network, req.AccountIdentifier.Address)
+	if err != nil {
+		return nil, withDetails(ErrAccountNotRegistered, err)
+	}
+
+	scan, err := acct.refresh(s.backend)
+	if err != nil {
+		return nil, withDetails(ErrInternal, err)
+	}
+
+	current := genesisIdentifier
+	if scan.ScannedHeight > 0 {
+		block, err := s.backend.GetBlock(scan.ScannedHeight)
+		if err != nil {
+			return nil, withDetails(ErrInternal, err)
+		}
+		current = blockIdentifier(block)
+	}
+
+	return map[string]interface{}{
+		"block_identifier": current,
+		"balances":         []*Amount{s.unsignedAmount(scan.Balance())},
+	}, nil
+}
+
+func (s *Server) call(body json.RawMessage) (interface{}, *Error) {
+	var req struct {
+		networkRequest
+		Method     string          `json:"method"`
+		Parameters json.RawMessage `json:"parameters"`
+	}
+	if err := s.decode(body, &req, &req.networkRequest); err != nil {
+		return nil, err
+	}
+
+	switch req.Method {
+	case CallRegisterViewKey:
+		var params struct {
+			Address string `json:"address"`
+			ViewKey string `json:"view_key"`
+		}
+		if err := json.Unmarshal(req.Parameters, &params); err != nil {
+			return nil, withDetails(ErrInvalidRequest, err)
+		}
+
+		address, err := s.accounts.register(s.network, params.Address, params.ViewKey)
+		if err != nil {
+			return nil, withDetails(ErrInvalidRequest, err)
+		}
+
+		return map[string]interface{}{
+			"result":     map[string]string{"address": address},
+			"idempotent": true,
+		}, nil
+
+	default:
+		return nil, withDetails(ErrUnsupported, fmt.Errorf("unknown call method %q", req.Method))
+	}
+}
@@ -0,0 +1,228 @@
+// Package rosetta implements the Rosetta Data and Construction APIs used
+// by exchanges to integrate with the chain.
+package rosetta
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"blockchain/types"
+	"blockchain/wallet"
+)
+
+// MaxRequestSize bounds the size of a request body
+const MaxRequestSize = 1 << 20
+
+// Errors returned by the API. All are listed in /network/options.
+var (
+	ErrInvalidNetwork       = &Error{Code: 1, Message: "Invalid network identifier"}
+	ErrBlockNotFound        = &Error{Code: 2, Message: "Block not found", Retriable: true}
+	ErrTxNotFound           = &Error{Code: 3, Message: "Transaction not found", Retriable: true}
+	ErrAccountNotRegistered = &Error{Code: 4, Message: "Account not registered, call register_view_key first"}
+	ErrInvalidRequest       = &Error{Code: 5, Message: "Invalid request"}
+	ErrUnsupported          = &Error{Code: 6, Message: "Not supported"}
+	ErrInternal             = &Error{Code: 7, Message: "Internal error", Retriable: true}
+	ErrSubmitFailed         = &Error{Code: 8, Message: "Transaction submission failed"}
+
+	allErrors = []*Error{
+		ErrInvalidNetwork, ErrBlockNotFound, ErrTxNotFound, ErrAccountNotRegistered,
+		ErrInvalidRequest, ErrUnsupported, ErrInternal, ErrSubmitFailed,
+	}
+)
+
+// withDetails returns a copy of base carrying the underlying error
+func withDetails(base *Error, err error) *Error {
+	e := *base
+	e.Details = &struct {
+		Error string `json:"error"`
+	}{Error: err.Error()}
+	return &e
+}
+
+// Backend provides the node data behind the API
+type Backend interface {
+	wallet.ChainReader
+	GetBlockByHash(hash types.Hash) (*types.Block, error)
+	GetGenesis() (*types.GenesisConfig, error)
+
+	// MempoolTransactions returns the pending transactions
+	MempoolTransactions() []*types.Transaction
+
+	// SubmitTransaction validates a transaction and relays it
+	SubmitTransaction(tx *types.Transaction) error
+
+	// PeerIDs returns the connected peers
+	PeerIDs() []string
+}
+
+// handler serves one endpoint from its decoded JSON body
+type handler func(body json.RawMessage) (interface{}, *Error)
+
+// Server serves the Rosetta API over HTTP
+type Server struct {
+	addr     string
+	backend  Backend
+	accounts *accountStore
+	currency *CurrencyObj  // The native coin, as the genesis denominates it
+	network  types.Network // Whose prefix account addresses carry
+
+	httpServer *http.Server
+	listener   net.Listener
+}
+
+// NewServer creates a server that will listen on addr
+func NewServer(addr string, backend Backend) *Server {
+	s := &Server{
+		addr:     addr,
+		backend:  backend,
+		accounts: newAccountStore(),
+	}
+
+	mux := http.NewServeMux()
+	routes := map[string]handler{
+		"/network/list":            s.networkList,
+		"/network/options":         s.networkOptions,
+		"/network/status":          s.networkStatus,
+		"/block":                   s.block,
+		"/block/transaction":       s.blockTransaction,
+		"/account/balance":         s.accountBalance,
+		"/mempool":                 s.mempool,
+		"/mempool/transaction":     s.mempoolTransaction,
+		"/call":                    s.call,
+		"/construction/derive":     s.constructionDerive,
+		"/construction/preprocess": s.constructionPreprocess,
+		"/construction/metadata":   s.constructionMetadata,
+		"/construction/payloads":   s.constructionPayloads,
+		"/construction/parse":      s.constructionParse,
+		"/construction/combine":    s.constructionCombine,
+		"/construction/hash":       s.constructionHash,
+		"/construction/submit":     s.constructionSubmit,
+	}
+	for path, h := range routes {
+		mux.Handle(path, h)
+	}
+
+	s.httpServer = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	return s
+}
+
+// Start begins listening in the background
+func (s *Server) Start() error {
+	genesis, err := s.backend.GetGenesis()
+	if err != nil {
+		return fmt.Errorf("failed to read genesis: %w", err)
+	}
+	s.currency = &CurrencyObj{
+		Symbol:   genesis.Denomination.Unit(),
+		Decimals: int32(genesis.Denomination.Decimals),
+	}
+	s.network = genesis.Network.OrDefault()
+
+	ln, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	s.listener = ln
+
+	go func() {
+		if err := s.httpServer.Serve(ln); err != nil && err != http.ErrServerClosed {
+			fmt.Printf("Rosetta server error: %v\n", err)
+		}
+	}()
+
+	return nil
+}
+
+// Addr returns the address the server is listening on
+func (s *Server) Addr() string {
+	if s.listener == nil {
+		return s.addr
+	}
+	return s.listener.Addr().String()
+}
+
+// Close shuts down the server
+func (s *Server) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return s.httpServer.Shutdown(ctx)
+}
+
+// ServeHTTP implements http.Handler for a single endpoint
+func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body json.RawMessage
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxRequestSize)).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, withDetails(ErrInvalidRequest, err))
+		return
+	}
+
+	result, rerr := h(body)
+	if rerr != nil {
+		writeJSON(w, http.StatusInternalServerError, rerr)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// writeJSON writes a JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// networkRequest is embedded by every request scoped to a network
+type networkRequest struct {
+	NetworkIdentifier *NetworkIdentifier `json:"network_identifier"`
+}
+
+// decode parses a request body and checks its network identifier
+func (s *Server) decode(body json.RawMessage, req interface{}, network *networkRequest) *Error {
+	if err := json.Unmarshal(body, req); err != nil {
+		return withDetails(ErrInvalidRequest, err)
+	}
+	return s.checkNetwork(network.NetworkIdentifier)
+}
+
+// checkNetwork rejects requests for another chain
+func (s *Server) checkNetwork(id *NetworkIdentifier) *Error {
+	if id == nil {
+		return withDetails(ErrInvalidNetwork, errors.New("missing network_identifier"))
+	}
+
+	chainID, err := s.backend.GetChainID()
+	if err != nil {
+		return withDetails(ErrInternal, err)
+	}
+
+	if id.Blockchain != Blockchain || id.Network != chainID {
+		return withDetails(ErrInvalidNetwork, fmt.Errorf("this node serves %s/%s", Blockchain, chainID))
+	}
+	return nil
+}
+
+// amount formats a signed coin amount in base units
+func (s *Server) amount(value int64) *Amount {
+	return &Amount{Value: fmt.Sprintf("%d", value), Currency: s.currency}
+}
+
+// unsignedAmount formats an unsigned coin amount in base units
+func (s *Server) unsignedAmount(value uint64) *Amount {
+	return &Amount{Value: fmt.Sprintf("%d", value), Currency: s.currency}
+}
@@ -0,0 +1,128 @@
+package rosetta
+
+// Rosetta API objects (https://www.rosetta-api.org/docs/api_objects.html).
+// Only the fields this implementation uses are declared.
+
+// Version is the Rosetta specification version implemented
+const Version = "1.4.13"
+
+// Blockchain is the blockchain name in network identifiers
+const Blockchain = "ApexCoin"
+
+// Operation types
+const (
+	OpInput    = "INPUT"    // Spends an output, account is the key image
+	OpOutput   = "OUTPUT"   // Creates an output, account is the one-time key
+	OpFee      = "FEE"      // Fee paid by a transaction
+	OpCoinbase = "COINBASE" // Block reward output
+	OpTreasury = "TREASURY" // Output paid out of the treasury
+	OpRelease  = "RELEASE"  // Output paying back unbonded stake
+	OpBurn     = "BURN"     // Amount destroyed by a burn output
+	OpTransfer = "TRANSFER" // Construction intent: debit sender or credit recipient
+)
+
+// StatusSuccess is the only operation status; failed transactions are
+// never included in blocks
+const StatusSuccess = "SUCCESS"
+
+// SignatureType marks the construction payload, which is signed by an
+// ApexCoin wallet rather than a generic signer (see construction.go)
+const SignatureType = "apex_ring"
+
+type NetworkIdentifier struct {
+	Blockchain string `json:"blockchain"`
+	Network    string `json:"network"`
+}
+
+type BlockIdentifier struct {
+	Index int64  `json:"index"`
+	Hash  string `json:"hash"`
+}
+
+type PartialBlockIdentifier struct {
+	Index *int64  `json:"index,omitempty"`
+	Hash  *string `json:"hash,omitempty"`
+}
+
+type TransactionIdentifier struct {
+	Hash string `json:"hash"`
+}
+
+type OperationIdentifier struct {
+	Index int64 `json:"index"`
+}
+
+type AccountIdentifier struct {
+	Address string `json:"address"`
+}
+
+type CurrencyObj struct {
+	Symbol   string `json:"symbol"`
+	Decimals int32  `json:"decimals"`
+}
+
+type Amount struct {
+	Value    string       `json:"value"`
+	Currency *CurrencyObj `json:"currency"`
+}
+
+type Operation struct {
+	OperationIdentifier *OperationIdentifier `json:"operation_identifier"`
+	Type                string               `json:"type"`
+	Status              *string              `json:"status,omitempty"`
+	Account             *AccountIdentifier   `json:"account,omitempty"`
+	Amount              *Amount              `json:"amount,omitempty"`
+}
+
+type Transaction struct {
+	TransactionIdentifier *TransactionIdentifier `json:"transaction_identifier"`
+	Operations            []*Operation           `json:"operations"`
+}
+
+type Block struct {
+	BlockIdentifier       *BlockIdentifier `json:"block_identifier"`
+	ParentBlockIdentifier *BlockIdentifier `json:"parent_block_identifier"`
+	Timestamp             int64            `json:"timestamp"` // Milliseconds
+	Transactions          []*Transaction   `json:"transactions"`
+}
+
+type Peer struct {
+	PeerID string `json:"peer_id"`
+}
+
+type SigningPayload struct {
+	AccountIdentifier *AccountIdentifier `json:"account_identifier"`
+	HexBytes          string             `json:"hex_bytes"`
+	SignatureType     string             `json:"signature_type"`
+}
+
+type PublicKey struct {
+	HexBytes  string `json:"hex_bytes"`
+	CurveType string `json:"curve_type"`
+}
+
+type Signature struct {
+	SigningPayload *SigningPayload `json:"signing_payload"`
+	PublicKey      *PublicKey      `json:"public_key,omitempty"`
+	SignatureType  string          `json:"signature_type"`
+	HexBytes       string          `json:"hex_bytes"`
+}
+
+type OperationStatus struct {
+	Status     string `json:"status"`
+	Successful bool   `json:"successful"`
+}
+
+// Error is a Rosetta error object
+type Error struct {
+	Code      int32  `json:"code"`
+	Message   string `json:"message"`
+	Retriable bool   `json:"retriable"`
+	Details   *struct {
+		Error string `json:"error"`
+	} `json:"details,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
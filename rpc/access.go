@@ -0,0 +1,157 @@
+package rpc
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Access is the level of authentication a method requires
+type Access int
+
+const (
+	// AccessPublic methods read chain data and are open to anyone
+	AccessPublic Access = iota
+
+	// AccessWrite methods change node state, such as submitting a
+	// transaction; they are public unless writes are restricted
+	AccessWrite
+
+	// AccessAdmin methods need the admin token or a client certificate
+	AccessAdmin
+)
+
+var accessNames = map[Access]string{
+	AccessPublic: "public",
+	AccessWrite:  "write",
+	AccessAdmin:  "admin",
+}
+
+func (a Access) String() string {
+	if name, ok := accessNames[a]; ok {
+		return name
+	}
+	return fmt.Sprintf("access(%d)", int(a))
+}
+
+// ParseAccess parses an access level name: public, write or admin
+func ParseAccess(name string) (Access, error) {
+	for a, n := range accessNames {
+		if n == name {
+			return a, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown access level %q (want public, write or admin)", name)
+}
+
+// SetAccess changes the access level of a registered method
+func (s *Server) SetAccess(method string, access Access) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.methods[method]; !ok {
+		return fmt.Errorf("unknown method %q", method)
+	}
+	s.access[method] = access
+	return nil
+}
+
+// SetRestrictWrites makes write methods require the same
+// authentication as admin methods. It must be called before Start.
+func (s *Server) SetRestrictWrites(restrict bool) {
+	s.restrictWrites = restrict
+}
+
+// TLSConfig names the files used to serve RPC over TLS
+type TLSConfig struct {
+	CertFile string
+	KeyFile  string
+
+	// ClientCAFile, if set, lets clients authenticate with a
+	// certificate signed by one of its CAs instead of the admin token
+	ClientCAFile string
+}
+
+// SetTLS serves RPC over TLS. It must be called before Start.
+func (s *Server) SetTLS(cfg TLSConfig) error {
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return errors.New("TLS needs both a certificate and a key file")
+	}
+
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates in client CA file %s", cfg.ClientCAFile)
+		}
+
+		// Public methods stay open to clients without a certificate
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	s.tlsConfig = tlsConfig
+	return nil
+}
+
+// SetCORSOrigins lets browser pages from origins call the server; "*"
+// allows any origin. It must be called before Start.
+func (s *Server) SetCORSOrigins(origins []string) {
+	s.corsOrigins = make(map[string]bool, len(origins))
+	for _, origin := range origins {
+		s.corsOrigins[strings.TrimSuffix(origin, "/")] = true
+	}
+}
+
+// allowCORS adds CORS headers for an allowed origin and reports whether
+// it did
+func (s *Server) allowCORS(w http.ResponseWriter, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || !(s.corsOrigins["*"] || s.corsOrigins[origin]) {
+		return false
+	}
+
+	h := w.Header()
+	h.Set("Access-Control-Allow-Origin", origin)
+	h.Add("Vary", "Origin")
+	h.Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	h.Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+	h.Set("Access-Control-Max-Age", "600")
+	return true
+}
+
+// authenticated reports whether a request carries the admin token or a
+// verified client certificate
+func (s *Server) authenticated(r *http.Request) bool {
+	if token := s.adminToken.Load(); token != nil && *token != "" && bearerMatches(r, *token) {
+		return true
+	}
+	return r.TLS != nil && len(r.TLS.VerifiedChains) > 0
+}
+
+// credential identifies how an authenticated request authenticated: by
+// client certificate subject and serial, or by the admin token
+func credential(r *http.Request) string {
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		cert := r.TLS.VerifiedChains[0][0]
+		return "cert:" + cert.Subject.String() + "/" + cert.SerialNumber.String()
+	}
+	return "token"
+}
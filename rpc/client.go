@@ -0,0 +1,105 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Client calls methods on a node's RPC server
+type Client struct {
+	url        string
+	httpClient *http.Client
+	nextID     uint64
+	authToken  string
+	signingKey string // See unix.go
+}
+
+// NewClient creates a client for the server at url
+func NewClient(url string) *Client {
+	return &Client{
+		url:        url,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// SetProxy routes requests through a SOCKS5 proxy (host:port), such as
+// Tor. Host names, including .onion, are resolved by the proxy.
+func (c *Client) SetProxy(addr string) {
+	proxyURL := &url.URL{Scheme: "socks5", Host: addr}
+	c.httpClient.Transport = &http.Transport{Proxy: http.ProxyURL(proxyURL)}
+}
+
+// SetAuthToken sets the bearer token sent with every request
+func (c *Client) SetAuthToken(token string) {
+	c.authToken = token
+}
+
+// Call invokes method with params and decodes the result into result.
+// A nil result discards the response payload.
+func (c *Client) Call(method string, params interface{}, result interface{}) error {
+	id := atomic.AddUint64(&c.nextID, 1)
+
+	req := Request{
+		JSONRPC: "2.0",
+		ID:      json.RawMessage(strconv.FormatUint(id, 10)),
+		Method:  method,
+	}
+
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		req.Params = data
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	httpReq, err := http.NewRequest(http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if c.authToken != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.authToken)
+	}
+	if c.signingKey != "" {
+		if err := c.sign(httpReq, body); err != nil {
+			return err
+		}
+	}
+
+	httpResp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		return fmt.Errorf("rpc request failed: %s", httpResp.Status)
+	}
+
+	var resp Response
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return err
+	}
+
+	if resp.Error != nil {
+		return resp.Error
+	}
+
+	if result == nil || len(resp.Result) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(resp.Result, result)
+}
@@ -0,0 +1,230 @@
+package rpc
+
+import (
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// CodeRateLimited is returned with HTTP 429 when a client exceeds its
+// request quota
+const CodeRateLimited = -32005
+
+const (
+	// limiterIdle is how long an idle client's quota is kept
+	limiterIdle = 10 * time.Minute
+
+	limiterSweepInterval = time.Minute
+)
+
+// RateLimitConfig sets request quotas. Clients are limited per IP
+// address, or per credential once they authenticate with the admin
+// token or a client certificate. Each call spends its method's cost
+// from the quota.
+type RateLimitConfig struct {
+	Enabled bool
+
+	Rate  float64 // Cost units per second per IP address
+	Burst int     // Cost units an idle IP address may spend at once
+
+	// Quota of authenticated clients; a zero rate leaves them unlimited
+	AuthRate  float64
+	AuthBurst int
+
+	// Costs weighs expensive methods; others cost 1. A cost above the
+	// burst spends the whole burst.
+	Costs map[string]int
+}
+
+// DefaultRateLimitConfig returns quotas suitable for a public RPC node.
+// Rate limiting is disabled until Enabled is set.
+func DefaultRateLimitConfig() RateLimitConfig {
+	return RateLimitConfig{
+		Rate:      20,
+		Burst:     40,
+		AuthRate:  0,
+		AuthBurst: 0,
+		Costs:     make(map[string]int),
+	}
+}
+
+// Validate checks the quotas are usable
+func (c RateLimitConfig) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.Rate <= 0 || c.Burst <= 0 {
+		return errors.New("rate limit rate and burst must be positive")
+	}
+	if c.AuthRate < 0 || (c.AuthRate > 0 && c.AuthBurst <= 0) {
+		return errors.New("authenticated rate limit needs a positive burst")
+	}
+	for method, cost := range c.Costs {
+		if cost <= 0 {
+			return errors.New("cost of " + method + " must be positive")
+		}
+	}
+	return nil
+}
+
+// cost returns the quota a method call spends
+func (c RateLimitConfig) cost(method string) int {
+	if cost, ok := c.Costs[method]; ok {
+		return cost
+	}
+	return 1
+}
+
+// rateLimiter tracks the quota of each client
+type rateLimiter struct {
+	config RateLimitConfig
+
+	mu        sync.Mutex
+	clients   map[string]*clientQuota
+	lastSweep time.Time
+	throttled map[string]uint64 // Rejected calls per method
+}
+
+type clientQuota struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+func newRateLimiter(config RateLimitConfig) *rateLimiter {
+	return &rateLimiter{
+		config:    config,
+		clients:   make(map[string]*clientQuota),
+		lastSweep: time.Now(),
+		throttled: make(map[string]uint64),
+	}
+}
+
+// allow spends the cost of a call from the client's quota. If the quota
+// is exhausted it returns false and how long until the call would fit.
+func (l *rateLimiter) allow(r *http.Request, method string, authenticated bool) (bool, time.Duration) {
+	limit, burst := rate.Limit(l.config.Rate), l.config.Burst
+	key := "ip:" + clientIP(r)
+	if authenticated {
+		if l.config.AuthRate == 0 {
+			return true, 0
+		}
+		limit, burst = rate.Limit(l.config.AuthRate), l.config.AuthBurst
+		key = credential(r)
+	}
+
+	cost := l.config.cost(method)
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > limiterSweepInterval {
+		for k, c := range l.clients {
+			if now.Sub(c.lastSeen) > limiterIdle {
+				delete(l.clients, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	c, ok := l.clients[key]
+	if !ok {
+		c = &clientQuota{limiter: rate.NewLimiter(limit, burst)}
+		l.clients[key] = c
+	}
+	c.lastSeen = now
+
+	if c.limiter.AllowN(now, min(cost, burst)) {
+		return true, 0
+	}
+
+	l.throttled[method]++
+	wait := time.Duration(float64(cost) / float64(limit) * float64(time.Second))
+	return false, wait
+}
+
+// clientIP returns the address a request came from. Proxies in front
+// of the node make all clients share one quota.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// knownMethod returns the method name, or "unknown" for methods not
+// registered, so arbitrary names cannot grow the throttle counters
+func (s *Server) knownMethod(method string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.methods[method]; !ok {
+		return "unknown"
+	}
+	return method
+}
+
+// SetRateLimit enables request quotas, or changes them while the server
+// runs. Clients start over with full quotas; throttle counts are kept
+// unless rate limiting is disabled.
+func (s *Server) SetRateLimit(config RateLimitConfig) {
+	if !config.Enabled {
+		s.limiter.Store(nil)
+		return
+	}
+
+	limiter := newRateLimiter(config)
+	if old := s.limiter.Load(); old != nil {
+		old.mu.Lock()
+		for method, count := range old.throttled {
+			limiter.throttled[method] = count
+		}
+		old.mu.Unlock()
+	}
+	s.limiter.Store(limiter)
+}
+
+// ThrottleStats counts calls rejected for exceeding a quota
+type ThrottleStats struct {
+	Method string
+	Count  uint64
+}
+
+// Throttled returns rejected calls per method since start, sorted by
+// method. It is empty when rate limiting is disabled.
+func (s *Server) Throttled() []ThrottleStats {
+	limiter := s.limiter.Load()
+	if limiter == nil {
+		return nil
+	}
+
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	stats := make([]ThrottleStats, 0, len(limiter.throttled))
+	for method, count := range limiter.throttled {
+		stats = append(stats, ThrottleStats{Method: method, Count: count})
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Method < stats[j].Method })
+	return stats
+}
+
+// writeRateLimited rejects a call with HTTP 429
+func writeRateLimited(w http.ResponseWriter, req *Request, wait time.Duration) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	w.WriteHeader(http.StatusTooManyRequests)
+	writeResponse(w, &Response{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Error:   &Error{Code: CodeRateLimited, Message: "rate limit exceeded"},
+	})
+}
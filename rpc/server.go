@@ -0,0 +1,370 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Standard JSON-RPC 2.0 error codes
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+
+	// CodeUnauthorized is returned for admin methods, and restricted
+	// write methods, called without the admin token or a client
+	// certificate
+	CodeUnauthorized = -32001
+
+	// CodeTxRejected is returned for a transaction the node refused. The
+	// error data holds its reject_code (see types.RejectCode).
+	CodeTxRejected = -32010
+)
+
+// MaxRequestSize bounds the size of a request body
+const MaxRequestSize = 1 << 20
+
+// Request is a JSON-RPC 2.0 request
+type Request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// Response is a JSON-RPC 2.0 response
+type Response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// Error is a JSON-RPC error object
+type Error struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+// InvalidParams wraps a parameter decoding or validation failure
+func InvalidParams(err error) *Error {
+	return &Error{Code: CodeInvalidParams, Message: err.Error()}
+}
+
+// Handler processes the params of a single method call
+type Handler func(params json.RawMessage) (interface{}, error)
+
+// Server serves JSON-RPC requests over HTTP
+type Server struct {
+	addr       string
+	socketPath string // Set for unix socket servers (see unix.go)
+
+	mu      sync.RWMutex
+	methods map[string]Handler
+
+	// Plain HTTP endpoints served alongside JSON-RPC
+	endpoints map[string]http.HandlerFunc
+
+	// authToken, if set, must be sent as a bearer token
+	authToken string
+
+	// Methods above AccessPublic require adminToken or a verified
+	// client certificate (see access.go)
+	access         map[string]Access
+	adminToken     atomic.Pointer[string]
+	restrictWrites bool
+
+	// signingKey, if set, must sign every request, and seenNonces holds
+	// the nonces of recent ones (see unix.go)
+	signingKey atomic.Pointer[string]
+	nonceMu    sync.Mutex
+	seenNonces map[string]time.Time
+
+	tlsConfig   *tls.Config // nil serves plain HTTP
+	corsOrigins map[string]bool
+
+	limiter atomic.Pointer[rateLimiter] // nil without quotas (see ratelimit.go)
+
+	panicHandler PanicHandler // nil only logs panics in methods
+
+	httpServer *http.Server
+	listener   net.Listener
+}
+
+// NewServer creates a server that will listen on addr
+func NewServer(addr string) *Server {
+	s := &Server{
+		addr:      addr,
+		methods:   make(map[string]Handler),
+		endpoints: make(map[string]http.HandlerFunc),
+		access:    make(map[string]Access),
+
+		seenNonces: make(map[string]time.Time),
+	}
+
+	s.httpServer = &http.Server{
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	return s
+}
+
+// Register adds a method handler, replacing any existing one
+func (s *Server) Register(method string, handler Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.methods[method] = handler
+}
+
+// RegisterAdmin adds a method handler that requires the admin token
+func (s *Server) RegisterAdmin(method string, handler Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.methods[method] = handler
+	s.access[method] = AccessAdmin
+}
+
+// RegisterWrite adds a method handler that changes node state, such as
+// submitting a transaction. It is public unless writes are restricted.
+func (s *Server) RegisterWrite(method string, handler Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.methods[method] = handler
+	s.access[method] = AccessWrite
+}
+
+// PanicHandler is told about a panic recovered in a method handler: the
+// method, the panic value and the goroutine's stack
+type PanicHandler func(method string, value interface{}, stack []byte)
+
+// SetPanicHandler sets the function told about panics in method
+// handlers, which fail the call with an internal error. It must be
+// called before Start.
+func (s *Server) SetPanicHandler(handler PanicHandler) {
+	s.panicHandler = handler
+}
+
+// SetAdminToken sets the bearer token required by admin methods. It
+// may be called while serving, to rotate the token.
+func (s *Server) SetAdminToken(token string) {
+	s.adminToken.Store(&token)
+}
+
+// HandleHTTP serves a plain HTTP endpoint at path, such as a health
+// check. Endpoints do not require the auth token.
+func (s *Server) HandleHTTP(path string, handler http.HandlerFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.endpoints[path] = handler
+}
+
+// SetAuthToken requires clients to send token in the Authorization
+// header. It must be called before Start.
+func (s *Server) SetAuthToken(token string) {
+	s.authToken = token
+}
+
+// Start begins listening in the background
+func (s *Server) Start() error {
+	ln, err := s.listen()
+	if err != nil {
+		return err
+	}
+	if s.tlsConfig != nil {
+		ln = tls.NewListener(ln, s.tlsConfig)
+	}
+	s.listener = ln
+
+	go func() {
+		if err := s.httpServer.Serve(ln); err != nil && err != http.ErrServerClosed {
+			fmt.Printf("RPC server error: %v\n", err)
+		}
+	}()
+
+	return nil
+}
+
+// Addr returns the address the server is listening on
+func (s *Server) Addr() string {
+	if s.listener == nil {
+		return s.addr
+	}
+	return s.listener.Addr().String()
+}
+
+// Close shuts down the server
+func (s *Server) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return s.httpServer.Shutdown(ctx)
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.allowCORS(w, r) && r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	s.mu.RLock()
+	endpoint, exists := s.endpoints[r.URL.Path]
+	s.mu.RUnlock()
+
+	if exists {
+		endpoint(w, r)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if s.authToken != "" && !bearerMatches(r, s.authToken) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxRequestSize))
+	if err == nil {
+		if err := s.verifySignature(r, body); err != nil {
+			http.Error(w, "unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+	}
+
+	var req Request
+	if err == nil {
+		err = json.NewDecoder(bytes.NewReader(body)).Decode(&req)
+	}
+	if err != nil {
+		writeResponse(w, &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: CodeParseError, Message: err.Error()},
+		})
+		return
+	}
+
+	authenticated := s.authenticated(r)
+	if limiter := s.limiter.Load(); limiter != nil {
+		if ok, wait := limiter.allow(r, s.knownMethod(req.Method), authenticated); !ok {
+			writeRateLimited(w, &req, wait)
+			return
+		}
+	}
+
+	writeResponse(w, s.dispatch(&req, authenticated))
+}
+
+// bearerMatches checks the request's bearer token in constant time
+func bearerMatches(r *http.Request, token string) bool {
+	sent := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(sent), []byte(token)) == 1
+}
+
+// dispatch runs a request against the registered handlers
+func (s *Server) dispatch(req *Request, isAdmin bool) *Response {
+	resp := &Response{JSONRPC: "2.0", ID: req.ID}
+
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		resp.Error = &Error{Code: CodeInvalidRequest, Message: "invalid request"}
+		return resp
+	}
+
+	s.mu.RLock()
+	handler, exists := s.methods[req.Method]
+	access := s.access[req.Method]
+	s.mu.RUnlock()
+
+	if !exists {
+		resp.Error = &Error{Code: CodeMethodNotFound, Message: "method not found: " + req.Method}
+		return resp
+	}
+
+	if access == AccessAdmin && !isAdmin {
+		resp.Error = &Error{Code: CodeUnauthorized, Message: "admin authentication required"}
+		return resp
+	}
+	if access == AccessWrite && s.restrictWrites && !isAdmin {
+		resp.Error = &Error{Code: CodeUnauthorized, Message: "authentication required for " + req.Method}
+		return resp
+	}
+
+	result, err := s.call(req.Method, handler, req.Params)
+	if err != nil {
+		if rpcErr, ok := err.(*Error); ok {
+			resp.Error = rpcErr
+		} else {
+			resp.Error = &Error{Code: CodeInternalError, Message: err.Error()}
+		}
+		return resp
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		resp.Error = &Error{Code: CodeInternalError, Message: err.Error()}
+		return resp
+	}
+	resp.Result = data
+
+	return resp
+}
+
+// call runs a method handler, turning a panic into an internal error
+func (s *Server) call(method string, handler Handler, params json.RawMessage) (result interface{}, err error) {
+	defer func() {
+		if value := recover(); value != nil {
+			stack := debug.Stack()
+			if s.panicHandler != nil {
+				s.panicHandler(method, value, stack)
+			} else {
+				fmt.Printf("RPC: panic in %s: %v\n%s", method, value, stack)
+			}
+			result, err = nil, &Error{Code: CodeInternalError, Message: "internal error"}
+		}
+	}()
+	return handler(params)
+}
+
+// writeResponse encodes a response as JSON
+func writeResponse(w http.ResponseWriter, resp *Response) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// DecodeParams decodes method params into v, reporting failures as
+// invalid-params errors
+func DecodeParams(params json.RawMessage, v interface{}) error {
+	if len(params) == 0 {
+		return InvalidParams(fmt.Errorf("missing params"))
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return InvalidParams(err)
+	}
+	return nil
+}
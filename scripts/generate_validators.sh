@@ -6,7 +6,7 @@ Write-Host "============================" -ForegroundColor Cyan
 
 # Build wallet tool
 Write-Host "`nBuilding wallet tool..." -ForegroundColor Yellow
-go build -o bin\wallet.exe cmd\wallet\main.go
+go build -o bin\wallet.exe .\cmd\wallet
 
 if ($LASTEXITCODE -ne 0) {
     Write-Host "❌ Failed to build wallet" -ForegroundColor Red
@@ -20,8 +20,8 @@ if (-not (Test-Path "validator1.json") -or -not (Test-Path "validator2.json") -o
 
 # Build binaries
 Write-Host "`nBuilding node and wallet..." -ForegroundColor Yellow
-go build -o bin\node.exe cmd\node\main.go
-go build -o bin\wallet.exe cmd\wallet\main.go
+go build -o bin\node.exe .\cmd\node
+go build -o bin\wallet.exe .\cmd\wallet
 
 if ($LASTEXITCODE -ne 0) {
     Write-Host "❌ Build failed!" -ForegroundColor Red
@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"errors"
+
+	"github.com/dgraph-io/badger/v3"
+)
+
+// badgerStore is the default engine, a BadgerDB directory
+type badgerStore struct {
+	db *badger.DB
+}
+
+func openBadger(path string, opts Options) (KVStore, error) {
+	bopts := badger.DefaultOptions(path)
+	bopts.Logger = nil // Disable logging for now
+	bopts.ReadOnly = opts.ReadOnly
+	if opts.Archive {
+		// Large block and index caches, and level 0 compacted early so
+		// a lookup touches few tables
+		bopts.BlockCacheSize = 1 << 30
+		bopts.IndexCacheSize = 512 << 20
+		bopts.NumLevelZeroTables = 2
+		bopts.CompactL0OnClose = true
+	}
+
+	db, err := badger.Open(bopts)
+	if err != nil {
+		return nil, err
+	}
+	return &badgerStore{db: db}, nil
+}
+
+func (s *badgerStore) Get(key []byte) ([]byte, error) {
+	var value []byte
+	err := s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(key)
+		if err != nil {
+			return err
+		}
+		value, err = item.ValueCopy(nil)
+		return err
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, ErrNotFound
+	}
+	return value, err
+}
+
+func (s *badgerStore) Set(key, value []byte) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(key, value)
+	})
+}
+
+func (s *badgerStore) Delete(key []byte) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(key)
+	})
+}
+
+func (s *badgerStore) Iterate(prefix, start []byte, reverse bool, fn func(key, value []byte) bool) error {
+	return s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Reverse = reverse
+		opts.Prefix = prefix
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		seek := start
+		if seek == nil {
+			seek = prefix
+			if reverse {
+				// Past every key with the prefix
+				seek = append(append([]byte{}, prefix...), 0xff)
+			}
+		}
+		for it.Seek(seek); it.Valid(); it.Next() {
+			item := it.Item()
+			var more bool
+			err := item.Value(func(val []byte) error {
+				more = fn(item.Key(), val)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if !more {
+				return nil
+			}
+		}
+		return nil
+	})
+}
+
+func (s *badgerStore) NewBatch() Batch {
+	return &badgerBatch{txn: s.db.NewTransaction(true)}
+}
+
+func (s *badgerStore) Close() error {
+	return s.db.Close()
+}
+
+// badgerBatch is a read-write transaction, so a batch is atomic
+type badgerBatch struct {
+	txn *badger.Txn
+}
+
+func (b *badgerBatch) Set(key, value []byte) error {
+	return b.txn.Set(key, value)
+}
+
+func (b *badgerBatch) Delete(key []byte) error {
+	return b.txn.Delete(key)
+}
+
+func (b *badgerBatch) Commit() error {
+	return b.txn.Commit()
+}
+
+func (b *badgerBatch) Discard() {
+	b.txn.Discard()
+}
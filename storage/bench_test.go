@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"testing"
+
+	"blockchain/crypto"
+	"blockchain/types"
+)
+
+// BenchmarkSaveBlock writes blocks of 100 ring-signed transactions and
+// their transaction indexes to a database in a temporary directory
+func BenchmarkSaveBlock(b *testing.B) {
+	const blockTxs = 100
+	db, err := Open(b.TempDir())
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+
+	txs := newBenchTransactions(b, blockTxs)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		block := &types.Block{Header: types.BlockHeader{Height: uint64(i + 1)}, Transactions: txs}
+		if err := db.SaveBlock(block); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(b.N*blockTxs)/b.Elapsed().Seconds(), "tx/s")
+}
+
+// newBenchTransactions creates n transactions the size of real ones,
+// each with a ring of eleven. The database does not validate them.
+func newBenchTransactions(b *testing.B, n int) []*types.Transaction {
+	keys, err := crypto.GenerateWalletKeys()
+	if err != nil {
+		b.Fatal(err)
+	}
+	decoys := make([]types.PublicKey, 10)
+	for i := range decoys {
+		decoy, err := crypto.GenerateKeyPair()
+		if err != nil {
+			b.Fatal(err)
+		}
+		decoys[i] = decoy.PublicKey
+	}
+
+	txs := make([]*types.Transaction, n)
+	for i := range txs {
+		kp, err := crypto.GenerateKeyPair()
+		if err != nil {
+			b.Fatal(err)
+		}
+		output, _, err := crypto.GenerateStealthAddress(keys.GetAddress())
+		if err != nil {
+			b.Fatal(err)
+		}
+		output.Amount = 1000
+
+		tx := &types.Transaction{
+			Version: 1,
+			Inputs: []*types.TxInput{{
+				KeyImage: crypto.GenerateKeyImage(kp.PrivateKey, kp.PublicKey),
+				Amount:   1000,
+			}},
+			Outputs: []*types.TxOutput{output},
+		}
+		signer, err := crypto.NewRingSigner(kp.PrivateKey, kp.PublicKey, decoys)
+		if err != nil {
+			b.Fatal(err)
+		}
+		prefix := tx.PrefixHash()
+		if tx.RingSignature, err = signer.Sign(prefix[:]); err != nil {
+			b.Fatal(err)
+		}
+		txs[i] = tx
+	}
+	return txs
+}
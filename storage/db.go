@@ -1,29 +1,41 @@
 package storage
 
 import (
+	"encoding/binary"
 	"encoding/json"
 	"errors"
+	"fmt"
 	
-	"github.com/dgraph-io/badger/v3"
 	"blockchain/types"
 )
 
-// Database wraps BadgerDB for blockchain storage
+// Database stores the chain in a key-value engine (see kv.go)
 type Database struct {
-	db *badger.DB
+	db KVStore
 }
 
-// Open opens or creates a BadgerDB database
+// NewDatabase stores the chain in store
+func NewDatabase(store KVStore) *Database {
+	return &Database{db: store}
+}
+
+// Open opens or creates a database with the default engine
 func Open(path string) (*Database, error) {
-	opts := badger.DefaultOptions(path)
-	opts.Logger = nil // Disable logging for now
-	
-	db, err := badger.Open(opts)
-	if err != nil {
-		return nil, err
-	}
-	
-	return &Database{db: db}, nil
+	return OpenEngine(DefaultEngine, path, Options{})
+}
+
+// OpenArchive opens or creates a database tuned for an archive node,
+// which serves random reads of old blocks more than it writes: large
+// block and index caches, and level 0 compacted early so a lookup
+// touches few tables. Nothing is ever pruned from the database.
+func OpenArchive(path string) (*Database, error) {
+	return OpenEngine(DefaultEngine, path, Options{Archive: true})
+}
+
+// OpenReadOnly opens an existing database without write access.
+// Used by tools such as the wallet that only read chain data.
+func OpenReadOnly(path string) (*Database, error) {
+	return OpenEngine(DefaultEngine, path, Options{ReadOnly: true})
 }
 
 // Close closes the database
@@ -33,42 +45,66 @@ func (d *Database) Close() error {
 
 // SaveBlock saves a block to database
 func (d *Database) SaveBlock(block *types.Block) error {
-	return d.db.Update(func(txn *badger.Txn) error {
-		// Serialize block
-		data, err := json.Marshal(block)
+	batch := d.db.NewBatch()
+	defer batch.Discard()
+	
+	// Serialize block
+	data, err := json.Marshal(block)
+	if err != nil {
+		return err
+	}
+	
+	// Save by height
+	key := makeBlockKey(block.Header.Height)
+	if err := batch.Set(key, data); err != nil {
+		return err
+	}
+	
+	// Save by hash
+	hashKey := makeBlockHashKey(block.Header.Hash())
+	if err := batch.Set(hashKey, data); err != nil {
+		return err
+	}
+	
+	// Index transactions so they can be looked up by hash
+	for _, tx := range block.Transactions {
+		txData, err := json.Marshal(tx)
 		if err != nil {
 			return err
 		}
-		
-		// Save by height
-		key := makeBlockKey(block.Header.Height)
-		if err := txn.Set(key, data); err != nil {
+		if err := batch.Set(makeTxKey(tx.Hash()), txData); err != nil {
 			return err
 		}
-		
-		// Save by hash
-		hashKey := makeBlockHashKey(block.Header.Hash())
-		return txn.Set(hashKey, data)
-	})
+	}
+	
+	return batch.Commit()
+}
+
+// getJSON decodes the value of key into v
+func (d *Database) getJSON(key []byte, v interface{}) error {
+	data, err := d.db.Get(key)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	return nil
+}
+
+// setJSON stores v encoded under key
+func (d *Database) setJSON(key []byte, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return d.db.Set(key, data)
 }
 
 // GetBlock retrieves a block by height
 func (d *Database) GetBlock(height uint64) (*types.Block, error) {
 	var block types.Block
-	
-	err := d.db.View(func(txn *badger.Txn) error {
-		key := makeBlockKey(height)
-		item, err := txn.Get(key)
-		if err != nil {
-			return err
-		}
-		
-		return item.Value(func(val []byte) error {
-			return json.Unmarshal(val, &block)
-		})
-	})
-	
-	if err != nil {
+	if err := d.getJSON(makeBlockKey(height), &block); err != nil {
 		return nil, err
 	}
 	
@@ -78,20 +114,7 @@ func (d *Database) GetBlock(height uint64) (*types.Block, error) {
 // GetBlockByHash retrieves a block by hash
 func (d *Database) GetBlockByHash(hash types.Hash) (*types.Block, error) {
 	var block types.Block
-	
-	err := d.db.View(func(txn *badger.Txn) error {
-		key := makeBlockHashKey(hash)
-		item, err := txn.Get(key)
-		if err != nil {
-			return err
-		}
-		
-		return item.Value(func(val []byte) error {
-			return json.Unmarshal(val, &block)
-		})
-	})
-	
-	if err != nil {
+	if err := d.getJSON(makeBlockHashKey(hash), &block); err != nil {
 		return nil, err
 	}
 	
@@ -110,78 +133,37 @@ func (d *Database) GetLatestBlock() (*types.Block, error) {
 
 // GetLatestHeight retrieves the latest block height
 func (d *Database) GetLatestHeight() (uint64, error) {
-	var height uint64
-	
-	err := d.db.View(func(txn *badger.Txn) error {
-		item, err := txn.Get([]byte("latest_height"))
-		if err != nil {
-			if errors.Is(err, badger.ErrKeyNotFound) {
-				height = 0
-				return nil
-			}
-			return err
+	val, err := d.db.Get([]byte("latest_height"))
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return 0, nil
 		}
-		
-		return item.Value(func(val []byte) error {
-			if len(val) < 8 {
-				return errors.New("invalid height data")
-			}
-			height = uint64(val[0]) | uint64(val[1])<<8 | uint64(val[2])<<16 | uint64(val[3])<<24 |
-				uint64(val[4])<<32 | uint64(val[5])<<40 | uint64(val[6])<<48 | uint64(val[7])<<56
-			return nil
-		})
-	})
+		return 0, err
+	}
 	
-	return height, err
+	if len(val) < 8 {
+		return 0, fmt.Errorf("%w: invalid height data", ErrCorrupt)
+	}
+	return binary.LittleEndian.Uint64(val), nil
 }
 
 // UpdateLatestHeight updates the latest block height
 func (d *Database) UpdateLatestHeight(height uint64) error {
-	return d.db.Update(func(txn *badger.Txn) error {
-		data := make([]byte, 8)
-		data[0] = byte(height)
-		data[1] = byte(height >> 8)
-		data[2] = byte(height >> 16)
-		data[3] = byte(height >> 24)
-		data[4] = byte(height >> 32)
-		data[5] = byte(height >> 40)
-		data[6] = byte(height >> 48)
-		data[7] = byte(height >> 56)
-		
-		return txn.Set([]byte("latest_height"), data)
-	})
+	data := make([]byte, 8)
+	binary.LittleEndian.PutUint64(data, height)
+	
+	return d.db.Set([]byte("latest_height"), data)
 }
 
 // SaveTransaction saves a transaction
 func (d *Database) SaveTransaction(tx *types.Transaction) error {
-	return d.db.Update(func(txn *badger.Txn) error {
-		data, err := json.Marshal(tx)
-		if err != nil {
-			return err
-		}
-		
-		key := makeTxKey(tx.Hash())
-		return txn.Set(key, data)
-	})
+	return d.setJSON(makeTxKey(tx.Hash()), tx)
 }
 
 // GetTransaction retrieves a transaction by hash
 func (d *Database) GetTransaction(hash types.Hash) (*types.Transaction, error) {
 	var tx types.Transaction
-	
-	err := d.db.View(func(txn *badger.Txn) error {
-		key := makeTxKey(hash)
-		item, err := txn.Get(key)
-		if err != nil {
-			return err
-		}
-		
-		return item.Value(func(val []byte) error {
-			return json.Unmarshal(val, &tx)
-		})
-	})
-	
-	if err != nil {
+	if err := d.getJSON(makeTxKey(hash), &tx); err != nil {
 		return nil, err
 	}
 	
@@ -190,36 +172,230 @@ func (d *Database) GetTransaction(hash types.Hash) (*types.Transaction, error) {
 
 // SaveGenesis saves the genesis configuration
 func (d *Database) SaveGenesis(genesis *types.GenesisConfig) error {
-	return d.db.Update(func(txn *badger.Txn) error {
-		data, err := json.Marshal(genesis)
-		if err != nil {
-			return err
-		}
-		
-		return txn.Set([]byte("genesis"), data)
-	})
+	return d.setJSON([]byte("genesis"), genesis)
 }
 
 // GetGenesis retrieves the genesis configuration
 func (d *Database) GetGenesis() (*types.GenesisConfig, error) {
 	var genesis types.GenesisConfig
+	if err := d.getJSON([]byte("genesis"), &genesis); err != nil {
+		return nil, err
+	}
+	
+	return &genesis, nil
+}
+
+// SaveGenesisHash pins the canonical hash of the stored genesis
+func (d *Database) SaveGenesisHash(hash types.Hash) error {
+	return d.db.Set([]byte("genesis_hash"), hash[:])
+}
+
+// GetGenesisHash returns the pinned genesis hash
+func (d *Database) GetGenesisHash() (types.Hash, error) {
+	var hash types.Hash
+	data, err := d.db.Get([]byte("genesis_hash"))
+	if err != nil {
+		return hash, err
+	}
+	if len(data) != len(hash) {
+		return hash, fmt.Errorf("%w: genesis hash of %d bytes", ErrCorrupt, len(data))
+	}
+	copy(hash[:], data)
+	return hash, nil
+}
+
+// GetChainID returns the chain ID from the stored genesis
+func (d *Database) GetChainID() (string, error) {
+	genesis, err := d.GetGenesis()
+	if err != nil {
+		return "", err
+	}
 	
-	err := d.db.View(func(txn *badger.Txn) error {
-		item, err := txn.Get([]byte("genesis"))
+	return genesis.ChainID, nil
+}
+
+// GetNetwork returns the network the chain's genesis names
+func (d *Database) GetNetwork() (types.Network, error) {
+	genesis, err := d.GetGenesis()
+	if err != nil {
+		return "", err
+	}
+	return genesis.Network.OrDefault(), nil
+}
+
+// GetDenomination returns how the chain's genesis writes amounts
+func (d *Database) GetDenomination() (types.Denomination, error) {
+	genesis, err := d.GetGenesis()
+	if err != nil {
+		return types.Denomination{}, err
+	}
+	
+	return genesis.Denomination, nil
+}
+
+// GetDustLimit returns the smallest amount an output of the next block
+// may carry, 0 while the limit is off
+func (d *Database) GetDustLimit() (uint64, error) {
+	genesis, err := d.GetGenesis()
+	if err != nil {
+		return 0, err
+	}
+	height, err := d.GetLatestHeight()
+	if err != nil {
+		return 0, err
+	}
+	
+	if genesis.Forks.VersionAt(height+1) < types.DustLimitVersion {
+		return 0, nil
+	}
+	return genesis.DustLimit, nil
+}
+
+// GetRingPolicy returns the ring size bounds of the next block, the zero
+// policy while they are not enforced
+func (d *Database) GetRingPolicy() (types.RingPolicy, error) {
+	genesis, err := d.GetGenesis()
+	if err != nil {
+		return types.RingPolicy{}, err
+	}
+	height, err := d.GetLatestHeight()
+	if err != nil {
+		return types.RingPolicy{}, err
+	}
+	
+	if genesis.Forks.VersionAt(height+1) < types.RingSizeVersion {
+		return types.RingPolicy{}, nil
+	}
+	return genesis.RingSize, nil
+}
+
+// GetMaturity returns the depths outputs must be buried under to be
+// spent or used as decoys in the next block
+func (d *Database) GetMaturity() (types.MaturityConfig, error) {
+	genesis, err := d.GetGenesis()
+	if err != nil {
+		return types.MaturityConfig{}, err
+	}
+	height, err := d.GetLatestHeight()
+	if err != nil {
+		return types.MaturityConfig{}, err
+	}
+	
+	if genesis.Forks.VersionAt(height+1) < types.MaturityVersion {
+		return types.MaturityConfig{CoinbaseConfirmations: types.MinRingMemberAge}, nil
+	}
+	return genesis.Maturity, nil
+}
+
+// GetNextProtocolVersion returns the protocol version of the next block
+func (d *Database) GetNextProtocolVersion() (uint32, error) {
+	genesis, err := d.GetGenesis()
+	if err != nil {
+		return 0, err
+	}
+	height, err := d.GetLatestHeight()
+	if err != nil {
+		return 0, err
+	}
+	return genesis.Forks.VersionAt(height + 1), nil
+}
+
+// GetRingMemberIndexes returns the global output index of each key, or
+// nil while rings do not reference members by index. It walks the whole
+// chain, numbering outputs the way the ledger does.
+func (d *Database) GetRingMemberIndexes(keys []types.PublicKey) ([]uint64, error) {
+	genesis, err := d.GetGenesis()
+	if err != nil {
+		return nil, err
+	}
+	latest, err := d.GetLatestHeight()
+	if err != nil {
+		return nil, err
+	}
+	if genesis.Forks.VersionAt(latest+1) < types.TxVersionRingIndex {
+		return nil, nil
+	}
+	
+	found := make(map[types.PublicKey]uint64, len(keys))
+	var next uint64
+	index := func(out *types.TxOutput) {
+		if !out.IsRingMember() {
+			return
+		}
+		if _, ok := found[out.StealthAddr.SpendKey]; !ok {
+			found[out.StealthAddr.SpendKey] = next
+		}
+		next++
+	}
+	
+	if genesis.InitialState != nil {
+		for _, utxo := range genesis.InitialState.UTXOs {
+			index(utxo.Output)
+		}
+	}
+	for height := uint64(1); height <= latest; height++ {
+		block, err := d.GetBlock(height)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		
-		return item.Value(func(val []byte) error {
-			return json.Unmarshal(val, &genesis)
-		})
-	})
+		for _, tx := range block.Transactions {
+			for _, out := range tx.AllOutputs() {
+				index(out)
+			}
+		}
+	}
+	
+	indexes := make([]uint64, len(keys))
+	for i, key := range keys {
+		var ok bool
+		if indexes[i], ok = found[key]; !ok {
+			return nil, fmt.Errorf("output key %x is not indexed", key[:8])
+		}
+	}
+	return indexes, nil
+}
+
+// SaveValidatorSet stores the validator set voting from snap.Height on
+func (d *Database) SaveValidatorSet(snap *types.ValidatorSetSnapshot) error {
+	return d.setJSON(makeValidatorSetKey(snap.Height), snap)
+}
+
+// GetValidatorSet retrieves the validator set that votes on the block at
+// height: the latest set stored at or below it
+func (d *Database) GetValidatorSet(height uint64) (*types.ValidatorSetSnapshot, error) {
+	var snap types.ValidatorSetSnapshot
 	
+	var data []byte
+	err := d.db.Iterate([]byte{'v'}, makeValidatorSetKey(height), true, func(key, value []byte) bool {
+		data = append([]byte{}, value...)
+		return false
+	})
 	if err != nil {
 		return nil, err
 	}
+	if data == nil {
+		return nil, ErrNotFound
+	}
 	
-	return &genesis, nil
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	
+	return &snap, nil
+}
+
+// SaveEpochSummary stores the summary of a finished epoch
+func (d *Database) SaveEpochSummary(summary *types.EpochSummary) error {
+	return d.setJSON(makeEpochKey(summary.Epoch), summary)
+}
+
+// GetEpochSummary retrieves the summary of an epoch
+func (d *Database) GetEpochSummary(epoch uint64) (*types.EpochSummary, error) {
+	var summary types.EpochSummary
+	if err := d.getJSON(makeEpochKey(epoch), &summary); err != nil {
+		return nil, err
+	}
+	return &summary, nil
 }
 
 // Helper functions to create database keys
@@ -249,4 +425,19 @@ func makeTxKey(hash types.Hash) []byte {
 	key[0] = 't' // transaction prefix
 	copy(key[1:], hash[:])
 	return key
-}
\ No newline at end of file
+}
+
+// makeValidatorSetKey is big-endian so sets iterate in height order
+func makeValidatorSetKey(height uint64) []byte {
+	key := make([]byte, 9)
+	key[0] = 'v' // validator set prefix
+	binary.BigEndian.PutUint64(key[1:], height)
+	return key
+}
+
+func makeEpochKey(epoch uint64) []byte {
+	key := make([]byte, 9)
+	key[0] = 'e' // epoch summary prefix
+	binary.BigEndian.PutUint64(key[1:], epoch)
+	return key
+}
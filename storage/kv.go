@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrNotFound is returned by KVStore.Get for a missing key
+var ErrNotFound = errors.New("key not found")
+
+// ErrCorrupt is returned for a stored value that cannot be decoded.
+// Unlike ErrNotFound, fetching the value again will not help.
+var ErrCorrupt = errors.New("corrupt record")
+
+// KVStore is the key-value engine under a Database. Keys are ordered
+// bytewise. Implementations must be safe for concurrent use.
+type KVStore interface {
+	// Get returns a copy of the value of key, or ErrNotFound
+	Get(key []byte) ([]byte, error)
+	Set(key, value []byte) error
+	Delete(key []byte) error
+
+	// Iterate calls fn with every key having prefix, in ascending order
+	// from the first key at or after start, or in descending order from
+	// the last key at or before it when reverse is set. A nil start
+	// covers the whole prefix. fn must not keep key or value, and stops
+	// the walk by returning false.
+	Iterate(prefix, start []byte, reverse bool, fn func(key, value []byte) bool) error
+
+	// NewBatch starts a group of writes applied all at once by Commit
+	NewBatch() Batch
+
+	Close() error
+}
+
+// Batch is a group of writes to a KVStore. Nothing is written unless
+// Commit succeeds, and a batch is not used after Commit or Discard.
+type Batch interface {
+	Set(key, value []byte) error
+	Delete(key []byte) error
+	Commit() error
+	Discard()
+}
+
+// Options tune how an engine opens a store
+type Options struct {
+	// ReadOnly opens an existing store without write access
+	ReadOnly bool
+
+	// Archive tunes the store for an archive node, which serves random
+	// reads of old blocks more than it writes (see OpenArchive)
+	Archive bool
+}
+
+// Opener opens or creates the store of an engine at path
+type Opener func(path string, opts Options) (KVStore, error)
+
+// Engines lists the storage engines selectable by name. Alternative
+// engines are added here from an init function.
+var Engines = map[string]Opener{
+	"badger": openBadger,
+	"memory": openMemory,
+}
+
+// DefaultEngine is the name of the engine used unless configured
+// otherwise
+const DefaultEngine = "badger"
+
+// GetEngine looks up an engine by name
+func GetEngine(name string) (Opener, error) {
+	open, ok := Engines[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown storage engine %q (available: %s)", name, strings.Join(EngineNames(), ", "))
+	}
+	return open, nil
+}
+
+// EngineNames returns the names of the engines, sorted
+func EngineNames() []string {
+	names := make([]string, 0, len(Engines))
+	for n := range Engines {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// OpenEngine opens or creates a database at path with the named engine
+func OpenEngine(name, path string, opts Options) (*Database, error) {
+	open, err := GetEngine(name)
+	if err != nil {
+		return nil, err
+	}
+	store, err := open(path, opts)
+	if err != nil {
+		return nil, err
+	}
+	return NewDatabase(store), nil
+}
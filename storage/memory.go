@@ -0,0 +1,189 @@
+package storage
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// memoryStore keeps the whole database in RAM, for tests and throwaway
+// networks. Nothing survives Close.
+type memoryStore struct {
+	mu     sync.RWMutex
+	values map[string][]byte
+	keys   []string // Sorted
+	closed bool
+}
+
+var errClosed = errors.New("store is closed")
+
+func openMemory(path string, opts Options) (KVStore, error) {
+	if opts.ReadOnly {
+		return nil, errors.New("memory store has nothing to open read-only")
+	}
+	return newMemoryStore(), nil
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{values: make(map[string][]byte)}
+}
+
+func (s *memoryStore) Get(key []byte) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return nil, errClosed
+	}
+	value, ok := s.values[string(key)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte{}, value...), nil
+}
+
+func (s *memoryStore) Set(key, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errClosed
+	}
+	s.set(string(key), value)
+	return nil
+}
+
+func (s *memoryStore) Delete(key []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errClosed
+	}
+	s.delete(string(key))
+	return nil
+}
+
+// set stores a copy of value (must hold lock)
+func (s *memoryStore) set(key string, value []byte) {
+	if _, ok := s.values[key]; !ok {
+		i := sort.SearchStrings(s.keys, key)
+		s.keys = append(s.keys, "")
+		copy(s.keys[i+1:], s.keys[i:])
+		s.keys[i] = key
+	}
+	s.values[key] = append([]byte{}, value...)
+}
+
+// delete removes key (must hold lock)
+func (s *memoryStore) delete(key string) {
+	if _, ok := s.values[key]; !ok {
+		return
+	}
+	delete(s.values, key)
+	i := sort.SearchStrings(s.keys, key)
+	s.keys = append(s.keys[:i], s.keys[i+1:]...)
+}
+
+func (s *memoryStore) Iterate(prefix, start []byte, reverse bool, fn func(key, value []byte) bool) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return errClosed
+	}
+
+	p := string(prefix)
+	if !reverse {
+		from := p
+		if start != nil {
+			from = string(start)
+		}
+		for i := sort.SearchStrings(s.keys, from); i < len(s.keys); i++ {
+			key := s.keys[i]
+			if !strings.HasPrefix(key, p) {
+				if key > p {
+					break
+				}
+				continue
+			}
+			if !fn([]byte(key), s.values[key]) {
+				break
+			}
+		}
+		return nil
+	}
+
+	// Index of the last key at or before start, or of the last key of
+	// the prefix
+	i := len(s.keys) - 1
+	if start != nil {
+		i = sort.Search(len(s.keys), func(j int) bool { return s.keys[j] > string(start) }) - 1
+	}
+	for ; i >= 0; i-- {
+		key := s.keys[i]
+		if !strings.HasPrefix(key, p) {
+			if key < p {
+				break
+			}
+			continue
+		}
+		if !fn([]byte(key), s.values[key]) {
+			break
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) NewBatch() Batch {
+	return &memoryBatch{store: s}
+}
+
+func (s *memoryStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	s.values, s.keys = nil, nil
+	return nil
+}
+
+// memoryBatch queues writes and applies them under one lock
+type memoryBatch struct {
+	store  *memoryStore
+	writes []memoryWrite
+}
+
+type memoryWrite struct {
+	key    string
+	value  []byte
+	delete bool
+}
+
+func (b *memoryBatch) Set(key, value []byte) error {
+	b.writes = append(b.writes, memoryWrite{key: string(key), value: append([]byte{}, value...)})
+	return nil
+}
+
+func (b *memoryBatch) Delete(key []byte) error {
+	b.writes = append(b.writes, memoryWrite{key: string(key), delete: true})
+	return nil
+}
+
+func (b *memoryBatch) Commit() error {
+	s := b.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errClosed
+	}
+	for _, w := range b.writes {
+		if w.delete {
+			s.delete(w.key)
+		} else {
+			s.set(w.key, w.value)
+		}
+	}
+	b.writes = nil
+	return nil
+}
+
+func (b *memoryBatch) Discard() {
+	b.writes = nil
+}
@@ -0,0 +1,62 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+)
+
+// MoneySupply is the most coins that can ever exist. No amount, sum of
+// amounts or total supply may exceed it, which keeps all amount
+// arithmetic far from uint64 overflow.
+const MoneySupply uint64 = 1 << 60
+
+// ErrAmountOverflow is returned when amounts add up past MoneySupply
+var ErrAmountOverflow = errors.New("amount exceeds money supply")
+
+// CheckAmount checks a single amount against MoneySupply
+func CheckAmount(amount uint64) error {
+	if amount > MoneySupply {
+		return ErrAmountOverflow
+	}
+	return nil
+}
+
+// AddAmounts returns the sum of amounts, failing if any amount or the
+// running total exceeds MoneySupply
+func AddAmounts(amounts ...uint64) (uint64, error) {
+	var sum uint64
+	for _, amount := range amounts {
+		// Both values are at most MoneySupply, so the sum cannot wrap
+		if amount > MoneySupply || sum+amount > MoneySupply {
+			return 0, ErrAmountOverflow
+		}
+		sum += amount
+	}
+	return sum, nil
+}
+
+// SubAmounts returns a-b, failing if b is larger than a
+func SubAmounts(a, b uint64) (uint64, error) {
+	if b > a {
+		return 0, fmt.Errorf("amount underflow: %d - %d", a, b)
+	}
+	return a - b, nil
+}
+
+// InputSum returns the total of a transaction's input amounts
+func (tx *Transaction) InputSum() (uint64, error) {
+	amounts := make([]uint64, len(tx.Inputs))
+	for i, in := range tx.Inputs {
+		amounts[i] = in.Amount
+	}
+	return AddAmounts(amounts...)
+}
+
+// OutputSum returns the total of a transaction's output amounts
+func (tx *Transaction) OutputSum() (uint64, error) {
+	amounts := make([]uint64, len(tx.Outputs))
+	for i, out := range tx.Outputs {
+		amounts[i] = out.Amount
+	}
+	return AddAmounts(amounts...)
+}
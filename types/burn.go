@@ -0,0 +1,62 @@
+package types
+
+import "errors"
+
+// TxVersionBurn is the first transaction version that may create burn
+// outputs. It needs protocol version 6.
+const TxVersionBurn = 6
+
+// IsBurn reports whether an output destroys its amount. Burn outputs
+// have no one-time address, so nobody can ever spend them; the ledger
+// never adds them to the UTXO set.
+func (o *TxOutput) IsBurn() bool {
+	return o.Burn
+}
+
+// ValidateBurn checks that a burn output is provably unspendable: it
+// carries an amount and nothing a spender could use
+func (o *TxOutput) ValidateBurn() error {
+	if o.Amount == 0 {
+		return errors.New("burn has no amount")
+	}
+	if o.StealthAddr != (Address{}) || o.TxPublicKey != (PublicKey{}) {
+		return errors.New("burn output cannot have an address")
+	}
+	if o.PaymentID != (PaymentID{}) || len(o.Memo) > 0 || o.ViewTag != nil {
+		return errors.New("burn output cannot carry a payment ID, memo or view tag")
+	}
+	if o.Multisig != nil || o.HashLock != nil || o.Lock != nil {
+		return errors.New("burn output cannot have spend conditions")
+	}
+	return nil
+}
+
+// HasBurns reports whether a transaction creates burn outputs
+func (tx *Transaction) HasBurns() bool {
+	for _, out := range tx.Outputs {
+		if out.Burn {
+			return true
+		}
+	}
+	return false
+}
+
+// BurnedAmount returns the sum of a transaction's burn outputs
+func (tx *Transaction) BurnedAmount() (uint64, error) {
+	amounts := make([]uint64, 0)
+	for _, out := range tx.Outputs {
+		if out.Burn {
+			amounts = append(amounts, out.Amount)
+		}
+	}
+	return AddAmounts(amounts...)
+}
+
+// writeBurns hashes which outputs are burns. Only transactions of
+// TxVersionBurn and later include them, so older transaction IDs are
+// unchanged.
+func writeBurns(h *Hasher, tx *Transaction) {
+	for _, out := range tx.Outputs {
+		h.Bool(out.Burn)
+	}
+}
@@ -0,0 +1,144 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultSymbol is the coin symbol used when the genesis sets none
+const DefaultSymbol = "APEX"
+
+// MaxDecimals bounds the decimal places of a coin. 10^18 base units per
+// coin still fits a uint64.
+const MaxDecimals = 18
+
+// maxSymbolLength bounds the length of a coin symbol
+const maxSymbolLength = 12
+
+// Denomination sets how amounts are written for people. Amounts on
+// chain are always whole base units; one coin is 10^Decimals of them.
+// It has no effect on consensus. The zero value is one base unit per
+// coin, under DefaultSymbol.
+type Denomination struct {
+	Symbol   string `json:"symbol,omitempty"`
+	Decimals uint8  `json:"decimals,omitempty"`
+}
+
+// Validate checks the symbol and decimal places
+func (d Denomination) Validate() error {
+	if d.Decimals > MaxDecimals {
+		return fmt.Errorf("decimals must not exceed %d", MaxDecimals)
+	}
+	if d.Symbol == "" {
+		return nil
+	}
+	if len(d.Symbol) > maxSymbolLength {
+		return fmt.Errorf("symbol must not exceed %d characters", maxSymbolLength)
+	}
+	for _, c := range d.Symbol {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			return errors.New("symbol must be capital letters and digits")
+		}
+	}
+	return nil
+}
+
+// Unit returns the coin symbol
+func (d Denomination) Unit() string {
+	if d.Symbol == "" {
+		return DefaultSymbol
+	}
+	return d.Symbol
+}
+
+// NumberFormat holds the separators a locale writes numbers with
+type NumberFormat struct {
+	Decimal string // Between whole coins and the fraction
+	Group   string // Between groups of three digits; empty for none
+}
+
+// CanonicalFormat is the only number format Parse accepts
+var CanonicalFormat = NumberFormat{Decimal: "."}
+
+// Format writes an amount of base units in coins with the symbol, such
+// as "1.5 APEX"
+func (d Denomination) Format(amount uint64) string {
+	return d.FormatNumber(amount, CanonicalFormat) + " " + d.Unit()
+}
+
+// FormatNumber writes an amount of base units in coins, without the
+// symbol, in format f. The fraction is written without trailing zeros,
+// and not at all for whole coins, so the result is exact and Parse
+// reads back the same amount.
+func (d Denomination) FormatNumber(amount uint64, f NumberFormat) string {
+	digits := strconv.FormatUint(amount, 10)
+	decimals := int(d.Decimals)
+	if len(digits) <= decimals {
+		digits = strings.Repeat("0", decimals-len(digits)+1) + digits
+	}
+
+	whole := digits[:len(digits)-decimals]
+	fraction := strings.TrimRight(digits[len(digits)-decimals:], "0")
+
+	if f.Group != "" {
+		var grouped strings.Builder
+		for i, c := range whole {
+			if i > 0 && (len(whole)-i)%3 == 0 {
+				grouped.WriteString(f.Group)
+			}
+			grouped.WriteRune(c)
+		}
+		whole = grouped.String()
+	}
+
+	if fraction == "" {
+		return whole
+	}
+	return whole + f.Decimal + fraction
+}
+
+// Parse reads an amount written in coins, such as "1.5" or "1.5 APEX",
+// into base units. It is strict so that amounts are never rounded: the
+// number must be digits with at most one decimal point and no more
+// decimal places than the coin has, without sign, exponent or grouping,
+// and a symbol must be the coin's own.
+func (d Denomination) Parse(s string) (uint64, error) {
+	number, unit, hasUnit := strings.Cut(s, " ")
+	if hasUnit && unit != d.Unit() {
+		return 0, fmt.Errorf("invalid amount %q: unit must be %s", s, d.Unit())
+	}
+
+	whole, fraction, hasPoint := strings.Cut(number, ".")
+	if !isDigits(whole) || (hasPoint && !isDigits(fraction)) {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	if len(fraction) > int(d.Decimals) {
+		return 0, fmt.Errorf("invalid amount %q: %s has %d decimal places", s, d.Unit(), d.Decimals)
+	}
+
+	digits := whole + fraction + strings.Repeat("0", int(d.Decimals)-len(fraction))
+	digits = strings.TrimLeft(digits, "0")
+	if digits == "" {
+		return 0, nil
+	}
+	amount, err := strconv.ParseUint(digits, 10, 64)
+	if err != nil || amount > MoneySupply {
+		return 0, fmt.Errorf("invalid amount %q: %w", s, ErrAmountOverflow)
+	}
+	return amount, nil
+}
+
+// isDigits reports whether s is a non-empty string of ASCII digits
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
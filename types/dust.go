@@ -0,0 +1,19 @@
+package types
+
+import "fmt"
+
+// DustLimitVersion is the protocol version that enforces the dust limit
+const DustLimitVersion = 8
+
+// CheckDust fails if a transaction creates a spendable output worth less
+// than limit. Such outputs cost every node a UTXO entry while being
+// worth less than the fee to spend them. Burn outputs are exempt, as
+// they never enter the UTXO set; a limit of 0 allows any amount.
+func (tx *Transaction) CheckDust(limit uint64) error {
+	for i, output := range tx.AllOutputs() {
+		if !output.Burn && output.Amount < limit {
+			return fmt.Errorf("output %d amount %d below dust limit %d", i, output.Amount, limit)
+		}
+	}
+	return nil
+}
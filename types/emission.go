@@ -0,0 +1,85 @@
+package types
+
+import "errors"
+
+// EmissionConfig defines the block subsidy as a function of height.
+// Every ReductionInterval blocks the subsidy shrinks by ReductionPercent
+// (50 halves it) until it reaches TailEmission, which is paid forever.
+type EmissionConfig struct {
+	InitialSubsidy    uint64 `json:"initial_subsidy"`
+	ReductionInterval uint64 `json:"reduction_interval,omitempty"` // 0 keeps the subsidy constant
+	ReductionPercent  uint64 `json:"reduction_percent,omitempty"`
+	TailEmission      uint64 `json:"tail_emission,omitempty"`
+
+	// MaxSupply stops emission once reached; 0 means MoneySupply
+	MaxSupply uint64 `json:"max_supply,omitempty"`
+
+	// TreasuryPercent of every subsidy goes to the treasury instead of
+	// the proposer (see treasury.go)
+	TreasuryPercent uint64 `json:"treasury_percent,omitempty"`
+}
+
+// Validate checks the emission parameters
+func (c EmissionConfig) Validate() error {
+	if c.ReductionInterval > 0 && (c.ReductionPercent == 0 || c.ReductionPercent > 100) {
+		return errors.New("reduction_percent must be between 1 and 100")
+	}
+	if c.ReductionInterval == 0 && c.ReductionPercent != 0 {
+		return errors.New("reduction_percent needs a reduction_interval")
+	}
+	if c.TreasuryPercent > 100 {
+		return errors.New("treasury_percent must not exceed 100")
+	}
+	if c.TailEmission > c.InitialSubsidy {
+		return errors.New("tail_emission exceeds initial_subsidy")
+	}
+	if c.MaxSupply > MoneySupply || c.InitialSubsidy > MoneySupply {
+		return ErrAmountOverflow
+	}
+	return nil
+}
+
+// SupplyCap returns the most coins the chain may ever hold
+func (c EmissionConfig) SupplyCap() uint64 {
+	if c.MaxSupply == 0 {
+		return MoneySupply
+	}
+	return c.MaxSupply
+}
+
+// Subsidy returns the newly created coins a block at height may claim
+func (c EmissionConfig) Subsidy(height uint64) uint64 {
+	if height == 0 {
+		return 0
+	}
+
+	subsidy := c.InitialSubsidy
+	if c.ReductionInterval > 0 {
+		for n := (height - 1) / c.ReductionInterval; n > 0 && subsidy > c.TailEmission; n-- {
+			// Split the product so large subsidies cannot overflow
+			cut := subsidy/100*c.ReductionPercent + subsidy%100*c.ReductionPercent/100
+			if cut == 0 {
+				break // Too small to shrink further
+			}
+			subsidy -= cut
+		}
+	}
+
+	if subsidy < c.TailEmission {
+		subsidy = c.TailEmission
+	}
+	return subsidy
+}
+
+// TreasuryShare returns the part of a subsidy credited to the treasury
+func (c EmissionConfig) TreasuryShare(subsidy uint64) uint64 {
+	// Split the product so large subsidies cannot overflow
+	return subsidy/100*c.TreasuryPercent + subsidy%100*c.TreasuryPercent/100
+}
+
+// IsCoinbase reports whether a transaction creates the block reward.
+// Coinbase transactions have no inputs and neither spend the treasury
+// nor release stake.
+func (tx *Transaction) IsCoinbase() bool {
+	return len(tx.Inputs) == 0 && tx.Treasury == nil && tx.Release == nil
+}
@@ -0,0 +1,55 @@
+package types
+
+// EpochSummary records what happened to the validator set over one
+// epoch, so staking dashboards and reward audits need not replay blocks.
+// Nodes store one at the end of every epoch they apply.
+type EpochSummary struct {
+	Epoch       uint64 `json:"epoch"`
+	StartHeight uint64 `json:"start_height"`
+	EndHeight   uint64 `json:"end_height"`
+	TotalStake  uint64 `json:"total_stake"` // Of the set voting at StartHeight
+
+	// Coinbase amounts paid to proposers, fees paid by transactions and
+	// stake slashed over the epoch
+	Rewards uint64 `json:"rewards"`
+	Fees    uint64 `json:"fees"`
+	Slashed uint64 `json:"slashed"`
+
+	// Participation is the share of TotalStake that signed the epoch's
+	// blocks, averaged over them
+	Participation float64 `json:"participation"`
+
+	// The set voting at StartHeight ranked by stake, then any validator
+	// that joined it during the epoch
+	Validators []EpochValidator `json:"validators"`
+}
+
+// EpochValidator is one validator's record in an EpochSummary
+type EpochValidator struct {
+	PublicKey  PublicKey `json:"public_key"`
+	Stake      uint64    `json:"stake"`     // At StartHeight, 0 if it joined during the epoch
+	EndStake   uint64    `json:"end_stake"` // After the epoch's last block
+	Commission uint32    `json:"commission"`
+	Proposed   uint64    `json:"proposed"`
+	Signed     uint64    `json:"signed"`  // Blocks whose certificate carries its vote
+	Missed     uint64    `json:"missed"`  // Blocks of the epoch it did not sign
+	Rewards    uint64    `json:"rewards"` // Coinbase amounts of the blocks it proposed
+	Slashed    uint64    `json:"slashed"` // Stake lost during the epoch
+	Jailed     bool      `json:"jailed,omitempty"`
+}
+
+// EpochOf returns the epoch the block at height belongs to. Epoch e
+// covers heights e*EpochLength+1 through (e+1)*EpochLength, so its
+// blocks are voted on by the set chosen at the rotation before it. The
+// genesis is reported as epoch 0.
+func (c ValidatorSetConfig) EpochOf(height uint64) uint64 {
+	if height == 0 {
+		return 0
+	}
+	return (height - 1) / c.Epoch()
+}
+
+// EpochBounds returns the first and last heights of an epoch
+func (c ValidatorSetConfig) EpochBounds(epoch uint64) (start, end uint64) {
+	return epoch*c.Epoch() + 1, (epoch + 1) * c.Epoch()
+}
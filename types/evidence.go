@@ -0,0 +1,51 @@
+package types
+
+// EvidenceVersion is the first protocol version whose blocks carry
+// evidence of double votes. Before it a double vote goes unpunished.
+const EvidenceVersion = 13
+
+const (
+	// DoubleVoteSlashPercent of a validator's stake is taken for a
+	// double vote
+	DoubleVoteSlashPercent = 10
+
+	// DoubleVoteJailBlocks is how long a double vote jails a validator,
+	// per slash on its record
+	DoubleVoteJailBlocks = 10000
+
+	// MaxEvidenceAge is how many blocks after a double vote its
+	// evidence may still be included
+	MaxEvidenceAge = 1000
+)
+
+// DoubleVote is evidence that a validator signed commit votes for two
+// different blocks at one height and round. The hashes are in byte
+// order, so the same two votes always make the same evidence.
+type DoubleVote struct {
+	Validator  PublicKey
+	Height     uint64
+	Round      uint32
+	BlockA     Hash
+	SignatureA Signature
+	BlockB     Hash
+	SignatureB Signature
+}
+
+// Hash identifies the evidence in a block's transaction root
+func (ev *DoubleVote) Hash() Hash {
+	return NewHasher(TagEvidence).
+		Fixed(ev.Validator[:]).
+		Uint64(ev.Height).
+		Uint32(ev.Round).
+		Fixed(ev.BlockA[:]).
+		Fixed(ev.SignatureA[:]).
+		Fixed(ev.BlockB[:]).
+		Fixed(ev.SignatureB[:]).
+		Sum()
+}
+
+// Votes returns the two commit votes the evidence is made of
+func (ev *DoubleVote) Votes(chainID string) (a, b *CanonicalVote) {
+	return NewCommitVote(chainID, ev.Height, ev.Round, ev.BlockA),
+		NewCommitVote(chainID, ev.Height, ev.Round, ev.BlockB)
+}
@@ -0,0 +1,111 @@
+package types
+
+import "errors"
+
+// FeeMarketVersion is the protocol version that charges the base fee
+const FeeMarketVersion = 7
+
+// Fee market defaults used when the genesis leaves a field unset
+const (
+	DefaultTargetTransactions = 500
+	DefaultBaseFeeChange      = 12 // Percent
+)
+
+// MaxTargetTransactions bounds the target so base fee steps cannot
+// overflow
+const MaxTargetTransactions = 1 << 24
+
+// FeeMarketConfig enables a base fee in the style of EIP-1559. Every
+// transaction must pay at least the base fee, which is burned; only the
+// rest, the tip, may be claimed by the proposer. After each block the
+// base fee rises if the block held more than TargetTransactions and
+// falls if it held fewer, by up to MaxChangePercent.
+type FeeMarketConfig struct {
+	InitialBaseFee     uint64 `json:"initial_base_fee,omitempty"` // 0 disables the base fee
+	MinBaseFee         uint64 `json:"min_base_fee,omitempty"`
+	TargetTransactions uint64 `json:"target_transactions,omitempty"`
+	MaxChangePercent   uint64 `json:"max_change_percent,omitempty"`
+}
+
+// Validate checks the fee market parameters
+func (c FeeMarketConfig) Validate() error {
+	if c.MaxChangePercent > 100 {
+		return errors.New("max_change_percent must not exceed 100")
+	}
+	if c.TargetTransactions > MaxTargetTransactions {
+		return errors.New("target_transactions too large")
+	}
+	if c.MinBaseFee > c.InitialBaseFee {
+		return errors.New("min_base_fee exceeds initial_base_fee")
+	}
+	if c.InitialBaseFee > MoneySupply {
+		return ErrAmountOverflow
+	}
+	return nil
+}
+
+// Enabled reports whether the chain charges a base fee
+func (c FeeMarketConfig) Enabled() bool {
+	return c.InitialBaseFee > 0
+}
+
+// Target returns the transactions per block that keep the base fee
+// unchanged
+func (c FeeMarketConfig) Target() uint64 {
+	if c.TargetTransactions == 0 {
+		return DefaultTargetTransactions
+	}
+	return c.TargetTransactions
+}
+
+// ChangePercent returns the most the base fee moves after one block
+func (c FeeMarketConfig) ChangePercent() uint64 {
+	if c.MaxChangePercent == 0 {
+		return DefaultBaseFeeChange
+	}
+	return c.MaxChangePercent
+}
+
+// NextBaseFee returns the base fee following a block that held txCount
+// fee-paying transactions under baseFee. An empty block lowers it by
+// the full ChangePercent, a block of twice the target or more raises it
+// by as much.
+func (c FeeMarketConfig) NextBaseFee(baseFee, txCount uint64) uint64 {
+	target := c.Target()
+
+	// Split the product so large fees cannot overflow
+	step := baseFee/100*c.ChangePercent() + baseFee%100*c.ChangePercent()/100
+
+	next := baseFee
+	if txCount > target {
+		excess := min(txCount-target, target)
+		delta := step/target*excess + step%target*excess/target
+		next = min(baseFee+max(delta, 1), MoneySupply)
+	} else if txCount < target {
+		shortfall := target - txCount
+		next = baseFee - (step/target*shortfall + step%target*shortfall/target)
+	}
+
+	if next < c.MinBaseFee {
+		next = c.MinBaseFee
+	}
+	if next == 0 {
+		next = 1 // Zero would switch the base fee off for good
+	}
+	return next
+}
+
+// PaysBaseFee reports whether a transaction is charged the base fee.
+// Coinbases, treasury spends and stake releases pay no fee at all.
+func (tx *Transaction) PaysBaseFee() bool {
+	return !tx.IsCoinbase() && !tx.IsTreasurySpend() && !tx.IsStakeRelease()
+}
+
+// MinFee returns the least fee a transaction may pay under baseFee: the
+// base fee plus the per-byte memo fee
+func (tx *Transaction) MinFee(baseFee uint64) uint64 {
+	if !tx.PaysBaseFee() {
+		return 0
+	}
+	return baseFee + uint64(tx.MemoSize())*MemoFeePerByte
+}
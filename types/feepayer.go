@@ -0,0 +1,64 @@
+package types
+
+// TxVersionFeePayer is the first transaction version that may carry a
+// FeePayer. It needs protocol version 2.
+const TxVersionFeePayer = 2
+
+// FeePayer is a third party paying a transaction's fee, such as a
+// merchant covering its customers' fees. The sponsor spends its own
+// input under a separate ring signature, so the sender's inputs only
+// cover the outputs and the sponsor's input covers the fee plus change.
+//
+// The sender signs the transaction prefix, which commits to the fee but
+// not to the sponsor, so the sponsor can be added after the sender has
+// signed. The sponsor signs FeePayerHash, which commits to the whole
+// transaction, so its payment cannot be moved to another transaction.
+type FeePayer struct {
+	Input         *TxInput
+	Change        *TxOutput `json:",omitempty"` // Returned to the sponsor
+	RingSignature *RingSignature
+}
+
+// FeePayerHash is what the sponsor of a transaction signs (bound to a
+// chain by TxSigningHash). It is zero if the transaction has no sponsor.
+func (tx *Transaction) FeePayerHash() Hash {
+	fp := tx.FeePayer
+	if fp == nil || fp.Input == nil {
+		return Hash{}
+	}
+
+	prefix := tx.PrefixHash()
+	h := NewHasher(TagFeePayer).Fixed(prefix[:])
+	h.Fixed(fp.Input.KeyImage[:])
+	h.Uint64(fp.Input.Amount)
+	if tx.Version >= TxVersionRingIndex {
+		writeOffsets(h, fp.Input.RingOffsets)
+	}
+	h.Bool(fp.Change != nil)
+	if fp.Change != nil {
+		writeOutput(h, fp.Change)
+	}
+	return h.Sum()
+}
+
+// AllInputs returns the transaction's inputs followed by the sponsor's
+// input, if any. Key images of all of them are spent by the transaction.
+func (tx *Transaction) AllInputs() []*TxInput {
+	if tx.FeePayer == nil || tx.FeePayer.Input == nil {
+		return tx.Inputs
+	}
+	inputs := make([]*TxInput, 0, len(tx.Inputs)+1)
+	inputs = append(inputs, tx.Inputs...)
+	return append(inputs, tx.FeePayer.Input)
+}
+
+// AllOutputs returns the transaction's outputs followed by the sponsor's
+// change, if any. The position of an output is its UTXO index.
+func (tx *Transaction) AllOutputs() []*TxOutput {
+	if tx.FeePayer == nil || tx.FeePayer.Change == nil {
+		return tx.Outputs
+	}
+	outputs := make([]*TxOutput, 0, len(tx.Outputs)+1)
+	outputs = append(outputs, tx.Outputs...)
+	return append(outputs, tx.FeePayer.Change)
+}
@@ -0,0 +1,194 @@
+package types
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/bits"
+	"slices"
+)
+
+// TagBlockFilter keys the item hashes of a block's compact filter
+const TagBlockFilter = "apex/block-filter/v1"
+
+// Golomb-coded set parameters, as in BIP158: a false positive rate of
+// about 1 in FilterM per item looked up
+const (
+	FilterP = 19
+	FilterM = 784931
+)
+
+// BlockFilter is a compact filter over a block, in the style of BIP158.
+// It lets a light wallet test whether a block may concern it without
+// revealing anything to the node serving the filter, then download
+// only matching blocks.
+//
+// The filter holds the recipient view key of every output, which is
+// the same for all addresses of a wallet (see crypto.Subaddress), and
+// the key image of every input, so wallets see both their incoming
+// payments and spends of their outputs. One-time output keys cannot be
+// used: a wallet cannot know them without scanning.
+type BlockFilter struct {
+	Height    uint64 `json:"height"`
+	BlockHash Hash   `json:"block_hash"` // Keys the item hashes
+	N         uint32 `json:"n"`          // Items in the set
+	Data      []byte `json:"data"`       // Golomb-Rice coded item hashes
+}
+
+// FilterItems returns the distinct items a block's filter is built over
+func FilterItems(block *Block) [][]byte {
+	seen := make(map[PublicKey]bool)
+	items := make([][]byte, 0)
+	add := func(key PublicKey) {
+		if key == (PublicKey{}) || seen[key] {
+			return
+		}
+		seen[key] = true
+		items = append(items, key[:])
+	}
+
+	for _, tx := range block.Transactions {
+		for _, input := range tx.AllInputs() {
+			add(input.KeyImage)
+		}
+		for _, output := range tx.AllOutputs() {
+			add(output.StealthAddr.ViewKey)
+		}
+	}
+	return items
+}
+
+// BuildBlockFilter builds the compact filter of a block
+func BuildBlockFilter(block *Block) *BlockFilter {
+	items := FilterItems(block)
+	blockHash := block.Header.Hash()
+
+	values := hashFilterItems(blockHash, items, uint64(len(items))*FilterM)
+	slices.Sort(values)
+
+	w := &bitWriter{}
+	var last uint64
+	for _, v := range values {
+		delta := v - last
+		last = v
+
+		// Quotient in unary, remainder in FilterP bits
+		for q := delta >> FilterP; q > 0; q-- {
+			w.writeBit(1)
+		}
+		w.writeBit(0)
+		w.writeBits(delta, FilterP)
+	}
+
+	return &BlockFilter{
+		Height:    block.Header.Height,
+		BlockHash: blockHash,
+		N:         uint32(len(items)),
+		Data:      w.bytes,
+	}
+}
+
+// MatchAny reports whether the filter may contain any of items. False
+// positives occur at about 1 in FilterM per item; false negatives never
+// do.
+func (f *BlockFilter) MatchAny(items [][]byte) (bool, error) {
+	if f.N == 0 || len(items) == 0 {
+		return false, nil
+	}
+
+	targets := hashFilterItems(f.BlockHash, items, uint64(f.N)*FilterM)
+	slices.Sort(targets)
+
+	r := &bitReader{data: f.Data}
+	var value uint64
+	next := 0
+	for i := uint32(0); i < f.N; i++ {
+		var q uint64
+		for {
+			bit, err := r.readBit()
+			if err != nil {
+				return false, err
+			}
+			if bit == 0 {
+				break
+			}
+			q++
+		}
+		rem, err := r.readBits(FilterP)
+		if err != nil {
+			return false, err
+		}
+		value += q<<FilterP | rem
+
+		for next < len(targets) && targets[next] < value {
+			next++
+		}
+		if next == len(targets) {
+			return false, nil
+		}
+		if targets[next] == value {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// hashFilterItems maps items uniformly onto [0, modulus), keyed by the
+// block hash so each block's filter hashes differently
+func hashFilterItems(blockHash Hash, items [][]byte, modulus uint64) []uint64 {
+	values := make([]uint64, len(items))
+	for i, item := range items {
+		sum := NewHasher(TagBlockFilter).Fixed(blockHash[:]).Fixed(item).Sum()
+		hi, _ := bits.Mul64(binary.BigEndian.Uint64(sum[:8]), modulus)
+		values[i] = hi
+	}
+	return values
+}
+
+var errFilterTruncated = errors.New("block filter is truncated")
+
+// bitWriter appends bits most significant first
+type bitWriter struct {
+	bytes []byte
+	used  uint8 // Bits used in the last byte
+}
+
+func (w *bitWriter) writeBit(bit uint8) {
+	if w.used == 0 {
+		w.bytes = append(w.bytes, 0)
+	}
+	w.bytes[len(w.bytes)-1] |= bit << (7 - w.used)
+	w.used = (w.used + 1) % 8
+}
+
+func (w *bitWriter) writeBits(v uint64, n int) {
+	for i := n - 1; i >= 0; i-- {
+		w.writeBit(uint8(v >> i & 1))
+	}
+}
+
+// bitReader reads bits written by bitWriter
+type bitReader struct {
+	data []byte
+	pos  int // In bits
+}
+
+func (r *bitReader) readBit() (uint8, error) {
+	if r.pos >= len(r.data)*8 {
+		return 0, errFilterTruncated
+	}
+	bit := r.data[r.pos/8] >> (7 - r.pos%8) & 1
+	r.pos++
+	return bit, nil
+}
+
+func (r *bitReader) readBits(n int) (uint64, error) {
+	var v uint64
+	for i := 0; i < n; i++ {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		v = v<<1 | uint64(bit)
+	}
+	return v, nil
+}
@@ -0,0 +1,98 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// BaseProtocolVersion is the rule set active from genesis
+	BaseProtocolVersion = 1
+
+	// ProtocolVersion is the newest rule set this software implements.
+	// Bump it together with the code gated on the new version.
+	// Version 2 adds sponsored fees (TxVersionFeePayer), version 3
+	// hashed timelocks (TxVersionHashLock), version 4 lock conditions
+	// (TxVersionLock), version 5 treasury spends (TxVersionTreasury),
+	// version 6 burn outputs (TxVersionBurn), version 7 the base fee
+	// (FeeMarketVersion), version 8 the dust limit (DustLimitVersion),
+	// version 9 the ring size policy (RingSizeVersion), version 10 ring
+	// members referenced by output index (TxVersionRingIndex), version
+	// 11 output maturity (MaturityVersion), version 12 output view tags
+	// (TxVersionViewTag), version 13 double vote evidence in blocks
+	// (EvidenceVersion), version 14 staking transactions and late votes
+	// in blocks (StakingVersion, LastCommitVersion).
+	ProtocolVersion = 14
+)
+
+// Fork activates a new protocol version at a block height
+type Fork struct {
+	Name    string `json:"name"`
+	Version uint32 `json:"version"`
+	Height  uint64 `json:"height"`
+}
+
+// ForkSchedule lists a chain's forks in activation order
+type ForkSchedule []Fork
+
+// Validate checks that forks have unique names and activate in height
+// order with increasing versions
+func (s ForkSchedule) Validate() error {
+	names := make(map[string]bool)
+	version := uint32(BaseProtocolVersion)
+	var height uint64
+
+	for _, f := range s {
+		if f.Name == "" {
+			return errors.New("fork must have a name")
+		}
+		if names[f.Name] {
+			return fmt.Errorf("duplicate fork %q", f.Name)
+		}
+		names[f.Name] = true
+
+		if f.Height == 0 {
+			return fmt.Errorf("fork %q must activate above genesis", f.Name)
+		}
+		if f.Height <= height {
+			return fmt.Errorf("fork %q activates at %d, not after the previous fork", f.Name, f.Height)
+		}
+		if f.Version <= version {
+			return fmt.Errorf("fork %q must raise the protocol version above %d", f.Name, version)
+		}
+		height, version = f.Height, f.Version
+	}
+
+	return nil
+}
+
+// VersionAt returns the protocol version in force at a height
+func (s ForkSchedule) VersionAt(height uint64) uint32 {
+	version := uint32(BaseProtocolVersion)
+	for _, f := range s {
+		if height >= f.Height {
+			version = f.Version
+		}
+	}
+	return version
+}
+
+// IsActive reports whether the named fork is in force at a height
+func (s ForkSchedule) IsActive(name string, height uint64) bool {
+	for _, f := range s {
+		if f.Name == name {
+			return height >= f.Height
+		}
+	}
+	return false
+}
+
+// Next returns the first fork activating above height, or nil
+func (s ForkSchedule) Next(height uint64) *Fork {
+	for i := range s {
+		if s[i].Height > height {
+			return &s[i]
+		}
+	}
+	return nil
+}
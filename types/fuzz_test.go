@@ -0,0 +1,88 @@
+package types
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// FuzzTransactionJSON checks that decoding never panics and that a
+// decoded transaction hashes the same after a round trip
+func FuzzTransactionJSON(f *testing.F) {
+	f.Add([]byte(`{"Version":1,"Inputs":[{"KeyImage":"0000000000000000000000000000000000000000000000000000000000000000","Amount":5}],"Outputs":[{"Amount":5}]}`))
+	f.Add([]byte(`{"Version":14,"Outputs":[{"Amount":5,"Burn":true,"Bond":"0100000000000000000000000000000000000000000000000000000000000000"}]}`))
+	f.Add([]byte(`{"Inputs":[null]}`))
+	f.Add([]byte(`{"Outputs":[null],"Treasury":{}}`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var tx Transaction
+		if err := json.Unmarshal(data, &tx); err != nil {
+			return
+		}
+		hash := tx.Hash()
+
+		encoded, err := json.Marshal(&tx)
+		if err != nil {
+			t.Fatalf("re-encoding: %v", err)
+		}
+		var decoded Transaction
+		if err := json.Unmarshal(encoded, &decoded); err != nil {
+			t.Fatalf("decoding %s: %v", encoded, err)
+		}
+		if decoded.Hash() != hash {
+			t.Fatalf("hash changed in a round trip of %s", encoded)
+		}
+	})
+}
+
+// FuzzBlockJSON checks that decoding never panics and that a decoded
+// block keeps its header hash after a round trip
+func FuzzBlockJSON(f *testing.F) {
+	f.Add([]byte(`{"Header":{"Height":1},"Transactions":[{"Version":1,"Outputs":[{"Amount":5}]}]}`))
+	f.Add([]byte(`{"Header":{"Height":2},"Transactions":[null]}`))
+	f.Add([]byte(`{"Header":{"Height":2},"Evidence":[null],"Staking":[null]}`))
+	f.Add([]byte(`{"Header":{"Height":2},"Staking":[{"Type":1,"Amount":1}],"LastCommit":[{"Round":1}]}`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var block Block
+		if err := json.Unmarshal(data, &block); err != nil {
+			return
+		}
+		hash := block.Header.Hash()
+		for _, tx := range block.Transactions {
+			tx.Hash()
+		}
+		for _, stx := range block.Staking {
+			stx.Hash()
+		}
+
+		encoded, err := json.Marshal(&block)
+		if err != nil {
+			t.Fatalf("re-encoding: %v", err)
+		}
+		var decoded Block
+		if err := json.Unmarshal(encoded, &decoded); err != nil {
+			t.Fatalf("decoding %s: %v", encoded, err)
+		}
+		if decoded.Header.Hash() != hash {
+			t.Fatalf("header hash changed in a round trip of %s", encoded)
+		}
+	})
+}
+
+// FuzzHashFromString checks that parsed hashes print back the same
+func FuzzHashFromString(f *testing.F) {
+	f.Add("00000000000000000000000000000000000000000000000000000000000000ff")
+	f.Add("zz")
+	f.Add("")
+
+	f.Fuzz(func(t *testing.T, s string) {
+		hash, err := HashFromString(s)
+		if err != nil {
+			return
+		}
+		again, err := HashFromString(hash.String())
+		if err != nil || again != hash {
+			t.Fatalf("%q parsed as %s, which does not parse back", s, hash)
+		}
+	})
+}
@@ -0,0 +1,107 @@
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ParseGenesis decodes a genesis file strictly: unknown fields and
+// trailing data are errors, so a misspelled setting is not silently
+// left at its default. The result is checked with Validate.
+func ParseGenesis(data []byte) (*GenesisConfig, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	var genesis GenesisConfig
+	if err := dec.Decode(&genesis); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("data after the genesis object")
+	}
+
+	if err := genesis.Validate(); err != nil {
+		return nil, err
+	}
+	return &genesis, nil
+}
+
+// Validate checks a genesis config, reporting every problem found rather
+// than only the first
+func (g *GenesisConfig) Validate() error {
+	var errs []error
+	check := func(err error, what string) {
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", what, err))
+		}
+	}
+
+	if g.ChainID == "" {
+		errs = append(errs, errors.New("chain_id is empty"))
+	}
+	_, err := time.Parse(time.RFC3339, g.GenesisTime)
+	check(err, "genesis_time")
+
+	check(g.Network.Validate(), "network")
+	check(g.Forks.Validate(), "forks")
+	check(g.Emission.Validate(), "emission")
+	check(g.FeeMarket.Validate(), "fee_market")
+	check(g.ValidatorSet.Validate(), "validator_set")
+	check(g.Liveness.Validate(), "liveness")
+	check(g.Denomination.Validate(), "denomination")
+	check(CheckAmount(g.DustLimit), "dust_limit")
+	check(g.RingSize.Validate(), "ring_size")
+	check(g.Maturity.Validate(), "maturity")
+
+	if g.InitialSupply > g.Emission.SupplyCap() {
+		errs = append(errs, fmt.Errorf("initial_supply %d exceeds supply cap %d", g.InitialSupply, g.Emission.SupplyCap()))
+	}
+
+	if len(g.InitialValidators) == 0 {
+		errs = append(errs, errors.New("initial_validators is empty; no one could propose the first block"))
+	}
+	seen := make(map[PublicKey]int, len(g.InitialValidators))
+	var totalStake uint64
+	for i, val := range g.InitialValidators {
+		what := fmt.Sprintf("initial_validators[%d]", i)
+		if val.PublicKey == (PublicKey{}) {
+			errs = append(errs, fmt.Errorf("%s: public_key is missing", what))
+		} else if first, ok := seen[val.PublicKey]; ok {
+			errs = append(errs, fmt.Errorf("%s: duplicate of initial_validators[%d]", what, first))
+		} else {
+			seen[val.PublicKey] = i
+		}
+
+		if val.StakedAmount == 0 {
+			errs = append(errs, fmt.Errorf("%s: staked_amount is zero", what))
+		}
+		if val.SelfBond > val.StakedAmount {
+			errs = append(errs, fmt.Errorf("%s: self_bond %d exceeds staked_amount %d", what, val.SelfBond, val.StakedAmount))
+		}
+		if val.Commission > g.ValidatorSet.CommissionCap() {
+			errs = append(errs, fmt.Errorf("%s: commission %d above maximum %d basis points", what, val.Commission, g.ValidatorSet.CommissionCap()))
+		}
+
+		totalStake, err = AddAmounts(totalStake, val.StakedAmount)
+		check(err, what+": staked_amount")
+	}
+	if totalStake > g.InitialSupply {
+		errs = append(errs, fmt.Errorf("initial validators stake %d, more than the initial_supply %d", totalStake, g.InitialSupply))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Hash returns the canonical hash of a genesis config. It covers the
+// config as re-encoded, so files that differ only in layout, key order
+// or fields left at their defaults hash the same.
+func (g *GenesisConfig) Hash() (Hash, error) {
+	data, err := json.Marshal(g)
+	if err != nil {
+		return Hash{}, err
+	}
+	return NewHasher(TagGenesis).Bytes(data).Sum(), nil
+}
@@ -0,0 +1,21 @@
+package types
+
+// Heartbeat announces that a validator is online, so its status is known
+// before missed votes accumulate
+type Heartbeat struct {
+	Validator PublicKey `json:"validator"`
+	Height    uint64    `json:"height"`    // Sender's chain height
+	Timestamp int64     `json:"timestamp"` // Unix seconds
+	Signature Signature `json:"signature"`
+}
+
+// SigningHash is the message signed by the validator. It binds the
+// heartbeat to one chain so it cannot be replayed on another.
+func (hb *Heartbeat) SigningHash(chainID string) Hash {
+	return NewHasher(TagHeartbeat).
+		String(chainID).
+		Fixed(hb.Validator[:]).
+		Uint64(hb.Height).
+		Uint64(uint64(hb.Timestamp)).
+		Sum()
+}
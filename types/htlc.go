@@ -0,0 +1,68 @@
+package types
+
+// TxVersionHashLock is the first transaction version that may create or
+// spend hash-locked outputs. It needs protocol version 3.
+const TxVersionHashLock = 3
+
+// MaxPreimageSize bounds the secret revealed to redeem a hash lock
+const MaxPreimageSize = 64
+
+// HashLock makes an output a hashed timelock contract (HTLC), the
+// building block of atomic swaps. The recipient spends it by revealing
+// a secret whose SHA-256 is Hash; from RefundHeight on, the sender can
+// take it back instead. Keys are plain public keys, so hash-locked
+// outputs are not private.
+type HashLock struct {
+	Hash         Hash      // SHA-256 of the secret
+	RecipientKey PublicKey // Signs redeems
+	RefundKey    PublicKey // Signs refunds
+	RefundHeight uint64    // First block height a refund is valid at
+}
+
+// HashLockSpend spends a hash-locked output. Like a multisig spend it
+// names the output, so it has no ring anonymity.
+type HashLockSpend struct {
+	TxHash      Hash
+	OutputIndex uint32
+	Preimage    []byte `json:",omitempty"` // The secret when redeeming, empty when refunding
+	Signature   Signature
+}
+
+// HasHashLocks reports whether a transaction creates or spends
+// hash-locked outputs
+func (tx *Transaction) HasHashLocks() bool {
+	for _, in := range tx.AllInputs() {
+		if in.HashLock != nil {
+			return true
+		}
+	}
+	for _, out := range tx.AllOutputs() {
+		if out.HashLock != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// writeHashLocks hashes the hash locks of a transaction's inputs and
+// outputs, except signatures. Only transactions of TxVersionHashLock and
+// later include them, so older transaction IDs are unchanged.
+func writeHashLocks(h *Hasher, tx *Transaction) {
+	for _, in := range tx.Inputs {
+		h.Bool(in.HashLock != nil)
+		if spend := in.HashLock; spend != nil {
+			h.Fixed(spend.TxHash[:])
+			h.Uint32(spend.OutputIndex)
+			h.Bytes(spend.Preimage)
+		}
+	}
+	for _, out := range tx.Outputs {
+		h.Bool(out.HashLock != nil)
+		if lock := out.HashLock; lock != nil {
+			h.Fixed(lock.Hash[:])
+			h.Fixed(lock.RecipientKey[:])
+			h.Fixed(lock.RefundKey[:])
+			h.Uint64(lock.RefundHeight)
+		}
+	}
+}
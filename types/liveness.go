@@ -0,0 +1,110 @@
+package types
+
+import "errors"
+
+// Liveness defaults used when the genesis leaves a field unset
+const (
+	DefaultSignedBlocksWindow   = 1000
+	DefaultMinSignedPercent     = 50
+	DefaultDowntimeSlashPercent = 1
+	DefaultDowntimeJailBlocks   = 600
+)
+
+// LastCommitVersion is the first protocol version whose blocks carry
+// the late votes for their parent, and that jails validators for
+// downtime. Before it only the votes of the certificate are counted,
+// which the proposer closes at 2/3 of the stake, so honest validators
+// could be jailed for voting late; and jailed validators could not
+// unjail without staking transactions in blocks (StakingVersion).
+const LastCommitVersion = 14
+
+// LivenessConfig punishes validators that stop voting. Participation is
+// tracked over the last SignedBlocksWindow blocks; a validator that signed
+// fewer than MinSignedPercent of them is slashed and jailed, from
+// LastCommitVersion on.
+type LivenessConfig struct {
+	SignedBlocksWindow   uint64 `json:"signed_blocks_window,omitempty"`
+	MinSignedPercent     uint64 `json:"min_signed_percent,omitempty"`
+	DowntimeSlashPercent uint64 `json:"downtime_slash_percent,omitempty"`
+	DowntimeJailBlocks   uint64 `json:"downtime_jail_blocks,omitempty"` // Blocks before an unjail is accepted
+}
+
+// Validate checks the liveness parameters
+func (c LivenessConfig) Validate() error {
+	if c.MinSignedPercent > 100 || c.DowntimeSlashPercent > 100 {
+		return errors.New("liveness percentages must not exceed 100")
+	}
+	return nil
+}
+
+// Window returns the number of blocks participation is tracked over
+func (c LivenessConfig) Window() uint64 {
+	if c.SignedBlocksWindow == 0 {
+		return DefaultSignedBlocksWindow
+	}
+	return c.SignedBlocksWindow
+}
+
+// MaxMissed returns the most blocks a validator may miss in a window
+// before it is jailed
+func (c LivenessConfig) MaxMissed() uint64 {
+	percent := c.MinSignedPercent
+	if percent == 0 {
+		percent = DefaultMinSignedPercent
+	}
+	return c.Window() - c.Window()*percent/100
+}
+
+// SlashPercent returns the share of stake slashed for downtime
+func (c LivenessConfig) SlashPercent() uint64 {
+	if c.DowntimeSlashPercent == 0 {
+		return DefaultDowntimeSlashPercent
+	}
+	return c.DowntimeSlashPercent
+}
+
+// JailBlocks returns how long a jailed validator must wait to unjail
+func (c LivenessConfig) JailBlocks() uint64 {
+	if c.DowntimeJailBlocks == 0 {
+		return DefaultDowntimeJailBlocks
+	}
+	return c.DowntimeJailBlocks
+}
+
+// MarkSigned records whether a validator voted on the block at height.
+// Bit height%window of MissedBlocks is set for a missed block.
+func (v *ValidatorState) MarkSigned(height, window uint64, signed bool) {
+	if uint64(len(v.MissedBlocks)) != (window+7)/8 {
+		v.MissedBlocks = make([]byte, (window+7)/8)
+		v.MissedCount = 0
+	}
+
+	i := height % window
+	mask := byte(1) << (i % 8)
+	missed := v.MissedBlocks[i/8]&mask != 0
+
+	switch {
+	case !signed && !missed:
+		v.MissedBlocks[i/8] |= mask
+		v.MissedCount++
+	case signed && missed:
+		v.MissedBlocks[i/8] &^= mask
+		v.MissedCount--
+	}
+}
+
+// MissedAt reports whether a validator's vote on the block at height is
+// recorded as missed
+func (v *ValidatorState) MissedAt(height, window uint64) bool {
+	if uint64(len(v.MissedBlocks)) != (window+7)/8 {
+		return false
+	}
+	i := height % window
+	return v.MissedBlocks[i/8]&(byte(1)<<(i%8)) != 0
+}
+
+// ResetSigning clears a validator's participation record
+func (v *ValidatorState) ResetSigning() {
+	v.MissedBlocks = nil
+	v.MissedCount = 0
+}
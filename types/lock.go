@@ -0,0 +1,204 @@
+package types
+
+import "fmt"
+
+// TxVersionLock is the first transaction version that may create or spend
+// outputs with lock conditions. It needs protocol version 4.
+const TxVersionLock = 4
+
+const (
+	// MaxLockPaths bounds the alternative spend paths of a lock
+	MaxLockPaths = 4
+
+	// MaxPathConditions bounds the conditions of one spend path
+	MaxPathConditions = 4
+
+	// MaxPathKeys bounds the keys across the conditions of one path, so
+	// witness signatures can index them with a uint8
+	MaxPathKeys = 16
+)
+
+// ConditionType identifies what a Condition requires of a spend
+type ConditionType uint8
+
+const (
+	ConditionKey      ConditionType = iota + 1 // A signature by Keys[0]
+	ConditionMultisig                          // Threshold signatures by distinct Keys
+	ConditionTimelock                          // A block height of at least Height
+	ConditionHashLock                          // A preimage whose SHA-256 is Hash
+)
+
+func (t ConditionType) String() string {
+	switch t {
+	case ConditionKey:
+		return "key"
+	case ConditionMultisig:
+		return "multisig"
+	case ConditionTimelock:
+		return "timelock"
+	case ConditionHashLock:
+		return "hashlock"
+	}
+	return fmt.Sprintf("condition(%d)", uint8(t))
+}
+
+// Condition is one requirement of a spend path. Only the fields used by
+// its type are set.
+type Condition struct {
+	Type      ConditionType
+	Keys      []PublicKey `json:",omitempty"` // Key and Multisig
+	Threshold uint8       `json:",omitempty"` // Multisig
+	Height    uint64      `json:",omitempty"` // Timelock
+	Hash      Hash        // HashLock
+}
+
+// KeyCondition requires a signature by key
+func KeyCondition(key PublicKey) Condition {
+	return Condition{Type: ConditionKey, Keys: []PublicKey{key}}
+}
+
+// ThresholdCondition requires threshold signatures by distinct keys
+func ThresholdCondition(threshold uint8, keys []PublicKey) Condition {
+	return Condition{Type: ConditionMultisig, Keys: keys, Threshold: threshold}
+}
+
+// TimelockCondition requires the spend to be in a block at height or later
+func TimelockCondition(height uint64) Condition {
+	return Condition{Type: ConditionTimelock, Height: height}
+}
+
+// HashLockCondition requires revealing a secret whose SHA-256 is hash
+func HashLockCondition(hash Hash) Condition {
+	return Condition{Type: ConditionHashLock, Hash: hash}
+}
+
+// SpendPath is a set of conditions that must all hold
+type SpendPath []Condition
+
+// Keys returns the keys of a path's conditions in order. Witness
+// signatures index into this list.
+func (p SpendPath) Keys() []PublicKey {
+	var keys []PublicKey
+	for _, cond := range p {
+		keys = append(keys, cond.Keys...)
+	}
+	return keys
+}
+
+// Lock attaches spend conditions to an output, which can then be spent
+// through any one of its paths. It is the general form of multisig and
+// hash lock outputs; new kinds of contracts should be built from it
+// rather than from new output fields. Keys are plain public keys and
+// spends name the output, so locked outputs are not private.
+type Lock struct {
+	Paths []SpendPath
+}
+
+// Witness spends a locked output through one of its paths
+type Witness struct {
+	TxHash      Hash
+	OutputIndex uint32
+	Path        uint8               // Index into Lock.Paths
+	Preimage    []byte              `json:",omitempty"` // For a HashLock condition
+	Signatures  []MultisigSignature // KeyIndex into the path's Keys
+}
+
+// SpendLock returns the conditions under which an output is spent by
+// reference: its Lock, or the equivalent of its multisig or hash lock
+// condition. It is nil for outputs spent with a ring signature.
+func (out *TxOutput) SpendLock() *Lock {
+	switch {
+	case out.Lock != nil:
+		return out.Lock
+	case out.Multisig != nil:
+		return &Lock{Paths: []SpendPath{
+			{ThresholdCondition(out.Multisig.Threshold, out.Multisig.Keys)},
+		}}
+	case out.HashLock != nil:
+		lock := out.HashLock
+		return &Lock{Paths: []SpendPath{
+			{HashLockCondition(lock.Hash), KeyCondition(lock.RecipientKey)},
+			{TimelockCondition(lock.RefundHeight), KeyCondition(lock.RefundKey)},
+		}}
+	}
+	return nil
+}
+
+// SpendWitness returns the witness of an input that spends an output by
+// reference, converting multisig and hash lock spends to the paths of
+// SpendLock. It is nil for ring-signed inputs.
+func (in *TxInput) SpendWitness() *Witness {
+	switch {
+	case in.Witness != nil:
+		return in.Witness
+	case in.Multisig != nil:
+		return &Witness{
+			TxHash:      in.Multisig.TxHash,
+			OutputIndex: in.Multisig.OutputIndex,
+			Signatures:  in.Multisig.Signatures,
+		}
+	case in.HashLock != nil:
+		spend := in.HashLock
+		w := &Witness{
+			TxHash:      spend.TxHash,
+			OutputIndex: spend.OutputIndex,
+			Preimage:    spend.Preimage,
+			Signatures:  []MultisigSignature{{KeyIndex: 0, Signature: spend.Signature}},
+		}
+		if len(spend.Preimage) == 0 {
+			w.Path = 1 // Refund
+		}
+		return w
+	}
+	return nil
+}
+
+// HasLocks reports whether a transaction creates or spends outputs with
+// lock conditions
+func (tx *Transaction) HasLocks() bool {
+	for _, in := range tx.AllInputs() {
+		if in.Witness != nil {
+			return true
+		}
+	}
+	for _, out := range tx.AllOutputs() {
+		if out.Lock != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// writeLocks hashes the locks and witnesses of a transaction, except
+// signatures. Only transactions of TxVersionLock and later include them,
+// so older transaction IDs are unchanged.
+func writeLocks(h *Hasher, tx *Transaction) {
+	for _, in := range tx.Inputs {
+		h.Bool(in.Witness != nil)
+		if w := in.Witness; w != nil {
+			h.Fixed(w.TxHash[:])
+			h.Uint32(w.OutputIndex)
+			h.Uint8(w.Path)
+			h.Bytes(w.Preimage)
+		}
+	}
+	for _, out := range tx.Outputs {
+		h.Bool(out.Lock != nil)
+		if lock := out.Lock; lock != nil {
+			h.Uint32(uint32(len(lock.Paths)))
+			for _, path := range lock.Paths {
+				h.Uint32(uint32(len(path)))
+				for _, cond := range path {
+					h.Uint8(uint8(cond.Type))
+					h.Uint32(uint32(len(cond.Keys)))
+					for _, k := range cond.Keys {
+						h.Fixed(k[:])
+					}
+					h.Uint8(cond.Threshold)
+					h.Uint64(cond.Height)
+					h.Fixed(cond.Hash[:])
+				}
+			}
+		}
+	}
+}
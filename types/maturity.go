@@ -0,0 +1,51 @@
+package types
+
+import "fmt"
+
+// MaturityVersion is the protocol version that enforces the genesis
+// maturity rules. Before it, outputs only need MinRingMemberAge blocks
+// to appear in rings (from TxVersionRingIndex).
+const MaturityVersion = 11
+
+// DefaultCoinbaseConfirmations is how deep a coinbase output must be
+// buried when the genesis sets no other depth. Rewards vanish if their
+// block is reorganized away, and so would every ring they joined.
+const DefaultCoinbaseConfirmations = 60
+
+// MaxConfirmations bounds the maturity depths
+const MaxConfirmations = 1 << 20
+
+// MaturityConfig sets how many blocks an output must be buried under
+// before it can be spent or used as a decoy. Depths below
+// MinRingMemberAge are raised to it.
+type MaturityConfig struct {
+	Confirmations         uint64 `json:"confirmations,omitempty"`          // 0 for MinRingMemberAge
+	CoinbaseConfirmations uint64 `json:"coinbase_confirmations,omitempty"` // 0 for DefaultCoinbaseConfirmations
+}
+
+// Validate checks the depths
+func (c MaturityConfig) Validate() error {
+	if c.Confirmations > MaxConfirmations || c.CoinbaseConfirmations > MaxConfirmations {
+		return fmt.Errorf("confirmations must not exceed %d", MaxConfirmations)
+	}
+	return nil
+}
+
+// Required returns the blocks an output must be buried under, coinbase
+// outputs and others alike
+func (c MaturityConfig) Required(coinbase bool) uint64 {
+	depth := c.Confirmations
+	if coinbase {
+		depth = c.CoinbaseConfirmations
+		if depth == 0 {
+			depth = DefaultCoinbaseConfirmations
+		}
+	}
+	return max(depth, MinRingMemberAge)
+}
+
+// Mature reports whether an output created at created may be spent or
+// used as a decoy in the block at height
+func (c MaturityConfig) Mature(created, height uint64, coinbase bool) bool {
+	return created+c.Required(coinbase) <= height
+}
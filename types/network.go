@@ -0,0 +1,39 @@
+package types
+
+import "fmt"
+
+// Network names which network a chain belongs to. Wallet files and
+// addresses carry it, so coins are not sent to, or from, the wrong
+// network by mistake.
+type Network string
+
+const (
+	Mainnet Network = "mainnet"
+	Testnet Network = "testnet"
+)
+
+// DefaultNetwork is the network of a genesis that names none. Chains
+// started before networks were named are all test networks.
+const DefaultNetwork = Testnet
+
+// Networks lists the known networks
+var Networks = []Network{Mainnet, Testnet}
+
+// OrDefault returns the network, or DefaultNetwork if it is unset
+func (n Network) OrDefault() Network {
+	if n == "" {
+		return DefaultNetwork
+	}
+	return n
+}
+
+// Validate checks that the network is known. An unset network is
+// DefaultNetwork.
+func (n Network) Validate() error {
+	for _, known := range Networks {
+		if n.OrDefault() == known {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown network %q (want mainnet or testnet)", string(n))
+}
@@ -0,0 +1,52 @@
+package types
+
+import "errors"
+
+// RejectCode classifies why a transaction was refused, so wallets can
+// react without parsing error messages. Nodes return it over RPC and in
+// replies to stem relay.
+type RejectCode string
+
+const (
+	RejectInvalid         RejectCode = "invalid"          // Breaks a rule not listed below; do not retry
+	RejectInsufficientFee RejectCode = "insufficient_fee" // Below the base fee plus memo fee; raise the fee
+	RejectDoubleSpend     RejectCode = "double_spend"     // Spends a key image already spent
+	RejectBadRing         RejectCode = "bad_ring"         // Ring signature, ring size or ring members are wrong
+	RejectTooLarge        RejectCode = "too_large"        // A memo, preimage or the whole encoding is too big
+	RejectExpired         RejectCode = "expired"          // Built for a chain state that has moved on
+	RejectImmature        RejectCode = "immature"         // Spends outputs not yet spendable; may pass later
+	RejectDuplicate       RejectCode = "duplicate"        // Already in the mempool
+	RejectPoolFull        RejectCode = "pool_full"        // The mempool is full; retry later
+)
+
+// RejectError is a transaction rejection with its code
+type RejectError struct {
+	Code RejectCode
+	Err  error
+}
+
+func (e *RejectError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RejectError) Unwrap() error {
+	return e.Err
+}
+
+// Reject classifies err under code
+func Reject(code RejectCode, err error) error {
+	return &RejectError{Code: code, Err: err}
+}
+
+// RejectCodeOf returns the code of a rejection, RejectInvalid for errors
+// without one and "" for nil
+func RejectCodeOf(err error) RejectCode {
+	if err == nil {
+		return ""
+	}
+	var rejectErr *RejectError
+	if errors.As(err, &rejectErr) {
+		return rejectErr.Code
+	}
+	return RejectInvalid
+}
@@ -0,0 +1,61 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+)
+
+// RingSizeVersion is the protocol version that enforces the ring size
+// policy
+const RingSizeVersion = 9
+
+// MaxRingSize bounds the ring size a policy may allow, so a single
+// signature cannot make every node verify thousands of ring members
+const MaxRingSize = 128
+
+// RingPolicy bounds the ring size, real input included, of every ring
+// signature. Rings of one size look alike; a wallet choosing a small
+// ring weakens the privacy of the decoys it borrows as well as its own.
+// Setting both bounds to the same value fixes the ring size.
+type RingPolicy struct {
+	MinSize int `json:"min_size,omitempty"` // 0 for no minimum
+	MaxSize int `json:"max_size,omitempty"` // 0 for MaxRingSize
+}
+
+// Validate checks the bounds
+func (p RingPolicy) Validate() error {
+	if p.MinSize < 0 || p.MaxSize < 0 {
+		return errors.New("ring sizes must not be negative")
+	}
+	if p.MinSize > MaxRingSize || p.MaxSize > MaxRingSize {
+		return fmt.Errorf("ring sizes must not exceed %d", MaxRingSize)
+	}
+	if p.MaxSize > 0 && p.MinSize > p.MaxSize {
+		return errors.New("min_size exceeds max_size")
+	}
+	return nil
+}
+
+// Max returns the largest ring size allowed
+func (p RingPolicy) Max() int {
+	if p.MaxSize == 0 {
+		return MaxRingSize
+	}
+	return p.MaxSize
+}
+
+// Check fails if size is outside the policy
+func (p RingPolicy) Check(size int) error {
+	if size < p.MinSize {
+		return fmt.Errorf("ring size %d below network minimum %d", size, p.MinSize)
+	}
+	if size > p.Max() {
+		return fmt.Errorf("ring size %d above network maximum %d", size, p.Max())
+	}
+	return nil
+}
+
+// Clamp returns the ring size closest to size that the policy allows
+func (p RingPolicy) Clamp(size int) int {
+	return min(max(size, p.MinSize), p.Max())
+}
@@ -0,0 +1,84 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+)
+
+// TxVersionRingIndex is the first transaction version whose ring-signed
+// inputs reference their ring members by global output index. It needs
+// protocol version 10, from which ring-signed inputs must carry them.
+const TxVersionRingIndex = 10
+
+// MinRingMemberAge is the number of blocks an output must be buried
+// under before it may appear in a ring, as decoy or as the real input.
+// Rings of fresh outputs would give away the real input, and a reorg
+// could remove members from under a ring.
+const MinRingMemberAge = 10
+
+// IndexedOutput is an entry of the global output index: the one-time key
+// of an output that may be a ring member, the height that created it and
+// whether a coinbase did. An output's global index is its position in
+// the index.
+type IndexedOutput struct {
+	Key      PublicKey `json:"key"`
+	Height   uint64    `json:"height"`
+	Coinbase bool      `json:"coinbase,omitempty"`
+}
+
+// IsRingMember reports whether an output can appear in rings, and so
+// gets a global output index. Hash-locked and locked outputs are spent
+// by reference and burns are never spent.
+func (out *TxOutput) IsRingMember() bool {
+	return out.HashLock == nil && out.Lock == nil && !out.Burn
+}
+
+// RingOffsets encodes ascending global output indexes as offsets: the
+// first index, then the distance from each index to the next
+func RingOffsets(indexes []uint64) []uint64 {
+	offsets := make([]uint64, len(indexes))
+	var prev uint64
+	for i, index := range indexes {
+		offsets[i] = index - prev
+		prev = index
+	}
+	return offsets
+}
+
+// ResolveOffsets decodes ring offsets into global output indexes. Every
+// offset after the first must be positive, so the indexes are strictly
+// ascending and a ring cannot name an output twice.
+func ResolveOffsets(offsets []uint64) ([]uint64, error) {
+	if len(offsets) == 0 {
+		return nil, errors.New("no ring member offsets")
+	}
+	indexes := make([]uint64, len(offsets))
+	var index uint64
+	for i, offset := range offsets {
+		if i > 0 && offset == 0 {
+			return nil, errors.New("ring names an output twice")
+		}
+		if offset > ^uint64(0)-index {
+			return nil, fmt.Errorf("ring member offset %d overflows", i)
+		}
+		index += offset
+		indexes[i] = index
+	}
+	return indexes, nil
+}
+
+// writeRingOffsets hashes the ring member offsets of the inputs.
+// Transactions from TxVersionRingIndex include them, so older
+// transaction IDs are unchanged.
+func writeRingOffsets(h *Hasher, tx *Transaction) {
+	for _, in := range tx.Inputs {
+		writeOffsets(h, in.RingOffsets)
+	}
+}
+
+func writeOffsets(h *Hasher, offsets []uint64) {
+	h.Uint32(uint32(len(offsets)))
+	for _, offset := range offsets {
+		h.Uint64(offset)
+	}
+}
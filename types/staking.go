@@ -0,0 +1,115 @@
+package types
+
+import "errors"
+
+// StakingVersion is the first protocol version whose blocks carry
+// staking transactions. Before it bonds, unbonds, commission changes and
+// unjails cannot take effect.
+const StakingVersion = 14
+
+// TxVersionBond is the first transaction version whose burns may pay
+// for a validator's stake. It needs protocol version 14.
+const TxVersionBond = 14
+
+// UnbondingPeriod is how many blocks an unbonding validator waits
+// before its stake is released
+const UnbondingPeriod = 100
+
+// StakeRelease makes a transaction pay a validator's stake back out
+// once its unbonding period is over. Bonds burned the staked coins, so
+// the release creates its outputs, which must add up to the stake. It
+// has no inputs; the validator signs ReleaseSigningHash. Until must be
+// the validator's UnbondingUntil, so a release applies only once.
+type StakeRelease struct {
+	Validator PublicKey
+	Until     uint64
+	Signature Signature
+}
+
+// IsStakeRelease reports whether a transaction pays back a validator's
+// stake
+func (tx *Transaction) IsStakeRelease() bool {
+	return tx.Release != nil
+}
+
+// ReleaseSigningHash is what a validator signs to release its stake. It
+// commits to the chain and the transaction prefix, which covers the
+// validator, Until and the outputs.
+func ReleaseSigningHash(chainID string, prefixHash Hash) Hash {
+	return NewHasher(TagRelease).
+		String(chainID).
+		Fixed(prefixHash[:]).
+		Sum()
+}
+
+// Hash identifies a staking transaction, signature included
+func (stx *StakingTx) Hash() Hash {
+	return NewHasher(TagStakingTx).
+		Uint8(uint8(stx.Type)).
+		Fixed(stx.Validator[:]).
+		Uint64(stx.Amount).
+		Uint64(stx.SelfBond).
+		Uint32(stx.Commission).
+		Uint64(stx.Nonce).
+		Fixed(stx.Funding[:]).
+		Fixed(stx.Signature[:]).
+		Sum()
+}
+
+// HasBonds reports whether any output of a transaction bonds stake
+func (tx *Transaction) HasBonds() bool {
+	for _, out := range tx.Outputs {
+		if out.Bond != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Bonded returns the validator a transaction's bond burns pay for and
+// their sum. A bond is paid to one validator, so all of them must name
+// the same one.
+func (tx *Transaction) Bonded() (PublicKey, uint64, error) {
+	var validator PublicKey
+	amounts := make([]uint64, 0)
+	for _, out := range tx.Outputs {
+		if out.Bond == nil {
+			continue
+		}
+		if !out.Burn {
+			return validator, 0, errors.New("only burns can bond stake")
+		}
+		if len(amounts) > 0 && *out.Bond != validator {
+			return validator, 0, errors.New("transaction bonds stake to more than one validator")
+		}
+		validator = *out.Bond
+		amounts = append(amounts, out.Amount)
+	}
+	if len(amounts) == 0 {
+		return validator, 0, errors.New("transaction bonds no stake")
+	}
+	amount, err := AddAmounts(amounts...)
+	return validator, amount, err
+}
+
+// writeBonds hashes the validators bond burns pay for. Transactions
+// from TxVersionBond include them, so older transaction IDs are
+// unchanged.
+func writeBonds(h *Hasher, tx *Transaction) {
+	for _, out := range tx.Outputs {
+		h.Bool(out.Bond != nil)
+		if out.Bond != nil {
+			h.Fixed(out.Bond[:])
+		}
+	}
+}
+
+// writeRelease hashes a transaction's stake release, except its
+// signature. Only releases write it, so the IDs of other transactions
+// from TxVersionBond are unchanged.
+func writeRelease(h *Hasher, tx *Transaction) {
+	if r := tx.Release; r != nil {
+		h.Fixed(r.Validator[:])
+		h.Uint64(r.Until)
+	}
+}
@@ -0,0 +1,311 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+)
+
+// StateChunkSize is the number of state entries committed per chunk
+const StateChunkSize = 1024
+
+// Leaf kinds in the state commitment
+const (
+	stateLeafOutput uint8 = iota
+	stateLeafKeyImage
+	stateLeafValidator
+	stateLeafRingOutput
+)
+
+// StateManifest describes a chunked state snapshot. Its StateRoot is the
+// value committed to by block headers.
+type StateManifest struct {
+	Height      uint64      `json:"height"`
+	TotalSupply uint64      `json:"total_supply"`
+	Supply      SupplyStats `json:"supply"`
+	Treasury    Treasury    `json:"treasury"`
+	BaseFee     uint64      `json:"base_fee"`
+	Chunks      uint32      `json:"chunks"`
+	ChunkRoot   Hash        `json:"chunk_root"` // Merkle root of the chunk hashes
+}
+
+// StateRoot commits to the supply, its accounting, the treasury, the
+// base fee and every chunk of the state
+func (m *StateManifest) StateRoot() Hash {
+	h := NewHasher(TagStateRoot).
+		Uint64(m.TotalSupply).
+		Uint64(m.Supply.Genesis).
+		Uint64(m.Supply.Minted).
+		Uint64(m.Supply.Burned).
+		Uint64(m.Supply.Slashed).
+		Uint64(m.Treasury.Balance).
+		Uint64(m.Treasury.Spends).
+		Uint64(m.BaseFee).
+		Uint32(m.Chunks).
+		Fixed(m.ChunkRoot[:])
+
+	// Only states where stake was released hash it, so the roots of the
+	// rest are unchanged
+	if m.Supply.Released != 0 {
+		h.Uint64(m.Supply.Released)
+	}
+	return h.Sum()
+}
+
+// StateChunk is a run of consecutive state entries. Entries follow
+// snapshot order: outputs, then key images, then validators, then the
+// global output index.
+type StateChunk struct {
+	Index       uint32           `json:"index"`
+	UTXOs       []*UTXO          `json:"utxos,omitempty"`
+	KeyImages   []PublicKey      `json:"key_images,omitempty"`
+	Validators  []ValidatorState `json:"validators,omitempty"`
+	RingOutputs []IndexedOutput  `json:"ring_outputs,omitempty"`
+}
+
+// Len returns the number of entries in the chunk
+func (c *StateChunk) Len() int {
+	return len(c.UTXOs) + len(c.KeyImages) + len(c.Validators) + len(c.RingOutputs)
+}
+
+// Hash computes the Merkle root of the chunk's entries
+func (c *StateChunk) Hash() Hash {
+	leaves := make([]Hash, 0, c.Len())
+
+	for _, utxo := range c.UTXOs {
+		h := NewHasher(TagStateLeaf).Uint8(stateLeafOutput)
+		h.Fixed(utxo.TxHash[:]).Uint32(utxo.OutputIndex).Uint64(utxo.BlockHeight)
+		writeOutput(h, utxo.Output)
+		leaves = append(leaves, h.Sum())
+	}
+
+	for _, keyImage := range c.KeyImages {
+		leaves = append(leaves, NewHasher(TagStateLeaf).Uint8(stateLeafKeyImage).Fixed(keyImage[:]).Sum())
+	}
+
+	for _, val := range c.Validators {
+		h := NewHasher(TagStateLeaf).
+			Uint8(stateLeafValidator).
+			Fixed(val.PublicKey[:]).
+			Uint64(val.StakedAmount).
+			Bool(val.Active).
+			Bool(val.Queued).
+			Uint64(val.JoinedHeight).
+			Uint64(val.UnbondingUntil).
+			Uint32(val.SlashCount).
+			Uint64(val.SelfBond).
+			Uint32(val.Commission).
+			Uint64(val.CommissionEpoch).
+			Bytes(val.MissedBlocks).
+			Uint64(val.MissedCount).
+			Bool(val.Jailed).
+			Uint64(val.JailedUntil).
+			Uint64(val.StakingNonce)
+
+		// Only validators punished for a double vote hash its height, so
+		// the leaves of the rest are unchanged
+		if val.EvidenceHeight != 0 {
+			h.Uint64(val.EvidenceHeight)
+		}
+		leaves = append(leaves, h.Sum())
+	}
+
+	for _, out := range c.RingOutputs {
+		leaves = append(leaves, NewHasher(TagStateLeaf).
+			Uint8(stateLeafRingOutput).
+			Fixed(out.Key[:]).
+			Uint64(out.Height).
+			Bool(out.Coinbase).
+			Sum())
+	}
+
+	return MerkleRoot(leaves)
+}
+
+// ChunkedState is a snapshot split into chunks, ready to be served with
+// proofs
+type ChunkedState struct {
+	Manifest StateManifest
+	Chunks   []*StateChunk
+	hashes   []Hash
+}
+
+// NewChunkedState splits a canonical snapshot into chunks
+func NewChunkedState(snap *StateSnapshot) *ChunkedState {
+	cs := &ChunkedState{}
+
+	var chunk *StateChunk
+	next := func() *StateChunk {
+		if chunk == nil || chunk.Len() == StateChunkSize {
+			chunk = &StateChunk{Index: uint32(len(cs.Chunks))}
+			cs.Chunks = append(cs.Chunks, chunk)
+		}
+		return chunk
+	}
+
+	for _, utxo := range snap.UTXOs {
+		c := next()
+		c.UTXOs = append(c.UTXOs, utxo)
+	}
+	for _, keyImage := range snap.KeyImages {
+		c := next()
+		c.KeyImages = append(c.KeyImages, keyImage)
+	}
+	for _, val := range snap.Validators {
+		c := next()
+		c.Validators = append(c.Validators, val)
+	}
+	for _, out := range snap.RingOutputs {
+		c := next()
+		c.RingOutputs = append(c.RingOutputs, out)
+	}
+
+	cs.hashes = make([]Hash, len(cs.Chunks))
+	for i, c := range cs.Chunks {
+		cs.hashes[i] = c.Hash()
+	}
+
+	cs.Manifest = StateManifest{
+		Height:      snap.Height,
+		TotalSupply: snap.TotalSupply,
+		Supply:      snap.Supply,
+		Treasury:    snap.Treasury,
+		BaseFee:     snap.BaseFee,
+		Chunks:      uint32(len(cs.Chunks)),
+		ChunkRoot:   MerkleRoot(cs.hashes),
+	}
+
+	return cs
+}
+
+// Proof returns the Merkle branch of a chunk against the chunk root
+func (cs *ChunkedState) Proof(index uint32) []Hash {
+	return MerkleProof(cs.hashes, int(index))
+}
+
+// VerifyChunk checks a chunk and its proof against the manifest
+func (m *StateManifest) VerifyChunk(chunk *StateChunk, proof []Hash) error {
+	if chunk.Index >= m.Chunks {
+		return fmt.Errorf("chunk %d out of range (%d chunks)", chunk.Index, m.Chunks)
+	}
+	if chunk.Len() == 0 || chunk.Len() > StateChunkSize {
+		return fmt.Errorf("chunk %d has %d entries", chunk.Index, chunk.Len())
+	}
+	if chunk.Index < m.Chunks-1 && chunk.Len() != StateChunkSize {
+		return fmt.Errorf("chunk %d is not full", chunk.Index)
+	}
+	for _, utxo := range chunk.UTXOs {
+		if utxo == nil || utxo.Output == nil {
+			return fmt.Errorf("chunk %d contains an empty output", chunk.Index)
+		}
+	}
+
+	if !VerifyMerkleProof(m.ChunkRoot, chunk.Hash(), int(chunk.Index), int(m.Chunks), proof) {
+		return fmt.Errorf("chunk %d does not match the state root", chunk.Index)
+	}
+	return nil
+}
+
+// AssembleState rebuilds a snapshot from verified chunks
+func AssembleState(m *StateManifest, chunks []*StateChunk) (*StateSnapshot, error) {
+	if uint32(len(chunks)) != m.Chunks {
+		return nil, fmt.Errorf("have %d of %d chunks", len(chunks), m.Chunks)
+	}
+
+	snap := &StateSnapshot{
+		Height:      m.Height,
+		TotalSupply: m.TotalSupply,
+		Supply:      m.Supply,
+		Treasury:    m.Treasury,
+		BaseFee:     m.BaseFee,
+	}
+	for i, chunk := range chunks {
+		if chunk == nil || chunk.Index != uint32(i) {
+			return nil, errors.New("chunks out of order")
+		}
+		snap.UTXOs = append(snap.UTXOs, chunk.UTXOs...)
+		snap.KeyImages = append(snap.KeyImages, chunk.KeyImages...)
+		snap.Validators = append(snap.Validators, chunk.Validators...)
+		snap.RingOutputs = append(snap.RingOutputs, chunk.RingOutputs...)
+	}
+
+	return snap, nil
+}
+
+// MerkleRoot computes a binary Merkle root. An odd node at the end of a
+// level is carried up unchanged.
+func MerkleRoot(leaves []Hash) Hash {
+	if len(leaves) == 0 {
+		return NewHasher(TagStateNode).Sum()
+	}
+
+	level := leaves
+	for len(level) > 1 {
+		level = merkleLevel(level)
+	}
+
+	return level[0]
+}
+
+// MerkleProof returns the sibling hashes from a leaf up to the root
+func MerkleProof(leaves []Hash, index int) []Hash {
+	var proof []Hash
+
+	level := leaves
+	for len(level) > 1 {
+		if sibling := index ^ 1; sibling < len(level) {
+			proof = append(proof, level[sibling])
+		}
+
+		level = merkleLevel(level)
+		index /= 2
+	}
+
+	return proof
+}
+
+// VerifyMerkleProof checks a leaf at index in a tree of count leaves
+func VerifyMerkleProof(root, leaf Hash, index, count int, proof []Hash) bool {
+	if index < 0 || index >= count {
+		return false
+	}
+
+	hash := leaf
+	for count > 1 {
+		switch {
+		case index%2 == 1:
+			if len(proof) == 0 {
+				return false
+			}
+			hash = merkleNode(proof[0], hash)
+			proof = proof[1:]
+		case index+1 < count:
+			if len(proof) == 0 {
+				return false
+			}
+			hash = merkleNode(hash, proof[0])
+			proof = proof[1:]
+		}
+		index /= 2
+		count = (count + 1) / 2
+	}
+
+	return len(proof) == 0 && hash == root
+}
+
+// merkleLevel hashes one level of the tree into the next
+func merkleLevel(level []Hash) []Hash {
+	next := make([]Hash, 0, (len(level)+1)/2)
+	for i := 0; i < len(level); i += 2 {
+		if i+1 < len(level) {
+			next = append(next, merkleNode(level[i], level[i+1]))
+		} else {
+			next = append(next, level[i])
+		}
+	}
+	return next
+}
+
+// merkleNode hashes two child nodes
+func merkleNode(left, right Hash) Hash {
+	return NewHasher(TagStateNode).Fixed(left[:]).Fixed(right[:]).Sum()
+}
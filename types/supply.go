@@ -0,0 +1,65 @@
+package types
+
+import "fmt"
+
+// SupplyStats accounts for how coins entered and left circulation since
+// genesis. The total supply is always Genesis + Minted + Released -
+// Burned.
+type SupplyStats struct {
+	Genesis uint64 `json:"genesis"` // Initial supply
+	Minted  uint64 `json:"minted"`  // Subsidies paid out by coinbases
+	Burned  uint64 `json:"burned"`  // Fees left unclaimed by coinbases and burn outputs
+
+	// Stake removed by slashing. NOTE: Phase 1 stake is not drawn from
+	// outputs, so slashing does not change the total supply.
+	Slashed uint64 `json:"slashed"`
+
+	// Stake paid back out by stake releases. Bonds burned it, so it is
+	// created again.
+	Released uint64 `json:"released,omitempty"`
+}
+
+// Total returns the supply the stats add up to
+func (s SupplyStats) Total() (uint64, error) {
+	created, err := AddAmounts(s.Genesis, s.Minted, s.Released)
+	if err != nil {
+		return 0, err
+	}
+	return SubAmounts(created, s.Burned)
+}
+
+// ApplyBlockReward accounts for a block whose coinbase claims claimed
+// and whose other transactions pay fees. Claims above the fees mint
+// coins; fees left unclaimed are burned.
+func (s *SupplyStats) ApplyBlockReward(claimed, fees uint64) error {
+	var err error
+	if claimed >= fees {
+		s.Minted, err = AddAmounts(s.Minted, claimed-fees)
+	} else {
+		s.Burned, err = AddAmounts(s.Burned, fees-claimed)
+	}
+	if err != nil {
+		return fmt.Errorf("supply accounting: %w", err)
+	}
+	return nil
+}
+
+// Release accounts for stake paid back out after unbonding
+func (s *SupplyStats) Release(amount uint64) error {
+	released, err := AddAmounts(s.Released, amount)
+	if err != nil {
+		return fmt.Errorf("supply accounting: %w", err)
+	}
+	s.Released = released
+	return nil
+}
+
+// Burn accounts for coins destroyed by burn outputs
+func (s *SupplyStats) Burn(amount uint64) error {
+	burned, err := AddAmounts(s.Burned, amount)
+	if err != nil {
+		return fmt.Errorf("supply accounting: %w", err)
+	}
+	s.Burned = burned
+	return nil
+}
@@ -0,0 +1,76 @@
+package types
+
+import "errors"
+
+// TxVersionTreasury is the first transaction version that may spend
+// from the treasury. It needs protocol version 5.
+const TxVersionTreasury = 5
+
+// MaxProposalSize bounds the description of a treasury spend
+const MaxProposalSize = 1024
+
+// Treasury is the protocol's community fund. It is credited
+// TreasuryPercent of every block subsidy and belongs to no key: coins
+// leave it only through treasury spends approved by the validators.
+type Treasury struct {
+	Balance uint64 `json:"balance"`
+	Spends  uint64 `json:"spends"` // Spends so far; the next must use it as its nonce
+}
+
+// TreasurySpend makes a transaction a governance proposal paying its
+// outputs out of the treasury. It has no inputs; validators holding 2/3
+// of the active stake approve it by signing TreasurySigningHash. Nonce
+// must equal the treasury's spend count, so a spend applies only once.
+type TreasurySpend struct {
+	Nonce     uint64
+	Proposal  string // What the spend funds
+	Approvals []TreasuryApproval
+}
+
+// TreasuryApproval is one validator's signature on a treasury spend
+type TreasuryApproval struct {
+	Validator PublicKey
+	Signature Signature
+}
+
+// IsTreasurySpend reports whether a transaction pays out of the
+// treasury
+func (tx *Transaction) IsTreasurySpend() bool {
+	return tx.Treasury != nil
+}
+
+// TreasurySigningHash is what validators sign to approve a treasury
+// spend. It commits to the chain and the transaction prefix, which
+// covers the nonce, proposal and outputs but not the approvals.
+func TreasurySigningHash(chainID string, prefixHash Hash) Hash {
+	return NewHasher(TagTreasury).
+		String(chainID).
+		Fixed(prefixHash[:]).
+		Sum()
+}
+
+// ValidateShape checks the parts of a treasury spend that do not depend
+// on state
+func (ts *TreasurySpend) ValidateShape() error {
+	if ts.Proposal == "" {
+		return errors.New("treasury spend needs a proposal")
+	}
+	if len(ts.Proposal) > MaxProposalSize {
+		return errors.New("proposal too long")
+	}
+	if len(ts.Approvals) == 0 {
+		return errors.New("treasury spend has no approvals")
+	}
+	return nil
+}
+
+// writeTreasury hashes a transaction's treasury spend, except approvals.
+// Only transactions of TxVersionTreasury and later include it, so older
+// transaction IDs are unchanged.
+func writeTreasury(h *Hasher, tx *Transaction) {
+	h.Bool(tx.Treasury != nil)
+	if ts := tx.Treasury; ts != nil {
+		h.Uint64(ts.Nonce)
+		h.String(ts.Proposal)
+	}
+}
@@ -1,8 +1,8 @@
 package types
 
 import (
-	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 )
 
 // Hash represents a 32-byte hash
@@ -12,6 +12,20 @@ func (h Hash) String() string {
 	return hex.EncodeToString(h[:])
 }
 
+// HashFromString decodes a hex-encoded hash
+func HashFromString(s string) (Hash, error) {
+	var h Hash
+	decoded, err := hex.DecodeString(s)
+	if err != nil {
+		return h, err
+	}
+	if len(decoded) != len(h) {
+		return h, errors.New("hash must be 32 bytes")
+	}
+	copy(h[:], decoded)
+	return h, nil
+}
+
 // PublicKey represents an Ed25519 public key
 type PublicKey [32]byte
 
@@ -46,6 +60,19 @@ func (pk *PublicKey) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// PaymentID lets a recipient tell deposits apart (e.g. per exchange user).
+// It travels encrypted to the recipient's view key.
+type PaymentID [8]byte
+
+func (pid PaymentID) String() string {
+	return hex.EncodeToString(pid[:])
+}
+
+// IsZero reports whether no payment ID is set
+func (pid PaymentID) IsZero() bool {
+	return pid == PaymentID{}
+}
+
 // Signature represents a cryptographic signature
 type Signature [64]byte
 
@@ -60,10 +87,21 @@ type Block struct {
 	Header       BlockHeader
 	Transactions []*Transaction
 	Validators   []ValidatorSignature
+	
+	// Double votes punished by this block (see evidence.go)
+	Evidence []*DoubleVote `json:",omitempty"`
+	
+	// Staking transactions applied by this block (see staking.go)
+	Staking []*StakingTx `json:",omitempty"`
+	
+	// Votes for the parent block that missed its certificate, counted
+	// for liveness (see liveness.go)
+	LastCommit []ValidatorSignature `json:",omitempty"`
 }
 
 // BlockHeader contains block metadata
 type BlockHeader struct {
+	Version       uint32 // Protocol version the block follows
 	Height        uint64
 	Timestamp     int64
 	PrevBlockHash Hash
@@ -73,14 +111,18 @@ type BlockHeader struct {
 	Round         uint32 // BFT round number
 }
 
-// Hash computes the block header hash
+// Hash computes the block header hash over every header field
 func (bh *BlockHeader) Hash() Hash {
-	data := append([]byte{}, bh.PrevBlockHash[:]...)
-	data = append(data, bh.TxRoot[:]...)
-	data = append(data, bh.StateRoot[:]...)
-	data = append(data, bh.Proposer[:]...)
-	// Add height, timestamp, round (simplified)
-	return sha256.Sum256(data)
+	return NewHasher(TagBlockHeader).
+		Uint32(bh.Version).
+		Uint64(bh.Height).
+		Uint64(uint64(bh.Timestamp)).
+		Fixed(bh.PrevBlockHash[:]).
+		Fixed(bh.TxRoot[:]).
+		Fixed(bh.StateRoot[:]).
+		Fixed(bh.Proposer[:]).
+		Uint32(bh.Round).
+		Sum()
 }
 
 // ValidatorSignature represents a validator's vote on a block
@@ -90,6 +132,19 @@ type ValidatorSignature struct {
 	Round     uint32
 }
 
+// SignedHeader is a block header with the validator votes that
+// finalized it, so light and syncing nodes can check finality without
+// the block body
+type SignedHeader struct {
+	Header     BlockHeader
+	Validators []ValidatorSignature
+}
+
+// SignedHeader returns the block's header and finality votes
+func (b *Block) SignedHeader() *SignedHeader {
+	return &SignedHeader{Header: b.Header, Validators: b.Validators}
+}
+
 // Transaction represents a private transaction
 type Transaction struct {
 	Version uint8
@@ -102,12 +157,35 @@ type Transaction struct {
 	
 	// Range proofs for amount hiding (placeholder for now)
 	RangeProofs [][]byte
+	
+	// Set when a third party pays the fee (see feepayer.go)
+	FeePayer *FeePayer `json:",omitempty"`
+	
+	// Set when the transaction pays out of the treasury (see treasury.go)
+	Treasury *TreasurySpend `json:",omitempty"`
+	
+	// Set when the transaction pays back a validator's stake after
+	// unbonding (see staking.go)
+	Release *StakeRelease `json:",omitempty"`
 }
 
 // TxInput references a previous output (by key image, not UTXO ID)
 type TxInput struct {
 	KeyImage PublicKey // Unique per output, prevents double-spend
 	Amount   uint64    // Hidden in real impl, visible for Phase 1
+	
+	// Set when spending a multisig output (no ring signature)
+	Multisig *MultisigSpend `json:",omitempty"`
+	
+	// Set when spending a hash-locked output (see htlc.go)
+	HashLock *HashLockSpend `json:",omitempty"`
+	
+	// Set when spending an output with a Lock (see lock.go)
+	Witness *Witness `json:",omitempty"`
+	
+	// Global output indexes of the ring members, as offsets (see
+	// ringindex.go)
+	RingOffsets []uint64 `json:",omitempty"`
 }
 
 // TxOutput represents a new UTXO with stealth address
@@ -115,6 +193,66 @@ type TxOutput struct {
 	Amount      uint64    // Will be hidden via Pedersen commitments later
 	StealthAddr Address   // One-time address
 	TxPublicKey PublicKey // Ephemeral key for ECDH
+	PaymentID   PaymentID // Encrypted to recipient, zero if unused
+	Memo        []byte    `json:",omitempty"` // Encrypted to recipient, at most MaxMemoSize bytes
+	
+	// Set when the output requires M-of-N signatures to spend
+	Multisig *MultisigCondition `json:",omitempty"`
+	
+	// Set when the output is a hashed timelock contract (see htlc.go)
+	HashLock *HashLock `json:",omitempty"`
+	
+	// Set when the output has general spend conditions (see lock.go)
+	Lock *Lock `json:",omitempty"`
+	
+	// Set when the output destroys its amount (see burn.go)
+	Burn bool `json:",omitempty"`
+	
+	// Set on a burn that pays for a validator's stake (see staking.go)
+	Bond *PublicKey `json:",omitempty"`
+	
+	// First byte of a hash of the shared secret, letting wallets skip
+	// outputs that are not theirs before deriving the one-time key (see
+	// viewtag.go)
+	ViewTag *uint8 `json:",omitempty"`
+}
+
+const (
+	// MaxMemoSize bounds the memo of a single output
+	MaxMemoSize = 256
+	
+	// MemoFeePerByte is the fee required on top of the base fee for
+	// every memo byte, so memos pay for the space they use
+	MemoFeePerByte = 10
+)
+
+// MultisigCondition restricts an output to M-of-N participant signatures
+// NOTE: Phase 1 uses the participants' base spend keys, so outputs of the
+// same group are linkable. Phase 2 derives per-output keys.
+type MultisigCondition struct {
+	Threshold uint8
+	Keys      []PublicKey
+}
+
+// MultisigSpend authorizes spending a multisig output. The output is
+// referenced directly, so these inputs have no ring anonymity.
+type MultisigSpend struct {
+	TxHash      Hash
+	OutputIndex uint32
+	Signatures  []MultisigSignature
+}
+
+// MultisigSignature is one participant's signature over the tx hash
+type MultisigSignature struct {
+	KeyIndex  uint8 // Index into MultisigCondition.Keys
+	Signature Signature
+}
+
+// MultisigAddress is the public address of an M-of-N wallet
+type MultisigAddress struct {
+	ViewKey   PublicKey
+	Threshold uint8
+	SpendKeys []PublicKey
 }
 
 // RingSignature provides sender anonymity
@@ -138,18 +276,69 @@ type UTXO struct {
 type ValidatorState struct {
 	PublicKey      PublicKey `json:"public_key"`
 	StakedAmount   uint64    `json:"staked_amount"`
-	Active         bool      `json:"active"`
+	Active         bool      `json:"active"`           // In the active set this epoch
+	Queued         bool      `json:"queued,omitempty"` // Waiting for a slot in the active set
 	JoinedHeight   uint64    `json:"joined_height"`
 	UnbondingUntil uint64    `json:"unbonding_until"`
 	SlashCount     uint32    `json:"slash_count"`
+	
+	// Stake bonded by the operator itself, part of StakedAmount
+	SelfBond uint64 `json:"self_bond,omitempty"`
+	
+	// Share of rewards kept by the operator, in basis points, and the
+	// epoch it was last changed in (see validators.go)
+	Commission      uint32 `json:"commission,omitempty"`
+	CommissionEpoch uint64 `json:"commission_epoch,omitempty"`
+	
+	// Missed votes over the liveness window (see liveness.go)
+	MissedBlocks []byte `json:"missed_blocks,omitempty"`
+	MissedCount  uint64 `json:"missed_count,omitempty"`
+	
+	// Jailed validators are out of the set until they unjail
+	Jailed      bool   `json:"jailed,omitempty"`
+	JailedUntil uint64 `json:"jailed_until,omitempty"`
+	
+	// Staking transactions accepted so far; the next must use it as its
+	// nonce
+	StakingNonce uint64 `json:"staking_nonce,omitempty"`
+	
+	// Height of the last double vote punished; evidence of one at or
+	// below it is refused (see evidence.go)
+	EvidenceHeight uint64 `json:"evidence_height,omitempty"`
 }
 
 // StakingTx represents a special transaction for staking
 type StakingTx struct {
-	Type      StakingType // Bond or Unbond
-	Validator PublicKey
-	Amount    uint64
-	Signature Signature
+	Type       StakingType // Bond, Unbond, SetCommission or Unjail
+	Validator  PublicKey
+	Amount     uint64
+	SelfBond   uint64 // Part of Amount bonded by the operator (Bond)
+	Commission uint32 // Basis points (Bond and SetCommission)
+	Nonce      uint64 // The validator's StakingNonce, so each applies once
+	Signature  Signature
+	
+	// Transaction burning Amount for the validator in the same block
+	// (Bond, see staking.go)
+	Funding Hash
+}
+
+// SigningHash is the message the validator key signs. It binds the
+// transaction to one chain and one nonce so it cannot be replayed. The
+// funding transaction is covered when set, so hashes of transactions
+// without one are unchanged.
+func (stx *StakingTx) SigningHash(chainID string) Hash {
+	h := NewHasher(TagStaking).
+		String(chainID).
+		Uint8(uint8(stx.Type)).
+		Fixed(stx.Validator[:]).
+		Uint64(stx.Amount).
+		Uint64(stx.SelfBond).
+		Uint32(stx.Commission).
+		Uint64(stx.Nonce)
+	if stx.Funding != (Hash{}) {
+		h.Fixed(stx.Funding[:])
+	}
+	return h.Sum()
 }
 
 type StakingType uint8
@@ -157,6 +346,8 @@ type StakingType uint8
 const (
 	StakingBond StakingType = iota
 	StakingUnbond
+	StakingSetCommission
+	StakingUnjail // Return to the queue after the jail period
 )
 
 // GenesisConfig defines initial chain state
@@ -165,18 +356,241 @@ type GenesisConfig struct {
 	GenesisTime       string           `json:"genesis_time"`
 	InitialSupply     uint64           `json:"initial_supply"`
 	InitialValidators []ValidatorState `json:"initial_validators"`
+	
+	// Network is mainnet or testnet, DefaultNetwork if unset (see
+	// network.go)
+	Network Network `json:"network,omitempty"`
+	
+	// Forks schedules protocol upgrades by activation height
+	Forks ForkSchedule `json:"forks,omitempty"`
+	
+	// Emission sets the block subsidy paid by coinbase transactions
+	Emission EmissionConfig `json:"emission"`
+	
+	// ValidatorSet caps the active validator set (see validators.go)
+	ValidatorSet ValidatorSetConfig `json:"validator_set,omitempty"`
+	
+	// Liveness jails validators that stop voting (see liveness.go)
+	Liveness LivenessConfig `json:"liveness,omitempty"`
+	
+	// FeeMarket charges a burned base fee (see feemarket.go)
+	FeeMarket FeeMarketConfig `json:"fee_market,omitempty"`
+	
+	// Denomination sets how amounts are written (see denomination.go)
+	Denomination Denomination `json:"denomination,omitempty"`
+	
+	// DustLimit is the smallest amount an output may carry, 0 for none
+	// (see dust.go)
+	DustLimit uint64 `json:"dust_limit,omitempty"`
+	
+	// RingSize bounds the size of every ring signature (see ring.go)
+	RingSize RingPolicy `json:"ring_size,omitempty"`
+	
+	// Maturity sets how deep outputs must be before they are spent or
+	// used as decoys (see maturity.go)
+	Maturity MaturityConfig `json:"maturity,omitempty"`
+	
+	// InitialState carries ledger state over from another chain
+	InitialState *StateSnapshot `json:"initial_state,omitempty"`
 }
 
-// Hash computes transaction hash
+// StateSnapshot is a canonical dump of ledger state at a height. Entries
+// are sorted so equal states produce identical files.
+type StateSnapshot struct {
+	ChainID     string           `json:"chain_id"`
+	Height      uint64           `json:"height"`
+	BlockHash   string           `json:"block_hash"`
+	TotalSupply uint64           `json:"total_supply"`
+	Supply      SupplyStats      `json:"supply"`
+	Treasury    Treasury         `json:"treasury"`
+	BaseFee     uint64           `json:"base_fee,omitempty"` // Of the next block
+	UTXOs       []*UTXO          `json:"utxos"`
+	KeyImages   []PublicKey      `json:"key_images"`
+	Validators  []ValidatorState `json:"validators"`
+	
+	// Global output index, in index order; only included once ring
+	// members are referenced by index (see ringindex.go)
+	RingOutputs []IndexedOutput `json:"ring_outputs,omitempty"`
+}
+
+// Hash computes the transaction ID. It covers the prefix and all
+// signatures, so transactions differing in any field have different IDs.
 func (tx *Transaction) Hash() Hash {
-	// Simplified: hash inputs + outputs
-	data := []byte{}
+	prefix := tx.PrefixHash()
+	h := NewHasher(TagTransaction).Fixed(prefix[:])
+	
+	h.Bool(tx.RingSignature != nil)
+	if sig := tx.RingSignature; sig != nil {
+		writeRingSignature(h, sig)
+	}
+	
+	for _, in := range tx.Inputs {
+		if in.Multisig == nil {
+			continue
+		}
+		h.Uint32(uint32(len(in.Multisig.Signatures)))
+		for _, sig := range in.Multisig.Signatures {
+			h.Uint8(sig.KeyIndex)
+			h.Fixed(sig.Signature[:])
+		}
+	}
+	
+	for _, in := range tx.Inputs {
+		if in.HashLock != nil {
+			h.Fixed(in.HashLock.Signature[:])
+		}
+	}
+	
+	for _, in := range tx.Inputs {
+		if in.Witness == nil {
+			continue
+		}
+		h.Uint32(uint32(len(in.Witness.Signatures)))
+		for _, sig := range in.Witness.Signatures {
+			h.Uint8(sig.KeyIndex)
+			h.Fixed(sig.Signature[:])
+		}
+	}
+	
+	if tx.Treasury != nil {
+		h.Uint32(uint32(len(tx.Treasury.Approvals)))
+		for _, a := range tx.Treasury.Approvals {
+			h.Fixed(a.Validator[:])
+			h.Fixed(a.Signature[:])
+		}
+	}
+	
+	// Only releases hash the validator's signature, so the IDs of other
+	// transactions are unchanged
+	if tx.Release != nil {
+		h.Fixed(tx.Release.Signature[:])
+	}
+	
+	// Only sponsored transactions hash the sponsor, so the IDs of
+	// transactions without one are unchanged
+	if tx.FeePayer != nil {
+		sponsor := tx.FeePayerHash()
+		h.Fixed(sponsor[:])
+		h.Bool(tx.FeePayer.RingSignature != nil)
+		if sig := tx.FeePayer.RingSignature; sig != nil {
+			writeRingSignature(h, sig)
+		}
+	}
+	
+	return h.Sum()
+}
+
+// writeRingSignature hashes every field of a ring signature
+func writeRingSignature(h *Hasher, sig *RingSignature) {
+	h.Uint32(uint32(len(sig.Ring)))
+	for _, pk := range sig.Ring {
+		h.Fixed(pk[:])
+	}
+	h.Fixed(sig.C[:])
+	h.Uint32(uint32(len(sig.Responses)))
+	for _, r := range sig.Responses {
+		h.Fixed(r[:])
+	}
+	h.Fixed(sig.KeyImage[:])
+}
+
+// RingSigHash hashes a ring signature together with the payload it
+// signs, identifying one verification of it
+func RingSigHash(payload Hash, sig *RingSignature) Hash {
+	h := NewHasher(TagRingSig)
+	h.Fixed(payload[:])
+	writeRingSignature(h, sig)
+	return h.Sum()
+}
+
+// PrefixHash hashes every transaction field except signatures. It is
+// what signatures commit to (see TxSigningHash).
+func (tx *Transaction) PrefixHash() Hash {
+	h := NewHasher(TagTxPrefix)
+	h.Uint8(tx.Version)
+	
+	h.Uint32(uint32(len(tx.Inputs)))
 	for _, in := range tx.Inputs {
-		data = append(data, in.KeyImage[:]...)
+		h.Fixed(in.KeyImage[:])
+		h.Uint64(in.Amount)
+		h.Bool(in.Multisig != nil)
+		if in.Multisig != nil {
+			h.Fixed(in.Multisig.TxHash[:])
+			h.Uint32(in.Multisig.OutputIndex)
+		}
 	}
+	
+	h.Uint32(uint32(len(tx.Outputs)))
 	for _, out := range tx.Outputs {
-		data = append(data, out.StealthAddr.ViewKey[:]...)
-		data = append(data, out.StealthAddr.SpendKey[:]...)
+		writeOutput(h, out)
+	}
+	
+	h.Uint64(tx.Fee)
+	
+	h.Uint32(uint32(len(tx.RangeProofs)))
+	for _, proof := range tx.RangeProofs {
+		h.Bytes(proof)
+	}
+	
+	if tx.Version >= TxVersionHashLock {
+		writeHashLocks(h, tx)
+	}
+	if tx.Version >= TxVersionLock {
+		writeLocks(h, tx)
+	}
+	if tx.Version >= TxVersionTreasury {
+		writeTreasury(h, tx)
+	}
+	if tx.Version >= TxVersionBurn {
+		writeBurns(h, tx)
+	}
+	if tx.Version >= TxVersionRingIndex {
+		writeRingOffsets(h, tx)
+	}
+	if tx.Version >= TxVersionViewTag {
+		writeViewTags(h, tx)
+	}
+	if tx.Version >= TxVersionBond {
+		writeBonds(h, tx)
+		writeRelease(h, tx)
+	}
+	
+	return h.Sum()
+}
+
+// writeOutput hashes every field of an output
+func writeOutput(h *Hasher, out *TxOutput) {
+	h.Uint64(out.Amount)
+	h.Fixed(out.StealthAddr.ViewKey[:])
+	h.Fixed(out.StealthAddr.SpendKey[:])
+	h.Fixed(out.TxPublicKey[:])
+	h.Fixed(out.PaymentID[:])
+	h.Bytes(out.Memo)
+	h.Bool(out.Multisig != nil)
+	if out.Multisig != nil {
+		h.Uint8(out.Multisig.Threshold)
+		h.Uint32(uint32(len(out.Multisig.Keys)))
+		for _, k := range out.Multisig.Keys {
+			h.Fixed(k[:])
+		}
+	}
+}
+
+// TxSigningHash is the message signed to authorize a transaction. It
+// binds the transaction prefix to one chain so its signatures cannot be
+// replayed on another.
+func TxSigningHash(chainID string, prefixHash Hash) Hash {
+	return NewHasher(TagTxSig).
+		String(chainID).
+		Fixed(prefixHash[:]).
+		Sum()
+}
+
+// MemoSize returns the total memo bytes of all outputs
+func (tx *Transaction) MemoSize() int {
+	size := 0
+	for _, out := range tx.AllOutputs() {
+		size += len(out.Memo)
 	}
-	return sha256.Sum256(data)
+	return size
 }
\ No newline at end of file
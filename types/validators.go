@@ -0,0 +1,185 @@
+package types
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+const (
+	// DefaultEpochLength is the active set rotation interval used when
+	// the genesis does not set one
+	DefaultEpochLength = 100
+
+	// CommissionDenominator is 100% in commission basis points
+	CommissionDenominator = 10000
+)
+
+// ValidatorSetConfig bounds the active validator set. At the end of every
+// epoch the MaxValidators eligible validators with the most stake become
+// active and the rest are queued.
+type ValidatorSetConfig struct {
+	MaxValidators int    `json:"max_validators,omitempty"` // 0 for no limit
+	EpochLength   uint64 `json:"epoch_length,omitempty"`   // 0 means DefaultEpochLength
+
+	// Bonding requirements for new validators
+	MinValidatorStake uint64 `json:"min_validator_stake,omitempty"`
+	MinSelfBond       uint64 `json:"min_self_bond,omitempty"`
+
+	// Commission limits in basis points. A validator may change its rate
+	// once per epoch, by at most MaxCommissionChange.
+	MaxCommission       uint32 `json:"max_commission,omitempty"`        // 0 means CommissionDenominator
+	MaxCommissionChange uint32 `json:"max_commission_change,omitempty"` // 0 for no limit
+}
+
+// Validate checks the validator set parameters
+func (c ValidatorSetConfig) Validate() error {
+	if c.MaxValidators < 0 {
+		return errors.New("max_validators must not be negative")
+	}
+	if c.MinSelfBond > c.MinValidatorStake && c.MinValidatorStake > 0 {
+		return errors.New("min_self_bond exceeds min_validator_stake")
+	}
+	if c.MaxCommission > CommissionDenominator {
+		return fmt.Errorf("max_commission exceeds %d basis points", CommissionDenominator)
+	}
+	return nil
+}
+
+// CommissionCap returns the highest commission rate allowed
+func (c ValidatorSetConfig) CommissionCap() uint32 {
+	if c.MaxCommission == 0 {
+		return CommissionDenominator
+	}
+	return c.MaxCommission
+}
+
+// CheckBond checks a new validator against the bonding requirements
+func (c ValidatorSetConfig) CheckBond(stake, selfBond uint64, commission uint32) error {
+	if stake < c.MinValidatorStake {
+		return fmt.Errorf("stake %d below minimum %d", stake, c.MinValidatorStake)
+	}
+	if selfBond > stake {
+		return fmt.Errorf("self-bond %d exceeds stake %d", selfBond, stake)
+	}
+	if selfBond < c.MinSelfBond {
+		return fmt.Errorf("self-bond %d below minimum %d", selfBond, c.MinSelfBond)
+	}
+	if commission > c.CommissionCap() {
+		return fmt.Errorf("commission %d above maximum %d basis points", commission, c.CommissionCap())
+	}
+	return nil
+}
+
+// CheckCommissionChange checks a validator's new commission rate at
+// height
+func (c ValidatorSetConfig) CheckCommissionChange(val *ValidatorState, commission uint32, height uint64) error {
+	if commission > c.CommissionCap() {
+		return fmt.Errorf("commission %d above maximum %d basis points", commission, c.CommissionCap())
+	}
+	if epoch := height / c.Epoch(); epoch <= val.CommissionEpoch {
+		return fmt.Errorf("commission already changed in epoch %d", val.CommissionEpoch)
+	}
+
+	change := commission - val.Commission
+	if commission < val.Commission {
+		change = val.Commission - commission
+	}
+	if c.MaxCommissionChange > 0 && change > c.MaxCommissionChange {
+		return fmt.Errorf("commission change %d above maximum %d basis points per epoch", change, c.MaxCommissionChange)
+	}
+	return nil
+}
+
+// Epoch returns the number of blocks between rotations
+func (c ValidatorSetConfig) Epoch() uint64 {
+	if c.EpochLength == 0 {
+		return DefaultEpochLength
+	}
+	return c.EpochLength
+}
+
+// IsEpochEnd reports whether the active set rotates after the block at
+// height
+func (c ValidatorSetConfig) IsEpochEnd(height uint64) bool {
+	return height%c.Epoch() == 0
+}
+
+// NextRotation returns the first height after height that ends an epoch
+func (c ValidatorSetConfig) NextRotation(height uint64) uint64 {
+	return (height/c.Epoch() + 1) * c.Epoch()
+}
+
+// Eligible reports whether a validator competes for the active set.
+// Unbonding and jailed validators are neither active nor queued.
+func (v *ValidatorState) Eligible() bool {
+	return v.Active || v.Queued
+}
+
+// Jail removes a validator from the set until at least height until. It
+// keeps its stake and returns with an unjail transaction.
+func (v *ValidatorState) Jail(until uint64) {
+	v.Active = false
+	v.Queued = false
+	v.Jailed = true
+	if until > v.JailedUntil {
+		v.JailedUntil = until
+	}
+	v.ResetSigning()
+}
+
+// SplitReward divides a reward between the validator's commission and
+// its delegators
+func (v *ValidatorState) SplitReward(reward uint64) (commission, delegators uint64) {
+	// Split the product so large rewards cannot overflow
+	commission = reward/CommissionDenominator*uint64(v.Commission) +
+		reward%CommissionDenominator*uint64(v.Commission)/CommissionDenominator
+	return commission, reward - commission
+}
+
+// RankValidators sorts validators by stake, highest first. Equal stakes
+// are ordered by public key so every node ranks the same way.
+func RankValidators(vals []*ValidatorState) {
+	sort.Slice(vals, func(i, j int) bool {
+		if vals[i].StakedAmount != vals[j].StakedAmount {
+			return vals[i].StakedAmount > vals[j].StakedAmount
+		}
+		return bytes.Compare(vals[i].PublicKey[:], vals[j].PublicKey[:]) < 0
+	})
+}
+
+// ValidatorSetSnapshot is the active validator set voting from Height
+// on, stored so the certificates of old blocks can be checked against
+// the set that signed them. A new snapshot is kept whenever the set or
+// its stakes change, normally once per epoch at rotation.
+type ValidatorSetSnapshot struct {
+	Height     uint64           `json:"height"` // First height the set votes on
+	Epoch      uint64           `json:"epoch"`
+	TotalStake uint64           `json:"total_stake"`
+	Validators []ValidatorState `json:"validators"` // Ranked by stake
+}
+
+// Stakes returns the stake of every validator in the set
+func (s *ValidatorSetSnapshot) Stakes() map[PublicKey]uint64 {
+	stakes := make(map[PublicKey]uint64, len(s.Validators))
+	for _, val := range s.Validators {
+		stakes[val.PublicKey] = val.StakedAmount
+	}
+	return stakes
+}
+
+// SameVoters reports whether two sets have the same validators with
+// the same stakes, so certificates verify alike under both
+func (s *ValidatorSetSnapshot) SameVoters(other *ValidatorSetSnapshot) bool {
+	if other == nil || len(s.Validators) != len(other.Validators) {
+		return false
+	}
+	for i := range s.Validators {
+		if s.Validators[i].PublicKey != other.Validators[i].PublicKey ||
+			s.Validators[i].StakedAmount != other.Validators[i].StakedAmount {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,27 @@
+package types
+
+// TxVersionViewTag is the first transaction version whose outputs may
+// carry a view tag. It needs protocol version 12.
+const TxVersionViewTag = 12
+
+// HasViewTags reports whether any output of a transaction carries a
+// view tag
+func (tx *Transaction) HasViewTags() bool {
+	for _, out := range tx.Outputs {
+		if out.ViewTag != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// writeViewTags hashes the view tags of the outputs. Transactions from
+// TxVersionViewTag include them, so older transaction IDs are unchanged.
+func writeViewTags(h *Hasher, tx *Transaction) {
+	for _, out := range tx.Outputs {
+		h.Bool(out.ViewTag != nil)
+		if out.ViewTag != nil {
+			h.Uint8(*out.ViewTag)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package types
+
+// VoteType distinguishes kinds of validator votes. The type is signed
+// so that a prevote cannot be replayed as a commit.
+type VoteType uint8
+
+const (
+	VoteCommit  VoteType = 1 // Vote to finalize a block
+	VotePrevote VoteType = 2 // Vote that a proposal is valid, before committing to it
+)
+
+// CanonicalVote is exactly what a validator signs when voting. It is
+// encoded field by field with the Hasher rather than through JSON, so
+// the signed bytes are the same on every node.
+type CanonicalVote struct {
+	Type      VoteType
+	ChainID   string
+	Height    uint64
+	Round     uint32
+	BlockHash Hash
+}
+
+// NewCommitVote returns the canonical commit vote for a block at a
+// height and round on one chain
+func NewCommitVote(chainID string, height uint64, round uint32, blockHash Hash) *CanonicalVote {
+	return &CanonicalVote{
+		Type:      VoteCommit,
+		ChainID:   chainID,
+		Height:    height,
+		Round:     round,
+		BlockHash: blockHash,
+	}
+}
+
+// NewPrevote returns the canonical prevote for a block at a height and
+// round on one chain
+func NewPrevote(chainID string, height uint64, round uint32, blockHash Hash) *CanonicalVote {
+	return &CanonicalVote{
+		Type:      VotePrevote,
+		ChainID:   chainID,
+		Height:    height,
+		Round:     round,
+		BlockHash: blockHash,
+	}
+}
+
+// SigningHash returns the digest of the vote's fields
+func (v *CanonicalVote) SigningHash() Hash {
+	return NewHasher(TagVote).
+		Uint8(uint8(v.Type)).
+		String(v.ChainID).
+		Uint64(v.Height).
+		Uint32(v.Round).
+		Fixed(v.BlockHash[:]).
+		Sum()
+}
+
+// SignBytes returns the message passed to ed25519
+func (v *CanonicalVote) SignBytes() []byte {
+	hash := v.SigningHash()
+	return hash[:]
+}
+
+// Vote is a vote as validators gossip it: the signature with the
+// height, round and block hash it covers, so it can be checked without
+// the block, and a commit vote for a conflicting block kept as evidence
+type Vote struct {
+	Height    uint64    `json:"height"`
+	Round     uint32    `json:"round"`
+	BlockHash Hash      `json:"block_hash"`
+	Validator PublicKey `json:"validator"`
+	Signature Signature `json:"signature"`
+	Prevote   bool      `json:"prevote,omitempty"` // A prevote rather than a commit vote
+}
+
+// Canonical returns the canonical vote the signature covers
+func (v *Vote) Canonical(chainID string) *CanonicalVote {
+	if v.Prevote {
+		return NewPrevote(chainID, v.Height, v.Round, v.BlockHash)
+	}
+	return NewCommitVote(chainID, v.Height, v.Round, v.BlockHash)
+}
+
+// Commit returns the vote as a block certificate carries it
+func (v *Vote) Commit() ValidatorSignature {
+	return ValidatorSignature{Validator: v.Validator, Signature: v.Signature, Round: v.Round}
+}
+
+// Proposal is a candidate block offered for a round of its height. A
+// block that gathered prevotes from 2/3 of the stake in an earlier round
+// is proposed again unchanged, so its header keeps the round it was
+// first proposed in; POLRound is then the round of those prevotes.
+type Proposal struct {
+	Round    uint32 `json:"round"`
+	POLRound uint32 `json:"pol_round,omitempty"`
+	Block    *Block `json:"block"`
+}
+
+// IsRepeat reports whether the proposal offers a block from an earlier
+// round again
+func (p *Proposal) IsRepeat() bool {
+	return p.Block.Header.Round < p.Round
+}
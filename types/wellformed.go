@@ -0,0 +1,60 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// CheckWellFormed rejects transactions with null entries where every
+// transaction has a value. Validation and hashing assume none, so
+// decoding runs it before a transaction from a peer, an RPC client or
+// disk reaches them.
+func (tx *Transaction) CheckWellFormed() error {
+	for i, in := range tx.Inputs {
+		if in == nil {
+			return fmt.Errorf("input %d is null", i)
+		}
+	}
+	for i, out := range tx.Outputs {
+		if out == nil {
+			return fmt.Errorf("output %d is null", i)
+		}
+	}
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler, rejecting transactions
+// that are not well formed
+func (tx *Transaction) UnmarshalJSON(data []byte) error {
+	type plain Transaction
+	if err := json.Unmarshal(data, (*plain)(tx)); err != nil {
+		return err
+	}
+	return tx.CheckWellFormed()
+}
+
+// UnmarshalJSON implements json.Unmarshaler, rejecting blocks with null
+// transactions, evidence or staking transactions
+func (b *Block) UnmarshalJSON(data []byte) error {
+	type plain Block
+	if err := json.Unmarshal(data, (*plain)(b)); err != nil {
+		return err
+	}
+	for _, tx := range b.Transactions {
+		if tx == nil {
+			return errors.New("block has a null transaction")
+		}
+	}
+	for _, ev := range b.Evidence {
+		if ev == nil {
+			return errors.New("block has null evidence")
+		}
+	}
+	for _, stx := range b.Staking {
+		if stx == nil {
+			return errors.New("block has a null staking transaction")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"blockchain/crypto"
+	"blockchain/types"
+)
+
+// PrimaryAccount is the account of the wallet's main address. It exists
+// in every wallet, with or without account metadata.
+const PrimaryAccount = 0
+
+// Account is a labeled group of subaddresses with its own balance and
+// history. Subaddress 0 of an account is its main address and receives
+// the change of its transactions.
+type Account struct {
+	Index        uint32 `json:"index"`
+	Label        string `json:"label"`
+	Subaddresses uint32 `json:"subaddresses"` // Subaddresses created, at least 1
+}
+
+// SubaddressIndex identifies a subaddress of the wallet
+type SubaddressIndex struct {
+	Account uint32 `json:"account"`
+	Index   uint32 `json:"index"`
+}
+
+// Accounts returns the wallet's accounts in index order, starting with
+// the primary account
+func (m *Metadata) Accounts() []*Account {
+	if len(m.AccountList) == 0 {
+		return []*Account{{Index: PrimaryAccount, Label: "primary", Subaddresses: 1}}
+	}
+	return m.AccountList
+}
+
+// CreateAccount adds an account with the next free index
+func (m *Metadata) CreateAccount(label string) (*Account, error) {
+	if err := m.checkAccountLabel(label); err != nil {
+		return nil, err
+	}
+
+	// Materialize the primary account so indexes stay stable
+	m.AccountList = m.Accounts()
+
+	account := &Account{
+		Index:        uint32(len(m.AccountList)),
+		Label:        label,
+		Subaddresses: 1,
+	}
+	m.AccountList = append(m.AccountList, account)
+	return account, nil
+}
+
+// RenameAccount changes the label of an account
+func (m *Metadata) RenameAccount(account *Account, label string) error {
+	if err := m.checkAccountLabel(label); err != nil {
+		return err
+	}
+
+	m.AccountList = m.Accounts()
+	m.AccountList[account.Index].Label = label
+	return nil
+}
+
+// checkAccountLabel rejects labels that are empty, taken, or could be
+// mistaken for an account index
+func (m *Metadata) checkAccountLabel(label string) error {
+	if label == "" {
+		return errors.New("account label cannot be empty")
+	}
+	if _, err := strconv.ParseUint(label, 10, 32); err == nil {
+		return errors.New("account label cannot be a number")
+	}
+	for _, a := range m.Accounts() {
+		if a.Label == label {
+			return fmt.Errorf("account %q already exists", label)
+		}
+	}
+	return nil
+}
+
+// FindAccount looks up an account by label or index
+func (m *Metadata) FindAccount(s string) (*Account, error) {
+	accounts := m.Accounts()
+
+	if index, err := strconv.ParseUint(s, 10, 32); err == nil {
+		if index >= uint64(len(accounts)) {
+			return nil, fmt.Errorf("account %d does not exist", index)
+		}
+		return accounts[index], nil
+	}
+
+	for _, a := range accounts {
+		if a.Label == s {
+			return a, nil
+		}
+	}
+	return nil, fmt.Errorf("account %q does not exist", s)
+}
+
+// NewSubaddress creates the next subaddress of an account
+func (m *Metadata) NewSubaddress(account *Account) SubaddressIndex {
+	m.AccountList = m.Accounts()
+
+	a := m.AccountList[account.Index]
+	index := SubaddressIndex{Account: a.Index, Index: a.Subaddresses}
+	a.Subaddresses++
+	return index
+}
+
+// Subaddresses lists every subaddress created in the wallet, for
+// scanning
+func (m *Metadata) Subaddresses() []SubaddressIndex {
+	subs := make([]SubaddressIndex, 0)
+	for _, a := range m.Accounts() {
+		for i := uint32(0); i < a.Subaddresses; i++ {
+			subs = append(subs, SubaddressIndex{Account: a.Index, Index: i})
+		}
+	}
+	return subs
+}
+
+// SubaddressAddress returns the public address of a subaddress
+func SubaddressAddress(keys *crypto.WalletKeys, sub SubaddressIndex) types.Address {
+	return keys.Subaddress(sub.Account, sub.Index).GetAddress()
+}
+
+// Account returns the part of a scan belonging to one account. Outputs
+// are shared with the full result, not copied.
+func (r *ScanResult) Account(account uint32) *ScanResult {
+	result := &ScanResult{
+		Outputs:       make([]*OwnedOutput, 0),
+		ScannedHeight: r.ScannedHeight,
+		ViewOnly:      r.ViewOnly,
+	}
+	for _, out := range r.Outputs {
+		if out.Account == account {
+			result.Outputs = append(result.Outputs, out)
+		}
+	}
+	return result
+}
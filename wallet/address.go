@@ -0,0 +1,211 @@
+package wallet
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"blockchain/types"
+)
+
+// Address strings are hex keys joined by colons (Phase 1 encoding),
+// after the prefix of the network they belong to:
+//
+//	standard:   <prefix>:<view_key>:<spend_key>
+//	integrated: <prefix>:<view_key>:<spend_key>:<payment_id>
+//	multisig:   <prefix>:multisig:<m>:<view_key>:<spend_key_1>,...,<spend_key_n>
+//
+// Addresses from before networks were named have no prefix. They are
+// only accepted on testnet, the only kind of network there was.
+
+// addressPrefixes start the addresses of each network
+var addressPrefixes = map[types.Network]string{
+	types.Mainnet: "apex",
+	types.Testnet: "tapex",
+}
+
+// multisigPrefix starts every multisig address after the network prefix
+const multisigPrefix = "multisig:"
+
+// AddressPrefix returns the prefix of a network's addresses
+func AddressPrefix(network types.Network) string {
+	return addressPrefixes[network.OrDefault()]
+}
+
+// FormatAddress encodes a standard address of network
+func FormatAddress(network types.Network, addr types.Address) string {
+	return AddressPrefix(network) + ":" + addr.ViewKey.String() + ":" + addr.SpendKey.String()
+}
+
+// FormatIntegratedAddress encodes an address bundled with a payment ID
+func FormatIntegratedAddress(network types.Network, addr types.Address, pid types.PaymentID) string {
+	return FormatAddress(network, addr) + ":" + pid.String()
+}
+
+// trimNetwork strips the network prefix of an address, refusing an
+// address of another network
+func trimNetwork(network types.Network, s string) (string, error) {
+	network = network.OrDefault()
+	if prefix, rest, ok := strings.Cut(s, ":"); ok {
+		for n, p := range addressPrefixes {
+			if prefix != p {
+				continue
+			}
+			if n != network {
+				return "", fmt.Errorf("address is for %s, not %s", n, network)
+			}
+			return rest, nil
+		}
+	}
+
+	if network != types.Testnet {
+		return "", fmt.Errorf("address has no network prefix; %s addresses start with %q", network, AddressPrefix(network)+":")
+	}
+	return s, nil
+}
+
+// anyNetwork strips the network prefix of an address of any network
+func anyNetwork(s string) string {
+	if prefix, rest, ok := strings.Cut(s, ":"); ok {
+		for _, p := range addressPrefixes {
+			if prefix == p {
+				return rest
+			}
+		}
+	}
+	return s
+}
+
+// ParseAddress decodes a standard or integrated address of network. The
+// returned payment ID is nil for standard addresses.
+func ParseAddress(network types.Network, s string) (types.Address, *types.PaymentID, error) {
+	rest, err := trimNetwork(network, s)
+	if err != nil {
+		return types.Address{}, nil, err
+	}
+	return parseAddress(rest)
+}
+
+// parseAddress decodes an address without its network prefix
+func parseAddress(s string) (types.Address, *types.PaymentID, error) {
+	var addr types.Address
+
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 && len(parts) != 3 {
+		return addr, nil, errors.New("address must be <prefix>:<view_key>:<spend_key>[:<payment_id>]")
+	}
+
+	if err := decodeHex(parts[0], addr.ViewKey[:]); err != nil {
+		return addr, nil, fmt.Errorf("invalid view key: %w", err)
+	}
+	if err := decodeHex(parts[1], addr.SpendKey[:]); err != nil {
+		return addr, nil, fmt.Errorf("invalid spend key: %w", err)
+	}
+
+	if len(parts) == 2 {
+		return addr, nil, nil
+	}
+
+	pid, err := ParsePaymentID(parts[2])
+	if err != nil {
+		return addr, nil, err
+	}
+
+	return addr, &pid, nil
+}
+
+// IsMultisigAddress reports whether s is a multisig address of any
+// network
+func IsMultisigAddress(s string) bool {
+	return strings.HasPrefix(anyNetwork(s), multisigPrefix)
+}
+
+// FormatMultisigAddress encodes the address of an M-of-N wallet of
+// network
+func FormatMultisigAddress(network types.Network, addr types.MultisigAddress) string {
+	keys := make([]string, len(addr.SpendKeys))
+	for i, k := range addr.SpendKeys {
+		keys[i] = k.String()
+	}
+	return fmt.Sprintf("%s:%s%d:%s:%s", AddressPrefix(network), multisigPrefix, addr.Threshold, addr.ViewKey, strings.Join(keys, ","))
+}
+
+// ParseMultisigAddress decodes a multisig address of network
+func ParseMultisigAddress(network types.Network, s string) (types.MultisigAddress, error) {
+	rest, err := trimNetwork(network, s)
+	if err != nil {
+		return types.MultisigAddress{}, err
+	}
+	return parseMultisigAddress(rest)
+}
+
+// parseMultisigAddress decodes a multisig address without its network
+// prefix
+func parseMultisigAddress(s string) (types.MultisigAddress, error) {
+	var addr types.MultisigAddress
+
+	if !strings.HasPrefix(s, multisigPrefix) {
+		return addr, errors.New("not a multisig address")
+	}
+
+	parts := strings.Split(strings.TrimPrefix(s, multisigPrefix), ":")
+	if len(parts) != 3 {
+		return addr, errors.New("multisig address must be <prefix>:multisig:<m>:<view_key>:<spend_keys>")
+	}
+
+	var threshold int
+	if _, err := fmt.Sscanf(parts[0], "%d", &threshold); err != nil || threshold < 1 || threshold > 255 {
+		return addr, errors.New("invalid multisig threshold")
+	}
+	addr.Threshold = uint8(threshold)
+
+	if err := decodeHex(parts[1], addr.ViewKey[:]); err != nil {
+		return addr, fmt.Errorf("invalid view key: %w", err)
+	}
+
+	for _, keyHex := range strings.Split(parts[2], ",") {
+		var key types.PublicKey
+		if err := decodeHex(keyHex, key[:]); err != nil {
+			return addr, fmt.Errorf("invalid spend key: %w", err)
+		}
+		addr.SpendKeys = append(addr.SpendKeys, key)
+	}
+
+	return addr, nil
+}
+
+// ParsePaymentID decodes a hex payment ID
+func ParsePaymentID(s string) (types.PaymentID, error) {
+	var pid types.PaymentID
+	if err := decodeHex(s, pid[:]); err != nil {
+		return pid, fmt.Errorf("invalid payment ID: %w", err)
+	}
+	if pid.IsZero() {
+		return pid, errors.New("invalid payment ID: must not be zero")
+	}
+	return pid, nil
+}
+
+// NewPaymentID generates a random payment ID
+func NewPaymentID() (types.PaymentID, error) {
+	var pid types.PaymentID
+	if _, err := rand.Read(pid[:]); err != nil {
+		return pid, err
+	}
+	return pid, nil
+}
+
+// decodeHex decodes s into dst, requiring an exact length match
+func decodeHex(s string, dst []byte) error {
+	decoded, err := hex.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	if len(decoded) != len(dst) {
+		return fmt.Errorf("expected %d bytes, got %d", len(dst), len(decoded))
+	}
+	copy(dst, decoded)
+	return nil
+}
@@ -0,0 +1,71 @@
+package wallet
+
+import (
+	"slices"
+	"testing"
+
+	"blockchain/types"
+)
+
+const (
+	testViewKey  = "0101010101010101010101010101010101010101010101010101010101010101"
+	testSpendKey = "0202020202020202020202020202020202020202020202020202020202020202"
+	testPayment  = "0303030303030303"
+)
+
+// FuzzParseAddress checks that addresses parse without panicking, and
+// that a parsed address formats to one that parses the same
+func FuzzParseAddress(f *testing.F) {
+	f.Add("tapex:" + testViewKey + ":" + testSpendKey)
+	f.Add("apex:" + testViewKey + ":" + testSpendKey + ":" + testPayment)
+	f.Add(testViewKey + ":" + testSpendKey)
+	f.Add("tapex:" + testViewKey + ":" + testSpendKey + ":0000000000000000")
+	f.Add("tapex::")
+
+	f.Fuzz(func(t *testing.T, s string) {
+		for _, network := range []types.Network{types.Mainnet, types.Testnet} {
+			addr, pid, err := ParseAddress(network, s)
+			if err != nil {
+				continue
+			}
+
+			formatted := FormatAddress(network, addr)
+			if pid != nil {
+				formatted = FormatIntegratedAddress(network, addr, *pid)
+			}
+			again, againPID, err := ParseAddress(network, formatted)
+			if err != nil {
+				t.Fatalf("%q formatted as %q, which does not parse: %v", s, formatted, err)
+			}
+			if again != addr || (againPID == nil) != (pid == nil) || (pid != nil && *againPID != *pid) {
+				t.Fatalf("%q changed in a round trip through %q", s, formatted)
+			}
+		}
+	})
+}
+
+// FuzzParseMultisigAddress is FuzzParseAddress for multisig addresses
+func FuzzParseMultisigAddress(f *testing.F) {
+	f.Add("tapex:multisig:2:" + testViewKey + ":" + testSpendKey + "," + testViewKey)
+	f.Add("apex:multisig:1:" + testViewKey + ":" + testSpendKey)
+	f.Add("tapex:multisig:0:" + testViewKey + ":")
+	f.Add("tapex:multisig:999::")
+
+	f.Fuzz(func(t *testing.T, s string) {
+		for _, network := range []types.Network{types.Mainnet, types.Testnet} {
+			addr, err := ParseMultisigAddress(network, s)
+			if err != nil {
+				continue
+			}
+
+			formatted := FormatMultisigAddress(network, addr)
+			again, err := ParseMultisigAddress(network, formatted)
+			if err != nil {
+				t.Fatalf("%q formatted as %q, which does not parse: %v", s, formatted, err)
+			}
+			if again.Threshold != addr.Threshold || again.ViewKey != addr.ViewKey || !slices.Equal(again.SpendKeys, addr.SpendKeys) {
+				t.Fatalf("%q changed in a round trip through %q", s, formatted)
+			}
+		}
+	})
+}
@@ -0,0 +1,687 @@
+package wallet
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"blockchain/crypto"
+	"blockchain/types"
+)
+
+const (
+	// DefaultFee is the fixed Phase 1 transaction fee
+	DefaultFee = 1000
+
+	// DefaultDecoyCount is the number of decoys mixed into each ring,
+	// unless the chain's ring policy asks otherwise (see ring.go)
+	DefaultDecoyCount = 2
+
+	// FormatUnsignedTx marks an unsigned transaction file
+	FormatUnsignedTx = "unsigned-tx"
+)
+
+// Payment is a single destination of a transaction
+type Payment struct {
+	Recipient types.Address
+	Amount    uint64
+	PaymentID *types.PaymentID
+	Memo      []byte // Plaintext, encrypted to the recipient
+
+	// Multisig is set when paying an M-of-N wallet instead of Recipient
+	Multisig *types.MultisigAddress
+
+	// HashLock is set when locking the amount in a swap contract instead
+	// of paying Recipient (see swap.go)
+	HashLock *types.HashLock
+
+	// Burn is set when destroying the amount instead of paying anyone
+	Burn bool
+
+	// Bond is set on a burn that pays for the stake of a validator
+	Bond *types.PublicKey
+}
+
+// ParsePayment creates a payment to a standard, integrated or multisig
+// address of network. paymentID may be empty; it cannot be combined with an
+// integrated address.
+func ParsePayment(network types.Network, recipient string, amount uint64, paymentID string) (Payment, error) {
+	payment := Payment{Amount: amount}
+
+	if paymentID != "" {
+		pid, err := ParsePaymentID(paymentID)
+		if err != nil {
+			return payment, err
+		}
+		payment.PaymentID = &pid
+	}
+
+	if IsMultisigAddress(recipient) {
+		addr, err := ParseMultisigAddress(network, recipient)
+		if err != nil {
+			return payment, err
+		}
+		payment.Multisig = &addr
+		return payment, nil
+	}
+
+	addr, integratedID, err := ParseAddress(network, recipient)
+	if err != nil {
+		return payment, err
+	}
+
+	if integratedID != nil {
+		if payment.PaymentID != nil {
+			return payment, errors.New("integrated address already contains a payment ID")
+		}
+		payment.PaymentID = integratedID
+	}
+
+	payment.Recipient = addr
+	return payment, nil
+}
+
+// UnsignedInput is an owned output selected for spending, together with
+// the decoys that will form its ring
+type UnsignedInput struct {
+	TxHash      types.Hash        `json:"tx_hash"`
+	OutputIndex uint32            `json:"output_index"`
+	Output      *types.TxOutput   `json:"output"`
+	Decoys      []types.PublicKey `json:"decoys"`
+
+	// Subaddress the output was paid to, whose keys sign it
+	Subaddress SubaddressIndex `json:"subaddress"`
+
+	// The whole ring in global output index order and its offsets, set
+	// when the chain references ring members by index (see ringindex.go)
+	Ring        []types.PublicKey `json:"ring,omitempty"`
+	RingOffsets []uint64          `json:"ring_offsets,omitempty"`
+}
+
+// UnsignedTx is the portable file format passed from an online wallet,
+// which selects inputs and decoys, to an offline wallet holding the
+// spend key. It contains no secret key material.
+type UnsignedTx struct {
+	Format  string            `json:"format"`
+	ChainID string            `json:"chain_id"` // Chain the signatures are bound to
+	Inputs  []*UnsignedInput  `json:"inputs"`
+	Outputs []*types.TxOutput `json:"outputs"`
+	Fee     uint64            `json:"fee"`
+
+	// Sponsored transactions leave the fee to a sponsor (see sponsor.go)
+	Sponsored bool `json:"sponsored,omitempty"`
+}
+
+// ID identifies the transaction before its key images and hash are known
+func (u *UnsignedTx) ID() string {
+	return OutputsID(u.Outputs)
+}
+
+// OutputsID hashes the one-time keys of a set of outputs. It links an
+// unsigned transaction to the signed transaction built from it.
+func OutputsID(outputs []*types.TxOutput) string {
+	h := sha256.New()
+	for _, out := range outputs {
+		h.Write(out.StealthAddr.SpendKey[:])
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// BuildUnsigned selects an input covering the payments plus fee, picks
+// decoys from the chain, and creates stealth outputs including change,
+// laid out as the policy asks. It only needs the view key, so it works
+// with view-only wallets.
+func BuildUnsigned(keys *crypto.WalletKeys, chain ChainReader, scan *ScanResult, payments []Payment, fee uint64, policy OutputPolicy) (*UnsignedTx, []*SentOutput, error) {
+	return buildUnsigned(keys, chain, scan, payments, fee, policy, false)
+}
+
+// BuildUnsignedFrom builds an unsigned transaction spending a specific
+// output chosen by the user (coin control). Frozen outputs are refused.
+func BuildUnsignedFrom(keys *crypto.WalletKeys, chain ChainReader, input *OwnedOutput, payments []Payment, fee uint64, policy OutputPolicy) (*UnsignedTx, []*SentOutput, error) {
+	return buildUnsignedFrom(keys, chain, input, payments, fee, policy, false)
+}
+
+// BuildSponsored is BuildUnsigned for a transaction whose fee is paid
+// by a sponsor: the input only covers the payments. Once signed, the
+// transaction is valid only after Sponsor adds the sponsor's input.
+func BuildSponsored(keys *crypto.WalletKeys, chain ChainReader, scan *ScanResult, payments []Payment, fee uint64, policy OutputPolicy) (*UnsignedTx, []*SentOutput, error) {
+	return buildUnsigned(keys, chain, scan, payments, fee, policy, true)
+}
+
+// BuildSponsoredFrom is BuildUnsignedFrom for a sponsored transaction
+func BuildSponsoredFrom(keys *crypto.WalletKeys, chain ChainReader, input *OwnedOutput, payments []Payment, fee uint64, policy OutputPolicy) (*UnsignedTx, []*SentOutput, error) {
+	return buildUnsignedFrom(keys, chain, input, payments, fee, policy, true)
+}
+
+func buildUnsigned(keys *crypto.WalletKeys, chain ChainReader, scan *ScanResult, payments []Payment, fee uint64, policy OutputPolicy, sponsored bool) (*UnsignedTx, []*SentOutput, error) {
+	total, err := inputTotal(payments, fee, sponsored)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Phase 1 transactions carry a single ring signature, so one input
+	// must cover the whole amount
+	scan, err = matureOutputs(chain, scan)
+	if err != nil {
+		return nil, nil, err
+	}
+	input, err := selectInput(scan, total)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return buildUnsignedFrom(keys, chain, input, payments, fee, policy, sponsored)
+}
+
+func buildUnsignedFrom(keys *crypto.WalletKeys, chain ChainReader, input *OwnedOutput, payments []Payment, fee uint64, policy OutputPolicy, sponsored bool) (*UnsignedTx, []*SentOutput, error) {
+	total, err := inputTotal(payments, fee, sponsored)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkInput(input, total, policy); err != nil {
+		return nil, nil, err
+	}
+
+	block, err := chain.GetBlock(input.BlockHeight)
+	if err != nil {
+		return nil, nil, err
+	}
+	realOutput, err := findOutput(block, input.TxHash, input.OutputIndex)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	decoyCount, err := DecoyCount(chain)
+	if err != nil {
+		return nil, nil, err
+	}
+	decoys, err := SelectDecoys(chain, realOutput.StealthAddr.SpendKey, decoyCount)
+	if err != nil {
+		return nil, nil, err
+	}
+	ring, offsets, err := orderRing(chain, realOutput.StealthAddr.SpendKey, decoys)
+	if err != nil {
+		return nil, nil, err
+	}
+	if offsets != nil {
+		if err := checkMaturity(chain, input); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	chainID, err := chain.GetChainID()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get chain ID: %w", err)
+	}
+	dustLimit, err := chainDustLimit(chain)
+	if err != nil {
+		return nil, nil, err
+	}
+	if policy.viewTags, err = viewTagsActive(chain); err != nil {
+		return nil, nil, err
+	}
+
+	unsigned, sent, err := assembleUnsigned(keys, chainID, input, realOutput, decoys, payments, fee, policy, sponsored, dustLimit)
+	if err != nil {
+		return nil, nil, err
+	}
+	unsigned.Inputs[0].Ring, unsigned.Inputs[0].RingOffsets = ring, offsets
+	return unsigned, sent, nil
+}
+
+// checkInput checks that input can fund total
+func checkInput(input *OwnedOutput, total uint64, policy OutputPolicy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+
+	if input.Spent {
+		return fmt.Errorf("output %s is already spent", input.Ref())
+	}
+	if input.Frozen {
+		return fmt.Errorf("output %s is frozen", input.Ref())
+	}
+	if input.Amount < total {
+		return fmt.Errorf("output %s holds %d, need %d", input.Ref(), input.Amount, total)
+	}
+	return nil
+}
+
+// assembleUnsigned builds the unsigned transaction spending input, whose
+// on-chain output and ring decoys are already known. Change below
+// dustLimit is added to the fee rather than paid back (see dust.go).
+func assembleUnsigned(keys *crypto.WalletKeys, chainID string, input *OwnedOutput, realOutput *types.TxOutput, decoys []types.PublicKey, payments []Payment, fee uint64, policy OutputPolicy, sponsored bool, dustLimit uint64) (*UnsignedTx, []*SentOutput, error) {
+	total, err := inputTotal(payments, fee, sponsored)
+	if err != nil {
+		return nil, nil, err
+	}
+	change := input.Amount - total
+	if change < dustLimit {
+		if change > 0 && sponsored {
+			return nil, nil, fmt.Errorf("change %d below dust limit %d; the sponsor cannot take it as fee", change, dustLimit)
+		}
+		fee += change
+		change = 0
+		policy.AlwaysChange = false
+	}
+
+	unsigned := &UnsignedTx{
+		Format:  FormatUnsignedTx,
+		ChainID: chainID,
+		Inputs: []*UnsignedInput{
+			{
+				TxHash:      input.TxHash,
+				OutputIndex: input.OutputIndex,
+				Output:      realOutput,
+				Decoys:      decoys,
+				Subaddress:  SubaddressIndex{Account: input.Account, Index: input.Subaddress},
+			},
+		},
+		Fee:       fee,
+		Sponsored: sponsored,
+	}
+
+	// Change stays in the account that funded the transaction
+	outputs, sent, err := createOutputs(payments, Payment{
+		Recipient: keys.Subaddress(input.Account, 0).GetAddress(),
+		Amount:    change,
+	}, policy)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkDust(outputs, dustLimit); err != nil {
+		return nil, nil, err
+	}
+	unsigned.Outputs = outputs
+
+	return unsigned, sent, nil
+}
+
+// RequiredFee returns the base fee plus the per-byte fee for memos
+func RequiredFee(payments []Payment) uint64 {
+	fee := uint64(DefaultFee)
+	for _, p := range payments {
+		fee += uint64(len(p.Memo)) * types.MemoFeePerByte
+	}
+	return fee
+}
+
+// BaseFeeReader is implemented by chains that report the base fee of
+// the next block, such as RemoteChain
+type BaseFeeReader interface {
+	GetBaseFee() (uint64, error)
+}
+
+// SuggestFee returns RequiredFee plus the chain's base fee, which is
+// burned, so the required fee is left as the proposer's tip. Chains
+// that cannot report a base fee add nothing.
+func SuggestFee(chain ChainReader, payments []Payment) (uint64, error) {
+	fee := RequiredFee(payments)
+	reader, ok := chain.(BaseFeeReader)
+	if !ok {
+		return fee, nil
+	}
+	baseFee, err := reader.GetBaseFee()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get base fee: %w", err)
+	}
+	return types.AddAmounts(fee, baseFee)
+}
+
+// inputTotal returns the amount the sender's input must cover, which
+// leaves out the fee of sponsored transactions
+func inputTotal(payments []Payment, fee uint64, sponsored bool) (uint64, error) {
+	total, err := paymentTotal(payments, fee)
+	if err != nil || !sponsored {
+		return total, err
+	}
+	if fee == 0 {
+		return 0, errors.New("sponsored transaction needs a fee")
+	}
+	return total - fee, nil
+}
+
+// paymentTotal returns the amount an input must cover
+func paymentTotal(payments []Payment, fee uint64) (uint64, error) {
+	if len(payments) == 0 {
+		return 0, errors.New("no payments")
+	}
+
+	total := fee
+	var memoSize uint64
+	for _, p := range payments {
+		if p.Amount == 0 {
+			return 0, errors.New("payment amount must be positive")
+		}
+		var err error
+		if total, err = types.AddAmounts(total, p.Amount); err != nil {
+			return 0, err
+		}
+		memoSize += uint64(len(p.Memo))
+	}
+
+	if memoFee := memoSize * types.MemoFeePerByte; fee < memoFee {
+		return 0, fmt.Errorf("fee %d below memo fee %d", fee, memoFee)
+	}
+
+	return total, nil
+}
+
+// createOutputs creates stealth outputs for the payments followed by a
+// change output, which is skipped when its amount is zero unless the
+// policy always wants change
+func createOutputs(payments []Payment, change Payment, policy OutputPolicy) ([]*types.TxOutput, []*SentOutput, error) {
+	outputs := make([]*types.TxOutput, 0, len(payments)+1)
+	sent := make([]*SentOutput, 0, len(payments))
+
+	for _, payment := range payments {
+		for _, p := range policy.splitPayment(payment) {
+			output, err := createOutput(p, policy.viewTags)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			// Hash locks and burns are public; there is no tx key to keep
+			if p.HashLock != nil || p.Burn {
+				outputs = append(outputs, output.TxOutput)
+				continue
+			}
+
+			sent = append(sent, &SentOutput{
+				OutputIndex: uint32(len(outputs)),
+				Recipient:   output.recipient,
+				Amount:      p.Amount,
+				TxKey:       output.ephemeral.PrivateKey,
+			})
+			outputs = append(outputs, output.TxOutput)
+		}
+	}
+
+	// Return the remainder to ourselves
+	if change.Amount > 0 || policy.AlwaysChange {
+		output, err := createOutput(change, policy.viewTags)
+		if err != nil {
+			return nil, nil, err
+		}
+		outputs = append(outputs, output.TxOutput)
+	}
+
+	if policy.ShuffleOutputs {
+		if err := shuffleOutputs(outputs, sent); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return outputs, sent, nil
+}
+
+// newOutput is a created output with the data the sender keeps
+type newOutput struct {
+	*types.TxOutput
+	recipient types.Address
+	ephemeral *crypto.KeyPair
+}
+
+// createOutput creates the stealth output for a single payment, the
+// contract output of a hash-locked one or the burn output of a burn.
+// Stealth outputs to an address get a view tag if viewTags is set.
+func createOutput(p Payment, viewTags bool) (*newOutput, error) {
+	if p.Burn {
+		if p.PaymentID != nil || len(p.Memo) > 0 || p.HashLock != nil {
+			return nil, errors.New("burns cannot carry a payment ID, memo or hash lock")
+		}
+		return &newOutput{TxOutput: &types.TxOutput{Amount: p.Amount, Burn: true, Bond: p.Bond}}, nil
+	}
+	if p.Bond != nil {
+		return nil, errors.New("only burns can bond stake")
+	}
+	if p.HashLock != nil {
+		if p.PaymentID != nil || len(p.Memo) > 0 {
+			return nil, errors.New("hash-locked payments cannot carry a payment ID or memo")
+		}
+		return &newOutput{TxOutput: &types.TxOutput{Amount: p.Amount, HashLock: p.HashLock}}, nil
+	}
+
+	var (
+		output    *types.TxOutput
+		ephemeral *crypto.KeyPair
+		recipient = p.Recipient
+		err       error
+	)
+
+	if p.Multisig != nil {
+		output, ephemeral, err = crypto.GenerateMultisigOutput(*p.Multisig)
+		recipient = types.Address{
+			ViewKey:  p.Multisig.ViewKey,
+			SpendKey: crypto.AggregateMultisigKey(p.Multisig.Threshold, p.Multisig.SpendKeys),
+		}
+	} else {
+		output, ephemeral, err = crypto.GenerateStealthAddress(p.Recipient)
+	}
+	if err != nil {
+		return nil, err
+	}
+	output.Amount = p.Amount
+	if viewTags && p.Multisig == nil {
+		tag := crypto.ViewTag(ephemeral, recipient)
+		output.ViewTag = &tag
+	}
+
+	// Encrypt the payment ID and memo so only the recipient can read them
+	if p.PaymentID != nil {
+		output.PaymentID = crypto.EncryptPaymentID(*p.PaymentID, ephemeral, recipient)
+	}
+	if len(p.Memo) > 0 {
+		output.Memo, err = crypto.EncryptMemo(p.Memo, ephemeral, recipient)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &newOutput{TxOutput: output, recipient: recipient, ephemeral: ephemeral}, nil
+}
+
+// Sign derives key images and ring signatures for an unsigned transaction.
+// This is the only step that needs the private spend key.
+func (u *UnsignedTx) Sign(keys *crypto.WalletKeys) (*types.Transaction, error) {
+	if !keys.CanSpend() {
+		return nil, errors.New("view-only wallet cannot sign transactions")
+	}
+	if u.Format != FormatUnsignedTx {
+		return nil, errors.New("not an unsigned transaction")
+	}
+	if len(u.Inputs) != 1 {
+		return nil, errors.New("Phase 1 transactions support exactly one input")
+	}
+	if u.ChainID == "" {
+		return nil, errors.New("unsigned transaction has no chain ID")
+	}
+
+	in := u.Inputs[0]
+	if in == nil || in.Output == nil {
+		return nil, errors.New("unsigned transaction input has no output")
+	}
+	for _, out := range u.Outputs {
+		if out == nil {
+			return nil, errors.New("unsigned transaction has a null output")
+		}
+	}
+
+	realPriv, err := keys.Subaddress(in.Subaddress.Account, in.Subaddress.Index).DeriveSpendKey(in.Output)
+	if err != nil {
+		return nil, err
+	}
+	realPub := in.Output.StealthAddr.SpendKey
+
+	signer, err := newRingSigner(realPriv, realPub, in.Decoys, in.Ring)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := &types.Transaction{
+		Version: u.version(),
+		Inputs: []*types.TxInput{
+			{
+				KeyImage:    crypto.GenerateKeyImage(realPriv, realPub),
+				Amount:      in.Output.Amount,
+				RingOffsets: in.RingOffsets,
+			},
+		},
+		Outputs: u.Outputs,
+		Fee:     u.Fee,
+	}
+
+	// Sign the transaction prefix, which commits to key images and
+	// outputs, bound to the chain ID
+	sigHash := types.TxSigningHash(u.ChainID, tx.PrefixHash())
+	sig, err := signer.Sign(sigHash[:])
+	if err != nil {
+		return nil, err
+	}
+	tx.RingSignature = sig
+
+	return tx, nil
+}
+
+// version returns the oldest transaction version supporting what the
+// transaction uses
+func (u *UnsignedTx) version() uint8 {
+	for _, out := range u.Outputs {
+		if out.Bond != nil {
+			return types.TxVersionBond
+		}
+	}
+	for _, out := range u.Outputs {
+		if out.ViewTag != nil {
+			return types.TxVersionViewTag
+		}
+	}
+	for _, in := range u.Inputs {
+		if in.RingOffsets != nil {
+			return types.TxVersionRingIndex
+		}
+	}
+	for _, out := range u.Outputs {
+		if out.Burn {
+			return types.TxVersionBurn
+		}
+	}
+	for _, out := range u.Outputs {
+		if out.HashLock != nil {
+			return types.TxVersionHashLock
+		}
+	}
+	if u.Sponsored {
+		return types.TxVersionFeePayer
+	}
+	return 1
+}
+
+// SelectDecoys picks random output keys from the chain to use as ring
+// members, excluding the real output
+// TODO Phase 2: Prefer recent outputs and matching amounts
+func SelectDecoys(chain ChainReader, exclude types.PublicKey, count int) ([]types.PublicKey, error) {
+	candidates, err := decoyCandidates(chain)
+	if err != nil {
+		return nil, err
+	}
+	return pickDecoys(candidates, exclude, count)
+}
+
+// decoyCandidates returns the keys of all outputs that can be ring
+// members
+func decoyCandidates(chain ChainReader) ([]types.PublicKey, error) {
+	latest, err := chain.GetLatestHeight()
+	if err != nil {
+		return nil, err
+	}
+	maturity, err := chainMaturity(chain)
+	if err != nil {
+		return nil, err
+	}
+
+	// Outputs of the last MinRingMemberAge blocks, and coinbase outputs
+	// short of their own depth, are too young to be ring members of the
+	// next block
+	candidates := make([]types.PublicKey, 0)
+	for height := uint64(1); height+types.MinRingMemberAge <= latest+1; height++ {
+		block, err := chain.GetBlock(height)
+		if err != nil {
+			return nil, err
+		}
+		for _, tx := range block.Transactions {
+			if !maturity.Mature(height, latest+1, tx.IsCoinbase()) {
+				continue
+			}
+			for _, out := range tx.AllOutputs() {
+				if out.IsRingMember() {
+					candidates = append(candidates, out.StealthAddr.SpendKey)
+				}
+			}
+		}
+	}
+	return candidates, nil
+}
+
+// pickDecoys draws count random candidates other than exclude. It does
+// not modify candidates.
+func pickDecoys(all []types.PublicKey, exclude types.PublicKey, count int) ([]types.PublicKey, error) {
+	candidates := make([]types.PublicKey, 0, len(all))
+	for _, key := range all {
+		if key != exclude {
+			candidates = append(candidates, key)
+		}
+	}
+
+	if len(candidates) < count {
+		return nil, fmt.Errorf("not enough outputs on chain for %d decoys", count)
+	}
+
+	// Partial Fisher-Yates shuffle
+	for i := 0; i < count; i++ {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(candidates)-i)))
+		if err != nil {
+			return nil, err
+		}
+		j := i + int(n.Int64())
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	}
+
+	return candidates[:count], nil
+}
+
+// selectInput returns the smallest unspent, unfrozen output covering
+// amount
+func selectInput(scan *ScanResult, amount uint64) (*OwnedOutput, error) {
+	var best *OwnedOutput
+	for _, out := range scan.Outputs {
+		if out.Spent || out.Frozen || out.Amount < amount {
+			continue
+		}
+		if best == nil || out.Amount < best.Amount {
+			best = out
+		}
+	}
+
+	if best == nil {
+		return nil, fmt.Errorf("no single unspent output covers %d", amount)
+	}
+	return best, nil
+}
+
+// findOutput locates an output within a block
+func findOutput(block *types.Block, txHash types.Hash, index uint32) (*types.TxOutput, error) {
+	for _, tx := range block.Transactions {
+		if tx.Hash() != txHash {
+			continue
+		}
+		outputs := tx.AllOutputs()
+		if int(index) >= len(outputs) {
+			break
+		}
+		return outputs[index], nil
+	}
+	return nil, errors.New("output not found in block")
+}
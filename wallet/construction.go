@@ -0,0 +1,272 @@
+package wallet
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"blockchain/crypto"
+	"blockchain/types"
+)
+
+// FormatConstructionData marks a transaction construction data file
+const FormatConstructionData = "construction-data"
+
+// Bounds of one construction data request
+const (
+	MaxConstructionOutputs = 16
+	MaxConstructionDecoys  = 16 // Per output
+)
+
+// ConstructionData is everything an offline wallet needs to build a
+// transaction spending one of Outputs: each output as it appears on
+// chain with a ring of decoys, the chain ID signatures bind to, the
+// base fee, the dust limit and whether outputs carry view tags. Wallets blind the output they spend by
+// asking for others too, so the node serving the data cannot tell which
+// one is real.
+type ConstructionData struct {
+	Format       string                `json:"format"`
+	ChainID      string                `json:"chain_id"`
+	Height       uint64                `json:"height"`                 // Chain tip the data was taken at
+	BaseFee      uint64                `json:"base_fee"`               // Base fee of the next block
+	DustLimit    uint64                `json:"dust_limit,omitempty"`   // Smallest output of the next block
+	ViewTags     bool                  `json:"view_tags,omitempty"`    // Next block accepts view tags
+	Denomination *types.Denomination   `json:"denomination,omitempty"` // How amounts are written
+	Outputs      []*ConstructionOutput `json:"outputs"`
+}
+
+// ConstructionOutput is an output that may be spent, with its decoys.
+// On chains referencing ring members by index, Ring and RingOffsets
+// hold the whole ring in index order.
+type ConstructionOutput struct {
+	TxHash      types.Hash        `json:"tx_hash"`
+	OutputIndex uint32            `json:"output_index"`
+	Output      *types.TxOutput   `json:"output"`
+	Decoys      []types.PublicKey `json:"decoys"`
+	Ring        []types.PublicKey `json:"ring,omitempty"`
+	RingOffsets []uint64          `json:"ring_offsets,omitempty"`
+}
+
+// Ref returns the "<tx_hash>:<index>" reference of the output
+func (o *ConstructionOutput) Ref() string {
+	return FormatOutputRef(o.TxHash, o.OutputIndex)
+}
+
+// NewConstructionData looks up the outputs refs point to and draws
+// decoyCount decoys for each, or as many as the chain's ring policy
+// asks for if decoyCount is 0
+func NewConstructionData(chain ChainReader, refs []string, decoyCount int) (*ConstructionData, error) {
+	if len(refs) == 0 || len(refs) > MaxConstructionOutputs {
+		return nil, fmt.Errorf("need between 1 and %d outputs", MaxConstructionOutputs)
+	}
+	if decoyCount == 0 {
+		var err error
+		if decoyCount, err = DecoyCount(chain); err != nil {
+			return nil, err
+		}
+	}
+	if decoyCount < 1 || decoyCount > MaxConstructionDecoys {
+		return nil, fmt.Errorf("need between 1 and %d decoys", MaxConstructionDecoys)
+	}
+
+	chainID, err := chain.GetChainID()
+	if err != nil {
+		return nil, err
+	}
+	height, err := chain.GetLatestHeight()
+	if err != nil {
+		return nil, err
+	}
+	data := &ConstructionData{
+		Format:  FormatConstructionData,
+		ChainID: chainID,
+		Height:  height,
+		Outputs: make([]*ConstructionOutput, 0, len(refs)),
+	}
+	if reader, ok := chain.(BaseFeeReader); ok {
+		if data.BaseFee, err = reader.GetBaseFee(); err != nil {
+			return nil, err
+		}
+	}
+	if data.DustLimit, err = chainDustLimit(chain); err != nil {
+		return nil, err
+	}
+	if data.ViewTags, err = viewTagsActive(chain); err != nil {
+		return nil, err
+	}
+	if reader, ok := chain.(DenominationReader); ok {
+		d, err := reader.GetDenomination()
+		if err != nil {
+			return nil, err
+		}
+		data.Denomination = &d
+	}
+
+	candidates, err := decoyCandidates(chain)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ref := range refs {
+		txHash, index, err := ParseOutputRef(ref)
+		if err != nil {
+			return nil, err
+		}
+		tx, err := chain.GetTransaction(txHash)
+		if err != nil {
+			return nil, fmt.Errorf("output %s: %w", ref, err)
+		}
+		outputs := tx.AllOutputs()
+		if int(index) >= len(outputs) {
+			return nil, fmt.Errorf("output %s does not exist", ref)
+		}
+		output := outputs[index]
+		if output.HashLock != nil || output.Lock != nil || output.Burn {
+			return nil, fmt.Errorf("output %s cannot be spent in a ring", ref)
+		}
+
+		decoys, err := pickDecoys(candidates, output.StealthAddr.SpendKey, decoyCount)
+		if err != nil {
+			return nil, err
+		}
+		ring, offsets, err := orderRing(chain, output.StealthAddr.SpendKey, decoys)
+		if err != nil {
+			return nil, err
+		}
+		data.Outputs = append(data.Outputs, &ConstructionOutput{
+			TxHash:      txHash,
+			OutputIndex: index,
+			Output:      output,
+			Decoys:      decoys,
+			Ring:        ring,
+			RingOffsets: offsets,
+		})
+	}
+
+	return data, nil
+}
+
+// SuggestFee returns the fee to pay for payments under the data's base
+// fee
+func (d *ConstructionData) SuggestFee(payments []Payment) (uint64, error) {
+	return types.AddAmounts(RequiredFee(payments), d.BaseFee)
+}
+
+// BuildUnsigned builds an unsigned transaction spending the output ref
+// of the data without chain access. The output must belong to keys,
+// paid to their main address or one of subaddresses.
+func (d *ConstructionData) BuildUnsigned(keys *crypto.WalletKeys, ref string, payments []Payment, fee uint64, policy OutputPolicy, subaddresses ...SubaddressIndex) (*UnsignedTx, []*SentOutput, error) {
+	if d.Format != FormatConstructionData {
+		return nil, nil, errors.New("not transaction construction data")
+	}
+
+	var data *ConstructionOutput
+	for _, out := range d.Outputs {
+		if out != nil && out.Ref() == ref {
+			data = out
+		}
+	}
+	if data == nil {
+		return nil, nil, fmt.Errorf("output %s is not in the construction data", ref)
+	}
+	if data.Output == nil {
+		return nil, nil, fmt.Errorf("output %s has no output data", ref)
+	}
+
+	tx := &types.Transaction{Outputs: []*types.TxOutput{data.Output}}
+	owned, err := scanTransaction(receiversFor(keys, subaddresses), tx, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(owned) == 0 {
+		return nil, nil, fmt.Errorf("output %s does not belong to this wallet", ref)
+	}
+	input := owned[0]
+	input.TxHash, input.OutputIndex = data.TxHash, data.OutputIndex
+
+	total, err := inputTotal(payments, fee, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkInput(input, total, policy); err != nil {
+		return nil, nil, err
+	}
+	policy.viewTags = d.ViewTags
+
+	unsigned, sent, err := assembleUnsigned(keys, d.ChainID, input, data.Output, data.Decoys, payments, fee, policy, false, d.DustLimit)
+	if err != nil {
+		return nil, nil, err
+	}
+	unsigned.Inputs[0].Ring, unsigned.Inputs[0].RingOffsets = data.Ring, data.RingOffsets
+	return unsigned, sent, nil
+}
+
+// BlindRefs mixes cover outputs, drawn at random from the chain, into
+// refs and sorts the result, so a node asked for construction data
+// cannot tell which outputs the wallet spends. Each cover output costs
+// one block download.
+func BlindRefs(chain ChainReader, refs []string, cover int) ([]string, error) {
+	latest, err := chain.GetLatestHeight()
+	if err != nil {
+		return nil, err
+	}
+	if cover > 0 && latest == 0 {
+		return nil, errors.New("no outputs on chain for cover")
+	}
+
+	seen := make(map[string]bool, len(refs)+cover)
+	for _, ref := range refs {
+		seen[ref] = true
+	}
+	blinded := append(make([]string, 0, len(refs)+cover), refs...)
+
+	for attempts := 0; len(blinded) < len(refs)+cover; attempts++ {
+		if attempts >= 10*cover {
+			return nil, errors.New("not enough outputs on chain for cover")
+		}
+
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(latest)))
+		if err != nil {
+			return nil, err
+		}
+		block, err := chain.GetBlock(uint64(n.Int64()) + 1)
+		if err != nil {
+			return nil, err
+		}
+
+		eligible := make([]string, 0)
+		for _, tx := range block.Transactions {
+			for i, out := range tx.AllOutputs() {
+				ref := FormatOutputRef(tx.Hash(), uint32(i))
+				if out.HashLock == nil && out.Lock == nil && !out.Burn && !seen[ref] {
+					eligible = append(eligible, ref)
+				}
+			}
+		}
+		if len(eligible) == 0 {
+			continue
+		}
+		n, err = rand.Int(rand.Reader, big.NewInt(int64(len(eligible))))
+		if err != nil {
+			return nil, err
+		}
+		ref := eligible[n.Int64()]
+		seen[ref] = true
+		blinded = append(blinded, ref)
+	}
+
+	sort.Strings(blinded)
+	return blinded, nil
+}
+
+// GetConstructionData asks the node for construction data over refs
+func (rc *RemoteChain) GetConstructionData(refs []string, decoyCount int) (*ConstructionData, error) {
+	var data ConstructionData
+	params := map[string]interface{}{"outputs": refs, "decoys": decoyCount}
+	if err := rc.client.Call("getConstructionData", params, &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
@@ -0,0 +1,454 @@
+package wallet
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"blockchain/crypto"
+	"blockchain/notify"
+	"blockchain/rpc"
+	"blockchain/types"
+)
+
+// DefaultScanInterval is how often the daemon rescans the chain
+const DefaultScanInterval = 10 * time.Second
+
+// Daemon is a long-running wallet that scans the chain in the background
+// and serves an authenticated JSON-RPC API
+type Daemon struct {
+	keys     *crypto.WalletKeys
+	network  types.Network
+	meta     *Metadata
+	chain    *RemoteChain
+	server   *rpc.Server
+	interval time.Duration
+	notifier *notify.Notifier // nil without webhooks
+
+	// mu guards the latest scan, the metadata and pending spends
+	mu   sync.RWMutex
+	scan *ScanResult
+
+	// Key images of submitted transactions not yet seen on chain, so
+	// their inputs are not selected again before the next block
+	pendingSpends map[types.PublicKey]bool
+
+	// sendMu serializes transaction building and submission
+	sendMu sync.Mutex
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// Destination is a single recipient in a transfer request
+type Destination struct {
+	Address string `json:"address"`
+	Amount  uint64 `json:"amount"`
+}
+
+// TransferRequest holds the params of transfer and buildTransaction.
+// Addresses may be address book labels.
+type TransferRequest struct {
+	Destinations []Destination `json:"destinations"`
+	PaymentID    string        `json:"payment_id,omitempty"`
+	Memo         string        `json:"memo,omitempty"`
+	Fee          uint64        `json:"fee,omitempty"`
+
+	// FromUTXO spends a specific output ("<tx_hash>:<index>") instead
+	// of selecting one automatically
+	FromUTXO string `json:"from_utxo,omitempty"`
+}
+
+// TransferEntry is a history entry as returned by getTransfers
+type TransferEntry struct {
+	TxHash     string   `json:"tx_hash"`
+	Height     uint64   `json:"height"`
+	Direction  string   `json:"direction"`
+	Amount     uint64   `json:"amount"`
+	PaymentIDs []string `json:"payment_ids,omitempty"`
+	Memos      []string `json:"memos,omitempty"`
+	Labels     []string `json:"labels,omitempty"`
+}
+
+// NewDaemon creates a wallet daemon of network reading the chain from a
+// node and listening on listenAddr. Every API call must carry authToken.
+func NewDaemon(keys *crypto.WalletKeys, network types.Network, meta *Metadata, chain *RemoteChain, listenAddr, authToken string, interval time.Duration) (*Daemon, error) {
+	if authToken == "" {
+		return nil, errors.New("wallet daemon requires an auth token")
+	}
+	if interval <= 0 {
+		interval = DefaultScanInterval
+	}
+
+	d := &Daemon{
+		keys:          keys,
+		network:       network,
+		meta:          meta,
+		chain:         chain,
+		server:        rpc.NewServer(listenAddr),
+		interval:      interval,
+		pendingSpends: make(map[types.PublicKey]bool),
+		quit:          make(chan struct{}),
+	}
+	d.server.SetAuthToken(authToken)
+
+	d.server.Register("getAddress", d.rpcGetAddress)
+	d.server.Register("createAddress", d.rpcCreateAddress)
+	d.server.Register("getBalance", d.rpcGetBalance)
+	d.server.Register("getTransfers", d.rpcGetTransfers)
+	d.server.Register("buildTransaction", d.rpcBuildTransaction)
+	d.server.Register("transfer", d.rpcTransfer)
+	d.server.Register("submitTransaction", d.rpcSubmitTransaction)
+
+	return d, nil
+}
+
+// Start checks the node is on the wallet's network and performs an
+// initial scan, then serves the API and keeps scanning
+func (d *Daemon) Start() error {
+	if err := CheckNetwork(d.chain, d.network); err != nil {
+		return err
+	}
+	if err := d.rescan(); err != nil {
+		return fmt.Errorf("initial scan failed: %w", err)
+	}
+
+	if err := d.server.Start(); err != nil {
+		return err
+	}
+
+	d.wg.Add(1)
+	go d.scanLoop()
+
+	return nil
+}
+
+// Stop shuts down the API and background scanning
+func (d *Daemon) Stop() error {
+	close(d.quit)
+	d.wg.Wait()
+	return d.server.Close()
+}
+
+// Addr returns the address the API listens on
+func (d *Daemon) Addr() string {
+	return d.server.Addr()
+}
+
+// scanLoop syncs with the chain until the daemon is stopped
+func (d *Daemon) scanLoop() {
+	defer d.wg.Done()
+
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.quit:
+			return
+		case <-ticker.C:
+			if err := d.rescan(); err != nil {
+				fmt.Printf("Wallet scan failed: %v\n", err)
+			}
+		}
+	}
+}
+
+// rescan syncs the checkpoint in the metadata with the chain, scanning
+// only new blocks, and replaces the cached scan result. The daemon
+// serves the primary account.
+func (d *Daemon) rescan() error {
+	// Sync a copy, since the metadata may be saved concurrently
+	d.mu.RLock()
+	subaddresses := d.meta.Subaddresses()
+	cache := d.meta.ScanCache.clone()
+	first := d.scan == nil
+	d.mu.RUnlock()
+
+	prev := cache.Height
+	full, err := Sync(d.keys, d.chain, cache, subaddresses...)
+	if err != nil {
+		return err
+	}
+	// Webhooks cover what was found while running, not the history
+	// caught up with on start
+	if !first {
+		d.notify(prev, cache, full)
+	}
+
+	d.mu.Lock()
+	d.meta.ScanCache = cache
+	err = d.meta.Save()
+	d.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	d.mu.RLock()
+	err = d.meta.ResolveSpends(full, d.chain)
+	d.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	result := full.Account(PrimaryAccount)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.meta.ApplyFrozen(result)
+	for _, out := range result.Outputs {
+		if !d.pendingSpends[out.KeyImage] {
+			continue
+		}
+		if out.Spent {
+			delete(d.pendingSpends, out.KeyImage)
+		} else {
+			out.Spent = true
+		}
+	}
+
+	d.scan = result
+	return nil
+}
+
+// currentScan returns the latest scan result
+func (d *Daemon) currentScan() *ScanResult {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.scan
+}
+
+func (d *Daemon) rpcGetAddress(params json.RawMessage) (interface{}, error) {
+	return map[string]interface{}{
+		"address":   FormatAddress(d.network, d.keys.GetAddress()),
+		"view_only": !d.keys.CanSpend(),
+	}, nil
+}
+
+// rpcCreateAddress returns a new integrated address so deposits can be
+// told apart, using a random payment ID unless one is given
+func (d *Daemon) rpcCreateAddress(params json.RawMessage) (interface{}, error) {
+	var req struct {
+		PaymentID string `json:"payment_id"`
+	}
+	if len(params) > 0 {
+		if err := rpc.DecodeParams(params, &req); err != nil {
+			return nil, err
+		}
+	}
+
+	var (
+		pid types.PaymentID
+		err error
+	)
+	if req.PaymentID != "" {
+		pid, err = ParsePaymentID(req.PaymentID)
+		if err != nil {
+			return nil, rpc.InvalidParams(err)
+		}
+	} else {
+		pid, err = NewPaymentID()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return map[string]string{
+		"address":    FormatIntegratedAddress(d.network, d.keys.GetAddress(), pid),
+		"payment_id": pid.String(),
+	}, nil
+}
+
+func (d *Daemon) rpcGetBalance(params json.RawMessage) (interface{}, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	scan := d.scan
+	return map[string]interface{}{
+		"balance":        scan.Balance(),
+		"received":       scan.Received(),
+		"scanned_height": scan.ScannedHeight,
+		"view_only":      scan.ViewOnly,
+	}, nil
+}
+
+func (d *Daemon) rpcGetTransfers(params json.RawMessage) (interface{}, error) {
+	d.mu.RLock()
+	history := BuildHistory(d.scan, d.meta)
+	d.mu.RUnlock()
+
+	entries := make([]TransferEntry, 0, len(history))
+	for _, h := range history {
+		entry := TransferEntry{
+			TxHash:    h.TxHash.String(),
+			Height:    h.Height,
+			Direction: h.Direction,
+			Amount:    h.Amount,
+			Labels:    h.Labels,
+			Memos:     h.Memos,
+		}
+		for _, pid := range h.PaymentIDs {
+			entry.PaymentIDs = append(entry.PaymentIDs, pid.String())
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// rpcBuildTransaction returns an unsigned transaction for offline
+// signing. It works with view-only wallets.
+func (d *Daemon) rpcBuildTransaction(params json.RawMessage) (interface{}, error) {
+	d.sendMu.Lock()
+	defer d.sendMu.Unlock()
+
+	unsigned, sent, err := d.build(params)
+	if err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.meta.RecordPending(unsigned.ID(), sent)
+	if err := d.meta.Save(); err != nil {
+		return nil, err
+	}
+
+	return unsigned, nil
+}
+
+// rpcTransfer builds, signs and submits a transaction
+func (d *Daemon) rpcTransfer(params json.RawMessage) (interface{}, error) {
+	if !d.keys.CanSpend() {
+		return nil, errors.New("view-only wallet cannot sign transactions; use buildTransaction")
+	}
+
+	d.sendMu.Lock()
+	defer d.sendMu.Unlock()
+
+	unsigned, sent, err := d.build(params)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := unsigned.Sign(d.keys)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := d.submit(tx, sent); err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"tx_hash": tx.Hash().String(),
+		"fee":     tx.Fee,
+	}, nil
+}
+
+// rpcSubmitTransaction broadcasts a transaction signed offline
+func (d *Daemon) rpcSubmitTransaction(params json.RawMessage) (interface{}, error) {
+	var req struct {
+		Tx *types.Transaction `json:"tx"`
+	}
+	if err := rpc.DecodeParams(params, &req); err != nil {
+		return nil, err
+	}
+	if req.Tx == nil {
+		return nil, rpc.InvalidParams(errors.New("missing tx"))
+	}
+
+	d.sendMu.Lock()
+	defer d.sendMu.Unlock()
+
+	if err := d.submit(req.Tx, nil); err != nil {
+		return nil, err
+	}
+
+	return map[string]string{"tx_hash": req.Tx.Hash().String()}, nil
+}
+
+// build decodes a transfer request and builds an unsigned transaction
+// from the latest scan
+func (d *Daemon) build(params json.RawMessage) (*UnsignedTx, []*SentOutput, error) {
+	var req TransferRequest
+	if err := rpc.DecodeParams(params, &req); err != nil {
+		return nil, nil, err
+	}
+	if len(req.Destinations) == 0 {
+		return nil, nil, rpc.InvalidParams(errors.New("no destinations"))
+	}
+	if len(req.Memo) > types.MaxMemoSize {
+		return nil, nil, rpc.InvalidParams(fmt.Errorf("memo exceeds %d bytes", types.MaxMemoSize))
+	}
+
+	payments := make([]Payment, 0, len(req.Destinations))
+	d.mu.RLock()
+	for _, dest := range req.Destinations {
+		payment, err := ParsePayment(d.network, d.meta.ResolveContact(dest.Address), dest.Amount, req.PaymentID)
+		if err != nil {
+			d.mu.RUnlock()
+			return nil, nil, rpc.InvalidParams(err)
+		}
+		if req.Memo != "" {
+			payment.Memo = []byte(req.Memo)
+		}
+		payments = append(payments, payment)
+	}
+	policy := d.meta.OutputPolicy
+	d.mu.RUnlock()
+
+	if req.Fee == 0 {
+		fee, err := SuggestFee(d.chain, payments)
+		if err != nil {
+			return nil, nil, err
+		}
+		req.Fee = fee
+	}
+
+	scan := d.currentScan()
+	if req.FromUTXO == "" {
+		return BuildUnsigned(d.keys, d.chain, scan, payments, req.Fee, policy)
+	}
+
+	txHash, index, err := ParseOutputRef(req.FromUTXO)
+	if err != nil {
+		return nil, nil, rpc.InvalidParams(err)
+	}
+	input, err := scan.Find(txHash, index)
+	if err != nil {
+		return nil, nil, rpc.InvalidParams(err)
+	}
+	return BuildUnsignedFrom(d.keys, d.chain, input, payments, req.Fee, policy)
+}
+
+// submit sends a transaction to the node and records it in the wallet.
+// sent is nil for transactions signed offline, whose outputs were
+// recorded as pending when they were built.
+func (d *Daemon) submit(tx *types.Transaction, sent []*SentOutput) error {
+	if err := d.chain.Client().Call("sendRawTransaction", map[string]interface{}{"tx": tx}, nil); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, input := range tx.AllInputs() {
+		d.pendingSpends[input.KeyImage] = true
+	}
+	for _, out := range d.scan.Outputs {
+		if d.pendingSpends[out.KeyImage] {
+			out.Spent = true
+		}
+	}
+
+	if sent != nil {
+		d.meta.RecordSent(tx.Hash(), sent)
+	} else {
+		d.meta.ResolvePending(tx)
+	}
+	return d.meta.Save()
+}
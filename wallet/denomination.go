@@ -0,0 +1,18 @@
+package wallet
+
+import "blockchain/types"
+
+// DenominationReader is implemented by chains that report how their
+// amounts are written, such as RemoteChain
+type DenominationReader interface {
+	GetDenomination() (types.Denomination, error)
+}
+
+// GetDenomination implements DenominationReader
+func (rc *RemoteChain) GetDenomination() (types.Denomination, error) {
+	var d types.Denomination
+	if err := rc.client.Call("getDenomination", nil, &d); err != nil {
+		return types.Denomination{}, err
+	}
+	return d, nil
+}
@@ -0,0 +1,131 @@
+package wallet
+
+import (
+	"fmt"
+
+	"blockchain/crypto"
+	"blockchain/types"
+)
+
+// DustLimitReader is implemented by chains that report the smallest
+// amount an output of the next block may carry, such as RemoteChain
+type DustLimitReader interface {
+	GetDustLimit() (uint64, error)
+}
+
+// GetDustLimit implements DustLimitReader
+func (rc *RemoteChain) GetDustLimit() (uint64, error) {
+	var result struct {
+		DustLimit uint64 `json:"dust_limit"`
+	}
+	if err := rc.client.Call("getDustLimit", nil, &result); err != nil {
+		return 0, err
+	}
+	return result.DustLimit, nil
+}
+
+// chainDustLimit returns the chain's dust limit, 0 for chains that
+// cannot report one
+func chainDustLimit(chain ChainReader) (uint64, error) {
+	reader, ok := chain.(DustLimitReader)
+	if !ok {
+		return 0, nil
+	}
+	limit, err := reader.GetDustLimit()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get dust limit: %w", err)
+	}
+	return limit, nil
+}
+
+// checkDust fails if any spendable output is below limit. Change is
+// never the culprit, as assembleUnsigned turns small change into fee;
+// payments have to be raised, or split into fewer outputs.
+func checkDust(outputs []*types.TxOutput, limit uint64) error {
+	for _, output := range outputs {
+		if !output.Burn && output.Amount < limit {
+			return fmt.Errorf("output of %d below dust limit %d (send more or use fewer split-outputs)", output.Amount, limit)
+		}
+	}
+	return nil
+}
+
+// selectFeeInput picks the smallest output covering fee whose change
+// is either nothing or at least the dust limit
+func selectFeeInput(scan *ScanResult, fee, dustLimit uint64) (*OwnedOutput, error) {
+	var best *OwnedOutput
+	for _, out := range scan.Outputs {
+		if out.Spent || out.Frozen || out.Amount < fee {
+			continue
+		}
+		if change := out.Amount - fee; change > 0 && change < dustLimit {
+			continue
+		}
+		if best == nil || out.Amount < best.Amount {
+			best = out
+		}
+	}
+
+	if best == nil {
+		return nil, fmt.Errorf("no single unspent output covers %d without leaving dust", fee)
+	}
+	return best, nil
+}
+
+// SelectDust picks the output a send paying fee should sweep under the
+// policy: the smallest dust output, one worth less than SweepBelow,
+// that covers the fee. It returns nil if sweeping is off, the fee is
+// above SweepMaxFee or no dust output covers it.
+func SelectDust(scan *ScanResult, fee uint64, policy OutputPolicy) *OwnedOutput {
+	if policy.SweepBelow == 0 || (policy.SweepMaxFee > 0 && fee > policy.SweepMaxFee) {
+		return nil
+	}
+
+	var best *OwnedOutput
+	for _, out := range scan.Outputs {
+		if out.Spent || out.Frozen || out.Amount < fee || out.Amount >= policy.SweepBelow {
+			continue
+		}
+		if best == nil || out.Amount < best.Amount {
+			best = out
+		}
+	}
+	return best
+}
+
+// BuildSweep builds the payments as a transaction whose fee is paid by
+// the dust output, in full: leftover dust would only be paid back as
+// new dust, so it goes to the proposer as a tip. The payments are
+// funded by another output. Phase 1 transactions have a single ring
+// input, so the dust is spent as the fee payer of a sponsored
+// transaction; once signed, SponsorFrom must add it before broadcast.
+// Both inputs appear in the same transaction, which links them for
+// anyone watching the chain.
+func BuildSweep(keys *crypto.WalletKeys, chain ChainReader, scan *ScanResult, payments []Payment, dust *OwnedOutput, policy OutputPolicy) (*UnsignedTx, []*SentOutput, error) {
+	total, err := inputTotal(payments, dust.Amount, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkMaturity(chain, dust); err != nil {
+		return nil, nil, err
+	}
+	scan, err = matureOutputs(chain, scan)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var input *OwnedOutput
+	for _, out := range scan.Outputs {
+		if out == dust || out.Spent || out.Frozen || out.Amount < total {
+			continue
+		}
+		if input == nil || out.Amount < input.Amount {
+			input = out
+		}
+	}
+	if input == nil {
+		return nil, nil, fmt.Errorf("no single unspent output besides the dust covers %d", total)
+	}
+
+	return buildUnsignedFrom(keys, chain, input, payments, dust.Amount, policy, true)
+}
@@ -0,0 +1,113 @@
+package wallet
+
+import (
+	"fmt"
+
+	"blockchain/crypto"
+	"blockchain/types"
+)
+
+// MaxFilterBatch is the most block filters fetched in one node request
+const MaxFilterBatch = 1000
+
+// FilterReader is a chain that serves compact block filters, such as
+// RemoteChain
+type FilterReader interface {
+	ChainReader
+	GetBlockFilters(fromHeight, count uint64) ([]*types.BlockFilter, error)
+}
+
+// GetBlockFilters implements FilterReader
+func (rc *RemoteChain) GetBlockFilters(fromHeight, count uint64) ([]*types.BlockFilter, error) {
+	var result struct {
+		Filters []*types.BlockFilter `json:"filters"`
+	}
+	params := map[string]uint64{"from_height": fromHeight, "count": count}
+	if err := rc.client.Call("getBlockFilters", params, &result); err != nil {
+		return nil, err
+	}
+	return result.Filters, nil
+}
+
+// SyncFiltered is Sync for light wallets that keep their keys to
+// themselves: it downloads the compact filter of every block and only
+// the blocks whose filter matches the wallet's view key or the key
+// image of one of its unspent outputs. The node learns which blocks
+// were fetched, among false positives, but not why.
+func SyncFiltered(keys *crypto.WalletKeys, chain FilterReader, cache *ScanCache, subaddresses ...SubaddressIndex) (*ScanResult, error) {
+	if err := cache.prepare(keys, chain, subaddresses); err != nil {
+		return nil, err
+	}
+
+	result := &ScanResult{
+		Outputs:       cache.Outputs,
+		ScannedHeight: cache.Height,
+		ViewOnly:      !keys.CanSpend(),
+	}
+	scanner := newBlockScanner(receiversFor(keys, subaddresses), result)
+
+	latest, err := chain.GetLatestHeight()
+	if err != nil {
+		return nil, err
+	}
+
+	lastHash := cache.BlockHash
+	for result.ScannedHeight < latest {
+		from := result.ScannedHeight + 1
+		filters, err := chain.GetBlockFilters(from, min(latest-from+1, MaxFilterBatch))
+		if err != nil {
+			return nil, err
+		}
+		if len(filters) == 0 {
+			return nil, fmt.Errorf("node served no filters from height %d", from)
+		}
+
+		for _, filter := range filters {
+			height := result.ScannedHeight + 1
+			if filter.Height != height {
+				return nil, fmt.Errorf("node served filter for height %d, want %d", filter.Height, height)
+			}
+
+			match, err := filter.MatchAny(filterItems(keys, result))
+			if err != nil {
+				return nil, fmt.Errorf("bad filter at height %d: %w", height, err)
+			}
+			if match {
+				block, err := chain.GetBlock(height)
+				if err != nil {
+					return nil, err
+				}
+				if block.Header.Hash() != filter.BlockHash {
+					return nil, fmt.Errorf("filter at height %d is for another block", height)
+				}
+				if err := scanner.scanBlock(block, height); err != nil {
+					return nil, err
+				}
+			}
+
+			result.ScannedHeight = height
+			lastHash = filter.BlockHash
+		}
+	}
+	scanner.markSpent()
+
+	cache.Outputs = result.Outputs
+	cache.Height = result.ScannedHeight
+	cache.BlockHash = lastHash
+
+	return result.clone(), nil
+}
+
+// filterItems returns what a block filter is matched against for a
+// wallet: its view key, shared by all its subaddresses, and the key
+// images of outputs not yet seen spent
+func filterItems(keys *crypto.WalletKeys, result *ScanResult) [][]byte {
+	viewKey := keys.GetAddress().ViewKey
+	items := [][]byte{viewKey[:]}
+	for _, out := range result.Outputs {
+		if !out.Spent && out.KeyImage != (types.PublicKey{}) {
+			items = append(items, out.KeyImage[:])
+		}
+	}
+	return items
+}
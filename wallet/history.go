@@ -0,0 +1,128 @@
+package wallet
+
+import (
+	"bytes"
+	"sort"
+
+	"blockchain/types"
+)
+
+// Transaction directions in the history
+const (
+	DirectionIn  = "in"
+	DirectionOut = "out"
+)
+
+// HistoryEntry summarizes one transaction affecting the wallet
+type HistoryEntry struct {
+	TxHash    types.Hash
+	Height    uint64
+	Direction string
+
+	// Amount is the net change in balance: received funds for incoming
+	// transactions, spent funds minus change (including the fee) for
+	// outgoing ones
+	Amount uint64
+
+	PaymentIDs []types.PaymentID // Decrypted payment IDs of incoming outputs
+	Memos      []string          // Decrypted memos of incoming outputs
+	Labels     []string          // Address book labels of known recipients
+}
+
+// BuildHistory lists the wallet's transactions from a scan, oldest first.
+// A transaction spending one of our outputs is outgoing; any outputs it
+// pays back to us are change. Recipients are labeled from the address
+// book using the outputs recorded when sending. View-only wallets only
+// see incoming transactions.
+func BuildHistory(scan *ScanResult, meta *Metadata) []*HistoryEntry {
+	type totals struct {
+		height   uint64
+		received uint64
+		spent    uint64
+		pids     []types.PaymentID
+		memos    []string
+	}
+
+	byTx := make(map[types.Hash]*totals)
+	get := func(hash types.Hash, height uint64) *totals {
+		t, exists := byTx[hash]
+		if !exists {
+			t = &totals{height: height}
+			byTx[hash] = t
+		}
+		return t
+	}
+
+	for _, out := range scan.Outputs {
+		t := get(out.TxHash, out.BlockHeight)
+		t.received += out.Amount
+		if out.PaymentID != nil {
+			t.pids = append(t.pids, *out.PaymentID)
+		}
+		if out.Memo != nil {
+			t.memos = append(t.memos, string(out.Memo))
+		}
+
+		if out.Spent {
+			get(out.SpentTxHash, out.SpentHeight).spent += out.Amount
+		}
+	}
+
+	entries := make([]*HistoryEntry, 0, len(byTx))
+	for hash, t := range byTx {
+		entry := &HistoryEntry{
+			TxHash:    hash,
+			Height:    t.height,
+			Direction: DirectionIn,
+			Amount:    t.received,
+		}
+
+		if t.spent > 0 {
+			entry.Direction = DirectionOut
+			if t.spent > t.received {
+				entry.Amount = t.spent - t.received
+			} else {
+				entry.Amount = 0
+			}
+			entry.Labels = recipientLabels(meta, hash)
+		} else {
+			entry.PaymentIDs = t.pids
+			entry.Memos = t.memos
+		}
+
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Height != entries[j].Height {
+			return entries[i].Height < entries[j].Height
+		}
+		return bytes.Compare(entries[i].TxHash[:], entries[j].TxHash[:]) < 0
+	})
+
+	return entries
+}
+
+// recipientLabels returns the address book labels of the recipients
+// recorded for a sent transaction
+func recipientLabels(meta *Metadata, txHash types.Hash) []string {
+	if meta == nil {
+		return nil
+	}
+
+	outputs, err := meta.GetSent(txHash)
+	if err != nil {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	labels := make([]string, 0)
+	for _, out := range outputs {
+		label := meta.ContactLabel(out.Recipient)
+		if label != "" && !seen[label] {
+			seen[label] = true
+			labels = append(labels, label)
+		}
+	}
+	return labels
+}
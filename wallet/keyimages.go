@@ -0,0 +1,170 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+
+	"blockchain/types"
+)
+
+// FormatKeyImages marks a key image export file
+const FormatKeyImages = "key-images"
+
+// MaxKeyImageBatch is the most key images checked in one node request
+const MaxKeyImageBatch = 1000
+
+// KeyImageExport carries the key images of a wallet's outputs from the
+// full wallet to a view-only copy, which cannot derive them, so it can
+// tell which outputs were spent
+type KeyImageExport struct {
+	Format    string             `json:"format"`
+	KeyImages []ExportedKeyImage `json:"key_images"`
+}
+
+// ExportedKeyImage is the key image of one output
+type ExportedKeyImage struct {
+	Output   string          `json:"output"` // <tx_hash>:<index>
+	KeyImage types.PublicKey `json:"key_image"`
+}
+
+// KeyImageChecker is implemented by chains that look up spent key
+// images, such as RemoteChain
+type KeyImageChecker interface {
+	IsKeyImageSpent(keyImages []types.PublicKey) ([]bool, error)
+}
+
+// ExportKeyImages lists the key images of a scan's outputs
+func ExportKeyImages(scan *ScanResult) (*KeyImageExport, error) {
+	if scan.ViewOnly {
+		return nil, errors.New("view-only wallet cannot derive key images")
+	}
+
+	export := &KeyImageExport{
+		Format:    FormatKeyImages,
+		KeyImages: make([]ExportedKeyImage, 0, len(scan.Outputs)),
+	}
+	for _, out := range scan.Outputs {
+		export.KeyImages = append(export.KeyImages, ExportedKeyImage{Output: out.Ref(), KeyImage: out.KeyImage})
+	}
+	return export, nil
+}
+
+// ImportKeyImages stores exported key images, replacing any known for
+// the same outputs. It returns how many were imported.
+func (m *Metadata) ImportKeyImages(export *KeyImageExport) (int, error) {
+	if export.Format != FormatKeyImages {
+		return 0, errors.New("not a key image export")
+	}
+	for _, ki := range export.KeyImages {
+		if _, _, err := ParseOutputRef(ki.Output); err != nil {
+			return 0, fmt.Errorf("invalid output %q: %w", ki.Output, err)
+		}
+		if ki.KeyImage == (types.PublicKey{}) {
+			return 0, fmt.Errorf("output %s has no key image", ki.Output)
+		}
+	}
+
+	for _, ki := range export.KeyImages {
+		m.KeyImages[ki.Output] = ki.KeyImage
+	}
+	return len(export.KeyImages), nil
+}
+
+// ApplyKeyImages fills in imported key images for outputs the scan
+// could not derive them for. It returns how many were applied.
+func (m *Metadata) ApplyKeyImages(scan *ScanResult) int {
+	applied := 0
+	for _, out := range scan.Outputs {
+		if out.KeyImage != (types.PublicKey{}) {
+			continue
+		}
+		if ki, ok := m.KeyImages[out.Ref()]; ok {
+			out.KeyImage = ki
+			applied++
+		}
+	}
+	return applied
+}
+
+// ResolveSpends applies imported key images to the scan of a view-only
+// wallet and marks the outputs they show spent. Chains that look up key
+// images are asked directly; others are scanned for the spending inputs.
+func (m *Metadata) ResolveSpends(scan *ScanResult, chain ChainReader) error {
+	if !scan.ViewOnly || m.ApplyKeyImages(scan) == 0 {
+		return nil
+	}
+	if checker, ok := chain.(KeyImageChecker); ok {
+		return MarkSpent(scan, checker)
+	}
+	return MarkSpent(scan, &scanningChecker{chain: chain})
+}
+
+// MarkSpent asks the chain which unspent outputs of a scan have their
+// key image spent and marks them. The spending transaction is not
+// known, so SpentTxHash stays unset.
+func MarkSpent(scan *ScanResult, chain KeyImageChecker) error {
+	pending := make([]*OwnedOutput, 0)
+	for _, out := range scan.Outputs {
+		if !out.Spent && out.KeyImage != (types.PublicKey{}) {
+			pending = append(pending, out)
+		}
+	}
+
+	for start := 0; start < len(pending); start += MaxKeyImageBatch {
+		batch := pending[start:min(start+MaxKeyImageBatch, len(pending))]
+		keyImages := make([]types.PublicKey, len(batch))
+		for i, out := range batch {
+			keyImages[i] = out.KeyImage
+		}
+
+		spent, err := chain.IsKeyImageSpent(keyImages)
+		if err != nil {
+			return err
+		}
+		if len(spent) != len(batch) {
+			return fmt.Errorf("node answered %d of %d key images", len(spent), len(batch))
+		}
+		for i, out := range batch {
+			out.Spent = spent[i]
+		}
+	}
+	return nil
+}
+
+// scanningChecker finds spent key images by walking a chain's blocks,
+// for chains that cannot look them up
+type scanningChecker struct {
+	chain ChainReader
+}
+
+// IsKeyImageSpent implements KeyImageChecker
+func (c *scanningChecker) IsKeyImageSpent(keyImages []types.PublicKey) ([]bool, error) {
+	wanted := make(map[types.PublicKey]bool, len(keyImages))
+	for _, ki := range keyImages {
+		wanted[ki] = false
+	}
+
+	latest, err := c.chain.GetLatestHeight()
+	if err != nil {
+		return nil, err
+	}
+	for height := uint64(1); height <= latest; height++ {
+		block, err := c.chain.GetBlock(height)
+		if err != nil {
+			return nil, err
+		}
+		for _, tx := range block.Transactions {
+			for _, input := range tx.AllInputs() {
+				if _, ok := wanted[input.KeyImage]; ok {
+					wanted[input.KeyImage] = true
+				}
+			}
+		}
+	}
+
+	spent := make([]bool, len(keyImages))
+	for i, ki := range keyImages {
+		spent[i] = wanted[ki]
+	}
+	return spent, nil
+}
@@ -0,0 +1,77 @@
+package wallet
+
+import (
+	"fmt"
+
+	"blockchain/types"
+)
+
+// MaturityReader is implemented by chains that report how deep outputs
+// must be buried before the next block may spend them or use them as
+// decoys, such as RemoteChain
+type MaturityReader interface {
+	GetMaturity() (types.MaturityConfig, error)
+}
+
+// GetMaturity implements MaturityReader
+func (rc *RemoteChain) GetMaturity() (types.MaturityConfig, error) {
+	var maturity types.MaturityConfig
+	if err := rc.client.Call("getMaturity", nil, &maturity); err != nil {
+		return types.MaturityConfig{}, err
+	}
+	return maturity, nil
+}
+
+// chainMaturity returns the chain's maturity rules. Chains that cannot
+// report them get MinRingMemberAge for every output, the rule before
+// MaturityVersion.
+func chainMaturity(chain ChainReader) (types.MaturityConfig, error) {
+	reader, ok := chain.(MaturityReader)
+	if !ok {
+		return types.MaturityConfig{CoinbaseConfirmations: types.MinRingMemberAge}, nil
+	}
+	maturity, err := reader.GetMaturity()
+	if err != nil {
+		return types.MaturityConfig{}, fmt.Errorf("failed to get maturity: %w", err)
+	}
+	return maturity, nil
+}
+
+// checkMaturity fails if input is too young to be spent in the next
+// block
+func checkMaturity(chain ChainReader, input *OwnedOutput) error {
+	maturity, err := chainMaturity(chain)
+	if err != nil {
+		return err
+	}
+	latest, err := chain.GetLatestHeight()
+	if err != nil {
+		return err
+	}
+	if next := latest + 1; !maturity.Mature(input.BlockHeight, next, input.Coinbase) {
+		return fmt.Errorf("output %s can be spent in %d blocks", input.Ref(), input.BlockHeight+maturity.Required(input.Coinbase)-next)
+	}
+	return nil
+}
+
+// matureOutputs returns the outputs of scan the next block may spend,
+// so automatic selection passes over young ones
+func matureOutputs(chain ChainReader, scan *ScanResult) (*ScanResult, error) {
+	maturity, err := chainMaturity(chain)
+	if err != nil {
+		return nil, err
+	}
+	latest, err := chain.GetLatestHeight()
+	if err != nil {
+		return nil, err
+	}
+
+	mature := *scan
+	mature.Outputs = make([]*OwnedOutput, 0, len(scan.Outputs))
+	for _, out := range scan.Outputs {
+		if maturity.Mature(out.BlockHeight, latest+1, out.Coinbase) {
+			mature.Outputs = append(mature.Outputs, out)
+		}
+	}
+	return &mature, nil
+}
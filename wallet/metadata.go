@@ -0,0 +1,247 @@
+package wallet
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"blockchain/crypto"
+	"blockchain/types"
+	"golang.org/x/crypto/ed25519"
+)
+
+// SentOutput records an output this wallet created, with the tx key
+// needed to later prove the payment
+type SentOutput struct {
+	OutputIndex uint32             `json:"output_index"`
+	Recipient   types.Address      `json:"recipient"`
+	Amount      uint64             `json:"amount"`
+	TxKey       ed25519.PrivateKey `json:"tx_key"`
+}
+
+// Metadata is wallet state kept in a file next to the key file
+type Metadata struct {
+	path string
+
+	// Outputs created by this wallet, keyed by tx hash (hex)
+	SentOutputs map[string][]*SentOutput `json:"sent_outputs"`
+
+	// Outputs of unsigned transactions awaiting signature, keyed by
+	// UnsignedTx.ID since the final hash is not known yet
+	PendingSent map[string][]*SentOutput `json:"pending_sent,omitempty"`
+
+	// Address book, mapping labels to address strings
+	Contacts map[string]string `json:"contacts,omitempty"`
+
+	// Outputs excluded from automatic input selection, by output reference
+	Frozen map[string]bool `json:"frozen_outputs,omitempty"`
+
+	// Labeled accounts, indexed by Account.Index; empty until the first
+	// account is created (see account.go)
+	AccountList []*Account `json:"accounts,omitempty"`
+
+	// How new transactions lay out their outputs (see outputs.go)
+	OutputPolicy OutputPolicy `json:"output_policy"`
+
+	// Swap keys derived so far, and the secrets of swaps this wallet
+	// initiated keyed by hash (hex); see swap.go
+	SwapKeys    uint32            `json:"swap_keys,omitempty"`
+	SwapSecrets map[string]string `json:"swap_secrets,omitempty"`
+
+	// Key images imported from the full wallet by output reference, so a
+	// view-only wallet can detect spends (see keyimages.go)
+	KeyImages map[string]types.PublicKey `json:"key_images,omitempty"`
+
+	// Incremental scan checkpoint, nil until the first sync (see sync.go)
+	ScanCache *ScanCache `json:"scan_cache,omitempty"`
+
+	// Registrations with node scanning services by node URL (see
+	// remotescan.go)
+	RemoteScans map[string]*RemoteScan `json:"remote_scans,omitempty"`
+
+	// How the chain writes amounts, nil until learned from a node
+	Denomination *types.Denomination `json:"denomination,omitempty"`
+}
+
+// MetadataPath returns the metadata file used for a wallet file
+func MetadataPath(walletPath string) string {
+	return strings.TrimSuffix(walletPath, filepath.Ext(walletPath)) + ".meta.json"
+}
+
+// LoadMetadata reads wallet metadata, returning empty metadata if the
+// file does not exist yet
+func LoadMetadata(path string) (*Metadata, error) {
+	meta := &Metadata{path: path}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, meta); err != nil {
+			return nil, err
+		}
+	}
+
+	if meta.SentOutputs == nil {
+		meta.SentOutputs = make(map[string][]*SentOutput)
+	}
+	if meta.PendingSent == nil {
+		meta.PendingSent = make(map[string][]*SentOutput)
+	}
+	if meta.Contacts == nil {
+		meta.Contacts = make(map[string]string)
+	}
+	if meta.Frozen == nil {
+		meta.Frozen = make(map[string]bool)
+	}
+	if meta.SwapSecrets == nil {
+		meta.SwapSecrets = make(map[string]string)
+	}
+	if meta.KeyImages == nil {
+		meta.KeyImages = make(map[string]types.PublicKey)
+	}
+	if meta.RemoteScans == nil {
+		meta.RemoteScans = make(map[string]*RemoteScan)
+	}
+
+	return meta, nil
+}
+
+// Save writes metadata back to its file
+func (m *Metadata) Save() error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(m.path, data, 0600)
+}
+
+// RecordSent stores the outputs of a transaction sent by this wallet
+func (m *Metadata) RecordSent(txHash types.Hash, outputs []*SentOutput) {
+	m.SentOutputs[txHash.String()] = outputs
+}
+
+// RecordPending stores the outputs of an unsigned transaction
+func (m *Metadata) RecordPending(unsignedID string, outputs []*SentOutput) {
+	m.PendingSent[unsignedID] = outputs
+}
+
+// ResolvePending moves pending outputs to the sent records once the
+// signed transaction is known. It reports whether a match was found.
+func (m *Metadata) ResolvePending(tx *types.Transaction) bool {
+	id := OutputsID(tx.Outputs)
+	outputs, exists := m.PendingSent[id]
+	if !exists {
+		return false
+	}
+
+	m.RecordSent(tx.Hash(), outputs)
+	delete(m.PendingSent, id)
+	return true
+}
+
+// GetSent returns the recorded outputs of a sent transaction
+func (m *Metadata) GetSent(txHash types.Hash) ([]*SentOutput, error) {
+	outputs, exists := m.SentOutputs[txHash.String()]
+	if !exists {
+		return nil, errors.New("no tx keys recorded for this transaction")
+	}
+	return outputs, nil
+}
+
+// AddContact stores a labeled address of network, replacing any existing
+// entry with the same label
+func (m *Metadata) AddContact(network types.Network, label, address string) error {
+	if label == "" || strings.Contains(label, ":") {
+		return errors.New("contact label must be non-empty and must not contain ':'")
+	}
+
+	if IsMultisigAddress(address) {
+		if _, err := ParseMultisigAddress(network, address); err != nil {
+			return err
+		}
+	} else if _, _, err := ParseAddress(network, address); err != nil {
+		return err
+	}
+
+	m.Contacts[label] = address
+	return nil
+}
+
+// RemoveContact deletes a labeled address
+func (m *Metadata) RemoveContact(label string) error {
+	if _, exists := m.Contacts[label]; !exists {
+		return fmt.Errorf("no contact named %q", label)
+	}
+	delete(m.Contacts, label)
+	return nil
+}
+
+// ResolveContact returns the address stored under a label, or s itself
+// if it is not a known label
+func (m *Metadata) ResolveContact(s string) string {
+	if address, exists := m.Contacts[s]; exists {
+		return address
+	}
+	return s
+}
+
+// ContactLabels returns the address book labels in sorted order
+func (m *Metadata) ContactLabels() []string {
+	labels := make([]string, 0, len(m.Contacts))
+	for label := range m.Contacts {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// ContactLabel returns the label of an address, or "" if it is unknown.
+// Integrated addresses match on their underlying address, and addresses
+// match whatever network they are written for.
+func (m *Metadata) ContactLabel(addr types.Address) string {
+	for _, label := range m.ContactLabels() {
+		address := m.Contacts[label]
+		if IsMultisigAddress(address) {
+			ms, err := parseMultisigAddress(anyNetwork(address))
+			if err == nil && addr.SpendKey == crypto.AggregateMultisigKey(ms.Threshold, ms.SpendKeys) {
+				return label
+			}
+			continue
+		}
+
+		parsed, _, err := parseAddress(anyNetwork(address))
+		if err == nil && parsed == addr {
+			return label
+		}
+	}
+	return ""
+}
+
+// Freeze excludes an output from automatic input selection
+func (m *Metadata) Freeze(txHash types.Hash, index uint32) {
+	m.Frozen[FormatOutputRef(txHash, index)] = true
+}
+
+// Unfreeze makes a frozen output selectable again
+func (m *Metadata) Unfreeze(txHash types.Hash, index uint32) error {
+	ref := FormatOutputRef(txHash, index)
+	if !m.Frozen[ref] {
+		return fmt.Errorf("output %s is not frozen", ref)
+	}
+	delete(m.Frozen, ref)
+	return nil
+}
+
+// ApplyFrozen marks the frozen outputs of a scan result
+func (m *Metadata) ApplyFrozen(scan *ScanResult) {
+	for _, out := range scan.Outputs {
+		out.Frozen = m.Frozen[out.Ref()]
+	}
+}
@@ -0,0 +1,224 @@
+package wallet
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"blockchain/crypto"
+	"blockchain/types"
+)
+
+const (
+	// FormatMultisigInfo marks a participant's setup message
+	FormatMultisigInfo = "multisig-info"
+
+	// FormatMultisig marks a multisig wallet file
+	FormatMultisig = "multisig"
+
+	// DefaultMultisigFile is the multisig wallet used when no path is given
+	DefaultMultisigFile = "multisig_wallet.json"
+)
+
+// MultisigInfo is the setup message each participant shares with the
+// others. It reveals the participant's view key seed, since all members
+// of a multisig wallet share one view key.
+type MultisigInfo struct {
+	Format   string          `json:"format"`
+	ViewSeed []byte          `json:"view_seed"`
+	SpendKey types.PublicKey `json:"spend_public_key"`
+}
+
+// ExportMultisigInfo creates the setup message for a participant
+func ExportMultisigInfo(keys *crypto.WalletKeys) *MultisigInfo {
+	return &MultisigInfo{
+		Format:   FormatMultisigInfo,
+		ViewSeed: keys.ViewKeyPair.PrivateKey.Seed(),
+		SpendKey: keys.SpendKeyPair.PublicKey,
+	}
+}
+
+// MultisigWallet is one participant's copy of an M-of-N wallet
+type MultisigWallet struct {
+	Format       string            `json:"format"`
+	Threshold    uint8             `json:"threshold"`
+	Participants []types.PublicKey `json:"participants"`
+	ViewKeyPair  *crypto.KeyPair   `json:"view_key_pair"`
+
+	// This participant's own spend key, used to co-sign
+	SpendKeyPair *crypto.KeyPair `json:"spend_key_pair"`
+
+	Network types.Network `json:"network,omitempty"`
+}
+
+// NewMultisigWallet combines the setup messages of all participants.
+// own must be one of the participants.
+func NewMultisigWallet(own *crypto.WalletKeys, infos []*MultisigInfo, threshold uint8) (*MultisigWallet, error) {
+	if !own.CanSpend() {
+		return nil, errors.New("view-only wallet cannot join a multisig wallet")
+	}
+
+	viewSeeds := make([][]byte, 0, len(infos))
+	participants := make([]types.PublicKey, 0, len(infos))
+	isMember := false
+
+	for _, info := range infos {
+		if info.Format != FormatMultisigInfo {
+			return nil, errors.New("not a multisig info message")
+		}
+		viewSeeds = append(viewSeeds, info.ViewSeed)
+		participants = append(participants, info.SpendKey)
+		if info.SpendKey == own.SpendKeyPair.PublicKey {
+			isMember = true
+		}
+	}
+
+	if !isMember {
+		return nil, errors.New("own multisig info is not among the participants")
+	}
+
+	if err := crypto.ValidateMultisigParams(threshold, participants); err != nil {
+		return nil, err
+	}
+
+	viewKey, err := crypto.MultisigViewKey(viewSeeds)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MultisigWallet{
+		Format:       FormatMultisig,
+		Threshold:    threshold,
+		Participants: crypto.SortMultisigKeys(participants),
+		ViewKeyPair:  viewKey,
+		SpendKeyPair: own.SpendKeyPair,
+	}, nil
+}
+
+// LoadMultisig reads a multisig wallet file
+func LoadMultisig(path string) (*MultisigWallet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("multisig wallet not found. Run 'wallet multisig import' first")
+	}
+
+	var mw MultisigWallet
+	if err := json.Unmarshal(data, &mw); err != nil {
+		return nil, err
+	}
+	if mw.Format != FormatMultisig {
+		return nil, errors.New("not a multisig wallet file")
+	}
+
+	return &mw, nil
+}
+
+// Save writes the multisig wallet to disk
+func (mw *MultisigWallet) Save(path string) error {
+	data, err := json.MarshalIndent(mw, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0600)
+}
+
+// Address returns the address others use to pay the multisig wallet
+func (mw *MultisigWallet) Address() types.MultisigAddress {
+	return types.MultisigAddress{
+		ViewKey:   mw.ViewKeyPair.PublicKey,
+		Threshold: mw.Threshold,
+		SpendKeys: mw.Participants,
+	}
+}
+
+// ScanKeys returns view-only keys that find the wallet's outputs
+func (mw *MultisigWallet) ScanKeys() *crypto.WalletKeys {
+	return &crypto.WalletKeys{
+		ViewKeyPair: mw.ViewKeyPair,
+		SpendKeyPair: &crypto.KeyPair{
+			PublicKey: crypto.AggregateMultisigKey(mw.Threshold, mw.Participants),
+		},
+	}
+}
+
+// BuildTx creates a transaction spending one multisig output. It needs
+// Threshold participant signatures (see Sign) before it is valid.
+func (mw *MultisigWallet) BuildTx(scan *ScanResult, payments []Payment, fee uint64) (*types.Transaction, error) {
+	total, err := paymentTotal(payments, fee)
+	if err != nil {
+		return nil, err
+	}
+
+	input, err := selectInput(scan, total)
+	if err != nil {
+		return nil, err
+	}
+
+	addr := mw.Address()
+	outputs, _, err := createOutputs(payments, Payment{
+		Amount:   input.Amount - total,
+		Multisig: &addr,
+	}, OutputPolicy{})
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.Transaction{
+		Version: 1,
+		Inputs: []*types.TxInput{
+			{
+				KeyImage: crypto.MultisigKeyImage(input.TxHash, input.OutputIndex),
+				Amount:   input.Amount,
+				Multisig: &types.MultisigSpend{
+					TxHash:      input.TxHash,
+					OutputIndex: input.OutputIndex,
+				},
+			},
+		},
+		Outputs: outputs,
+		Fee:     fee,
+	}, nil
+}
+
+// Sign adds this participant's signature for the given chain to every
+// multisig input and returns the lowest signature count across inputs
+func (mw *MultisigWallet) Sign(tx *types.Transaction, chainID string) (int, error) {
+	if chainID == "" {
+		return 0, errors.New("missing chain ID")
+	}
+
+	cond := &types.MultisigCondition{
+		Threshold: mw.Threshold,
+		Keys:      mw.Participants,
+	}
+	txHash := types.TxSigningHash(chainID, tx.PrefixHash())
+
+	minSigs := -1
+	for _, input := range tx.Inputs {
+		if input.Multisig == nil {
+			return 0, errors.New("transaction has a non-multisig input")
+		}
+
+		sig, err := crypto.SignMultisig(cond, mw.SpendKeyPair, txHash)
+		if err != nil {
+			return 0, err
+		}
+
+		// Replace an earlier signature by the same participant
+		sigs := make([]types.MultisigSignature, 0, len(input.Multisig.Signatures)+1)
+		for _, existing := range input.Multisig.Signatures {
+			if existing.KeyIndex != sig.KeyIndex {
+				sigs = append(sigs, existing)
+			}
+		}
+		input.Multisig.Signatures = append(sigs, *sig)
+
+		if minSigs < 0 || len(sigs)+1 < minSigs {
+			minSigs = len(sigs) + 1
+		}
+	}
+
+	return minSigs, nil
+}
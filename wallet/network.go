@@ -0,0 +1,65 @@
+package wallet
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"blockchain/types"
+)
+
+// NetworkReader is implemented by chains that report which network they
+// are, such as RemoteChain
+type NetworkReader interface {
+	GetNetwork() (types.Network, error)
+}
+
+// GetNetwork implements NetworkReader. Nodes that predate named networks
+// report none and are taken to be testnet.
+func (rc *RemoteChain) GetNetwork() (types.Network, error) {
+	var result struct {
+		Network types.Network `json:"network"`
+	}
+	if err := rc.client.Call("getChainId", nil, &result); err != nil {
+		return "", err
+	}
+	return result.Network.OrDefault(), nil
+}
+
+// CheckNetwork refuses a chain of another network than the wallet's, so
+// a transaction built for testnet is never sent to a mainnet node or the
+// other way round. Chains that do not report a network are not checked.
+func CheckNetwork(chain ChainReader, network types.Network) error {
+	reader, ok := chain.(NetworkReader)
+	if !ok {
+		return nil
+	}
+	nodeNetwork, err := reader.GetNetwork()
+	if err != nil {
+		return fmt.Errorf("failed to get node network: %w", err)
+	}
+	if nodeNetwork != network.OrDefault() {
+		return fmt.Errorf("node is on %s, but the wallet is for %s", nodeNetwork, network.OrDefault())
+	}
+	return nil
+}
+
+// LoadNetwork returns the network of a wallet file of any kind. Files
+// written before networks were named are testnet wallets.
+func LoadNetwork(path string) (types.Network, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	var file struct {
+		Network types.Network `json:"network"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return "", err
+	}
+	if err := file.Network.Validate(); err != nil {
+		return "", err
+	}
+	return file.Network.OrDefault(), nil
+}
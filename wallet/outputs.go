@@ -0,0 +1,180 @@
+package wallet
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"blockchain/types"
+)
+
+// MaxSplitOutputs caps the number of outputs a payment is split into
+const MaxSplitOutputs = 16
+
+// OutputPolicy controls how the builder lays out the outputs of a
+// transaction. Phase 1 amounts are public, so these options only make
+// it harder to tell which outputs are payments and which is change.
+// The zero policy creates one output per payment and change last, and
+// sweeps no dust.
+type OutputPolicy struct {
+	// SplitOutputs pays each payment with this many outputs of equal
+	// amount; 0 or 1 uses a single output
+	SplitOutputs int `json:"split_outputs,omitempty"`
+
+	// AlwaysChange adds a change output even when nothing is left over,
+	// so exact-amount spends look like any other
+	AlwaysChange bool `json:"always_change,omitempty"`
+
+	// ShuffleOutputs puts the outputs in random order instead of
+	// payments first and change last
+	ShuffleOutputs bool `json:"shuffle_outputs,omitempty"`
+
+	// SweepBelow makes sends pay their fee with an owned output worth
+	// less than this many base units, so dust leaves the wallet; 0
+	// turns sweeping off (see dust.go)
+	SweepBelow uint64 `json:"sweep_below,omitempty"`
+
+	// SweepMaxFee sweeps only while the fee is at most this many base
+	// units; 0 sweeps at any fee
+	SweepMaxFee uint64 `json:"sweep_max_fee,omitempty"`
+
+	// viewTags tags stealth outputs, set by the builder when the chain
+	// accepts view tags (see viewtag.go)
+	viewTags bool
+}
+
+// Validate checks the policy is usable
+func (p OutputPolicy) Validate() error {
+	if p.SplitOutputs < 0 || p.SplitOutputs > MaxSplitOutputs {
+		return fmt.Errorf("split outputs must be between 0 and %d", MaxSplitOutputs)
+	}
+	return nil
+}
+
+// OutputOptions lists the names accepted by Set, in display order
+var OutputOptions = []string{"split-outputs", "always-change", "shuffle-outputs", "sweep-below", "sweep-max-fee"}
+
+// Set changes one option by name
+func (p *OutputPolicy) Set(name, value string) error {
+	next := *p
+
+	switch name {
+	case "split-outputs":
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid split-outputs %q", value)
+		}
+		next.SplitOutputs = n
+	case "always-change", "shuffle-outputs":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q (want true or false)", name, value)
+		}
+		if name == "always-change" {
+			next.AlwaysChange = b
+		} else {
+			next.ShuffleOutputs = b
+		}
+	case "sweep-below", "sweep-max-fee":
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil || n > types.MoneySupply {
+			return fmt.Errorf("invalid %s %q (want base units)", name, value)
+		}
+		if name == "sweep-below" {
+			next.SweepBelow = n
+		} else {
+			next.SweepMaxFee = n
+		}
+	default:
+		return fmt.Errorf("unknown setting %q", name)
+	}
+
+	if err := next.Validate(); err != nil {
+		return err
+	}
+	*p = next
+	return nil
+}
+
+// Get returns the value of one option by name
+func (p OutputPolicy) Get(name string) string {
+	switch name {
+	case "split-outputs":
+		return strconv.Itoa(p.SplitOutputs)
+	case "always-change":
+		return strconv.FormatBool(p.AlwaysChange)
+	case "shuffle-outputs":
+		return strconv.FormatBool(p.ShuffleOutputs)
+	case "sweep-below":
+		return strconv.FormatUint(p.SweepBelow, 10)
+	case "sweep-max-fee":
+		return strconv.FormatUint(p.SweepMaxFee, 10)
+	}
+	return ""
+}
+
+// splitPayment divides a payment into the outputs the policy asks for.
+// Parts differ by at most 1 and are never zero, so small amounts get
+// fewer parts. The payment ID is kept on every part so the recipient
+// can match them; the memo goes on the first part only, since memos pay
+// per byte. Swap contracts are never split.
+func (p OutputPolicy) splitPayment(payment Payment) []Payment {
+	n := uint64(max(p.SplitOutputs, 1))
+	if payment.Amount < n {
+		n = payment.Amount
+	}
+	if n <= 1 || payment.HashLock != nil || payment.Burn {
+		return []Payment{payment}
+	}
+
+	parts := make([]Payment, n)
+	for i := range parts {
+		part := payment
+		part.Amount = payment.Amount / n
+		if uint64(i) < payment.Amount%n {
+			part.Amount++
+		}
+		if i > 0 {
+			part.Memo = nil
+		}
+		parts[i] = part
+	}
+	return parts
+}
+
+// shuffleOutputs puts outputs in random order and updates the indexes
+// recorded for sent outputs
+func shuffleOutputs(outputs []*types.TxOutput, sent []*SentOutput) error {
+	order := make([]int, len(outputs))
+	for i := range order {
+		order[i] = i
+	}
+
+	// Fisher-Yates shuffle
+	for i := len(order) - 1; i > 0; i-- {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return err
+		}
+		j := int(n.Int64())
+		order[i], order[j] = order[j], order[i]
+	}
+
+	shuffled := make([]*types.TxOutput, len(outputs))
+	position := make([]uint32, len(outputs))
+	for to, from := range order {
+		shuffled[to] = outputs[from]
+		position[from] = uint32(to)
+	}
+	copy(outputs, shuffled)
+
+	for _, s := range sent {
+		if int(s.OutputIndex) >= len(position) {
+			return errors.New("sent output index out of range")
+		}
+		s.OutputIndex = position[s.OutputIndex]
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package wallet
+
+import (
+	"blockchain/rpc"
+	"blockchain/types"
+)
+
+// RemoteChain reads chain data from a node over RPC
+type RemoteChain struct {
+	client *rpc.Client
+}
+
+// NewRemoteChain creates a chain reader for the node RPC at url
+func NewRemoteChain(url string) *RemoteChain {
+	return &RemoteChain{client: rpc.NewClient(url)}
+}
+
+// Client returns the underlying RPC client
+func (rc *RemoteChain) Client() *rpc.Client {
+	return rc.client
+}
+
+// GetLatestHeight implements ChainReader
+func (rc *RemoteChain) GetLatestHeight() (uint64, error) {
+	var result struct {
+		Height uint64 `json:"height"`
+	}
+	if err := rc.client.Call("getHeight", nil, &result); err != nil {
+		return 0, err
+	}
+	return result.Height, nil
+}
+
+// GetBlock implements ChainReader
+func (rc *RemoteChain) GetBlock(height uint64) (*types.Block, error) {
+	var block types.Block
+	params := map[string]uint64{"height": height}
+	if err := rc.client.Call("getBlock", params, &block); err != nil {
+		return nil, err
+	}
+	return &block, nil
+}
+
+// GetTransaction implements ChainReader
+func (rc *RemoteChain) GetTransaction(hash types.Hash) (*types.Transaction, error) {
+	var tx types.Transaction
+	params := map[string]string{"hash": hash.String()}
+	if err := rc.client.Call("getTransaction", params, &tx); err != nil {
+		return nil, err
+	}
+	return &tx, nil
+}
+
+// GetBaseFee implements BaseFeeReader
+func (rc *RemoteChain) GetBaseFee() (uint64, error) {
+	var result struct {
+		BaseFee uint64 `json:"base_fee"`
+	}
+	if err := rc.client.Call("getBaseFee", nil, &result); err != nil {
+		return 0, err
+	}
+	return result.BaseFee, nil
+}
+
+// IsKeyImageSpent implements KeyImageChecker
+func (rc *RemoteChain) IsKeyImageSpent(keyImages []types.PublicKey) ([]bool, error) {
+	var result struct {
+		Spent []bool `json:"spent"`
+	}
+	params := map[string]interface{}{"key_images": keyImages}
+	if err := rc.client.Call("isKeyImageSpent", params, &result); err != nil {
+		return nil, err
+	}
+	return result.Spent, nil
+}
+
+// GetChainID implements ChainReader
+func (rc *RemoteChain) GetChainID() (string, error) {
+	var result struct {
+		ChainID string `json:"chain_id"`
+	}
+	if err := rc.client.Call("getChainId", nil, &result); err != nil {
+		return "", err
+	}
+	return result.ChainID, nil
+}
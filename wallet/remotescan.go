@@ -0,0 +1,139 @@
+package wallet
+
+import (
+	"errors"
+	"slices"
+
+	"blockchain/crypto"
+	"blockchain/rpc"
+)
+
+// RemoteScan is a wallet's registration with a node scanning service
+type RemoteScan struct {
+	Token        string            `json:"token"`
+	Subaddresses []SubaddressIndex `json:"subaddresses,omitempty"`
+}
+
+// Covers reports whether the registration scans for subaddresses
+func (r *RemoteScan) Covers(subaddresses []SubaddressIndex) bool {
+	return r != nil && slices.Equal(r.Subaddresses, subaddresses)
+}
+
+// RegisterScan hands the view keys of keys to the node's scanning
+// service and returns the token for later requests. The node learns
+// every incoming output of the wallet, but cannot spend them.
+func (rc *RemoteChain) RegisterScan(keys *crypto.WalletKeys, subaddresses []SubaddressIndex) (*RemoteScan, error) {
+	reg := &ScanRegistration{
+		ViewKeyPair:  keys.ViewKeyPair,
+		SpendKey:     keys.SpendKeyPair.PublicKey,
+		Subaddresses: subaddresses,
+	}
+	var result struct {
+		Token string `json:"token"`
+	}
+	if err := rc.client.Call("registerScanWallet", reg, &result); err != nil {
+		return nil, err
+	}
+	return &RemoteScan{Token: result.Token, Subaddresses: slices.Clone(subaddresses)}, nil
+}
+
+// UnregisterScan makes the node forget a registration's view keys
+func (rc *RemoteChain) UnregisterScan(token string) error {
+	params := map[string]string{"token": token}
+	return rc.client.Call("unregisterScanWallet", params, nil)
+}
+
+// ScanOutputs returns the outputs the node's scanning service matched
+// from fromHeight on, a page of at most MaxScanBlocks blocks
+func (rc *RemoteChain) ScanOutputs(token string, fromHeight uint64) (*ScanOutputsResult, error) {
+	var result ScanOutputsResult
+	params := map[string]interface{}{"token": token, "from_height": fromHeight}
+	if err := rc.client.Call("getScanOutputs", params, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// IsUnknownScanToken reports whether err means the node no longer knows
+// a registration, for example after a restart, so the wallet must
+// register again
+func IsUnknownScanToken(err error) bool {
+	var rpcErr *rpc.Error
+	return errors.As(err, &rpcErr) && rpcErr.Code == rpc.CodeUnauthorized && rpcErr.Message == ErrUnknownScanToken.Error()
+}
+
+// SyncRemote is Sync with the scanning done by the node's scanning
+// service: only the transactions of matched outputs are downloaded,
+// and each match is checked against keys before it is kept. Spends are
+// found by key image lookup, which needs the private spend key or
+// imported key images.
+func SyncRemote(keys *crypto.WalletKeys, chain *RemoteChain, token string, cache *ScanCache, subaddresses ...SubaddressIndex) (*ScanResult, error) {
+	if err := cache.prepare(keys, chain, subaddresses); err != nil {
+		return nil, err
+	}
+
+	result := &ScanResult{
+		Outputs:       copyOutputs(cache.Outputs),
+		ScannedHeight: cache.Height,
+		ViewOnly:      !keys.CanSpend(),
+	}
+	known := make(map[string]bool, len(result.Outputs))
+	for _, out := range result.Outputs {
+		known[out.Ref()] = true
+	}
+	receivers := receiversFor(keys, subaddresses)
+
+	for {
+		page, err := chain.ScanOutputs(token, result.ScannedHeight+1)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, candidate := range page.Candidates {
+			ref := FormatOutputRef(candidate.TxHash, candidate.OutputIndex)
+			if known[ref] {
+				continue
+			}
+			tx, err := chain.GetTransaction(candidate.TxHash)
+			if err != nil {
+				return nil, err
+			}
+			owned, err := scanTransaction(receivers, tx, candidate.BlockHeight)
+			if err != nil {
+				return nil, err
+			}
+			for _, out := range owned {
+				if out.OutputIndex == candidate.OutputIndex {
+					result.Outputs = append(result.Outputs, out)
+					known[ref] = true
+				}
+			}
+		}
+
+		if page.ScannedHeight <= result.ScannedHeight {
+			break
+		}
+		result.ScannedHeight = page.ScannedHeight
+		if page.ScannedHeight >= page.Height {
+			break
+		}
+	}
+
+	if !result.ViewOnly {
+		if err := MarkSpent(result, chain); err != nil {
+			return nil, err
+		}
+	}
+
+	if result.ScannedHeight > cache.Height {
+		block, err := chain.GetBlock(result.ScannedHeight)
+		if err != nil {
+			return nil, err
+		}
+		cache.Height = result.ScannedHeight
+		cache.BlockHash = block.Header.Hash()
+	}
+	cache.Outputs = result.Outputs
+
+	return result.clone(), nil
+}
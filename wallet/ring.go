@@ -0,0 +1,42 @@
+package wallet
+
+import (
+	"fmt"
+
+	"blockchain/types"
+)
+
+// RingPolicyReader is implemented by chains that report the ring size
+// bounds of the next block, such as RemoteChain
+type RingPolicyReader interface {
+	GetRingPolicy() (types.RingPolicy, error)
+}
+
+// GetRingPolicy implements RingPolicyReader
+func (rc *RemoteChain) GetRingPolicy() (types.RingPolicy, error) {
+	var policy types.RingPolicy
+	if err := rc.client.Call("getRingPolicy", nil, &policy); err != nil {
+		return types.RingPolicy{}, err
+	}
+	return policy, nil
+}
+
+// RingDecoys returns the decoys per ring under policy: DefaultDecoyCount
+// unless the network asks for larger or smaller rings
+func RingDecoys(policy types.RingPolicy) int {
+	return policy.Clamp(DefaultDecoyCount+1) - 1
+}
+
+// DecoyCount returns the decoys per ring the chain's ring policy asks
+// for, DefaultDecoyCount for chains that cannot report one
+func DecoyCount(chain ChainReader) (int, error) {
+	reader, ok := chain.(RingPolicyReader)
+	if !ok {
+		return DefaultDecoyCount, nil
+	}
+	policy, err := reader.GetRingPolicy()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get ring policy: %w", err)
+	}
+	return RingDecoys(policy), nil
+}
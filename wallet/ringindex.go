@@ -0,0 +1,75 @@
+package wallet
+
+import (
+	"fmt"
+	"sort"
+
+	"blockchain/crypto"
+	"blockchain/types"
+	"golang.org/x/crypto/ed25519"
+)
+
+// RingMemberReader is implemented by chains that report the global
+// output index of ring members, such as RemoteChain. It returns nil
+// while the chain does not reference ring members by index.
+type RingMemberReader interface {
+	GetRingMemberIndexes(keys []types.PublicKey) ([]uint64, error)
+}
+
+// GetRingMemberIndexes implements RingMemberReader
+func (rc *RemoteChain) GetRingMemberIndexes(keys []types.PublicKey) ([]uint64, error) {
+	var result struct {
+		Indexes []uint64 `json:"indexes"`
+	}
+	params := map[string]interface{}{"keys": keys}
+	if err := rc.client.Call("getRingMemberIndexes", params, &result); err != nil {
+		return nil, err
+	}
+	return result.Indexes, nil
+}
+
+// orderRing puts the real key and its decoys in global output index
+// order and returns them with their offsets, as rings must be from
+// TxVersionRingIndex. It returns nil for chains that do not reference
+// ring members by index.
+func orderRing(chain ChainReader, real types.PublicKey, decoys []types.PublicKey) ([]types.PublicKey, []uint64, error) {
+	reader, ok := chain.(RingMemberReader)
+	if !ok {
+		return nil, nil, nil
+	}
+
+	ring := append([]types.PublicKey{real}, decoys...)
+	indexes, err := reader.GetRingMemberIndexes(ring)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get ring member indexes: %w", err)
+	}
+	if indexes == nil {
+		return nil, nil, nil
+	}
+	if len(indexes) != len(ring) {
+		return nil, nil, fmt.Errorf("chain returned %d indexes for %d ring members", len(indexes), len(ring))
+	}
+
+	order := make([]int, len(ring))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return indexes[order[a]] < indexes[order[b]] })
+
+	sorted := make([]types.PublicKey, len(ring))
+	sortedIndexes := make([]uint64, len(ring))
+	for to, from := range order {
+		sorted[to] = ring[from]
+		sortedIndexes[to] = indexes[from]
+	}
+	return sorted, types.RingOffsets(sortedIndexes), nil
+}
+
+// newRingSigner creates the signer of a ring given in index order, or of
+// a ring in random order around decoys if ring is nil
+func newRingSigner(realPriv ed25519.PrivateKey, realPub types.PublicKey, decoys, ring []types.PublicKey) (*crypto.RingSigner, error) {
+	if ring == nil {
+		return crypto.NewRingSigner(realPriv, realPub, decoys)
+	}
+	return crypto.NewOrderedRingSigner(realPriv, realPub, ring)
+}
@@ -0,0 +1,319 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"blockchain/crypto"
+	"blockchain/types"
+)
+
+// ChainReader provides the chain data a wallet reads. It is satisfied
+// by a local storage.Database and by RemoteChain.
+type ChainReader interface {
+	GetLatestHeight() (uint64, error)
+	GetBlock(height uint64) (*types.Block, error)
+	GetTransaction(hash types.Hash) (*types.Transaction, error)
+	GetChainID() (string, error)
+}
+
+// OwnedOutput is a transaction output that belongs to the wallet
+type OwnedOutput struct {
+	TxHash      types.Hash       `json:"tx_hash"`
+	OutputIndex uint32           `json:"output_index"`
+	Amount      uint64           `json:"amount"`
+	BlockHeight uint64           `json:"block_height"`
+	KeyImage    types.PublicKey  `json:"key_image"`            // Zero for view-only wallets
+	PaymentID   *types.PaymentID `json:"payment_id,omitempty"` // Decrypted payment ID, nil if none
+	Memo        []byte           `json:"memo,omitempty"`       // Decrypted memo, nil if none
+	Spent       bool             `json:"spent,omitempty"`
+	Coinbase    bool             `json:"coinbase,omitempty"` // Block reward, which matures later
+
+	// Transaction that spent the output, set when Spent
+	SpentTxHash types.Hash `json:"spent_tx_hash"`
+	SpentHeight uint64     `json:"spent_height,omitempty"`
+
+	// Frozen outputs are never selected automatically (coin control)
+	Frozen bool `json:"frozen,omitempty"`
+
+	// Subaddress the output was paid to (see account.go)
+	Account    uint32 `json:"account,omitempty"`
+	Subaddress uint32 `json:"subaddress,omitempty"`
+}
+
+// Ref returns the "<tx_hash>:<index>" reference of the output
+func (o *OwnedOutput) Ref() string {
+	return FormatOutputRef(o.TxHash, o.OutputIndex)
+}
+
+// FormatOutputRef encodes an output reference
+func FormatOutputRef(txHash types.Hash, index uint32) string {
+	return fmt.Sprintf("%s:%d", txHash, index)
+}
+
+// ParseOutputRef decodes a "<tx_hash>:<index>" output reference
+func ParseOutputRef(s string) (types.Hash, uint32, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return types.Hash{}, 0, errors.New("output reference must be <tx_hash>:<index>")
+	}
+
+	txHash, err := types.HashFromString(parts[0])
+	if err != nil {
+		return types.Hash{}, 0, err
+	}
+
+	index, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return types.Hash{}, 0, fmt.Errorf("invalid output index: %w", err)
+	}
+
+	return txHash, uint32(index), nil
+}
+
+// Find returns the output with the given reference
+func (r *ScanResult) Find(txHash types.Hash, index uint32) (*OwnedOutput, error) {
+	for _, out := range r.Outputs {
+		if out.TxHash == txHash && out.OutputIndex == index {
+			return out, nil
+		}
+	}
+	return nil, errors.New("output not found in wallet")
+}
+
+// spendRef records where a key image was spent
+type spendRef struct {
+	txHash types.Hash
+	height uint64
+}
+
+// ScanResult holds the outputs discovered by a scan
+type ScanResult struct {
+	Outputs       []*OwnedOutput
+	ScannedHeight uint64
+
+	// ViewOnly is set when key images could not be derived, in which
+	// case spent outputs cannot be detected
+	ViewOnly bool
+}
+
+// Received returns the total amount of all discovered outputs
+func (r *ScanResult) Received() uint64 {
+	var total uint64
+	for _, out := range r.Outputs {
+		total += out.Amount
+	}
+	return total
+}
+
+// SpendsKnown reports whether every output has a key image, so Spent
+// can be trusted. View-only wallets need key images imported from the
+// full wallet (see keyimages.go).
+func (r *ScanResult) SpendsKnown() bool {
+	for _, out := range r.Outputs {
+		if out.KeyImage == (types.PublicKey{}) {
+			return false
+		}
+	}
+	return true
+}
+
+// Balance returns the total amount of unspent outputs.
+// For view-only wallets without key images this equals Received.
+func (r *ScanResult) Balance() uint64 {
+	var total uint64
+	for _, out := range r.Outputs {
+		if !out.Spent {
+			total += out.Amount
+		}
+	}
+	return total
+}
+
+// Scan walks the chain from the given height and collects outputs that
+// belong to the wallet's main address or to one of subaddresses. Full
+// wallets also derive key images so spent outputs are detected;
+// view-only wallets only see incoming funds.
+func Scan(keys *crypto.WalletKeys, chain ChainReader, fromHeight uint64, subaddresses ...SubaddressIndex) (*ScanResult, error) {
+	result, _, err := scanFrom(keys, chain, fromHeight, nil, subaddresses)
+	return result, err
+}
+
+// scanFrom continues a scan at fromHeight, starting with the outputs
+// found before it so spends of those are detected too. It also returns
+// the hash of the last block scanned, zero if none was.
+func scanFrom(keys *crypto.WalletKeys, chain ChainReader, fromHeight uint64, known []*OwnedOutput, subaddresses []SubaddressIndex) (*ScanResult, types.Hash, error) {
+	result := &ScanResult{
+		Outputs:  append(make([]*OwnedOutput, 0, len(known)), known...),
+		ViewOnly: !keys.CanSpend(),
+	}
+	var lastHash types.Hash
+
+	receivers := receiversFor(keys, subaddresses)
+
+	latest, err := chain.GetLatestHeight()
+	if err != nil {
+		return nil, types.Hash{}, err
+	}
+
+	// Height 0 is genesis and carries no transactions
+	if fromHeight == 0 {
+		fromHeight = 1
+	}
+	if fromHeight > 1 {
+		result.ScannedHeight = fromHeight - 1
+	}
+
+	// Blocks are fetched and scanned in parallel (see scanpool.go), and
+	// added in order
+	scanner := newBlockScanner(receivers, result)
+	err = scanBlocks(chain, receivers, fromHeight, latest, func(scanned *scannedBlock) error {
+		scanner.addBlock(scanned.block, scanned.height, scanned.owned)
+		result.ScannedHeight = scanned.height
+		lastHash = scanned.block.Header.Hash()
+		return nil
+	})
+	if err != nil {
+		return nil, types.Hash{}, err
+	}
+	scanner.markSpent()
+
+	return result, lastHash, nil
+}
+
+// blockScanner collects a wallet's outputs from blocks, and the spends
+// of them once all blocks are seen
+type blockScanner struct {
+	receivers []receiver
+	result    *ScanResult
+	spent     map[types.PublicKey]spendRef
+}
+
+func newBlockScanner(receivers []receiver, result *ScanResult) *blockScanner {
+	return &blockScanner{
+		receivers: receivers,
+		result:    result,
+		spent:     make(map[types.PublicKey]spendRef),
+	}
+}
+
+// scanBlock adds the wallet's outputs in block and records its spends
+func (s *blockScanner) scanBlock(block *types.Block, height uint64) error {
+	owned, err := scanBlockOutputs(s.receivers, block, height)
+	if err != nil {
+		return err
+	}
+	s.addBlock(block, height, owned)
+	return nil
+}
+
+// addBlock adds the wallet's outputs already found in block and records
+// its spends
+func (s *blockScanner) addBlock(block *types.Block, height uint64, owned []*OwnedOutput) {
+	for _, tx := range block.Transactions {
+		txHash := tx.Hash()
+		for _, input := range tx.AllInputs() {
+			s.spent[input.KeyImage] = spendRef{txHash: txHash, height: height}
+		}
+	}
+	s.result.Outputs = append(s.result.Outputs, owned...)
+}
+
+// markSpent marks the outputs whose key images were spent in the
+// scanned blocks
+func (s *blockScanner) markSpent() {
+	for _, out := range s.result.Outputs {
+		if out.Spent || out.KeyImage == (types.PublicKey{}) {
+			continue
+		}
+		if ref, spent := s.spent[out.KeyImage]; spent {
+			out.Spent = true
+			out.SpentTxHash = ref.txHash
+			out.SpentHeight = ref.height
+		}
+	}
+}
+
+// receiver is an address scanned for, with its keys
+type receiver struct {
+	index SubaddressIndex
+	keys  *crypto.WalletKeys
+}
+
+// receiversFor returns the main address of keys, which is always
+// scanned, and the given subaddresses
+func receiversFor(keys *crypto.WalletKeys, subaddresses []SubaddressIndex) []receiver {
+	receivers := []receiver{{keys: keys}}
+	for _, sub := range subaddresses {
+		if sub.Account == 0 && sub.Index == 0 {
+			continue
+		}
+		receivers = append(receivers, receiver{index: sub, keys: keys.Subaddress(sub.Account, sub.Index)})
+	}
+	return receivers
+}
+
+// scanTransaction returns the outputs of tx that belong to one of the
+// receivers
+func scanTransaction(receivers []receiver, tx *types.Transaction, height uint64) ([]*OwnedOutput, error) {
+	owned := make([]*OwnedOutput, 0)
+	txHash := tx.Hash()
+
+	for i, output := range tx.AllOutputs() {
+		// Hash-locked outputs are found by swap reference instead, and
+		// locked outputs and burns carry no stealth address
+		if output.HashLock != nil || output.Lock != nil || output.Burn {
+			continue
+		}
+
+		var keys *crypto.WalletKeys
+		var index SubaddressIndex
+		for _, r := range receivers {
+			belongs, _, err := r.keys.ScanTransaction(output)
+			if err != nil {
+				return nil, err
+			}
+			if belongs {
+				keys, index = r.keys, r.index
+				break
+			}
+		}
+		if keys == nil {
+			continue
+		}
+
+		out := &OwnedOutput{
+			TxHash:      txHash,
+			OutputIndex: uint32(i),
+			Amount:      output.Amount,
+			BlockHeight: height,
+			Coinbase:    tx.IsCoinbase(),
+			Account:     index.Account,
+			Subaddress:  index.Index,
+		}
+
+		if !output.PaymentID.IsZero() {
+			pid := keys.DecryptPaymentID(output)
+			out.PaymentID = &pid
+		}
+		out.Memo = keys.DecryptMemo(output)
+
+		// Multisig key images come from the output reference; all
+		// others need the private spend key
+		if output.Multisig != nil {
+			out.KeyImage = crypto.MultisigKeyImage(txHash, uint32(i))
+		} else if keys.CanSpend() {
+			priv, err := keys.DeriveSpendKey(output)
+			if err != nil {
+				return nil, err
+			}
+			out.KeyImage = crypto.GenerateKeyImage(priv, output.StealthAddr.SpendKey)
+		}
+
+		owned = append(owned, out)
+	}
+
+	return owned, nil
+}
@@ -0,0 +1,101 @@
+package wallet
+
+import (
+	"runtime"
+
+	"blockchain/types"
+)
+
+// ScanWindow bounds how many blocks a scan fetches and scans ahead of
+// the block it is adding, so memory stays flat on long rescans
+const ScanWindow = 64
+
+// scannedBlock is a block with the wallet's outputs in it
+type scannedBlock struct {
+	height uint64
+	block  *types.Block
+	owned  []*OwnedOutput
+	err    error
+}
+
+// scanBlocks fetches and scans the blocks from..to across one worker per
+// CPU and hands them to add in height order, one at a time. It stops at
+// the first error from the chain, a scan or add.
+func scanBlocks(chain ChainReader, receivers []receiver, from, to uint64, add func(*scannedBlock) error) error {
+	if from > to {
+		return nil
+	}
+
+	workers := uint64(runtime.GOMAXPROCS(0))
+	if n := to - from + 1; n < workers {
+		workers = n
+	}
+
+	type job struct {
+		height uint64
+		done   chan *scannedBlock
+	}
+	jobs := make(chan job, ScanWindow)
+	pending := make(chan chan *scannedBlock, ScanWindow)
+	stop := make(chan struct{})
+	defer close(stop)
+
+	// Jobs are queued in height order, and their results are waited for
+	// in the same order however the workers finish them
+	go func() {
+		defer close(jobs)
+		defer close(pending)
+		for height := from; height <= to; height++ {
+			done := make(chan *scannedBlock, 1)
+			select {
+			case pending <- done:
+			case <-stop:
+				return
+			}
+			jobs <- job{height: height, done: done}
+		}
+	}()
+
+	for i := uint64(0); i < workers; i++ {
+		go func() {
+			for j := range jobs {
+				j.done <- scanBlockAt(chain, receivers, j.height)
+			}
+		}()
+	}
+
+	for done := range pending {
+		scanned := <-done
+		if scanned.err != nil {
+			return scanned.err
+		}
+		if err := add(scanned); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanBlockAt fetches the block at height and finds the wallet's outputs
+// in it
+func scanBlockAt(chain ChainReader, receivers []receiver, height uint64) *scannedBlock {
+	block, err := chain.GetBlock(height)
+	if err != nil {
+		return &scannedBlock{height: height, err: err}
+	}
+	owned, err := scanBlockOutputs(receivers, block, height)
+	return &scannedBlock{height: height, block: block, owned: owned, err: err}
+}
+
+// scanBlockOutputs returns the wallet's outputs in block, in order
+func scanBlockOutputs(receivers []receiver, block *types.Block, height uint64) ([]*OwnedOutput, error) {
+	var owned []*OwnedOutput
+	for _, tx := range block.Transactions {
+		found, err := scanTransaction(receivers, tx, height)
+		if err != nil {
+			return nil, err
+		}
+		owned = append(owned, found...)
+	}
+	return owned, nil
+}
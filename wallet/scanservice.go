@@ -0,0 +1,212 @@
+package wallet
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"blockchain/crypto"
+	"blockchain/types"
+	"golang.org/x/crypto/ed25519"
+)
+
+// Scanning service limits
+const (
+	MaxScanSubaddresses = 256  // Per registered wallet
+	MaxScanBlocks       = 1000 // Per ScanOutputs call
+)
+
+// ErrUnknownScanToken is returned for tokens the service does not know,
+// including those of registrations it has since forgotten
+var ErrUnknownScanToken = errors.New("unknown or expired scan token")
+
+// ScanServiceConfig limits the registrations a scanning service keeps
+type ScanServiceConfig struct {
+	MaxWallets int           // Registrations kept at once
+	TTL        time.Duration // Registrations unused this long are forgotten
+}
+
+// DefaultScanServiceConfig returns the limits used by nodes
+func DefaultScanServiceConfig() ScanServiceConfig {
+	return ScanServiceConfig{
+		MaxWallets: 1000,
+		TTL:        24 * time.Hour,
+	}
+}
+
+// ScanRegistration is what a light wallet hands a scanning service: its
+// view keys and the subaddresses to look for. It cannot spend, but it
+// reveals every incoming output, amount and memo of the wallet.
+type ScanRegistration struct {
+	ViewKeyPair  *crypto.KeyPair   `json:"view_key_pair"`
+	SpendKey     types.PublicKey   `json:"spend_public_key"`
+	Subaddresses []SubaddressIndex `json:"subaddresses,omitempty"`
+}
+
+// ScanCandidate is an output a scanning service matched to a wallet.
+// The wallet fetches the transaction and checks the match itself.
+type ScanCandidate struct {
+	TxHash      types.Hash `json:"tx_hash"`
+	OutputIndex uint32     `json:"output_index"`
+	BlockHeight uint64     `json:"block_height"`
+}
+
+// ScanOutputsResult is one page of a remote scan
+type ScanOutputsResult struct {
+	Candidates    []ScanCandidate `json:"candidates"`
+	ScannedHeight uint64          `json:"scanned_height"` // Last block scanned
+	Height        uint64          `json:"height"`         // Chain tip
+}
+
+// ScanService scans the chain on behalf of light wallets that register
+// their view keys. Registrations are held in memory only, so a restart
+// forgets them, and each is reached with a random token given to the
+// wallet at registration.
+type ScanService struct {
+	chain  ChainReader
+	config ScanServiceConfig
+
+	mu      sync.Mutex
+	wallets map[[sha256.Size]byte]*scanWallet // By token hash
+}
+
+// scanWallet is a registered wallet
+type scanWallet struct {
+	keys         *crypto.WalletKeys
+	subaddresses []SubaddressIndex
+	lastUsed     time.Time
+}
+
+// NewScanService creates a scanning service over chain
+func NewScanService(chain ChainReader, config ScanServiceConfig) *ScanService {
+	return &ScanService{
+		chain:   chain,
+		config:  config,
+		wallets: make(map[[sha256.Size]byte]*scanWallet),
+	}
+}
+
+// Register stores a wallet's view keys and returns the token that
+// reaches them
+func (s *ScanService) Register(reg *ScanRegistration) (string, error) {
+	if err := reg.validate(); err != nil {
+		return "", err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(secret)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expire()
+	if len(s.wallets) >= s.config.MaxWallets {
+		return "", errors.New("scanning service is full")
+	}
+	s.wallets[sha256.Sum256([]byte(token))] = &scanWallet{
+		keys: &crypto.WalletKeys{
+			ViewKeyPair:  reg.ViewKeyPair,
+			SpendKeyPair: &crypto.KeyPair{PublicKey: reg.SpendKey},
+		},
+		subaddresses: reg.Subaddresses,
+		lastUsed:     time.Now(),
+	}
+	return token, nil
+}
+
+// Unregister forgets the wallet reached by token. It reports whether
+// there was one.
+func (s *ScanService) Unregister(token string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := sha256.Sum256([]byte(token))
+	_, ok := s.wallets[key]
+	delete(s.wallets, key)
+	return ok
+}
+
+// Outputs scans up to MaxScanBlocks blocks from fromHeight for the
+// wallet reached by token
+func (s *ScanService) Outputs(token string, fromHeight uint64) (*ScanOutputsResult, error) {
+	s.mu.Lock()
+	s.expire()
+	w, ok := s.wallets[sha256.Sum256([]byte(token))]
+	if ok {
+		w.lastUsed = time.Now()
+	}
+	s.mu.Unlock()
+	if !ok {
+		return nil, ErrUnknownScanToken
+	}
+
+	latest, err := s.chain.GetLatestHeight()
+	if err != nil {
+		return nil, err
+	}
+	if fromHeight == 0 {
+		fromHeight = 1
+	}
+
+	result := &ScanOutputsResult{
+		Candidates:    make([]ScanCandidate, 0),
+		ScannedHeight: fromHeight - 1,
+		Height:        latest,
+	}
+	receivers := receiversFor(w.keys, w.subaddresses)
+	for height := fromHeight; height <= latest && height < fromHeight+MaxScanBlocks; height++ {
+		block, err := s.chain.GetBlock(height)
+		if err != nil {
+			return nil, err
+		}
+		for _, tx := range block.Transactions {
+			owned, err := scanTransaction(receivers, tx, height)
+			if err != nil {
+				return nil, err
+			}
+			for _, out := range owned {
+				result.Candidates = append(result.Candidates, ScanCandidate{
+					TxHash:      out.TxHash,
+					OutputIndex: out.OutputIndex,
+					BlockHeight: height,
+				})
+			}
+		}
+		result.ScannedHeight = height
+	}
+	return result, nil
+}
+
+// expire drops registrations unused for longer than the TTL. The caller
+// holds mu.
+func (s *ScanService) expire() {
+	cutoff := time.Now().Add(-s.config.TTL)
+	for key, w := range s.wallets {
+		if w.lastUsed.Before(cutoff) {
+			delete(s.wallets, key)
+		}
+	}
+}
+
+// validate checks that a registration holds a usable view key
+func (reg *ScanRegistration) validate() error {
+	if reg.ViewKeyPair == nil || len(reg.ViewKeyPair.PrivateKey) != ed25519.PrivateKeySize {
+		return errors.New("registration needs the private view key")
+	}
+	var pub types.PublicKey
+	copy(pub[:], reg.ViewKeyPair.PrivateKey.Public().(ed25519.PublicKey))
+	if pub != reg.ViewKeyPair.PublicKey {
+		return errors.New("view key pair does not match")
+	}
+	if len(reg.Subaddresses) > MaxScanSubaddresses {
+		return fmt.Errorf("at most %d subaddresses can be registered", MaxScanSubaddresses)
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+
+	"blockchain/crypto"
+	"blockchain/types"
+)
+
+// NeedsSponsor reports whether a signed transaction was built with
+// BuildSponsored and still lacks its sponsor
+func NeedsSponsor(tx *types.Transaction) bool {
+	if tx.FeePayer != nil || tx.Version < types.TxVersionFeePayer || tx.Fee == 0 {
+		return false
+	}
+	in, err := tx.InputSum()
+	if err != nil {
+		return false
+	}
+	out, err := tx.OutputSum()
+	return err == nil && in == out
+}
+
+// Sponsor pays the fee of a transaction signed by someone else. It
+// spends one of the sponsor's outputs covering the fee, returns the rest
+// to the account the output belongs to, and signs with a ring signature
+// of its own. Fees above maxFee are refused, so a sender cannot make the
+// sponsor pay more than it agreed to.
+func Sponsor(keys *crypto.WalletKeys, chain ChainReader, scan *ScanResult, tx *types.Transaction, maxFee uint64) error {
+	chainID, err := checkSponsorable(keys, chain, tx, maxFee)
+	if err != nil {
+		return err
+	}
+	dustLimit, err := chainDustLimit(chain)
+	if err != nil {
+		return err
+	}
+
+	scan, err = matureOutputs(chain, scan)
+	if err != nil {
+		return err
+	}
+	input, err := selectFeeInput(scan, tx.Fee, dustLimit)
+	if err != nil {
+		return err
+	}
+	return sponsorWith(keys, chain, chainID, input, tx)
+}
+
+// SponsorFrom is Sponsor paying the fee from a specific output, whose
+// change must not fall below the dust limit
+func SponsorFrom(keys *crypto.WalletKeys, chain ChainReader, input *OwnedOutput, tx *types.Transaction, maxFee uint64) error {
+	chainID, err := checkSponsorable(keys, chain, tx, maxFee)
+	if err != nil {
+		return err
+	}
+	dustLimit, err := chainDustLimit(chain)
+	if err != nil {
+		return err
+	}
+
+	if err := checkInput(input, tx.Fee, OutputPolicy{}); err != nil {
+		return err
+	}
+	if change := input.Amount - tx.Fee; change > 0 && change < dustLimit {
+		return fmt.Errorf("change %d below dust limit %d", change, dustLimit)
+	}
+	return sponsorWith(keys, chain, chainID, input, tx)
+}
+
+// checkSponsorable checks that keys may pay the fee of tx, and returns
+// the chain ID the sponsor signs for
+func checkSponsorable(keys *crypto.WalletKeys, chain ChainReader, tx *types.Transaction, maxFee uint64) (string, error) {
+	if !keys.CanSpend() {
+		return "", errors.New("view-only wallet cannot sponsor transactions")
+	}
+	if !NeedsSponsor(tx) {
+		return "", errors.New("transaction was not built for a sponsor or already has one")
+	}
+	if tx.Fee > maxFee {
+		return "", fmt.Errorf("fee %d above the maximum %d", tx.Fee, maxFee)
+	}
+
+	chainID, err := chain.GetChainID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get chain ID: %w", err)
+	}
+
+	// Refuse to pay for a transaction the chain would reject anyway
+	if tx.RingSignature == nil {
+		return "", errors.New("transaction is not signed by the sender")
+	}
+	sigHash := types.TxSigningHash(chainID, tx.PrefixHash())
+	if !crypto.VerifyRingSignature(tx.RingSignature, sigHash[:]) {
+		return "", errors.New("invalid sender signature (signed for another chain?)")
+	}
+	return chainID, nil
+}
+
+// sponsorWith adds input as the fee payer of tx and signs it
+func sponsorWith(keys *crypto.WalletKeys, chain ChainReader, chainID string, input *OwnedOutput, tx *types.Transaction) error {
+	block, err := chain.GetBlock(input.BlockHeight)
+	if err != nil {
+		return err
+	}
+	realOutput, err := findOutput(block, input.TxHash, input.OutputIndex)
+	if err != nil {
+		return err
+	}
+	decoyCount, err := DecoyCount(chain)
+	if err != nil {
+		return err
+	}
+	decoys, err := SelectDecoys(chain, realOutput.StealthAddr.SpendKey, decoyCount)
+	if err != nil {
+		return err
+	}
+	ring, offsets, err := orderRing(chain, realOutput.StealthAddr.SpendKey, decoys)
+	if err != nil {
+		return err
+	}
+	if offsets != nil {
+		if err := checkMaturity(chain, input); err != nil {
+			return err
+		}
+	}
+
+	realPriv, err := keys.Subaddress(input.Account, input.Subaddress).DeriveSpendKey(realOutput)
+	if err != nil {
+		return err
+	}
+	realPub := realOutput.StealthAddr.SpendKey
+
+	fp := &types.FeePayer{
+		Input: &types.TxInput{
+			KeyImage:    crypto.GenerateKeyImage(realPriv, realPub),
+			Amount:      input.Amount,
+			RingOffsets: offsets,
+		},
+	}
+	if change := input.Amount - tx.Fee; change > 0 {
+		output, err := createOutput(Payment{
+			Recipient: keys.Subaddress(input.Account, 0).GetAddress(),
+			Amount:    change,
+		}, false)
+		if err != nil {
+			return err
+		}
+		fp.Change = output.TxOutput
+	}
+	tx.FeePayer = fp
+
+	signer, err := newRingSigner(realPriv, realPub, decoys, ring)
+	if err != nil {
+		tx.FeePayer = nil
+		return err
+	}
+	sponsorHash := types.TxSigningHash(chainID, tx.FeePayerHash())
+	sig, err := signer.Sign(sponsorHash[:])
+	if err != nil {
+		tx.FeePayer = nil
+		return err
+	}
+	fp.RingSignature = sig
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package wallet
+
+import (
+	"errors"
+
+	"golang.org/x/crypto/ed25519"
+
+	"blockchain/crypto"
+	"blockchain/types"
+)
+
+// SignStakingTx signs a staking transaction with the wallet's spend key,
+// which is the validator key, binding it to chainID and its nonce
+func SignStakingTx(keys *crypto.WalletKeys, stx *types.StakingTx, chainID string) error {
+	if !keys.CanSpend() {
+		return errors.New("view-only wallet cannot sign staking transactions")
+	}
+	if stx.Validator != keys.SpendKeyPair.PublicKey {
+		return errors.New("staking transaction is for another validator")
+	}
+
+	sigHash := stx.SigningHash(chainID)
+	copy(stx.Signature[:], ed25519.Sign(keys.SpendKeyPair.PrivateKey, sigHash[:]))
+	return nil
+}
+
+// BuildStakeRelease returns a transaction paying the validator's stake
+// back to the wallet once unbonding ends at height until. It is signed
+// with the spend key, like staking transactions.
+func BuildStakeRelease(keys *crypto.WalletKeys, stake, until uint64, chainID string) (*types.Transaction, error) {
+	if !keys.CanSpend() {
+		return nil, errors.New("view-only wallet cannot release stake")
+	}
+
+	addr := keys.GetAddress()
+	output, ephemeral, err := crypto.GenerateStealthAddress(addr)
+	if err != nil {
+		return nil, err
+	}
+	output.Amount = stake
+	tag := crypto.ViewTag(ephemeral, addr)
+	output.ViewTag = &tag
+
+	tx := &types.Transaction{
+		Version: types.TxVersionBond,
+		Outputs: []*types.TxOutput{output},
+		Release: &types.StakeRelease{Validator: keys.SpendKeyPair.PublicKey, Until: until},
+	}
+	sigHash := types.ReleaseSigningHash(chainID, tx.PrefixHash())
+	copy(tx.Release.Signature[:], ed25519.Sign(keys.SpendKeyPair.PrivateKey, sigHash[:]))
+	return tx, nil
+}
@@ -0,0 +1,223 @@
+package wallet
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"blockchain/crypto"
+	"blockchain/types"
+	"golang.org/x/crypto/ed25519"
+)
+
+const (
+	// SwapSecretSize is the size of the secrets NewSwapSecret creates
+	SwapSecretSize = 32
+
+	// DefaultInitiatorTimeout is the refund delay, in blocks, of the
+	// party that creates the secret: about 24 hours of 2 second blocks.
+	// It must be well above the participant's, so the participant can
+	// still redeem after the secret is revealed.
+	DefaultInitiatorTimeout = 43200
+
+	// DefaultParticipantTimeout is the refund delay of the other party,
+	// about 12 hours
+	DefaultParticipantTimeout = 21600
+)
+
+// NewSwapSecret creates a random swap secret and its hash
+func NewSwapSecret() ([]byte, types.Hash, error) {
+	secret := make([]byte, SwapSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, types.Hash{}, err
+	}
+	return secret, sha256.Sum256(secret), nil
+}
+
+// NewSwapKey derives the wallet's next swap key
+func (m *Metadata) NewSwapKey(keys *crypto.WalletKeys) (*crypto.KeyPair, error) {
+	key, err := keys.SwapKey(m.SwapKeys)
+	if err != nil {
+		return nil, err
+	}
+	m.SwapKeys++
+	return key, nil
+}
+
+// FindSwapKey returns the wallet's swap key with public key pub
+func (m *Metadata) FindSwapKey(keys *crypto.WalletKeys, pub types.PublicKey) (*crypto.KeyPair, error) {
+	for i := uint32(0); i < m.SwapKeys; i++ {
+		key, err := keys.SwapKey(i)
+		if err != nil {
+			return nil, err
+		}
+		if key.PublicKey == pub {
+			return key, nil
+		}
+	}
+	return nil, errors.New("key is not one of this wallet's swap keys")
+}
+
+// SaveSwapSecret keeps the secret of a swap this wallet initiated
+func (m *Metadata) SaveSwapSecret(secret []byte) {
+	hash := types.Hash(sha256.Sum256(secret))
+	m.SwapSecrets[hash.String()] = hex.EncodeToString(secret)
+}
+
+// SwapSecret returns the saved secret for a hash lock, if any
+func (m *Metadata) SwapSecret(hash types.Hash) ([]byte, bool) {
+	s, ok := m.SwapSecrets[hash.String()]
+	if !ok {
+		return nil, false
+	}
+	secret, err := hex.DecodeString(s)
+	return secret, err == nil
+}
+
+// HashLockOutput is a hash-locked output found on chain, with how it was
+// spent
+type HashLockOutput struct {
+	TxHash      types.Hash
+	OutputIndex uint32
+	Amount      uint64
+	BlockHeight uint64
+	Lock        *types.HashLock
+
+	Spent       bool
+	SpentTxHash types.Hash
+	Preimage    []byte // Secret revealed by a redeem; empty for refunds
+}
+
+// Ref returns the output reference string, <tx_hash>:<index>
+func (o *HashLockOutput) Ref() string {
+	return FormatOutputRef(o.TxHash, o.OutputIndex)
+}
+
+// FindHashLock looks up a hash-locked output and whether it was
+// redeemed or refunded. It scans the chain, since spends are found by
+// reference rather than by key.
+func FindHashLock(chain ChainReader, txHash types.Hash, index uint32) (*HashLockOutput, error) {
+	latest, err := chain.GetLatestHeight()
+	if err != nil {
+		return nil, err
+	}
+
+	var found *HashLockOutput
+	for height := uint64(1); height <= latest; height++ {
+		block, err := chain.GetBlock(height)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, tx := range block.Transactions {
+			if found == nil {
+				if tx.Hash() != txHash {
+					continue
+				}
+				outputs := tx.AllOutputs()
+				if int(index) >= len(outputs) || outputs[index].HashLock == nil {
+					return nil, fmt.Errorf("output %s is not hash-locked", FormatOutputRef(txHash, index))
+				}
+				found = &HashLockOutput{
+					TxHash:      txHash,
+					OutputIndex: index,
+					Amount:      outputs[index].Amount,
+					BlockHeight: height,
+					Lock:        outputs[index].HashLock,
+				}
+				continue
+			}
+
+			for _, in := range tx.Inputs {
+				if spend := in.HashLock; spend != nil && spend.TxHash == txHash && spend.OutputIndex == index {
+					found.Spent = true
+					found.SpentTxHash = tx.Hash()
+					found.Preimage = spend.Preimage
+					return found, nil
+				}
+			}
+		}
+	}
+
+	if found == nil {
+		return nil, fmt.Errorf("output %s not found on chain", FormatOutputRef(txHash, index))
+	}
+	return found, nil
+}
+
+// BuildHashLockSpend builds a transaction moving a hash-locked output to
+// the wallet's main address, less the fee. With a secret it redeems the
+// output and key must be the recipient key; without one it is a refund
+// signed by the refund key.
+func BuildHashLockSpend(keys *crypto.WalletKeys, chain ChainReader, out *HashLockOutput, secret []byte, key *crypto.KeyPair, fee uint64) (*types.Transaction, error) {
+	if out.Spent {
+		return nil, fmt.Errorf("output %s was already spent by %s", out.Ref(), out.SpentTxHash)
+	}
+	if out.Amount <= fee {
+		return nil, fmt.Errorf("output %s holds %d, not enough for fee %d", out.Ref(), out.Amount, fee)
+	}
+
+	want := out.Lock.RefundKey
+	if secret != nil {
+		if types.Hash(sha256.Sum256(secret)) != out.Lock.Hash {
+			return nil, errors.New("secret does not match the hash lock")
+		}
+		want = out.Lock.RecipientKey
+	}
+	if key.PublicKey != want {
+		return nil, errors.New("key cannot sign this spend")
+	}
+
+	chainID, err := chain.GetChainID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chain ID: %w", err)
+	}
+
+	output, err := createOutput(Payment{Recipient: keys.GetAddress(), Amount: out.Amount - fee}, false)
+	if err != nil {
+		return nil, err
+	}
+
+	spend := &types.HashLockSpend{
+		TxHash:      out.TxHash,
+		OutputIndex: out.OutputIndex,
+		Preimage:    secret,
+	}
+	tx := &types.Transaction{
+		Version: types.TxVersionHashLock,
+		Inputs: []*types.TxInput{
+			{
+				KeyImage: crypto.HashLockKeyImage(out.TxHash, out.OutputIndex),
+				Amount:   out.Amount,
+				HashLock: spend,
+			},
+		},
+		Outputs: []*types.TxOutput{output.TxOutput},
+		Fee:     fee,
+	}
+
+	sigHash := types.TxSigningHash(chainID, tx.PrefixHash())
+	copy(spend.Signature[:], ed25519.Sign(key.PrivateKey, sigHash[:]))
+
+	return tx, nil
+}
+
+// ParseSwapKey parses a swap public key in hex
+func ParseSwapKey(s string) (types.PublicKey, error) {
+	var key types.PublicKey
+	if err := decodeHex(s, key[:]); err != nil {
+		return key, fmt.Errorf("invalid swap key: %w", err)
+	}
+	return key, nil
+}
+
+// ParseSwapHash parses the hex hash of a swap secret
+func ParseSwapHash(s string) (types.Hash, error) {
+	var hash types.Hash
+	if err := decodeHex(s, hash[:]); err != nil {
+		return hash, fmt.Errorf("invalid swap hash: %w", err)
+	}
+	return hash, nil
+}
@@ -0,0 +1,147 @@
+package wallet
+
+import (
+	"slices"
+
+	"blockchain/crypto"
+	"blockchain/types"
+)
+
+// ScanCache is a scan checkpoint kept in the wallet metadata, so each
+// sync only reads the blocks added since the last one
+type ScanCache struct {
+	// Wallet and subaddresses the outputs were scanned for
+	ViewKey      types.PublicKey   `json:"view_key"`
+	Subaddresses []SubaddressIndex `json:"subaddresses,omitempty"`
+
+	// Last block scanned, and its hash to notice a replaced chain
+	Height    uint64     `json:"height"`
+	BlockHash types.Hash `json:"block_hash"`
+
+	// Outputs found up to Height, with spends detected so far
+	Outputs []*OwnedOutput `json:"outputs"`
+}
+
+// Rewind forgets everything the cache learned from height on, outputs
+// received and spends made there, so the next Sync rescans from height
+func (c *ScanCache) Rewind(height uint64) {
+	if height == 0 {
+		height = 1
+	}
+	if c.Height < height {
+		return
+	}
+
+	kept := make([]*OwnedOutput, 0, len(c.Outputs))
+	for _, out := range c.Outputs {
+		if out.BlockHeight >= height {
+			continue
+		}
+		// Spends found by key image lookup have no height; the next
+		// sync checks them again
+		if out.Spent && (out.SpentHeight >= height || out.SpentHeight == 0) {
+			out.Spent = false
+			out.SpentTxHash = types.Hash{}
+			out.SpentHeight = 0
+		}
+		kept = append(kept, out)
+	}
+
+	c.Outputs = kept
+	c.Height = height - 1
+	c.BlockHash = types.Hash{}
+}
+
+// Sync brings the cache up to the chain tip and returns the wallet's
+// outputs. It starts over from genesis when the cache belongs to other
+// keys or subaddresses, or when the chain no longer contains the block
+// it ended at. The returned outputs are copies, so callers may annotate
+// them (frozen flags, imported key images) without touching the cache.
+func Sync(keys *crypto.WalletKeys, chain ChainReader, cache *ScanCache, subaddresses ...SubaddressIndex) (*ScanResult, error) {
+	if err := cache.prepare(keys, chain, subaddresses); err != nil {
+		return nil, err
+	}
+
+	result, lastHash, err := scanFrom(keys, chain, cache.Height+1, cache.Outputs, subaddresses)
+	if err != nil {
+		return nil, err
+	}
+
+	cache.Outputs = result.Outputs
+	if result.ScannedHeight > cache.Height {
+		cache.Height = result.ScannedHeight
+		cache.BlockHash = lastHash
+	}
+
+	return result.clone(), nil
+}
+
+// prepare resets the cache unless it can be continued for keys and
+// subaddresses on chain
+func (c *ScanCache) prepare(keys *crypto.WalletKeys, chain ChainReader, subaddresses []SubaddressIndex) error {
+	viewKey := keys.GetAddress().ViewKey
+
+	valid, err := c.valid(chain, viewKey, subaddresses)
+	if err != nil {
+		return err
+	}
+	if !valid {
+		*c = ScanCache{ViewKey: viewKey, Subaddresses: slices.Clone(subaddresses)}
+	}
+	return nil
+}
+
+// valid reports whether the cache can be continued for viewKey and
+// subaddresses on chain
+func (c *ScanCache) valid(chain ChainReader, viewKey types.PublicKey, subaddresses []SubaddressIndex) (bool, error) {
+	if c.ViewKey != viewKey || !slices.Equal(c.Subaddresses, subaddresses) {
+		return false, nil
+	}
+	if c.Height == 0 {
+		return true, nil
+	}
+	if c.BlockHash == (types.Hash{}) {
+		// Rewound: the block below the rewind point was checked when
+		// the cache last synced past it
+		return true, nil
+	}
+
+	latest, err := chain.GetLatestHeight()
+	if err != nil {
+		return false, err
+	}
+	if latest < c.Height {
+		return false, nil
+	}
+
+	block, err := chain.GetBlock(c.Height)
+	if err != nil {
+		return false, err
+	}
+	return block.Header.Hash() == c.BlockHash, nil
+}
+
+// clone returns a copy of the cache with copied outputs
+func (c *ScanCache) clone() *ScanCache {
+	if c == nil {
+		return &ScanCache{}
+	}
+	copied := *c
+	copied.Subaddresses = slices.Clone(c.Subaddresses)
+	copied.Outputs = copyOutputs(c.Outputs)
+	return &copied
+}
+
+// clone returns a copy of the result with copied outputs
+func (r *ScanResult) clone() *ScanResult {
+	return &ScanResult{Outputs: copyOutputs(r.Outputs), ScannedHeight: r.ScannedHeight, ViewOnly: r.ViewOnly}
+}
+
+func copyOutputs(outputs []*OwnedOutput) []*OwnedOutput {
+	copied := make([]*OwnedOutput, len(outputs))
+	for i, out := range outputs {
+		o := *out
+		copied[i] = &o
+	}
+	return copied
+}
@@ -0,0 +1,40 @@
+package wallet
+
+import (
+	"fmt"
+
+	"blockchain/types"
+)
+
+// ProtocolReader is implemented by chains that report the protocol
+// version of the next block, such as RemoteChain
+type ProtocolReader interface {
+	GetNextProtocolVersion() (uint32, error)
+}
+
+// GetNextProtocolVersion implements ProtocolReader
+func (rc *RemoteChain) GetNextProtocolVersion() (uint32, error) {
+	var info struct {
+		Height uint64             `json:"height"`
+		Forks  types.ForkSchedule `json:"forks"`
+	}
+	if err := rc.client.Call("getForks", nil, &info); err != nil {
+		return 0, err
+	}
+	return info.Forks.VersionAt(info.Height + 1), nil
+}
+
+// viewTagsActive reports whether outputs of the next block may carry
+// view tags. Chains that cannot report their protocol version get none,
+// which every version accepts.
+func viewTagsActive(chain ChainReader) (bool, error) {
+	reader, ok := chain.(ProtocolReader)
+	if !ok {
+		return false, nil
+	}
+	version, err := reader.GetNextProtocolVersion()
+	if err != nil {
+		return false, fmt.Errorf("failed to get protocol version: %w", err)
+	}
+	return version >= types.TxVersionViewTag, nil
+}
@@ -0,0 +1,99 @@
+package wallet
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"blockchain/crypto"
+	"blockchain/types"
+)
+
+// DefaultFile is the wallet file used when no path is given
+const DefaultFile = "wallet.json"
+
+// FormatViewOnly marks a watch-only wallet file
+const FormatViewOnly = "view-only"
+
+// viewOnlyFile is the on-disk format for watch-only wallets.
+// It holds the private view key but only the public spend key.
+type viewOnlyFile struct {
+	Format      string          `json:"format"`
+	ViewKeyPair *crypto.KeyPair `json:"view_key_pair"`
+	SpendKey    types.PublicKey `json:"spend_public_key"`
+	Network     types.Network   `json:"network,omitempty"`
+}
+
+// fullFile is the on-disk format for wallets that can spend
+type fullFile struct {
+	*crypto.WalletKeys
+	Network types.Network `json:"network,omitempty"`
+}
+
+// Load reads a full or view-only wallet file
+func Load(path string) (*crypto.WalletKeys, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("wallet file not found. Run 'wallet generate' first")
+	}
+
+	// Detect the file format before decoding
+	var probe struct {
+		Format string `json:"format"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, err
+	}
+
+	if probe.Format == FormatMultisig {
+		return nil, errors.New("this is a multisig wallet; use the 'wallet multisig' commands")
+	}
+
+	if probe.Format == FormatViewOnly {
+		var vf viewOnlyFile
+		if err := json.Unmarshal(data, &vf); err != nil {
+			return nil, err
+		}
+		if vf.ViewKeyPair == nil {
+			return nil, errors.New("view-only wallet is missing its view key")
+		}
+
+		return &crypto.WalletKeys{
+			ViewKeyPair:  vf.ViewKeyPair,
+			SpendKeyPair: &crypto.KeyPair{PublicKey: vf.SpendKey},
+		}, nil
+	}
+
+	var keys crypto.WalletKeys
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, err
+	}
+	if keys.ViewKeyPair == nil || keys.SpendKeyPair == nil {
+		return nil, errors.New("wallet file is missing keys")
+	}
+
+	return &keys, nil
+}
+
+// Save writes wallet keys of network to disk (see LoadNetwork). Keys
+// without a private spend key
+// are written in the view-only format.
+func Save(path string, keys *crypto.WalletKeys, network types.Network) error {
+	var v interface{} = &fullFile{WalletKeys: keys, Network: network}
+	if !keys.CanSpend() {
+		v = &viewOnlyFile{
+			Format:      FormatViewOnly,
+			ViewKeyPair: keys.ViewKeyPair,
+			SpendKey:    keys.SpendKeyPair.PublicKey,
+			Network:     network,
+		}
+	}
+
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0600)
+}
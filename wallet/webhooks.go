@@ -0,0 +1,107 @@
+package wallet
+
+import (
+	"blockchain/notify"
+	"blockchain/types"
+)
+
+// PaymentEvent is the data of a payment_received webhook
+type PaymentEvent struct {
+	TxHash      string `json:"tx_hash"`
+	OutputIndex uint32 `json:"output_index"`
+	Amount      uint64 `json:"amount"`
+	Height      uint64 `json:"height"`
+	Address     string `json:"address"` // Address paid, main or subaddress
+	Account     uint32 `json:"account"`
+	Subaddress  uint32 `json:"subaddress"`
+	PaymentID   string `json:"payment_id,omitempty"`
+	Memo        string `json:"memo,omitempty"`
+}
+
+// TxFinalizedEvent is the data of a tx_finalized webhook, sent when a
+// transaction spending the wallet's outputs is included in a block
+type TxFinalizedEvent struct {
+	TxHash string   `json:"tx_hash"`
+	Height uint64   `json:"height"`
+	Spent  uint64   `json:"spent"`  // Total of the wallet's outputs spent
+	Inputs []string `json:"inputs"` // "<tx_hash>:<index>" of each
+}
+
+// BlockEvent is the data of a block webhook. Blocks found by the same
+// scan are reported together, by the new tip.
+type BlockEvent struct {
+	Height     uint64 `json:"height"`
+	Hash       string `json:"hash"`
+	FromHeight uint64 `json:"from_height"` // First new block
+}
+
+// SetNotifier makes the daemon send webhooks for what each scan after
+// the first finds. Call it before Start.
+func (d *Daemon) SetNotifier(n *notify.Notifier) {
+	d.notifier = n
+}
+
+// notify sends the webhooks for a sync that advanced the wallet from
+// height prev to cache
+func (d *Daemon) notify(prev uint64, cache *ScanCache, result *ScanResult) {
+	n := d.notifier
+	if n == nil || cache.Height <= prev {
+		return
+	}
+
+	if n.Wants(notify.EventBlock) {
+		n.Notify(&notify.Event{
+			ID:   "block:" + cache.BlockHash.String(),
+			Type: notify.EventBlock,
+			Data: &BlockEvent{
+				Height:     cache.Height,
+				Hash:       cache.BlockHash.String(),
+				FromHeight: prev + 1,
+			},
+		})
+	}
+
+	if n.Wants(notify.EventPaymentReceived) {
+		for _, out := range result.Outputs {
+			if out.BlockHeight <= prev {
+				continue
+			}
+			ref := FormatOutputRef(out.TxHash, out.OutputIndex)
+			data := &PaymentEvent{
+				TxHash:      out.TxHash.String(),
+				OutputIndex: out.OutputIndex,
+				Amount:      out.Amount,
+				Height:      out.BlockHeight,
+				Address:     FormatAddress(d.network, SubaddressAddress(d.keys, SubaddressIndex{Account: out.Account, Index: out.Subaddress})),
+				Account:     out.Account,
+				Subaddress:  out.Subaddress,
+				Memo:        string(out.Memo),
+			}
+			if out.PaymentID != nil {
+				data.PaymentID = out.PaymentID.String()
+			}
+			n.Notify(&notify.Event{ID: "payment:" + ref, Type: notify.EventPaymentReceived, Data: data})
+		}
+	}
+
+	if n.Wants(notify.EventTxFinalized) {
+		spends := make(map[types.Hash]*TxFinalizedEvent)
+		order := make([]types.Hash, 0)
+		for _, out := range result.Outputs {
+			if !out.Spent || out.SpentHeight <= prev || out.SpentTxHash == (types.Hash{}) {
+				continue
+			}
+			e, ok := spends[out.SpentTxHash]
+			if !ok {
+				e = &TxFinalizedEvent{TxHash: out.SpentTxHash.String(), Height: out.SpentHeight}
+				spends[out.SpentTxHash] = e
+				order = append(order, out.SpentTxHash)
+			}
+			e.Spent += out.Amount
+			e.Inputs = append(e.Inputs, FormatOutputRef(out.TxHash, out.OutputIndex))
+		}
+		for _, hash := range order {
+			n.Notify(&notify.Event{ID: "tx_finalized:" + hash.String(), Type: notify.EventTxFinalized, Data: spends[hash]})
+		}
+	}
+}